@@ -1,24 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"encoding/hex"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"strings"
 
 	"guide.apparel/ntag424"
 )
 
 func main() {
 	var (
-		uidHex     = flag.String("uid", "", "14-char hex string (7-byte tag UID, required)")
-		counter    = flag.Uint("ctr", 0, "SDM read counter value")
-		sdmKeyFile = flag.String("sdm-key-file", "../keys/SDMEncryptionKey.hex", "Path to SDM key .hex file")
-		baseURL    = flag.String("url", "https://api.guideapparel.com/tap", "Base URL")
-		verify     = flag.Bool("verify", false, "Self-verify the generated URL")
-		verbose    = flag.Bool("v", false, "Enable debug logging")
-		logFormat  = flag.String("log-format", "text", "Log format: text or json")
+		uidHex      = flag.String("uid", "", "14-char hex string (7-byte tag UID, required)")
+		counter     = flag.Uint("ctr", 0, "SDM read counter value")
+		ctrStart    = flag.Uint("ctr-start", 0, "First counter of a batch range (inclusive)")
+		ctrEnd      = flag.Uint("ctr-end", 0, "Last counter of a batch range (inclusive)")
+		outFile     = flag.String("out", "", "Batch mode: write URLs to this file instead of stdout")
+		sdmKeyFile  = flag.String("sdm-key-file", "../keys/SDMEncryptionKey.hex", "Path to SDM key .hex file")
+		metaKeyFile = flag.String("meta-key-file", "", "Encrypted PICC mode: path to SDM meta read key .hex file")
+		baseURL     = flag.String("url", "https://api.guideapparel.com/tap", "Base URL")
+		verify      = flag.Bool("verify", false, "Self-verify the generated URL")
+		decode      = flag.String("decode", "", "Decode-only: verify this scanned SDM URL and print its contents")
+		verbose     = flag.Bool("v", false, "Enable debug logging")
+		logFormat   = flag.String("log-format", "text", "Log format: text or json")
 	)
 	flag.Parse()
 
@@ -46,6 +54,36 @@ func main() {
 	}
 	slog.SetDefault(logger)
 
+	// -decode checks a scanned URL instead of generating one
+	if *decode != "" {
+		sdmKey, err := ntag424.LoadKeyHexFile(*sdmKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading SDM key: %v\n", err)
+			os.Exit(1)
+		}
+		var metaKey []byte
+		if *metaKeyFile != "" {
+			metaKey, err = ntag424.LoadKeyHexFile(*metaKeyFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading SDM meta key: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("SDM key: %s\n", *sdmKeyFile)
+		if metaKey != nil {
+			fmt.Printf("Meta key: %s\n", *metaKeyFile)
+		}
+		match, err := decodeURL(*decode, sdmKey, metaKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding URL: %v\n", err)
+			os.Exit(1)
+		}
+		if !match {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Validate required flags
 	if *uidHex == "" {
 		fmt.Fprintf(os.Stderr, "Error: -uid is required\n")
@@ -63,6 +101,27 @@ func main() {
 		os.Exit(1)
 	}
 
+	// -ctr-start/-ctr-end switch to batch mode
+	batch := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ctr-start" || f.Name == "ctr-end" {
+			batch = true
+		}
+	})
+	if batch {
+		if *ctrEnd > 0xFFFFFF {
+			fmt.Fprintf(os.Stderr, "Error: -ctr-end must be <= 0xFFFFFF, got %d\n", *ctrEnd)
+			os.Exit(1)
+		}
+		if *ctrStart > *ctrEnd {
+			fmt.Fprintf(os.Stderr, "Error: -ctr-start (%d) must be <= -ctr-end (%d)\n", *ctrStart, *ctrEnd)
+			os.Exit(1)
+		}
+	} else if *outFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: -out requires -ctr-start/-ctr-end\n")
+		os.Exit(1)
+	}
+
 	// Load SDM key
 	slog.Debug("Loading SDM key", "path", *sdmKeyFile)
 	sdmKey, err := ntag424.LoadKeyHexFile(*sdmKeyFile)
@@ -72,6 +131,17 @@ func main() {
 	}
 	slog.Debug("SDM key loaded", "key", fmt.Sprintf("%X", sdmKey))
 
+	// A meta key switches to encrypted PICC data (picc_data=) URLs
+	var metaKey []byte
+	if *metaKeyFile != "" {
+		slog.Debug("Loading SDM meta key", "path", *metaKeyFile)
+		metaKey, err = ntag424.LoadKeyHexFile(*metaKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading SDM meta key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Parse UID
 	slog.Debug("Parsing UID", "uid", *uidHex)
 	uid, err := hex.DecodeString(*uidHex)
@@ -85,9 +155,22 @@ func main() {
 	}
 	slog.Debug("UID parsed", "bytes", uid)
 
+	if batch {
+		if err := generateBatch(*baseURL, uid, sdmKey, metaKey, uint32(*ctrStart), uint32(*ctrEnd), *outFile, *verify); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Generate SDM URL
 	slog.Debug("Generating SDM URL", "baseURL", *baseURL, "counter", *counter)
-	generatedURL, err := ntag424.GenerateSDMURL(*baseURL, uid, uint32(*counter), sdmKey)
+	var generatedURL string
+	if metaKey != nil {
+		generatedURL, err = ntag424.GenerateSDMURLEncryptedPICC(*baseURL, uid, uint32(*counter), metaKey, sdmKey)
+	} else {
+		generatedURL, err = ntag424.GenerateSDMURL(*baseURL, uid, uint32(*counter), sdmKey)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating SDM URL: %v\n", err)
 		os.Exit(1)
@@ -95,6 +178,9 @@ func main() {
 
 	// Print output
 	fmt.Printf("SDM key: %s\n", *sdmKeyFile)
+	if metaKey != nil {
+		fmt.Printf("Meta key: %s\n", *metaKeyFile)
+	}
 	fmt.Printf("UID:     %s\n", *uidHex)
 	fmt.Printf("Counter: %d\n", *counter)
 	fmt.Printf("URL:     %s\n", generatedURL)
@@ -102,7 +188,7 @@ func main() {
 	// Verify if requested
 	if *verify {
 		slog.Debug("Verifying generated URL")
-		match, err := ntag424.VerifySDMMAC(generatedURL, sdmKey)
+		match, err := verifyURL(generatedURL, sdmKey, metaKey)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error verifying URL: %v\n", err)
 			os.Exit(1)
@@ -115,3 +201,122 @@ func main() {
 		}
 	}
 }
+
+// verifyURL checks a generated URL, decrypting picc_data with metaKey when
+// it is set.
+func verifyURL(u string, sdmKey, metaKey []byte) (bool, error) {
+	if metaKey != nil {
+		match, _, _, err := ntag424.VerifySDMMACEncryptedPICC(u, metaKey, sdmKey)
+		return match, err
+	}
+	return ntag424.VerifySDMMAC(u, sdmKey)
+}
+
+// decodeURL verifies a scanned SDM URL and prints the UID, counter, the
+// URL's MAC next to the computed one, and the verdict. A picc_data= URL (or
+// a non-nil metaKey) is decrypted with metaKey first. Returns whether the
+// MAC matches.
+func decodeURL(rawURL string, sdmKey, metaKey []byte) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	q := u.Query()
+	fmt.Printf("URL:      %s\n", rawURL)
+
+	if metaKey != nil || q.Has("picc_data") {
+		if metaKey == nil {
+			return false, fmt.Errorf("URL carries picc_data; -meta-key-file is required to decrypt it")
+		}
+		match, uid, counter, computed, err := ntag424.VerifySDMMACEncryptedPICCDetailed(rawURL, metaKey, sdmKey)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("Mode:     encrypted PICC data\n")
+		fmt.Printf("UID:      %X\n", uid)
+		fmt.Printf("Counter:  %d (0x%06X)\n", counter, counter)
+		fmt.Printf("MAC:      %s (expected)\n", strings.ToUpper(q.Get("mac")))
+		fmt.Printf("Computed: %s\n", computed)
+		printMatch(match)
+		return match, nil
+	}
+
+	uid, _, mac, err := ntag424.ParseSDMURL(rawURL)
+	if err != nil {
+		return false, err
+	}
+	match, counter, computed, err := ntag424.VerifySDMMACDetailed(rawURL, sdmKey)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Mode:     plain UID/counter\n")
+	fmt.Printf("UID:      %s\n", strings.ToUpper(uid))
+	fmt.Printf("Counter:  %d (0x%06X)\n", counter, counter)
+	fmt.Printf("MAC:      %s (expected)\n", strings.ToUpper(mac))
+	fmt.Printf("Computed: %s\n", computed)
+	printMatch(match)
+	return match, nil
+}
+
+func printMatch(match bool) {
+	if match {
+		fmt.Printf("Verify:   OK\n")
+	} else {
+		fmt.Printf("Verify:   MISMATCH\n")
+	}
+}
+
+// generateBatch writes one SDM URL per line for every counter in
+// [start, end] to outPath, or stdout when outPath is empty. A non-nil
+// metaKey produces encrypted PICC data URLs.
+func generateBatch(baseURL string, uid, sdmKey, metaKey []byte, start, end uint32, outPath string, verify bool) error {
+	gen, err := ntag424.NewSDMURLGenerator(baseURL, uid, sdmKey, ntag424.DefaultSDMParamConfig())
+	if err != nil {
+		return fmt.Errorf("generating SDM URLs: %w", err)
+	}
+	generate := gen.Generate
+	if metaKey != nil {
+		generate = func(ctr uint32) (string, error) {
+			return ntag424.GenerateSDMURLEncryptedPICC(baseURL, uid, ctr, metaKey, sdmKey)
+		}
+	}
+
+	out := os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	slog.Debug("Generating SDM URL batch", "baseURL", baseURL, "start", start, "end", end)
+	for ctr := uint64(start); ctr <= uint64(end); ctr++ {
+		u, err := generate(uint32(ctr))
+		if err != nil {
+			return fmt.Errorf("generating SDM URL for counter %d: %w", ctr, err)
+		}
+		if verify {
+			match, err := verifyURL(u, sdmKey, metaKey)
+			if err != nil {
+				return fmt.Errorf("verifying URL for counter %d: %w", ctr, err)
+			}
+			if !match {
+				return fmt.Errorf("verify failed for counter %d: %s", ctr, u)
+			}
+		}
+		if _, err := fmt.Fprintln(w, u); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+
+	if outPath != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d URLs to %s\n", uint64(end)-uint64(start)+1, outPath)
+	}
+	return nil
+}
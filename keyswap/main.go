@@ -1,15 +1,16 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/barnettlynn/nfctools/pkg/ntag424/prompt"
 	"github.com/ebfe/scard"
-	"golang.org/x/term"
 )
 
 // ============================================================================
@@ -25,85 +26,51 @@ type probeResult struct {
 // Card I/O
 // ============================================================================
 
-func selectMenu(prompt string, items []string) int {
-	if len(items) == 0 {
-		return -1
+// selectMenu asks p to choose from items, exiting on Ctrl-C or a prompt error.
+func selectMenu(p prompt.Prompter, title string, items []string) int {
+	idx, err := p.Select(title, items)
+	if errors.Is(err, prompt.ErrPromptAborted) {
+		os.Exit(0)
 	}
-
-	// Put stdin into raw mode
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error setting raw mode: %v\r\n", err)
-		return -1
-	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
-
-	selected := 0
-
-	// Initial render
-	fmt.Printf("%s\r\n", prompt)
-	for i, item := range items {
-		if i == selected {
-			fmt.Printf("> %s\r\n", item)
-		} else {
-			fmt.Printf("  %s\r\n", item)
-		}
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
+	return idx
+}
 
-	// Read loop
-	buf := make([]byte, 3)
+// inputKeyVersion asks p for a key version byte, accepting hex with or
+// without 0x; an empty answer takes def. It re-asks until the answer parses
+// and exits on Ctrl-C or a prompt error.
+func inputKeyVersion(p prompt.Prompter, title, def string) byte {
 	for {
-		n, err := os.Stdin.Read(buf)
+		answer, err := p.Input(title, def)
+		if errors.Is(err, prompt.ErrPromptAborted) {
+			os.Exit(0)
+		}
 		if err != nil {
-			break
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-
-		if n == 1 {
-			// Single byte commands
-			switch buf[0] {
-			case 0x0D, 0x0A: // Enter
-				// Move cursor down past menu, then restore terminal
-				fmt.Printf("\r\n")
-				return selected
-			case 0x03: // Ctrl-C
-				term.Restore(int(os.Stdin.Fd()), oldState)
-				fmt.Printf("\r\n")
-				os.Exit(0)
-			}
-		} else if n == 3 && buf[0] == 0x1B && buf[1] == '[' {
-			// Arrow keys
-			needRedraw := false
-			switch buf[2] {
-			case 'A': // Up arrow
-				if selected > 0 {
-					selected--
-					needRedraw = true
-				}
-			case 'B': // Down arrow
-				if selected < len(items)-1 {
-					selected++
-					needRedraw = true
-				}
-			}
-
-			if needRedraw {
-				// Move cursor up to start of menu (skip prompt line)
-				fmt.Printf("\033[%dA", len(items))
-				// Redraw all items
-				for i, item := range items {
-					// Clear line and return to column 0
-					fmt.Print("\033[2K\r")
-					if i == selected {
-						fmt.Printf("> %s\r\n", item)
-					} else {
-						fmt.Printf("  %s\r\n", item)
-					}
-				}
-			}
+		v, err := parseKeyVersion(answer)
+		if err == nil {
+			return v
 		}
+		fmt.Printf("Invalid key version: %v\n", err)
 	}
+}
 
-	return selected
+// parseKeyVersion parses a key version as one hex byte, with or without a
+// 0x prefix; anything after the first space (e.g. "(minter default)") is
+// ignored.
+func parseKeyVersion(s string) (byte, error) {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), " ")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	v, err := strconv.ParseUint(s, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a hex byte 00-FF", s)
+	}
+	return byte(v), nil
 }
 
 // ============================================================================
@@ -113,6 +80,10 @@ func selectMenu(prompt string, items []string) int {
 func main() {
 	verbose := flag.Bool("v", false, "enable debug logging")
 	logFormat := flag.String("log-format", "text", "log format: text or json")
+	slotRolesFile := flag.String("slot-roles", "", "YAML file with slot_roles labels for key slots (default: standard layout)")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
+	rotateSpec := flag.String("rotate", "", "change several slots in one session, e.g. 1=newsdm.hex,2=newwrite.hex,0=newmaster.hex")
+	rotateVersion := flag.Uint("key-version", 0x01, "key version stored with each key changed by -rotate")
 	flag.Parse()
 
 	// Configure slog
@@ -126,6 +97,25 @@ func main() {
 	} else {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
 	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Printf("Error creating trace file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		enableAPDUTrace(f)
+	}
+
+	slotRoles := defaultSlotRoles()
+	if *slotRolesFile != "" {
+		roles, err := loadSlotRoles(*slotRolesFile)
+		if err != nil {
+			fmt.Printf("Error loading slot roles: %v\n", err)
+			os.Exit(1)
+		}
+		slotRoles = roles
+	}
 
 	fmt.Println("=== NTAG 424 DNA Key Swap Tool ===")
 	fmt.Println()
@@ -177,32 +167,29 @@ func main() {
 	type keyInfo struct {
 		key   []byte
 		label string
+		slot  int // declared slot, -1 to try every slot
 	}
 
 	keys := []keyInfo{
-		{make([]byte, 16), "all-zero"},
+		{make([]byte, 16), "all-zero", -1},
 	}
 
 	// Load keys from ../keys/
-	keyFiles, err := loadAllHexKeys("../keys")
+	keyFiles, err := loadAllKeys("../keys")
 	if err == nil {
 		for _, kf := range keyFiles {
-			keys = append(keys, keyInfo{kf.key, kf.name})
+			keys = append(keys, keyInfo{kf.key, kf.name, kf.slot})
 		}
 	}
 
 	// Probe each slot
 	slotKeys := make(map[byte]probeResult)
-	slotRoles := map[byte]string{
-		0: "AppMaster",
-		1: "SDM",
-		2: "File Two Write",
-		3: "read/write",
-		4: "read/write",
-	}
 
 	for slot := byte(0); slot <= 4; slot++ {
 		for _, k := range keys {
+			if k.slot >= 0 && k.slot != int(slot) {
+				continue
+			}
 			if err := selectNDEFApp(card); err != nil {
 				continue
 			}
@@ -232,7 +219,17 @@ func main() {
 	}
 	fmt.Println()
 
+	if *rotateSpec != "" {
+		if *rotateVersion > 0xFF {
+			fmt.Printf("Error: -key-version must be 0x00-0xFF\n")
+			os.Exit(1)
+		}
+		runRotation(card, *rotateSpec, byte(*rotateVersion), slotKeys)
+		return
+	}
+
 	// Prompt for slot selection using arrow keys
+	prompter := prompt.NewTerminalPrompter()
 	slotItems := []string{}
 	slotOrder := []byte{0, 1, 2, 3, 4}
 	for _, slot := range slotOrder {
@@ -248,11 +245,7 @@ func main() {
 		slotItems = append(slotItems, fmt.Sprintf("%d - %-11s [%s]", slot, role, status))
 	}
 
-	selectedIdx := selectMenu("Select slot to change:", slotItems)
-	if selectedIdx < 0 {
-		fmt.Println("Invalid selection.")
-		os.Exit(1)
-	}
+	selectedIdx := selectMenu(prompter, "Select slot to change:", slotItems)
 	targetSlot := slotOrder[selectedIdx]
 
 	// Check if we know the current key for this slot
@@ -300,26 +293,30 @@ func main() {
 	}
 
 	// Prompt for new key selection using arrow keys
-	newKeyIdx := selectMenu("Select new key:", keyItems)
-	if newKeyIdx < 0 {
-		fmt.Println("Invalid selection.")
-		os.Exit(1)
-	}
+	newKeyIdx := selectMenu(prompter, "Select new key:", keyItems)
 
 	newKey := allKeys[newKeyIdx].key
 	newKeyLabel := allKeys[newKeyIdx].name
 
+	// Prompt for the key version the tag stores alongside the new key,
+	// defaulting to the version the slot holds now
+	defaultVersion := "0x01 (minter default)"
+	current, err := readKeyVersion(card, targetSlot)
+	if err != nil {
+		fmt.Printf("Could not read current key version: %v\n", err)
+	} else {
+		defaultVersion = fmt.Sprintf("0x%02X", current)
+	}
+	keyVersion := inputKeyVersion(prompter, fmt.Sprintf("Key version for slot %d (hex 00-FF)", targetSlot), defaultVersion)
+
 	// Confirm
 	fmt.Println()
-	fmt.Printf("Replace slot %d key with %s? (y/n): ", targetSlot, newKeyLabel)
-	reader := bufio.NewReader(os.Stdin)
-	confirmInput, err := reader.ReadString('\n')
-	if err != nil {
+	confirmed, err := prompter.Confirm(fmt.Sprintf("Replace slot %d key with %s (version 0x%02X)?", targetSlot, newKeyLabel, keyVersion))
+	if err != nil && !errors.Is(err, prompt.ErrPromptAborted) {
 		fmt.Printf("Error reading input: %v\n", err)
 		os.Exit(1)
 	}
-	confirmInput = strings.ToLower(strings.TrimSpace(confirmInput))
-	if confirmInput != "y" && confirmInput != "yes" {
+	if !confirmed {
 		fmt.Println("Cancelled.")
 		os.Exit(0)
 	}
@@ -328,6 +325,26 @@ func main() {
 	fmt.Println()
 	fmt.Println("Changing key...")
 
+	if targetSlot == 0 {
+		// Slot 0: same-slot change, then re-select and re-authenticate with the new key
+		if err := rotateKeySame(card, targetSlot, authKey, newKey, keyVersion); err != nil {
+			fmt.Printf("Key change failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Key change successful! (verified with new key)")
+	} else {
+		changeKeyCrossSlot(card, targetSlot, authSlot, authKey, currentKey.key, newKey, keyVersion)
+	}
+
+	fmt.Println()
+	fmt.Printf("SUCCESS: Slot %d key replaced with %s (version 0x%02X)\n", targetSlot, newKeyLabel, keyVersion)
+	fmt.Printf("Authenticated with: slot %d (%s)\n", authSlot, slotKeys[authSlot].label)
+}
+
+// changeKeyCrossSlot changes a slot 1-4 key while authenticated with authSlot,
+// storing keyVersion with it, then verifies by authenticating the target slot
+// with the new key.
+func changeKeyCrossSlot(card *scard.Card, targetSlot, authSlot byte, authKey, oldKey, newKey []byte, keyVersion byte) {
 	if err := selectNDEFApp(card); err != nil {
 		fmt.Printf("Error re-selecting NDEF app: %v\n", err)
 		os.Exit(1)
@@ -339,15 +356,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	if targetSlot == 0 {
-		// Slot 0: Use changeKeySame (same-key change)
-		err = changeKeySame(card, sess, targetSlot, newKey, 0x00)
-	} else {
-		// Slots 1-4: Use changeKey (different-key change)
-		err = changeKey(card, sess, targetSlot, newKey, currentKey.key, 0x00, authSlot)
-	}
-
-	if err != nil {
+	if err := changeKeyVersioned(card, sess, targetSlot, newKey, oldKey, keyVersion, authSlot); err != nil {
 		fmt.Printf("Key change failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -356,18 +365,13 @@ func main() {
 
 	// Verify by re-authenticating with the new key
 	fmt.Println("Verifying...")
-	if err := selectNDEFApp(card); err != nil {
-		fmt.Printf("Error re-selecting NDEF app: %v\n", err)
+	ok, err := verifyKeyByReauth(card, targetSlot, newKey)
+	if err != nil {
+		fmt.Printf("Verification failed: %v\n", err)
 		os.Exit(1)
 	}
-
-	_, err = authenticateEV2First(card, newKey, targetSlot)
-	if err != nil {
-		fmt.Printf("Verification failed: Cannot authenticate with new key: %v\n", err)
+	if !ok {
+		fmt.Println("Verification failed: Cannot authenticate with new key")
 		os.Exit(1)
 	}
-
-	fmt.Println()
-	fmt.Printf("SUCCESS: Slot %d key replaced with %s\n", targetSlot, newKeyLabel)
-	fmt.Printf("Authenticated with: slot %d (%s)\n", authSlot, slotKeys[authSlot].label)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/barnettlynn/nfctools/pkg/ntag424/prompt"
+)
+
+func TestParseKeyVersion(t *testing.T) {
+	for in, want := range map[string]byte{
+		"00": 0x00, "0x10": 0x10, "ff": 0xFF, "0XA5": 0xA5, " 7 ": 0x07, "0x01 (minter default)": 0x01,
+	} {
+		if got, err := parseKeyVersion(in); err != nil || got != want {
+			t.Errorf("parseKeyVersion(%q) = 0x%02X, %v; want 0x%02X", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "100", "0xG1", "-1"} {
+		if _, err := parseKeyVersion(in); err == nil {
+			t.Errorf("parseKeyVersion(%q): expected an error", in)
+		}
+	}
+}
+
+func TestInputKeyVersionRetriesAndDefaults(t *testing.T) {
+	p := prompt.NewScriptedPrompter(
+		prompt.PromptStep{Prompt: "Key version", Text: "1FF"},
+		prompt.PromptStep{Prompt: "Key version", Text: "0x42"},
+		prompt.PromptStep{Prompt: "Key version"},
+	)
+	if v := inputKeyVersion(p, "Key version for slot 1 (hex 00-FF)", "0x10"); v != 0x42 {
+		t.Fatalf("expected 0x42 after an invalid answer, got 0x%02X", v)
+	}
+	if v := inputKeyVersion(p, "Key version for slot 1 (hex 00-FF)", "0x10"); v != 0x10 {
+		t.Fatalf("expected the current version 0x10 as default, got 0x%02X", v)
+	}
+	if !p.Done() {
+		t.Fatal("expected every scripted answer to be used")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
+	"github.com/ebfe/scard"
+)
+
+// rotateEntry is one slot=file pair from a -rotate spec.
+type rotateEntry struct {
+	slot byte
+	path string
+}
+
+// parseRotateSpec parses a -rotate spec such as
+// "1=newsdm.hex,2=newwrite.hex,0=newmaster.hex". Slots must be 0-4 and may
+// appear once; entries are returned in spec order.
+func parseRotateSpec(spec string) ([]rotateEntry, error) {
+	var entries []rotateEntry
+	seen := map[byte]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		slotStr, path, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("rotate entry %q: want slot=keyfile", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(slotStr))
+		if err != nil || n < 0 || n > 4 {
+			return nil, fmt.Errorf("rotate entry %q: slot must be 0-4", part)
+		}
+		slot := byte(n)
+		if seen[slot] {
+			return nil, fmt.Errorf("rotate spec lists slot %d twice", slot)
+		}
+		seen[slot] = true
+		entries = append(entries, rotateEntry{slot: slot, path: strings.TrimSpace(path)})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("rotate spec is empty")
+	}
+	return entries, nil
+}
+
+// planRotation builds the key changes for entries from the probed current
+// keys, in the order they are applied: slots 1-4 first, slot 0 last, since
+// the whole batch runs in one session authenticated with slot 0. Every listed
+// slot and slot 0 itself must have a known current key.
+func planRotation(entries []rotateEntry, newKeys map[byte][]byte, current map[byte]probeResult, keyVersion byte) ([]ntag424.KeyChange, error) {
+	if _, ok := current[0]; !ok {
+		return nil, fmt.Errorf("slot 0 key is unknown; cannot authenticate to change keys")
+	}
+	changes := make([]ntag424.KeyChange, 0, len(entries))
+	for _, e := range entries {
+		cur, ok := current[e.slot]
+		if !ok {
+			return nil, fmt.Errorf("current key for slot %d is unknown", e.slot)
+		}
+		changes = append(changes, ntag424.KeyChange{
+			Slot:       e.slot,
+			OldKey:     cur.key,
+			NewKey:     newKeys[e.slot],
+			NewVersion: keyVersion,
+		})
+	}
+	return ntag424.OrderKeyChanges(changes)
+}
+
+// runRotation loads the new keys named by spec, changes every listed slot in
+// one slot 0 session and verifies each slot by authenticating with its new
+// key. It exits the process on failure.
+func runRotation(card *scard.Card, spec string, keyVersion byte, current map[byte]probeResult) {
+	entries, err := parseRotateSpec(spec)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	newKeys := make(map[byte][]byte)
+	labels := make(map[byte]string)
+	for _, e := range entries {
+		key, err := loadKeyHexFile(e.path)
+		if err != nil {
+			fmt.Printf("Error loading key for slot %d: %v\n", e.slot, err)
+			os.Exit(1)
+		}
+		newKeys[e.slot] = key
+		labels[e.slot] = e.path
+	}
+
+	changes, err := planRotation(entries, newKeys, current, keyVersion)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Rotation plan (authenticated once with slot 0):")
+	for i, c := range changes {
+		fmt.Printf("  %d. slot %d: %s -> %s (version 0x%02X)\n", i+1, c.Slot, current[c.Slot].label, labels[c.Slot], keyVersion)
+	}
+	fmt.Println()
+
+	if err := selectNDEFApp(card); err != nil {
+		fmt.Printf("Error re-selecting NDEF app: %v\n", err)
+		os.Exit(1)
+	}
+	sess, err := authenticateEV2First(card, current[0].key, 0)
+	if err != nil {
+		fmt.Printf("Authentication failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ntag424.ProvisionKeys(card, toNtag424Session(sess), changes); err != nil {
+		fmt.Printf("Rotation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Verifying...")
+	failed := false
+	for _, c := range changes {
+		ok, err := verifyKeyByReauth(card, c.Slot, c.NewKey)
+		switch {
+		case err != nil:
+			fmt.Printf("  slot %d: verification error: %v\n", c.Slot, err)
+			failed = true
+		case !ok:
+			fmt.Printf("  slot %d: cannot authenticate with new key\n", c.Slot)
+			failed = true
+		default:
+			fmt.Printf("  slot %d: OK\n", c.Slot)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println()
+	fmt.Printf("SUCCESS: rotated %d slot(s)\n", len(changes))
+}
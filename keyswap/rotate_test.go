@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseRotateSpec(t *testing.T) {
+	entries, err := parseRotateSpec("1=newsdm.hex, 2=newwrite.hex,0=newmaster.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rotateEntry{{1, "newsdm.hex"}, {2, "newwrite.hex"}, {0, "newmaster.hex"}}
+	if len(entries) != len(want) {
+		t.Fatalf("got %v, want %v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %v, want %v", i, entries[i], want[i])
+		}
+	}
+
+	for _, spec := range []string{"", "1", "5=k.hex", "x=k.hex", "1=", "1=a.hex,1=b.hex"} {
+		if _, err := parseRotateSpec(spec); err == nil {
+			t.Errorf("parseRotateSpec(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestPlanRotationOrdersMasterLast(t *testing.T) {
+	key := func(b byte) []byte { return bytes.Repeat([]byte{b}, 16) }
+	current := map[byte]probeResult{
+		0: {key: key(0x00), label: "all-zero"},
+		1: {key: key(0x01), label: "sdm"},
+		2: {key: key(0x02), label: "write"},
+	}
+	entries := []rotateEntry{{0, "m.hex"}, {2, "w.hex"}, {1, "s.hex"}}
+	newKeys := map[byte][]byte{0: key(0xA0), 1: key(0xA1), 2: key(0xA2)}
+
+	changes, err := planRotation(entries, newKeys, current, 0x02)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []byte
+	for _, c := range changes {
+		order = append(order, c.Slot)
+		if !bytes.Equal(c.OldKey, current[c.Slot].key) || !bytes.Equal(c.NewKey, newKeys[c.Slot]) {
+			t.Errorf("slot %d: wrong keys in change", c.Slot)
+		}
+		if c.NewVersion != 0x02 {
+			t.Errorf("slot %d: version 0x%02X, want 0x02", c.Slot, c.NewVersion)
+		}
+	}
+	if !bytes.Equal(order, []byte{2, 1, 0}) {
+		t.Errorf("order = %v, want [2 1 0]", order)
+	}
+}
+
+func TestPlanRotationNeedsKnownKeys(t *testing.T) {
+	k := make([]byte, 16)
+	newKeys := map[byte][]byte{1: k, 3: k}
+
+	_, err := planRotation([]rotateEntry{{1, "s.hex"}}, newKeys, map[byte]probeResult{1: {key: k}}, 1)
+	if err == nil || !strings.Contains(err.Error(), "slot 0") {
+		t.Errorf("unknown slot 0: err = %v", err)
+	}
+	_, err = planRotation([]rotateEntry{{3, "x.hex"}}, newKeys, map[byte]probeResult{0: {key: k}}, 1)
+	if err == nil || !strings.Contains(err.Error(), "slot 3") {
+		t.Errorf("unknown slot 3: err = %v", err)
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
 	"strings"
 	"unsafe"
 
 	"github.com/ebfe/scard"
 	"github.com/barnettlynn/nfctools/pkg/ntag424"
+	"gopkg.in/yaml.v3"
 )
 
 // Type definitions
@@ -15,11 +20,14 @@ type session struct {
 	kmac   [16]byte
 	ti     [4]byte
 	cmdCtr uint16
+
+	fileModes unsafe.Pointer // ntag424.Session's file comm mode cache (a map); only the library uses it
 }
 
 type keyFile struct {
 	name string
 	key  []byte
+	slot int // declared slot from a .json key file, -1 if unknown
 }
 
 // Session conversion helpers
@@ -62,12 +70,58 @@ func authenticateEV2First(card *scard.Card, key []byte, keyNo byte) (*session, e
 	return fromNtag424Session(sess), nil
 }
 
-func changeKey(card *scard.Card, sess *session, keySlot byte, newKey, oldKey []byte, keyVersion byte, authSlot byte) error {
-	return ntag424.ChangeKey(card, toNtag424Session(sess), keySlot, newKey, oldKey, keyVersion, authSlot)
+func changeKeyVersioned(card *scard.Card, sess *session, keySlot byte, newKey, oldKey []byte, keyVersion byte, authSlot byte) error {
+	return ntag424.ChangeKeyVersioned(card, toNtag424Session(sess), keySlot, newKey, oldKey, keyVersion, authSlot)
 }
 
-func changeKeySame(card *scard.Card, sess *session, keySlot byte, newKey []byte, keyVersion byte) error {
-	return ntag424.ChangeKeySame(card, toNtag424Session(sess), keySlot, newKey, keyVersion)
+// readKeyVersion re-selects the NDEF app, dropping any session left by
+// probing, and reads slot's key version in plain.
+func readKeyVersion(card *scard.Card, slot byte) (byte, error) {
+	if err := selectNDEFApp(card); err != nil {
+		return 0, err
+	}
+	return ntag424.GetKeyVersion(card, nil, slot)
+}
+
+func rotateKeySame(card *scard.Card, keySlot byte, oldKey, newKey []byte, keyVersion byte) error {
+	return ntag424.RotateKeySame(card, keySlot, oldKey, newKey, keyVersion)
+}
+
+func verifyKeyByReauth(card *scard.Card, keySlot byte, key []byte) (bool, error) {
+	return ntag424.VerifyKeyByReauth(card, keySlot, key)
+}
+
+func enableAPDUTrace(w io.Writer) {
+	ntag424.EnableAPDUTrace(w, true)
+}
+
+func defaultSlotRoles() map[byte]string {
+	return ntag424.DefaultSlotRoles()
+}
+
+// slotRolesFile is the -slot-roles YAML layout:
+//
+//	slot_roles:
+//	  0: AppMaster
+//	  3: Loyalty
+type slotRolesFile struct {
+	SlotRoles map[int]string `yaml:"slot_roles"`
+}
+
+// loadSlotRoles reads a -slot-roles file and applies it to the default
+// roles: listed slots get the given role, an empty role removes it.
+func loadSlotRoles(path string) (map[byte]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read slot roles: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	var f slotRolesFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse slot roles yaml: %w", err)
+	}
+	return ntag424.DefaultSlotRoles().WithOverrides(f.SlotRoles)
 }
 
 func crc32DESFire(data []byte) uint32 {
@@ -78,14 +132,14 @@ func loadKeyHexFile(path string) ([]byte, error) {
 	return ntag424.LoadKeyHexFile(path)
 }
 
-func loadAllHexKeys(dir string) ([]keyFile, error) {
-	keys, err := ntag424.LoadAllHexKeys(dir)
+func loadAllKeys(dir string) ([]keyFile, error) {
+	keys, err := ntag424.LoadAllKeys(dir)
 	if err != nil {
 		return nil, err
 	}
 	result := make([]keyFile, len(keys))
 	for i, k := range keys {
-		result[i] = keyFile{name: k.Name, key: k.Key}
+		result[i] = keyFile{name: k.Name, key: k.Key, slot: k.Slot}
 	}
 	return result, nil
 }
@@ -3,8 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -45,8 +50,121 @@ func registerTag(endpoint, cfClientID, cfClientSecret string, reg TagRegistratio
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("API returned non-2xx status: %d %s", resp.StatusCode, resp.Status)
+		return &apiStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	return nil
 }
+
+// apiStatusError is returned by registerTag when the API answers with a
+// non-2xx status.
+type apiStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *apiStatusError) Error() string {
+	return fmt.Sprintf("API returned non-2xx status: %d %s", e.StatusCode, e.Status)
+}
+
+// retryable reports whether a registerTag error is worth retrying. Network
+// errors, 429 and 5xx are; other 4xx responses will not change on retry.
+func retryable(err error) bool {
+	var se *apiStatusError
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500
+	}
+	return true
+}
+
+// backoff is an exponential retry policy with jitter. sleep and jitter are
+// injectable so the timing can be tested without waiting.
+type backoff struct {
+	attempts int           // total tries, including the first
+	base     time.Duration // delay before the first retry
+	max      time.Duration // cap on any single delay
+	sleep    func(time.Duration)
+	jitter   func() float64 // returns a value in [0, 1)
+}
+
+func newBackoff(retries int) backoff {
+	return backoff{
+		attempts: retries + 1,
+		base:     500 * time.Millisecond,
+		max:      8 * time.Second,
+		sleep:    time.Sleep,
+		jitter:   rand.Float64,
+	}
+}
+
+// delay returns how long to wait after failed attempt n (1-based): base
+// doubled n-1 times and capped at max, then jittered into [d/2, d).
+func (b backoff) delay(n int) time.Duration {
+	d := b.base
+	for i := 1; i < n && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	half := d / 2
+	return half + time.Duration(b.jitter()*float64(half))
+}
+
+// do calls fn until it succeeds, returns a non-retryable error, or the
+// attempts run out. The last error is returned.
+func (b backoff) do(fn func() error) error {
+	var err error
+	for n := 1; n <= b.attempts; n++ {
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+		if n == b.attempts {
+			break
+		}
+		d := b.delay(n)
+		fmt.Printf("  attempt %d/%d failed: %v (retrying in %s)\n", n, b.attempts, err, d.Round(time.Millisecond))
+		b.sleep(d)
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", b.attempts, err)
+}
+
+// savePending writes reg to dir/<uid>.json so `minter replay` can register
+// it later.
+func savePending(dir string, reg TagRegistration) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create pending dir: %w", err)
+	}
+	payload, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal registration: %w", err)
+	}
+	path := filepath.Join(dir, pendingFileName(reg.UID))
+	if err := os.WriteFile(path, append(payload, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("write pending registration: %w", err)
+	}
+	return path, nil
+}
+
+func pendingFileName(uid string) string {
+	uid = strings.ToLower(strings.TrimSpace(uid))
+	if uid == "" {
+		uid = "unknown"
+	}
+	return uid + ".json"
+}
+
+func loadPending(path string) (TagRegistration, error) {
+	var reg TagRegistration
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return reg, err
+	}
+	if err := json.Unmarshal(content, &reg); err != nil {
+		return reg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if reg.UID == "" {
+		return reg, fmt.Errorf("%s: missing uid", path)
+	}
+	return reg, nil
+}
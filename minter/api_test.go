@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock records the delays backoff asks for instead of sleeping.
+type fakeClock struct {
+	slept []time.Duration
+}
+
+func (c *fakeClock) sleep(d time.Duration) { c.slept = append(c.slept, d) }
+
+func testBackoff(attempts int, jitter float64, clock *fakeClock) backoff {
+	return backoff{
+		attempts: attempts,
+		base:     500 * time.Millisecond,
+		max:      2 * time.Second,
+		sleep:    clock.sleep,
+		jitter:   func() float64 { return jitter },
+	}
+}
+
+func TestBackoffDelayDoublesAndCaps(t *testing.T) {
+	clock := &fakeClock{}
+	lo := testBackoff(5, 0, clock)
+	hi := testBackoff(5, 0.999999, clock)
+
+	wantLo := []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, time.Second}
+	for i, want := range wantLo {
+		n := i + 1
+		if got := lo.delay(n); got != want {
+			t.Fatalf("delay(%d) with no jitter: expected %s, got %s", n, want, got)
+		}
+		if got := hi.delay(n); got < want || got >= 2*want {
+			t.Fatalf("delay(%d) with max jitter: expected [%s, %s), got %s", n, want, 2*want, got)
+		}
+	}
+}
+
+func TestBackoffDoRetriesTransientErrors(t *testing.T) {
+	clock := &fakeClock{}
+	b := testBackoff(4, 0, clock)
+
+	calls := 0
+	err := b.do(func() error {
+		calls++
+		if calls < 3 {
+			return &apiStatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success on third attempt, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	want := []time.Duration{250 * time.Millisecond, 500 * time.Millisecond}
+	if !reflect.DeepEqual(clock.slept, want) {
+		t.Fatalf("expected sleeps %v, got %v", want, clock.slept)
+	}
+}
+
+func TestBackoffDoGivesUp(t *testing.T) {
+	clock := &fakeClock{}
+	b := testBackoff(3, 0, clock)
+
+	netErr := errors.New("connection refused")
+	calls := 0
+	err := b.do(func() error {
+		calls++
+		return netErr
+	})
+	if !errors.Is(err, netErr) {
+		t.Fatalf("expected wrapped network error, got %v", err)
+	}
+	if calls != 3 || len(clock.slept) != 2 {
+		t.Fatalf("expected 3 calls and 2 sleeps, got %d and %d", calls, len(clock.slept))
+	}
+}
+
+func TestBackoffDoStopsOnClientError(t *testing.T) {
+	clock := &fakeClock{}
+	b := testBackoff(5, 0, clock)
+
+	calls := 0
+	err := b.do(func() error {
+		calls++
+		return &apiStatusError{StatusCode: 400, Status: "400 Bad Request"}
+	})
+	if err == nil || calls != 1 || len(clock.slept) != 0 {
+		t.Fatalf("expected a single attempt for 400, got calls=%d sleeps=%d err=%v", calls, len(clock.slept), err)
+	}
+}
+
+func TestSavePendingRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), pendingDirName)
+	reg := TagRegistration{UID: "041e3c5a7b6f80", HatName: "Classic Trucker", HatColor: "Navy", BatchSize: 12}
+
+	path, err := savePending(dir, reg)
+	if err != nil {
+		t.Fatalf("savePending returned error: %v", err)
+	}
+	if filepath.Base(path) != "041e3c5a7b6f80.json" {
+		t.Fatalf("expected <uid>.json, got %s", path)
+	}
+	got, err := loadPending(path)
+	if err != nil {
+		t.Fatalf("loadPending returned error: %v", err)
+	}
+	if got != reg {
+		t.Fatalf("expected %+v, got %+v", reg, got)
+	}
+}
@@ -18,10 +18,11 @@ const (
 )
 
 type Config struct {
-	API     APIConfig     `yaml:"api"`
-	Keys    KeysConfig    `yaml:"keys"`
-	SDM     SDMConfig     `yaml:"sdm"`
-	Runtime RuntimeConfig `yaml:"runtime"`
+	API         APIConfig         `yaml:"api"`
+	Keys        KeysConfig        `yaml:"keys"`
+	SDM         SDMConfig         `yaml:"sdm"`
+	Proprietary ProprietaryConfig `yaml:"proprietary,omitempty"`
+	Runtime     RuntimeConfig     `yaml:"runtime"`
 }
 
 type APIConfig struct {
@@ -34,10 +35,37 @@ type KeysConfig struct {
 	AppMasterKeyFile string `yaml:"app_master_key_file"`
 	SDMKeyFile       string `yaml:"sdm_key_file"`
 	NDEFWriteKeyFile string `yaml:"ndef_write_key_file"`
+	FileThreeKeyFile string `yaml:"file_three_key_file,omitempty"`
 }
 
+// DefaultSDMFileNo is the file SDM is configured on when sdm.file_no is absent.
+const DefaultSDMFileNo = 2
+
+// ProprietaryFileMaxSize is the size of file 3 on an NTAG 424 DNA.
+const ProprietaryFileMaxSize = 128
+
 type SDMConfig struct {
 	BaseURL string `yaml:"base_url"`
+	FileNo  *int   `yaml:"file_no,omitempty"`
+}
+
+// FileNumber returns sdm.file_no, or DefaultSDMFileNo when it is absent.
+func (c SDMConfig) FileNumber() byte {
+	if c.FileNo == nil {
+		return DefaultSDMFileNo
+	}
+	return byte(*c.FileNo)
+}
+
+// ProprietaryConfig configures the optional file 3 provisioning step. It is
+// enabled when keys.file_three_key_file and proprietary.data_file are set.
+type ProprietaryConfig struct {
+	DataFile string `yaml:"data_file,omitempty"`
+}
+
+// ProprietaryEnabled reports whether file 3 should be provisioned.
+func (c *Config) ProprietaryEnabled() bool {
+	return strings.TrimSpace(c.Keys.FileThreeKeyFile) != "" && strings.TrimSpace(c.Proprietary.DataFile) != ""
 }
 
 type RuntimeConfig struct {
@@ -125,6 +153,29 @@ func (c *Config) validateFullMode() error {
 	if strings.TrimSpace(c.SDM.BaseURL) == "" {
 		return fmt.Errorf("config.sdm.base_url is required")
 	}
+	// minter writes the SDM template to the NDEF file (file 2) and makes
+	// only that file writable, so SDM offsets are only valid there
+	if c.SDM.FileNo != nil && *c.SDM.FileNo != DefaultSDMFileNo {
+		return fmt.Errorf("config.sdm.file_no must be %d, the NDEF file that holds the SDM template", DefaultSDMFileNo)
+	}
+
+	// File 3 provisioning is optional, but needs both the key and the payload
+	hasKey := strings.TrimSpace(c.Keys.FileThreeKeyFile) != ""
+	hasData := strings.TrimSpace(c.Proprietary.DataFile) != ""
+	if hasKey != hasData {
+		return fmt.Errorf("config.keys.file_three_key_file and config.proprietary.data_file must be set together")
+	}
+	if hasKey {
+		if err := validateReadableFile(c.Keys.FileThreeKeyFile, "config.keys.file_three_key_file"); err != nil {
+			return err
+		}
+		if err := validateReadableFile(c.Proprietary.DataFile, "config.proprietary.data_file"); err != nil {
+			return err
+		}
+		if info, err := os.Stat(c.Proprietary.DataFile); err == nil && info.Size() > ProprietaryFileMaxSize {
+			return fmt.Errorf("config.proprietary.data_file is %d bytes, file 3 holds %d", info.Size(), ProprietaryFileMaxSize)
+		}
+	}
 
 	if c.Runtime.ReaderIndex == nil {
 		return fmt.Errorf("config.runtime.reader_index is required")
@@ -141,6 +192,8 @@ func (c *Config) resolvePaths(configPath string) {
 	c.Keys.AppMasterKeyFile = resolvePath(configDir, c.Keys.AppMasterKeyFile)
 	c.Keys.SDMKeyFile = resolvePath(configDir, c.Keys.SDMKeyFile)
 	c.Keys.NDEFWriteKeyFile = resolvePath(configDir, c.Keys.NDEFWriteKeyFile)
+	c.Keys.FileThreeKeyFile = resolvePath(configDir, c.Keys.FileThreeKeyFile)
+	c.Proprietary.DataFile = resolvePath(configDir, c.Proprietary.DataFile)
 }
 
 func resolvePath(baseDir, path string) string {
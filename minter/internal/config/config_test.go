@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const baseYAML = `
+api:
+  endpoint: "https://example.com/v1/tags"
+  cf_client_id: "id"
+  cf_client_secret: "secret"
+keys:
+  app_master_key_file: "app.hex"
+  sdm_key_file: "sdm.hex"
+  ndef_write_key_file: "ndef.hex"
+sdm:
+  base_url: "https://example.com/tap"
+runtime:
+  reader_index: 0
+`
+
+// writeConfig writes key files and a config made of baseYAML with keysExtra
+// added under keys:, sdmExtra under sdm: and topExtra at the end. It returns
+// the config path.
+func writeConfig(t *testing.T, keysExtra, sdmExtra, topExtra string) string {
+	t.Helper()
+	tmp := t.TempDir()
+	for _, name := range []string{"app.hex", "sdm.hex", "ndef.hex", "three.hex"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), []byte("00112233445566778899AABBCCDDEEFF\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "payload.bin"), []byte("proprietary"), 0o644); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "big.bin"), bytes.Repeat([]byte{0x01}, ProprietaryFileMaxSize+1), 0o644); err != nil {
+		t.Fatalf("write big payload: %v", err)
+	}
+
+	y := strings.Replace(baseYAML, "  ndef_write_key_file: \"ndef.hex\"\n", "  ndef_write_key_file: \"ndef.hex\"\n"+keysExtra, 1)
+	y = strings.Replace(y, "  base_url: \"https://example.com/tap\"\n", "  base_url: \"https://example.com/tap\"\n"+sdmExtra, 1)
+	path := filepath.Join(tmp, "config.yaml")
+	if err := os.WriteFile(path, []byte(y+topExtra), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadWithoutProprietaryKeepsDefaults(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "", "", ""))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.SDM.FileNumber() != DefaultSDMFileNo {
+		t.Fatalf("expected default SDM file %d, got %d", DefaultSDMFileNo, cfg.SDM.FileNumber())
+	}
+	if cfg.ProprietaryEnabled() {
+		t.Fatalf("expected file 3 provisioning to be disabled")
+	}
+}
+
+func TestLoadProprietaryResolvesPaths(t *testing.T) {
+	path := writeConfig(t, "  file_three_key_file: \"three.hex\"\n", "  file_no: 2\n", "proprietary:\n  data_file: \"payload.bin\"\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	dir := filepath.Dir(path)
+	if cfg.Keys.FileThreeKeyFile != filepath.Join(dir, "three.hex") {
+		t.Fatalf("expected resolved file three key path, got %q", cfg.Keys.FileThreeKeyFile)
+	}
+	if cfg.Proprietary.DataFile != filepath.Join(dir, "payload.bin") {
+		t.Fatalf("expected resolved data file path, got %q", cfg.Proprietary.DataFile)
+	}
+	if !cfg.ProprietaryEnabled() {
+		t.Fatalf("expected file 3 provisioning to be enabled")
+	}
+}
+
+func TestLoadRejectsInvalidProprietaryConfig(t *testing.T) {
+	cases := []struct {
+		name                          string
+		keysExtra, sdmExtra, topExtra string
+		wantErr                       string
+	}{
+		{"key without data", "  file_three_key_file: \"three.hex\"\n", "", "", "must be set together"},
+		{"data without key", "", "", "proprietary:\n  data_file: \"payload.bin\"\n", "must be set together"},
+		{"payload too large", "  file_three_key_file: \"three.hex\"\n", "", "proprietary:\n  data_file: \"big.bin\"\n", "file 3 holds"},
+		{"sdm on file 3", "  file_three_key_file: \"three.hex\"\n", "  file_no: 3\n", "proprietary:\n  data_file: \"payload.bin\"\n", "must be 2"},
+		{"sdm on the CC file", "", "  file_no: 1\n", "", "must be 2"},
+		{"file_no out of range", "", "  file_no: 4\n", "", "must be 2"},
+		{"missing key file", "  file_three_key_file: \"nope.hex\"\n", "", "proprietary:\n  data_file: \"payload.bin\"\n", "file_three_key_file"},
+	}
+	for _, tc := range cases {
+		_, err := Load(writeConfig(t, tc.keysExtra, tc.sdmExtra, tc.topExtra))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
@@ -1,23 +1,35 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/barnettlynn/nfctools/minter/internal/config"
 	"github.com/barnettlynn/nfctools/pkg/ntag424"
 )
 
-const configFileName = "config.yaml"
+const (
+	configFileName = "config.yaml"
+	pendingDirName = "pending"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
+
 	verbose := flag.Bool("v", false, "enable debug logging")
 	logFormat := flag.String("log-format", "text", "log format: text or json")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
 	emulator := flag.Bool("emulator", false, "skip physical card and use provided UID (for API testing)")
 	uid := flag.String("uid", "", "tag UID hex (required in emulator mode, optional override in physical mode)")
 	hatName := flag.String("hat-name", "", "hat name (required)")
@@ -27,6 +39,12 @@ func main() {
 	batchSize := flag.Int("batch-size", 0, "batch size (optional)")
 	scanCount := flag.Int("scan-count", 0, "scan count (optional)")
 	notes := flag.String("notes", "", "notes (optional)")
+	continuous := flag.Bool("continuous", false, "keep running and provision/register every tag tapped on the reader (Ctrl-C to stop)")
+	diversify := flag.Bool("diversify", false, "treat configured keys as master keys and derive per-tag keys from the UID (AN10922)")
+	apiRetries := flag.Int("api-retries", 3, "retries for a failed API registration before saving it to pending/")
+	manifestFile := flag.String("manifest", "", "CSV of tags to mint (hat_name,hat_color,...): provision each tapped tag with the next row and record its UID in the file")
+	shareFlag := flag.String("share", "shared", "PC/SC share mode: shared or exclusive (keeps other applications off the card during key changes)")
+	protocolFlag := flag.String("protocol", "any", "PC/SC protocol: any, t0 or t1")
 	flag.Parse()
 
 	// Configure slog
@@ -40,17 +58,53 @@ func main() {
 	} else {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
 	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("-trace: %v", err)
+		}
+		defer f.Close()
+		ntag424.EnableAPDUTrace(f, true)
+	}
 
 	// Validate required flags
-	if strings.TrimSpace(*hatName) == "" {
-		log.Fatalf("-hat-name is required")
-	}
-	if strings.TrimSpace(*hatColor) == "" {
-		log.Fatalf("-hat-color is required")
+	var m *manifest
+	if *manifestFile != "" {
+		if *emulator || *continuous || strings.TrimSpace(*uid) != "" {
+			log.Fatalf("-manifest cannot be combined with -emulator, -continuous or -uid")
+		}
+		var err error
+		if m, err = loadManifest(*manifestFile); err != nil {
+			log.Fatalf("manifest load failed: %v", err)
+		}
+	} else {
+		if strings.TrimSpace(*hatName) == "" {
+			log.Fatalf("-hat-name is required")
+		}
+		if strings.TrimSpace(*hatColor) == "" {
+			log.Fatalf("-hat-color is required")
+		}
 	}
 	if *emulator && strings.TrimSpace(*uid) == "" {
 		log.Fatalf("-uid is required in emulator mode")
 	}
+	if *continuous && (*emulator || strings.TrimSpace(*uid) != "") {
+		log.Fatalf("-continuous cannot be combined with -emulator or -uid")
+	}
+	if *apiRetries < 0 {
+		log.Fatalf("-api-retries must be >= 0")
+	}
+	share, err := ntag424.ParseShareMode(*shareFlag)
+	if err != nil {
+		log.Fatalf("-share: %v", err)
+	}
+	proto, err := ntag424.ParseProtocol(*protocolFlag)
+	if err != nil {
+		log.Fatalf("-protocol: %v", err)
+	}
+	monitor := func(ctx context.Context, reader string, onInsert func(*ntag424.Connection)) error {
+		return ntag424.MonitorCardsWithOptions(ctx, reader, share, proto, onInsert)
+	}
 
 	// Load config
 	configPath, err := defaultConfigPath()
@@ -68,76 +122,248 @@ func main() {
 	if err != nil {
 		log.Fatalf("config load failed: %v", err)
 	}
+	r := &registrar{
+		cfg:        cfg,
+		backoff:    newBackoff(*apiRetries),
+		pendingDir: filepath.Join(filepath.Dir(configPath), pendingDirName),
+	}
 
-	var tagUID string
+	// Registration fields shared by every tag minted in this run
+	reg := TagRegistration{
+		HatName:   strings.TrimSpace(*hatName),
+		HatColor:  strings.TrimSpace(*hatColor),
+		HatSKU:    strings.TrimSpace(*hatSKU),
+		BatchID:   strings.TrimSpace(*batchID),
+		BatchSize: *batchSize,
+		ScanCount: *scanCount,
+		Notes:     strings.TrimSpace(*notes),
+	}
 
 	if *emulator {
 		// Emulator mode: use provided UID, skip provisioning
-		tagUID = strings.ToLower(strings.TrimSpace(*uid))
-		fmt.Printf("Emulator mode: using provided UID: %s\n", tagUID)
-	} else {
-		// Physical mode: load keys and provision tag
-		appMasterKey, err := ntag424.LoadKeyHexFile(cfg.Keys.AppMasterKeyFile)
-		if err != nil {
-			log.Fatalf("app master key file invalid: %v", err)
+		reg.UID = strings.ToLower(strings.TrimSpace(*uid))
+		fmt.Printf("Emulator mode: using provided UID: %s\n", reg.UID)
+		if err := r.register(reg); err != nil {
+			log.Fatal(err)
 		}
-		sdmKey, err := ntag424.LoadKeyHexFile(cfg.Keys.SDMKeyFile)
+		return
+	}
+
+	// Physical mode: load keys and provision tag
+	appMasterKey, err := ntag424.LoadKeyHexFile(cfg.Keys.AppMasterKeyFile)
+	if err != nil {
+		log.Fatalf("app master key file invalid: %v", err)
+	}
+	sdmKey, err := ntag424.LoadKeyHexFile(cfg.Keys.SDMKeyFile)
+	if err != nil {
+		log.Fatalf("SDM key file invalid: %v", err)
+	}
+	ndefKey, err := ntag424.LoadKeyHexFile(cfg.Keys.NDEFWriteKeyFile)
+	if err != nil {
+		log.Fatalf("NDEF write key file invalid: %v", err)
+	}
+	loadedKeys := ntag424.StaticKeyProvider{0x00: appMasterKey, 0x01: sdmKey, 0x02: ndefKey}
+	var prop *proprietaryData
+	if cfg.ProprietaryEnabled() {
+		fileThreeKey, err := ntag424.LoadKeyHexFile(cfg.Keys.FileThreeKeyFile)
 		if err != nil {
-			log.Fatalf("SDM key file invalid: %v", err)
+			log.Fatalf("file three key file invalid: %v", err)
 		}
-		ndefKey, err := ntag424.LoadKeyHexFile(cfg.Keys.NDEFWriteKeyFile)
+		data, err := os.ReadFile(cfg.Proprietary.DataFile)
 		if err != nil {
-			log.Fatalf("NDEF write key file invalid: %v", err)
+			log.Fatalf("proprietary data file: %v", err)
 		}
+		loadedKeys[fileThreeKeyNo] = fileThreeKey
+		prop = &proprietaryData{data: data}
+	}
+	// With -diversify the loaded keys are master keys and each tag gets
+	// keys derived from its UID.
+	var keys ntag424.KeyProvider = loadedKeys
+	if *diversify {
+		keys = ntag424.DiversifiedKeyProvider{MasterKeys: loadedKeys}
+	}
 
-		fmt.Printf("AppMasterKey: %s\n", cfg.Keys.AppMasterKeyFile)
-		fmt.Printf("SDM key: %s\n", cfg.Keys.SDMKeyFile)
-		fmt.Printf("NDEF write key: %s\n", cfg.Keys.NDEFWriteKeyFile)
-		fmt.Printf("SDM base URL: %s\n", cfg.SDM.BaseURL)
-
-		conn, err := ntag424.Connect(*cfg.Runtime.ReaderIndex)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer conn.Close()
-		fmt.Printf("Using reader [%d]: %s\n", conn.ReaderIdx, conn.Reader)
+	fmt.Printf("AppMasterKey: %s\n", cfg.Keys.AppMasterKeyFile)
+	fmt.Printf("SDM key: %s\n", cfg.Keys.SDMKeyFile)
+	fmt.Printf("NDEF write key: %s\n", cfg.Keys.NDEFWriteKeyFile)
+	fmt.Printf("SDM base URL: %s\n", cfg.SDM.BaseURL)
+	fmt.Printf("SDM file: %d\n", cfg.SDM.FileNumber())
+	if prop != nil {
+		fmt.Printf("File three key: %s\n", cfg.Keys.FileThreeKeyFile)
+		fmt.Printf("Proprietary data: %s (%d bytes)\n", cfg.Proprietary.DataFile, len(prop.data))
+	}
+	profile := ntag424.DefaultGuideApparelProfile()
+	fmt.Printf("Provisioning profile: %s\n", profile.Name)
+	if *diversify {
+		fmt.Println("Key diversification: enabled (per-tag keys derived from UID)")
+	}
 
+	// provision provisions the tag on conn and returns the UID to register
+	provision := func(conn *ntag424.Connection) (string, error) {
 		fmt.Println("Provisioning tag...")
-		provisionedUID, err := provisionTag(conn, appMasterKey, sdmKey, ndefKey, cfg.SDM.BaseURL)
+		if err := conn.EnsureCard(); err != nil {
+			return "", fmt.Errorf("provision tag failed: %w", err)
+		}
+		// Hold the card for the whole key-change sequence so no other
+		// process interleaves APDUs with the secure session.
+		var provisionedUID string
+		err := conn.WithTransaction(func() (err error) {
+			provisionedUID, err = provisionTag(conn, profile, keys, cfg.SDM.BaseURL, cfg.SDM.FileNumber(), prop)
+			return err
+		})
 		if err != nil {
-			log.Fatalf("provision tag failed: %v", err)
+			if hint := ntag424.Remediation(err); hint != "" {
+				return "", fmt.Errorf("provision tag failed: %w (hint: %s)", err, hint)
+			}
+			return "", fmt.Errorf("provision tag failed: %w", err)
 		}
 
 		// Use override UID if provided, otherwise use provisioned UID (lowercased for API)
 		if strings.TrimSpace(*uid) != "" {
-			tagUID = strings.ToLower(strings.TrimSpace(*uid))
-			fmt.Printf("Using override UID: %s (provisioned UID: %s)\n", tagUID, provisionedUID)
-		} else {
-			tagUID = strings.ToLower(provisionedUID)
-			fmt.Printf("Provisioned UID: %s\n", tagUID)
+			overrideUID := strings.ToLower(strings.TrimSpace(*uid))
+			fmt.Printf("Using override UID: %s (provisioned UID: %s)\n", overrideUID, provisionedUID)
+			return overrideUID, nil
 		}
+		fmt.Printf("Provisioned UID: %s\n", strings.ToLower(provisionedUID))
+		return strings.ToLower(provisionedUID), nil
 	}
 
-	// Build registration payload
-	reg := TagRegistration{
-		UID:       tagUID,
-		HatName:   strings.TrimSpace(*hatName),
-		HatColor:  strings.TrimSpace(*hatColor),
-		HatSKU:    strings.TrimSpace(*hatSKU),
-		BatchID:   strings.TrimSpace(*batchID),
-		BatchSize: *batchSize,
-		ScanCount: *scanCount,
-		Notes:     strings.TrimSpace(*notes),
+	mint := func(conn *ntag424.Connection) error {
+		tagUID, err := provision(conn)
+		if err != nil {
+			return err
+		}
+		tagReg := reg
+		tagReg.UID = tagUID
+		return r.register(tagReg)
+	}
+
+	if m != nil {
+		runManifest(m, *cfg.Runtime.ReaderIndex, monitor, func(conn *ntag424.Connection) error {
+			return m.mintNext(func() (string, error) { return provision(conn) }, r)
+		})
+		return
+	}
+
+	if *continuous {
+		readers, err := ntag424.ListReaders()
+		if err != nil || len(readers) == 0 {
+			log.Fatalf("no readers found: %v", err)
+		}
+		idx := *cfg.Runtime.ReaderIndex
+		if idx < 0 || idx >= len(readers) {
+			log.Fatalf("reader index out of range (0..%d)", len(readers)-1)
+		}
+		fmt.Printf("Using reader [%d]: %s\n", idx, readers[idx])
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		minted := 0
+		fmt.Println("Continuous mode: tap tags one after another (Ctrl-C to stop)")
+		err = monitor(ctx, readers[idx], func(conn *ntag424.Connection) {
+			if err := mint(conn); err != nil {
+				log.Printf("%v", err)
+			} else {
+				minted++
+			}
+			fmt.Println("Waiting for next tag...")
+		})
+		if err != nil {
+			log.Fatalf("card monitor failed: %v", err)
+		}
+		fmt.Printf("\nStopped after minting %d tag(s)\n", minted)
+		return
+	}
+
+	conn, err := ntag424.ConnectWithOptions(*cfg.Runtime.ReaderIndex, share, proto)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Printf("Using reader [%d]: %s\n", conn.ReaderIdx, conn.Reader)
+
+	if err := mint(conn); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runManifest mints one manifest row per tag tapped on the reader at
+// readerIdx, watched with monitor, until every row is done or the user
+// presses Ctrl-C.
+func runManifest(m *manifest, readerIdx int, monitor func(context.Context, string, func(*ntag424.Connection)) error, mintRow func(*ntag424.Connection) error) {
+	if m.remaining() == 0 {
+		fmt.Printf("Manifest %s: every row is already minted\n", m.path)
+		return
+	}
+	readers, err := ntag424.ListReaders()
+	if err != nil || len(readers) == 0 {
+		log.Fatalf("no readers found: %v", err)
+	}
+	if readerIdx < 0 || readerIdx >= len(readers) {
+		log.Fatalf("reader index out of range (0..%d)", len(readers)-1)
+	}
+	fmt.Printf("Using reader [%d]: %s\n", readerIdx, readers[readerIdx])
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fmt.Printf("Manifest %s: %d of %d row(s) to mint; tap tags one after another (Ctrl-C to stop)\n",
+		m.path, m.remaining(), len(m.rows))
+	err = monitor(ctx, readers[readerIdx], func(conn *ntag424.Connection) {
+		if err := mintRow(conn); err != nil {
+			log.Printf("%v", err)
+		}
+		if m.remaining() == 0 {
+			cancel()
+			return
+		}
+		fmt.Printf("%d row(s) left. Waiting for next tag...\n", m.remaining())
+	})
+	if err != nil {
+		log.Fatalf("card monitor failed: %v", err)
+	}
+	pending := 0
+	for _, row := range m.rows {
+		if row.Status == rowPending {
+			pending++
+		}
 	}
+	fmt.Printf("\nStopped with %d row(s) left, %d registration(s) pending (run `minter replay`)\n", m.remaining(), pending)
+}
+
+// registrar posts tag registrations to the API, retrying transient
+// failures and saving anything that still fails to pendingDir.
+type registrar struct {
+	cfg        *config.Config
+	backoff    backoff
+	pendingDir string
+}
+
+func (r *registrar) post(reg TagRegistration) error {
+	return r.backoff.do(func() error {
+		return registerTag(r.cfg.API.Endpoint, r.cfg.API.CFClientID, r.cfg.API.CFClientSecret, reg)
+	})
+}
 
+// register posts reg to the API and prints a summary. The tag is already
+// provisioned by the time this runs, so a failed registration is written
+// to the pending directory instead of being lost.
+func (r *registrar) register(reg TagRegistration) error {
 	// Register tag with API
-	fmt.Printf("Registering tag with API: %s\n", cfg.API.Endpoint)
-	if err := registerTag(cfg.API.Endpoint, cfg.API.CFClientID, cfg.API.CFClientSecret, reg); err != nil {
-		log.Fatalf("register tag failed: %v", err)
+	fmt.Printf("Registering tag with API: %s\n", r.cfg.API.Endpoint)
+	if err := r.post(reg); err != nil {
+		path, saveErr := savePending(r.pendingDir, reg)
+		if saveErr != nil {
+			return fmt.Errorf("register tag failed: %w (and could not save pending registration: %v)", err, saveErr)
+		}
+		return fmt.Errorf("register tag failed: %w (saved to %s; run `minter replay` to retry)", err, path)
 	}
 
 	fmt.Println("Tag registered successfully!")
-	fmt.Printf("  UID: %s\n", tagUID)
+	fmt.Printf("  UID: %s\n", reg.UID)
 	fmt.Printf("  Hat: %s - %s\n", reg.HatName, reg.HatColor)
 	if reg.HatSKU != "" {
 		fmt.Printf("  SKU: %s\n", reg.HatSKU)
@@ -148,6 +374,62 @@ func main() {
 	if reg.BatchSize > 0 {
 		fmt.Printf("  Batch Size: %d\n", reg.BatchSize)
 	}
+	return nil
+}
+
+// replay re-posts every registration saved in the pending directory and
+// removes the ones that succeed.
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	apiRetries := fs.Int("api-retries", 3, "retries per pending registration")
+	fs.Parse(args)
+
+	configPath, err := defaultConfigPath()
+	if err != nil {
+		log.Fatalf("resolve config path failed: %v", err)
+	}
+	fmt.Printf("Using config: %s\n", configPath)
+	cfg, err := config.LoadWithMode(configPath, config.ValidationEmulator)
+	if err != nil {
+		log.Fatalf("config load failed: %v", err)
+	}
+	r := &registrar{
+		cfg:        cfg,
+		backoff:    newBackoff(*apiRetries),
+		pendingDir: filepath.Join(filepath.Dir(configPath), pendingDirName),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(r.pendingDir, "*.json"))
+	if err != nil {
+		log.Fatalf("list pending registrations: %v", err)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("No pending registrations in %s\n", r.pendingDir)
+		return
+	}
+
+	failed := 0
+	for _, path := range paths {
+		reg, err := loadPending(path)
+		if err != nil {
+			log.Printf("skip %v", err)
+			failed++
+			continue
+		}
+		fmt.Printf("Replaying %s (UID %s)\n", filepath.Base(path), reg.UID)
+		if err := r.post(reg); err != nil {
+			log.Printf("register %s failed: %v", reg.UID, err)
+			failed++
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("registered %s but could not remove %s: %v", reg.UID, path, err)
+		}
+	}
+	fmt.Printf("Replayed %d of %d pending registration(s)\n", len(paths)-failed, len(paths))
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
 
 func defaultConfigPath() (string, error) {
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Manifest row states, kept in the status column.
+const (
+	rowTodo    = ""        // not yet minted
+	rowDone    = "done"    // provisioned and registered
+	rowPending = "pending" // provisioned, registration saved to pending/
+)
+
+// manifestColumns is the column order written back by manifest.write.
+// hat_name and hat_color are required on input; the rest are optional and
+// may appear in any order.
+var manifestColumns = []string{
+	"hat_name", "hat_color", "hat_sku", "batch_id", "batch_size", "scan_count", "notes", "uid", "status",
+}
+
+// manifestRow is one tag to mint: its registration fields plus the UID and
+// status recorded once a tag has been provisioned for it.
+type manifestRow struct {
+	Reg    TagRegistration // UID is set once the row is minted
+	Status string
+}
+
+// manifest is a CSV of tags to mint in order. Rows are consumed with next
+// and recorded with mark; save rewrites the file so a restarted run resumes
+// at the first unminted row.
+type manifest struct {
+	path string
+	rows []manifestRow
+}
+
+// loadManifest reads and parses the manifest at path.
+func loadManifest(path string) (*manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := parseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.path = path
+	return m, nil
+}
+
+// parseManifest parses a manifest CSV. The first record is the header; blank
+// lines are skipped. Unknown columns and rows without hat_name or hat_color
+// are errors.
+func parseManifest(r io.Reader) (*manifest, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("manifest is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !knownManifestColumn(name) {
+			return nil, fmt.Errorf("unknown column %q (want %s)", name, strings.Join(manifestColumns, ", "))
+		}
+		if _, dup := col[name]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		col[name] = i
+	}
+	for _, name := range []string{"hat_name", "hat_color"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("missing required column %q", name)
+		}
+	}
+
+	m := &manifest{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := col[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		atoi := func(name string) (int, error) {
+			v := field(name)
+			if v == "" {
+				return 0, nil
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("line %d: %s %q is not a non-negative integer", line, name, v)
+			}
+			return n, nil
+		}
+
+		row := manifestRow{
+			Reg: TagRegistration{
+				UID:      strings.ToLower(field("uid")),
+				HatName:  field("hat_name"),
+				HatColor: field("hat_color"),
+				HatSKU:   field("hat_sku"),
+				BatchID:  field("batch_id"),
+				Notes:    field("notes"),
+			},
+			Status: strings.ToLower(field("status")),
+		}
+		if row.Reg.HatName == "" || row.Reg.HatColor == "" {
+			return nil, fmt.Errorf("line %d: hat_name and hat_color are required", line)
+		}
+		if row.Reg.BatchSize, err = atoi("batch_size"); err != nil {
+			return nil, err
+		}
+		if row.Reg.ScanCount, err = atoi("scan_count"); err != nil {
+			return nil, err
+		}
+		switch row.Status {
+		case rowTodo:
+		case rowDone, rowPending:
+			if row.Reg.UID == "" {
+				return nil, fmt.Errorf("line %d: status %q without a uid", line, row.Status)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown status %q", line, row.Status)
+		}
+		m.rows = append(m.rows, row)
+	}
+	return m, nil
+}
+
+func knownManifestColumn(name string) bool {
+	for _, c := range manifestColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the index of the first row not yet minted, or -1 if every
+// row has been.
+func (m *manifest) next() int {
+	for i, row := range m.rows {
+		if row.Status == rowTodo {
+			return i
+		}
+	}
+	return -1
+}
+
+// remaining returns how many rows are not yet minted.
+func (m *manifest) remaining() int {
+	n := 0
+	for _, row := range m.rows {
+		if row.Status == rowTodo {
+			n++
+		}
+	}
+	return n
+}
+
+// mark records that row i was minted as uid with the given status.
+func (m *manifest) mark(i int, uid, status string) {
+	m.rows[i].Reg.UID = strings.ToLower(uid)
+	m.rows[i].Status = status
+}
+
+// write encodes the manifest as CSV in manifestColumns order.
+func (m *manifest) write(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(manifestColumns); err != nil {
+		return err
+	}
+	for _, row := range m.rows {
+		reg := row.Reg
+		itoa := func(n int) string {
+			if n == 0 {
+				return ""
+			}
+			return strconv.Itoa(n)
+		}
+		record := []string{reg.HatName, reg.HatColor, reg.HatSKU, reg.BatchID,
+			itoa(reg.BatchSize), itoa(reg.ScanCount), reg.Notes, reg.UID, row.Status}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// save rewrites the manifest file through a temporary file and rename, so an
+// interrupted save never leaves a truncated manifest.
+func (m *manifest) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := m.write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	return nil
+}
+
+// mintNext provisions the tag on conn for the next manifest row, registers
+// it and records the outcome in the manifest file. A row is only consumed
+// once a tag has been provisioned for it: a failed registration marks the
+// row pending (the registration is in pending/), a failed provisioning
+// leaves it for the next tag.
+func (m *manifest) mintNext(provision func() (string, error), r *registrar) error {
+	i := m.next()
+	if i < 0 {
+		return errors.New("manifest has no rows left")
+	}
+	row := m.rows[i]
+	fmt.Printf("Manifest row %d/%d: %s - %s\n", i+1, len(m.rows), row.Reg.HatName, row.Reg.HatColor)
+
+	uid, err := provision()
+	if err != nil {
+		return err
+	}
+
+	reg := row.Reg
+	reg.UID = strings.ToLower(uid)
+	status := rowDone
+	regErr := r.register(reg)
+	if regErr != nil {
+		status = rowPending
+	}
+	m.mark(i, uid, status)
+	if err := m.save(); err != nil {
+		return errors.Join(regErr, fmt.Errorf("row %d minted as %s: %w", i+1, reg.UID, err))
+	}
+	return regErr
+}
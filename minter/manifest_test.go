@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/barnettlynn/nfctools/minter/internal/config"
+)
+
+const testManifest = `batch_id, hat_name, hat_color, hat_sku, batch_size
+B7, Classic Trucker, Navy, CT-NVY, 3
+
+B7, Classic Trucker, "Red, White", CT-RW, 3
+B7, Dad Hat, Olive, , 3
+`
+
+func TestParseManifest(t *testing.T) {
+	m, err := parseManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatalf("parseManifest returned error: %v", err)
+	}
+	if len(m.rows) != 3 || m.remaining() != 3 || m.next() != 0 {
+		t.Fatalf("expected 3 unminted rows, got %d rows, %d remaining, next %d", len(m.rows), m.remaining(), m.next())
+	}
+	want := TagRegistration{HatName: "Classic Trucker", HatColor: "Red, White", HatSKU: "CT-RW", BatchID: "B7", BatchSize: 3}
+	if m.rows[1].Reg != want {
+		t.Fatalf("expected row 2 %+v, got %+v", want, m.rows[1].Reg)
+	}
+	if m.rows[2].Reg.HatSKU != "" {
+		t.Fatalf("expected empty SKU on row 3, got %q", m.rows[2].Reg.HatSKU)
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	cases := map[string]string{
+		"empty":          "",
+		"missing color":  "hat_name\nTrucker\n",
+		"unknown column": "hat_name,hat_color,size\nTrucker,Navy,L\n",
+		"blank name":     "hat_name,hat_color\n,Navy\n",
+		"bad batch size": "hat_name,hat_color,batch_size\nTrucker,Navy,many\n",
+		"done no uid":    "hat_name,hat_color,status\nTrucker,Navy,done\n",
+		"bad status":     "hat_name,hat_color,uid,status\nTrucker,Navy,04aa,skipped\n",
+	}
+	for name, content := range cases {
+		if _, err := parseManifest(strings.NewReader(content)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestManifestRowAdvancementSurvivesSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.csv")
+	if err := os.WriteFile(path, []byte(testManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %v", err)
+	}
+
+	m.mark(m.next(), "041E3C5A7B6F80", rowDone)
+	m.mark(m.next(), "04AABBCCDDEEFF", rowPending)
+	if m.next() != 2 || m.remaining() != 1 {
+		t.Fatalf("expected row 3 next with 1 remaining, got next %d remaining %d", m.next(), m.remaining())
+	}
+	if err := m.save(); err != nil {
+		t.Fatalf("save returned error: %v", err)
+	}
+
+	reloaded, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if reloaded.next() != 2 {
+		t.Fatalf("expected reloaded manifest to resume at row 3, got %d", reloaded.next())
+	}
+	if got := reloaded.rows[0]; got.Reg.UID != "041e3c5a7b6f80" || got.Status != rowDone {
+		t.Fatalf("expected row 1 done with lowercased UID, got %+v", got)
+	}
+	if got := reloaded.rows[1]; got.Reg.UID != "04aabbccddeeff" || got.Status != rowPending || got.Reg.HatColor != "Red, White" {
+		t.Fatalf("expected row 2 pending with its fields intact, got %+v", got)
+	}
+
+	reloaded.mark(2, "04010203040506", rowDone)
+	if reloaded.next() != -1 || reloaded.remaining() != 0 {
+		t.Fatalf("expected no rows left, got next %d remaining %d", reloaded.next(), reloaded.remaining())
+	}
+}
+
+func TestManifestMintNextRecordsUIDOnAPIFailure(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "batch.csv")
+	if err := os.WriteFile(path, []byte(testManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %v", err)
+	}
+	r := &registrar{
+		cfg:        &config.Config{API: config.APIConfig{Endpoint: srv.URL}},
+		backoff:    testBackoff(1, 0, &fakeClock{}),
+		pendingDir: filepath.Join(dir, pendingDirName),
+	}
+
+	// A failed provisioning leaves the row for the next tag.
+	provisionErr := errors.New("tag removed")
+	if err := m.mintNext(func() (string, error) { return "", provisionErr }, r); !errors.Is(err, provisionErr) {
+		t.Fatalf("expected provisioning error, got %v", err)
+	}
+	if m.next() != 0 {
+		t.Fatalf("expected row 1 still next, got %d", m.next())
+	}
+
+	if err := m.mintNext(func() (string, error) { return "041e3c5a7b6f80", nil }, r); err != nil {
+		t.Fatalf("mintNext returned error: %v", err)
+	}
+
+	status = http.StatusBadRequest
+	if err := m.mintNext(func() (string, error) { return "04aabbccddeeff", nil }, r); err == nil {
+		t.Fatal("expected registration error")
+	}
+
+	reloaded, err := loadManifest(path)
+	if err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if reloaded.rows[0].Status != rowDone || reloaded.rows[1].Status != rowPending || reloaded.rows[1].Reg.UID != "04aabbccddeeff" {
+		t.Fatalf("expected rows done/pending with UIDs recorded, got %+v", reloaded.rows[:2])
+	}
+	if _, err := loadPending(filepath.Join(dir, pendingDirName, "04aabbccddeeff.json")); err != nil {
+		t.Fatalf("expected failed registration in pending/: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := reloaded.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), strings.Join(manifestColumns, ",")+"\n") {
+		t.Fatalf("expected canonical header, got %q", buf.String())
+	}
+}
@@ -13,31 +13,72 @@ const (
 	counterFileNo    = 0x02
 	ndefFileNo       = 0x01 // NDEF file number (different from counterFileNo)
 	authDefaultKeyNo = 0x00
+
+	proprietaryFileNo = 0x03
+	fileThreeKeyNo    = 0x03
 )
 
+// proprietaryData is the optional file 3 payload (proprietary.data_file)
+// and the slot 3 key that guards it. provisionTag fills in key per tag from
+// its KeyProvider.
+type proprietaryData struct {
+	key  []byte
+	data []byte
+}
+
 // provisionTag provisions an NTAG 424 DNA tag with the specified keys and SDM configuration.
 // Handles tags in factory default state (all keys = zeros) regardless of File 2 access rights.
 //
 // Steps:
-//  1. Get UID
+//  1. Get the real UID (ntag424.ProvisioningUID)
 //  2. Build SDM NDEF template
 //  3. Authenticate with zero key and set File 2 to Write=free (if needed)
 //  4. Write NDEF using plain write
 //  5. Select NDEF app
 //  6. Re-authenticate with factory zero key (slot 0) to enable key changes
-//  7. Change keys: SDM (slot 1), NDEF write (slot 2), App master (slot 0)
-//  8. Re-select NDEF app
+//  7. Change keys: SDM (slot 1), NDEF write (slot 2), App master (slot 0),
+//     rolled back to the factory key if any change fails
+//  8. Verify the new app master key (RotateKeySame re-selects and re-authenticates)
 //  9. Re-authenticate with new app master key
-// 10. Configure SDM file settings
+// 10. Read the real UID with GetCardUID (see ntag424.RealUID)
+// 11. Configure SDM file settings on sdmFileNo from profile
+// 12. If prop is set, provision file 3 (see provisionProprietaryData)
+//
+// The keys for slots 0-2, and slot 3 when prop is set, come from keys once
+// the UID is known and before anything is written: a StaticKeyProvider gives
+// every tag the loaded keys, a DiversifiedKeyProvider derives per-tag keys
+// from the UID (AN10922).
 //
-// Returns the tag UID as a hex string (uppercase) on success.
-func provisionTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey []byte, baseURL string) (string, error) {
-	// 1) Get UID
-	uid, err := ntag424.GetUID(conn)
+// Returns the real tag UID as a hex string (uppercase) on success. Step 1
+// reads the real UID with ntag424.ProvisioningUID (GET DATA, or GetCardUID
+// on a random-ID tag), so diversified keys are derived from the UID that is
+// registered; step 10 reads it again over the new session and checks that.
+func provisionTag(conn *ntag424.Connection, profile ntag424.ProvisioningProfile, keys ntag424.KeyProvider, baseURL string, sdmFileNo byte, prop *proprietaryData) (string, error) {
+	// 1) Get the real UID the keys are derived from
+	uid, err := ntag424.ProvisioningUID(conn, keys)
 	if err != nil {
 		return "", fmt.Errorf("get UID: %w", err)
 	}
-	uidHex := strings.ToUpper(hex.EncodeToString(uid))
+
+	appMasterKey, err := keys.KeyForSlot(uid, 0x00)
+	if err != nil {
+		return "", fmt.Errorf("tag keys: %w", err)
+	}
+	sdmKey, err := keys.KeyForSlot(uid, 0x01)
+	if err != nil {
+		return "", fmt.Errorf("tag keys: %w", err)
+	}
+	ndefKey, err := keys.KeyForSlot(uid, 0x02)
+	if err != nil {
+		return "", fmt.Errorf("tag keys: %w", err)
+	}
+	if prop != nil {
+		key, err := keys.KeyForSlot(uid, fileThreeKeyNo)
+		if err != nil {
+			return "", fmt.Errorf("tag keys: %w", err)
+		}
+		prop = &proprietaryData{key: key, data: prop.data}
+	}
 
 	// 2) Build SDM NDEF template
 	sdm, err := ntag424.BuildSDMNDEF(baseURL)
@@ -48,17 +89,11 @@ func provisionTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey []byte
 	// 3) Ensure tag is at factory defaults before provisioning
 	// Try to authenticate - if tag is provisioned, reset it first
 	zeroKey := make([]byte, 16)
-	if err := ntag424.SelectNDEFApp(conn); err != nil {
-		return "", fmt.Errorf("select NDEF app for prep: %w", err)
-	}
-	sess, authKey, _, err := ntag424.AuthenticateWithFallback(conn, appMasterKey, authDefaultKeyNo, authDefaultKeyNo)
+	provisioned, authKey, sess, err := ntag424.TagState(conn, appMasterKey)
 	if err != nil {
-		return "", fmt.Errorf("authenticate for prep: %w", err)
+		return "", fmt.Errorf("check tag state for prep: %w", err)
 	}
 
-	// Determine if tag is provisioned by checking which key authenticated
-	provisioned := !bytes.Equal(authKey, zeroKey)
-
 	// If tag is provisioned, reset it to factory defaults
 	if provisioned {
 		// Reset all keys to zeros
@@ -68,14 +103,11 @@ func provisionTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey []byte
 		if err := ntag424.ChangeKey(conn, sess, 0x02, zeroKey, ndefKey, 0x00, authDefaultKeyNo); err != nil {
 			return "", fmt.Errorf("reset key slot 2: %w", err)
 		}
-		if err := ntag424.ChangeKeySame(conn, sess, 0x00, zeroKey, 0x00); err != nil {
+		if err := ntag424.RotateKeySame(conn, 0x00, authKey, zeroKey, 0x00); err != nil {
 			return "", fmt.Errorf("reset key slot 0: %w", err)
 		}
 
 		// Re-authenticate with zero key
-		if err := ntag424.SelectNDEFApp(conn); err != nil {
-			return "", fmt.Errorf("re-select after reset: %w", err)
-		}
 		sess, err = ntag424.AuthenticateEV2First(conn, zeroKey, authDefaultKeyNo)
 		if err != nil {
 			return "", fmt.Errorf("re-auth after reset: %w", err)
@@ -91,13 +123,15 @@ func provisionTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey []byte
 	_ = authKey // Mark as used
 
 	// 4) Write NDEF using plain write (now Write=free is guaranteed)
-	// WriteNDEFPlain selects NDEF app and file, then writes using ISO UPDATE BINARY
-	if err := ntag424.WriteNDEFPlain(conn, sdm.NDEF); err != nil {
+	// WriteNDEFPlainVerified selects NDEF app and file, writes using ISO UPDATE
+	// BINARY, then reads the NDEF back so a corrupt write fails before the
+	// tag is registered with the API
+	if err := ntag424.WriteNDEFPlainVerified(conn, sdm.NDEF); err != nil {
 		return "", fmt.Errorf("write NDEF: %w", err)
 	}
 
 	// 5) Select NDEF application to set up for authentication
-	// (WriteNDEFPlain already selected it, but being explicit for clarity)
+	// (WriteNDEFPlainVerified already selected it, but being explicit for clarity)
 	if err := ntag424.SelectNDEFApp(conn); err != nil {
 		return "", fmt.Errorf("select NDEF app for auth: %w", err)
 	}
@@ -108,55 +142,94 @@ func provisionTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey []byte
 		return "", fmt.Errorf("authenticate with factory key: %w", err)
 	}
 
-	// 7) Change keys: SDM (slot 1), NDEF write (slot 2), App master (slot 0)
-	// Change slot 1 (SDM key)
-	if err := ntag424.ChangeKey(conn, sess, 0x01, sdmKey, zeroKey, 0x01, authDefaultKeyNo); err != nil {
-		return "", fmt.Errorf("change key slot 1 (SDM): %w", err)
+	// 7) Change keys: SDM (slot 1), NDEF write (slot 2), App master (slot 0).
+	// ProvisionKeys changes slot 0 last and verifies it; if any change
+	// fails it puts the changed slots back to the factory key, so the tag
+	// can simply be minted again
+	if err := ntag424.ProvisionKeys(conn, sess, []ntag424.KeyChange{
+		{Slot: 0x01, OldKey: zeroKey, NewKey: sdmKey, NewVersion: 0x01},
+		{Slot: 0x02, OldKey: zeroKey, NewKey: ndefKey, NewVersion: 0x01},
+		{Slot: 0x00, OldKey: zeroKey, NewKey: appMasterKey, NewVersion: 0x01},
+	}); err != nil {
+		return "", fmt.Errorf("change keys: %w", err)
 	}
 
-	// Change slot 2 (NDEF write key)
-	if err := ntag424.ChangeKey(conn, sess, 0x02, ndefKey, zeroKey, 0x01, authDefaultKeyNo); err != nil {
-		return "", fmt.Errorf("change key slot 2 (NDEF write): %w", err)
+	// 8-9) Authenticate with new app master key for the settings change
+	// (ProvisionKeys leaves the NDEF app selected but no session)
+	sess, err = ntag424.AuthenticateEV2First(conn, appMasterKey, 0x00)
+	if err != nil {
+		return "", fmt.Errorf("re-authenticate with new app master key: %w", err)
 	}
 
-	// Change slot 0 (app master key) - uses current auth key as old key
-	if err := ntag424.ChangeKeySame(conn, sess, 0x00, appMasterKey, 0x01); err != nil {
-		return "", fmt.Errorf("change key slot 0 (app master): %w", err)
+	// 10) Read the real UID over the authenticated channel
+	realUID, err := ntag424.RealUID(conn, sess)
+	if err != nil {
+		return "", fmt.Errorf("read real UID: %w", err)
 	}
+	if !bytes.Equal(realUID, uid) {
+		return "", fmt.Errorf("real UID %X differs from the UID %X the keys were derived from", realUID, uid)
+	}
+	uidHex := strings.ToUpper(hex.EncodeToString(realUID))
 
-	// 8) Re-select NDEF app (required before re-authenticating)
-	if err := ntag424.SelectNDEFApp(conn); err != nil {
-		return "", fmt.Errorf("re-select NDEF app: %w", err)
+	// 11) Configure SDM file settings from the profile
+	if err := ntag424.ChangeFileSettingsProfile(conn, sess, sdmFileNo, profile, sdm); err != nil {
+		return "", fmt.Errorf("change file settings SDM: %w", err)
 	}
 
-	// 9) Re-authenticate with new app master key (session is invalidated after changing slot 0)
-	sess, err = ntag424.AuthenticateEV2First(conn, appMasterKey, 0x00)
+	// 12) Optional proprietary data in file 3
+	if prop != nil {
+		if err := provisionProprietaryData(conn, appMasterKey, prop); err != nil {
+			return "", err
+		}
+	}
+
+	return uidHex, nil
+}
+
+// provisionProprietaryData puts prop.key in slot 3, switches file 3 to Full
+// comm mode with slot 3 guarding read and write, and writes prop.data with
+// WriteFileDataSecure.
+//
+// Steps:
+//  1. Check whether slot 3 already holds prop.key (a re-provisioned tag)
+//  2. Authenticate slot 0 and change slot 3 from the factory zero key if not
+//  3. Set file 3: FileOption=0x03 (Full), RW=3 CAR=0, R=3 W=3
+//  4. Authenticate slot 3 and write the payload at offset 0
+func provisionProprietaryData(conn *ntag424.Connection, appMasterKey []byte, prop *proprietaryData) error {
+	hasKey, err := ntag424.VerifyKeyByReauth(conn, fileThreeKeyNo, prop.key)
 	if err != nil {
-		return "", fmt.Errorf("re-authenticate with new app master key: %w", err)
+		return fmt.Errorf("check key slot 3: %w", err)
 	}
 
-	// 10) Configure SDM file settings
-	// Access rights: RW=0x02, CAR=0x00, R=0x0E (free), W=0x02
-	const (
-		rwKeyNo  = 0x02
-		carKeyNo = 0x00
-		rKeyNo   = 0x0E
-		wKeyNo   = 0x02
-	)
-	ar1 := byte((rwKeyNo << 4) | carKeyNo)
-	ar2 := byte((rKeyNo << 4) | wKeyNo)
-
-	// SDM options: 0xC1 = UID+ReadCtr mirroring, ASCII encoding
-	sdmOptions := byte(0xC1)
-	sdmMeta := byte(0x0E)    // plain meta
-	sdmFile := byte(0x01)    // SDM file read key
-	sdmCtr := byte(0x01)     // SDM counter key
-
-	if err := ntag424.ChangeFileSettingsSDM(conn, sess, counterFileNo, 0x00, ar1, ar2,
-		sdmOptions, sdmMeta, sdmFile, sdmCtr,
-		sdm.UIDOffset, sdm.CtrOffset, sdm.MacInputOffset, sdm.MacOffset); err != nil {
-		return "", fmt.Errorf("change file settings SDM: %w", err)
+	if err := ntag424.SelectNDEFApp(conn); err != nil {
+		return fmt.Errorf("select NDEF app for file 3: %w", err)
+	}
+	sess, err := ntag424.AuthenticateEV2First(conn, appMasterKey, authDefaultKeyNo)
+	if err != nil {
+		return fmt.Errorf("authenticate for file 3: %w", err)
+	}
+	if !hasKey {
+		zeroKey := make([]byte, 16)
+		if err := ntag424.ChangeKey(conn, sess, fileThreeKeyNo, prop.key, zeroKey, 0x01, authDefaultKeyNo); err != nil {
+			return fmt.Errorf("change key slot 3 (file 3): %w", err)
+		}
 	}
 
-	return uidHex, nil
+	ar1 := byte(fileThreeKeyNo<<4 | authDefaultKeyNo)
+	ar2 := byte(fileThreeKeyNo<<4 | fileThreeKeyNo)
+	if err := ntag424.ChangeFileSettingsBasic(conn, sess, proprietaryFileNo, 0x03, ar1, ar2); err != nil && !ntag424.IsNoChanges(err) {
+		return fmt.Errorf("set file 3 to full comm mode: %w", err)
+	}
+
+	if err := ntag424.SelectNDEFApp(conn); err != nil {
+		return fmt.Errorf("select NDEF app for file 3 write: %w", err)
+	}
+	sess, err = ntag424.AuthenticateEV2First(conn, prop.key, fileThreeKeyNo)
+	if err != nil {
+		return fmt.Errorf("authenticate key slot 3: %w", err)
+	}
+	if err := ntag424.WriteFileDataSecure(conn, sess, proprietaryFileNo, 0, prop.data); err != nil {
+		return fmt.Errorf("write file 3: %w", err)
+	}
+	return nil
 }
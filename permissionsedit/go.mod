@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/ebfe/scard v0.0.0-20241214075232-7af069cabc25
 	golang.org/x/term v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.29.0 // indirect
@@ -14,10 +14,13 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
+	"github.com/barnettlynn/nfctools/pkg/ntag424/prompt"
 	"github.com/ebfe/scard"
-	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 // ============================================================================
@@ -51,7 +54,7 @@ type fileSettings struct {
 	sdmMeta        byte
 	sdmFile        byte
 	sdmCtr         byte
-	rawData        []byte // Store raw response for building ChangeFileSettings
+	rawData        []byte // Settings bytes as the tag sent them, set by parseFileSettings; kept for ChangeFileSettings
 	uidOffset      uint32
 	ctrOffset      uint32
 	macInputOffset uint32
@@ -61,20 +64,16 @@ type fileSettings struct {
 	ctrLimit       uint32
 }
 
+func (fs *fileSettings) accessRights() ntag424.AccessRights {
+	return ntag424.DecodeAccessRights(fs.ar1, fs.ar2)
+}
+
 // ============================================================================
 // Card I/O
 // ============================================================================
 
 func transmit(card *scard.Card, apdu []byte) ([]byte, uint16, error) {
-	resp, err := card.Transmit(apdu)
-	if err != nil {
-		return nil, 0, err
-	}
-	if len(resp) < 2 {
-		return nil, 0, fmt.Errorf("short response: %d bytes", len(resp))
-	}
-	sw := uint16(resp[len(resp)-2])<<8 | uint16(resp[len(resp)-1])
-	return resp[:len(resp)-2], sw, nil
+	return ntag424.Transmit(card, apdu)
 }
 
 func swOK(sw uint16) bool {
@@ -111,91 +110,6 @@ func selectNDEFApp(card *scard.Card) error {
 // Crypto
 // ============================================================================
 
-type cipherBlock interface {
-	Encrypt(dst, src []byte)
-}
-
-func xorBlock(dst, a, b []byte) {
-	for i := 0; i < len(a) && i < len(b); i++ {
-		dst[i] = a[i] ^ b[i]
-	}
-}
-
-func leftShift1(dst, src []byte) {
-	var carry byte
-	for i := len(src) - 1; i >= 0; i-- {
-		b := src[i]
-		dst[i] = (b << 1) | carry
-		carry = (b >> 7) & 1
-	}
-}
-
-func generateCMACSubkeys(block cipherBlock) (k1, k2 []byte) {
-	const Rb = 0x87
-	zero := make([]byte, 16)
-	L := make([]byte, 16)
-	block.Encrypt(L, zero)
-
-	k1 = make([]byte, 16)
-	leftShift1(k1, L)
-	if (L[0] & 0x80) != 0 {
-		k1[15] ^= Rb
-	}
-
-	k2 = make([]byte, 16)
-	leftShift1(k2, k1)
-	if (k1[0] & 0x80) != 0 {
-		k2[15] ^= Rb
-	}
-	return k1, k2
-}
-
-func aesCMAC(key, msg []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-	k1, k2 := generateCMACSubkeys(block)
-
-	n := (len(msg) + 15) / 16
-	if n == 0 {
-		n = 1
-	}
-	lastComplete := len(msg) != 0 && len(msg)%16 == 0
-
-	last := make([]byte, 16)
-	if lastComplete {
-		copy(last, msg[(n-1)*16:])
-		xorBlock(last, last, k1)
-	} else {
-		remain := len(msg) - (n-1)*16
-		if remain > 0 {
-			copy(last, msg[(n-1)*16:])
-		}
-		last[remain] = 0x80
-		xorBlock(last, last, k2)
-	}
-
-	X := make([]byte, 16)
-	Y := make([]byte, 16)
-	for i := 0; i < n-1; i++ {
-		blockStart := i * 16
-		xorBlock(Y, X, msg[blockStart:blockStart+16])
-		block.Encrypt(X, Y)
-	}
-	xorBlock(Y, X, last)
-	block.Encrypt(X, Y)
-	return X, nil
-}
-
-func truncateOddBytes(cmac []byte) []byte {
-	out := make([]byte, 8)
-	for i := 0; i < 8; i++ {
-		out[i] = cmac[1+i*2]
-	}
-	return out
-}
-
 func aesCBCEncrypt(key, iv, data []byte) ([]byte, error) {
 	if len(data)%16 != 0 {
 		return nil, fmt.Errorf("CBC encrypt: data not block aligned")
@@ -237,25 +151,6 @@ func aesECBEncrypt(key, blockIn []byte) ([]byte, error) {
 	return out, nil
 }
 
-func padISO9797M2(data []byte) []byte {
-	padLen := 16 - (len(data) % 16)
-	out := make([]byte, len(data)+padLen)
-	copy(out, data)
-	out[len(data)] = 0x80
-	return out
-}
-
-func unpadISO9797M2(data []byte) ([]byte, error) {
-	idx := len(data) - 1
-	for idx >= 0 && data[idx] == 0x00 {
-		idx--
-	}
-	if idx < 0 || data[idx] != 0x80 {
-		return nil, errors.New("bad padding")
-	}
-	return data[:idx], nil
-}
-
 func rotateLeft1(in []byte) []byte {
 	out := make([]byte, len(in))
 	if len(in) == 0 {
@@ -347,11 +242,11 @@ func authenticateEV2First(card *scard.Card, key []byte, keyNo byte) (*session, e
 	copy(sv1[24:32], rndA[8:16])
 	copy(sv2[24:32], rndA[8:16])
 
-	kenc, err := aesCMAC(key, sv1)
+	kenc, err := ntag424.AESCMAC(key, sv1)
 	if err != nil {
 		return nil, err
 	}
-	kmac, err := aesCMAC(key, sv2)
+	kmac, err := ntag424.AESCMAC(key, sv2)
 	if err != nil {
 		return nil, err
 	}
@@ -364,10 +259,18 @@ func authenticateEV2First(card *scard.Card, key []byte, keyNo byte) (*session, e
 	return s, nil
 }
 
-func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte) ([]byte, error) {
+// ssmCmd runs cmd in the authenticated session. mode says how the response
+// is protected: CommModeMAC responses are cleartext plus MAC (GetFileSettings),
+// CommModeFull responses are encrypted. The mode must come from the caller;
+// a 16-byte cleartext response looks exactly like one block of ciphertext.
+// The command itself is always sent in Full mode.
+func ssmCmd(card *scard.Card, sess *session, mode ntag424.CommMode, cmd byte, header, data []byte) ([]byte, error) {
 	if sess == nil {
 		return nil, errors.New("session is nil")
 	}
+	if mode != ntag424.CommModeMAC && mode != ntag424.CommModeFull {
+		return nil, fmt.Errorf("unsupported response comm mode %s", mode)
+	}
 
 	ivcIn := make([]byte, 16)
 	ivcIn[0] = 0xA5
@@ -382,7 +285,7 @@ func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte)
 
 	encData := []byte{}
 	if len(data) > 0 {
-		padded := padISO9797M2(data)
+		padded := ntag424.PadISO9797M2(data)
 		encData, err = aesCBCEncrypt(sess.kenc[:], ivc, padded)
 		if err != nil {
 			return nil, err
@@ -396,11 +299,11 @@ func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte)
 	macInput = append(macInput, header...)
 	macInput = append(macInput, encData...)
 
-	cmac, err := aesCMAC(sess.kmac[:], macInput)
+	cmac, err := ntag424.AESCMAC(sess.kmac[:], macInput)
 	if err != nil {
 		return nil, err
 	}
-	mact := truncateOddBytes(cmac)
+	mact := ntag424.TruncateOddBytes(cmac)
 
 	dataLen := len(header) + len(encData) + len(mact)
 	if dataLen > 255 {
@@ -424,40 +327,10 @@ func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte)
 		return nil, fmt.Errorf("response too short (len=%d, SW=%04X)", len(resp), sw)
 	}
 
-	// Save original response for MAC calculation
-	origResp := resp
-
-	// First, determine if response is encrypted or plain by checking alignment
-	respEncLen := len(resp) - 8
-	if respEncLen < 0 {
-		return nil, fmt.Errorf("response too short for MAC (len=%d)", len(resp))
-	}
-	isEncrypted := (respEncLen == 0 || respEncLen%16 == 0)
-
-	// For ENCRYPTED responses: skip status byte (0x00)
-	// For PLAIN responses: DON'T skip - the 0x00 might be the file type!
-	if isEncrypted && len(resp) > 0 && resp[0] == 0x00 {
-		resp = resp[1:]
-		// Recalculate after skipping status
-		respEncLen = len(resp) - 8
-		if respEncLen < 0 {
-			return nil, fmt.Errorf("response too short for MAC after status skip (len=%d)", len(resp))
-		}
-	}
-	var respEnc []byte
-	var respPlain []byte
-	var respMac []byte
-
-	if isEncrypted {
-		// Standard encrypted response
-		respEnc = resp[:respEncLen]
-		respMac = resp[respEncLen:]
-	} else {
-		// Plain data response (happens when file CommMode is Plain)
-		// Format: [Plain data] + [CMAC (8 bytes)]
-		respPlain = resp[:respEncLen]
-		respMac = resp[respEncLen:]
-	}
+	// Response: [data (cleartext or encrypted)] + [CMAC (8 bytes)]
+	respDataLen := len(resp) - 8
+	respData := resp[:respDataLen]
+	respMac := resp[respDataLen:]
 
 	cmdCtr1 := sess.cmdCtr + 1
 	ivrIn := make([]byte, 16)
@@ -471,40 +344,32 @@ func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte)
 		return nil, err
 	}
 
-	// Build MAC input - use ORIGINAL response (with status bytes) for MAC calculation
-	// The MAC is calculated over: SW2 || CmdCtr || TI || [status bytes] || data
-	// But we only use the data portion (excluding final MAC bytes)
-	macDataWithStatus := origResp[:len(origResp)-8]
-
-	macIn2 := make([]byte, 0, 8+len(macDataWithStatus))
+	// The MAC is calculated over: SW2 || CmdCtr+1 || TI || data
+	macIn2 := make([]byte, 0, 8+respDataLen)
 	macIn2 = append(macIn2, byte(sw&0xFF))
 	macIn2 = append(macIn2, byte(cmdCtr1&0xFF), byte((cmdCtr1>>8)&0xFF))
 	macIn2 = append(macIn2, sess.ti[:]...)
-	macIn2 = append(macIn2, macDataWithStatus...)
+	macIn2 = append(macIn2, respData...)
 
-	cmac2, err := aesCMAC(sess.kmac[:], macIn2)
+	cmac2, err := ntag424.AESCMAC(sess.kmac[:], macIn2)
 	if err != nil {
 		return nil, err
 	}
-	mact2 := truncateOddBytes(cmac2)
+	mact2 := ntag424.TruncateOddBytes(cmac2)
 	if !bytes.Equal(respMac, mact2) {
 		return nil, errors.New("response MAC mismatch")
 	}
 
-	out := []byte{}
-	if isEncrypted && respEncLen > 0 {
-		// Decrypt encrypted data
-		dec, err := aesCBCDecrypt(sess.kenc[:], ivr, respEnc)
+	out := append([]byte{}, respData...)
+	if mode == ntag424.CommModeFull && respDataLen > 0 {
+		dec, err := aesCBCDecrypt(sess.kenc[:], ivr, respData)
 		if err != nil {
 			return nil, err
 		}
-		out, err = unpadISO9797M2(dec)
+		out, err = ntag424.UnpadISO9797M2(dec)
 		if err != nil {
 			return nil, err
 		}
-	} else if !isEncrypted {
-		// Use plain data directly
-		out = respPlain
 	}
 
 	sess.cmdCtr = cmdCtr1
@@ -516,16 +381,11 @@ func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte)
 // ============================================================================
 
 func getFileSettings(card *scard.Card, sess *session, fileNo byte) (*fileSettings, error) {
-	out, err := ssmCmdFull(card, sess, 0xF5, []byte{fileNo}, nil)
-	if err != nil {
-		return nil, err
-	}
-	fs, err := parseFileSettings(out)
+	out, err := ssmCmd(card, sess, ntag424.CommModeMAC, 0xF5, []byte{fileNo}, nil)
 	if err != nil {
 		return nil, err
 	}
-	fs.rawData = out // Store for later use in ChangeFileSettings
-	return fs, nil
+	return parseFileSettings(out)
 }
 
 func getFileSettingsPlain(card *scard.Card, fileNo byte) (*fileSettings, error) {
@@ -537,12 +397,7 @@ func getFileSettingsPlain(card *scard.Card, fileNo byte) (*fileSettings, error)
 	if !swOK(sw) {
 		return nil, fmt.Errorf("GetFileSettings failed (SW=%04X)", sw)
 	}
-	fs, err := parseFileSettings(resp)
-	if err != nil {
-		return nil, err
-	}
-	fs.rawData = resp
-	return fs, nil
+	return parseFileSettings(resp)
 }
 
 func parseFileSettings(data []byte) (*fileSettings, error) {
@@ -555,6 +410,7 @@ func parseFileSettings(data []byte) (*fileSettings, error) {
 	fs.ar1 = data[2]
 	fs.ar2 = data[3]
 	fs.size = int(data[4]) | int(data[5])<<8 | int(data[6])<<16
+	fs.rawData = append([]byte(nil), data...)
 
 	idx := 7
 	if (fs.fileOption & 0x40) == 0 {
@@ -631,7 +487,7 @@ func parseFileSettings(data []byte) (*fileSettings, error) {
 }
 
 func changeFileSettings(card *scard.Card, sess *session, fileNo byte, newSettings []byte) error {
-	_, err := ssmCmdFull(card, sess, 0x5F, []byte{fileNo}, newSettings)
+	_, err := ssmCmd(card, sess, ntag424.CommModeFull, 0x5F, []byte{fileNo}, newSettings)
 	return err
 }
 
@@ -649,40 +505,56 @@ func commModeLabel(fileOption byte) string {
 	}
 }
 
-func accessLabel(keyNo byte) string {
+// slotRolesFile is the -slot-roles YAML layout:
+//
+//	slot_roles:
+//	  0: AppMaster
+//	  3: Loyalty
+type slotRolesFile struct {
+	SlotRoles map[int]string `yaml:"slot_roles"`
+}
+
+// loadSlotRoles reads a -slot-roles file and applies it to
+// ntag424.DefaultSlotRoles: listed slots get the given role, an empty role
+// removes it, and unlisted slots keep the standard label.
+func loadSlotRoles(path string) (ntag424.SlotRoles, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read slot roles: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	var f slotRolesFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse slot roles yaml: %w", err)
+	}
+	return ntag424.DefaultSlotRoles().WithOverrides(f.SlotRoles)
+}
+
+func accessLabel(keyNo byte, roles ntag424.SlotRoles) string {
 	switch keyNo {
 	case 0xE:
 		return "Free"
 	case 0xF:
 		return "Denied"
-	case 0:
-		return "Key 0 (AppMaster)"
-	case 1:
-		return "Key 1 (SDM)"
-	case 2:
-		return "Key 2 (File 2 Write)"
-	case 3:
-		return "Key 3"
-	case 4:
-		return "Key 4"
 	default:
+		if role := roles.Role(keyNo); role != "" {
+			return fmt.Sprintf("Key %d (%s)", keyNo, role)
+		}
 		return fmt.Sprintf("Key %d", keyNo)
 	}
 }
 
-func displayFileSettings(fileNo byte, name string, fs *fileSettings) {
+func displayFileSettings(fileNo byte, name string, fs *fileSettings, roles ntag424.SlotRoles) {
 	fmt.Printf("\nFile %d (%s):\n", fileNo, name)
 	fmt.Printf("  CommMode:     %s\n", commModeLabel(fs.fileOption))
 
-	readKey := (fs.ar2 >> 4) & 0x0F
-	writeKey := fs.ar2 & 0x0F
-	readWriteKey := (fs.ar1 >> 4) & 0x0F
-	changeAccessKey := fs.ar1 & 0x0F
+	ar := fs.accessRights()
 
-	fmt.Printf("  Read:         %s\n", accessLabel(readKey))
-	fmt.Printf("  Write:        %s\n", accessLabel(writeKey))
-	fmt.Printf("  ReadWrite:    %s\n", accessLabel(readWriteKey))
-	fmt.Printf("  ChangeAccess: %s\n", accessLabel(changeAccessKey))
+	fmt.Printf("  Read:         %s\n", accessLabel(ar.Read, roles))
+	fmt.Printf("  Write:        %s\n", accessLabel(ar.Write, roles))
+	fmt.Printf("  ReadWrite:    %s\n", accessLabel(ar.ReadWrite, roles))
+	fmt.Printf("  ChangeAccess: %s\n", accessLabel(ar.ChangeAccessRights, roles))
 
 	if (fs.fileOption & 0x40) != 0 {
 		fmt.Printf("  SDM:          Enabled\n")
@@ -692,9 +564,9 @@ func displayFileSettings(fileNo byte, name string, fs *fileSettings) {
 		fmt.Printf("    ReadCtr limit:    %s\n", onOff((fs.sdmOptions&0x20) != 0))       // Bit 5
 		fmt.Printf("    Enc file data:    %s\n", onOff((fs.sdmOptions&0x10) != 0))       // Bit 4
 		fmt.Printf("    ASCII encoding:   %s\n", onOff((fs.sdmOptions&0x01) != 0))       // Bit 0
-		fmt.Printf("    SDMMetaRead:      %s\n", accessLabel(fs.sdmMeta))
-		fmt.Printf("    SDMFileRead:      %s\n", accessLabel(fs.sdmFile))
-		fmt.Printf("    SDMCtrRet:        %s\n", accessLabel(fs.sdmCtr))
+		fmt.Printf("    SDMMetaRead:      %s\n", accessLabel(fs.sdmMeta, roles))
+		fmt.Printf("    SDMFileRead:      %s\n", accessLabel(fs.sdmFile, roles))
+		fmt.Printf("    SDMCtrRet:        %s\n", accessLabel(fs.sdmCtr, roles))
 	}
 }
 
@@ -786,7 +658,7 @@ func onOff(b bool) string {
 	return "Off"
 }
 
-func selectSDMAccessKey(prompt string, current byte, allowDenied bool) byte {
+func selectSDMAccessKey(p prompt.Prompter, title string, current byte, allowDenied bool) (byte, error) {
 	items := []string{}
 	values := []byte{}
 
@@ -815,361 +687,351 @@ func selectSDMAccessKey(prompt string, current byte, allowDenied bool) byte {
 		}
 	}
 
-	idx := selectMenu(prompt, items)
-	if idx < 0 || idx >= len(values) {
-		return current
+	idx, err := p.Select(title, items)
+	if err != nil {
+		return current, err
 	}
-	return values[idx]
+	return values[idx], nil
 }
 
 // ============================================================================
-// Interactive Menu
+// Settings Edit
 // ============================================================================
 
-func selectMenu(prompt string, items []string) int {
-	if len(items) == 0 {
-		return -1
+type fileInfo struct {
+	no   byte
+	name string
+}
+
+// settingsEdit is the requested new state of one file's settings. The SDM
+// fields are only used when sdmEdited is set; otherwise the current SDM
+// configuration is kept (or dropped when sdmDisabled is set).
+type settingsEdit struct {
+	commMode    byte
+	ar          ntag424.AccessRights
+	sdmEdited   bool
+	sdmDisabled bool
+	sdmOptions  byte
+	sdmMeta     byte
+	sdmFile     byte
+	sdmCtr      byte
+
+	// structural is the sdmStructuralChange reason, if any. Such edits are
+	// only applied when offsets can be rediscovered from the NDEF file.
+	structural string
+	offsets    *ntag424.SDMNDEF
+}
+
+// editFlags holds the non-interactive flag values. Empty strings keep the
+// current setting. A preset is applied first; the other flags override it.
+type editFlags struct {
+	preset    string
+	commMode  string
+	read      string
+	write     string
+	readWrite string
+	change    string
+}
+
+// parseAccessCond parses an access condition flag: "free", "denied" or a key
+// number 0-4.
+func parseAccessCond(s string) (byte, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "free":
+		return ntag424.ARFree, nil
+	case "denied":
+		return ntag424.ARDenied, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 || n > 4 {
+		return 0, fmt.Errorf("invalid access condition %q (want free, denied or 0..4)", s)
 	}
+	return byte(n), nil
+}
 
-	// Put stdin into raw mode
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error setting raw mode: %v\r\n", err)
-		return -1
+// parseCommMode parses "plain", "mac" or "full" into the FileOption comm
+// mode bits.
+func parseCommMode(s string) (byte, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "plain":
+		return 0x00, nil
+	case "mac":
+		return 0x01, nil
+	case "full":
+		return 0x03, nil
+	default:
+		return 0, fmt.Errorf("invalid comm mode %q (want plain, mac or full)", s)
 	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
+}
 
-	selected := 0
+// applyEditFlags starts from the current settings and overrides whatever the
+// flags specify. SDM settings are always preserved, so a preset never makes
+// a structural SDM change.
+func applyEditFlags(current *fileSettings, f editFlags) (settingsEdit, error) {
+	edit := settingsEdit{
+		commMode: current.fileOption & 0x03,
+		ar:       current.accessRights(),
+	}
 
-	// Initial render
-	fmt.Printf("%s\r\n", prompt)
-	for i, item := range items {
-		if i == selected {
-			fmt.Printf("> %s\r\n", item)
-		} else {
-			fmt.Printf("  %s\r\n", item)
+	if f.preset != "" {
+		preset, ok := ntag424.LookupAccessPreset(strings.ToLower(strings.TrimSpace(f.preset)))
+		if !ok {
+			return edit, fmt.Errorf("-preset: unknown preset %q (see -list-presets)", f.preset)
 		}
+		edit.commMode = preset.CommMode & 0x03
+		edit.ar = preset.Access
 	}
 
-	// Read loop
-	buf := make([]byte, 3)
-	for {
-		n, err := os.Stdin.Read(buf)
+	if f.commMode != "" {
+		mode, err := parseCommMode(f.commMode)
 		if err != nil {
-			break
+			return edit, fmt.Errorf("-comm-mode: %w", err)
 		}
+		edit.commMode = mode
+	}
 
-		if n == 1 {
-			// Single byte commands
-			switch buf[0] {
-			case 0x0D, 0x0A: // Enter
-				// Move cursor down past menu, then restore terminal
-				fmt.Printf("\r\n")
-				return selected
-			case 0x03: // Ctrl-C
-				term.Restore(int(os.Stdin.Fd()), oldState)
-				fmt.Printf("\r\n")
-				os.Exit(0)
-			}
-		} else if n == 3 && buf[0] == 0x1B && buf[1] == '[' {
-			// Arrow keys
-			needRedraw := false
-			switch buf[2] {
-			case 'A': // Up arrow
-				if selected > 0 {
-					selected--
-					needRedraw = true
-				}
-			case 'B': // Down arrow
-				if selected < len(items)-1 {
-					selected++
-					needRedraw = true
-				}
-			}
-
-			if needRedraw {
-				// Move cursor up to start of menu (skip prompt line)
-				fmt.Printf("\033[%dA", len(items))
-				// Redraw all items
-				for i, item := range items {
-					// Clear line and return to column 0
-					fmt.Print("\033[2K\r")
-					if i == selected {
-						fmt.Printf("> %s\r\n", item)
-					} else {
-						fmt.Printf("  %s\r\n", item)
-					}
-				}
-			}
+	conds := []struct {
+		flag  string
+		value string
+		dst   *byte
+	}{
+		{"-read", f.read, &edit.ar.Read},
+		{"-write", f.write, &edit.ar.Write},
+		{"-readwrite", f.readWrite, &edit.ar.ReadWrite},
+		{"-change", f.change, &edit.ar.ChangeAccessRights},
+	}
+	for _, c := range conds {
+		if c.value == "" {
+			continue
+		}
+		v, err := parseAccessCond(c.value)
+		if err != nil {
+			return edit, fmt.Errorf("%s: %w", c.flag, err)
 		}
+		*c.dst = v
 	}
-
-	return selected
+	return edit, nil
 }
 
-// ============================================================================
-// Main
-// ============================================================================
+// sdmStructuralChange reports why moving from the current SDM configuration
+// to the new options and access keys would add or remove offset fields, or
+// "" if the field layout is unchanged. Offsets depend on the NDEF template,
+// so such changes cannot be made by editing settings alone.
+func sdmStructuralChange(current *fileSettings, newSDMOptions, newSDMMeta, newSDMFile byte) string {
+	oldMetaIsPlain := current.sdmMeta == 0x0E
+	newMetaIsPlain := newSDMMeta == 0x0E
+	oldMetaIsKey := current.sdmMeta != 0x0E && current.sdmMeta != 0x0F
+	newMetaIsKey := newSDMMeta != 0x0E && newSDMMeta != 0x0F
+
+	oldFileNotDenied := current.sdmFile != 0x0F
+	newFileNotDenied := newSDMFile != 0x0F
+
+	oldUIDMirror := (current.sdmOptions & 0x80) != 0
+	newUIDMirror := (newSDMOptions & 0x80) != 0
+	oldCtrMirror := (current.sdmOptions & 0x40) != 0
+	newCtrMirror := (newSDMOptions & 0x40) != 0
+	oldEncFile := (current.sdmOptions & 0x10) != 0
+	newEncFile := (newSDMOptions & 0x10) != 0
+	oldCtrLimit := (current.sdmOptions & 0x20) != 0
+	newCtrLimit := (newSDMOptions & 0x20) != 0
+
+	switch {
+	case oldMetaIsPlain != newMetaIsPlain || oldMetaIsKey != newMetaIsKey:
+		return "SDMMetaRead changed between plain (Free) and encrypted (Key 0-4)"
+	case oldFileNotDenied != newFileNotDenied:
+		return "SDMFileRead changed to/from Denied (affects MAC offset fields)"
+	case oldEncFile != newEncFile:
+		return "Encrypted file data toggled (affects ENC offset fields)"
+	case oldCtrLimit != newCtrLimit:
+		return "ReadCtr limit toggled (affects CtrLimit field)"
+	case oldMetaIsPlain && newMetaIsPlain && oldUIDMirror != newUIDMirror:
+		// Only check UID/Ctr mirror changes if meta is plain
+		return "UID mirror toggled while MetaRead is plain (affects UIDOffset field)"
+	case oldMetaIsPlain && newMetaIsPlain && oldCtrMirror != newCtrMirror:
+		return "ReadCtr mirror toggled while MetaRead is plain (affects CtrOffset field)"
+	}
+	return ""
+}
 
-func main() {
-	verbose := flag.Bool("v", false, "enable debug logging")
-	logFormat := flag.String("log-format", "text", "log format: text or json")
-	flag.Parse()
+// offsetsRediscoverable reports whether a structural SDM edit can be applied
+// with offsets discovered from the NDEF file (see resolveStructuralChange).
+// Only the uid/ctr/mac mirrors can be recovered, so the edit must target the
+// NDEF file, keep MetaRead plain or denied, leave ENC off and not newly
+// enable the ReadCtr limit (there is no limit value to program).
+func offsetsRediscoverable(targetFile byte, current *fileSettings, edit settingsEdit) bool {
+	newMetaIsKey := edit.sdmMeta != 0x0E && edit.sdmMeta != 0x0F
+	newEncFile := (edit.sdmOptions & 0x10) != 0
+	newCtrLimit := (edit.sdmOptions&0x20) != 0 && (current.sdmOptions&0x20) == 0
+	return targetFile == 0x02 && !newMetaIsKey && !newEncFile && !newCtrLimit
+}
 
-	// Configure slog
-	level := slog.LevelInfo
-	if *verbose {
-		level = slog.LevelDebug
+// resolveStructuralChange fills edit.offsets by rediscovering the mirror
+// offsets from the NDEF currently on the tag, or exits if the edit cannot be
+// applied without reprovisioning.
+func resolveStructuralChange(card *scard.Card, targetFile byte, current *fileSettings, edit *settingsEdit) {
+	if !offsetsRediscoverable(targetFile, current, *edit) {
+		exitStructuralChange(edit.structural)
 	}
-	opts := &slog.HandlerOptions{Level: level}
-	if *logFormat == "json" {
-		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
-	} else {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	offsets, err := ntag424.DiscoverSDMOffsets(card)
+	if err != nil {
+		fmt.Printf("\nCould not rediscover SDM offsets from the NDEF file: %v\n", err)
+		exitStructuralChange(edit.structural)
 	}
+	fmt.Printf("\nStructural change (%s):\n", edit.structural)
+	fmt.Printf("  Using offsets discovered from the current NDEF URL:\n  %s\n", offsets.URL)
+	edit.offsets = offsets
+}
 
-	fmt.Println("=== NTAG 424 DNA File Permissions Editor ===")
-	fmt.Println()
+// buildSettingsPayload builds the ChangeFileSettings data for edit. SDM
+// offset fields are copied from current.rawData, which is safe because
+// structural SDM changes are rejected beforehand unless edit.offsets holds
+// offsets rediscovered from the NDEF file, in which case all offset fields
+// are rebuilt from those.
+func buildSettingsPayload(current *fileSettings, edit settingsEdit) []byte {
+	ar1, ar2 := edit.ar.Encode()
+	sdmEnabled := (current.fileOption & 0x40) != 0
+
+	if !sdmEnabled || edit.sdmDisabled {
+		return []byte{edit.commMode & 0x03, ar1, ar2}
+	}
+
+	if edit.sdmEdited && edit.offsets != nil {
+		fs := &ntag424.FileSettings{
+			FileOption: edit.commMode & 0x03,
+			AR1:        ar1,
+			AR2:        ar2,
+			SDMOptions: edit.sdmOptions,
+			SDMMeta:    edit.sdmMeta,
+			SDMFile:    edit.sdmFile,
+			SDMCtr:     edit.sdmCtr,
+			CtrLimit:   current.ctrLimit,
+		}
+		edit.offsets.ApplyTo(fs)
+		return ntag424.BuildChangeFileSettingsDataFull(fs)
+	}
 
-	// Establish context
-	ctx, err := scard.EstablishContext()
-	if err != nil {
-		fmt.Printf("Error establishing context: %v\n", err)
-		os.Exit(1)
+	// SDM is/remains enabled
+	fileOption := (edit.commMode & 0x03) | 0x40
+	if edit.sdmEdited {
+		// SDM settings were edited - rebuild SDM bytes
+		data := []byte{fileOption, ar1, ar2, edit.sdmOptions}
+
+		// Build SDMAccessRights (2 bytes)
+		sdmAR := uint16((uint16(edit.sdmMeta&0x0F) << 12) | (uint16(edit.sdmFile&0x0F) << 8) | (0x0F << 4) | uint16(edit.sdmCtr&0x0F))
+		data = append(data, byte(sdmAR&0xFF), byte((sdmAR>>8)&0xFF))
+
+		// Append offset fields from rawData (starting at byte 10)
+		if len(current.rawData) > 10 {
+			data = append(data, current.rawData[10:]...)
+		}
+		return data
 	}
-	defer ctx.Release()
 
-	// List readers
-	readers, err := ctx.ListReaders()
-	if err != nil || len(readers) == 0 {
-		fmt.Printf("Error: no card readers available\n")
-		os.Exit(1)
+	// SDM not edited - preserve all SDM data from rawData
+	// rawData format: [0] FileType [1] FileOption [2] AR1 [3] AR2 [4-6] Size [7+] SDM data
+	// payload format: [0] FileOption [1] AR1 [2] AR2 [3+] SDM data
+	data := []byte{fileOption, ar1, ar2}
+	if len(current.rawData) > 7 {
+		data = append(data, current.rawData[7:]...)
 	}
+	return data
+}
 
-	fmt.Printf("Using reader: %s\n", readers[0])
+// editInteractive walks the user through the menus on p and returns the
+// selected file and its requested settings.
+func editInteractive(p prompt.Prompter, fileInfos []fileInfo, settings map[byte]*fileSettings) (byte, settingsEdit, error) {
+	// Select file to edit
+	fileItems := []string{}
+	fileOrder := []byte{}
 
-	// Connect to card
-	card, err := ctx.Connect(readers[0], scard.ShareShared, scard.ProtocolAny)
-	if err != nil {
-		fmt.Printf("Error connecting to card: %v\n", err)
-		os.Exit(1)
+	for _, info := range fileInfos {
+		if _, ok := settings[info.no]; ok {
+			fileItems = append(fileItems, fmt.Sprintf("File %d (%s)", info.no, info.name))
+			fileOrder = append(fileOrder, info.no)
+		}
 	}
-	defer card.Disconnect(scard.LeaveCard)
 
-	// Get UID
-	uid, err := getUID(card)
+	selectedFileIdx, err := p.Select("Select file to edit:", fileItems)
 	if err != nil {
-		fmt.Printf("Error reading UID: %v\n", err)
-		os.Exit(1)
+		return 0, settingsEdit{}, err
 	}
-	fmt.Printf("UID: %s\n", hexUpper(uid))
+	targetFile := fileOrder[selectedFileIdx]
+	currentSettings := settings[targetFile]
+
+	fmt.Printf("\nEditing File %d\n", targetFile)
 	fmt.Println()
 
-	// Select NDEF app
-	if err := selectNDEFApp(card); err != nil {
-		fmt.Printf("Error selecting NDEF app: %v\n", err)
-		os.Exit(1)
+	// Edit CommMode
+	commModeItems := []string{"Plain", "MAC", "Full"}
+	currentCommMode := currentSettings.fileOption & 0x03
+	var currentCommIdx int
+	switch currentCommMode {
+	case 0x00:
+		currentCommIdx = 0
+	case 0x01:
+		currentCommIdx = 1
+	case 0x03:
+		currentCommIdx = 2
 	}
 
-	// Probe slot 0 (AppMasterKey)
-	fmt.Println("Probing AppMasterKey (slot 0)...")
-
-	// Build key list: all-zero + key files
-	type keyInfo struct {
-		key   []byte
-		label string
+	// Highlight current selection
+	for i := range commModeItems {
+		if i == currentCommIdx {
+			commModeItems[i] = commModeItems[i] + " (current)"
+		}
 	}
 
-	keys := []keyInfo{
-		{make([]byte, 16), "all-zero"},
+	commModeIdx, err := p.Select("Select CommMode:", commModeItems)
+	if err != nil {
+		return 0, settingsEdit{}, err
 	}
-
-	// Load keys from ../keys/
-	keyFiles, err := loadAllHexKeys("../keys")
-	if err == nil {
-		for _, kf := range keyFiles {
-			keys = append(keys, keyInfo{kf.key, kf.name})
-		}
+	var newCommMode byte
+	switch commModeIdx {
+	case 0:
+		newCommMode = 0x00
+	case 1:
+		newCommMode = 0x01
+	case 2:
+		newCommMode = 0x03
+	default:
+		return 0, settingsEdit{}, fmt.Errorf("invalid CommMode selection %d", commModeIdx)
 	}
 
-	// Try to find AppMasterKey
-	var masterKey []byte
-	var masterKeyLabel string
-	found := false
+	currentAR := currentSettings.accessRights()
 
-	for _, k := range keys {
-		if err := selectNDEFApp(card); err != nil {
-			continue
+	// Edit Read key
+	readAccessItems := []string{"Free", "Denied", "Key 0 (AppMaster)", "Key 1 (SDM)", "Key 2 (File 2 Write)", "Key 3", "Key 4"}
+	currentReadKey := currentAR.Read
+	for i := range readAccessItems {
+		var expectedKey byte
+		if i == 0 {
+			expectedKey = 0xE
+		} else if i == 1 {
+			expectedKey = 0xF
+		} else {
+			expectedKey = byte(i - 2)
 		}
-		if _, err := authenticateEV2First(card, k.key, 0); err == nil {
-			masterKey = k.key
-			masterKeyLabel = k.label
-			found = true
-			break
+		if expectedKey == currentReadKey {
+			readAccessItems[i] = readAccessItems[i] + " (current)"
 		}
 	}
 
-	if !found {
-		fmt.Println("Error: Cannot authenticate with AppMasterKey (slot 0)")
-		fmt.Println("Please ensure the correct key is available in ../keys/ or the card uses the default all-zero key.")
-		os.Exit(1)
+	readKeyIdx, err := p.Select("Select Read key:", readAccessItems)
+	if err != nil {
+		return 0, settingsEdit{}, err
 	}
-
-	fmt.Printf("AppMasterKey: %s\n", masterKeyLabel)
-	fmt.Println()
-
-	// Re-authenticate with slot 0
-	if err := selectNDEFApp(card); err != nil {
-		fmt.Printf("Error re-selecting NDEF app: %v\n", err)
-		os.Exit(1)
-	}
-
-	sess, err := authenticateEV2First(card, masterKey, 0)
-	if err != nil {
-		fmt.Printf("Authentication failed: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Read file settings for files 1, 2, 3
-	fmt.Println("Reading file settings...")
-
-	fileInfos := []struct {
-		no   byte
-		name string
-	}{
-		{1, "CC"},
-		{2, "NDEF"},
-		{3, "Proprietary"},
-	}
-
-	fileSettings := make(map[byte]*fileSettings)
-
-	for _, info := range fileInfos {
-		// Try plain mode first (no authentication needed)
-		fs, err := getFileSettingsPlain(card, info.no)
-		if err != nil {
-			// Plain mode failed - try secure mode with authentication
-			if err := selectNDEFApp(card); err != nil {
-				fmt.Printf("Warning: Could not re-select NDEF app for file %d: %v\n", info.no, err)
-				continue
-			}
-
-			sess, authErr := authenticateEV2First(card, masterKey, 0)
-			if authErr != nil {
-				fmt.Printf("Warning: Could not authenticate for file %d: %v\n", info.no, authErr)
-				// Reset card state before next file
-				selectNDEFApp(card)
-				continue
-			}
-
-			fs, err = getFileSettings(card, sess, info.no)
-			if err != nil {
-				fmt.Printf("Warning: Could not read file %d settings (plain or secure): %v\n", info.no, err)
-				// Reset card state before next file
-				selectNDEFApp(card)
-				continue
-			}
-
-			// Reset card state after successful secure read, so next file can try plain mode
-			selectNDEFApp(card)
-		}
-		fileSettings[info.no] = fs
-		displayFileSettings(info.no, info.name, fs)
-	}
-
-	if len(fileSettings) == 0 {
-		fmt.Println("\nError: No file settings could be read.")
-		os.Exit(1)
-	}
-
-	fmt.Println()
-
-	// Select file to edit
-	fileItems := []string{}
-	fileOrder := []byte{}
-
-	for _, info := range fileInfos {
-		if _, ok := fileSettings[info.no]; ok {
-			fileItems = append(fileItems, fmt.Sprintf("File %d (%s)", info.no, info.name))
-			fileOrder = append(fileOrder, info.no)
-		}
-	}
-
-	selectedFileIdx := selectMenu("Select file to edit:", fileItems)
-	if selectedFileIdx < 0 {
-		fmt.Println("Invalid selection.")
-		os.Exit(1)
-	}
-	targetFile := fileOrder[selectedFileIdx]
-	currentSettings := fileSettings[targetFile]
-
-	fmt.Printf("\nEditing File %d\n", targetFile)
-	fmt.Println()
-
-	// Edit CommMode
-	commModeItems := []string{"Plain", "MAC", "Full"}
-	currentCommMode := currentSettings.fileOption & 0x03
-	var currentCommIdx int
-	switch currentCommMode {
-	case 0x00:
-		currentCommIdx = 0
-	case 0x01:
-		currentCommIdx = 1
-	case 0x03:
-		currentCommIdx = 2
-	}
-
-	// Highlight current selection
-	for i := range commModeItems {
-		if i == currentCommIdx {
-			commModeItems[i] = commModeItems[i] + " (current)"
-		}
-	}
-
-	commModeIdx := selectMenu("Select CommMode:", commModeItems)
-	var newCommMode byte
-	switch commModeIdx {
-	case 0:
-		newCommMode = 0x00
-	case 1:
-		newCommMode = 0x01
-	case 2:
-		newCommMode = 0x03
-	default:
-		fmt.Println("Invalid selection.")
-		os.Exit(1)
-	}
-
-	// Edit Read key
-	readAccessItems := []string{"Free", "Denied", "Key 0 (AppMaster)", "Key 1 (SDM)", "Key 2 (File 2 Write)", "Key 3", "Key 4"}
-	currentReadKey := (currentSettings.ar2 >> 4) & 0x0F
-	for i := range readAccessItems {
-		var expectedKey byte
-		if i == 0 {
-			expectedKey = 0xE
-		} else if i == 1 {
-			expectedKey = 0xF
-		} else {
-			expectedKey = byte(i - 2)
-		}
-		if expectedKey == currentReadKey {
-			readAccessItems[i] = readAccessItems[i] + " (current)"
-		}
-	}
-
-	readKeyIdx := selectMenu("Select Read key:", readAccessItems)
-	var newReadKey byte
-	if readKeyIdx == 0 {
-		newReadKey = 0xE
-	} else if readKeyIdx == 1 {
-		newReadKey = 0xF
-	} else {
-		newReadKey = byte(readKeyIdx - 2)
+	var newReadKey byte
+	if readKeyIdx == 0 {
+		newReadKey = 0xE
+	} else if readKeyIdx == 1 {
+		newReadKey = 0xF
+	} else {
+		newReadKey = byte(readKeyIdx - 2)
 	}
 
 	// Edit Write key
 	writeAccessItems := []string{"Free", "Denied", "Key 0 (AppMaster)", "Key 1 (SDM)", "Key 2 (File 2 Write)", "Key 3", "Key 4"}
-	currentWriteKey := currentSettings.ar2 & 0x0F
+	currentWriteKey := currentAR.Write
 	for i := range writeAccessItems {
 		var expectedKey byte
 		if i == 0 {
@@ -1184,7 +1046,10 @@ func main() {
 		}
 	}
 
-	writeKeyIdx := selectMenu("Select Write key:", writeAccessItems)
+	writeKeyIdx, err := p.Select("Select Write key:", writeAccessItems)
+	if err != nil {
+		return 0, settingsEdit{}, err
+	}
 	var newWriteKey byte
 	if writeKeyIdx == 0 {
 		newWriteKey = 0xE
@@ -1196,7 +1061,7 @@ func main() {
 
 	// Edit ReadWrite key
 	readWriteAccessItems := []string{"Free", "Denied", "Key 0 (AppMaster)", "Key 1 (SDM)", "Key 2 (File 2 Write)", "Key 3", "Key 4"}
-	currentReadWriteKey := (currentSettings.ar1 >> 4) & 0x0F
+	currentReadWriteKey := currentAR.ReadWrite
 	for i := range readWriteAccessItems {
 		var expectedKey byte
 		if i == 0 {
@@ -1211,7 +1076,10 @@ func main() {
 		}
 	}
 
-	readWriteKeyIdx := selectMenu("Select ReadWrite key:", readWriteAccessItems)
+	readWriteKeyIdx, err := p.Select("Select ReadWrite key:", readWriteAccessItems)
+	if err != nil {
+		return 0, settingsEdit{}, err
+	}
 	var newReadWriteKey byte
 	if readWriteKeyIdx == 0 {
 		newReadWriteKey = 0xE
@@ -1223,14 +1091,17 @@ func main() {
 
 	// Edit ChangeAccess key (no Free/Denied option)
 	changeAccessItems := []string{"Key 0 (AppMaster)", "Key 1 (SDM)", "Key 2 (File 2 Write)", "Key 3", "Key 4"}
-	currentChangeAccessKey := currentSettings.ar1 & 0x0F
+	currentChangeAccessKey := currentAR.ChangeAccessRights
 	for i := range changeAccessItems {
 		if byte(i) == currentChangeAccessKey {
 			changeAccessItems[i] = changeAccessItems[i] + " (current)"
 		}
 	}
 
-	changeAccessKeyIdx := selectMenu("Select ChangeAccess key:", changeAccessItems)
+	changeAccessKeyIdx, err := p.Select("Select ChangeAccess key:", changeAccessItems)
+	if err != nil {
+		return 0, settingsEdit{}, err
+	}
 	newChangeAccessKey := byte(changeAccessKeyIdx)
 
 	// SDM editing
@@ -1239,17 +1110,24 @@ func main() {
 	var newSDMMeta byte
 	var newSDMFile byte
 	var newSDMCtr byte
+	var structural string
 	sdmEnabled := (currentSettings.fileOption & 0x40) != 0
 	sdmDisabled := false
 
 	if sdmEnabled {
 		editSDMItems := []string{"No (preserve current SDM settings)", "Yes (edit SDM settings)"}
-		editSDMIdx := selectMenu("Edit SDM settings?", editSDMItems)
+		editSDMIdx, err := p.Select("Edit SDM settings?", editSDMItems)
+		if err != nil {
+			return 0, settingsEdit{}, err
+		}
 
 		if editSDMIdx == 1 {
 			// Ask if user wants to keep or disable SDM
 			sdmToggleItems := []string{"Keep enabled", "Disable SDM"}
-			sdmToggleIdx := selectMenu("SDM:", sdmToggleItems)
+			sdmToggleIdx, err := p.Select("SDM:", sdmToggleItems)
+			if err != nil {
+				return 0, settingsEdit{}, err
+			}
 
 			if sdmToggleIdx == 1 {
 				// User wants to disable SDM
@@ -1271,7 +1149,10 @@ func main() {
 						uidMirrorItems[i] = uidMirrorItems[i] + " (current)"
 					}
 				}
-				uidMirrorIdx := selectMenu("UID mirroring:", uidMirrorItems)
+				uidMirrorIdx, err := p.Select("UID mirroring:", uidMirrorItems)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 				if uidMirrorIdx == 1 {
 					newSDMOptions |= 0x80
 				} else {
@@ -1285,7 +1166,10 @@ func main() {
 						ctrMirrorItems[i] = ctrMirrorItems[i] + " (current)"
 					}
 				}
-				ctrMirrorIdx := selectMenu("ReadCtr mirroring:", ctrMirrorItems)
+				ctrMirrorIdx, err := p.Select("ReadCtr mirroring:", ctrMirrorItems)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 				if ctrMirrorIdx == 1 {
 					newSDMOptions |= 0x40
 				} else {
@@ -1299,7 +1183,10 @@ func main() {
 						ctrLimitItems[i] = ctrLimitItems[i] + " (current)"
 					}
 				}
-				ctrLimitIdx := selectMenu("ReadCtr limit:", ctrLimitItems)
+				ctrLimitIdx, err := p.Select("ReadCtr limit:", ctrLimitItems)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 				if ctrLimitIdx == 1 {
 					newSDMOptions |= 0x20
 				} else {
@@ -1313,7 +1200,10 @@ func main() {
 						encFileItems[i] = encFileItems[i] + " (current)"
 					}
 				}
-				encFileIdx := selectMenu("Encrypted file data:", encFileItems)
+				encFileIdx, err := p.Select("Encrypted file data:", encFileItems)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 				if encFileIdx == 1 {
 					newSDMOptions |= 0x10
 				} else {
@@ -1327,7 +1217,10 @@ func main() {
 						asciiItems[i] = asciiItems[i] + " (current)"
 					}
 				}
-				asciiIdx := selectMenu("ASCII encoding:", asciiItems)
+				asciiIdx, err := p.Select("ASCII encoding:", asciiItems)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 				if asciiIdx == 1 {
 					newSDMOptions |= 0x01
 				} else {
@@ -1335,74 +1228,34 @@ func main() {
 				}
 
 				// SDMMetaRead key
-				newSDMMeta = selectSDMAccessKey("SDMMetaRead key:", currentSettings.sdmMeta, false)
+				newSDMMeta, err = selectSDMAccessKey(p, "SDMMetaRead key:", currentSettings.sdmMeta, false)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 
 				// SDMFileRead key
-				newSDMFile = selectSDMAccessKey("SDMFileRead key:", currentSettings.sdmFile, true)
+				newSDMFile, err = selectSDMAccessKey(p, "SDMFileRead key:", currentSettings.sdmFile, true)
+				if err != nil {
+					return 0, settingsEdit{}, err
+				}
 
 				// SDMCtrRet key
-				newSDMCtr = selectSDMAccessKey("SDMCtrRet key:", currentSettings.sdmCtr, true)
-
-				// Structural change detection
-				oldMetaIsPlain := currentSettings.sdmMeta == 0x0E
-				newMetaIsPlain := newSDMMeta == 0x0E
-				oldMetaIsKey := currentSettings.sdmMeta != 0x0E && currentSettings.sdmMeta != 0x0F
-				newMetaIsKey := newSDMMeta != 0x0E && newSDMMeta != 0x0F
-
-				oldFileNotDenied := currentSettings.sdmFile != 0x0F
-				newFileNotDenied := newSDMFile != 0x0F
-
-				oldUIDMirror := (currentSettings.sdmOptions & 0x80) != 0
-				newUIDMirror := (newSDMOptions & 0x80) != 0
-				oldCtrMirror := (currentSettings.sdmOptions & 0x40) != 0
-				newCtrMirror := (newSDMOptions & 0x40) != 0
-				oldEncFile := (currentSettings.sdmOptions & 0x10) != 0
-				newEncFile := (newSDMOptions & 0x10) != 0
-				oldCtrLimit := (currentSettings.sdmOptions & 0x20) != 0
-				newCtrLimit := (newSDMOptions & 0x20) != 0
-
-				structuralChange := false
-				var changeReason string
-
-				// Check for structural changes
-				if oldMetaIsPlain != newMetaIsPlain || oldMetaIsKey != newMetaIsKey {
-					structuralChange = true
-					changeReason = "SDMMetaRead changed between plain (Free) and encrypted (Key 0-4)"
-				} else if oldFileNotDenied != newFileNotDenied {
-					structuralChange = true
-					changeReason = "SDMFileRead changed to/from Denied (affects MAC offset fields)"
-				} else if oldEncFile != newEncFile {
-					structuralChange = true
-					changeReason = "Encrypted file data toggled (affects ENC offset fields)"
-				} else if oldCtrLimit != newCtrLimit {
-					structuralChange = true
-					changeReason = "ReadCtr limit toggled (affects CtrLimit field)"
-				} else if oldMetaIsPlain && newMetaIsPlain {
-					// Only check UID/Ctr mirror changes if meta is plain
-					if oldUIDMirror != newUIDMirror {
-						structuralChange = true
-						changeReason = "UID mirror toggled while MetaRead is plain (affects UIDOffset field)"
-					} else if oldCtrMirror != newCtrMirror {
-						structuralChange = true
-						changeReason = "ReadCtr mirror toggled while MetaRead is plain (affects CtrOffset field)"
-					}
+				newSDMCtr, err = selectSDMAccessKey(p, "SDMCtrRet key:", currentSettings.sdmCtr, true)
+				if err != nil {
+					return 0, settingsEdit{}, err
 				}
 
-				if structuralChange {
-					fmt.Printf("\n=== ERROR: Structural Change Detected ===\n")
-					fmt.Printf("Reason: %s\n\n", changeReason)
-					fmt.Printf("This change would alter the offset field structure in the SDM configuration.\n")
-					fmt.Printf("Offsets depend on the NDEF template content and cannot be safely modified\n")
-					fmt.Printf("without rewriting the entire template.\n\n")
-					fmt.Printf("Please use the 'update' tool to re-provision the tag with new SDM settings.\n")
-					os.Exit(1)
-				}
+				// Structural change detection
+				structural = sdmStructuralChange(currentSettings, newSDMOptions, newSDMMeta, newSDMFile)
 			}
 		}
 	} else {
 		// SDM not currently enabled - offer to enable it
 		enableSDMItems := []string{"No (keep SDM disabled)", "Yes (enable SDM)"}
-		enableSDMIdx := selectMenu("Enable SDM on this file?", enableSDMItems)
+		enableSDMIdx, err := p.Select("Enable SDM on this file?", enableSDMItems)
+		if err != nil {
+			return 0, settingsEdit{}, err
+		}
 
 		if enableSDMIdx == 1 {
 			fmt.Printf("\n=== Cannot Enable SDM ===\n")
@@ -1411,29 +1264,332 @@ func main() {
 			fmt.Printf("without knowing the template content.\n\n")
 			fmt.Printf("To enable SDM on this file, please use the 'update' tool to\n")
 			fmt.Printf("re-provision the tag with SDM configuration.\n")
-			os.Exit(1)
+			return 0, settingsEdit{}, errors.New("enabling SDM is not supported here")
 		}
 		// User chose not to enable SDM, continue with normal permission editing
 	}
 
+	return targetFile, settingsEdit{
+		commMode: newCommMode,
+		ar: ntag424.AccessRights{
+			Read:               newReadKey,
+			Write:              newWriteKey,
+			ReadWrite:          newReadWriteKey,
+			ChangeAccessRights: newChangeAccessKey,
+		},
+		sdmEdited:   sdmEdited,
+		sdmDisabled: sdmDisabled,
+		sdmOptions:  newSDMOptions,
+		sdmMeta:     newSDMMeta,
+		sdmFile:     newSDMFile,
+		sdmCtr:      newSDMCtr,
+		structural:  structural,
+	}, nil
+}
+
+// printPresets lists the access presets for -list-presets.
+func printPresets() {
+	fmt.Println("Access presets (-preset <name>):")
+	for _, p := range ntag424.AccessPresets() {
+		fileOption, ar1, ar2 := p.Bytes()
+		fmt.Printf("  %-12s %s\n", p.Name, p.Description)
+		fmt.Printf("  %-12s CommMode=%s FileOption=0x%02X AR1=0x%02X AR2=0x%02X\n", "", commModeLabel(fileOption), fileOption, ar1, ar2)
+	}
+}
+
+func exitStructuralChange(reason string) {
+	fmt.Printf("\n=== ERROR: Structural Change Detected ===\n")
+	fmt.Printf("Reason: %s\n\n", reason)
+	fmt.Printf("This change would alter the offset field structure in the SDM configuration.\n")
+	fmt.Printf("Offsets depend on the NDEF template content and cannot be safely modified\n")
+	fmt.Printf("without rewriting the entire template.\n\n")
+	fmt.Printf("Please use the 'update' tool to re-provision the tag with new SDM settings.\n")
+	os.Exit(1)
+}
+
+// ============================================================================
+// Main
+// ============================================================================
+
+func main() {
+	verbose := flag.Bool("v", false, "enable debug logging")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	slotRolesFile := flag.String("slot-roles", "", "YAML file with slot_roles labels for key slots (default: standard layout)")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
+	fileFlag := flag.Int("file", 0, "file number to edit (1-3); enables non-interactive mode")
+	commModeFlag := flag.String("comm-mode", "", "new comm mode: plain, mac or full")
+	readFlag := flag.String("read", "", "new Read access: free, denied or 0..4")
+	writeFlag := flag.String("write", "", "new Write access: free, denied or 0..4")
+	readWriteFlag := flag.String("readwrite", "", "new ReadWrite access: free, denied or 0..4")
+	changeFlag := flag.String("change", "", "new ChangeAccessRights access: free, denied or 0..4")
+	presetFlag := flag.String("preset", "", "apply a named access preset (see -list-presets); other edit flags override it")
+	listPresets := flag.Bool("list-presets", false, "list the access presets and exit")
+	assumeYes := flag.Bool("yes", false, "apply without asking for confirmation")
+	flag.Parse()
+
+	if *listPresets {
+		printPresets()
+		return
+	}
+
+	// Any edit flag switches to non-interactive mode; -file is then required.
+	nonInteractive := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "file", "preset", "comm-mode", "read", "write", "readwrite", "change":
+			nonInteractive = true
+		}
+	})
+	flagEdit := editFlags{
+		preset:    *presetFlag,
+		commMode:  *commModeFlag,
+		read:      *readFlag,
+		write:     *writeFlag,
+		readWrite: *readWriteFlag,
+		change:    *changeFlag,
+	}
+	if nonInteractive && (*fileFlag < 1 || *fileFlag > 3) {
+		fmt.Println("Error: -file 1..3 is required with -preset/-comm-mode/-read/-write/-readwrite/-change")
+		os.Exit(1)
+	}
+
+	// Configure slog
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if *logFormat == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Printf("Error creating trace file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		ntag424.EnableAPDUTrace(f, true)
+	}
+
+	roles := ntag424.DefaultSlotRoles()
+	if *slotRolesFile != "" {
+		loaded, err := loadSlotRoles(*slotRolesFile)
+		if err != nil {
+			fmt.Printf("Error loading slot roles: %v\n", err)
+			os.Exit(1)
+		}
+		roles = loaded
+	}
+
+	fmt.Println("=== NTAG 424 DNA File Permissions Editor ===")
+	fmt.Println()
+
+	// Establish context
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		fmt.Printf("Error establishing context: %v\n", err)
+		os.Exit(1)
+	}
+	defer ctx.Release()
+
+	// List readers
+	readers, err := ctx.ListReaders()
+	if err != nil || len(readers) == 0 {
+		fmt.Printf("Error: no card readers available\n")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Using reader: %s\n", readers[0])
+
+	// Connect to card
+	card, err := ctx.Connect(readers[0], scard.ShareShared, scard.ProtocolAny)
+	if err != nil {
+		fmt.Printf("Error connecting to card: %v\n", err)
+		os.Exit(1)
+	}
+	defer card.Disconnect(scard.LeaveCard)
+
+	// Get UID
+	uid, err := getUID(card)
+	if err != nil {
+		fmt.Printf("Error reading UID: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("UID: %s\n", hexUpper(uid))
+	fmt.Println()
+
+	// Select NDEF app
+	if err := selectNDEFApp(card); err != nil {
+		fmt.Printf("Error selecting NDEF app: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Probe slot 0 (AppMasterKey)
+	fmt.Println("Probing AppMasterKey (slot 0)...")
+
+	// Build key list: all-zero + key files
+	type keyInfo struct {
+		key   []byte
+		label string
+	}
+
+	keys := []keyInfo{
+		{make([]byte, 16), "all-zero"},
+	}
+
+	// Load keys from ../keys/
+	keyFiles, err := loadAllHexKeys("../keys")
+	if err == nil {
+		for _, kf := range keyFiles {
+			keys = append(keys, keyInfo{kf.key, kf.name})
+		}
+	}
+
+	// Try to find AppMasterKey
+	var masterKey []byte
+	var masterKeyLabel string
+	found := false
+
+	for _, k := range keys {
+		if err := selectNDEFApp(card); err != nil {
+			continue
+		}
+		if _, err := authenticateEV2First(card, k.key, 0); err == nil {
+			masterKey = k.key
+			masterKeyLabel = k.label
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		fmt.Println("Error: Cannot authenticate with AppMasterKey (slot 0)")
+		fmt.Println("Please ensure the correct key is available in ../keys/ or the card uses the default all-zero key.")
+		os.Exit(1)
+	}
+
+	fmt.Printf("AppMasterKey: %s\n", masterKeyLabel)
+	fmt.Println()
+
+	// Re-authenticate with slot 0
+	if err := selectNDEFApp(card); err != nil {
+		fmt.Printf("Error re-selecting NDEF app: %v\n", err)
+		os.Exit(1)
+	}
+
+	sess, err := authenticateEV2First(card, masterKey, 0)
+	if err != nil {
+		fmt.Printf("Authentication failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Read file settings for files 1, 2, 3
+	fmt.Println("Reading file settings...")
+
+	fileInfos := []fileInfo{
+		{1, "CC"},
+		{2, "NDEF"},
+		{3, "Proprietary"},
+	}
+
+	fileSettings := make(map[byte]*fileSettings)
+
+	for _, info := range fileInfos {
+		// Try plain mode first (no authentication needed)
+		fs, err := getFileSettingsPlain(card, info.no)
+		if err != nil {
+			// Plain mode failed - try secure mode with authentication
+			if err := selectNDEFApp(card); err != nil {
+				fmt.Printf("Warning: Could not re-select NDEF app for file %d: %v\n", info.no, err)
+				continue
+			}
+
+			sess, authErr := authenticateEV2First(card, masterKey, 0)
+			if authErr != nil {
+				fmt.Printf("Warning: Could not authenticate for file %d: %v\n", info.no, authErr)
+				// Reset card state before next file
+				selectNDEFApp(card)
+				continue
+			}
+
+			fs, err = getFileSettings(card, sess, info.no)
+			if err != nil {
+				fmt.Printf("Warning: Could not read file %d settings (plain or secure): %v\n", info.no, err)
+				// Reset card state before next file
+				selectNDEFApp(card)
+				continue
+			}
+
+			// Reset card state after successful secure read, so next file can try plain mode
+			selectNDEFApp(card)
+		}
+		fileSettings[info.no] = fs
+		displayFileSettings(info.no, info.name, fs, roles)
+	}
+
+	if len(fileSettings) == 0 {
+		fmt.Println("\nError: No file settings could be read.")
+		os.Exit(1)
+	}
+
+	fmt.Println()
+
+	prompter := prompt.NewTerminalPrompter()
+	var targetFile byte
+	var edit settingsEdit
+	if nonInteractive {
+		targetFile = byte(*fileFlag)
+		current, ok := fileSettings[targetFile]
+		if !ok {
+			fmt.Printf("Error: settings for file %d are not available\n", targetFile)
+			os.Exit(1)
+		}
+		edit, err = applyEditFlags(current, flagEdit)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		targetFile, edit, err = editInteractive(prompter, fileInfos, fileSettings)
+		if errors.Is(err, prompt.ErrPromptAborted) {
+			fmt.Println("Cancelled.")
+			os.Exit(0)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	currentSettings := fileSettings[targetFile]
+	if edit.structural != "" {
+		resolveStructuralChange(card, targetFile, currentSettings, &edit)
+	}
+	currentAR := currentSettings.accessRights()
+	sdmEnabled := (currentSettings.fileOption & 0x40) != 0
+	sdmEdited, sdmDisabled := edit.sdmEdited, edit.sdmDisabled
+	newSDMOptions, newSDMMeta, newSDMFile, newSDMCtr := edit.sdmOptions, edit.sdmMeta, edit.sdmFile, edit.sdmCtr
+
 	// Show summary
 	fmt.Println("\n=== Summary ===")
 	fmt.Printf("File %d - Changing:\n", targetFile)
 	fmt.Printf("  CommMode:     %s -> %s\n",
 		commModeLabel(currentSettings.fileOption),
-		commModeLabel(newCommMode))
+		commModeLabel(edit.commMode))
 	fmt.Printf("  Read:         %s -> %s\n",
-		accessLabel((currentSettings.ar2>>4)&0x0F),
-		accessLabel(newReadKey))
+		accessLabel(currentAR.Read, roles),
+		accessLabel(edit.ar.Read, roles))
 	fmt.Printf("  Write:        %s -> %s\n",
-		accessLabel(currentSettings.ar2&0x0F),
-		accessLabel(newWriteKey))
+		accessLabel(currentAR.Write, roles),
+		accessLabel(edit.ar.Write, roles))
 	fmt.Printf("  ReadWrite:    %s -> %s\n",
-		accessLabel((currentSettings.ar1>>4)&0x0F),
-		accessLabel(newReadWriteKey))
+		accessLabel(currentAR.ReadWrite, roles),
+		accessLabel(edit.ar.ReadWrite, roles))
 	fmt.Printf("  ChangeAccess: %s -> %s\n",
-		accessLabel(currentSettings.ar1&0x0F),
-		accessLabel(newChangeAccessKey))
+		accessLabel(currentAR.ChangeAccessRights, roles),
+		accessLabel(edit.ar.ChangeAccessRights, roles))
 
 	// Show SDM changes if applicable
 	if sdmEnabled && sdmDisabled {
@@ -1467,75 +1623,38 @@ func main() {
 		}
 		if currentSettings.sdmMeta != newSDMMeta {
 			fmt.Printf("    SDMMetaRead:      %s -> %s\n",
-				accessLabel(currentSettings.sdmMeta),
-				accessLabel(newSDMMeta))
+				accessLabel(currentSettings.sdmMeta, roles),
+				accessLabel(newSDMMeta, roles))
 		}
 		if currentSettings.sdmFile != newSDMFile {
 			fmt.Printf("    SDMFileRead:      %s -> %s\n",
-				accessLabel(currentSettings.sdmFile),
-				accessLabel(newSDMFile))
+				accessLabel(currentSettings.sdmFile, roles),
+				accessLabel(newSDMFile, roles))
 		}
 		if currentSettings.sdmCtr != newSDMCtr {
 			fmt.Printf("    SDMCtrRet:        %s -> %s\n",
-				accessLabel(currentSettings.sdmCtr),
-				accessLabel(newSDMCtr))
+				accessLabel(currentSettings.sdmCtr, roles),
+				accessLabel(newSDMCtr, roles))
 		}
 	}
 
 	fmt.Println()
 
 	// Confirm
-	fmt.Print("Apply these changes? (y/n): ")
-	reader := bufio.NewReader(os.Stdin)
-	confirmInput, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
-		os.Exit(1)
-	}
-	confirmInput = strings.ToLower(strings.TrimSpace(confirmInput))
-	if confirmInput != "y" && confirmInput != "yes" {
-		fmt.Println("Cancelled.")
-		os.Exit(0)
+	if !*assumeYes {
+		ok, err := prompter.Confirm("Apply these changes?")
+		if err != nil && !errors.Is(err, prompt.ErrPromptAborted) {
+			fmt.Printf("Error reading input: %v\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Println("Cancelled.")
+			os.Exit(0)
+		}
 	}
 
 	// Build new settings payload
-	var newSettingsData []byte
-
-	// Build AR bytes
-	newAR1 := (newReadWriteKey << 4) | newChangeAccessKey
-	newAR2 := (newReadKey << 4) | newWriteKey
-
-	if sdmEnabled && !sdmDisabled {
-		// SDM is/remains enabled
-		newFileOption := (newCommMode & 0x03) | 0x40
-
-		if sdmEdited {
-			// SDM settings were edited - rebuild SDM bytes
-			newSettingsData = []byte{newFileOption, newAR1, newAR2, newSDMOptions}
-
-			// Build SDMAccessRights (2 bytes)
-			sdmAR := uint16((uint16(newSDMMeta&0x0F) << 12) | (uint16(newSDMFile&0x0F) << 8) | (0x0F << 4) | uint16(newSDMCtr&0x0F))
-			newSettingsData = append(newSettingsData, byte(sdmAR&0xFF), byte((sdmAR>>8)&0xFF))
-
-			// Append offset fields from rawData (starting at byte 10)
-			// These are preserved as structural changes are blocked
-			if len(currentSettings.rawData) > 10 {
-				newSettingsData = append(newSettingsData, currentSettings.rawData[10:]...)
-			}
-		} else {
-			// SDM not edited - preserve all SDM data from rawData
-			// rawData format: [0] FileType [1] FileOption [2] AR1 [3] AR2 [4-6] Size [7+] SDM data
-			// payload format: [0] FileOption [1] AR1 [2] AR2 [3+] SDM data
-			newSettingsData = []byte{newFileOption, newAR1, newAR2}
-			if len(currentSettings.rawData) > 7 {
-				newSettingsData = append(newSettingsData, currentSettings.rawData[7:]...)
-			}
-		}
-	} else {
-		// SDM disabled or was disabled
-		newFileOption := newCommMode & 0x03
-		newSettingsData = []byte{newFileOption, newAR1, newAR2}
-	}
+	newSettingsData := buildSettingsPayload(currentSettings, edit)
 
 	// Send ChangeFileSettings
 	fmt.Println("\nSending ChangeFileSettings command...")
@@ -1580,7 +1699,7 @@ func main() {
 		fmt.Printf("Warning: Could not verify file settings: %v\n", err)
 	} else {
 		fmt.Println()
-		displayFileSettings(targetFile, "", verifyFS)
+		displayFileSettings(targetFile, "", verifyFS, roles)
 		fmt.Println()
 		fmt.Println("SUCCESS: File permissions updated!")
 	}
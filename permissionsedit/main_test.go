@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
+	"github.com/barnettlynn/nfctools/pkg/ntag424/prompt"
+)
+
+// sdmFile2 is a provisioned NDEF file: Plain, AR1=0x20 AR2=0xE2, SDM with
+// UID+Ctr mirroring and plain meta.
+func sdmFile2(t *testing.T) *fileSettings {
+	t.Helper()
+	raw := []byte{0x00, 0x40, 0x20, 0xE2, 0x00, 0x01, 0x00,
+		0xC1, 0x1F, 0xE1, // SDMOptions, SDMAR (Meta=E File=1 Ctr=1)
+		0x20, 0x00, 0x00, 0x33, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x3E, 0x00, 0x00}
+	fs, err := parseFileSettings(raw)
+	if err != nil {
+		t.Fatalf("parseFileSettings returned error: %v", err)
+	}
+	fs.rawData = raw
+	return fs
+}
+
+func TestParseAccessCond(t *testing.T) {
+	cases := map[string]byte{"free": 0x0E, "Denied": 0x0F, "0": 0, "4": 4, " 2 ": 2}
+	for in, want := range cases {
+		got, err := parseAccessCond(in)
+		if err != nil || got != want {
+			t.Fatalf("parseAccessCond(%q) = %X, %v; want %X", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"5", "-1", "E", "slot1", ""} {
+		if _, err := parseAccessCond(in); err == nil {
+			t.Fatalf("expected error for %q", in)
+		}
+	}
+}
+
+func TestApplyEditFlagsKeepsUnsetFields(t *testing.T) {
+	current := sdmFile2(t)
+	edit, err := applyEditFlags(current, editFlags{write: "free", commMode: "full"})
+	if err != nil {
+		t.Fatalf("applyEditFlags returned error: %v", err)
+	}
+	want := ntag424.AccessRights{Read: 0x0E, Write: 0x0E, ReadWrite: 0x02, ChangeAccessRights: 0x00}
+	if edit.ar != want {
+		t.Fatalf("expected %v, got %v", want, edit.ar)
+	}
+	if edit.commMode != 0x03 {
+		t.Fatalf("expected comm mode 03, got %02X", edit.commMode)
+	}
+	if edit.sdmEdited || edit.sdmDisabled {
+		t.Fatalf("expected SDM settings to be preserved, got %+v", edit)
+	}
+
+	if _, err := applyEditFlags(current, editFlags{change: "7"}); err == nil {
+		t.Fatalf("expected error for -change 7")
+	}
+	if _, err := applyEditFlags(current, editFlags{commMode: "enc"}); err == nil {
+		t.Fatalf("expected error for -comm-mode enc")
+	}
+}
+
+func TestBuildSettingsPayloadPreservesSDM(t *testing.T) {
+	current := sdmFile2(t)
+	edit, err := applyEditFlags(current, editFlags{write: "free"})
+	if err != nil {
+		t.Fatalf("applyEditFlags returned error: %v", err)
+	}
+
+	got := buildSettingsPayload(current, edit)
+	want := append([]byte{0x40, 0x20, 0xEE}, current.rawData[7:]...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+
+	edit.sdmDisabled = true
+	if got := buildSettingsPayload(current, edit); !bytes.Equal(got, []byte{0x00, 0x20, 0xEE}) {
+		t.Fatalf("expected SDM dropped when disabled, got % X", got)
+	}
+}
+
+func TestSDMStructuralChange(t *testing.T) {
+	current := sdmFile2(t)
+	if reason := sdmStructuralChange(current, 0xC1, 0x0E, 0x01); reason != "" {
+		t.Fatalf("expected no structural change, got %q", reason)
+	}
+	if reason := sdmStructuralChange(current, 0xC1, 0x02, 0x01); reason == "" {
+		t.Fatalf("expected meta plain->key to be structural")
+	}
+	if reason := sdmStructuralChange(current, 0x41, 0x0E, 0x01); reason == "" {
+		t.Fatalf("expected UID mirror toggle to be structural")
+	}
+}
+
+func TestBuildSettingsPayloadWithDiscoveredOffsets(t *testing.T) {
+	current := sdmFile2(t)
+	offsets, err := ntag424.BuildSDMNDEF("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+
+	// Turning off the UID mirror drops UIDOffset from the payload.
+	edit, err := applyEditFlags(current, editFlags{})
+	if err != nil {
+		t.Fatalf("applyEditFlags returned error: %v", err)
+	}
+	edit.sdmEdited = true
+	edit.sdmOptions, edit.sdmMeta, edit.sdmFile, edit.sdmCtr = 0x41, 0x0E, 0x01, 0x01
+	edit.structural = sdmStructuralChange(current, edit.sdmOptions, edit.sdmMeta, edit.sdmFile)
+	if edit.structural == "" || !offsetsRediscoverable(0x02, current, edit) {
+		t.Fatalf("expected a rediscoverable structural change, got %q", edit.structural)
+	}
+	edit.offsets = offsets
+
+	ar1, ar2 := edit.ar.Encode()
+	want := ntag424.BuildChangeFileSettingsData(0x00, ar1, ar2, 0x41, 0x0E, 0x01, 0x01,
+		0, offsets.CtrOffset, offsets.MacInputOffset, offsets.MacOffset, 0)
+	if got := buildSettingsPayload(current, edit); !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+
+	edit.sdmMeta = 0x02
+	if offsetsRediscoverable(0x02, current, edit) {
+		t.Fatalf("expected encrypted PICC data to require reprovisioning")
+	}
+	edit.sdmMeta = 0x0E
+	if offsetsRediscoverable(0x03, current, edit) {
+		t.Fatalf("expected only the NDEF file to be rediscoverable")
+	}
+}
+
+func TestApplyEditFlagsPreset(t *testing.T) {
+	current := sdmFile2(t)
+	for _, p := range ntag424.AccessPresets() {
+		edit, err := applyEditFlags(current, editFlags{preset: p.Name})
+		if err != nil {
+			t.Fatalf("%s: applyEditFlags returned error: %v", p.Name, err)
+		}
+		if edit.ar != p.Access || edit.commMode != p.CommMode {
+			t.Fatalf("%s: expected %v comm %02X, got %v comm %02X", p.Name, p.Access, p.CommMode, edit.ar, edit.commMode)
+		}
+		if edit.sdmEdited || edit.sdmDisabled || edit.structural != "" {
+			t.Fatalf("%s: expected SDM settings to be preserved, got %+v", p.Name, edit)
+		}
+		// The SDM bytes must survive the preset untouched.
+		payload := buildSettingsPayload(current, edit)
+		if !bytes.Equal(payload[3:], current.rawData[7:]) {
+			t.Fatalf("%s: SDM bytes changed\n got: % X\nwant: % X", p.Name, payload[3:], current.rawData[7:])
+		}
+	}
+
+	edit, err := applyEditFlags(current, editFlags{preset: "read-only", write: "2"})
+	if err != nil {
+		t.Fatalf("applyEditFlags returned error: %v", err)
+	}
+	if edit.ar.Write != 0x02 || edit.ar.ReadWrite != ntag424.ARDenied {
+		t.Fatalf("expected -write to override the preset, got %v", edit.ar)
+	}
+	if _, err := applyEditFlags(current, editFlags{preset: "wide-open"}); err == nil {
+		t.Fatal("expected error for an unknown preset")
+	}
+}
+
+func TestEditInteractiveScripted(t *testing.T) {
+	current := sdmFile2(t)
+	files := []fileInfo{{0x01, "CC"}, {0x02, "NDEF"}, {0x03, "Proprietary"}}
+	settings := map[byte]*fileSettings{0x02: current}
+
+	p := prompt.NewScriptedPrompter(
+		prompt.PromptStep{Prompt: "Select file", Item: "File 2"},
+		prompt.PromptStep{Prompt: "Select CommMode", Item: "MAC"},
+		prompt.PromptStep{Prompt: "Select Read", Item: "Free"},
+		prompt.PromptStep{Prompt: "Select Write", Item: "Key 2"},
+		prompt.PromptStep{Prompt: "Select ReadWrite", Item: "Denied"},
+		prompt.PromptStep{Prompt: "Select ChangeAccess", Item: "Key 0"},
+		prompt.PromptStep{Prompt: "Edit SDM", Item: "Yes"},
+		prompt.PromptStep{Prompt: "SDM:", Item: "Keep enabled"},
+		prompt.PromptStep{Prompt: "UID mirroring", Item: "On"},
+		prompt.PromptStep{Prompt: "ReadCtr mirroring", Item: "On"},
+		prompt.PromptStep{Prompt: "ReadCtr limit", Item: "Off"},
+		prompt.PromptStep{Prompt: "Encrypted file data", Item: "Off"},
+		prompt.PromptStep{Prompt: "ASCII encoding", Item: "On"},
+		prompt.PromptStep{Prompt: "SDMMetaRead", Item: "Free"},
+		prompt.PromptStep{Prompt: "SDMFileRead", Item: "Key 1"},
+		prompt.PromptStep{Prompt: "SDMCtrRet", Item: "Key 1"},
+	)
+	target, edit, err := editInteractive(p, files, settings)
+	if err != nil {
+		t.Fatalf("editInteractive returned error: %v", err)
+	}
+	if !p.Done() {
+		t.Fatalf("expected every scripted step used, asked %q", p.Asked)
+	}
+	if target != 0x02 {
+		t.Fatalf("expected file 2, got %d", target)
+	}
+	want := ntag424.AccessRights{Read: 0x0E, Write: 0x02, ReadWrite: 0x0F, ChangeAccessRights: 0x00}
+	if edit.ar != want || edit.commMode != 0x01 {
+		t.Fatalf("expected %v comm 01, got %v comm %02X", want, edit.ar, edit.commMode)
+	}
+	if !edit.sdmEdited || edit.sdmOptions != 0xC1 || edit.structural != "" {
+		t.Fatalf("expected a non-structural SDM edit with options C1, got %+v", edit)
+	}
+
+	payload := buildSettingsPayload(current, edit)
+	if !bytes.Equal(payload[:4], []byte{0x41, 0xF0, 0xE2, 0xC1}) {
+		t.Fatalf("expected FileOption/AR/SDMOptions 41 F0 E2 C1, got % X", payload[:4])
+	}
+	if !bytes.Equal(payload[6:], current.rawData[10:]) {
+		t.Fatalf("expected offsets preserved\n got: % X\nwant: % X", payload[6:], current.rawData[10:])
+	}
+}
+
+func TestEditInteractiveStops(t *testing.T) {
+	settings := map[byte]*fileSettings{0x02: sdmFile2(t)}
+	files := []fileInfo{{0x02, "NDEF"}}
+
+	// Running out of script mid-edit surfaces as an error, not a partial edit.
+	p := prompt.NewScriptedPrompter(
+		prompt.PromptStep{Prompt: "Select file", Item: "File 2"},
+	)
+	if _, _, err := editInteractive(p, files, settings); err == nil {
+		t.Fatal("expected error when the prompter stops answering")
+	}
+
+	// Enabling SDM is refused rather than exiting the process.
+	plain := &fileSettings{fileType: 0x00, fileOption: 0x00, ar1: 0xE0, ar2: 0xEE}
+	p = prompt.NewScriptedPrompter(
+		prompt.PromptStep{Item: "File 2"},
+		prompt.PromptStep{Item: "Plain"},
+		prompt.PromptStep{Item: "Free"},
+		prompt.PromptStep{Item: "Free"},
+		prompt.PromptStep{Item: "Free"},
+		prompt.PromptStep{Item: "Key 0"},
+		prompt.PromptStep{Prompt: "Enable SDM", Item: "Yes"},
+	)
+	if _, _, err := editInteractive(p, files, map[byte]*fileSettings{0x02: plain}); err == nil {
+		t.Fatal("expected error when asked to enable SDM")
+	}
+}
+
+func TestLoadSlotRoles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+
+	roles, err := loadSlotRoles(write("roles.yaml", "slot_roles:\n  1: SDM MAC\n  3: Loyalty\n  4: \"\"\n"))
+	if err != nil {
+		t.Fatalf("loadSlotRoles returned error: %v", err)
+	}
+	want := ntag424.SlotRoles{0: "AppMaster", 1: "SDM MAC", 2: "File Two Write", 3: "Loyalty"}
+	if !reflect.DeepEqual(roles, want) {
+		t.Fatalf("expected roles %v, got %v", want, roles)
+	}
+
+	for name, content := range map[string]string{
+		"range.yaml":   "slot_roles:\n  5: Extra\n",
+		"unknown.yaml": "roles:\n  0: AppMaster\n",
+	} {
+		if _, err := loadSlotRoles(write(name, content)); err == nil {
+			t.Fatalf("expected error for %q", content)
+		}
+	}
+}
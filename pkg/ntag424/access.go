@@ -0,0 +1,117 @@
+package ntag424
+
+import "fmt"
+
+// Access condition nibble values (0x0-0xD are key slot numbers).
+const (
+	ARFree   byte = 0x0E // No authentication needed
+	ARDenied byte = 0x0F // Operation never permitted
+)
+
+// AccessRights is the decoded form of the AR1/AR2 access rights bytes.
+// See the package documentation for the nibble layout.
+type AccessRights struct {
+	Read               byte `json:"read"`                 // AR2 upper nibble
+	Write              byte `json:"write"`                // AR2 lower nibble
+	ReadWrite          byte `json:"read_write"`           // AR1 upper nibble
+	ChangeAccessRights byte `json:"change_access_rights"` // AR1 lower nibble
+}
+
+// DecodeAccessRights splits AR1/AR2 into their four access condition nibbles.
+//
+// Example: AR1=0x20, AR2=0xE2 → Read=free Write=slot2 ReadWrite=slot2 Change=slot0
+func DecodeAccessRights(ar1, ar2 byte) AccessRights {
+	return AccessRights{
+		Read:               (ar2 >> 4) & 0x0F,
+		Write:              ar2 & 0x0F,
+		ReadWrite:          (ar1 >> 4) & 0x0F,
+		ChangeAccessRights: ar1 & 0x0F,
+	}
+}
+
+// Encode packs the access rights back into AR1/AR2 as used by
+// ChangeFileSettings. Each field is masked to its low nibble.
+func (a AccessRights) Encode() (ar1, ar2 byte) {
+	ar1 = (a.ReadWrite&0x0F)<<4 | (a.ChangeAccessRights & 0x0F)
+	ar2 = (a.Read&0x0F)<<4 | (a.Write & 0x0F)
+	return ar1, ar2
+}
+
+// String renders the access rights as "Read=free Write=slot2 ReadWrite=slot2 Change=slot0".
+func (a AccessRights) String() string {
+	return fmt.Sprintf("Read=%s Write=%s ReadWrite=%s Change=%s",
+		accessCondName(a.Read), accessCondName(a.Write),
+		accessCondName(a.ReadWrite), accessCondName(a.ChangeAccessRights))
+}
+
+// accessCondName returns a compact name for an access condition nibble.
+func accessCondName(keyNo byte) string {
+	switch keyNo {
+	case ARFree:
+		return "free"
+	case ARDenied:
+		return "denied"
+	default:
+		return fmt.Sprintf("slot%d", keyNo)
+	}
+}
+
+// AccessRights returns the decoded AR1/AR2 access rights.
+func (fs *FileSettings) AccessRights() AccessRights {
+	return DecodeAccessRights(fs.AR1, fs.AR2)
+}
+
+// AccessPreset is a named comm mode and access rights combination that
+// operators apply to a file in one step (permissionsedit -preset).
+type AccessPreset struct {
+	Name        string
+	Description string
+	CommMode    byte // FileOption bits 1:0
+	Access      AccessRights
+}
+
+// Bytes returns the FileOption comm mode bits and the AR1/AR2 bytes for p,
+// as passed to ChangeFileSettingsBasic.
+func (p AccessPreset) Bytes() (fileOption, ar1, ar2 byte) {
+	ar1, ar2 = p.Access.Encode()
+	return p.CommMode & 0x03, ar1, ar2
+}
+
+// accessPresets is the preset table, in the order AccessPresets lists it.
+var accessPresets = []AccessPreset{
+	{
+		// File 2 as minter provisions it (DefaultGuideApparelProfile)
+		Name:        "ndef-locked",
+		Description: "plain, read free, write and read/write slot 2, change slot 0 (AR1=0x20 AR2=0xE2)",
+		CommMode:    0x00,
+		Access:      AccessRights{Read: ARFree, Write: 0x02, ReadWrite: 0x02, ChangeAccessRights: 0x00},
+	},
+	{
+		// File 2 as reset leaves it
+		Name:        "open",
+		Description: "plain, read and write free, read/write and change slot 0 (AR1=0x00 AR2=0xEE)",
+		CommMode:    0x00,
+		Access:      AccessRights{Read: ARFree, Write: ARFree, ReadWrite: 0x00, ChangeAccessRights: 0x00},
+	},
+	{
+		Name:        "read-only",
+		Description: "plain, read free, write and read/write denied, change slot 0 (AR1=0xF0 AR2=0xEF)",
+		CommMode:    0x00,
+		Access:      AccessRights{Read: ARFree, Write: ARDenied, ReadWrite: ARDenied, ChangeAccessRights: 0x00},
+	},
+}
+
+// AccessPresets returns the built-in access presets.
+func AccessPresets() []AccessPreset {
+	return append([]AccessPreset(nil), accessPresets...)
+}
+
+// LookupAccessPreset returns the preset with the given name.
+func LookupAccessPreset(name string) (AccessPreset, bool) {
+	for _, p := range accessPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return AccessPreset{}, false
+}
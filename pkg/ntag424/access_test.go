@@ -0,0 +1,88 @@
+package ntag424
+
+import "testing"
+
+func TestDecodeAccessRightsProvisionedFile2(t *testing.T) {
+	// Provisioned NDEF file from the package docs: AR1=0x20, AR2=0xE2
+	ar := DecodeAccessRights(0x20, 0xE2)
+	want := AccessRights{Read: ARFree, Write: 0x02, ReadWrite: 0x02, ChangeAccessRights: 0x00}
+	if ar != want {
+		t.Fatalf("expected %+v, got %+v", want, ar)
+	}
+	if got := ar.String(); got != "Read=free Write=slot2 ReadWrite=slot2 Change=slot0" {
+		t.Fatalf("unexpected String(): %q", got)
+	}
+
+	ar1, ar2 := ar.Encode()
+	if ar1 != 0x20 || ar2 != 0xE2 {
+		t.Fatalf("expected Encode() 20 E2, got %02X %02X", ar1, ar2)
+	}
+
+	fs := &FileSettings{AR1: 0x20, AR2: 0xE2}
+	if fs.AccessRights() != want {
+		t.Fatalf("expected FileSettings.AccessRights() %+v, got %+v", want, fs.AccessRights())
+	}
+}
+
+func TestAccessRightsRoundTrip(t *testing.T) {
+	cases := []struct {
+		ar1, ar2 byte
+		str      string
+	}{
+		{0xE0, 0xEE, "Read=free Write=free ReadWrite=free Change=slot0"},
+		{0x00, 0xE0, "Read=free Write=slot0 ReadWrite=slot0 Change=slot0"},
+		{0xFF, 0xFF, "Read=denied Write=denied ReadWrite=denied Change=denied"},
+		{0x3D, 0x1C, "Read=slot1 Write=slot12 ReadWrite=slot3 Change=slot13"},
+	}
+	for _, tc := range cases {
+		ar := DecodeAccessRights(tc.ar1, tc.ar2)
+		if got := ar.String(); got != tc.str {
+			t.Fatalf("AR %02X %02X: expected %q, got %q", tc.ar1, tc.ar2, tc.str, got)
+		}
+		ar1, ar2 := ar.Encode()
+		if ar1 != tc.ar1 || ar2 != tc.ar2 {
+			t.Fatalf("AR %02X %02X: Encode() returned %02X %02X", tc.ar1, tc.ar2, ar1, ar2)
+		}
+	}
+}
+
+func TestAccessRightsEncodeMasksNibbles(t *testing.T) {
+	ar1, ar2 := AccessRights{Read: 0x1E, Write: 0xF2, ReadWrite: 0x22, ChangeAccessRights: 0x30}.Encode()
+	if ar1 != 0x20 || ar2 != 0xE2 {
+		t.Fatalf("expected masked 20 E2, got %02X %02X", ar1, ar2)
+	}
+}
+
+func TestAccessPresetBytes(t *testing.T) {
+	want := map[string][3]byte{
+		"ndef-locked": {0x00, 0x20, 0xE2},
+		"open":        {0x00, 0x00, 0xEE},
+		"read-only":   {0x00, 0xF0, 0xEF},
+	}
+	presets := AccessPresets()
+	if len(presets) != len(want) {
+		t.Fatalf("expected %d presets, got %d", len(want), len(presets))
+	}
+	for _, p := range presets {
+		w, ok := want[p.Name]
+		if !ok {
+			t.Fatalf("unexpected preset %q", p.Name)
+		}
+		fileOption, ar1, ar2 := p.Bytes()
+		if got := [3]byte{fileOption, ar1, ar2}; got != w {
+			t.Fatalf("%s: expected FileOption/AR1/AR2 % X, got % X", p.Name, w, got)
+		}
+		if looked, ok := LookupAccessPreset(p.Name); !ok || looked != p {
+			t.Fatalf("%s: LookupAccessPreset returned %+v, %v", p.Name, looked, ok)
+		}
+	}
+
+	profile := DefaultGuideApparelProfile()
+	locked, _ := LookupAccessPreset("ndef-locked")
+	if locked.Access != profile.Access || locked.CommMode != profile.CommMode {
+		t.Fatalf("expected ndef-locked to match %s, got %+v", profile.Name, locked)
+	}
+	if _, ok := LookupAccessPreset("wide-open"); ok {
+		t.Fatal("expected unknown preset lookup to fail")
+	}
+}
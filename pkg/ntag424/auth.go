@@ -18,6 +18,32 @@ type Session struct {
 	kmac   [16]byte
 	ti     [4]byte
 	cmdCtr uint16
+
+	// fileModes caches, per file number, what GetFileSettings learned
+	// during this session (see FileCommMode).
+	fileModes map[byte]fileMode
+}
+
+// sessionLimitMargin is how many commands before cmdCtr reaches 0xFFFF
+// NearLimit starts reporting true.
+const sessionLimitMargin = 256
+
+// CommandsIssued returns the session's command counter: the number of
+// commands the tag has counted since AuthenticateEV2First. It is 0 for a nil
+// session.
+func (s *Session) CommandsIssued() uint16 {
+	if s == nil {
+		return 0
+	}
+	return s.cmdCtr
+}
+
+// NearLimit reports whether the 16-bit command counter is within
+// sessionLimitMargin commands of 0xFFFF. The counter feeds the IV and MAC
+// inputs and cannot wrap, so a long-running caller should re-authenticate
+// once NearLimit is true instead of failing a command at the boundary.
+func (s *Session) NearLimit() bool {
+	return s != nil && s.cmdCtr >= 0xFFFF-sessionLimitMargin
 }
 
 // AuthError represents an authentication failure at a specific step.
@@ -123,36 +149,21 @@ func AuthenticateEV2First(card Card, key []byte, keyNo byte) (*Session, error) {
 	}
 
 	// Derive session keys Kenc and Kmac
-	sv1 := make([]byte, 32)
-	sv2 := make([]byte, 32)
-	copy(sv1, []byte{0xA5, 0x5A, 0x00, 0x01, 0x00, 0x80})
-	copy(sv2, []byte{0x5A, 0xA5, 0x00, 0x01, 0x00, 0x80})
-	copy(sv1[6:8], rndA[:2])
-	copy(sv2[6:8], rndA[:2])
-	for i := 0; i < 6; i++ {
-		sv1[8+i] = rndA[2+i] ^ rndB[i]
-		sv2[8+i] = rndA[2+i] ^ rndB[i]
-	}
-	copy(sv1[14:24], rndB[6:16])
-	copy(sv2[14:24], rndB[6:16])
-	copy(sv1[24:32], rndA[8:16])
-	copy(sv2[24:32], rndA[8:16])
-
-	kenc, err := aesCMAC(key, sv1)
-	if err != nil {
-		return nil, &AuthError{Step: "step2", Cause: err}
-	}
-	kmac, err := aesCMAC(key, sv2)
+	kenc, kmac, err := deriveSessionKeys(key, rndA, rndB)
 	if err != nil {
 		return nil, &AuthError{Step: "step2", Cause: err}
 	}
 
-	slog.Debug("session keys derived",
-		"rndA", strings.ToUpper(hex.EncodeToString(rndA)),
-		"rndB", strings.ToUpper(hex.EncodeToString(rndB)),
-		"ti", strings.ToUpper(hex.EncodeToString(ti)),
-		"kenc", strings.ToUpper(hex.EncodeToString(kenc)),
-		"kmac", strings.ToUpper(hex.EncodeToString(kmac)))
+	if redactKeyMaterial() {
+		slog.Debug("session keys derived", "ti", strings.ToUpper(hex.EncodeToString(ti)))
+	} else {
+		slog.Debug("session keys derived",
+			"rndA", strings.ToUpper(hex.EncodeToString(rndA)),
+			"rndB", strings.ToUpper(hex.EncodeToString(rndB)),
+			"ti", strings.ToUpper(hex.EncodeToString(ti)),
+			"kenc", strings.ToUpper(hex.EncodeToString(kenc)),
+			"kmac", strings.ToUpper(hex.EncodeToString(kmac)))
+	}
 
 	s := &Session{}
 	copy(s.kenc[:], kenc)
@@ -162,6 +173,44 @@ func AuthenticateEV2First(card Card, key []byte, keyNo byte) (*Session, error) {
 	return s, nil
 }
 
+// deriveSessionKeys computes the EV2 session keys from the authentication
+// key and both 16-byte random challenges, as in AN12196:
+//
+//	Kenc = AES-CMAC(key, SV1), Kmac = AES-CMAC(key, SV2)
+//
+// with SV1 and SV2 built by sessionVectors.
+func deriveSessionKeys(key, rndA, rndB []byte) (kenc, kmac []byte, err error) {
+	if len(rndA) != 16 || len(rndB) != 16 {
+		return nil, nil, fmt.Errorf("rndA and rndB must be 16 bytes, got %d and %d", len(rndA), len(rndB))
+	}
+	sv1, sv2 := sessionVectors(rndA, rndB)
+	if kenc, err = AESCMAC(key, sv1); err != nil {
+		return nil, nil, err
+	}
+	if kmac, err = AESCMAC(key, sv2); err != nil {
+		return nil, nil, err
+	}
+	return kenc, kmac, nil
+}
+
+// sessionVectors builds the session vectors for deriveSessionKeys:
+//
+//	SV1 = A5 5A 00 01 00 80 || rndA[0:2] || (rndA[2:8] XOR rndB[0:6]) || rndB[6:16] || rndA[8:16]
+//	SV2 = 5A A5 00 01 00 80 || (same fill)
+func sessionVectors(rndA, rndB []byte) (sv1, sv2 []byte) {
+	sv1 = make([]byte, 32)
+	copy(sv1, []byte{0xA5, 0x5A, 0x00, 0x01, 0x00, 0x80})
+	copy(sv1[6:8], rndA[:2])
+	for i := 0; i < 6; i++ {
+		sv1[8+i] = rndA[2+i] ^ rndB[i]
+	}
+	copy(sv1[14:24], rndB[6:16])
+	copy(sv1[24:32], rndA[8:16])
+
+	sv2 = append([]byte{0x5A, 0xA5}, sv1[2:]...)
+	return sv1, sv2
+}
+
 // AuthenticateWithFallback attempts authentication with multiple key/slot combinations.
 // It tries:
 //   1. Provided key with keyNo
@@ -218,6 +267,26 @@ func AuthenticateWithFallback(card Card, key []byte, keyNo byte, altKeyNo byte)
 	return nil, nil, 0, lastErr
 }
 
+// TagState is the precheck the provisioning tools run before provisioning or
+// resetting a tag: it selects the NDEF application and authenticates slot 0
+// with appMasterKey, falling back to the all-zero factory key (see
+// AuthenticateWithFallback).
+//
+// provisioned is true if appMasterKey authenticated and false if only the
+// factory key did (or appMasterKey is itself all zero). authKey is the key
+// that worked and sess the session it opened, ready for key or file changes.
+// An error means neither key opens slot 0.
+func TagState(card Card, appMasterKey []byte) (provisioned bool, authKey []byte, sess *Session, err error) {
+	if err := SelectNDEFApp(card); err != nil {
+		return false, nil, nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, authKey, _, err = AuthenticateWithFallback(card, appMasterKey, 0, 0)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("authenticate slot 0: %w", err)
+	}
+	return !isAllZero(authKey), authKey, sess, nil
+}
+
 func isAllZero(b []byte) bool {
 	for _, v := range b {
 		if v != 0 {
@@ -0,0 +1,78 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTagStateFactory(t *testing.T) {
+	tag := newKeyTag(t)
+	appMasterKey := bytes.Repeat([]byte{0x5C}, 16)
+
+	provisioned, authKey, sess, err := TagState(tag, appMasterKey)
+	if err != nil {
+		t.Fatalf("TagState returned error: %v", err)
+	}
+	if provisioned || !bytes.Equal(authKey, make([]byte, 16)) || sess == nil {
+		t.Fatalf("expected factory tag opened with the zero key, got provisioned=%v key=% X", provisioned, authKey)
+	}
+}
+
+func TestTagStateProvisioned(t *testing.T) {
+	tag := newKeyTag(t)
+	appMasterKey := bytes.Repeat([]byte{0x5C}, 16)
+	tag.keys[0] = appMasterKey
+
+	provisioned, authKey, sess, err := TagState(tag, appMasterKey)
+	if err != nil {
+		t.Fatalf("TagState returned error: %v", err)
+	}
+	if !provisioned || !bytes.Equal(authKey, appMasterKey) || sess == nil {
+		t.Fatalf("expected provisioned tag opened with the app key, got provisioned=%v key=% X", provisioned, authKey)
+	}
+	// The session is live: a cross-slot ChangeKey goes through
+	if err := ChangeKey(tag, sess, 1, bytes.Repeat([]byte{0x11}, 16), make([]byte, 16), 1, 0); err != nil {
+		t.Fatalf("ChangeKey over TagState session returned error: %v", err)
+	}
+}
+
+func TestTagStateUnknownKey(t *testing.T) {
+	tag := newKeyTag(t)
+	tag.keys[0] = bytes.Repeat([]byte{0x77}, 16)
+
+	if _, _, _, err := TagState(tag, bytes.Repeat([]byte{0x5C}, 16)); err == nil {
+		t.Fatal("expected error when neither key opens slot 0")
+	}
+}
+
+// AN12196 AuthenticateEV2First example with the all-zero key.
+func TestDeriveSessionKeysAN12196(t *testing.T) {
+	key := make([]byte, 16)
+	rndA := mustHex(t, "13C5DB8A5930439FC3DEF9A4C675360F")
+	rndB := mustHex(t, "B9E2FC789B64BF237CCCAA20EC7E6E48")
+
+	sv1, sv2 := sessionVectors(rndA, rndB)
+	if want := mustHex(t, "A55A0001008013C56268A548D8FBBF237CCCAA20EC7E6E48C3DEF9A4C675360F"); !bytes.Equal(sv1, want) {
+		t.Fatalf("SV1 = % X, want % X", sv1, want)
+	}
+	if want := mustHex(t, "5AA50001008013C56268A548D8FBBF237CCCAA20EC7E6E48C3DEF9A4C675360F"); !bytes.Equal(sv2, want) {
+		t.Fatalf("SV2 = % X, want % X", sv2, want)
+	}
+
+	kenc, kmac, err := deriveSessionKeys(key, rndA, rndB)
+	if err != nil {
+		t.Fatalf("deriveSessionKeys returned error: %v", err)
+	}
+	if want := mustHex(t, "1309C877509E5A215007FF0ED19CA564"); !bytes.Equal(kenc, want) {
+		t.Fatalf("Kenc = % X, want % X", kenc, want)
+	}
+	if want := mustHex(t, "4C6626F5E72EA694202139295C7A7FC7"); !bytes.Equal(kmac, want) {
+		t.Fatalf("Kmac = % X, want % X", kmac, want)
+	}
+}
+
+func TestDeriveSessionKeysRejectsShortChallenges(t *testing.T) {
+	if _, _, err := deriveSessionKeys(make([]byte, 16), make([]byte, 16), make([]byte, 8)); err == nil {
+		t.Fatal("expected an error for an 8-byte rndB")
+	}
+}
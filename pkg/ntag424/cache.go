@@ -0,0 +1,94 @@
+package ntag424
+
+import (
+	"sync"
+	"time"
+)
+
+// SettingsCache remembers file settings per (UID, file number) for a fixed
+// TTL, so a scan loop can skip GetFileSettings when the same tag is tapped
+// again. It is safe for concurrent use.
+//
+// A nil *SettingsCache is valid and caches nothing, so tools can thread an
+// optional cache through without checking for it. Entries are not
+// invalidated when settings change on the tag; call Invalidate after
+// ChangeFileSettings on a cached UID.
+type SettingsCache struct {
+	ttl     time.Duration
+	now     func() time.Time // replaced in tests
+	mu      sync.Mutex
+	entries map[settingsCacheKey]settingsCacheEntry
+}
+
+type settingsCacheKey struct {
+	uid    string
+	fileNo byte
+}
+
+type settingsCacheEntry struct {
+	fs      FileSettings
+	expires time.Time
+}
+
+// NewSettingsCache returns a cache whose entries expire ttl after Put.
+func NewSettingsCache(ttl time.Duration) *SettingsCache {
+	return &SettingsCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[settingsCacheKey]settingsCacheEntry),
+	}
+}
+
+// Get returns a copy of the settings stored for uid and fileNo, if they have
+// not expired.
+func (c *SettingsCache) Get(uid []byte, fileNo byte) (*FileSettings, bool) {
+	if c == nil || len(uid) == 0 {
+		return nil, false
+	}
+	key := settingsCacheKey{uid: string(uid), fileNo: fileNo}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return copyFileSettings(&e.fs), true
+}
+
+// Put stores a copy of fs for uid and fileNo. A nil fs or an empty UID is
+// ignored.
+func (c *SettingsCache) Put(uid []byte, fileNo byte, fs *FileSettings) {
+	if c == nil || len(uid) == 0 || fs == nil {
+		return
+	}
+	key := settingsCacheKey{uid: string(uid), fileNo: fileNo}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = settingsCacheEntry{fs: *copyFileSettings(fs), expires: c.now().Add(c.ttl)}
+}
+
+// Invalidate drops every entry for uid.
+func (c *SettingsCache) Invalidate(uid []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.uid == string(uid) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func copyFileSettings(fs *FileSettings) *FileSettings {
+	cp := *fs
+	cp.RawData = append([]byte(nil), fs.RawData...)
+	return &cp
+}
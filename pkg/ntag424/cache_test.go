@@ -0,0 +1,63 @@
+package ntag424
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsCacheTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewSettingsCache(2 * time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Put(testUID, 0x02, &FileSettings{AR1: 0x20, AR2: 0xE2, Size: 256})
+	fs, ok := c.Get(testUID, 0x02)
+	if !ok || fs.AR1 != 0x20 || fs.Size != 256 {
+		t.Fatalf("expected cached settings, got %+v ok=%v", fs, ok)
+	}
+	fs.AR1 = 0xFF // callers get a copy
+	if fs, _ := c.Get(testUID, 0x02); fs.AR1 != 0x20 {
+		t.Fatalf("expected cached entry unaffected by caller changes, got AR1=0x%02X", fs.AR1)
+	}
+
+	now = now.Add(1999 * time.Millisecond)
+	if _, ok := c.Get(testUID, 0x02); !ok {
+		t.Fatalf("expected entry before TTL")
+	}
+	now = now.Add(time.Millisecond)
+	if _, ok := c.Get(testUID, 0x02); ok {
+		t.Fatalf("expected entry to expire at TTL")
+	}
+}
+
+func TestSettingsCacheKeyedByUIDAndFile(t *testing.T) {
+	c := NewSettingsCache(time.Minute)
+	otherUID := []byte{0x04, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	c.Put(testUID, 0x02, &FileSettings{AR2: 0xE2})
+	if _, ok := c.Get(otherUID, 0x02); ok {
+		t.Fatalf("expected no entry for a different UID")
+	}
+	if _, ok := c.Get(testUID, 0x03); ok {
+		t.Fatalf("expected no entry for a different file")
+	}
+
+	c.Put(otherUID, 0x02, &FileSettings{AR2: 0x00})
+	if fs, _ := c.Get(testUID, 0x02); fs == nil || fs.AR2 != 0xE2 {
+		t.Fatalf("expected first UID's entry untouched, got %+v", fs)
+	}
+
+	c.Invalidate(testUID)
+	if _, ok := c.Get(testUID, 0x02); ok {
+		t.Fatalf("expected entry dropped by Invalidate")
+	}
+	if _, ok := c.Get(otherUID, 0x02); !ok {
+		t.Fatalf("expected other UID's entry to survive Invalidate")
+	}
+
+	var disabled *SettingsCache
+	disabled.Put(testUID, 0x02, &FileSettings{})
+	if _, ok := disabled.Get(testUID, 0x02); ok {
+		t.Fatalf("expected nil cache to cache nothing")
+	}
+}
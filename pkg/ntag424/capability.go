@@ -0,0 +1,122 @@
+package ntag424
+
+import "fmt"
+
+// KeyCapabilityReport is what one key may do on a tag, as returned by
+// KeyCapabilities.
+type KeyCapabilityReport struct {
+	Slots      []byte           `json:"slots"`       // Key slots the key authenticates on
+	ChangeKeys bool             `json:"change_keys"` // Key is the AppMasterKey (slot 0), which ChangeKey requires
+	Files      []FileCapability `json:"files"`
+}
+
+// FileCapability is what the key may do with one file. An operation whose
+// access condition is free is reported as allowed, with or without the key.
+type FileCapability struct {
+	FileNo         byte         `json:"file_no"`
+	Access         AccessRights `json:"access"`
+	Read           bool         `json:"read"`            // ReadData, via Read or ReadWrite
+	Write          bool         `json:"write"`           // WriteData, via Write or ReadWrite
+	ChangeSettings bool         `json:"change_settings"` // ChangeFileSettings, via ChangeAccessRights
+	Error          string       `json:"error,omitempty"` // Why the settings could not be read
+}
+
+// Operations lists the allowed operations as "read", "write" and
+// "change-settings", in that order.
+func (f FileCapability) Operations() []string {
+	var ops []string
+	if f.Read {
+		ops = append(ops, "read")
+	}
+	if f.Write {
+		ops = append(ops, "write")
+	}
+	if f.ChangeSettings {
+		ops = append(ops, "change-settings")
+	}
+	return ops
+}
+
+// KeyCapabilities works out which operations key authorizes. It tries key
+// on slots 0-4, re-selecting the NDEF app before each attempt, then reads the
+// settings of every file ListFileIDs returns and checks each access condition
+// against the matched slots. Settings are read in a session with the first
+// matched slot, so files whose settings need authentication are covered too.
+//
+// Each slot the key does not match counts against the tag's
+// failed-authentication counter. A file whose settings cannot be read is
+// reported with Error set; only a failed select or GetFileIDs exchange is
+// returned as an error.
+func KeyCapabilities(card Card, key []byte) (*KeyCapabilityReport, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("key must be 16 bytes, got %d", len(key))
+	}
+	var slots []byte
+	for slot := byte(0); slot <= maxKeySlot; slot++ {
+		if err := SelectNDEFApp(card); err != nil {
+			return nil, fmt.Errorf("select NDEF app: %w", err)
+		}
+		if _, err := AuthenticateEV2First(card, key, slot); err == nil {
+			slots = append(slots, slot)
+		}
+	}
+
+	if err := SelectNDEFApp(card); err != nil {
+		return nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	fileNos, err := ListFileIDs(card, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get file IDs: %w", err)
+	}
+	var sess *Session
+	if len(slots) > 0 {
+		// Without a session only plainly readable settings are covered
+		sess, _ = AuthenticateEV2First(card, key, slots[0])
+	}
+
+	files := make([]FileCapability, 0, len(fileNos))
+	for _, fileNo := range fileNos {
+		fs, err := GetFileSettings(card, sess, fileNo)
+		if err != nil {
+			files = append(files, FileCapability{FileNo: fileNo, Error: err.Error()})
+			continue
+		}
+		files = append(files, fileCapability(fileNo, fs.AccessRights(), slots))
+	}
+	return newKeyCapabilityReport(slots, files), nil
+}
+
+// newKeyCapabilityReport assembles a KeyCapabilityReport.
+func newKeyCapabilityReport(slots []byte, files []FileCapability) *KeyCapabilityReport {
+	r := &KeyCapabilityReport{Slots: slots, Files: files}
+	for _, s := range slots {
+		if s == 0 {
+			r.ChangeKeys = true
+		}
+	}
+	return r
+}
+
+// fileCapability checks the access rights of one file against the slots a
+// key authenticates on. ReadWrite grants both read and write.
+func fileCapability(fileNo byte, ar AccessRights, slots []byte) FileCapability {
+	permits := func(cond byte) bool {
+		if cond == ARFree {
+			return true
+		}
+		for _, s := range slots {
+			if s == cond {
+				return true
+			}
+		}
+		return false
+	}
+	rw := permits(ar.ReadWrite)
+	return FileCapability{
+		FileNo:         fileNo,
+		Access:         ar,
+		Read:           rw || permits(ar.Read),
+		Write:          rw || permits(ar.Write),
+		ChangeSettings: permits(ar.ChangeAccessRights),
+	}
+}
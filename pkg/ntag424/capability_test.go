@@ -0,0 +1,70 @@
+package ntag424
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestKeyCapabilitiesSlot2(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	key := bytes.Repeat([]byte{0x22}, 16)
+	zero := make([]byte, 16)
+	ars := [][2]byte{
+		{0x00, 0xE0}, // CC: read free, everything else slot 0
+		{0x20, 0xE2}, // NDEF: read free, write and read/write slot 2
+		{0x30, 0x23}, // read slot 2, write and read/write slot 3
+	}
+
+	script := probeExchanges(t, [5][]byte{zero, zero, key, zero, zero}, [][]byte{key})
+	script = append(script, selectNDEFAppExchange,
+		FakeExchange{Command: []byte{0x90, 0x6F, 0x00, 0x00, 0x00}, Response: []byte{0x01, 0x02, 0x03, 0x91, 0x00}})
+	auth, _ := authExchanges(t, 2, key, key)
+	script = append(script, auth...)
+	for i, ar := range ars {
+		fileNo := byte(i + 1)
+		script = append(script, FakeExchange{
+			Command:  []byte{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x00},
+			Response: settingsAPDUResponse(0x00, ar[0], ar[1], 32),
+		})
+	}
+	card := NewFakeCard(script...)
+
+	r, err := KeyCapabilities(card, key)
+	if err != nil {
+		t.Fatalf("KeyCapabilities returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.Slots, []byte{0x02}) || r.ChangeKeys {
+		t.Fatalf("expected slot 2 only and no ChangeKey, got slots %v change_keys=%v", r.Slots, r.ChangeKeys)
+	}
+	want := map[byte][]string{
+		0x01: {"read"},
+		0x02: {"read", "write"},
+		0x03: {"read"},
+	}
+	if len(r.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), r.Files)
+	}
+	for _, f := range r.Files {
+		if f.Error != "" {
+			t.Fatalf("file %d: unexpected error %s", f.FileNo, f.Error)
+		}
+		if got := f.Operations(); !reflect.DeepEqual(got, want[f.FileNo]) {
+			t.Errorf("file %d: expected %v, got %v", f.FileNo, want[f.FileNo], got)
+		}
+	}
+}
+
+func TestFileCapabilityReadWriteGrantsBoth(t *testing.T) {
+	ar := AccessRights{Read: ARDenied, Write: ARDenied, ReadWrite: 0x03, ChangeAccessRights: 0x00}
+	f := fileCapability(0x03, ar, []byte{0x00, 0x03})
+	if !f.Read || !f.Write || !f.ChangeSettings {
+		t.Fatalf("expected read, write and change-settings, got %v", f.Operations())
+	}
+	if f := fileCapability(0x03, ar, []byte{0x01}); len(f.Operations()) != 0 {
+		t.Fatalf("expected nothing for slot 1, got %v", f.Operations())
+	}
+}
@@ -10,8 +10,11 @@ type Card interface {
 // Transmit sends an APDU to the card and extracts the status word.
 // Returns (response_data, status_word, error).
 // The response data does NOT include the trailing SW bytes.
+//
+// Every exchange is recorded when EnableAPDUTrace is on.
 func Transmit(card Card, apdu []byte) ([]byte, uint16, error) {
 	resp, err := card.Transmit(apdu)
+	traceAPDU(apdu, resp, err)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -24,13 +27,70 @@ func Transmit(card Card, apdu []byte) ([]byte, uint16, error) {
 
 // GetUID retrieves the card UID via ISO 7816 GET DATA command (FF CA 00 00).
 // Tries with Le=0x00 (wildcard) and Le=0x04 (specific 4-byte UID length).
+// If both fail, the error wraps the last failure, a *SWError for a status word.
 func GetUID(card Card) ([]byte, error) {
+	var lastErr error
 	for _, le := range []byte{0x00, 0x04} {
 		apdu := []byte{0xFF, 0xCA, 0x00, 0x00, le}
 		data, sw, err := Transmit(card, apdu)
-		if err == nil && SwOK(sw) && len(data) > 0 {
+		switch {
+		case err != nil:
+			lastErr = err
+		case !SwOK(sw):
+			lastErr = &SWError{Cmd: 0xCA, SW: sw}
+		case len(data) > 0:
 			return data, nil
 		}
 	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("UID not available via GET DATA: %w", lastErr)
+	}
 	return nil, fmt.Errorf("UID not available via GET DATA")
 }
+
+// GetCardUID retrieves the real 7-byte UID with DESFire GetCardUID (INS 0x51).
+// The response is always in CommMode.Full, so an authenticated session is
+// required (any key slot). Unlike GET DATA, it returns the real UID even when
+// random ID is enabled.
+func GetCardUID(card Card, sess *Session) ([]byte, error) {
+	uid, err := SsmCmdFull(card, sess, 0x51, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(uid) != 7 {
+		return nil, fmt.Errorf("GetCardUID returned %d bytes, expected 7", len(uid))
+	}
+	return uid, nil
+}
+
+// IsRandomUID reports whether uid is an ISO 14443-3 random ID: 4 bytes
+// starting with 0x08, as returned by GET DATA on a tag with random ID enabled.
+func IsRandomUID(uid []byte) bool {
+	return len(uid) == 4 && uid[0] == 0x08
+}
+
+// RealUID returns the tag's real UID for registration. With a session it uses
+// GetCardUID over the authenticated channel. Without one, or if GetCardUID
+// fails, it falls back to GET DATA, but only when that is not a random ID.
+func RealUID(card Card, sess *Session) ([]byte, error) {
+	var cardUIDErr error
+	if sess != nil {
+		uid, err := GetCardUID(card, sess)
+		if err == nil {
+			return uid, nil
+		}
+		cardUIDErr = err
+	}
+
+	uid, err := GetUID(card)
+	if err != nil {
+		return nil, err
+	}
+	if IsRandomUID(uid) {
+		if cardUIDErr != nil {
+			return nil, fmt.Errorf("GET DATA returned random ID %X and GetCardUID failed: %w", uid, cardUIDErr)
+		}
+		return nil, fmt.Errorf("GET DATA returned random ID %X; authenticate to read the real UID", uid)
+	}
+	return uid, nil
+}
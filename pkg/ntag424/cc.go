@@ -0,0 +1,49 @@
+package ntag424
+
+import "fmt"
+
+// ccMinLen is the length of a Type 4 Tag CC with only the mandatory NDEF
+// File Control TLV: CCLEN(2) MappingVersion(1) MLe(2) MLc(2) TLV(8).
+const ccMinLen = 15
+
+// CapabilityContainer is the decoded NFC Forum Type 4 Tag Capability
+// Container (File 1, ID 0xE103). Multi-byte fields are big-endian on the tag.
+type CapabilityContainer struct {
+	CCLEN          uint16 `json:"cclen"`           // Size of the CC in bytes
+	MappingVersion byte   `json:"mapping_version"` // Major version in the upper nibble, minor in the lower
+	MLe            uint16 `json:"mle"`             // Max R-APDU data size
+	MLc            uint16 `json:"mlc"`             // Max C-APDU data size
+
+	// NDEF File Control TLV (T=0x04, L>=6)
+	NDEFFileID  uint16 `json:"ndef_file_id"`  // Usually 0xE104
+	MaxNDEFSize uint16 `json:"max_ndef_size"` // Including the 2-byte NLEN
+	ReadAccess  byte   `json:"read_access"`   // 0x00 = granted
+	WriteAccess byte   `json:"write_access"`  // 0x00 = granted, 0xFF = read-only
+}
+
+// ParseCCFile decodes a Capability Container as returned by ReadCCFile.
+// data must hold at least the 15 mandatory bytes and start its TLV area with
+// an NDEF File Control TLV; trailing bytes (extra TLVs, padding) are ignored.
+func ParseCCFile(data []byte) (*CapabilityContainer, error) {
+	if len(data) < ccMinLen {
+		return nil, fmt.Errorf("CC file too short: %d bytes, need %d", len(data), ccMinLen)
+	}
+	if data[7] != 0x04 {
+		return nil, fmt.Errorf("CC file: expected NDEF File Control TLV (T=04) at byte 7, got %02X", data[7])
+	}
+	if data[8] < 6 {
+		return nil, fmt.Errorf("CC file: NDEF File Control TLV length %d, need 6", data[8])
+	}
+
+	be16 := func(i int) uint16 { return uint16(data[i])<<8 | uint16(data[i+1]) }
+	return &CapabilityContainer{
+		CCLEN:          be16(0),
+		MappingVersion: data[2],
+		MLe:            be16(3),
+		MLc:            be16(5),
+		NDEFFileID:     be16(9),
+		MaxNDEFSize:    be16(11),
+		ReadAccess:     data[13],
+		WriteAccess:    data[14],
+	}, nil
+}
@@ -0,0 +1,90 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCCFileStandard(t *testing.T) {
+	// NTAG 424 DNA factory CC (first 15 bytes of the 32-byte file)
+	data := mustHex(t, "001720010000FF0406E10401000000")
+
+	cc, err := ParseCCFile(data)
+	if err != nil {
+		t.Fatalf("ParseCCFile returned error: %v", err)
+	}
+	want := CapabilityContainer{
+		CCLEN:          0x0017,
+		MappingVersion: 0x20,
+		MLe:            0x0100,
+		MLc:            0x00FF,
+		NDEFFileID:     0xE104,
+		MaxNDEFSize:    0x0100,
+		ReadAccess:     0x00,
+		WriteAccess:    0x00,
+	}
+	if *cc != want {
+		t.Fatalf("expected %+v, got %+v", want, *cc)
+	}
+
+	// Trailing TLVs and padding are ignored
+	long := append(append([]byte{}, data...), 0x05, 0x06, 0xE1, 0x05, 0x00, 0x80, 0x82, 0x83)
+	if cc2, err := ParseCCFile(long); err != nil || *cc2 != want {
+		t.Fatalf("expected same CC with trailing bytes, got %+v, %v", cc2, err)
+	}
+}
+
+func TestParseCCFileMalformed(t *testing.T) {
+	cases := map[string][]byte{
+		"empty":         nil,
+		"short":         mustHex(t, "001720010000FF"),
+		"one short":     mustHex(t, "001720010000FF0406E104010000"),
+		"wrong tlv":     mustHex(t, "001720010000FF0506E10401000000"),
+		"tlv too short": mustHex(t, "001720010000FF0404E10401000000"),
+	}
+	for name, data := range cases {
+		if _, err := ParseCCFile(data); err == nil {
+			t.Fatalf("%s: expected error for % X", name, data)
+		}
+	}
+}
+
+func TestReadNDEFFileIDUsesCC(t *testing.T) {
+	var selected []uint16
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xA4:
+			selected = append(selected, uint16(apdu[5])<<8|uint16(apdu[6]))
+			return []byte{0x90, 0x00}, nil
+		case 0xB0:
+			return append(ccWithNDEFFile(0xE105), 0x90, 0x00), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	id, err := readNDEFFileID(card)
+	if err != nil {
+		t.Fatalf("readNDEFFileID returned error: %v", err)
+	}
+	if id != 0xE105 || len(selected) != 1 || selected[0] != 0xE103 {
+		t.Fatalf("expected E105 from CC file E103, got %04X (selected %X)", id, selected)
+	}
+}
+
+func TestReadNDEFFallsBackOnUnexpectedCC(t *testing.T) {
+	tag := newISONDEFTag(t, 64)
+	tag.files[0xE103][7] = 0x05 // not an NDEF File Control TLV
+	tag.files[0xE104] = append([]byte{0x00, 0x03, 0xD0, 0x00, 0x00}, make([]byte, 59)...)
+
+	got, err := ReadNDEF(tag)
+	if err != nil {
+		t.Fatalf("ReadNDEF returned error: %v", err)
+	}
+	if !bytes.Equal(got, []byte{0xD0, 0x00, 0x00}) {
+		t.Fatalf("expected the message from E104, got % X", got)
+	}
+	if tag.selected != 0xE104 {
+		t.Fatalf("expected default NDEF file E104 selected, got %04X", tag.selected)
+	}
+}
@@ -0,0 +1,50 @@
+package ntag424
+
+import "fmt"
+
+// SetConfiguration (INS 0x5C) option bytes.
+const (
+	configOptionPICC       byte = 0x00 // PICC configuration; bit 1 of the data enables Random ID
+	configOptionMirror     byte = 0x02 // Global mirror byte; see ConfigureMirror
+	configOptionCapability byte = 0x05 // Capability data; enables LRP secure messaging
+)
+
+// ConfigureMirror writes the PICC-wide mirror configuration byte with
+// SetConfiguration option 0x02, sent in CommMode.Full under sess, which must
+// be authenticated with the application master key (slot 0).
+//
+// This is for advanced use on parts that document a one-byte global mirror
+// setting under option 0x02. NTAG 424 DNA does not: its UID and counter
+// mirroring is configured per file with SDM (ChangeFileSettingsSDM), and
+// the tag rejects the option with a parameter error (91 9E), which is
+// returned. On MIFARE DESFire EV2/EV3 option 0x02 updates the ATS instead,
+// which a single byte would corrupt, so do not use it there either.
+func ConfigureMirror(card Card, sess *Session, mirrorByte byte) error {
+	if err := setConfiguration(card, sess, configOptionMirror, []byte{mirrorByte}); err != nil {
+		return fmt.Errorf("configure mirror: %w", err)
+	}
+	return nil
+}
+
+// setConfiguration sends SetConfiguration with option in the header and
+// data encrypted. It refuses the settings NXP documents as permanent:
+// enabling Random ID and switching to LRP cannot be undone on the tag.
+func setConfiguration(card Card, sess *Session, option byte, data []byte) error {
+	if err := checkReversibleConfig(option, data); err != nil {
+		return err
+	}
+	if _, err := SsmCmdFull(card, sess, 0x5C, []byte{option}, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkReversibleConfig(option byte, data []byte) error {
+	switch {
+	case option == configOptionPICC && len(data) > 0 && data[0]&0x02 != 0:
+		return fmt.Errorf("SetConfiguration option 0x%02X: enabling Random ID is irreversible, refusing", option)
+	case option == configOptionCapability:
+		return fmt.Errorf("SetConfiguration option 0x%02X: capability data can switch the tag to LRP irreversibly, refusing", option)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ntag424
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// The AN12196 session from TestChangeKeyGoldenAPDUs at counter 0. Expected
+// APDU computed independently with openssl: IV = AES-ECB(Kenc, A55A||TI||
+// ctr||0*8), data 01 80 00.. encrypted under it, and the truncated CMAC
+// (Kmac) of 5C||ctr||TI||02||ciphertext.
+func TestConfigureMirrorGoldenAPDU(t *testing.T) {
+	t.Setenv("NTAG_KENC", "4CF3CB41A22583A61E89B158D252FC53")
+	t.Setenv("NTAG_KMAC", "5529860B2FC5FB6154B7F28361D30BF9")
+	t.Setenv("NTAG_TI", "7614281A")
+	t.Setenv("NTAG_CMDC", "0000")
+	sess, err := SessionFromEnv()
+	if err != nil {
+		t.Fatalf("SessionFromEnv returned error: %v", err)
+	}
+	tag := *sess
+	var got []byte
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		got = append([]byte(nil), apdu...)
+		return ssmResponse(t, &tag, nil), nil
+	})
+	if err := ConfigureMirror(card, sess, 0x01); err != nil {
+		t.Fatalf("ConfigureMirror returned error: %v", err)
+	}
+	want := mustHex(t, "905C000019"+"02"+
+		"6ADE98DDA3AEB02F037FA804ECA5B6F1"+
+		"6E9DA36A42138796"+"00")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("unexpected APDU\n got: %X\nwant: %X", got, want)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected cmdCtr 1 after success, got %d", sess.cmdCtr)
+	}
+}
+
+func TestConfigureMirrorRejected(t *testing.T) {
+	card := apduFunc(func([]byte) ([]byte, error) { return []byte{0x91, 0x9E}, nil })
+	err := ConfigureMirror(card, &Session{}, 0x01)
+	if err == nil || !strings.Contains(err.Error(), "configure mirror") {
+		t.Fatalf("expected a configure mirror error for 91 9E, got %v", err)
+	}
+}
+
+func TestSetConfigurationRefusesIrreversible(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+	for _, tc := range []struct {
+		option byte
+		data   []byte
+	}{
+		{configOptionPICC, []byte{0x02}},
+		{configOptionCapability, make([]byte, 10)},
+	} {
+		if err := setConfiguration(card, &Session{}, tc.option, tc.data); err == nil || !strings.Contains(err.Error(), "irreversibl") {
+			t.Errorf("option 0x%02X % X: expected an irreversible refusal, got %v", tc.option, tc.data, err)
+		}
+	}
+}
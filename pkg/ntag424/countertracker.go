@@ -0,0 +1,91 @@
+package ntag424
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// CounterStore persists the highest accepted SDM read counter per tag, so a
+// CounterTracker survives restarts or is shared between servers. Keys are
+// the UID as uppercase hex.
+type CounterStore interface {
+	// Load returns the high-water mark for uid; ok is false for a tag not
+	// seen before.
+	Load(uid string) (counter uint32, ok bool, err error)
+	// Store records counter as the new high-water mark for uid.
+	Store(uid string, counter uint32) error
+}
+
+// MemoryCounterStore is an in-memory CounterStore, lost on restart.
+type MemoryCounterStore struct {
+	mu   sync.Mutex
+	last map[string]uint32
+}
+
+// NewMemoryCounterStore returns an empty MemoryCounterStore.
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{last: make(map[string]uint32)}
+}
+
+// Load implements CounterStore.
+func (m *MemoryCounterStore) Load(uid string) (uint32, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.last[uid]
+	return c, ok, nil
+}
+
+// Store implements CounterStore.
+func (m *MemoryCounterStore) Store(uid string, counter uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last[uid] = counter
+	return nil
+}
+
+// CounterTracker rejects replayed or rolled-back SDM taps. The tag
+// increments its read counter on every tap, so a counter at or below the
+// last accepted one for the same UID is a URL seen before.
+//
+// Check is safe for concurrent use; the load-compare-store sequence is
+// serialized per tracker, so two servers sharing a store need the store
+// itself to make Store conditional.
+type CounterTracker struct {
+	mu    sync.Mutex
+	store CounterStore
+}
+
+// NewCounterTracker returns a tracker backed by store, or by a
+// MemoryCounterStore if store is nil.
+func NewCounterTracker(store CounterStore) *CounterTracker {
+	if store == nil {
+		store = NewMemoryCounterStore()
+	}
+	return &CounterTracker{store: store}
+}
+
+// Check accepts counter if uid has not been seen or counter is above its
+// high-water mark, and then records counter as the new mark. Only call it
+// for taps whose MAC verified, or a forged URL can move the mark.
+//
+// A store error rejects the tap: replay protection fails closed.
+func (t *CounterTracker) Check(uid []byte, counter uint32) (accepted bool) {
+	key := strings.ToUpper(hex.EncodeToString(uid))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok, err := t.store.Load(key)
+	if err != nil {
+		slog.Warn("counter store load failed, rejecting tap", "uid", key, "error", err)
+		return false
+	}
+	if ok && counter <= last {
+		return false
+	}
+	if err := t.store.Store(key, counter); err != nil {
+		slog.Warn("counter store update failed, rejecting tap", "uid", key, "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCounterTrackerCheck(t *testing.T) {
+	tr := NewCounterTracker(nil)
+	other := []byte{0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	steps := []struct {
+		name    string
+		uid     []byte
+		counter uint32
+		want    bool
+	}{
+		{"first seen", testUID, 5, true},
+		{"increasing", testUID, 6, true},
+		{"skipped ahead", testUID, 9, true},
+		{"equal", testUID, 9, false},
+		{"decreasing", testUID, 7, false},
+		{"other tag first seen at zero", other, 0, true},
+		{"other tag equal", other, 0, false},
+		{"first tag still tracked", testUID, 10, true},
+	}
+	for _, s := range steps {
+		if got := tr.Check(s.uid, s.counter); got != s.want {
+			t.Fatalf("%s: Check(% X, %d) = %v, want %v", s.name, s.uid, s.counter, got, s.want)
+		}
+	}
+
+	// A rejected tap does not move the mark.
+	if tr.Check(testUID, 8) || !tr.Check(testUID, 11) {
+		t.Fatal("expected mark to stay at 10 after a rejected tap")
+	}
+}
+
+// failingStore is a CounterStore whose Load or Store fails.
+type failingStore struct {
+	*MemoryCounterStore
+	loadErr, storeErr error
+}
+
+func (f failingStore) Load(uid string) (uint32, bool, error) {
+	if f.loadErr != nil {
+		return 0, false, f.loadErr
+	}
+	return f.MemoryCounterStore.Load(uid)
+}
+
+func (f failingStore) Store(uid string, counter uint32) error {
+	if f.storeErr != nil {
+		return f.storeErr
+	}
+	return f.MemoryCounterStore.Store(uid, counter)
+}
+
+func TestCounterTrackerStore(t *testing.T) {
+	store := NewMemoryCounterStore()
+	if !NewCounterTracker(store).Check(testUID, 3) {
+		t.Fatal("expected first tap to be accepted")
+	}
+	if c, ok, _ := store.Load("041E3C5A7B6F80"); !ok || c != 3 {
+		t.Fatalf("expected store to hold 3 under the uppercase hex UID, got %d (ok=%v)", c, ok)
+	}
+	// A new tracker over the same store keeps the mark, as after a restart.
+	if NewCounterTracker(store).Check(testUID, 3) {
+		t.Fatal("expected replay to be rejected by a tracker sharing the store")
+	}
+
+	for _, fs := range []failingStore{
+		{MemoryCounterStore: NewMemoryCounterStore(), loadErr: errors.New("db down")},
+		{MemoryCounterStore: NewMemoryCounterStore(), storeErr: errors.New("db down")},
+	} {
+		if NewCounterTracker(fs).Check(testUID, 1) {
+			t.Fatalf("expected store failure %+v to reject the tap", fs)
+		}
+	}
+}
+
+func TestVerifySDMWithCounterTracker(t *testing.T) {
+	tr := NewCounterTracker(nil)
+	first, _ := GenerateSDMURL("https://example.com/tap", testUID, 0x10, testSDMKey)
+	next, _ := GenerateSDMURL("https://example.com/tap", testUID, 0x11, testSDMKey)
+	forged, _ := GenerateSDMURL("https://example.com/tap", testUID, 0x50, bytes.Repeat([]byte{0x99}, 16))
+
+	if res := VerifySDM(first, testSDMKey, WithCounterTracker(tr)); !res.Valid {
+		t.Fatalf("expected first tap to verify, got %+v", res)
+	}
+	if res := VerifySDM(first, testSDMKey, WithCounterTracker(tr)); res.Reason != SDMReasonCounterReplay {
+		t.Fatalf("expected replayed tap to be rejected, got %+v", res)
+	}
+	// A forged tap with a high counter must not raise the mark.
+	if res := VerifySDM(forged, testSDMKey, WithCounterTracker(tr)); res.Reason != SDMReasonMACMismatch {
+		t.Fatalf("expected forged tap to fail the MAC, got %+v", res)
+	}
+	if res := VerifySDM(next, testSDMKey, WithCounterTracker(tr)); !res.Valid {
+		t.Fatalf("expected next tap to verify after a forged one, got %+v", res)
+	}
+}
@@ -7,6 +7,11 @@ import (
 	"fmt"
 )
 
+// ErrBadPadding is returned by UnpadISO9797M2 when the data has no 0x80
+// padding marker; after decryption it means the wrong session keys or a
+// corrupted response.
+var ErrBadPadding = errors.New("bad padding")
+
 func aesCBCEncrypt(key, iv, data []byte) ([]byte, error) {
 	if len(data)%16 != 0 {
 		return nil, fmt.Errorf("CBC encrypt: data not block aligned")
@@ -46,7 +51,10 @@ func aesECBEncrypt(key, blockIn []byte) ([]byte, error) {
 	return out, nil
 }
 
-func padISO9797M2(data []byte) []byte {
+// PadISO9797M2 pads data with ISO/IEC 9797-1 padding method 2 (0x80, then
+// zeros) to the next multiple of 16 bytes. A full block of padding is added
+// to data that is already block aligned, as secure messaging requires.
+func PadISO9797M2(data []byte) []byte {
 	padLen := 16 - (len(data) % 16)
 	out := make([]byte, len(data)+padLen)
 	copy(out, data)
@@ -54,13 +62,15 @@ func padISO9797M2(data []byte) []byte {
 	return out
 }
 
-func unpadISO9797M2(data []byte) ([]byte, error) {
+// UnpadISO9797M2 strips ISO/IEC 9797-1 method 2 padding: trailing zeros and
+// the 0x80 before them. It fails if there is no 0x80 marker.
+func UnpadISO9797M2(data []byte) ([]byte, error) {
 	idx := len(data) - 1
 	for idx >= 0 && data[idx] == 0x00 {
 		idx--
 	}
 	if idx < 0 || data[idx] != 0x80 {
-		return nil, errors.New("bad padding")
+		return nil, ErrBadPadding
 	}
 	return data[:idx], nil
 }
@@ -85,13 +95,38 @@ func rotateRight1(in []byte) []byte {
 	return out
 }
 
-func aesCMAC(key, msg []byte) ([]byte, error) {
+// AESCMAC returns the 16-byte AES-CMAC (NIST SP 800-38B, RFC 4493) of msg
+// under key, the MAC secure messaging, session key derivation and SDM use.
+// key must be 16, 24 or 32 bytes; the tag only uses AES-128.
+func AESCMAC(key, msg []byte) ([]byte, error) {
+	ck, err := newCMACKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return ck.sum(msg), nil
+}
+
+// cmacKey holds an AES cipher and its CMAC subkeys so repeated MACs under the
+// same key skip the key schedule and subkey generation.
+type cmacKey struct {
+	block  cipher.Block
+	k1, k2 []byte
+}
+
+func newCMACKey(key []byte) (*cmacKey, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return newCMACKeyFromBlock(block), nil
+}
+
+func newCMACKeyFromBlock(block cipher.Block) *cmacKey {
 	k1, k2 := generateCMACSubkeys(block)
+	return &cmacKey{block: block, k1: k1, k2: k2}
+}
 
+func (ck *cmacKey) sum(msg []byte) []byte {
 	n := (len(msg) + 15) / 16
 	if n == 0 {
 		n = 1
@@ -101,14 +136,14 @@ func aesCMAC(key, msg []byte) ([]byte, error) {
 	last := make([]byte, 16)
 	if lastComplete {
 		copy(last, msg[(n-1)*16:])
-		xorBlock(last, last, k1)
+		xorBlock(last, last, ck.k1)
 	} else {
 		remain := len(msg) - (n-1)*16
 		if remain > 0 {
 			copy(last, msg[(n-1)*16:])
 		}
 		last[remain] = 0x80
-		xorBlock(last, last, k2)
+		xorBlock(last, last, ck.k2)
 	}
 
 	x := make([]byte, 16)
@@ -116,11 +151,11 @@ func aesCMAC(key, msg []byte) ([]byte, error) {
 	for i := 0; i < n-1; i++ {
 		blockStart := i * 16
 		xorBlock(y, x, msg[blockStart:blockStart+16])
-		block.Encrypt(x, y)
+		ck.block.Encrypt(x, y)
 	}
 	xorBlock(y, x, last)
-	block.Encrypt(x, y)
-	return x, nil
+	ck.block.Encrypt(x, y)
+	return x
 }
 
 func generateCMACSubkeys(block cipherBlock) (k1, k2 []byte) {
@@ -162,10 +197,14 @@ func xorBlock(dst, a, b []byte) {
 	}
 }
 
-func truncateOddBytes(cmac []byte) []byte {
-	out := make([]byte, 8)
-	for i := 0; i < 8; i++ {
-		out[i] = cmac[1+i*2]
+// TruncateOddBytes shortens a 16-byte CMAC to the 8 bytes the tag sends:
+// the odd-indexed bytes 1, 3, ..., 15. This is the MACt of secure messaging
+// and the SDMMAC mirrored into the URL. A shorter cmac gives the odd-indexed
+// bytes it has, so fewer than 8; bytes past index 15 are ignored.
+func TruncateOddBytes(cmac []byte) []byte {
+	out := make([]byte, 0, 8)
+	for i := 1; i < len(cmac) && i < 16; i += 2 {
+		out = append(out, cmac[i])
 	}
 	return out
 }
@@ -0,0 +1,79 @@
+package ntag424
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+// RFC 4493 section 4 test vectors (AES-128).
+func TestAESCMACRFC4493(t *testing.T) {
+	key := mustHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	msg := mustHex(t, "6bc1bee22e409f96e93d7e117393172a"+
+		"ae2d8a571e03ac9c9eb76fac45af8e51"+
+		"30c81c46a35ce411e5fbc1191a0a52ef"+
+		"f69f2445df4f9b17ad2b417be66c3710")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	k1, k2 := generateCMACSubkeys(block)
+	if !bytes.Equal(k1, mustHex(t, "fbeed618357133667c85e08f7236a8de")) ||
+		!bytes.Equal(k2, mustHex(t, "f7ddac306ae266ccf90bc11ee46d513b")) {
+		t.Fatalf("unexpected subkeys K1=% X K2=% X", k1, k2)
+	}
+
+	for _, tt := range []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		got, err := AESCMAC(key, msg[:tt.n])
+		if err != nil {
+			t.Fatalf("AESCMAC(len %d) returned error: %v", tt.n, err)
+		}
+		if want := mustHex(t, tt.want); !bytes.Equal(got, want) {
+			t.Fatalf("len %d: expected % X, got % X", tt.n, want, got)
+		}
+	}
+
+	if _, err := AESCMAC(key[:15], msg); err == nil {
+		t.Fatal("expected error for a 15-byte key")
+	}
+}
+
+func TestTruncateOddBytes(t *testing.T) {
+	cmac := mustHex(t, "51f0bebf7e3b9d92fc49741779363cfe")
+	if got, want := TruncateOddBytes(cmac), mustHex(t, "f0bf3b92491736fe"); !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+
+	// Short input keeps the odd bytes present instead of panicking.
+	for n, want := range map[int]string{0: "", 1: "", 2: "f0", 7: "f0bf3b", 15: "f0bf3b92491736"} {
+		if got := TruncateOddBytes(cmac[:n]); !bytes.Equal(got, mustHex(t, want)) {
+			t.Fatalf("len %d: expected %s, got % X", n, want, got)
+		}
+	}
+}
+
+func TestPadISO9797M2RoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 15, 16, 17, 32} {
+		data := bytes.Repeat([]byte{0xA5}, n)
+		padded := PadISO9797M2(data)
+		if len(padded)%16 != 0 || len(padded) <= n || padded[n] != 0x80 {
+			t.Fatalf("len %d: bad padding % X", n, padded)
+		}
+		out, err := UnpadISO9797M2(padded)
+		if err != nil || !bytes.Equal(out, data) {
+			t.Fatalf("len %d: round trip gave % X, %v", n, out, err)
+		}
+	}
+	if _, err := UnpadISO9797M2(make([]byte, 16)); err == nil {
+		t.Fatal("expected error for data without a 0x80 marker")
+	}
+}
@@ -1,5 +1,7 @@
 package ntag424
 
+import "fmt"
+
 // AuthSlotResult holds the result of an authentication attempt for diagnostics.
 type AuthSlotResult struct {
 	Slot    byte   // Key slot number
@@ -41,3 +43,60 @@ func DiagnoseAuthSlots(card Card, key []byte, slots []byte) []AuthSlotResult {
 	}
 	return results
 }
+
+// KeyProbeResult is one key tried against one slot by ProbeAllKeys.
+type KeyProbeResult struct {
+	Slot    byte   // Key slot number
+	Role    string // Slot role from the roles map, "" if not given
+	KeyName string // KeyFile.Name of the key tried
+	Success bool   // True if the key authenticated on the slot
+	Err     error  // Select or authentication error when Success is false
+}
+
+// ProbeAllKeys tries every key against every slot to find out which keys are
+// on the tag. See ProbeAllKeysWithRoles.
+func ProbeAllKeys(card Card, keys []KeyFile, slots []byte) []KeyProbeResult {
+	return ProbeAllKeysWithRoles(card, keys, slots, nil)
+}
+
+// ProbeAllKeysWithRoles tries every key against every slot, re-selecting the
+// NDEF app before each attempt. Keys are tried in order and a slot is done as
+// soon as one matches, so later keys have no result for that slot. roles, if
+// non-nil, labels the results (e.g. 0: "AppMaster").
+//
+// Attempts are sequential (PC/SC is serial). Each failed attempt counts
+// against the tag's failed-authentication counter, so keep the key list to
+// plausible candidates.
+func ProbeAllKeysWithRoles(card Card, keys []KeyFile, slots []byte, roles map[byte]string) []KeyProbeResult {
+	results := make([]KeyProbeResult, 0, len(keys)*len(slots))
+	for _, slot := range slots {
+		for _, k := range keys {
+			result := KeyProbeResult{Slot: slot, Role: roles[slot], KeyName: k.Name}
+			if err := SelectNDEFApp(card); err != nil {
+				result.Err = fmt.Errorf("select NDEF app: %w", err)
+				results = append(results, result)
+				continue
+			}
+			_, err := AuthenticateEV2First(card, k.Key, slot)
+			result.Success = err == nil
+			result.Err = err
+			results = append(results, result)
+			if result.Success {
+				break
+			}
+		}
+	}
+	return results
+}
+
+// MatchedKeys reduces ProbeAllKeys results to slot -> name of the key that
+// authenticated. Slots with no matching key are absent.
+func MatchedKeys(results []KeyProbeResult) map[byte]string {
+	matched := make(map[byte]string)
+	for _, r := range results {
+		if r.Success {
+			matched[r.Slot] = r.KeyName
+		}
+	}
+	return matched
+}
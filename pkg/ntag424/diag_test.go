@@ -0,0 +1,66 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProbeAllKeysShortCircuitsPerSlot(t *testing.T) {
+	tag := newKeyTag(t)
+	master := bytes.Repeat([]byte{0x11}, 16)
+	sdm := bytes.Repeat([]byte{0x22}, 16)
+	tag.keys[0] = master
+	tag.keys[1] = sdm
+
+	keys := []KeyFile{
+		{Name: "all-zero", Key: make([]byte, 16)},
+		{Name: "master.hex", Key: master},
+		{Name: "sdm.hex", Key: sdm},
+	}
+	roles := map[byte]string{0: "AppMaster", 1: "SDM"}
+	results := ProbeAllKeysWithRoles(tag, keys, []byte{0, 1, 2}, roles)
+
+	type attempt struct {
+		slot byte
+		name string
+		ok   bool
+	}
+	want := []attempt{
+		{0, "all-zero", false}, {0, "master.hex", true},
+		{1, "all-zero", false}, {1, "master.hex", false}, {1, "sdm.hex", true},
+		{2, "all-zero", true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d attempts, got %d: %+v", len(want), len(results), results)
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Slot != w.slot || r.KeyName != w.name || r.Success != w.ok {
+			t.Fatalf("attempt %d: expected %+v, got %+v", i, w, r)
+		}
+		if r.Role != roles[r.Slot] {
+			t.Fatalf("attempt %d: expected role %q, got %q", i, roles[r.Slot], r.Role)
+		}
+		if !r.Success && r.Err == nil {
+			t.Fatalf("attempt %d: expected error for failed probe", i)
+		}
+	}
+
+	matched := MatchedKeys(results)
+	if len(matched) != 3 || matched[0] != "master.hex" || matched[1] != "sdm.hex" || matched[2] != "all-zero" {
+		t.Fatalf("unexpected matched keys %v", matched)
+	}
+}
+
+func TestProbeAllKeysSelectsBeforeEachAttempt(t *testing.T) {
+	tag := newKeyTag(t)
+	keys := []KeyFile{{Name: "a", Key: bytes.Repeat([]byte{0x01}, 16)}, {Name: "b", Key: bytes.Repeat([]byte{0x02}, 16)}}
+
+	results := ProbeAllKeys(tag, keys, []byte{3})
+	if len(results) != 2 || results[0].Success || results[1].Success {
+		t.Fatalf("expected two failed attempts, got %+v", results)
+	}
+	if n := bytes.Count(tag.ins, []byte{0xA4}); n != 2 {
+		t.Fatalf("expected a select before each attempt, got %d selects in % X", n, tag.ins)
+	}
+}
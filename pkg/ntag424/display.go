@@ -6,9 +6,9 @@ import "fmt"
 // From update/internal/ntag/types.go:45-54.
 func accessLabel(keyNo byte) string {
 	switch keyNo {
-	case 0x0E:
+	case ARFree:
 		return "free            (no key needed)"
-	case 0x0F:
+	case ARDenied:
 		return "denied          (never)"
 	default:
 		return fmt.Sprintf("Key slot %d", keyNo)
@@ -23,17 +23,13 @@ func accessLabel(keyNo byte) string {
 //   - fileNo: File number (0x01, 0x02, 0x03)
 //   - fs: FileSettings structure
 func PrintFileSettings(label string, fileNo byte, fs *FileSettings) {
-	// Extract access rights from AR1/AR2
-	readKey := (fs.AR2 >> 4) & 0x0F   // AR2 upper = Read
-	writeKey := fs.AR2 & 0x0F          // AR2 lower = Write
-	rwKey := (fs.AR1 >> 4) & 0x0F      // AR1 upper = ReadWrite
-	changeKey := fs.AR1 & 0x0F         // AR1 lower = ChangeAccessRights
+	ar := fs.AccessRights()
 
 	fmt.Printf("  %s - File %d access rights:    [raw: %02X %02X]\n", label, fileNo, fs.AR1, fs.AR2)
-	fmt.Printf("    Read data:        %s\n", accessLabel(readKey))
-	fmt.Printf("    Write data:       %s\n", accessLabel(writeKey))
-	fmt.Printf("    Read+Write:       %s\n", accessLabel(rwKey))
-	fmt.Printf("    Change settings:  %s\n", accessLabel(changeKey))
+	fmt.Printf("    Read data:        %s\n", accessLabel(ar.Read))
+	fmt.Printf("    Write data:       %s\n", accessLabel(ar.Write))
+	fmt.Printf("    Read+Write:       %s\n", accessLabel(ar.ReadWrite))
+	fmt.Printf("    Change settings:  %s\n", accessLabel(ar.ChangeAccessRights))
 
 	// Print SDM configuration if enabled
 	if (fs.FileOption & 0x40) != 0 {
@@ -0,0 +1,64 @@
+package ntag424
+
+import (
+	"crypto/aes"
+	"fmt"
+)
+
+// maxDivInputLen is the longest diversification input AN10922 allows for
+// AES-128: the 0x01 constant plus M must fit in two cipher blocks.
+const maxDivInputLen = 31
+
+// DiversifyKeyAES128 derives a per-tag AES-128 key from masterKey using the
+// CMAC-based diversification described in NXP AN10922 section 2.2.
+//
+// The CMAC input is 0x01 || divInput, always padded to 32 bytes: when the
+// input is shorter it gets ISO 9797-1 method 2 padding and the last block is
+// masked with subkey K2, otherwise with K1. divInput must be 1-31 bytes.
+func DiversifyKeyAES128(masterKey, divInput []byte) ([]byte, error) {
+	if len(masterKey) != 16 {
+		return nil, fmt.Errorf("diversify: master key must be 16 bytes, got %d", len(masterKey))
+	}
+	if len(divInput) == 0 || len(divInput) > maxDivInputLen {
+		return nil, fmt.Errorf("diversify: input must be 1-%d bytes, got %d", maxDivInputLen, len(divInput))
+	}
+
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	ck := newCMACKeyFromBlock(block)
+
+	d := make([]byte, 32)
+	d[0] = 0x01
+	copy(d[1:], divInput)
+	subkey := ck.k1
+	if n := 1 + len(divInput); n < len(d) {
+		d[n] = 0x80
+		subkey = ck.k2
+	}
+	xorBlock(d[16:], d[16:], subkey)
+
+	x := make([]byte, 16)
+	block.Encrypt(x, d[:16])
+	xorBlock(x, x, d[16:])
+	block.Encrypt(x, x)
+	return x, nil
+}
+
+// DiversifyForTag derives the key for slot keyNo of one tag. The
+// diversification input is UID || AID || keyNo, so every tag and every key
+// slot on a tag gets a distinct key from the same master key.
+//
+// For NTAG 424 DNA the AID is normally the NDEF application DF name
+// (D2760000850101) and the UID is the 7-byte UID from GetUID.
+func DiversifyForTag(masterKey, uid, aid []byte, keyNo byte) ([]byte, error) {
+	if len(uid) == 0 {
+		return nil, fmt.Errorf("diversify: UID is empty")
+	}
+	divInput := make([]byte, 0, len(uid)+len(aid)+1)
+	divInput = append(divInput, uid...)
+	divInput = append(divInput, aid...)
+	divInput = append(divInput, keyNo)
+	return DiversifyKeyAES128(masterKey, divInput)
+}
@@ -0,0 +1,90 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestDiversifyKeyAES128AN10922Example(t *testing.T) {
+	// AN10922 section 2.2.1: UID 04782E21801D80, AID 3042F5,
+	// system identifier "NXP Abu".
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	m := mustHex(t, "04782E21801D803042F54E585020416275")
+	want := mustHex(t, "A8DD63A3B89D54B37CA802473FDA9175")
+
+	got, err := DiversifyKeyAES128(master, m)
+	if err != nil {
+		t.Fatalf("DiversifyKeyAES128 returned error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+}
+
+func TestDiversifyKeyAES128FullBlockUsesK1(t *testing.T) {
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	m := bytes.Repeat([]byte{0x5A}, maxDivInputLen)
+
+	got, err := DiversifyKeyAES128(master, m)
+	if err != nil {
+		t.Fatalf("DiversifyKeyAES128 returned error: %v", err)
+	}
+	// With exactly 32 bytes of input there is no padding, so the result is
+	// a plain CMAC over 0x01 || M.
+	want, err := AESCMAC(master, append([]byte{0x01}, m...))
+	if err != nil {
+		t.Fatalf("AESCMAC returned error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+}
+
+func TestDiversifyKeyAES128RejectsBadInput(t *testing.T) {
+	master := make([]byte, 16)
+	if _, err := DiversifyKeyAES128(master[:8], []byte{1}); err == nil {
+		t.Fatalf("expected error for short master key")
+	}
+	if _, err := DiversifyKeyAES128(master, nil); err == nil {
+		t.Fatalf("expected error for empty input")
+	}
+	if _, err := DiversifyKeyAES128(master, make([]byte, maxDivInputLen+1)); err == nil {
+		t.Fatalf("expected error for 32-byte input")
+	}
+}
+
+func TestDiversifyForTagSeparatesSlots(t *testing.T) {
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	aid := mustHex(t, ndefAppAID)
+
+	k0, err := DiversifyForTag(master, testUID, aid, 0)
+	if err != nil {
+		t.Fatalf("DiversifyForTag returned error: %v", err)
+	}
+	k1, err := DiversifyForTag(master, testUID, aid, 1)
+	if err != nil {
+		t.Fatalf("DiversifyForTag returned error: %v", err)
+	}
+	if bytes.Equal(k0, k1) {
+		t.Fatalf("expected distinct keys per slot")
+	}
+
+	divInput := append(append(append([]byte{}, testUID...), aid...), 0x01)
+	want, err := DiversifyKeyAES128(master, divInput)
+	if err != nil {
+		t.Fatalf("DiversifyKeyAES128 returned error: %v", err)
+	}
+	if !bytes.Equal(k1, want) {
+		t.Fatalf("expected UID||AID||keyNo input, got % X want % X", k1, want)
+	}
+}
@@ -3,14 +3,40 @@ Package ntag424 provides a unified library for communicating with NXP NTAG 424 D
 
 This package consolidates the core functionality previously duplicated across five tools
 (ro, update, newekey, keyswap, permissionsedit), providing:
-  - Cryptographic operations (AES-CBC, AES-CMAC, DESFire session key derivation)
+  - Cryptographic operations (AES-CBC, AES-CMAC, DESFire session key derivation);
+    AESCMAC, TruncateOddBytes and PadISO9797M2/UnpadISO9797M2 are exported so
+    backend SDM verification can use the same primitives as the tag code
   - EV2First authentication with session management
-  - Secure messaging (BuildSsmApdu, SsmCmdFull)
+  - Secure messaging (BuildSsmApdu, SsmCmdFull, SsmCmdMAC)
+  - Transaction commit/abort for DESFire backup data files (CommitTransaction, AbortTransaction)
+  - PICC-wide mirror byte via SetConfiguration (ConfigureMirror), for parts
+    that document one; NTAG 424 DNA mirrors per file with SDM instead
   - File settings read/modify (GetFileSettings, ChangeFileSettings)
-  - Read operations (ISO READ BINARY, DESFire ReadData, NDEF reads)
-  - Key management (loading, changing keys with CRC32 versioning)
-  - SDM (Secure Dynamic Messaging) configuration and verification
-  - PC/SC card connection wrapper
+  - Read operations (ISO READ BINARY, DESFire ReadData, NDEF reads, and
+    NDEFReader streaming a large NDEF message chunk by chunk)
+  - Key management (loading, changing keys with CRC32 versioning); a
+    KeyProvider supplies the keys to provision per slot, either loaded
+    (StaticKeyProvider) or derived from the UID (DiversifiedKeyProvider)
+  - SDM (Secure Dynamic Messaging) configuration and verification, including
+    encrypted PICC data (GenerateSDMURLEncryptedPICC, VerifySDMMACEncryptedPICC,
+    VerifySDMMACEncryptedPICCDetailed);
+    VerifySDM reports server-side outcomes as reason codes, with optional
+    replay rejection against a last-seen counter or a CounterTracker that
+    keeps the high-water mark per UID
+  - PC/SC card connection wrapper (Connect), and HTTPRelayCard for driving a
+    tag held by a phone or other relay over HTTP; anything with
+    Transmit([]byte) ([]byte, error) is a Card
+  - Real UID lookup on random-ID tags (GetCardUID, RealUID)
+  - Proprietary file 3 records: a version byte plus TLV fields
+    (ParseProprietaryData), decoded for display through ProprietaryDecoder
+  - Provisioning profiles (ProvisioningProfile) bundling the SDM file's
+    access rights, comm mode and SDM options
+  - Tag inspection (Inspect) classifying key slots as default/provisioned/unknown,
+    and DiffTags (DiffTagsWithConfig for custom SDM parameter names) listing
+    configuration differences between two reports
+  - APDU tracing to a file with key material redacted (EnableAPDUTrace)
+  - Offline testing: FakeCard scripts APDU responses, RecordingCard captures
+    transcripts from a real card for replay (ReadTranscript)
 
 # Access Rights Encoding
 
@@ -80,7 +106,9 @@ MAC mode (CommMode=MAC):
 	Command:  90 F5 00 00 <Lc> <fileNo> <MAC(8)> 00
 	Response: <data> <MAC(8)> | SW
 
-	Data is cleartext but MACed for integrity.
+	Data is cleartext but MACed for integrity. GetFileSettings itself is a
+	MAC-mode command, so GetFileSettings and GetFileSettingsSecure use
+	SsmCmdMAC after authentication.
 
 Full mode (CommMode=Full, after EV2First auth):
 
@@ -89,6 +117,10 @@ Full mode (CommMode=Full, after EV2First auth):
 
 	Data encrypted with session Kenc, MACed with Kmac.
 
+A 16-byte MAC-mode response looks exactly like one block of ciphertext, so
+the mode cannot be inferred from the response length. SsmCmd takes the comm
+mode explicitly; SsmCmdFull is SsmCmd with CommModeFull.
+
 Response fields (when SDM disabled, 7 bytes):
 
 	[0]   FileType    0x00=standard data
@@ -103,6 +135,10 @@ Additional fields (when SDM enabled, 10+ bytes):
 	[8:9] SDMAR       little-endian uint16: [Meta(15:12)|File(11:8)|RFU(7:4)|Ctr(3:0)]
 	[10+] Offsets     conditional 3-byte LE offsets (UID, Ctr, MACInput, MAC, ENC)
 
+When SDMMeta is a key the UID/Ctr offsets are replaced by a single
+PICCDataOffset. ParseFileSettings stores it in UIDOffset; ParseFileSettingsSDM
+and GetFileSettingsSDM keep it in FileSettings.PICCDataOffset.
+
 Fail states:
 
 	SW=917E  Le wrong (use Le=0x00), or file doesn't exist
@@ -151,6 +187,8 @@ Response:
 
 Chunking: Max 255 bytes per read. Loop with increasing offset.
 NDEF format: First 2 bytes = NLEN (big-endian length), then NDEF message.
+Files written by other toolchains may wrap the message in an NDEF Message TLV
+instead; ReadNDEFWithLayout and WriteNDEFMessageWithLayout take an NDEFLayout.
 
 Fail states:
 
@@ -190,6 +228,9 @@ Fail states:
 	SW=91AE  Auth error (wrong CAR key)
 	SW=6982  Security not satisfied
 
+ChangeFileSettingsSDM and ChangeFileSettingsSDMFull run FileSettings.Validate
+first, which reports most 917E/919E causes by field name without a round trip.
+
 # Operation: AuthenticateEV2First (INS 0x71 + 0xAF)
 
 Purpose: Establish encrypted session with the tag.
@@ -232,9 +273,13 @@ Always select BEFORE authenticating, or re-authenticate after selecting.
 	Bit 3:        Reserved
 	Bit 2:        Reserved
 	Bit 1:        Reserved
-	Bit 0 (0x01): Tag tamper status enabled
+	Bit 0 (0x01): ASCII mirror encoding (clear = binary, see SDMEncoding)
 
-Common value: 0xC1 = UID mirror + Counter mirror + Tag tamper
+Common value: 0xC1 = UID mirror + Counter mirror + ASCII encoding
+
+Binary mirrors hold the raw UID, LSB-first counter and MAC bytes, and the
+SDM MAC covers those raw bytes. Set SDMParamConfig.Encoding to
+SDMEncodingBinary to generate or verify URLs carrying their hex forms.
 
 # Communication Modes
 
@@ -276,5 +321,8 @@ Session/Crypto Errors:
 	rndA verification failed Key mismatch during EV2First. Check key file.
 	Bad padding              Decrypted response has invalid ISO 9797 M2 padding.
 	APDU data too long       Command data exceeds 255 bytes. Chunk the operation.
+
+Remediation maps an *SWError, *AuthError or session error to a one-line hint
+from this table, for tools to print next to the raw error.
 */
 package ntag424
@@ -1,6 +1,10 @@
 package ntag424
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // Status word constants for ISO 7816 and DESFire responses
 const (
@@ -73,36 +77,204 @@ func swDescription(sw uint16) string {
 	}
 }
 
+// commandNames maps DESFire/ISO INS bytes to the command names used in
+// Remediation hints.
+var commandNames = map[byte]string{
+	0x3C: "ReadSig",
+	0x3D: "WriteData",
+	0x51: "GetCardUID",
+	0x5A: "SelectApplication",
+	0x5F: "ChangeFileSettings",
+	0x60: "GetVersion",
+	0x64: "GetKeyVersion",
+	0x71: "AuthenticateEV2First",
+	0xA4: "SELECT",
+	0xAF: "AdditionalFrame",
+	0xB0: "READ BINARY",
+	0xBD: "ReadData",
+	0xCA: "GET DATA",
+	0xC4: "ChangeKey",
+	0xD6: "UPDATE BINARY",
+	0xF5: "GetFileSettings",
+	0xF6: "GetFileCounters",
+}
+
+// commandName returns the name of an INS byte, or "INS 0xNN" if unknown.
+func commandName(ins byte) string {
+	if name, ok := commandNames[ins]; ok {
+		return name
+	}
+	return fmt.Sprintf("INS 0x%02X", ins)
+}
+
+// Remediation returns an actionable hint for err, based on the fail states in
+// the package documentation, or "" if there is none. It understands
+// *SWError and *AuthError (also when wrapped) and the session/crypto errors
+// returned by the secure messaging helpers. Tools print it next to the raw
+// error.
+func Remediation(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		if hint := authRemediation(authErr); hint != "" {
+			return hint
+		}
+	}
+
+	var swErr *SWError
+	if errors.As(err, &swErr) {
+		return swRemediation(swErr)
+	}
+
+	switch {
+	case errors.Is(err, ErrResponseMAC):
+		return "response MAC mismatch: session out of sync or tampered; re-authenticate"
+	case errors.Is(err, ErrBadPadding):
+		return "bad padding: wrong session keys or corrupted response; re-authenticate"
+	case errors.Is(err, ErrNoSession):
+		return "no session: authenticate with AuthenticateEV2First first"
+	}
+	return ""
+}
+
+// authRemediation returns the hint for an EV2First failure, or "" to fall
+// back to the status word.
+func authRemediation(e *AuthError) string {
+	if e.Cause != nil && strings.Contains(e.Cause.Error(), "rndA check failed") {
+		return "rndA check failed: wrong key file for this slot"
+	}
+	switch {
+	case e.SW == SWAuthError:
+		return fmt.Sprintf("SW=91AE on auth %s: wrong key for this slot; check the key file and slot number", e.Step)
+	case e.SW == SWLengthError && e.Step == "step1":
+		return "SW=917E on auth step1: key slot does not exist; use slots 0-4"
+	case e.SW == SWPermDenied:
+		return "SW=919D on auth: the NDEF application is not selected; call SelectNDEFApp first"
+	case SwOK(e.SW) || e.SW == SWMoreData:
+		return fmt.Sprintf("auth %s: unexpected %d-byte response; the card may not be an NTAG 424 DNA", e.Step, e.RespLen)
+	}
+	return ""
+}
+
+// swRemediation returns the hint for a status word error.
+func swRemediation(e *SWError) string {
+	prefix := fmt.Sprintf("SW=%04X on %s: ", e.SW, commandName(e.Cmd))
+	switch e.SW {
+	case SWSuccess, SWDESFireOK:
+		return ""
+	case SWMoreData:
+		return prefix + "more frames pending; send 90 AF to continue"
+	case SWLengthError:
+		if e.Cmd == 0xF5 {
+			return prefix + "use Le=0x00, and check the file number"
+		}
+		return prefix + "check Le, the file number and the command data length"
+	case SWAuthError:
+		return prefix + "wrong key for this slot; re-authenticate with the right key"
+	case SWPermDenied:
+		return prefix + "authenticated with a key that lacks the access right; check the file's access rights"
+	case SWParameterErr:
+		if e.Cmd == 0x5F {
+			return prefix + "invalid file settings; check SDMOptions, SDMAR and offsets with FileSettings.Validate"
+		}
+		return prefix + "invalid command parameters"
+	case SWBoundaryError:
+		return prefix + "offset+length is past the end of the file; treat as empty or read less"
+	case SWNoChanges:
+		return prefix + "settings already match; nothing to do"
+	case SWCommandAbort:
+		return prefix + "command aborted; re-select the application, re-authenticate and retry"
+	case SWSecurityNotSatisfied:
+		return prefix + "authentication required; authenticate with the key for this access right"
+	case SWFileNotFound:
+		return prefix + "file not found; select the NDEF application and check the file ID"
+	case SWWrongP1P2:
+		return prefix + "wrong P1/P2; check the offset or selection parameters"
+	case SWWrongLength:
+		return prefix + "wrong Lc/Le; check the APDU length"
+	}
+	if (e.SW & 0xFF00) == SWWrongLe {
+		return prefix + fmt.Sprintf("retry with Le=0x%02X", e.SW&0xFF)
+	}
+	return prefix + "unknown status word"
+}
+
+// NDEFMismatchError reports that the NDEF message read back after a write
+// differs from the one written.
+type NDEFMismatchError struct {
+	Offset int // First differing byte in the message (after NLEN)
+	Wrote  int // Message length written
+	Read   int // Message length read back
+}
+
+func (e *NDEFMismatchError) Error() string {
+	return fmt.Sprintf("NDEF verify failed: read back %d bytes, wrote %d, first difference at message offset %d", e.Read, e.Wrote, e.Offset)
+}
+
+func newNDEFMismatchError(wrote, read []byte) *NDEFMismatchError {
+	i := 0
+	for i < len(wrote) && i < len(read) && wrote[i] == read[i] {
+		i++
+	}
+	return &NDEFMismatchError{Offset: i, Wrote: len(wrote), Read: len(read)}
+}
+
+// PartialWriteError reports that a chunked write stopped partway. Written
+// bytes of the data (from its start, not the file offset) reached the tag
+// and can be skipped when the write is resumed.
+type PartialWriteError struct {
+	Written int   // Bytes of the data acknowledged by the tag
+	Err     error // Why the write stopped
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("write stopped after %d bytes: %v", e.Written, e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error { return e.Err }
+
 // IsLengthError checks if an error is a length-related status word error.
+// Wrapped errors are unwrapped, as for all the Is* predicates.
 func IsLengthError(err error) bool {
-	if swErr, ok := err.(*SWError); ok {
-		return swErr.SW == SWLengthError || swErr.SW == SWWrongLength || (swErr.SW&0xFF00) == SWWrongLe
-	}
-	return false
+	var swErr *SWError
+	return errors.As(err, &swErr) &&
+		(swErr.SW == SWLengthError || swErr.SW == SWWrongLength || (swErr.SW&0xFF00) == SWWrongLe)
 }
 
-// IsAuthError checks if an error is an authentication-related status word error.
+// IsAuthError checks if an error is an authentication-related status word
+// error, from any command or from AuthenticateEV2First itself (*AuthError).
 func IsAuthError(err error) bool {
-	if swErr, ok := err.(*SWError); ok {
+	var swErr *SWError
+	if errors.As(err, &swErr) {
 		return swErr.SW == SWAuthError || swErr.SW == SWSecurityNotSatisfied
 	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr.SW == SWAuthError || authErr.SW == SWSecurityNotSatisfied
+	}
 	return false
 }
 
 // IsBoundaryError checks if an error is a boundary error (read past file end).
 func IsBoundaryError(err error) bool {
-	if swErr, ok := err.(*SWError); ok {
-		return swErr.SW == SWBoundaryError
-	}
-	return false
+	var swErr *SWError
+	return errors.As(err, &swErr) && swErr.SW == SWBoundaryError
+}
+
+// IsNoChanges checks if an error is SW=9140 (no changes), which
+// ChangeFileSettings returns when the new settings equal the current ones.
+func IsNoChanges(err error) bool {
+	var swErr *SWError
+	return errors.As(err, &swErr) && swErr.SW == SWNoChanges
 }
 
 // IsPermissionDenied checks if an error is a permission denied error.
 func IsPermissionDenied(err error) bool {
-	if swErr, ok := err.(*SWError); ok {
-		return swErr.SW == SWPermDenied
-	}
-	return false
+	var swErr *SWError
+	return errors.As(err, &swErr) && swErr.SW == SWPermDenied
 }
 
 // SwOK checks if a status word indicates success (ISO 9000 or DESFire 9100).
@@ -0,0 +1,150 @@
+package ntag424
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRemediationCoversEverySW(t *testing.T) {
+	tests := []struct {
+		sw   uint16
+		cmd  byte
+		want string // substring of the hint; "" means no hint
+	}{
+		{SWSuccess, 0xB0, ""},
+		{SWDESFireOK, 0xBD, ""},
+		{SWSecurityNotSatisfied, 0xB0, "authentication required"},
+		{SWFileNotFound, 0xA4, "file not found"},
+		{SWWrongP1P2, 0xB0, "wrong P1/P2"},
+		{SWWrongLength, 0xD6, "wrong Lc/Le"},
+		{SWWrongLe | 0x0F, 0xB0, "Le=0x0F"},
+		{SWMoreData, 0x71, "90 AF"},
+		{SWLengthError, 0xF5, "SW=917E on GetFileSettings: use Le=0x00"},
+		{SWLengthError, 0xBD, "file number"},
+		{SWAuthError, 0xC4, "wrong key"},
+		{SWPermDenied, 0x3D, "access right"},
+		{SWParameterErr, 0x5F, "FileSettings.Validate"},
+		{SWParameterErr, 0xC4, "invalid command parameters"},
+		{SWBoundaryError, 0xBD, "past the end of the file"},
+		{SWNoChanges, 0x5F, "already match"},
+		{SWCommandAbort, 0x3D, "re-authenticate"},
+		{0x91EE, 0x99, "SW=91EE on INS 0x99: unknown"},
+	}
+	for _, tc := range tests {
+		got := Remediation(&SWError{Cmd: tc.cmd, SW: tc.sw})
+		if tc.want == "" {
+			if got != "" {
+				t.Fatalf("SW=%04X: expected no hint, got %q", tc.sw, got)
+			}
+			continue
+		}
+		if !strings.Contains(got, tc.want) {
+			t.Fatalf("SW=%04X cmd=%02X: expected hint containing %q, got %q", tc.sw, tc.cmd, tc.want, got)
+		}
+	}
+}
+
+func TestRemediationAuthAndWrapped(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&AuthError{Step: "step2", Cause: errors.New("rndA check failed")}, "rndA check failed: wrong key file for this slot"},
+		{&AuthError{Step: "step2", SW: SWAuthError}, "wrong key for this slot"},
+		{&AuthError{Step: "step1", SW: SWLengthError}, "slot does not exist"},
+		{&AuthError{Step: "step1", SW: SWMoreData, RespLen: 8}, "unexpected 8-byte response"},
+		{fmt.Errorf("read file 2: %w", &SWError{Cmd: 0xBD, SW: SWBoundaryError}), "SW=911C on ReadData"},
+		{fmt.Errorf("read file 3: %w", ErrResponseMAC), "session out of sync"},
+		{fmt.Errorf("read file 3: %w", ErrBadPadding), "wrong session keys"},
+		{ErrNoSession, "AuthenticateEV2First"},
+	}
+	for _, tc := range tests {
+		if got := Remediation(tc.err); !strings.Contains(got, tc.want) {
+			t.Fatalf("%v: expected hint containing %q, got %q", tc.err, tc.want, got)
+		}
+	}
+
+	if got := Remediation(nil); got != "" {
+		t.Fatalf("expected no hint for nil, got %q", got)
+	}
+	if got := Remediation(errors.New("something else")); got != "" {
+		t.Fatalf("expected no hint for an unknown error, got %q", got)
+	}
+}
+
+// swCard answers the first len(ok) APDUs with ok and everything after with sw.
+func swCard(sw uint16, ok ...[]byte) Card {
+	n := 0
+	return apduFunc(func(apdu []byte) ([]byte, error) {
+		n++
+		if n <= len(ok) {
+			return ok[n-1], nil
+		}
+		return []byte{byte(sw >> 8), byte(sw)}, nil
+	})
+}
+
+func TestCommandErrorsCarrySW(t *testing.T) {
+	versionPart := append(make([]byte, 7), 0x91, 0xAF)
+	tests := []struct {
+		name string
+		run  func(Card) error
+		cmd  byte
+	}{
+		{"GetVersion part 1", func(c Card) error { _, err := GetVersion(c); return err }, 0x60},
+		{"GetVersion part 3", func(c Card) error { _, err := GetVersion(c); return err }, 0xAF},
+		{"GetUID", func(c Card) error { _, err := GetUID(c); return err }, 0xCA},
+		{"SelectNDEFApp", SelectNDEFApp, 0xA4},
+		{"SelectFile", func(c Card) error { return SelectFile(c, 0xE104) }, 0xA4},
+		{"SelectApplicationAID", func(c Card) error { return SelectApplicationAID(c, []byte{1, 2, 3}) }, 0x5A},
+		{"ReadBinary", func(c Card) error { _, err := ReadBinary(c, 0, 2); return err }, 0xB0},
+		{"ReadFileDataPlain", func(c Card) error { _, err := ReadFileDataPlain(c, 2, 0, 4); return err }, 0xBD},
+		{"WriteFileDataPlain", func(c Card) error { return WriteFileDataPlain(c, 2, 0, []byte{1}) }, 0x3D},
+		{"WriteNDEFData", func(c Card) error { return WriteNDEFData(c, []byte{1}) }, 0xD6},
+		{"GetFileSettingsPlain", func(c Card) error { _, err := GetFileSettingsPlain(c, 2); return err }, 0xF5},
+		{"GetKeyVersion", func(c Card) error { _, err := GetKeyVersion(c, nil, 0); return err }, 0x64},
+		{"GetFileCounters", func(c Card) error { _, err := GetFileCounters(c, nil, 2); return err }, 0xF6},
+		{"ReadSignature", func(c Card) error { _, err := ReadSignature(c); return err }, 0x3C},
+		{"SsmCmdFull", func(c Card) error { _, err := SsmCmdFull(c, testSession(), 0x51, nil, nil); return err }, 0x51},
+	}
+	for _, tt := range tests {
+		card := swCard(SWPermDenied)
+		if tt.name == "GetVersion part 3" {
+			card = swCard(SWPermDenied, versionPart, versionPart)
+		}
+		err := tt.run(card)
+		var swErr *SWError
+		if !errors.As(err, &swErr) {
+			t.Errorf("%s: expected a *SWError, got %v", tt.name, err)
+			continue
+		}
+		if swErr.Cmd != tt.cmd || swErr.SW != SWPermDenied {
+			t.Errorf("%s: expected INS 0x%02X SW=919D, got %+v", tt.name, tt.cmd, swErr)
+		}
+		if !IsPermissionDenied(err) {
+			t.Errorf("%s: IsPermissionDenied is false for %v", tt.name, err)
+		}
+	}
+}
+
+func TestSWPredicatesUnwrap(t *testing.T) {
+	wrap := func(sw uint16) error { return fmt.Errorf("read file 3: %w", &SWError{Cmd: 0xBD, SW: sw}) }
+	if !IsBoundaryError(wrap(SWBoundaryError)) || !IsLengthError(wrap(SWLengthError)) ||
+		!IsAuthError(wrap(SWAuthError)) || !IsPermissionDenied(wrap(SWPermDenied)) || !IsNoChanges(wrap(SWNoChanges)) {
+		t.Fatal("expected predicates to see through wrapping")
+	}
+	if !IsAuthError(&AuthError{Step: "step2", SW: SWAuthError}) {
+		t.Fatal("expected IsAuthError for a wrong-key AuthenticateEV2First")
+	}
+	if IsAuthError(&AuthError{Step: "step1", SW: SWLengthError}) || IsBoundaryError(errors.New("SW=911C")) {
+		t.Fatal("expected no match for other SWs or untyped errors")
+	}
+
+	// ReadFileDataSecure treats the typed boundary error as an empty read.
+	data, err := ReadFileDataSecure(swCard(SWBoundaryError), testSession(), 0x03, 0, 16)
+	if err != nil || len(data) != 0 {
+		t.Fatalf("expected empty read on SW=911C, got % X, %v", data, err)
+	}
+}
@@ -0,0 +1,150 @@
+package ntag424
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FakeExchange is one scripted command/response pair for FakeCard.
+type FakeExchange struct {
+	Command  []byte // Expected APDU; nil accepts any APDU
+	Response []byte // Response data followed by SW1 SW2
+	Err      error  // Returned instead of Response when non-nil
+}
+
+// FakeCard is a Card that answers APDUs from a fixed script, in order.
+// Every APDU it receives is kept in Sent so tests can inspect commands whose
+// contents are not known up front (e.g. anything encrypted under a random
+// RndA).
+//
+// A command that does not match the next scripted exchange, or any command
+// after the script is exhausted, fails with an error rather than a status
+// word, so a test cannot silently drift out of step with the script.
+type FakeCard struct {
+	Script []FakeExchange
+	Sent   [][]byte
+	next   int
+}
+
+// NewFakeCard returns a FakeCard that plays script.
+func NewFakeCard(script ...FakeExchange) *FakeCard {
+	return &FakeCard{Script: script}
+}
+
+// Transmit implements Card.
+func (f *FakeCard) Transmit(apdu []byte) ([]byte, error) {
+	f.Sent = append(f.Sent, append([]byte(nil), apdu...))
+	if f.next >= len(f.Script) {
+		return nil, fmt.Errorf("fake card: unexpected APDU %X after %d scripted exchanges", apdu, len(f.Script))
+	}
+	ex := f.Script[f.next]
+	f.next++
+	if ex.Command != nil && !bytes.Equal(ex.Command, apdu) {
+		return nil, fmt.Errorf("fake card: exchange %d: expected APDU %X, got %X", f.next, ex.Command, apdu)
+	}
+	if ex.Err != nil {
+		return nil, ex.Err
+	}
+	return append([]byte(nil), ex.Response...), nil
+}
+
+// Done returns an error if scripted exchanges were left unused.
+func (f *FakeCard) Done() error {
+	if f.next < len(f.Script) {
+		return fmt.Errorf("fake card: %d of %d scripted exchanges unused", len(f.Script)-f.next, len(f.Script))
+	}
+	return nil
+}
+
+// RecordingCard wraps a Card and writes every exchange to a transcript that
+// ReadTranscript can turn back into a FakeCard script:
+//
+//	> 00A4040007D276000085010100
+//	< 9000
+//	! transmit failed: card removed
+//
+// Lines starting with '>' are commands, '<' responses and '!' transmit
+// errors. Blank lines and lines starting with '#' are ignored.
+//
+// Replay compares commands byte for byte. Secure messaging after
+// AuthenticateEV2First depends on the random RndA, so clear Command on those
+// exchanges (or script the session keys) before replaying them.
+type RecordingCard struct {
+	card Card
+	w    io.Writer
+}
+
+// NewRecordingCard returns a Card that forwards to card and logs to w.
+func NewRecordingCard(card Card, w io.Writer) *RecordingCard {
+	return &RecordingCard{card: card, w: w}
+}
+
+// Transmit implements Card. Failing to write the transcript is reported as
+// a transmit error so a recording is never silently incomplete.
+func (r *RecordingCard) Transmit(apdu []byte) ([]byte, error) {
+	resp, err := r.card.Transmit(apdu)
+	line := fmt.Sprintf("> %X\n< %X\n", apdu, resp)
+	if err != nil {
+		line = fmt.Sprintf("> %X\n! %s\n", apdu, strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	if _, werr := io.WriteString(r.w, line); werr != nil {
+		return nil, fmt.Errorf("recording card: write transcript: %w", werr)
+	}
+	return resp, err
+}
+
+// ReadTranscript parses a RecordingCard transcript into a FakeCard script.
+func ReadTranscript(r io.Reader) ([]FakeExchange, error) {
+	var script []FakeExchange
+	var cmd []byte
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		kind, value := line[0], strings.TrimSpace(line[1:])
+
+		switch kind {
+		case '>':
+			if cmd != nil {
+				return nil, fmt.Errorf("transcript line %d: command without response", lineNo)
+			}
+			b, err := hex.DecodeString(value)
+			if err != nil || len(b) == 0 {
+				return nil, fmt.Errorf("transcript line %d: bad command %q", lineNo, value)
+			}
+			cmd = b
+		case '<', '!':
+			if cmd == nil {
+				return nil, fmt.Errorf("transcript line %d: response without command", lineNo)
+			}
+			ex := FakeExchange{Command: cmd}
+			if kind == '!' {
+				ex.Err = errors.New(value)
+			} else {
+				b, err := hex.DecodeString(value)
+				if err != nil {
+					return nil, fmt.Errorf("transcript line %d: bad response %q", lineNo, value)
+				}
+				ex.Response = b
+			}
+			script = append(script, ex)
+			cmd = nil
+		default:
+			return nil, fmt.Errorf("transcript line %d: unknown line type %q", lineNo, kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cmd != nil {
+		return nil, fmt.Errorf("transcript ends with command %X without response", cmd)
+	}
+	return script, nil
+}
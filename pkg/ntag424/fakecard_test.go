@@ -0,0 +1,325 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeRndA is set as NTAG_RNDA by tests that script authentication. It makes
+// AuthenticateEV2First deterministic, so the tag side (keyTag's RndB and TI)
+// can be scripted with exact commands.
+const fakeRndA = "A0A1A2A3A4A5A6A7A8A9AAABACADAEAF"
+
+var selectNDEFAppExchange = FakeExchange{
+	Command:  []byte{0x00, 0xA4, 0x04, 0x00, 0x07, 0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01, 0x00},
+	Response: []byte{0x90, 0x00},
+}
+
+// authExchanges scripts AuthenticateEV2First with tryKey against a slot that
+// holds cardKey. A mismatch is refused with 91AE after part 2; a match
+// returns the tag's view of the new session.
+func authExchanges(t *testing.T, slot byte, cardKey, tryKey []byte) ([]FakeExchange, *Session) {
+	t.Helper()
+	iv0 := make([]byte, 16)
+	encRndB, err := aesCBCEncrypt(cardKey, iv0, keyTagRndB)
+	if err != nil {
+		t.Fatalf("encrypt RndB: %v", err)
+	}
+	part1 := FakeExchange{
+		Command:  []byte{0x90, 0x71, 0x00, 0x00, 0x02, slot, 0x00, 0x00},
+		Response: append(encRndB, 0x91, 0xAF),
+	}
+	if !bytes.Equal(cardKey, tryKey) {
+		return []FakeExchange{part1, {Response: []byte{0x91, 0xAE}}}, nil
+	}
+
+	rndA := mustHex(t, fakeRndA)
+	encAB, err := aesCBCEncrypt(cardKey, iv0, append(append([]byte{}, rndA...), rotateLeft1(keyTagRndB)...))
+	if err != nil {
+		t.Fatalf("encrypt RndA||RndB': %v", err)
+	}
+	ti := []byte{0x9D, 0x00, 0xC4, 0xDF}
+	plain := append(append(append([]byte{}, ti...), rotateLeft1(rndA)...), make([]byte, 12)...)
+	encResp, err := aesCBCEncrypt(cardKey, iv0, plain)
+	if err != nil {
+		t.Fatalf("encrypt part 2 response: %v", err)
+	}
+	part2 := FakeExchange{
+		Command:  append(append([]byte{0x90, 0xAF, 0x00, 0x00, 0x20}, encAB...), 0x00),
+		Response: append(encResp, 0x91, 0x00),
+	}
+
+	kenc, kmac, err := deriveSessionKeys(cardKey, rndA, keyTagRndB)
+	if err != nil {
+		t.Fatalf("derive session keys: %v", err)
+	}
+	sess := &Session{}
+	copy(sess.ti[:], ti)
+	copy(sess.kenc[:], kenc)
+	copy(sess.kmac[:], kmac)
+	return []FakeExchange{part1, part2}, sess
+}
+
+// probeExchanges scripts ProbeAllKeys over slots 0-4: each candidate is tried
+// in order after an app select until one matches the slot's key.
+func probeExchanges(t *testing.T, slotKeys [5][]byte, candidates [][]byte) []FakeExchange {
+	t.Helper()
+	var script []FakeExchange
+	for slot, cardKey := range slotKeys {
+		for _, k := range candidates {
+			auth, sess := authExchanges(t, byte(slot), cardKey, k)
+			script = append(script, selectNDEFAppExchange)
+			script = append(script, auth...)
+			if sess != nil {
+				break
+			}
+		}
+	}
+	return script
+}
+
+// readNDEFExchanges scripts ReadNDEF of msg (NLEN||message) from an ISO NDEF
+// file of 256 bytes; an empty msg reads NLEN 0.
+func readNDEFExchanges(t *testing.T, msg []byte) []FakeExchange {
+	script := []FakeExchange{
+		selectNDEFAppExchange,
+		{Command: mustHex(t, "00A4000C02E103"), Response: []byte{0x90, 0x00}},
+		{Command: mustHex(t, "00B000000F"), Response: mustHex(t, "000F20007F007F0406E104010000009000")},
+		{Command: mustHex(t, "00A4000C02E104"), Response: []byte{0x90, 0x00}},
+	}
+	if len(msg) == 0 {
+		return append(script, FakeExchange{Command: mustHex(t, "00B0000002"), Response: []byte{0x00, 0x00, 0x90, 0x00}})
+	}
+	script = append(script, FakeExchange{Command: mustHex(t, "00B0000002"), Response: append(append([]byte{}, msg[:2]...), 0x90, 0x00)})
+	body := msg[2:]
+	return append(script, FakeExchange{
+		Command:  []byte{0x00, 0xB0, 0x00, 0x02, byte(len(body))},
+		Response: append(append([]byte{}, body...), 0x90, 0x00),
+	})
+}
+
+func TestFakeCardSsmCmdFull(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+
+	apdu, _, _, _, err := BuildSsmApdu(&tag, 0x5F, []byte{0x02}, []byte{0xAA, 0xBB})
+	if err != nil {
+		t.Fatalf("BuildSsmApdu returned error: %v", err)
+	}
+	card := NewFakeCard(FakeExchange{Command: apdu, Response: ssmResponse(t, &tag, []byte("hello"))})
+
+	out, err := SsmCmdFull(card, sess, 0x5F, []byte{0x02}, []byte{0xAA, 0xBB})
+	if err != nil {
+		t.Fatalf("SsmCmdFull returned error: %v", err)
+	}
+	if string(out) != "hello" || sess.cmdCtr != 1 {
+		t.Fatalf("expected \"hello\" with cmdCtr 1, got %q with %d", out, sess.cmdCtr)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeCardChangeKeyOtherSlot(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	oldKey := make([]byte, 16)
+	newKey := bytes.Repeat([]byte{0x3C}, 16)
+
+	card := NewFakeCard(FakeExchange{Response: ssmResponse(t, &tag, nil)})
+	if err := ChangeKey(card, sess, 0x02, newKey, oldKey, 0x01, 0x00); err != nil {
+		t.Fatalf("ChangeKey returned error: %v", err)
+	}
+
+	sent := card.Sent[0]
+	if sent[1] != 0xC4 || sent[5] != 0x02 {
+		t.Fatalf("expected ChangeKey for slot 2, got % X", sent[:6])
+	}
+	keyData := ssmDecryptCommand(t, &tag, sent, 1)
+	crc := CRC32DESFire(newKey)
+	want := append(append([]byte{}, newKey...), 0x01, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+	if !bytes.Equal(keyData, want) {
+		t.Fatalf("expected key data % X, got % X", want, keyData)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected cmdCtr 1, got %d", sess.cmdCtr)
+	}
+}
+
+func TestFakeCardGetFileSettingsFallsBackToSecure(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	denied := []byte{0x91, 0x9D}
+
+	secure, err := buildMACApdu(&tag, 0xF5, []byte{0x03}, nil)
+	if err != nil {
+		t.Fatalf("buildMACApdu returned error: %v", err)
+	}
+	settings := settingsAPDUResponse(0x03, 0x30, 0x33, 128)
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x03, 0x00}, Response: denied},
+		FakeExchange{Command: secure, Response: ssmMACResponse(t, &tag, settings[:len(settings)-2])},
+	)
+
+	fs, err := GetFileSettings(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("GetFileSettings returned error: %v", err)
+	}
+	if fs.FileOption != 0x03 || fs.AR1 != 0x30 || fs.AR2 != 0x33 || fs.Size != 128 {
+		t.Fatalf("unexpected settings %+v", fs)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeCardRejectsUnscriptedAPDUs(t *testing.T) {
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x00, 0xA4}, Response: []byte{0x90, 0x00}},
+		FakeExchange{Response: []byte{0x90, 0x00}},
+	)
+	if _, err := card.Transmit([]byte{0x00, 0xB0}); err == nil {
+		t.Fatalf("expected error for mismatched APDU")
+	}
+	if err := card.Done(); err == nil {
+		t.Fatalf("expected Done to report the unused exchange")
+	}
+	if _, err := card.Transmit([]byte{0x00, 0xB0}); err != nil {
+		t.Fatalf("expected wildcard exchange to accept any APDU, got %v", err)
+	}
+	if _, err := card.Transmit([]byte{0x00, 0xB0}); err == nil {
+		t.Fatalf("expected error once the script is exhausted")
+	}
+}
+
+func TestRecordingCardReplay(t *testing.T) {
+	live := NewFakeCard(
+		FakeExchange{Command: []byte{0xFF, 0xCA, 0x00, 0x00, 0x00}, Response: append(append([]byte{}, testUID...), 0x90, 0x00)},
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x00}, Err: errors.New("card removed")},
+	)
+	var transcript bytes.Buffer
+	rec := NewRecordingCard(live, &transcript)
+
+	uid, err := GetUID(rec)
+	if err != nil {
+		t.Fatalf("GetUID returned error: %v", err)
+	}
+	if _, err := GetFileSettingsPlain(rec, 0x02); err == nil {
+		t.Fatalf("expected recorded transmit error")
+	}
+	if !strings.Contains(transcript.String(), "! card removed") {
+		t.Fatalf("expected transmit error in transcript, got:\n%s", transcript.String())
+	}
+
+	script, err := ReadTranscript(strings.NewReader("# recorded\n\n" + transcript.String()))
+	if err != nil {
+		t.Fatalf("ReadTranscript returned error: %v", err)
+	}
+	replay := NewFakeCard(script...)
+	got, err := GetUID(replay)
+	if err != nil || !bytes.Equal(got, uid) {
+		t.Fatalf("expected replayed UID % X, got % X (err %v)", uid, got, err)
+	}
+	if _, err := GetFileSettingsPlain(replay, 0x02); err == nil || err.Error() != "card removed" {
+		t.Fatalf("expected replayed transmit error, got %v", err)
+	}
+	if err := replay.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadTranscriptRejectsMalformed(t *testing.T) {
+	cases := []string{
+		"< 9000\n",
+		"> 00A4\n> 00B0\n",
+		"> 00A4\n",
+		"> zz\n< 9000\n",
+		"? 00\n",
+	}
+	for _, c := range cases {
+		if _, err := ReadTranscript(strings.NewReader(c)); err == nil {
+			t.Fatalf("expected error for transcript %q", c)
+		}
+	}
+}
+
+func TestRealUIDPrefersGetCardUIDOverRandomID(t *testing.T) {
+	realUID := []byte{0x04, 0xA4, 0x7A, 0x8A, 0x12, 0x34, 0x56}
+	randomID := []byte{0x08, 0x11, 0x22, 0x33}
+	getData := []byte{0xFF, 0xCA, 0x00, 0x00, 0x00}
+
+	sess := testSession()
+	tag := *sess
+	apdu, _, _, _, err := BuildSsmApdu(&tag, 0x51, nil, nil)
+	if err != nil {
+		t.Fatalf("BuildSsmApdu returned error: %v", err)
+	}
+	card := NewFakeCard(FakeExchange{Command: apdu, Response: ssmResponse(t, &tag, realUID)})
+	uid, err := RealUID(card, sess)
+	if err != nil {
+		t.Fatalf("RealUID returned error: %v", err)
+	}
+	if !bytes.Equal(uid, realUID) {
+		t.Fatalf("expected real UID %X, got %X", realUID, uid)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a session a random ID must not be passed off as the UID.
+	card = NewFakeCard(FakeExchange{Command: getData, Response: append(append([]byte{}, randomID...), 0x90, 0x00)})
+	if _, err := RealUID(card, nil); err == nil || !strings.Contains(err.Error(), "random ID") {
+		t.Fatalf("expected random ID error, got %v", err)
+	}
+
+	// GetCardUID failing on a tag without random ID falls back to GET DATA.
+	card = NewFakeCard(
+		FakeExchange{Response: []byte{0x91, 0xAE}},
+		FakeExchange{Command: getData, Response: append(append([]byte{}, realUID...), 0x90, 0x00)},
+	)
+	uid, err = RealUID(card, testSession())
+	if err != nil {
+		t.Fatalf("RealUID fallback returned error: %v", err)
+	}
+	if !bytes.Equal(uid, realUID) {
+		t.Fatalf("expected GET DATA UID %X, got %X", realUID, uid)
+	}
+}
+
+func TestSsmCmdFullChainsAdditionalFrames(t *testing.T) {
+	plain := bytes.Repeat([]byte{0x3C}, 100)
+	sess := testSession()
+	tag := *sess
+
+	full := ssmResponse(t, &tag, plain) // ciphertext || MAC || 91 00
+	split := 64
+	first := append(append([]byte{}, full[:split]...), 0x91, 0xAF)
+	card := NewFakeCard(
+		FakeExchange{Response: first},
+		FakeExchange{Command: []byte{0x90, 0xAF, 0x00, 0x00, 0x00}, Response: full[split:]},
+	)
+
+	out, err := SsmCmdFull(card, sess, 0xBD, nil, []byte{0x03, 0, 0, 0, 100, 0, 0})
+	if err != nil {
+		t.Fatalf("SsmCmdFull returned error: %v", err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("expected %d decrypted bytes, got % X", len(plain), out)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected one command counted for both frames, got cmdCtr %d", sess.cmdCtr)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupted second frame fails the MAC over the concatenation.
+	bad := append([]byte{}, full[split:]...)
+	bad[0] ^= 0x01
+	card = NewFakeCard(FakeExchange{Response: first}, FakeExchange{Response: bad})
+	if _, err := SsmCmdFull(card, testSession(), 0xBD, nil, []byte{0x03, 0, 0, 0, 100, 0, 0}); err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Fatalf("expected MAC mismatch, got %v", err)
+	}
+}
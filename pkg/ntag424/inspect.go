@@ -0,0 +1,206 @@
+package ntag424
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// KeySlotState classifies a key slot for Inspect.
+type KeySlotState string
+
+const (
+	KeySlotDefault     KeySlotState = "default"     // Factory all-zero key authenticates
+	KeySlotProvisioned KeySlotState = "provisioned" // One of the supplied keys authenticates
+	KeySlotUnknown     KeySlotState = "unknown"     // Neither the zero key nor a supplied key matched
+)
+
+// FactoryKeyName is the KeyFile.Name Inspect reports for the all-zero key.
+const FactoryKeyName = "factory-default"
+
+// originalitySigLen is the length of the NXP originality signature (ECC
+// secp224r1 r||s) returned by Read_Sig.
+const originalitySigLen = 56
+
+// TagReport is the structured result of Inspect. Fields Inspect could not
+// read are left empty and the reason is recorded in Errors.
+type TagReport struct {
+	UID         []byte          `json:"uid,omitempty"`
+	Version     *TagVersion     `json:"version,omitempty"`
+	Files       []FileReport    `json:"files"`
+	KeySlots    []KeySlotReport `json:"key_slots"`
+	NDEFURL     string          `json:"ndef_url,omitempty"`
+	SDMEnabled  bool            `json:"sdm_enabled"`
+	Originality []byte          `json:"originality_signature,omitempty"` // Raw Read_Sig response, not verified
+	Errors      []string        `json:"errors,omitempty"`
+}
+
+// FileReport is the settings of one application file, or why they could not
+// be read.
+type FileReport struct {
+	FileNo   byte          `json:"file_no"`
+	Settings *FileSettings `json:"settings,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// KeySlotReport is the provisioning state of one key slot.
+type KeySlotReport struct {
+	Slot       byte         `json:"slot"`
+	State      KeySlotState `json:"state"`
+	MatchedKey string       `json:"matched_key,omitempty"` // KeyFile.Name, FactoryKeyName for the zero key
+}
+
+// MarshalJSON encodes UID and the originality signature as uppercase hex,
+// like TagVersion.
+func (r TagReport) MarshalJSON() ([]byte, error) {
+	type plain TagReport
+	return json.Marshal(struct {
+		plain
+		UID         string `json:"uid,omitempty"`
+		Originality string `json:"originality_signature,omitempty"`
+	}{
+		plain:       plain(r),
+		UID:         strings.ToUpper(hex.EncodeToString(r.UID)),
+		Originality: strings.ToUpper(hex.EncodeToString(r.Originality)),
+	})
+}
+
+func (r *TagReport) addError(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// ReadSignature reads the 56-byte NXP originality signature with Read_Sig
+// (INS 0x3C, address 0x00). Outside an authenticated session the tag returns
+// it in plain.
+//
+// The signature is an ECDSA secp224r1 signature over the UID. Checking it
+// needs NXP's originality public key, which this package does not carry.
+func ReadSignature(card Card) ([]byte, error) {
+	apdu := []byte{0x90, 0x3C, 0x00, 0x00, 0x01, 0x00, 0x00}
+	data, sw, err := Transmit(card, apdu)
+	if err != nil {
+		return nil, err
+	}
+	if !SwOK(sw) {
+		return nil, &SWError{Cmd: 0x3C, SW: sw}
+	}
+	if len(data) != originalitySigLen {
+		return nil, fmt.Errorf("originality signature: expected %d bytes, got %d", originalitySigLen, len(data))
+	}
+	return data, nil
+}
+
+// Inspect gathers everything the tools show about a tag without printing
+// anything: UID, version, originality signature, settings of files 1-3, the
+// provisioning state of key slots 0-4, the NDEF URL and whether SDM is
+// enabled on the NDEF file.
+//
+// Each key slot is probed with the all-zero key first, then with keys in
+// order (see ProbeAllKeys); every failed attempt counts against the tag's
+// failed-authentication counter. Files whose settings cannot be read in
+// plain are retried with GetFileSettingsSecure under any key that matched
+// slot 0.
+//
+// Only a failure to select the NDEF application is returned as an error;
+// anything else that cannot be read is recorded in TagReport.Errors.
+func Inspect(card Card, keys []KeyFile) (*TagReport, error) {
+	r := &TagReport{Files: []FileReport{}, KeySlots: []KeySlotReport{}}
+
+	if uid, err := GetUID(card); err != nil {
+		r.addError("uid: %v", err)
+	} else {
+		r.UID = uid
+	}
+	if v, err := GetVersion(card); err != nil {
+		r.addError("version: %v", err)
+	} else {
+		r.Version = v
+		if r.UID == nil {
+			r.UID = v.UID
+		}
+	}
+
+	if err := SelectNDEFApp(card); err != nil {
+		return nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	if sig, err := ReadSignature(card); err != nil {
+		r.addError("originality signature: %v", err)
+	} else {
+		r.Originality = sig
+	}
+
+	candidates := append([]KeyFile{{Name: FactoryKeyName, Key: make([]byte, 16)}}, keys...)
+	matched := MatchedKeys(ProbeAllKeys(card, candidates, []byte{0, 1, 2, 3, 4}))
+	for slot := byte(0); slot <= 4; slot++ {
+		ks := KeySlotReport{Slot: slot, State: KeySlotUnknown, MatchedKey: matched[slot]}
+		switch ks.MatchedKey {
+		case "":
+		case FactoryKeyName:
+			ks.State = KeySlotDefault
+		default:
+			ks.State = KeySlotProvisioned
+		}
+		r.KeySlots = append(r.KeySlots, ks)
+	}
+
+	var masterKey []byte
+	for _, k := range candidates {
+		if k.Name == matched[0] {
+			masterKey = k.Key
+			break
+		}
+	}
+	for _, fileNo := range []byte{0x01, 0x02, 0x03} {
+		r.Files = append(r.Files, inspectFile(card, fileNo, masterKey))
+	}
+	for _, f := range r.Files {
+		if f.FileNo == 0x02 && f.Settings != nil {
+			r.SDMEnabled = f.Settings.FileOption&0x40 != 0
+		}
+	}
+
+	ndef, err := ReadNDEF(card)
+	if err != nil {
+		r.addError("ndef: %v", err)
+		return r, nil
+	}
+	if len(ndef) == 0 {
+		return r, nil
+	}
+	records, err := ParseNDEFMessage(ndef)
+	if err != nil {
+		r.addError("ndef parse: %v", err)
+		return r, nil
+	}
+	for _, rec := range records {
+		if url, err := DecodeURIRecord(rec); err == nil {
+			r.NDEFURL = url
+			break
+		}
+	}
+	return r, nil
+}
+
+// inspectFile reads one file's settings in plain, falling back to a
+// slot-0 session when masterKey is known.
+func inspectFile(card Card, fileNo byte, masterKey []byte) FileReport {
+	f := FileReport{FileNo: fileNo}
+	if err := SelectNDEFApp(card); err != nil {
+		f.Error = fmt.Sprintf("select NDEF app: %v", err)
+		return f
+	}
+	fs, err := GetFileSettingsPlain(card, fileNo)
+	if err != nil && masterKey != nil {
+		var sess *Session
+		if sess, err = AuthenticateEV2First(card, masterKey, 0); err == nil {
+			fs, err = GetFileSettingsSecure(card, sess, fileNo)
+		}
+	}
+	if err != nil {
+		f.Error = err.Error()
+		return f
+	}
+	f.Settings = fs
+	return f
+}
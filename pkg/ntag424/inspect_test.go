@@ -0,0 +1,175 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var inspectSignature = bytes.Repeat([]byte{0x5A}, 56)
+
+// inspectPreamble scripts GET DATA, the three GetVersion frames, the NDEF
+// app select and Read_Sig.
+func inspectPreamble(t *testing.T) []FakeExchange {
+	version3 := append(append([]byte{}, testUID...), 0xCA, 0xFE, 0x00, 0x01, 0x02, 0x00, 0x23, 0x91, 0x00)
+	return []FakeExchange{
+		{Command: mustHex(t, "FFCA000000"), Response: append(append([]byte{}, testUID...), 0x90, 0x00)},
+		{Command: mustHex(t, "9060000000"), Response: mustHex(t, "0404023000110591AF")},
+		{Command: mustHex(t, "90AF000000"), Response: mustHex(t, "0404020102110591AF")},
+		{Command: mustHex(t, "90AF000000"), Response: version3},
+		selectNDEFAppExchange,
+		{Command: mustHex(t, "903C0000010000"), Response: append(append([]byte{}, inspectSignature...), 0x91, 0x00)},
+	}
+}
+
+// inspectPlainSettings scripts a select and plain GetFileSettings answered
+// with settings (without status word).
+func inspectPlainSettings(fileNo byte, settings []byte) []FakeExchange {
+	return []FakeExchange{
+		selectNDEFAppExchange,
+		{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x00}, Response: append(append([]byte{}, settings...), 0x91, 0x00)},
+	}
+}
+
+func TestInspectFactoryDefaultTag(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	zero := make([]byte, 16)
+	probes := probeExchanges(t, [5][]byte{zero, zero, zero, zero, zero}, [][]byte{zero})
+
+	script := inspectPreamble(t)
+	script = append(script, probes...)
+	for fileNo, size := range []int{32, 256, 128} {
+		resp := settingsAPDUResponse(0x00, 0x00, 0xE0, size)
+		script = append(script, inspectPlainSettings(byte(fileNo+1), resp[:len(resp)-2])...)
+	}
+	script = append(script, readNDEFExchanges(t, nil)...)
+	card := NewFakeCard(script...)
+
+	report, err := Inspect(card, nil)
+	if err != nil {
+		t.Fatalf("Inspect returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("expected no errors, got %v", report.Errors)
+	}
+	if !bytes.Equal(report.UID, testUID) || report.Version == nil || !bytes.Equal(report.Version.UID, testUID) {
+		t.Fatalf("expected UID %X in report and version, got %X / %+v", testUID, report.UID, report.Version)
+	}
+	if !bytes.Equal(report.Originality, inspectSignature) {
+		t.Fatalf("expected originality signature to be recorded, got % X", report.Originality)
+	}
+	if len(report.KeySlots) != 5 {
+		t.Fatalf("expected 5 key slots, got %d", len(report.KeySlots))
+	}
+	for _, ks := range report.KeySlots {
+		if ks.State != KeySlotDefault || ks.MatchedKey != FactoryKeyName {
+			t.Fatalf("expected slot %d to be default, got %+v", ks.Slot, ks)
+		}
+	}
+	if len(report.Files) != 3 {
+		t.Fatalf("expected 3 file reports, got %d", len(report.Files))
+	}
+	for _, f := range report.Files {
+		if f.Settings == nil || f.Error != "" {
+			t.Fatalf("expected settings for file %d, got %+v", f.FileNo, f)
+		}
+	}
+	if report.NDEFURL != "" || report.SDMEnabled {
+		t.Fatalf("expected empty NDEF and SDM off, got %q sdm=%v", report.NDEFURL, report.SDMEnabled)
+	}
+}
+
+func TestInspectProvisionedTag(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	msg, err := BuildSDMNDEF("https://api.guideapparel.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	zero := make([]byte, 16)
+	masterKey := bytes.Repeat([]byte{0x11}, 16)
+	sdmKey := bytes.Repeat([]byte{0x22}, 16)
+	otherKey := bytes.Repeat([]byte{0x33}, 16) // slot 3, not supplied to Inspect
+
+	probes := probeExchanges(t, [5][]byte{masterKey, sdmKey, zero, otherKey, zero}, [][]byte{zero, masterKey, sdmKey})
+
+	sdmSettings := []byte{0x00, 0x40, 0x00, 0xE0, 0x00, 0x01, 0x00, 0xC1, 0xF1, 0xE1}
+	sdmSettings = append(sdmSettings, u24le(msg.UIDOffset)...)
+	sdmSettings = append(sdmSettings, u24le(msg.CtrOffset)...)
+	sdmSettings = append(sdmSettings, u24le(msg.MacInputOffset)...)
+	sdmSettings = append(sdmSettings, u24le(msg.MacOffset)...)
+	file1 := settingsAPDUResponse(0x00, 0x00, 0xE0, 32)
+	file3 := settingsAPDUResponse(0x00, 0x00, 0xE0, 128)
+
+	// File 3 refuses plain GetFileSettings, so Inspect authenticates slot 0
+	// with the master key and asks again in CommMode.MAC.
+	auth, sess := authExchanges(t, 0, masterKey, masterKey)
+	cmac, err := AESCMAC(sess.kmac[:], append(append([]byte{0xF5, 0x00, 0x00}, sess.ti[:]...), 0x03))
+	if err != nil {
+		t.Fatalf("command CMAC: %v", err)
+	}
+
+	script := inspectPreamble(t)
+	script = append(script, probes...)
+	script = append(script, inspectPlainSettings(0x01, file1[:len(file1)-2])...)
+	script = append(script, inspectPlainSettings(0x02, sdmSettings)...)
+	script = append(script,
+		selectNDEFAppExchange,
+		FakeExchange{Command: mustHex(t, "90F50000010300"), Response: []byte{0x91, 0xAE}},
+	)
+	script = append(script, auth...)
+	script = append(script, FakeExchange{
+		Command:  append(append([]byte{0x90, 0xF5, 0x00, 0x00, 0x09, 0x03}, TruncateOddBytes(cmac)...), 0x00),
+		Response: ssmMACResponse(t, sess, file3[:len(file3)-2]),
+	})
+	script = append(script, readNDEFExchanges(t, msg.NDEF)...)
+	card := NewFakeCard(script...)
+
+	keys := []KeyFile{{Name: "master.hex", Key: masterKey}, {Name: "sdm.hex", Key: sdmKey}}
+	report, err := Inspect(card, keys)
+	if err != nil {
+		t.Fatalf("Inspect returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("expected no errors, got %v", report.Errors)
+	}
+
+	want := []KeySlotReport{
+		{Slot: 0, State: KeySlotProvisioned, MatchedKey: "master.hex"},
+		{Slot: 1, State: KeySlotProvisioned, MatchedKey: "sdm.hex"},
+		{Slot: 2, State: KeySlotDefault, MatchedKey: FactoryKeyName},
+		{Slot: 3, State: KeySlotUnknown},
+		{Slot: 4, State: KeySlotDefault, MatchedKey: FactoryKeyName},
+	}
+	for i := range want {
+		if report.KeySlots[i] != want[i] {
+			t.Fatalf("expected key slots %+v, got %+v", want, report.KeySlots)
+		}
+	}
+
+	if f := report.Files[2]; f.Settings == nil || f.Settings.Size != 128 {
+		t.Fatalf("expected file 3 settings through the slot-0 session, got %+v", f)
+	}
+	if !report.SDMEnabled {
+		t.Fatalf("expected SDM to be reported enabled")
+	}
+	if !strings.HasPrefix(report.NDEFURL, "https://api.guideapparel.com/tap?") {
+		t.Fatalf("expected SDM URL, got %q", report.NDEFURL)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error: %v", err)
+	}
+	for _, wantJSON := range []string{`"uid":"041E3C5A7B6F80"`, `"state":"unknown"`, `"sdm_enabled":true`, `"originality_signature":"5A5A`} {
+		if !strings.Contains(string(b), wantJSON) {
+			t.Fatalf("expected %s in %s", wantJSON, b)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package ntag424
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 )
 
 const (
@@ -16,7 +20,18 @@ const (
 // Always select BEFORE authenticating, or re-authenticate after selecting.
 func SelectNDEFApp(card Card) error {
 	aid, _ := hex.DecodeString(ndefAppAID)
-	apdu := append([]byte{0x00, 0xA4, 0x04, 0x00, byte(len(aid))}, aid...)
+	return SelectApplicationISO(card, aid)
+}
+
+// SelectApplicationISO selects an application by ISO DF name using ISO 7816
+// SELECT (00 A4 04 00). dfName is 1-16 bytes, e.g. D2760000850101 for NDEF.
+//
+// Like SelectNDEFApp, this INVALIDATES any active authentication session.
+func SelectApplicationISO(card Card, dfName []byte) error {
+	if len(dfName) == 0 || len(dfName) > 16 {
+		return fmt.Errorf("DF name must be 1-16 bytes, got %d", len(dfName))
+	}
+	apdu := append([]byte{0x00, 0xA4, 0x04, 0x00, byte(len(dfName))}, dfName...)
 	apdu = append(apdu, 0x00)
 	_, sw, err := Transmit(card, apdu)
 	if err != nil {
@@ -28,6 +43,147 @@ func SelectNDEFApp(card Card) error {
 	return nil
 }
 
+// SelectApplicationAID selects an application by its 3-byte DESFire AID using
+// native SelectApplication (90 5A 00 00 03 AID 00). The AID is sent as given,
+// i.e. least significant byte first as DESFire GetApplicationIDs reports it;
+// 00 00 00 selects the PICC level.
+//
+// This is for DESFire EV-family cards. NTAG 424 DNA only supports the ISO
+// select (SelectApplicationISO). Invalidates any active session.
+func SelectApplicationAID(card Card, aid []byte) error {
+	if len(aid) != 3 {
+		return fmt.Errorf("DESFire AID must be 3 bytes, got %d", len(aid))
+	}
+	apdu := append([]byte{0x90, 0x5A, 0x00, 0x00, 0x03}, aid...)
+	apdu = append(apdu, 0x00)
+	_, sw, err := Transmit(card, apdu)
+	if err != nil {
+		return err
+	}
+	if sw != SWDESFireOK {
+		return &SWError{Cmd: 0x5A, SW: sw}
+	}
+	return nil
+}
+
+// GetApplicationIDs lists the applications on a DESFire card using native
+// GetApplicationIDs (90 6A 00 00 00) at PICC level. Long lists arrive in
+// several frames (SW=91AF) and are fetched with 0xAF continuations. Each AID
+// is 3 bytes, least significant byte first, ready for SelectApplicationAID.
+//
+// Cards that do not support the command (NTAG 424 DNA answers 911C) or
+// refuse it without authentication (919D) are reported as having no
+// applications rather than as an error.
+func GetApplicationIDs(card Card) ([][]byte, error) {
+	data, sw, err := transmitChained(card, []byte{0x90, 0x6A, 0x00, 0x00, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if commandUnsupported(sw) {
+		return nil, nil
+	}
+	if sw != SWDESFireOK {
+		return nil, &SWError{Cmd: 0x6A, SW: sw}
+	}
+	if len(data)%3 != 0 {
+		return nil, fmt.Errorf("GetApplicationIDs response is %d bytes, not a multiple of 3", len(data))
+	}
+	aids := make([][]byte, 0, len(data)/3)
+	for i := 0; i < len(data); i += 3 {
+		aids = append(aids, append([]byte(nil), data[i:i+3]...))
+	}
+	return aids, nil
+}
+
+// GetFileIDs lists the file numbers of the selected application using
+// native GetFileIDs (90 6F 00 00 00). Like GetApplicationIDs, an
+// unsupported or refused command yields no files rather than an error.
+func GetFileIDs(card Card) ([]byte, error) {
+	data, sw, err := transmitChained(card, []byte{0x90, 0x6F, 0x00, 0x00, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if commandUnsupported(sw) {
+		return nil, nil
+	}
+	if sw != SWDESFireOK {
+		return nil, &SWError{Cmd: 0x6F, SW: sw}
+	}
+	return data, nil
+}
+
+// defaultFileNos are the NTAG 424 DNA NDEF application files (CC, NDEF,
+// proprietary), assumed when the card does not list its files.
+var defaultFileNos = []byte{0x01, 0x02, 0x03}
+
+// ListFileIDs lists the file numbers of the selected application like
+// GetFileIDs, in CommMode.MAC when sess is set. Without a session, a card
+// that does not list its files (NTAG 424 DNA answers GetFileIDs with an
+// error) gets files 1-3.
+//
+// With a session every refusal is returned: the error status has ended the
+// authentication, so sess is no longer usable and the caller must not go on
+// with it. To list files on such a card, call ListFileIDs with a nil session
+// before authenticating.
+func ListFileIDs(card Card, sess *Session) ([]byte, error) {
+	var fileNos []byte
+	if sess == nil {
+		ids, err := GetFileIDs(card)
+		if err != nil {
+			return nil, err
+		}
+		fileNos = ids
+	} else {
+		ids, err := SsmCmdMAC(card, sess, 0x6F, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		fileNos = ids
+	}
+	if len(fileNos) == 0 {
+		return append([]byte(nil), defaultFileNos...), nil
+	}
+	return fileNos, nil
+}
+
+// ListAndReadAllFileSettings reads the settings of every file ListFileIDs
+// returns, with GetFileSettings (plain, or secure over sess where the tag
+// requires it), so inspection works on DESFire applications with files
+// beyond 1-3.
+//
+// A file whose settings cannot be read is left out of the map and its error
+// joined into err; the map still holds every file that was read. Only a
+// failed file listing returns a nil map; with sess that includes a tag that
+// refuses GetFileIDs (see ListFileIDs).
+func ListAndReadAllFileSettings(card Card, sess *Session) (map[byte]*FileSettings, error) {
+	fileNos, err := ListFileIDs(card, sess)
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+	settings := make(map[byte]*FileSettings, len(fileNos))
+	var errs []error
+	for _, fileNo := range fileNos {
+		fs, err := GetFileSettings(card, sess, fileNo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("file %d settings: %w", fileNo, err))
+			continue
+		}
+		settings[fileNo] = fs
+	}
+	return settings, errors.Join(errs...)
+}
+
+// commandUnsupported reports whether sw means the card does not offer a
+// command here: illegal command code, permission denied, or the ISO
+// "instruction/class not supported" words.
+func commandUnsupported(sw uint16) bool {
+	switch sw {
+	case SWBoundaryError, SWPermDenied, 0x6D00, 0x6E00:
+		return true
+	}
+	return false
+}
+
 // SelectFile selects a file by its 16-bit ID using ISO 7816 SELECT FILE.
 // From update/internal/ntag/io.go:74-84.
 //
@@ -51,24 +207,81 @@ func SelectFile(card Card, fileID uint16) error {
 }
 
 // WriteNDEFPlain writes NDEF data without authentication.
-// Selects NDEF app and file, then writes data using ISO UPDATE BINARY.
+// Selects NDEF app, reads the CC file to find the NDEF file ID (as ReadNDEF
+// does), then writes data using ISO UPDATE BINARY. If the CC cannot be read
+// the data goes to the default NDEF file 0xE104, as it did before the CC
+// was consulted.
 // From update/internal/ntag/io.go:13-21.
 func WriteNDEFPlain(card Card, data []byte) error {
 	if err := SelectNDEFApp(card); err != nil {
 		return err
 	}
-	if err := SelectFile(card, ndefFileID); err != nil {
+	fileID, err := readNDEFFileID(card)
+	if err != nil {
+		slog.Warn("CC file unreadable, writing NDEF to the default file", "ndef_file_id", fmt.Sprintf("%04X", ndefFileID), "error", err)
+		fileID = ndefFileID
+	}
+	if err := SelectFile(card, fileID); err != nil {
 		return err
 	}
 	return WriteNDEFData(card, data)
 }
 
+// WriteNDEFPlainVerified writes data like WriteNDEFPlain, then reads the
+// NDEF back with ReadNDEF and compares it with the message in data (the bytes
+// after the 2-byte NLEN). A write truncated or corrupted by a flaky reader
+// fails here with a *NDEFMismatchError instead of surfacing later as a failed
+// SDM verification.
+func WriteNDEFPlainVerified(card Card, data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("NDEF data must start with a 2-byte NLEN, got %d bytes", len(data))
+	}
+	nlen := int(data[0])<<8 | int(data[1])
+	if nlen > len(data)-2 {
+		return fmt.Errorf("NLEN %d exceeds the %d message bytes supplied", nlen, len(data)-2)
+	}
+	want := data[2 : 2+nlen]
+
+	if err := WriteNDEFPlain(card, data); err != nil {
+		return err
+	}
+	got, err := ReadNDEF(card)
+	if err != nil {
+		return fmt.Errorf("verify NDEF: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return newNDEFMismatchError(want, got)
+	}
+	return nil
+}
+
 // WriteNDEFWithAuth writes NDEF data after authentication.
 // Assumes NDEF app is already selected and authentication is active.
 // Does NOT call SelectNDEFApp to preserve the auth session.
 // From update/internal/ntag/io.go:23-31.
+//
+// The CC file is not read here (that would need another SELECT); the NDEF
+// file is assumed to be 0xE104. Use WriteNDEFToFileWithAuth for other IDs.
 func WriteNDEFWithAuth(card Card, data []byte) error {
-	if err := SelectFile(card, ndefFileID); err != nil {
+	return WriteNDEFToFileWithAuth(card, ndefFileID, data)
+}
+
+// WriteNDEFToFile writes NDEF data to an explicit file ID without authentication.
+// Selects NDEF app and the given file, then writes using ISO UPDATE BINARY.
+func WriteNDEFToFile(card Card, fileID uint16, data []byte) error {
+	if err := SelectNDEFApp(card); err != nil {
+		return err
+	}
+	if err := SelectFile(card, fileID); err != nil {
+		return err
+	}
+	return WriteNDEFData(card, data)
+}
+
+// WriteNDEFToFileWithAuth writes NDEF data to an explicit file ID after authentication.
+// Does NOT call SelectNDEFApp to preserve the auth session.
+func WriteNDEFToFileWithAuth(card Card, fileID uint16, data []byte) error {
+	if err := SelectFile(card, fileID); err != nil {
 		return err
 	}
 	return WriteNDEFData(card, data)
@@ -81,38 +294,161 @@ func WriteNDEFWithAuth(card Card, data []byte) error {
 //
 // Writes data in chunks of up to 255 bytes using ISO UPDATE BINARY (INS 0xD6).
 func WriteNDEFData(card Card, data []byte) error {
-	offset := 0
-	for offset < len(data) {
-		chunk := len(data) - offset
+	return WriteNDEFDataAt(card, 0, data)
+}
+
+// WriteNDEFDataAt is WriteNDEFData starting at offset in the selected file.
+// If a chunk fails, the error is a *PartialWriteError whose Written count
+// can be added to offset (and sliced off data) to resume the write.
+func WriteNDEFDataAt(card Card, offset int, data []byte) error {
+	if offset < 0 || offset+len(data) > 0x7FFF {
+		return fmt.Errorf("UPDATE BINARY offset %d + %d bytes out of range", offset, len(data))
+	}
+	return updateBinary(card, offset, data)
+}
+
+// WriteNDEFMessage writes payload (an NDEF message without the NLEN header)
+// to the NDEF file named in the CC, without authentication.
+//
+// The CC's MaxNDEFSize is checked before anything is written, so a message
+// that does not fit fails up front instead of leaving a truncated file. The
+// write follows the NFC Forum Type 4 update order: NLEN is zeroed, the
+// payload written at offset 2, then the real NLEN written last, so a reader
+// never sees a length that does not match the data.
+//
+// If the payload write stops partway the error is a *PartialWriteError;
+// pass its Written count to ResumeNDEFMessage to finish the write.
+func WriteNDEFMessage(card Card, payload []byte) error {
+	return ResumeNDEFMessage(card, payload, 0)
+}
+
+// ResumeNDEFMessage is WriteNDEFMessage skipping the first written bytes of
+// payload, which an earlier interrupted write already put on the tag (see
+// PartialWriteError). NLEN is zeroed again first, so the file stays marked
+// empty until the rest of the payload and the real NLEN are written.
+// A *PartialWriteError from a resumed write counts from the start of
+// payload, so it can be fed straight back into ResumeNDEFMessage.
+func ResumeNDEFMessage(card Card, payload []byte, written int) error {
+	return ResumeNDEFMessageWithLayout(card, payload, written, NDEFLayoutStandardNLEN2)
+}
+
+// WriteNDEFMessageWithLayout is WriteNDEFMessage for an NDEF file framed as
+// layout. For NDEFLayoutTLV the file gets an NDEF Message TLV followed by a
+// Terminator TLV, written in the same order: an empty TLV first, then the
+// payload and terminator, then the real TLV header.
+func WriteNDEFMessageWithLayout(card Card, payload []byte, layout NDEFLayout) error {
+	return ResumeNDEFMessageWithLayout(card, payload, 0, layout)
+}
+
+// ResumeNDEFMessageWithLayout is ResumeNDEFMessage for an NDEF file framed as
+// layout; see WriteNDEFMessageWithLayout.
+func ResumeNDEFMessageWithLayout(card Card, payload []byte, written int, layout NDEFLayout) error {
+	if written < 0 || written > len(payload) {
+		return fmt.Errorf("resume offset %d outside %d-byte NDEF message", written, len(payload))
+	}
+	header, err := ndefHeader(layout, len(payload))
+	if err != nil {
+		return err
+	}
+	body := append(append([]byte{}, payload...), ndefTrailer(layout)...)
+	if err := SelectNDEFApp(card); err != nil {
+		return err
+	}
+	cc, err := readCC(card)
+	if err != nil {
+		return err
+	}
+	// An NLEN of zero, or an empty NDEF Message TLV, marks the file empty
+	lenName, empty := "NLEN", []byte{0x00, 0x00}
+	if layout == NDEFLayoutTLV {
+		lenName, empty = "TLV", []byte{tlvNDEF, 0x00}
+	}
+	if need := len(header) + len(body); need > int(cc.MaxNDEFSize) {
+		return fmt.Errorf("NDEF message is %d bytes (+%d %s), file %04X holds at most %d",
+			len(payload), need-len(payload), lenName, cc.NDEFFileID, cc.MaxNDEFSize)
+	}
+	if err := SelectFile(card, cc.NDEFFileID); err != nil {
+		return err
+	}
+
+	if err := updateBinary(card, 0, empty); err != nil {
+		return fmt.Errorf("clear %s: %w", lenName, err)
+	}
+	if err := updateBinary(card, len(header)+written, body[written:]); err != nil {
+		var perr *PartialWriteError
+		if errors.As(err, &perr) {
+			perr.Written += written
+			if perr.Written > len(payload) {
+				perr.Written = len(payload) // only the terminator is missing
+			}
+		} else if written > 0 {
+			err = &PartialWriteError{Written: written, Err: err}
+		}
+		return fmt.Errorf("write NDEF message: %w", err)
+	}
+	if err := updateBinary(card, 0, header); err != nil {
+		return fmt.Errorf("write %s: %w", lenName, err)
+	}
+	return nil
+}
+
+// updateBinary writes data to the selected file at offset in chunks of up to
+// 255 bytes using ISO UPDATE BINARY (INS 0xD6). A failure after the first
+// chunk is returned as a *PartialWriteError.
+func updateBinary(card Card, offset int, data []byte) error {
+	written := 0
+	for written < len(data) {
+		chunk := len(data) - written
 		if chunk > 0xFF {
 			chunk = 0xFF
 		}
 
 		apdu := make([]byte, 0, 5+chunk)
 		apdu = append(apdu, 0x00, 0xD6, byte(offset>>8), byte(offset), byte(chunk))
-		apdu = append(apdu, data[offset:offset+chunk]...)
+		apdu = append(apdu, data[written:written+chunk]...)
 
 		_, sw, err := Transmit(card, apdu)
+		if err == nil && !SwOK(sw) {
+			err = &SWError{Cmd: 0xD6, SW: sw}
+		}
 		if err != nil {
+			if written > 0 {
+				return &PartialWriteError{Written: written, Err: err}
+			}
 			return err
 		}
-		if !SwOK(sw) {
-			return &SWError{Cmd: 0xD6, SW: sw}
-		}
+		written += chunk
 		offset += chunk
 	}
 	return nil
 }
 
+// writePlainChunk is the largest WriteData chunk WriteFileDataPlain sends:
+// the 7-byte fileNo/offset/length prefix plus 248 data bytes is Lc=255, the
+// most a short APDU carries.
+const writePlainChunk = 248
+
 // WriteFileDataPlain writes data to a file using DESFire native WriteData (INS 0x3D).
 // This respects DESFire access rights (Write=free will work without authentication).
-// Mirrors ReadFileDataPlain but for writing.
+// Mirrors ReadFileDataPlain but for writing. An offset or data length that
+// does not fit the 3-byte fields is rejected before anything is sent.
+//
+// Data longer than writePlainChunk is sent as consecutive WriteData commands
+// at increasing offsets.
+//
+// Fail states (the tag's status word is an *SWError):
+//   - SW=911C: write past the file's allocated size (IsBoundaryError)
+//   - SW=919D/91AE: write access needs a key (IsPermissionDenied, IsAuthError)
+//   - A chunk after the first fails: *PartialWriteError wrapping the cause
 func WriteFileDataPlain(card Card, fileNo byte, offset int, data []byte) error {
+	if err := checkDataRange(offset, len(data)); err != nil {
+		return err
+	}
 	written := 0
 	for written < len(data) {
 		chunk := len(data) - written
-		if chunk > 0xFF {
-			chunk = 0xFF
+		if chunk > writePlainChunk {
+			chunk = writePlainChunk
 		}
 
 		apdu := make([]byte, 0, 12+chunk)
@@ -124,28 +460,76 @@ func WriteFileDataPlain(card Card, fileNo byte, offset int, data []byte) error {
 		apdu = append(apdu, 0x00)
 
 		_, sw, err := Transmit(card, apdu)
+		if err == nil && !SwOK(sw) {
+			err = &SWError{Cmd: 0x3D, SW: sw}
+		}
 		if err != nil {
+			if written > 0 {
+				return &PartialWriteError{Written: written, Err: err}
+			}
 			return err
 		}
-		if !SwOK(sw) {
-			return &SWError{Cmd: 0x3D, SW: sw}
-		}
 		written += chunk
 		offset += chunk
 	}
 	return nil
 }
 
+// WriteFileDataPlainVerified writes data with WriteFileDataPlain, then reads
+// the same range back with ReadFileDataPlain and returns an error if it
+// differs. The read-back is done in readFileChunk pieces, so the file's Read
+// access must be free as well.
+func WriteFileDataPlainVerified(card Card, fileNo byte, offset int, data []byte) error {
+	if err := WriteFileDataPlain(card, fileNo, offset, data); err != nil {
+		return err
+	}
+
+	got := make([]byte, 0, len(data))
+	for len(got) < len(data) {
+		n := len(data) - len(got)
+		if n > readFileChunk {
+			n = readFileChunk
+		}
+		chunk, err := ReadFileDataPlain(card, fileNo, offset+len(got), n)
+		if err != nil {
+			return fmt.Errorf("verify read at offset %d: %w", offset+len(got), err)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("verify file %d: read back %d bytes that do not match the %d bytes written", fileNo, len(got), len(data))
+	}
+	return nil
+}
+
+// writeSecureChunk is the largest WriteData chunk WriteFileDataSecure sends.
+// The 7-byte fileNo/offset/length prefix plus 232 data bytes pads to 240
+// bytes of ciphertext; with the 8-byte MAC that is Lc=248, inside a short APDU.
+const writeSecureChunk = 232
+
 // WriteFileDataSecure writes data to a file using DESFire native WriteData (INS 0x3D)
 // with secure messaging (CMAC). Requires active authentication session.
 // Mirrors ReadFileDataSecure - all parameters go in encrypted cmdData.
+// Offsets and lengths are validated as for WriteFileDataPlain.
+//
+// Data longer than writeSecureChunk is sent as consecutive WriteData commands
+// at increasing offsets. Each is its own secure-messaging command, so cmdCtr
+// advances once per chunk and every chunk gets a fresh IV. The 3-byte offset
+// and length fields address at most 16 MiB (offset+len(data) <= 0x1000000);
+// NTAG 424 DNA data files are at most 256 bytes, so real writes are one or two
+// chunks.
 func WriteFileDataSecure(card Card, sess *Session, fileNo byte, offset int, data []byte) error {
+	if err := checkDataRange(offset, len(data)); err != nil {
+		return err
+	}
 	written := 0
 	for written < len(data) {
 		chunk := len(data) - written
-		// Use very small chunks to avoid APDU length issues
-		if chunk > 16 {
-			chunk = 16
+		if chunk > writeSecureChunk {
+			chunk = writeSecureChunk
 		}
 
 		// Build command data: fileNo + offset (3 LE) + length (3 LE) + file data
@@ -167,3 +551,67 @@ func WriteFileDataSecure(card Card, sess *Session, fileNo byte, offset int, data
 	}
 	return nil
 }
+
+// writeMACChunk is the largest WriteData chunk WriteFileDataMAC sends: the
+// 7-byte fileNo/offset/length header, 240 cleartext data bytes and the 8-byte
+// MAC make Lc=255.
+const writeMACChunk = 240
+
+// WriteFileDataMAC writes data to a file using DESFire native WriteData
+// (INS 0x3D) in CommMode.MAC, for files whose comm mode is MAC. The header
+// and data are sent in cleartext followed by a truncated CMAC; the tag's
+// response MAC is verified. Requires an active authentication session.
+func WriteFileDataMAC(card Card, sess *Session, fileNo byte, offset int, data []byte) error {
+	if err := checkDataRange(offset, len(data)); err != nil {
+		return err
+	}
+	written := 0
+	for written < len(data) {
+		chunk := len(data) - written
+		if chunk > writeMACChunk {
+			chunk = writeMACChunk
+		}
+
+		cmdHeader := []byte{
+			fileNo,
+			byte(offset), byte(offset >> 8), byte(offset >> 16),
+			byte(chunk), byte(chunk >> 8), byte(chunk >> 16),
+		}
+		if _, err := SsmCmdMAC(card, sess, 0x3D, cmdHeader, data[written:written+chunk]); err != nil {
+			return err
+		}
+
+		written += chunk
+		offset += chunk
+	}
+	return nil
+}
+
+// WriteFileDataSecureVerified writes data with WriteFileDataSecure, then reads
+// the same range back with ReadFileDataSecure and returns an error if it
+// differs. The read-back is done in readFileChunk pieces.
+func WriteFileDataSecureVerified(card Card, sess *Session, fileNo byte, offset int, data []byte) error {
+	if err := WriteFileDataSecure(card, sess, fileNo, offset, data); err != nil {
+		return err
+	}
+
+	got := make([]byte, 0, len(data))
+	for len(got) < len(data) {
+		n := len(data) - len(got)
+		if n > readFileChunk {
+			n = readFileChunk
+		}
+		chunk, err := ReadFileDataSecure(card, sess, fileNo, offset+len(got), n)
+		if err != nil {
+			return fmt.Errorf("verify read at offset %d: %w", offset+len(got), err)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("verify file %d: read back %d bytes that do not match the %d bytes written", fileNo, len(got), len(data))
+	}
+	return nil
+}
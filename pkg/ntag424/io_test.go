@@ -0,0 +1,793 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// apduFunc adapts a function to the Card interface for scripted tests.
+type apduFunc func(apdu []byte) ([]byte, error)
+
+func (f apduFunc) Transmit(apdu []byte) ([]byte, error) { return f(apdu) }
+
+// ccWithNDEFFile returns a 15-byte CC whose NDEF File Control TLV points at fileID.
+func ccWithNDEFFile(fileID uint16) []byte {
+	return []byte{0x00, 0x0F, 0x20, 0x00, 0x7F, 0x00, 0x7F,
+		0x04, 0x06, byte(fileID >> 8), byte(fileID), 0x01, 0x00, 0x00, 0x00}
+}
+
+func TestWriteNDEFPlainUsesCCFileID(t *testing.T) {
+	var selected []uint16
+	var writes int
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch {
+		case apdu[1] == 0xA4 && apdu[2] == 0x00:
+			selected = append(selected, uint16(apdu[5])<<8|uint16(apdu[6]))
+		case apdu[1] == 0xB0:
+			return append(ccWithNDEFFile(0xE105), 0x90, 0x00), nil
+		case apdu[1] == 0xD6:
+			if len(selected) == 0 || selected[len(selected)-1] != 0xE105 {
+				t.Fatalf("UPDATE BINARY issued with selected files %X, want E105 last", selected)
+			}
+			writes++
+		}
+		return []byte{0x90, 0x00}, nil
+	})
+
+	if err := WriteNDEFPlain(card, []byte{0x00, 0x03, 0xD0, 0x00, 0x00}); err != nil {
+		t.Fatalf("WriteNDEFPlain returned error: %v", err)
+	}
+	if len(selected) != 2 || selected[0] != 0xE103 || selected[1] != 0xE105 {
+		t.Fatalf("expected SELECT E103 then E105, got %X", selected)
+	}
+	if writes != 1 {
+		t.Fatalf("expected one UPDATE BINARY, got %d", writes)
+	}
+}
+
+func TestWriteNDEFPlainDefaultsWhenCCUnreadable(t *testing.T) {
+	var selected []uint16
+	var writes int
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch {
+		case apdu[1] == 0xA4 && apdu[2] == 0x00:
+			id := uint16(apdu[5])<<8 | uint16(apdu[6])
+			selected = append(selected, id)
+			if id == 0xE103 {
+				return []byte{0x6A, 0x82}, nil // CC file not found
+			}
+		case apdu[1] == 0xD6:
+			if selected[len(selected)-1] != 0xE104 {
+				t.Fatalf("UPDATE BINARY issued with selected files %X, want E104 last", selected)
+			}
+			writes++
+		}
+		return []byte{0x90, 0x00}, nil
+	})
+
+	if err := WriteNDEFPlain(card, []byte{0x00, 0x03, 0xD0, 0x00, 0x00}); err != nil {
+		t.Fatalf("WriteNDEFPlain returned error: %v", err)
+	}
+	if writes != 1 {
+		t.Fatalf("expected one UPDATE BINARY, got %d", writes)
+	}
+}
+
+func TestWriteNDEFToFileWithAuthSkipsAppSelect(t *testing.T) {
+	var apdus [][]byte
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		apdus = append(apdus, append([]byte(nil), apdu...))
+		return []byte{0x90, 0x00}, nil
+	})
+
+	if err := WriteNDEFToFileWithAuth(card, 0xE106, []byte{0x00, 0x00}); err != nil {
+		t.Fatalf("WriteNDEFToFileWithAuth returned error: %v", err)
+	}
+	if len(apdus) != 2 {
+		t.Fatalf("expected SELECT FILE + UPDATE BINARY, got %d APDUs", len(apdus))
+	}
+	if want := []byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x06}; !bytes.Equal(apdus[0], want) {
+		t.Fatalf("expected % X, got % X", want, apdus[0])
+	}
+	if apdus[1][1] != 0xD6 {
+		t.Fatalf("expected UPDATE BINARY, got % X", apdus[1])
+	}
+}
+
+// ssmExchanges scripts the tag side of sess answering one command per entry
+// of plains, in CommModeFull or CommModeMAC. Commands are accepted as sent;
+// sentWrites checks them afterwards.
+func ssmExchanges(t *testing.T, sess Session, mode CommMode, plains ...[]byte) []FakeExchange {
+	t.Helper()
+	script := make([]FakeExchange, 0, len(plains))
+	for _, plain := range plains {
+		var resp []byte
+		if mode == CommModeMAC {
+			resp = ssmMACResponse(t, &sess, plain)
+		} else {
+			resp = ssmResponse(t, &sess, plain)
+		}
+		sess.cmdCtr++
+		script = append(script, FakeExchange{Response: resp})
+	}
+	return script
+}
+
+// sentWrite is one WriteData command recovered from FakeCard.Sent.
+type sentWrite struct {
+	off  int
+	lc   int
+	ctr  uint16 // tag-side cmdCtr the command was protected with
+	data []byte
+}
+
+// sentWrites decodes the WriteData commands in sent. In CommModeFull and
+// CommModeMAC every command, ReadData included, is checked against the tag
+// side of sess, whose counter advances once per command.
+func sentWrites(t *testing.T, sess Session, mode CommMode, sent [][]byte) []sentWrite {
+	t.Helper()
+	var writes []sentWrite
+	for _, apdu := range sent {
+		var cmd []byte
+		switch mode {
+		case CommModeFull:
+			cmd = ssmDecryptCommand(t, &sess, apdu, 0)
+		case CommModeMAC:
+			cmd = ssmCheckMACCommand(t, &sess, apdu)
+		default:
+			cmd = apdu[5 : 5+int(apdu[4])]
+		}
+		if apdu[1] == 0x3D {
+			_, off, n := readDataArgs(cmd)
+			if len(cmd)-7 != n {
+				t.Fatalf("WriteData length %d does not match %d data bytes", n, len(cmd)-7)
+			}
+			writes = append(writes, sentWrite{off: off, lc: int(apdu[4]), ctr: sess.cmdCtr, data: cmd[7:]})
+		}
+		if mode != CommModePlain {
+			sess.cmdCtr++
+		}
+	}
+	return writes
+}
+
+// writtenData joins the data of writes, checking they are contiguous from
+// offset.
+func writtenData(t *testing.T, writes []sentWrite, offset int) []byte {
+	t.Helper()
+	var data []byte
+	for _, w := range writes {
+		if w.off != offset+len(data) {
+			t.Fatalf("expected write at offset %d, got %d", offset+len(data), w.off)
+		}
+		data = append(data, w.data...)
+	}
+	return data
+}
+
+func TestWriteFileDataPlainChunksWithinShortAPDU(t *testing.T) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	card := NewFakeCard(
+		FakeExchange{Response: []byte{0x91, 0x00}},
+		FakeExchange{Response: []byte{0x91, 0x00}},
+		FakeExchange{Command: mustHex(t, "90BD000007030A000080000000"), Response: append(append([]byte{}, data[:128]...), 0x91, 0x00)},
+		FakeExchange{Command: mustHex(t, "90BD000007038A000080000000"), Response: append(append([]byte{}, data[128:256]...), 0x91, 0x00)},
+		FakeExchange{Command: mustHex(t, "90BD000007030A01002C000000"), Response: append(append([]byte{}, data[256:]...), 0x91, 0x00)},
+	)
+
+	if err := WriteFileDataPlainVerified(card, 0x03, 10, data); err != nil {
+		t.Fatalf("WriteFileDataPlainVerified returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	writes := sentWrites(t, Session{}, CommModePlain, card.Sent)
+	if len(writes) != 2 || len(writes[0].data) != writePlainChunk || len(writes[1].data) != 300-writePlainChunk {
+		t.Fatalf("expected chunks of %d and %d, got %d writes", writePlainChunk, 300-writePlainChunk, len(writes))
+	}
+	if writes[0].lc != 255 {
+		t.Fatalf("expected full chunk Lc=255, got %d", writes[0].lc)
+	}
+	if !bytes.Equal(writtenData(t, writes, 10), data) {
+		t.Fatalf("file content mismatch after write")
+	}
+}
+
+func TestWriteFileDataPlainPastFileSize(t *testing.T) {
+	card := NewFakeCard(FakeExchange{Response: []byte{0x91, 0x1C}})
+	err := WriteFileDataPlain(card, 0x03, 0, make([]byte, 40))
+	if !IsBoundaryError(err) {
+		t.Fatalf("expected boundary error, got %v", err)
+	}
+	var perr *PartialWriteError
+	if errors.As(err, &perr) {
+		t.Fatalf("expected a plain SWError when nothing was written, got %v", err)
+	}
+
+	// A write running past the end in its second chunk reports what landed.
+	card = NewFakeCard(FakeExchange{Response: []byte{0x91, 0x00}}, FakeExchange{Response: []byte{0x91, 0x1C}})
+	err = WriteFileDataPlain(card, 0x03, 0, make([]byte, 300))
+	if !errors.As(err, &perr) || perr.Written != writePlainChunk || !IsBoundaryError(err) {
+		t.Fatalf("expected PartialWriteError after %d bytes wrapping 911C, got %v", writePlainChunk, err)
+	}
+
+	// Write=key answers 919D.
+	card = NewFakeCard(FakeExchange{Response: []byte{0x91, 0x9D}})
+	if err := WriteFileDataPlainVerified(card, 0x03, 0, []byte{1}); !IsPermissionDenied(err) {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
+
+func TestWriteFileDataSecureVerifiedSpansChunks(t *testing.T) {
+	const start = 40
+	data := make([]byte, writeSecureChunk+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sess := testSession()
+	tag := *sess
+	card := NewFakeCard(ssmExchanges(t, tag, CommModeFull, nil, nil, data[:128], data[128:256], data[256:])...)
+
+	if err := WriteFileDataSecureVerified(card, sess, 0x03, start, data); err != nil {
+		t.Fatalf("WriteFileDataSecureVerified returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	writes := sentWrites(t, tag, CommModeFull, card.Sent)
+	if !bytes.Equal(writtenData(t, writes, start), data) {
+		t.Fatalf("file content mismatch after write")
+	}
+	wantLens := []int{writeSecureChunk, 100}
+	if len(writes) != len(wantLens) {
+		t.Fatalf("expected %d WriteData chunks, got %d", len(wantLens), len(writes))
+	}
+	for i, w := range writes {
+		if len(w.data) != wantLens[i] {
+			t.Fatalf("chunk %d: expected length %d, got %d", i, wantLens[i], len(w.data))
+		}
+	}
+	for _, apdu := range card.Sent {
+		if int(apdu[4]) != len(apdu)-6 {
+			t.Fatalf("Lc %d does not describe a short APDU of %d bytes", apdu[4], len(apdu))
+		}
+	}
+}
+
+func TestWriteFileDataSecureChunksAtLimit(t *testing.T) {
+	data := bytes.Repeat([]byte{0xA5}, 500)
+	sess := testSession()
+	tag := *sess
+	card := NewFakeCard(ssmExchanges(t, tag, CommModeFull, nil, nil, nil)...)
+
+	if err := WriteFileDataSecure(card, sess, 0x03, 0, data); err != nil {
+		t.Fatalf("WriteFileDataSecure returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	writes := sentWrites(t, tag, CommModeFull, card.Sent)
+	want := []int{writeSecureChunk, writeSecureChunk, 500 - 2*writeSecureChunk}
+	if len(writes) != len(want) || len(writes[0].data) != want[0] || len(writes[2].data) != want[2] {
+		t.Fatalf("expected chunks %v, got %d writes", want, len(writes))
+	}
+	if writes[0].lc != 248 {
+		t.Fatalf("expected full chunk Lc=248, got %d", writes[0].lc)
+	}
+	if !bytes.Equal(writtenData(t, writes, 0), data) {
+		t.Fatalf("file content mismatch after write")
+	}
+}
+
+func TestWriteFileDataSecureChunksPast16BitOffsets(t *testing.T) {
+	const start = 0xFF80
+	data := make([]byte, 3*writeSecureChunk+10)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	sess := testSession()
+	sess.cmdCtr = 5
+	tag := *sess
+	card := NewFakeCard(ssmExchanges(t, tag, CommModeFull, nil, nil, nil, nil)...)
+
+	if err := WriteFileDataSecure(card, sess, 0x03, start, data); err != nil {
+		t.Fatalf("WriteFileDataSecure returned error: %v", err)
+	}
+	writes := sentWrites(t, tag, CommModeFull, card.Sent)
+	if len(writes) != 4 {
+		t.Fatalf("expected 4 chunks, got %d", len(writes))
+	}
+	for i, w := range writes {
+		if want := start + i*writeSecureChunk; w.off != want {
+			t.Fatalf("chunk %d: expected offset 0x%X, got 0x%X", i, want, w.off)
+		}
+		if want := uint16(5 + i); w.ctr != want {
+			t.Fatalf("chunk %d: expected cmdCtr %d, got %d", i, want, w.ctr)
+		}
+	}
+	if writes[1].off <= 0xFFFF {
+		t.Fatalf("expected later chunks past 0xFFFF, got offset 0x%X", writes[1].off)
+	}
+	if sess.cmdCtr != 9 {
+		t.Fatalf("expected cmdCtr 9 after 4 chunks, got %d", sess.cmdCtr)
+	}
+	if !bytes.Equal(writtenData(t, writes, start), data) {
+		t.Fatalf("file content mismatch after write")
+	}
+
+	if err := WriteFileDataSecure(card, sess, 0x03, 0xFFFFF0, make([]byte, 0x11)); err == nil {
+		t.Fatal("expected a write running past 0xFFFFFF to be rejected")
+	}
+	if len(card.Sent) != 4 {
+		t.Fatalf("expected nothing sent for the rejected write, got %d APDUs", len(card.Sent))
+	}
+}
+
+func TestWriteFileDataSecureVerifiedDetectsMismatch(t *testing.T) {
+	sess := testSession()
+	data := bytes.Repeat([]byte{0x11}, 200)
+	corrupted := append([]byte{0xEE}, data[1:]...) // the tag stored a flipped first byte
+	card := NewFakeCard(ssmExchanges(t, *sess, CommModeFull, nil, corrupted[:128], corrupted[128:])...)
+
+	if err := WriteFileDataSecureVerified(card, sess, 0x03, 0, data); err == nil {
+		t.Fatalf("expected verification error")
+	}
+}
+
+func TestWriteFileDataMACSendsCleartext(t *testing.T) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sess := testSession()
+	tag := *sess
+	card := NewFakeCard(ssmExchanges(t, tag, CommModeMAC, nil, nil)...)
+
+	if err := WriteFileDataMAC(card, sess, 0x03, 10, data); err != nil {
+		t.Fatalf("WriteFileDataMAC returned error: %v", err)
+	}
+	writes := sentWrites(t, tag, CommModeMAC, card.Sent)
+	if !bytes.Equal(writtenData(t, writes, 10), data) {
+		t.Fatalf("file content mismatch after write")
+	}
+	if len(writes) != 2 || len(writes[0].data) != writeMACChunk || len(writes[1].data) != 300-writeMACChunk {
+		t.Fatalf("expected chunks [%d %d], got %d writes", writeMACChunk, 300-writeMACChunk, len(writes))
+	}
+	if writes[0].lc != 255 {
+		t.Fatalf("expected full chunk Lc=255, got %d", writes[0].lc)
+	}
+	if sess.cmdCtr != 2 {
+		t.Fatalf("expected cmdCtr 2, got %d", sess.cmdCtr)
+	}
+}
+
+func TestSelectApplicationAPDUs(t *testing.T) {
+	var sent [][]byte
+	sw := []byte{0x90, 0x00}
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		sent = append(sent, append([]byte{}, apdu...))
+		return sw, nil
+	})
+
+	if err := SelectApplicationISO(card, []byte{0xA0, 0x00, 0x00, 0x03, 0x96}); err != nil {
+		t.Fatalf("SelectApplicationISO returned error: %v", err)
+	}
+	if err := SelectNDEFApp(card); err != nil {
+		t.Fatalf("SelectNDEFApp returned error: %v", err)
+	}
+	sw = []byte{0x91, 0x00}
+	if err := SelectApplicationAID(card, []byte{0x56, 0x34, 0x12}); err != nil {
+		t.Fatalf("SelectApplicationAID returned error: %v", err)
+	}
+
+	want := [][]byte{
+		{0x00, 0xA4, 0x04, 0x00, 0x05, 0xA0, 0x00, 0x00, 0x03, 0x96, 0x00},
+		{0x00, 0xA4, 0x04, 0x00, 0x07, 0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01, 0x00},
+		{0x90, 0x5A, 0x00, 0x00, 0x03, 0x56, 0x34, 0x12, 0x00},
+	}
+	for i := range want {
+		if !bytes.Equal(sent[i], want[i]) {
+			t.Fatalf("APDU %d: expected % X, got % X", i, want[i], sent[i])
+		}
+	}
+}
+
+func TestSelectApplicationErrors(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0x5A {
+			return []byte{0x91, 0xA0}, nil // APPLICATION_NOT_FOUND
+		}
+		return []byte{0x6A, 0x82}, nil
+	})
+
+	if err := SelectApplicationAID(card, []byte{0x01, 0x02}); err == nil {
+		t.Fatalf("expected error for 2-byte AID")
+	}
+	if err := SelectApplicationISO(card, nil); err == nil {
+		t.Fatalf("expected error for empty DF name")
+	}
+
+	var swErr *SWError
+	if err := SelectApplicationAID(card, []byte{0x01, 0x02, 0x03}); !errors.As(err, &swErr) || swErr.SW != 0x91A0 {
+		t.Fatalf("expected SWError 91A0, got %v", err)
+	}
+	if err := SelectApplicationISO(card, []byte{0xA0, 0x00}); !errors.As(err, &swErr) || swErr.SW != SWFileNotFound {
+		t.Fatalf("expected SWError 6A82, got %v", err)
+	}
+}
+
+// isoNDEFTag emulates ISO SELECT / READ BINARY / UPDATE BINARY over a CC
+// file (E103) and an NDEF file (E104).
+type isoNDEFTag struct {
+	t        *testing.T
+	files    map[uint16][]byte
+	selected uint16
+	writes   [][2]int // offset, length of each UPDATE BINARY
+}
+
+func newISONDEFTag(t *testing.T, ndefSize int) *isoNDEFTag {
+	cc := ccWithNDEFFile(0xE104)
+	cc[11], cc[12] = byte(ndefSize>>8), byte(ndefSize)
+	return &isoNDEFTag{t: t, files: map[uint16][]byte{0xE103: cc, 0xE104: make([]byte, ndefSize)}}
+}
+
+func (f *isoNDEFTag) Transmit(apdu []byte) ([]byte, error) {
+	switch apdu[1] {
+	case 0xA4:
+		if apdu[2] == 0x00 {
+			f.selected = uint16(apdu[5])<<8 | uint16(apdu[6])
+		}
+		return []byte{0x90, 0x00}, nil
+	case 0xB0:
+		off, n := int(apdu[2])<<8|int(apdu[3]), int(apdu[4])
+		return append(append([]byte{}, f.files[f.selected][off:off+n]...), 0x90, 0x00), nil
+	case 0xD6:
+		off, n := int(apdu[2])<<8|int(apdu[3]), int(apdu[4])
+		file := f.files[f.selected]
+		if off+n > len(file) {
+			return []byte{0x6A, 0x82}, nil
+		}
+		copy(file[off:], apdu[5:5+n])
+		f.writes = append(f.writes, [2]int{off, n})
+		return []byte{0x90, 0x00}, nil
+	}
+	f.t.Fatalf("unexpected APDU % X", apdu)
+	return nil, nil
+}
+
+func TestWriteNDEFMessageAtMaxSize(t *testing.T) {
+	tag := newISONDEFTag(t, 256)
+	payload := bytes.Repeat([]byte{0x5A}, 254)
+
+	if err := WriteNDEFMessage(tag, payload); err != nil {
+		t.Fatalf("WriteNDEFMessage returned error: %v", err)
+	}
+	file := tag.files[0xE104]
+	if file[0] != 0x00 || file[1] != 0xFE || !bytes.Equal(file[2:], payload) {
+		t.Fatalf("expected NLEN 00FE followed by payload, got % X", file[:4])
+	}
+	// NLEN cleared first, payload at offset 2, NLEN written last
+	want := [][2]int{{0, 2}, {2, 254}, {0, 2}}
+	if len(tag.writes) != len(want) {
+		t.Fatalf("expected writes %v, got %v", want, tag.writes)
+	}
+	for i := range want {
+		if tag.writes[i] != want[i] {
+			t.Fatalf("expected writes %v, got %v", want, tag.writes)
+		}
+	}
+}
+
+func TestWriteNDEFMessagePastMaxSizeWritesNothing(t *testing.T) {
+	tag := newISONDEFTag(t, 256)
+
+	err := WriteNDEFMessage(tag, bytes.Repeat([]byte{0x5A}, 255))
+	if err == nil {
+		t.Fatalf("expected error for payload one byte past MaxNDEFSize")
+	}
+	if len(tag.writes) != 0 {
+		t.Fatalf("expected no writes, got %v", tag.writes)
+	}
+}
+
+func TestWriteNDEFPlainVerified(t *testing.T) {
+	msg := bytes.Repeat([]byte{0x5A}, 400)
+	data := append([]byte{0x01, 0x90}, msg...)
+
+	if err := WriteNDEFPlainVerified(newISONDEFTag(t, 512), data); err != nil {
+		t.Fatalf("WriteNDEFPlainVerified returned error: %v", err)
+	}
+
+	// Second chunk (offset 255) loses its last byte, like a reader that drops
+	// bits on a long write.
+	tag := newISONDEFTag(t, 512)
+	updates := 0
+	corrupting := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xD6 {
+			updates++
+			if updates == 2 {
+				apdu = append([]byte{}, apdu...)
+				apdu[len(apdu)-1] ^= 0xFF
+			}
+		}
+		return tag.Transmit(apdu)
+	})
+	err := WriteNDEFPlainVerified(corrupting, data)
+	var mismatch *NDEFMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected *NDEFMismatchError, got %v", err)
+	}
+	if mismatch.Offset != len(data)-3 || mismatch.Wrote != 400 || mismatch.Read != 400 {
+		t.Fatalf("expected mismatch at message offset %d, got %+v", len(data)-3, mismatch)
+	}
+
+	if err := WriteNDEFPlainVerified(newISONDEFTag(t, 512), []byte{0x00, 0x05, 0xD1}); err == nil {
+		t.Fatalf("expected error when NLEN exceeds the supplied message")
+	}
+}
+
+func TestResumeNDEFMessageAfterFailedChunk(t *testing.T) {
+	tag := newISONDEFTag(t, 600)
+	payload := make([]byte, 520) // three UPDATE BINARY chunks: 255, 255, 10
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	updates := 0
+	failing := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xD6 {
+			updates++
+			if updates == 3 { // NLEN clear, chunk 1, then chunk 2 fails
+				return nil, errors.New("reader removed")
+			}
+		}
+		return tag.Transmit(apdu)
+	})
+	err := WriteNDEFMessage(failing, payload)
+	var perr *PartialWriteError
+	if !errors.As(err, &perr) || perr.Written != 255 {
+		t.Fatalf("expected PartialWriteError after 255 bytes, got %v", err)
+	}
+	if nlen := tag.files[0xE104][:2]; nlen[0] != 0 || nlen[1] != 0 {
+		t.Fatalf("expected NLEN to stay zero after the failed write, got % X", nlen)
+	}
+
+	tag.writes = nil
+	if err := ResumeNDEFMessage(tag, payload, perr.Written); err != nil {
+		t.Fatalf("ResumeNDEFMessage returned error: %v", err)
+	}
+	wantWrites := [][2]int{{0, 2}, {257, 255}, {512, 10}, {0, 2}}
+	if len(tag.writes) != len(wantWrites) {
+		t.Fatalf("expected writes %v, got %v", wantWrites, tag.writes)
+	}
+	for i := range wantWrites {
+		if tag.writes[i] != wantWrites[i] {
+			t.Fatalf("expected writes %v, got %v", wantWrites, tag.writes)
+		}
+	}
+	got, err := ReadNDEF(tag)
+	if err != nil {
+		t.Fatalf("ReadNDEF returned error: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("expected resumed message to match payload")
+	}
+}
+
+func TestWriteNDEFDataAtWritesFromOffset(t *testing.T) {
+	tag := newISONDEFTag(t, 600)
+	tag.selected = 0xE104
+	if err := WriteNDEFDataAt(tag, 300, bytes.Repeat([]byte{0xA5}, 260)); err != nil {
+		t.Fatalf("WriteNDEFDataAt returned error: %v", err)
+	}
+	want := [][2]int{{300, 255}, {555, 5}}
+	if len(tag.writes) != 2 || tag.writes[0] != want[0] || tag.writes[1] != want[1] {
+		t.Fatalf("expected writes %v, got %v", want, tag.writes)
+	}
+}
+
+func TestGetApplicationIDsTwoFrames(t *testing.T) {
+	// 21 AIDs do not fit one frame: 19 arrive first with 91AF, then 2 more.
+	var first []byte
+	for i := 1; i <= 19; i++ {
+		first = append(first, byte(i), 0x00, 0xF0)
+	}
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x90, 0x6A, 0x00, 0x00, 0x00}, Response: append(first, 0x91, 0xAF)},
+		FakeExchange{Command: []byte{0x90, 0xAF, 0x00, 0x00, 0x00}, Response: []byte{0x56, 0x34, 0x12, 0x01, 0x76, 0xD2, 0x91, 0x00}},
+	)
+
+	aids, err := GetApplicationIDs(card)
+	if err != nil {
+		t.Fatalf("GetApplicationIDs returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if len(aids) != 21 {
+		t.Fatalf("expected 21 AIDs, got %d", len(aids))
+	}
+	if !bytes.Equal(aids[0], []byte{0x01, 0x00, 0xF0}) || !bytes.Equal(aids[19], []byte{0x56, 0x34, 0x12}) || !bytes.Equal(aids[20], []byte{0x01, 0x76, 0xD2}) {
+		t.Fatalf("unexpected AIDs: % X, % X, % X", aids[0], aids[19], aids[20])
+	}
+}
+
+func TestGetApplicationIDsUnsupported(t *testing.T) {
+	// NTAG 424 DNA rejects the command as illegal.
+	aids, err := GetApplicationIDs(NewFakeCard(FakeExchange{Response: []byte{0x91, 0x1C}}))
+	if err != nil || len(aids) != 0 {
+		t.Fatalf("expected no AIDs and no error, got %v, %v", aids, err)
+	}
+	files, err := GetFileIDs(NewFakeCard(FakeExchange{Response: []byte{0x6D, 0x00}}))
+	if err != nil || len(files) != 0 {
+		t.Fatalf("expected no files and no error, got %v, %v", files, err)
+	}
+
+	var swErr *SWError
+	if _, err := GetApplicationIDs(NewFakeCard(FakeExchange{Response: []byte{0x91, 0xCA}})); !errors.As(err, &swErr) || swErr.SW != SWCommandAbort {
+		t.Fatalf("expected SWError 91CA, got %v", err)
+	}
+	if _, err := GetApplicationIDs(NewFakeCard(FakeExchange{Response: []byte{0x01, 0x02, 0x91, 0x00}})); err == nil {
+		t.Fatal("expected error for a truncated AID")
+	}
+}
+
+func TestReadNDEFWithLayoutStandardAndTLV(t *testing.T) {
+	msg, err := BuildNDEFMessage([]NDEFRecord{NewURIRecord("https://example.com/t")})
+	if err != nil {
+		t.Fatalf("BuildNDEFMessage returned error: %v", err)
+	}
+	want := msg[2:]
+
+	standard := newISONDEFTag(t, 64)
+	copy(standard.files[0xE104], msg)
+
+	// NULL TLV padding, a Lock Control TLV, then the NDEF Message TLV
+	tlv := newISONDEFTag(t, 64)
+	file := []byte{0x00, 0x01, 0x03, 0xA0, 0x10, 0x44, 0x03, byte(len(want))}
+	file = append(append(file, want...), 0xFE)
+	copy(tlv.files[0xE104], file)
+
+	// A file from another toolchain whose CC has no NDEF File Control TLV
+	// first is read from the default file E104.
+	foreign := newISONDEFTag(t, 64)
+	copy(foreign.files[0xE104], file)
+	foreign.files[0xE103][7] = 0x05
+
+	for _, tt := range []struct {
+		name   string
+		tag    *isoNDEFTag
+		layout NDEFLayout
+	}{
+		{"standard", standard, NDEFLayoutStandardNLEN2},
+		{"tlv", tlv, NDEFLayoutTLV},
+		{"tlv with foreign CC", foreign, NDEFLayoutTLV},
+	} {
+		got, err := ReadNDEFWithLayout(tt.tag, tt.layout)
+		if err != nil {
+			t.Fatalf("%s: ReadNDEFWithLayout returned error: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: expected % X, got % X", tt.name, want, got)
+		}
+	}
+
+	// A terminator before any NDEF TLV is an empty file.
+	empty := newISONDEFTag(t, 64)
+	empty.files[0xE104][0] = 0xFE
+	if got, err := ReadNDEFWithLayout(empty, NDEFLayoutTLV); err != nil || len(got) != 0 {
+		t.Fatalf("expected empty message, got % X, %v", got, err)
+	}
+}
+
+func TestWriteNDEFMessageWithLayoutTLV(t *testing.T) {
+	for _, size := range []int{20, 300} {
+		tag := newISONDEFTag(t, 512)
+		payload := bytes.Repeat([]byte{0x5A}, size)
+
+		if err := WriteNDEFMessageWithLayout(tag, payload, NDEFLayoutTLV); err != nil {
+			t.Fatalf("%d bytes: WriteNDEFMessageWithLayout returned error: %v", size, err)
+		}
+		hdr := []byte{0x03, byte(size)}
+		if size >= 0xFF {
+			hdr = []byte{0x03, 0xFF, byte(size >> 8), byte(size)}
+		}
+		file := tag.files[0xE104]
+		if !bytes.Equal(file[:len(hdr)], hdr) || file[len(hdr)+size] != 0xFE {
+			t.Fatalf("%d bytes: expected TLV % X ... FE, got % X", size, hdr, file[:len(hdr)+1])
+		}
+		// Empty TLV first, payload and terminator next, real header last
+		if tag.writes[0] != [2]int{0, 2} || tag.writes[len(tag.writes)-1] != [2]int{0, len(hdr)} {
+			t.Fatalf("%d bytes: unexpected write order %v", size, tag.writes)
+		}
+		got, err := ReadNDEFWithLayout(tag, NDEFLayoutTLV)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("%d bytes: read back % X, %v", size, got, err)
+		}
+	}
+}
+
+func TestListAndReadAllFileSettings(t *testing.T) {
+	ars := map[byte][2]byte{0x01: {0x00, 0xE0}, 0x02: {0xE0, 0xEE}, 0x03: {0x30, 0x23}, 0x05: {0x11, 0x11}}
+	refuse := map[byte]bool{}
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0x6F:
+			return []byte{0x01, 0x02, 0x03, 0x05, 0x91, 0x00}, nil
+		case 0xF5:
+			fileNo := apdu[5]
+			if refuse[fileNo] {
+				return []byte{0x91, 0x9D}, nil
+			}
+			ar := ars[fileNo]
+			return settingsAPDUResponse(0x00, ar[0], ar[1], 32*int(fileNo)), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	all, err := ListAndReadAllFileSettings(card, nil)
+	if err != nil {
+		t.Fatalf("ListAndReadAllFileSettings returned error: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected settings for files 1, 2, 3 and 5, got %d", len(all))
+	}
+	for fileNo, ar := range ars {
+		fs := all[fileNo]
+		if fs == nil || fs.AR1 != ar[0] || fs.AR2 != ar[1] || fs.Size != 32*int(fileNo) {
+			t.Fatalf("file %d: unexpected settings %+v", fileNo, fs)
+		}
+	}
+
+	// A file needing authentication is left out; the rest are still returned.
+	refuse[0x05] = true
+	all, err = ListAndReadAllFileSettings(card, nil)
+	if err == nil || !strings.Contains(err.Error(), "file 5") {
+		t.Fatalf("expected an error naming file 5, got %v", err)
+	}
+	if len(all) != 3 || all[0x05] != nil {
+		t.Fatalf("expected files 1-3 only, got %d entries", len(all))
+	}
+}
+
+func TestListFileIDsFallsBackToNTAG424Files(t *testing.T) {
+	card := NewFakeCard(FakeExchange{Command: []byte{0x90, 0x6F, 0x00, 0x00, 0x00}, Response: []byte{0x91, 0x1C}})
+	ids, err := ListFileIDs(card, nil)
+	if err != nil || !bytes.Equal(ids, []byte{0x01, 0x02, 0x03}) {
+		t.Fatalf("expected files 1-3, got % X, %v", ids, err)
+	}
+}
+
+func TestListFileIDsInSessionReturnsRefusal(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	refused := false
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if refused {
+			t.Fatalf("command % X sent after the refusal ended the session", apdu)
+		}
+		if apdu[1] != 0x6F {
+			t.Fatalf("unexpected APDU % X", apdu)
+		}
+		ssmCheckMACCommand(t, &tag, apdu)
+		refused = true
+		return []byte{0x91, 0x1C}, nil
+	})
+
+	ids, err := ListFileIDs(card, sess)
+	var swErr *SWError
+	if !errors.As(err, &swErr) || swErr.SW != SWBoundaryError {
+		t.Fatalf("expected the 91 1C refusal, got % X, %v", ids, err)
+	}
+	if _, err := ListAndReadAllFileSettings(apduFunc(func(apdu []byte) ([]byte, error) {
+		return []byte{0x91, 0x1C}, nil
+	}), testSession()); err == nil {
+		t.Fatal("expected ListAndReadAllFileSettings to fail when the listing is refused in a session")
+	}
+}
@@ -0,0 +1,95 @@
+package ntag424
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// KeyProvider supplies the key to provision into a key slot of one tag, so a
+// provider can hand out the same key everywhere or a key per tag.
+//
+// uid is the tag's real 7-byte UID as ProvisioningUID returns it: the UID
+// RealUID reads for registration and the tag mirrors into SDM URLs, never
+// the random ID GET DATA gives on a tag with random ID enabled. A backend
+// deriving keys from a registered or tapped UID therefore gets the same keys.
+type KeyProvider interface {
+	KeyForSlot(uid []byte, slot byte) ([]byte, error)
+}
+
+// StaticKeyProvider gives every tag the same key per slot, as loaded from
+// key files. The UID is ignored.
+type StaticKeyProvider map[byte][]byte
+
+// KeyForSlot implements KeyProvider.
+func (p StaticKeyProvider) KeyForSlot(_ []byte, slot byte) ([]byte, error) {
+	key, ok := p[slot]
+	if !ok {
+		return nil, fmt.Errorf("no key for slot %d", slot)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("key for slot %d must be 16 bytes, got %d", slot, len(key))
+	}
+	return append([]byte(nil), key...), nil
+}
+
+// DiversifiedKeyProvider derives each tag's keys from per-slot master keys
+// with DiversifyForTag (AN10922), so no per-tag key has to be stored: the
+// backend derives the same key from the master key and the UID. Use the
+// same master key for every slot to derive everything from a single seed;
+// the slot number is part of the diversification input either way.
+type DiversifiedKeyProvider struct {
+	MasterKeys map[byte][]byte
+	AID        []byte // Diversification AID; nil means the NDEF application DF name
+}
+
+// KeyForSlot implements KeyProvider.
+func (p DiversifiedKeyProvider) KeyForSlot(uid []byte, slot byte) ([]byte, error) {
+	master, ok := p.MasterKeys[slot]
+	if !ok {
+		return nil, fmt.Errorf("no master key for slot %d", slot)
+	}
+	aid := p.AID
+	if aid == nil {
+		aid, _ = hex.DecodeString(ndefAppAID)
+	}
+	key, err := DiversifyForTag(master, uid, aid, slot)
+	if err != nil {
+		return nil, fmt.Errorf("key slot %d: %w", slot, err)
+	}
+	return key, nil
+}
+
+// ProvisioningUID returns the UID to derive a tag's keys from: its real
+// 7-byte UID, the one RealUID reads for registration and a backend later
+// derives the same keys from. GET DATA gives it directly unless random ID
+// is enabled; then it selects the NDEF application, authenticates slot 0
+// with the factory key (or, if that fails, the slot 0 key keys gives for
+// the random ID, which only a UID-independent provider such as
+// StaticKeyProvider gets right) and reads it with GetCardUID.
+func ProvisioningUID(card Card, keys KeyProvider) ([]byte, error) {
+	uid, err := GetUID(card)
+	if err != nil {
+		return nil, err
+	}
+	if !IsRandomUID(uid) {
+		return uid, nil
+	}
+	if err := SelectNDEFApp(card); err != nil {
+		return nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, err := AuthenticateEV2First(card, make([]byte, 16), 0)
+	if err != nil {
+		key, kerr := keys.KeyForSlot(uid, 0)
+		if kerr != nil {
+			return nil, fmt.Errorf("random ID %X: factory key failed (%v) and no slot 0 key: %w", uid, err, kerr)
+		}
+		if sess, err = AuthenticateEV2First(card, key, 0); err != nil {
+			return nil, fmt.Errorf("random ID %X: neither the factory key nor the slot 0 key opens the tag to read its real UID: %w", uid, err)
+		}
+	}
+	realUID, err := GetCardUID(card, sess)
+	if err != nil {
+		return nil, fmt.Errorf("random ID %X: read real UID: %w", uid, err)
+	}
+	return realUID, nil
+}
@@ -0,0 +1,145 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStaticKeyProvider(t *testing.T) {
+	sdm := bytes.Repeat([]byte{0x11}, 16)
+	p := StaticKeyProvider{0: make([]byte, 16), 1: sdm}
+
+	for _, uid := range [][]byte{testUID, {0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}} {
+		got, err := p.KeyForSlot(uid, 1)
+		if err != nil {
+			t.Fatalf("KeyForSlot returned error: %v", err)
+		}
+		if !bytes.Equal(got, sdm) {
+			t.Fatalf("expected the loaded slot 1 key for UID % X, got % X", uid, got)
+		}
+		got[0] = 0xFF // must not alias the provider's key
+	}
+	if sdm[0] != 0x11 {
+		t.Fatal("expected KeyForSlot to return a copy")
+	}
+	if _, err := p.KeyForSlot(testUID, 2); err == nil {
+		t.Fatal("expected an error for a slot without a key")
+	}
+	if _, err := (StaticKeyProvider{3: make([]byte, 8)}).KeyForSlot(testUID, 3); err == nil {
+		t.Fatal("expected an error for an 8-byte key")
+	}
+}
+
+// Expected key computed independently with openssl (AN10922 CMAC over
+// 01 || UID || D2760000850101 || 01, padded, last block masked with K2).
+func TestDiversifiedKeyProvider(t *testing.T) {
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	p := DiversifiedKeyProvider{MasterKeys: map[byte][]byte{0: master, 1: master}}
+
+	got, err := p.KeyForSlot(testUID, 1)
+	if err != nil {
+		t.Fatalf("KeyForSlot returned error: %v", err)
+	}
+	if want := mustHex(t, "18A0316487CBDCDCE73A4E11F3B547F8"); !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+
+	slot0, _ := p.KeyForSlot(testUID, 0)
+	other, _ := p.KeyForSlot([]byte{0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, 1)
+	if bytes.Equal(slot0, got) || bytes.Equal(other, got) {
+		t.Fatal("expected distinct keys per slot and per tag from one master key")
+	}
+
+	custom := DiversifiedKeyProvider{MasterKeys: p.MasterKeys, AID: mustHex(t, "3042F5")}
+	gotCustom, err := custom.KeyForSlot(testUID, 1)
+	if err != nil {
+		t.Fatalf("KeyForSlot returned error: %v", err)
+	}
+	want, _ := DiversifyForTag(master, testUID, mustHex(t, "3042F5"), 1)
+	if !bytes.Equal(gotCustom, want) {
+		t.Fatalf("expected custom AID to be used, got % X want % X", gotCustom, want)
+	}
+
+	if _, err := p.KeyForSlot(testUID, 2); err == nil {
+		t.Fatal("expected an error for a slot without a master key")
+	}
+}
+
+// getDataExchange scripts GET DATA answered with uid.
+func getDataExchange(t *testing.T, uid []byte) FakeExchange {
+	return FakeExchange{Command: mustHex(t, "FFCA000000"), Response: append(append([]byte{}, uid...), 0x90, 0x00)}
+}
+
+// randomIDExchanges scripts ProvisioningUID on a tag with random ID enabled
+// whose slot 0 holds cardKey: GET DATA answers randomID, then each of
+// tryKeys is tried on slot 0 in turn, and on a match GetCardUID returns the
+// real testUID.
+func randomIDExchanges(t *testing.T, randomID, cardKey []byte, tryKeys ...[]byte) []FakeExchange {
+	t.Helper()
+	script := []FakeExchange{getDataExchange(t, randomID), selectNDEFAppExchange}
+	for _, k := range tryKeys {
+		auth, sess := authExchanges(t, 0, cardKey, k)
+		script = append(script, auth...)
+		if sess != nil {
+			return append(script, ssmExchanges(t, *sess, CommModeFull, testUID)...)
+		}
+	}
+	return script
+}
+
+func TestProvisioningUIDRandomID(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	diversified := DiversifiedKeyProvider{MasterKeys: map[byte][]byte{0: master}}
+	randomID := []byte{0x08, 0x12, 0x34, 0x56}
+	factory := make([]byte, 16)
+
+	// Factory tag: the factory key opens it and keys come from the real UID.
+	card := NewFakeCard(randomIDExchanges(t, randomID, factory, factory)...)
+	uid, err := ProvisioningUID(card, diversified)
+	if err != nil {
+		t.Fatalf("ProvisioningUID returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uid, testUID) {
+		t.Fatalf("expected the GetCardUID UID % X, got % X", testUID, uid)
+	}
+	fromReal, _ := diversified.KeyForSlot(uid, 0)
+	fromRandom, _ := diversified.KeyForSlot(randomID, 0)
+	if bytes.Equal(fromReal, fromRandom) {
+		t.Fatal("expected keys derived from the real UID to differ from the random ID's")
+	}
+
+	// Provisioned with static keys: the loaded slot 0 key opens it.
+	static := StaticKeyProvider{0: bytes.Repeat([]byte{0x5C}, 16)}
+	card = NewFakeCard(randomIDExchanges(t, randomID, static[0], factory, static[0])...)
+	if uid, err := ProvisioningUID(card, static); err != nil || !bytes.Equal(uid, testUID) {
+		t.Fatalf("expected real UID with the static slot 0 key, got % X, %v", uid, err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Provisioned with diversified keys: the real UID cannot be read.
+	card = NewFakeCard(randomIDExchanges(t, randomID, fromReal, factory, fromRandom)...)
+	if _, err := ProvisioningUID(card, diversified); err == nil {
+		t.Fatal("expected an error for a provisioned random-ID tag with diversified keys")
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvisioningUIDFixedUID(t *testing.T) {
+	// Only GET DATA is scripted: a fixed UID needs nothing else.
+	card := NewFakeCard(getDataExchange(t, testUID))
+	uid, err := ProvisioningUID(card, StaticKeyProvider{})
+	if err != nil || !bytes.Equal(uid, testUID) {
+		t.Fatalf("expected GET DATA UID % X, got % X, %v", testUID, uid, err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,7 +2,9 @@ package ntag424
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -11,12 +13,33 @@ import (
 	"strings"
 )
 
-// KeyFile represents a key loaded from a .hex file.
+// KeyFile represents a key loaded from a .hex or .json file.
 type KeyFile struct {
 	Name string // File name (e.g., "key0.hex")
 	Key  []byte // 16-byte AES key
 }
 
+// KeyEntry is a key together with the metadata a .json key file declares.
+// Keys loaded from .hex files have Version 0, no Role and Slot -1.
+type KeyEntry struct {
+	KeyFile
+	Version byte   // Key version written with the key
+	Role    string // Declared role (e.g. "AppMaster"), empty if unknown
+	Slot    int    // Declared key slot (0-4), -1 if unknown
+}
+
+// keyJSONFile is the on-disk layout of a .json key file:
+//
+//	{"key":"00112233445566778899AABBCCDDEEFF","version":1,"role":"AppMaster","slot":0}
+//
+// Only key is required.
+type keyJSONFile struct {
+	Key     string `json:"key"`
+	Version *int   `json:"version"`
+	Role    string `json:"role"`
+	Slot    *int   `json:"slot"`
+}
+
 // CRC32DESFire computes the CRC32 of data using the DESFire polynomial (0xEDB88320).
 // Used for key versioning in ChangeKey operations.
 // From update/internal/ntag/keys.go:13-27.
@@ -101,6 +124,86 @@ func LoadAllHexKeys(dir string) ([]KeyFile, error) {
 	return keys, nil
 }
 
+// LoadKeyJSONFile loads a key and its metadata from a .json key file.
+// Unknown fields, a key that is not 32 hex characters, a version outside
+// 0-255 and a slot outside 0-4 are errors.
+func LoadKeyJSONFile(path string) (*KeyEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := parseKeyJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	entry.Name = filepath.Base(path)
+	return entry, nil
+}
+
+func parseKeyJSON(content []byte) (*KeyEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	var raw keyJSONFile
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid key file: %v", err)
+	}
+
+	if len(raw.Key) != 32 {
+		return nil, fmt.Errorf("key must be 32 hex chars, got %d", len(raw.Key))
+	}
+	key, err := hex.DecodeString(raw.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex key: %v", err)
+	}
+	entry := &KeyEntry{KeyFile: KeyFile{Key: key}, Role: raw.Role, Slot: -1}
+	if raw.Version != nil {
+		if *raw.Version < 0 || *raw.Version > 0xFF {
+			return nil, fmt.Errorf("key version %d out of range 0-255", *raw.Version)
+		}
+		entry.Version = byte(*raw.Version)
+	}
+	if raw.Slot != nil {
+		if *raw.Slot < 0 || *raw.Slot > 4 {
+			return nil, fmt.Errorf("key slot %d out of range 0-4", *raw.Slot)
+		}
+		entry.Slot = *raw.Slot
+	}
+	return entry, nil
+}
+
+// LoadAllKeys loads all .hex and .json key files from a directory, sorted by
+// file name. Like LoadAllHexKeys it skips invalid files silently.
+func LoadAllKeys(dir string) ([]KeyEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []KeyEntry
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".hex":
+			key, err := LoadKeyHexFile(path)
+			if err != nil {
+				continue // Skip invalid key files
+			}
+			keys = append(keys, KeyEntry{KeyFile: KeyFile{Name: e.Name(), Key: key}, Slot: -1})
+		case ".json":
+			entry, err := LoadKeyJSONFile(path)
+			if err != nil {
+				continue // Skip invalid key files
+			}
+			keys = append(keys, *entry)
+		}
+	}
+
+	return keys, nil
+}
+
 // ChangeKey changes a key slot using DESFire ChangeKey (INS 0xC4) with cross-slot support.
 // This is the canonical version from keyswap/main.go:487-520.
 //
@@ -114,20 +217,18 @@ func LoadAllHexKeys(dir string) ([]KeyFile, error) {
 //   - authSlot: Slot used for authentication
 //
 // Key data format:
-//   - If changing same slot (keySlot == authSlot): XOR(16) + version(1) + CRC_new(4) + CRC_old(4) = 25 bytes
 //   - If changing different slot: XOR(16) + version(1) + CRC_new(4) = 21 bytes
+//   - If changing same slot (keySlot == authSlot): delegates to ChangeKeySame,
+//     NewKey(16) + version(1) = 17 bytes; oldKey is not sent
 //
-// Note: For same-slot changes, prefer ChangeKeySame which handles session invalidation correctly.
+// Note: A same-slot change invalidates the session; see ChangeKeySame.
 func ChangeKey(card Card, sess *Session, keySlot byte, newKey, oldKey []byte, keyVersion byte, authSlot byte) error {
-	changingSameKey := (keySlot == authSlot)
-
-	var keyData []byte
-	if changingSameKey {
-		keyData = make([]byte, 25) // XOR + version + CRC_new + CRC_old
-	} else {
-		keyData = make([]byte, 21) // XOR + version + CRC_new
+	if keySlot == authSlot {
+		return ChangeKeySame(card, sess, keySlot, newKey, keyVersion)
 	}
 
+	keyData := make([]byte, 21) // XOR + version + CRC_new
+
 	// XOR new and old keys
 	for i := 0; i < 16; i++ {
 		keyData[i] = newKey[i] ^ oldKey[i]
@@ -141,19 +242,42 @@ func ChangeKey(card Card, sess *Session, keySlot byte, newKey, oldKey []byte, ke
 	keyData[19] = byte((crcNew >> 16) & 0xFF)
 	keyData[20] = byte((crcNew >> 24) & 0xFF)
 
-	// CRC of old key (only if changing same slot)
-	if changingSameKey {
-		crcOld := CRC32DESFire(oldKey)
-		keyData[21] = byte(crcOld & 0xFF)
-		keyData[22] = byte((crcOld >> 8) & 0xFF)
-		keyData[23] = byte((crcOld >> 16) & 0xFF)
-		keyData[24] = byte((crcOld >> 24) & 0xFF)
-	}
-
 	_, err := SsmCmdFull(card, sess, 0xC4, []byte{keySlot}, keyData)
 	return err
 }
 
+// maxKeySlot is the highest application key number on an NTAG 424 DNA (five
+// AES keys, 0-4).
+const maxKeySlot = 4
+
+// ChangeKeyVersioned is the canonical entry point for changing a key: it
+// validates its arguments and then calls ChangeKey, so every tool writes the
+// key version the same way. The tag stores newVersion with the key; keep it
+// consistent across rotations so the version read back with GetKeyVersion
+// (INS 0x64) tells you which key is loaded. 0x00 is the factory default.
+//
+// Key data layout (see ChangeKey):
+//   - keySlot != authSlot: XOR(16) + newVersion(1) + CRC_new(4) = 21 bytes
+//   - keySlot == authSlot: NewKey(16) + newVersion(1) = 17 bytes
+//
+// For a same-slot change prefer RotateKeySame, which also deals with the
+// session the change invalidates.
+func ChangeKeyVersioned(card Card, sess *Session, keySlot byte, newKey, oldKey []byte, newVersion byte, authSlot byte) error {
+	if sess == nil {
+		return ErrNoSession
+	}
+	if keySlot > maxKeySlot || authSlot > maxKeySlot {
+		return fmt.Errorf("key slot must be 0-%d, got keySlot=%d authSlot=%d", maxKeySlot, keySlot, authSlot)
+	}
+	if len(newKey) != 16 {
+		return fmt.Errorf("new key must be 16 bytes, got %d", len(newKey))
+	}
+	if len(oldKey) != 16 {
+		return fmt.Errorf("old key must be 16 bytes, got %d", len(oldKey))
+	}
+	return ChangeKey(card, sess, keySlot, newKey, oldKey, newVersion, authSlot)
+}
+
 // ChangeKeySame changes the same key slot used for authentication.
 // This is the canonical version from keyswap/main.go:522-595.
 //
@@ -174,7 +298,7 @@ func ChangeKey(card Card, sess *Session, keySlot byte, newKey, oldKey []byte, ke
 // format is different (no CMAC).
 func ChangeKeySame(card Card, sess *Session, keySlot byte, newKey []byte, keyVersion byte) error {
 	if sess == nil {
-		return errors.New("session is nil")
+		return ErrNoSession
 	}
 
 	// Build keyData: NewKey(16) + KeyVersion(1) — no XOR, no CRC
@@ -183,7 +307,7 @@ func ChangeKeySame(card Card, sess *Session, keySlot byte, newKey []byte, keyVer
 	keyData[16] = keyVersion
 
 	// Pad to 32 bytes
-	padded := padISO9797M2(keyData)
+	padded := PadISO9797M2(keyData)
 
 	// Build IVC (same as SsmCmdFull)
 	ivcIn := make([]byte, 16)
@@ -213,11 +337,11 @@ func ChangeKeySame(card Card, sess *Session, keySlot byte, newKey []byte, keyVer
 	macInput = append(macInput, encData...)
 
 	// Compute CMAC
-	cmac, err := aesCMAC(sess.kmac[:], macInput)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
 	if err != nil {
 		return err
 	}
-	mact := truncateOddBytes(cmac)
+	mact := TruncateOddBytes(cmac)
 
 	// Build APDU
 	dataLen := len(header) + len(encData) + len(mact)
@@ -244,6 +368,98 @@ func ChangeKeySame(card Card, sess *Session, keySlot byte, newKey []byte, keyVer
 	return nil
 }
 
+// RotateKeySame changes the key in keySlot while authenticated with that
+// same slot, then proves the change took effect.
+//
+// Steps:
+//  1. Select NDEF app and authenticate keySlot with oldKey
+//  2. ChangeKeySame (invalidates the session)
+//  3. Re-select NDEF app and authenticate keySlot with newKey
+//
+// An error from step 3 means the tag does not accept newKey; the message
+// says whether oldKey is still valid, i.e. whether the change was lost.
+// The caller must authenticate again before any further secure command.
+func RotateKeySame(card Card, keySlot byte, oldKey, newKey []byte, keyVersion byte) error {
+	if err := SelectNDEFApp(card); err != nil {
+		return fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, err := AuthenticateEV2First(card, oldKey, keySlot)
+	if err != nil {
+		return fmt.Errorf("authenticate slot %d with old key: %w", keySlot, err)
+	}
+	if err := ChangeKeySame(card, sess, keySlot, newKey, keyVersion); err != nil {
+		return fmt.Errorf("change key slot %d: %w", keySlot, err)
+	}
+
+	if err := SelectNDEFApp(card); err != nil {
+		return fmt.Errorf("re-select NDEF app after key change: %w", err)
+	}
+	if _, err := AuthenticateEV2First(card, newKey, keySlot); err != nil {
+		if oldValid, _ := VerifyKeyByReauth(card, keySlot, oldKey); oldValid {
+			return fmt.Errorf("verify slot %d: new key rejected and old key still valid, change did not take effect: %w", keySlot, err)
+		}
+		return fmt.Errorf("verify slot %d: new key rejected: %w", keySlot, err)
+	}
+	return nil
+}
+
+// GetKeyVersion reads the version stored with key slot keyNo using
+// GetKeyVersion (INS 0x64). With sess nil the command is sent plain, as the
+// tag allows outside an authenticated session; otherwise it goes in
+// CommMode.MAC and advances the session counter.
+//
+// The version is only a label written by ChangeKey: ChangeKey's key data
+// carries the new version, never the old one, so a slot changes the same
+// way whatever version it holds.
+func GetKeyVersion(card Card, sess *Session, keyNo byte) (byte, error) {
+	var data []byte
+	if sess == nil {
+		resp, sw, err := Transmit(card, []byte{0x90, 0x64, 0x00, 0x00, 0x01, keyNo, 0x00})
+		if err != nil {
+			return 0, err
+		}
+		if sw != SWDESFireOK {
+			return 0, &SWError{Cmd: 0x64, SW: sw}
+		}
+		data = resp
+	} else {
+		resp, err := SsmCmdMAC(card, sess, 0x64, []byte{keyNo}, nil)
+		if err != nil {
+			return 0, err
+		}
+		data = resp
+	}
+	if len(data) != 1 {
+		return 0, fmt.Errorf("GetKeyVersion response is %d bytes, expected 1", len(data))
+	}
+	return data[0], nil
+}
+
+// VerifyKeyByReauth reports whether key is the key in keySlot by selecting
+// the NDEF app and attempting EV2First on that slot.
+//
+// A rejected key (SW=91AE at step 2) is (false, nil). Anything else that
+// stops the attempt (select failure, transmit error, a slot that does not
+// exist, SW=91AD authentication delay) is returned as an error, since it
+// says nothing about the key. The session is discarded either way; the
+// caller must authenticate again before any secure command.
+func VerifyKeyByReauth(card Card, keySlot byte, key []byte) (bool, error) {
+	if len(key) != 16 {
+		return false, fmt.Errorf("key must be 16 bytes, got %d", len(key))
+	}
+	if err := SelectNDEFApp(card); err != nil {
+		return false, fmt.Errorf("select NDEF app: %w", err)
+	}
+	_, err := AuthenticateEV2First(card, key, keySlot)
+	if err == nil {
+		return true, nil
+	}
+	if step, sw, _, ok := ClassifyAuthError(err); ok && step == "step2" && sw == SWAuthError {
+		return false, nil
+	}
+	return false, fmt.Errorf("authenticate slot %d: %w", keySlot, err)
+}
+
 // SessionFromEnv creates a Session from environment variables (for testing/debugging).
 // Environment variables:
 //   - NTAG_KENC: 32-character hex string (16 bytes)
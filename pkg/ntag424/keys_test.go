@@ -0,0 +1,464 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// keyTag emulates the parts of a tag needed for key changes: EV2First
+// authentication against its key slots, GetKeyVersion, and ChangeKey,
+// same-slot and (with slot 0 authenticated) cross-slot. Like a real tag, a
+// select, a same-slot ChangeKey or a failed command drops the session.
+type keyTag struct {
+	t          *testing.T
+	keys       [5][]byte
+	versions   [5]byte
+	authSlot   byte
+	sess       *Session
+	dropChange bool          // acknowledge ChangeKey without storing the new key
+	failChange map[byte]bool // answer ChangeKey on these slots with SW=91CA
+	ins        []byte
+}
+
+func newKeyTag(t *testing.T) *keyTag {
+	tag := &keyTag{t: t}
+	for i := range tag.keys {
+		tag.keys[i] = make([]byte, 16)
+	}
+	return tag
+}
+
+var keyTagRndB = bytes.Repeat([]byte{0xB7}, 16)
+
+func (k *keyTag) Transmit(apdu []byte) ([]byte, error) {
+	k.ins = append(k.ins, apdu[1])
+	iv0 := make([]byte, 16)
+	switch apdu[1] {
+	case 0xA4:
+		k.sess = nil
+		return []byte{0x90, 0x00}, nil
+	case 0x71:
+		k.sess = nil
+		k.authSlot = apdu[5]
+		enc, _ := aesCBCEncrypt(k.keys[k.authSlot], iv0, keyTagRndB)
+		return append(enc, 0x91, 0xAF), nil
+	case 0xAF:
+		key := k.keys[k.authSlot]
+		dec, _ := aesCBCDecrypt(key, iv0, apdu[5:37])
+		if !bytes.Equal(dec[16:], rotateLeft1(keyTagRndB)) {
+			return []byte{0x91, 0xAE}, nil
+		}
+		rndA := dec[:16]
+		plain := make([]byte, 32)
+		copy(plain, []byte{0x9D, 0x00, 0xC4, 0xDF})
+		copy(plain[4:], rotateLeft1(rndA))
+		enc, _ := aesCBCEncrypt(key, iv0, plain)
+
+		kenc, kmac, err := deriveSessionKeys(key, rndA, keyTagRndB)
+		if err != nil {
+			k.t.Fatalf("derive session keys: %v", err)
+		}
+		k.sess = &Session{ti: [4]byte{0x9D, 0x00, 0xC4, 0xDF}}
+		copy(k.sess.kenc[:], kenc)
+		copy(k.sess.kmac[:], kmac)
+		return append(enc, 0x91, 0x00), nil
+	case 0x64:
+		slot := apdu[5]
+		if k.sess == nil {
+			return []byte{k.versions[slot], 0x91, 0x00}, nil
+		}
+		ssmDecryptCommand(k.t, k.sess, apdu, 1)
+		resp := ssmMACResponse(k.t, k.sess, []byte{k.versions[slot]})
+		k.sess.cmdCtr++
+		return resp, nil
+	case 0xC4:
+		if k.sess == nil {
+			return []byte{0x91, 0xAE}, nil
+		}
+		keyData := ssmDecryptCommand(k.t, k.sess, apdu, 1)
+		slot := apdu[5]
+		if k.failChange[slot] {
+			k.sess = nil
+			return []byte{0x91, 0xCA}, nil
+		}
+		if slot != k.authSlot {
+			if k.authSlot != 0 {
+				k.t.Fatalf("keyTag only models cross-slot ChangeKey from slot 0, got auth slot %d", k.authSlot)
+			}
+			for i := range k.keys[slot] {
+				k.keys[slot][i] ^= keyData[i]
+			}
+			k.versions[slot] = keyData[16]
+			resp := ssmMACResponse(k.t, k.sess, nil)
+			k.sess.cmdCtr++
+			return resp, nil
+		}
+		if !k.dropChange {
+			k.keys[k.authSlot] = append([]byte{}, keyData[:16]...)
+			k.versions[k.authSlot] = keyData[16]
+		}
+		k.sess = nil
+		return []byte{0x91, 0x00}, nil
+	}
+	k.t.Fatalf("unexpected APDU % X", apdu)
+	return nil, nil
+}
+
+func TestChangeKeySameInvalidatesSession(t *testing.T) {
+	tag := newKeyTag(t)
+	sess, err := AuthenticateEV2First(tag, tag.keys[0], 0)
+	if err != nil {
+		t.Fatalf("AuthenticateEV2First returned error: %v", err)
+	}
+	newKey := bytes.Repeat([]byte{0x42}, 16)
+	if err := ChangeKeySame(tag, sess, 0, newKey, 0x01); err != nil {
+		t.Fatalf("ChangeKeySame returned error: %v", err)
+	}
+	if !bytes.Equal(tag.keys[0], newKey) {
+		t.Fatalf("expected slot 0 to hold the new key, got % X", tag.keys[0])
+	}
+
+	var swErr *SWError
+	if err := ChangeKeySame(tag, sess, 0, newKey, 0x01); !errors.As(err, &swErr) || swErr.SW != SWAuthError {
+		t.Fatalf("expected stale session to be rejected with 91AE, got %v", err)
+	}
+}
+
+func TestRotateKeySameReauthenticatesWithNewKey(t *testing.T) {
+	tag := newKeyTag(t)
+	oldKey := bytes.Repeat([]byte{0x11}, 16)
+	newKey := bytes.Repeat([]byte{0x22}, 16)
+	tag.keys[0] = oldKey
+
+	if err := RotateKeySame(tag, 0, oldKey, newKey, 0x01); err != nil {
+		t.Fatalf("RotateKeySame returned error: %v", err)
+	}
+	if !bytes.Equal(tag.keys[0], newKey) {
+		t.Fatalf("expected slot 0 to hold the new key, got % X", tag.keys[0])
+	}
+	want := []byte{0xA4, 0x71, 0xAF, 0xC4, 0xA4, 0x71, 0xAF}
+	if !bytes.Equal(tag.ins, want) {
+		t.Fatalf("expected command sequence % X, got % X", want, tag.ins)
+	}
+}
+
+func TestRotateKeySameDetectsLostChange(t *testing.T) {
+	tag := newKeyTag(t)
+	tag.dropChange = true
+	newKey := bytes.Repeat([]byte{0x22}, 16)
+
+	err := RotateKeySame(tag, 0, tag.keys[0], newKey, 0x01)
+	if err == nil || !strings.Contains(err.Error(), "did not take effect") {
+		t.Fatalf("expected verification to report the lost change, got %v", err)
+	}
+}
+
+func TestRotateKeySameWrongOldKey(t *testing.T) {
+	tag := newKeyTag(t)
+	wrong := bytes.Repeat([]byte{0x33}, 16)
+
+	err := RotateKeySame(tag, 0, wrong, bytes.Repeat([]byte{0x22}, 16), 0x01)
+	if err == nil || !strings.Contains(err.Error(), "old key") {
+		t.Fatalf("expected old key authentication error, got %v", err)
+	}
+	if bytes.Contains(tag.ins, []byte{0xC4}) {
+		t.Fatalf("expected no ChangeKey after failed authentication")
+	}
+}
+
+func TestVerifyKeyByReauth(t *testing.T) {
+	tag := newKeyTag(t)
+	tag.keys[2] = bytes.Repeat([]byte{0x22}, 16)
+
+	if ok, err := VerifyKeyByReauth(tag, 2, tag.keys[2]); err != nil || !ok {
+		t.Fatalf("expected matching key to verify, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyKeyByReauth(tag, 2, make([]byte, 16)); err != nil || ok {
+		t.Fatalf("expected wrong key to be (false, nil), got %v, %v", ok, err)
+	}
+	want := []byte{0xA4, 0x71, 0xAF, 0xA4, 0x71, 0xAF}
+	if !bytes.Equal(tag.ins, want) {
+		t.Fatalf("expected select before each attempt % X, got % X", want, tag.ins)
+	}
+}
+
+func TestVerifyKeyByReauthReportsCardErrors(t *testing.T) {
+	card := NewFakeCard(
+		FakeExchange{Response: []byte{0x90, 0x00}},
+		FakeExchange{Command: []byte{0x90, 0x71, 0x00, 0x00, 0x02, 0x07, 0x00, 0x00}, Response: []byte{0x91, 0x40}},
+	)
+	ok, err := VerifyKeyByReauth(card, 7, make([]byte, 16))
+	if err == nil || ok {
+		t.Fatalf("expected an error for a missing slot, got %v, %v", ok, err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	card = NewFakeCard(FakeExchange{Err: errors.New("card removed")})
+	if _, err := VerifyKeyByReauth(card, 0, make([]byte, 16)); err == nil || !strings.Contains(err.Error(), "card removed") {
+		t.Fatalf("expected transmit error, got %v", err)
+	}
+}
+
+func TestChangeKeyVersionedKeyDataLayout(t *testing.T) {
+	newKey := bytes.Repeat([]byte{0x42}, 16)
+	oldKey := bytes.Repeat([]byte{0x17}, 16)
+	const version = 0x05
+
+	for _, tc := range []struct {
+		name              string
+		keySlot, authSlot byte
+		wantLen           int
+	}{
+		{"cross-slot", 2, 0, 21},
+		{"same-slot", 0, 0, 17},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sess := testSession()
+			tag := *sess
+			var keyData []byte
+			card := apduFunc(func(apdu []byte) ([]byte, error) {
+				if apdu[1] != 0xC4 || apdu[5] != tc.keySlot {
+					t.Fatalf("expected ChangeKey for slot %d, got % X", tc.keySlot, apdu)
+				}
+				keyData = ssmDecryptCommand(t, &tag, apdu, 1)
+				if tc.keySlot == tc.authSlot {
+					// Same-slot change: the session ends, no response MAC.
+					return []byte{0x91, 0x00}, nil
+				}
+				return ssmResponse(t, &tag, nil), nil
+			})
+			if err := ChangeKeyVersioned(card, sess, tc.keySlot, newKey, oldKey, version, tc.authSlot); err != nil {
+				t.Fatalf("ChangeKeyVersioned returned error: %v", err)
+			}
+			if len(keyData) != tc.wantLen {
+				t.Fatalf("expected %d bytes of key data, got %d: % X", tc.wantLen, len(keyData), keyData)
+			}
+			if keyData[16] != version {
+				t.Fatalf("expected key version 0x%02X at byte 16, got 0x%02X", version, keyData[16])
+			}
+			if tc.keySlot == tc.authSlot {
+				if !bytes.Equal(keyData[:16], newKey) {
+					t.Fatalf("expected the new key in clear, got % X", keyData[:16])
+				}
+				return
+			}
+			for i := range newKey {
+				if keyData[i] != newKey[i]^oldKey[i] {
+					t.Fatalf("expected new XOR old key, got % X", keyData[:16])
+				}
+			}
+			crc := CRC32DESFire(newKey)
+			if want := []byte{byte(crc), byte(crc >> 8), byte(crc >> 16), byte(crc >> 24)}; !bytes.Equal(keyData[17:21], want) {
+				t.Fatalf("expected CRC of new key % X, got % X", want, keyData[17:21])
+			}
+		})
+	}
+}
+
+// AN12196 ChangeKey session: the keys, TI and counter come in through
+// SessionFromEnv as they would when replaying a captured authentication.
+// Expected APDUs were computed independently with openssl (AES-128-ECB/CBC
+// and CMAC); the same-slot ciphertext matches the AN12196 example.
+func TestChangeKeyGoldenAPDUs(t *testing.T) {
+	t.Setenv("NTAG_KENC", "4CF3CB41A22583A61E89B158D252FC53")
+	t.Setenv("NTAG_KMAC", "5529860B2FC5FB6154B7F28361D30BF9")
+	t.Setenv("NTAG_TI", "7614281A")
+
+	tests := []struct {
+		name              string
+		cmdCtr            string
+		keySlot, authSlot byte
+		newKey, oldKey    string
+		resp              func(t *testing.T, sess *Session) []byte
+		want              string
+	}{
+		{
+			// NewKey(16) || KeyVer, padded: no XOR and no CRC for the
+			// authenticated key.
+			name: "same slot", cmdCtr: "0003", keySlot: 0, authSlot: 0,
+			newKey: "5004BF991F408672B1EF00F08F9E8647", oldKey: "00000000000000000000000000000000",
+			resp: func(*testing.T, *Session) []byte { return []byte{0x91, 0x00} },
+			want: "90C4000029" + "00" +
+				"C0EB4DEEFEDDF0B513A03A95A75491818580503190D4D05053FF75668A01D6FD" +
+				"A6610234BDED6432" + "00",
+		},
+		{
+			// (NewKey XOR OldKey) || KeyVer || CRC32(NewKey), padded.
+			name: "cross slot", cmdCtr: "0000", keySlot: 2, authSlot: 0,
+			newKey: "F3847D627727ED3BC9C4CC050489B966", oldKey: "00000000000000000000000000000000",
+			resp: func(t *testing.T, sess *Session) []byte { return ssmResponse(t, sess, nil) },
+			want: "90C4000029" + "02" +
+				"2EA8A649678DEEDCC01E45B4AED6E20578699817E5631499EF704372127E1B0E" +
+				"26950C3331A058E2" + "00",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NTAG_CMDC", tc.cmdCtr)
+			sess, err := SessionFromEnv()
+			if err != nil {
+				t.Fatalf("SessionFromEnv returned error: %v", err)
+			}
+			tag := *sess
+			var got []byte
+			card := apduFunc(func(apdu []byte) ([]byte, error) {
+				got = append([]byte(nil), apdu...)
+				return tc.resp(t, &tag), nil
+			})
+			if err := ChangeKey(card, sess, tc.keySlot, mustHex(t, tc.newKey), mustHex(t, tc.oldKey), 0x01, tc.authSlot); err != nil {
+				t.Fatalf("ChangeKey returned error: %v", err)
+			}
+			if want := mustHex(t, tc.want); !bytes.Equal(got, want) {
+				t.Fatalf("unexpected APDU\n got: %X\nwant: %X", got, want)
+			}
+		})
+	}
+}
+
+func TestChangeKeyVersionedRejectsBadArgs(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+	key := make([]byte, 16)
+	if err := ChangeKeyVersioned(card, testSession(), 5, key, key, 0x01, 0); err == nil {
+		t.Fatalf("expected error for key slot 5")
+	}
+	if err := ChangeKeyVersioned(card, testSession(), 1, key[:15], key, 0x01, 0); err == nil {
+		t.Fatalf("expected error for short new key")
+	}
+	if err := ChangeKeyVersioned(card, nil, 1, key, key, 0x01, 0); err == nil {
+		t.Fatalf("expected error for nil session")
+	}
+}
+
+func TestLoadKeyJSONFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.json")
+	content := `{"key":"00112233445566778899aabbccddeeff","version":1,"role":"AppMaster","slot":0}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadKeyJSONFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyJSONFile returned error: %v", err)
+	}
+	want := &KeyEntry{
+		KeyFile: KeyFile{Name: "app.json", Key: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}},
+		Version: 1,
+		Role:    "AppMaster",
+		Slot:    0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected entry\n got: %+v\nwant: %+v", got, want)
+	}
+
+	// Metadata is optional; an undeclared slot is -1.
+	entry, err := parseKeyJSON([]byte(`{"key":"00112233445566778899AABBCCDDEEFF"}`))
+	if err != nil {
+		t.Fatalf("parseKeyJSON returned error: %v", err)
+	}
+	if entry.Slot != -1 || entry.Version != 0 || entry.Role != "" {
+		t.Fatalf("expected no metadata, got %+v", entry)
+	}
+}
+
+func TestLoadKeyJSONFileInvalid(t *testing.T) {
+	cases := map[string]struct {
+		content string
+		want    string
+	}{
+		"not json":      {`00112233445566778899AABBCCDDEEFF`, "invalid key file"},
+		"missing key":   {`{"role":"AppMaster"}`, "32 hex chars"},
+		"short key":     {`{"key":"0011"}`, "32 hex chars"},
+		"bad hex":       {`{"key":"zz112233445566778899AABBCCDDEEFF"}`, "invalid hex"},
+		"bad version":   {`{"key":"00112233445566778899AABBCCDDEEFF","version":256}`, "version 256"},
+		"bad slot":      {`{"key":"00112233445566778899AABBCCDDEEFF","slot":5}`, "slot 5"},
+		"unknown field": {`{"key":"00112233445566778899AABBCCDDEEFF","slto":1}`, "slto"},
+	}
+	dir := t.TempDir()
+	for name, tc := range cases {
+		path := filepath.Join(dir, "key.json")
+		if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadKeyJSONFile(path)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestLoadAllKeysMixedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.hex":     "000102030405060708090A0B0C0D0E0F\n",
+		"b.json":    `{"key":"101112131415161718191A1B1C1D1E1F","version":2,"role":"SDMMAC","slot":3}`,
+		"bad.json":  `{"key":"10"}`,
+		"bad.hex":   "nothex\n",
+		"notes.txt": "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := LoadAllKeys(dir)
+	if err != nil {
+		t.Fatalf("LoadAllKeys returned error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", keys)
+	}
+	if keys[0].Name != "a.hex" || keys[0].Slot != -1 || keys[0].Key[15] != 0x0F {
+		t.Fatalf("unexpected .hex entry %+v", keys[0])
+	}
+	if keys[1].Name != "b.json" || keys[1].Slot != 3 || keys[1].Version != 2 || keys[1].Role != "SDMMAC" {
+		t.Fatalf("unexpected .json entry %+v", keys[1])
+	}
+
+	// LoadAllHexKeys keeps ignoring .json files.
+	hexKeys, err := LoadAllHexKeys(dir)
+	if err != nil || len(hexKeys) != 1 {
+		t.Fatalf("expected 1 .hex key, got %v, %v", hexKeys, err)
+	}
+}
+
+func TestGetKeyVersionAcrossChangeKey(t *testing.T) {
+	tag := newKeyTag(t)
+	provisioned := bytes.Repeat([]byte{0x11}, 16)
+	tag.keys[1] = append([]byte{}, provisioned...)
+	tag.versions = [5]byte{0x01, 0x03, 0x00, 0x00, 0x00}
+
+	if v, err := GetKeyVersion(tag, nil, 1); err != nil || v != 0x03 {
+		t.Fatalf("expected plain GetKeyVersion 0x03, got 0x%02X %v", v, err)
+	}
+	sess, err := AuthenticateEV2First(tag, tag.keys[0], 0)
+	if err != nil {
+		t.Fatalf("AuthenticateEV2First returned error: %v", err)
+	}
+	if v, err := GetKeyVersion(tag, sess, 0); err != nil || v != 0x01 {
+		t.Fatalf("expected MAC GetKeyVersion 0x01, got 0x%02X %v", v, err)
+	}
+
+	// Reset slot 1: the version byte in the key data is the new one (0x00);
+	// the old version 0x03 plays no part in the change.
+	zero := make([]byte, 16)
+	if err := ChangeKey(tag, sess, 1, zero, provisioned, 0x00, 0); err != nil {
+		t.Fatalf("ChangeKey returned error: %v", err)
+	}
+	if v, err := GetKeyVersion(tag, sess, 1); err != nil || v != 0x00 {
+		t.Fatalf("expected slot 1 version 0x00 after reset, got 0x%02X %v", v, err)
+	}
+	if !bytes.Equal(tag.keys[1], zero) {
+		t.Fatalf("expected slot 1 back at zeros, got % X", tag.keys[1])
+	}
+}
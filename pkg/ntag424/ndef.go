@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 const (
 	sdmUIDLenASCII = 14
 	sdmCtrLenASCII = 6
 	sdmMacLenASCII = 16
+
+	// Encrypted PICC data: 16-byte ciphertext mirrored as 32 hex chars
+	sdmPICCDataLenASCII = 32
 )
 
 // SDMNDEF represents an NDEF message with SDM (Secure Dynamic Messaging) parameters.
@@ -18,19 +23,43 @@ type SDMNDEF struct {
 	URL            string // Full URL with uid/ctr/mac placeholders
 	NDEF           []byte // Complete NDEF message bytes
 	UIDOffset      uint32 // Byte offset where UID mirror starts
+	PICCDataOffset uint32 // Byte offset where encrypted PICC data mirror starts (0 = plain UID/Ctr)
 	CtrOffset      uint32 // Byte offset where counter mirror starts
 	MacInputOffset uint32 // Byte offset where MAC input starts (typically "uid=")
 	MacOffset      uint32 // Byte offset where MAC mirror starts
+	ENCOffset      uint32 // Byte offset where the ENC file data placeholder starts (0 = none)
+	ENCLength      uint32 // Length of the ENC placeholder in ASCII bytes
+	CtrLimit       uint32 // SDMReadCtrLimit to program (0 = no limit)
+}
+
+// ApplyTo copies the mirror offsets into fs. A non-zero ENCLength enables
+// encrypted file data (SDMOptions bit 4) and a non-zero CtrLimit enables the
+// ReadCtr limit (SDMOptions bit 5).
+func (s *SDMNDEF) ApplyTo(fs *FileSettings) {
+	fs.UIDOffset = s.UIDOffset
+	fs.CtrOffset = s.CtrOffset
+	fs.PICCDataOffset = s.PICCDataOffset
+	fs.MACInputOffset = s.MacInputOffset
+	fs.MACOffset = s.MacOffset
+	if s.ENCLength != 0 {
+		fs.ENCOffset = s.ENCOffset
+		fs.ENCLength = s.ENCLength
+		fs.SDMOptions |= 0x10
+	}
+	if s.CtrLimit != 0 {
+		fs.CtrLimit = s.CtrLimit
+		fs.SDMOptions |= 0x20
+	}
 }
 
 // BuildSDMNDEF constructs an NDEF message with SDM placeholders from a base URL.
 // From update/internal/ntag/ndef.go:10-99.
 //
 // The function:
-//   1. Parses and validates the URL
-//   2. Adds uid, ctr, mac query parameters with zero-filled placeholders
-//   3. Builds an NDEF URI record with proper prefix encoding
-//   4. Calculates byte offsets for SDM mirroring
+//  1. Parses and validates the URL
+//  2. Adds uid, ctr, mac query parameters with zero-filled placeholders
+//  3. Builds an NDEF URI record with proper prefix encoding
+//  4. Calculates byte offsets for SDM mirroring
 //
 // Parameters:
 //   - baseURL: Base URL (must be absolute with scheme and host)
@@ -38,75 +67,356 @@ type SDMNDEF struct {
 // Returns:
 //   - SDMNDEF structure with URL, NDEF bytes, and mirror offsets
 //   - Error if URL is invalid or NDEF exceeds 256 bytes
+//   - Error if "uid=", "ctr=" or "mac=" appears anywhere else in the URL,
+//     e.g. in the path or inside another parameter name
 //
 // Example:
-//   BuildSDMNDEF("https://example.com/tag")
-//   → URL: "https://example.com/tag?uid=00000000000000&ctr=000000&mac=0000000000000000"
-//   → UIDOffset: offset to first '0' after "uid="
-//   → CtrOffset: offset to first '0' after "ctr="
-//   → MacOffset: offset to first '0' after "mac="
+//
+//	BuildSDMNDEF("https://example.com/tag")
+//	→ URL: "https://example.com/tag?uid=00000000000000&ctr=000000&mac=0000000000000000"
+//	→ UIDOffset: offset to first '0' after "uid="
+//	→ CtrOffset: offset to first '0' after "ctr="
+//	→ MacOffset: offset to first '0' after "mac="
 func BuildSDMNDEF(baseURL string) (*SDMNDEF, error) {
+	return BuildSDMNDEFWithConfig(baseURL, DefaultSDMParamConfig())
+}
+
+// BuildSDMNDEFWithConfig constructs an SDM NDEF message using the parameter
+// names and MAC input template from cfg.
+//
+// The rendered template is written verbatim as the start of the query string,
+// followed by the MAC placeholder and any other existing query parameters, so
+// the bytes between MacInputOffset and MacOffset are exactly what
+// GenerateSDMURLWithConfig and VerifySDMMACWithConfig feed into the CMAC.
+//
+// The template must contain {uid} and {ctr} exactly once and end with
+// "<MACParam>=". Only SDMEncodingASCII placeholders can be laid out in a URL.
+// The computed offsets are checked against the encoded NDEF: each parameter
+// marker must occur once in the URL and each offset must land just after it
+// inside the URI payload.
+func BuildSDMNDEFWithConfig(baseURL string, cfg SDMParamConfig) (*SDMNDEF, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Encoding != SDMEncodingASCII {
+		return nil, fmt.Errorf("SDM NDEF placeholders need ASCII encoding, got %v", cfg.Encoding)
+	}
+	tmpl := cfg.template()
+	if strings.Count(tmpl, "{uid}") != 1 || strings.Count(tmpl, "{ctr}") != 1 {
+		return nil, fmt.Errorf("MAC input template must contain {uid} and {ctr} exactly once: %q", tmpl)
+	}
+	if !strings.HasSuffix(tmpl, cfg.MACParam+"=") {
+		return nil, fmt.Errorf("MAC input template must end with %q: %q", cfg.MACParam+"=", tmpl)
+	}
+
+	macInput := cfg.macInput(strings.Repeat("0", sdmUIDLenASCII), strings.Repeat("0", sdmCtrLenASCII))
+	sdmQuery := macInput + strings.Repeat("0", sdmMacLenASCII)
+	fullURL, ndef, inputIdx, err := encodeSDMNDEF(baseURL, sdmQuery, cfg.UIDParam, cfg.CtrParam, cfg.MACParam)
+	if err != nil {
+		return nil, err
+	}
+
+	// Placeholder positions are relative to the rendered template.
+	uidPos := strings.Index(tmpl, "{uid}")
+	ctrPos := strings.Index(tmpl, "{ctr}")
+	if uidPos < ctrPos {
+		ctrPos += sdmUIDLenASCII - len("{uid}")
+	} else {
+		uidPos += sdmCtrLenASCII - len("{ctr}")
+	}
+
+	uidOffset := inputIdx + uidPos
+	ctrOffset := inputIdx + ctrPos
+	macOffset := inputIdx + len(macInput)
+	if err := checkSDMMarkers(fullURL, ndef,
+		sdmMarker{cfg.UIDParam, uidOffset, sdmUIDLenASCII},
+		sdmMarker{cfg.CtrParam, ctrOffset, sdmCtrLenASCII},
+		sdmMarker{cfg.MACParam, macOffset, sdmMacLenASCII}); err != nil {
+		return nil, err
+	}
+
+	return &SDMNDEF{
+		URL:            fullURL,
+		NDEF:           ndef,
+		UIDOffset:      uint32(uidOffset),
+		CtrOffset:      uint32(ctrOffset),
+		MacInputOffset: uint32(inputIdx), // MAC input starts at the rendered template
+		MacOffset:      uint32(macOffset),
+	}, nil
+}
+
+// sdmENCParam is the query parameter BuildSDMNDEFWithENC mirrors the
+// encrypted file data into.
+const sdmENCParam = "enc"
+
+// BuildSDMNDEFWithENC constructs an SDM NDEF message that also reserves a
+// placeholder for encrypted file data mirroring (SDMENCFileData).
+//
+// An enc parameter with encLen*2 zero hex characters is inserted between ctr
+// and mac, so the ENC region lies inside the MAC input as the tag requires:
+//
+//	?uid=<14>&ctr=<6>&enc=<encLen*2>&mac=<16>
+//
+// Parameters:
+//   - baseURL: Base URL (must be absolute with scheme and host)
+//   - encLen: plaintext file data length in bytes (multiple of 16)
+//
+// Returns:
+//   - SDMNDEF with ENCOffset/ENCLength set alongside the uid/ctr/mac offsets
+//   - Error if encLen is invalid or the NDEF exceeds 256 bytes
+func BuildSDMNDEFWithENC(baseURL string, encLen int) (*SDMNDEF, error) {
+	if encLen <= 0 || encLen%16 != 0 {
+		return nil, fmt.Errorf("ENC length must be a positive multiple of 16 bytes, got %d", encLen)
+	}
+
 	parsed, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
+	query := parsed.Query()
+	query.Del(sdmENCParam)
+	parsed.RawQuery = query.Encode()
+
+	encHexLen := encLen * 2
+	cfg := DefaultSDMParamConfig()
+	cfg.MACInputTemplate = "uid={uid}&ctr={ctr}&" + sdmENCParam + "=" + strings.Repeat("0", encHexLen) + "&mac="
+
+	sdm, err := BuildSDMNDEFWithConfig(parsed.String(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := "&" + sdmENCParam + "="
+	encIdx := bytes.Index(sdm.NDEF[sdm.MacInputOffset:sdm.MacOffset], []byte(marker))
+	if encIdx < 0 {
+		return nil, fmt.Errorf("failed to locate enc in NDEF")
+	}
+	sdm.ENCOffset = sdm.MacInputOffset + uint32(encIdx+len(marker))
+	sdm.ENCLength = uint32(encHexLen)
+	return sdm, nil
+}
+
+// BuildSDMNDEFEncryptedPICC constructs an SDM NDEF message for encrypted PICC
+// data mirroring, where UID and read counter are hidden inside one 16-byte
+// ciphertext block:
+//
+//	?picc_data=<32 hex chars>&mac=<16 hex chars>
+//
+// The MAC input starts at "picc_data=", so the tag MACs over
+// "picc_data=<ciphertext>&mac=". Program the tag with an SDMMeta key slot
+// (not 0xE/0xF) and set FileSettings.PICCDataOffset to the returned
+// PICCDataOffset; SDMNDEF.ApplyTo does this.
+//
+// Parameters:
+//   - baseURL: Base URL (must be absolute with scheme and host)
+//
+// Returns:
+//   - SDMNDEF with PICCDataOffset, MacInputOffset, and MacOffset set
+//   - Error if URL is invalid or NDEF exceeds 256 bytes
+func BuildSDMNDEFEncryptedPICC(baseURL string) (*SDMNDEF, error) {
+	macInput := "picc_data=" + strings.Repeat("0", sdmPICCDataLenASCII) + "&mac="
+	sdmQuery := macInput + strings.Repeat("0", sdmMacLenASCII)
+	fullURL, ndef, inputIdx, err := encodeSDMNDEF(baseURL, sdmQuery, "picc_data", "mac", "uid", "ctr")
+	if err != nil {
+		return nil, err
+	}
+
+	piccOffset := inputIdx + len("picc_data=")
+	macOffset := inputIdx + len(macInput)
+	if err := checkSDMMarkers(fullURL, ndef,
+		sdmMarker{"picc_data", piccOffset, sdmPICCDataLenASCII},
+		sdmMarker{"mac", macOffset, sdmMacLenASCII}); err != nil {
+		return nil, err
+	}
+
+	return &SDMNDEF{
+		URL:            fullURL,
+		NDEF:           ndef,
+		PICCDataOffset: uint32(piccOffset),
+		MacInputOffset: uint32(inputIdx), // MAC input starts at "picc_data="
+		MacOffset:      uint32(macOffset),
+	}, nil
+}
+
+// DiscoverSDMOffsets reads the NDEF file currently on the tag and recovers
+// the SDM mirror offsets from its uid=/ctr=/mac= query parameters. Use it to
+// rewrite SDM settings (for example a new SDMFileRead key) on a tag that was
+// provisioned with BuildSDMNDEF without rewriting the NDEF file.
+//
+// The live file holds mirrored values rather than zero placeholders, so the
+// offsets are located by parameter name and the URL in the result is the one
+// read from the tag. Offsets are file offsets, including the 2-byte NLEN.
+func DiscoverSDMOffsets(card Card) (*SDMNDEF, error) {
+	return DiscoverSDMOffsetsWithConfig(card, DefaultSDMParamConfig())
+}
+
+// DiscoverSDMOffsetsWithConfig is DiscoverSDMOffsets for tags provisioned
+// with BuildSDMNDEFWithConfig.
+func DiscoverSDMOffsetsWithConfig(card Card, cfg SDMParamConfig) (*SDMNDEF, error) {
+	msg, err := ReadNDEF(card)
+	if err != nil {
+		return nil, err
+	}
+	return discoverSDMOffsets(msg, cfg)
+}
+
+// discoverSDMOffsets locates the SDM parameters in an NDEF message as
+// returned by ReadNDEF (without NLEN). The bytes between MacInputOffset and
+// MacOffset must render cfg's template with the mirrored UID and counter,
+// which rules out parameters that merely share a name.
+func discoverSDMOffsets(msg []byte, cfg SDMParamConfig) (*SDMNDEF, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(msg) == 0 {
+		return nil, fmt.Errorf("discover SDM offsets: NDEF file is empty")
+	}
+
+	ndef := make([]byte, 2+len(msg))
+	ndef[0] = byte(len(msg) >> 8)
+	ndef[1] = byte(len(msg))
+	copy(ndef[2:], msg)
+
+	uidOffset := findQueryValue(ndef, cfg.UIDParam)
+	ctrOffset := findQueryValue(ndef, cfg.CtrParam)
+	macOffset := findQueryValue(ndef, cfg.MACParam)
+	switch {
+	case uidOffset < 0:
+		return nil, fmt.Errorf("discover SDM offsets: no %q parameter in NDEF", cfg.UIDParam)
+	case ctrOffset < 0:
+		return nil, fmt.Errorf("discover SDM offsets: no %q parameter in NDEF", cfg.CtrParam)
+	case macOffset < 0:
+		return nil, fmt.Errorf("discover SDM offsets: no %q parameter in NDEF", cfg.MACParam)
+	}
+	if !isHexASCII(ndef, uidOffset, sdmUIDLenASCII) ||
+		!isHexASCII(ndef, ctrOffset, sdmCtrLenASCII) ||
+		!isHexASCII(ndef, macOffset, sdmMacLenASCII) {
+		return nil, fmt.Errorf("discover SDM offsets: mirror fields are not %d/%d/%d hex chars",
+			sdmUIDLenASCII, sdmCtrLenASCII, sdmMacLenASCII)
+	}
+
+	// The MAC input starts at the template's first parameter name.
+	tmpl := cfg.template()
+	first := tmpl[:strings.Index(tmpl, "=")]
+	inputIdx := findQueryValue(ndef, first) - len(first) - 1
+	if inputIdx < 0 {
+		return nil, fmt.Errorf("discover SDM offsets: no %q parameter in NDEF", first)
+	}
+	macInput := cfg.macInput(string(ndef[uidOffset:uidOffset+sdmUIDLenASCII]), string(ndef[ctrOffset:ctrOffset+sdmCtrLenASCII]))
+	if inputIdx > macOffset || string(ndef[inputIdx:macOffset]) != macInput {
+		return nil, fmt.Errorf("discover SDM offsets: NDEF does not match MAC input template %q", tmpl)
+	}
+
+	records, err := ParseNDEFMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("discover SDM offsets: %w", err)
+	}
+	fullURL, err := DecodeURIRecord(records[0])
+	if err != nil {
+		return nil, fmt.Errorf("discover SDM offsets: %w", err)
+	}
+
+	return &SDMNDEF{
+		URL:            fullURL,
+		NDEF:           ndef,
+		UIDOffset:      uint32(uidOffset),
+		CtrOffset:      uint32(ctrOffset),
+		MacInputOffset: uint32(inputIdx),
+		MacOffset:      uint32(macOffset),
+	}, nil
+}
+
+// findQueryValue returns the offset just after "<name>=" where it starts a
+// query parameter (preceded by '?' or '&'), or -1.
+func findQueryValue(data []byte, name string) int {
+	key := []byte(name + "=")
+	for start := 0; ; {
+		i := bytes.Index(data[start:], key)
+		if i < 0 {
+			return -1
+		}
+		i += start
+		if i > 0 && (data[i-1] == '?' || data[i-1] == '&') {
+			return i + len(key)
+		}
+		start = i + 1
+	}
+}
+
+// isHexASCII reports whether data[off:off+n] exists and holds hex digits.
+func isHexASCII(data []byte, off, n int) bool {
+	if off+n > len(data) {
+		return false
+	}
+	for _, c := range data[off : off+n] {
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeSDMNDEF builds the NDEF URI message for baseURL with sdmQuery as the
+// leading query component. Existing query parameters named in reserved are
+// dropped; all others are preserved after the SDM block.
+//
+// Returns:
+//   - fullURL: URL written to the tag
+//   - ndef: NLEN(2) + URI record bytes
+//   - inputIdx: offset of sdmQuery within ndef
+//   - error if the URL is invalid or the NDEF exceeds 256 bytes
+func encodeSDMNDEF(baseURL, sdmQuery string, reserved ...string) (fullURL string, ndef []byte, inputIdx int, err error) {
+	isReserved := func(key string) bool {
+		for _, r := range reserved {
+			if key == r {
+				return true
+			}
+		}
+		return false
+	}
+
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid URL: %w", err)
+	}
 	if parsed.Scheme == "" || parsed.Host == "" {
-		return nil, fmt.Errorf("URL must be absolute (include scheme and host)")
+		return "", nil, 0, fmt.Errorf("URL must be absolute (include scheme and host)")
 	}
 	parsed.Fragment = ""
 
 	// Build query string manually to preserve uid, ctr, mac order
 	// (url.Values.Encode() sorts alphabetically, violating NTAG 424 DNA ordering constraint)
 	query := parsed.Query()
-	var params []string
-	// Add SDM parameters in required order: uid, ctr, mac
-	params = append(params, fmt.Sprintf("uid=%s", url.QueryEscape(strings.Repeat("0", sdmUIDLenASCII))))
-	params = append(params, fmt.Sprintf("ctr=%s", url.QueryEscape(strings.Repeat("0", sdmCtrLenASCII))))
-	params = append(params, fmt.Sprintf("mac=%s", url.QueryEscape(strings.Repeat("0", sdmMacLenASCII))))
+	params := []string{sdmQuery}
 	// Preserve any other existing query parameters
 	for key, values := range query {
-		if key != "uid" && key != "ctr" && key != "mac" {
-			for _, value := range values {
-				params = append(params, fmt.Sprintf("%s=%s", url.QueryEscape(key), url.QueryEscape(value)))
-			}
+		if isReserved(key) {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, fmt.Sprintf("%s=%s", url.QueryEscape(key), url.QueryEscape(value)))
 		}
 	}
 	parsed.RawQuery = strings.Join(params, "&")
 
-	fullURL := parsed.String()
+	fullURL = parsed.String()
 
 	// Encode URL prefix according to NFC URI Record Type Definition
-	prefixCode := byte(0x00)
-	uri := fullURL
-	for _, p := range []struct {
-		prefix string
-		code   byte
-	}{
-		{prefix: "https://www.", code: 0x02},
-		{prefix: "http://www.", code: 0x01},
-		{prefix: "https://", code: 0x04},
-		{prefix: "http://", code: 0x03},
-	} {
-		if strings.HasPrefix(fullURL, p.prefix) {
-			prefixCode = p.code
-			uri = fullURL[len(p.prefix):]
-			break
-		}
-	}
+	prefixCode, uri := EncodeURIPrefix(fullURL)
 
 	// Build NDEF message: NLEN(2) + NDEF Record
 	// NDEF Record: TNFFLAGS(1) TYPELEN(1) PAYLOADLEN(1) TYPE(1) PAYLOAD
 	payloadLen := 1 + len(uri) // prefix code + URI
 	if payloadLen > 255 {
-		return nil, fmt.Errorf("URI too long")
+		return "", nil, 0, fmt.Errorf("URI too long")
 	}
 	recordLen := 4 + payloadLen // header(3) + type(1) + payload
 	totalLen := 2 + recordLen   // NLEN(2) + record
 	if totalLen > 256 {
-		return nil, fmt.Errorf("NDEF too long")
+		return "", nil, 0, fmt.Errorf("NDEF too long")
 	}
 
-	ndef := make([]byte, totalLen)
+	ndef = make([]byte, totalLen)
 	ndef[0] = byte((recordLen >> 8) & 0xFF) // NLEN high byte
 	ndef[1] = byte(recordLen & 0xFF)        // NLEN low byte
 	ndef[2] = 0xD1                          // TNF=0x01 (Well-known), MB=1, ME=1, SR=1
@@ -116,28 +426,381 @@ func BuildSDMNDEF(baseURL string) (*SDMNDEF, error) {
 	ndef[6] = prefixCode                    // URI prefix code
 	copy(ndef[7:], []byte(uri))             // URI (without prefix)
 
-	// Locate SDM parameter positions in the NDEF message
-	uidIdx := bytes.Index(ndef, []byte("uid="))
-	ctrIdx := bytes.Index(ndef, []byte("ctr="))
-	macIdx := bytes.Index(ndef, []byte("mac="))
-	if uidIdx < 0 || ctrIdx < 0 || macIdx < 0 {
-		return nil, fmt.Errorf("failed to locate uid/ctr/mac in NDEF")
+	// The SDM block is the first query component; locate it by structure,
+	// not by searching, so a path that happens to contain it cannot match.
+	q := strings.IndexByte(uri, '?')
+	if q < 0 || !strings.HasPrefix(uri[q+1:], sdmQuery) {
+		return "", nil, 0, fmt.Errorf("failed to locate SDM parameters in NDEF")
 	}
+	inputIdx = sdmURIStart + q + 1
+	return fullURL, ndef, inputIdx, nil
+}
+
+// sdmURIStart is the offset of the URI (after the prefix code) in the NDEF
+// file encodeSDMNDEF builds: NLEN(2) + record header(3) + type(1) + prefix(1).
+const sdmURIStart = 7
 
-	// Offsets point to the first placeholder character after "uid=", "ctr=", "mac="
-	uidOffset := uidIdx + 4
-	ctrOffset := ctrIdx + 4
-	macOffset := macIdx + 4
-	if uidOffset+sdmUIDLenASCII > len(ndef) || ctrOffset+sdmCtrLenASCII > len(ndef) || macOffset+sdmMacLenASCII > len(ndef) {
-		return nil, fmt.Errorf("offsets out of range")
+// sdmMarker is one mirrored parameter as laid out in an SDM NDEF: name=
+// followed by length placeholder characters at offset.
+type sdmMarker struct {
+	name   string
+	offset int
+	length int
+}
+
+// checkSDMMarkers cross-checks computed mirror offsets against the encoded
+// NDEF. Each name= must appear in fullURL exactly once, in the query and not
+// in the path or inside another parameter, and each offset must point just
+// past its name= inside the URI payload. Anything else would make the tag
+// mirror into the wrong bytes, or a backend read the wrong parameter.
+func checkSDMMarkers(fullURL string, ndef []byte, markers ...sdmMarker) error {
+	parsed, err := url.Parse(fullURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	for _, m := range markers {
+		key := m.name + "="
+		if strings.Contains(parsed.EscapedPath(), key) {
+			return fmt.Errorf("URL path contains %q, which SDM uses as a query parameter marker: %s", key, parsed.EscapedPath())
+		}
+		if n := strings.Count(fullURL, key); n != 1 {
+			return fmt.Errorf("SDM marker %q appears %d times in %s; it must appear exactly once", key, n, fullURL)
+		}
+		start := m.offset - len(key)
+		if start < sdmURIStart || m.offset+m.length > len(ndef) {
+			return fmt.Errorf("%s offset %d outside the URI payload (%d-%d)", m.name, m.offset, sdmURIStart, len(ndef))
+		}
+		if string(ndef[start:m.offset]) != key {
+			return fmt.Errorf("%s offset %d does not follow %q in the NDEF", m.name, m.offset, key)
+		}
 	}
+	return nil
+}
 
-	return &SDMNDEF{
-		URL:            fullURL,
-		NDEF:           ndef,
-		UIDOffset:      uint32(uidOffset),
-		CtrOffset:      uint32(ctrOffset),
-		MacInputOffset: uint32(uidIdx), // MAC input starts at "uid="
-		MacOffset:      uint32(macOffset),
-	}, nil
+// NDEF record TNF (Type Name Format) values.
+const (
+	TNFEmpty       byte = 0x00
+	TNFWellKnown   byte = 0x01
+	TNFMediaType   byte = 0x02
+	TNFAbsoluteURI byte = 0x03
+	TNFExternal    byte = 0x04
+	TNFUnknown     byte = 0x05
+	TNFUnchanged   byte = 0x06
+)
+
+// NDEF record header flags.
+const (
+	ndefFlagMB = 0x80 // Message Begin
+	ndefFlagME = 0x40 // Message End
+	ndefFlagCF = 0x20 // Chunk Flag
+	ndefFlagSR = 0x10 // Short Record (1-byte payload length)
+	ndefFlagIL = 0x08 // ID Length present
+)
+
+// NDEFRecord is a single record of an NDEF message.
+type NDEFRecord struct {
+	TNF     byte   // Type Name Format (TNFWellKnown, TNFExternal, ...)
+	Type    []byte // Record type (e.g. "U" for URI, "android.com:pkg" for AAR)
+	ID      []byte // Optional record ID
+	Payload []byte // Record payload
+}
+
+// NewURIRecord returns a well-known URI record with the prefix compressed.
+func NewURIRecord(uri string) NDEFRecord {
+	code, rest := EncodeURIPrefix(uri)
+	payload := make([]byte, 0, 1+len(rest))
+	payload = append(payload, code)
+	payload = append(payload, rest...)
+	return NDEFRecord{TNF: TNFWellKnown, Type: []byte("U"), Payload: payload}
+}
+
+// NewAARRecord returns an Android Application Record for the given package name.
+func NewAARRecord(packageName string) NDEFRecord {
+	return NDEFRecord{TNF: TNFExternal, Type: []byte("android.com:pkg"), Payload: []byte(packageName)}
+}
+
+// BuildNDEFMessage encodes records into an NDEF message prefixed with the
+// 2-byte big-endian NLEN, ready for WriteNDEFPlain.
+//
+// The first record gets MB, the last ME. Payloads up to 255 bytes use the
+// short-record (SR) 1-byte length, longer ones the 4-byte length. IL is set
+// when a record has an ID.
+//
+// Returns:
+//   - NLEN(2) + records
+//   - Error if records is empty, a TNF is invalid, a type/ID exceeds 255 bytes,
+//     or the message exceeds 0xFFFF bytes
+func BuildNDEFMessage(records []NDEFRecord) ([]byte, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("NDEF message needs at least one record")
+	}
+
+	msg := []byte{0x00, 0x00} // NLEN placeholder
+	for i, rec := range records {
+		if rec.TNF > TNFUnchanged {
+			return nil, fmt.Errorf("record %d: invalid TNF 0x%02X", i, rec.TNF)
+		}
+		if len(rec.Type) > 255 {
+			return nil, fmt.Errorf("record %d: type too long (%d bytes)", i, len(rec.Type))
+		}
+		if len(rec.ID) > 255 {
+			return nil, fmt.Errorf("record %d: ID too long (%d bytes)", i, len(rec.ID))
+		}
+
+		header := rec.TNF
+		if i == 0 {
+			header |= ndefFlagMB
+		}
+		if i == len(records)-1 {
+			header |= ndefFlagME
+		}
+		short := len(rec.Payload) <= 255
+		if short {
+			header |= ndefFlagSR
+		}
+		if len(rec.ID) > 0 {
+			header |= ndefFlagIL
+		}
+
+		msg = append(msg, header, byte(len(rec.Type)))
+		if short {
+			msg = append(msg, byte(len(rec.Payload)))
+		} else {
+			n := uint32(len(rec.Payload))
+			msg = append(msg, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		}
+		if len(rec.ID) > 0 {
+			msg = append(msg, byte(len(rec.ID)))
+		}
+		msg = append(msg, rec.Type...)
+		msg = append(msg, rec.ID...)
+		msg = append(msg, rec.Payload...)
+	}
+
+	nlen := len(msg) - 2
+	if nlen > 0xFFFF {
+		return nil, fmt.Errorf("NDEF message too long (%d bytes)", nlen)
+	}
+	msg[0] = byte(nlen >> 8)
+	msg[1] = byte(nlen)
+	return msg, nil
+}
+
+// uriPrefixes is the NFC Forum URI Record Type Definition prefix table,
+// indexed by identifier code.
+var uriPrefixes = []string{
+	"", "http://www.", "https://www.", "http://", "https://",
+	"tel:", "mailto:", "ftp://anonymous:anonymous@", "ftp://ftp.",
+	"ftps://", "sftp://", "smb://", "nfs://", "ftp://", "dav://",
+	"news:", "telnet://", "imap:", "rtsp://", "urn:", "pop:",
+	"sip:", "sips:", "tftp:", "btspp://", "btl2cap://",
+	"btgoep://", "tcpobex://", "irdaobex://", "file://",
+	"urn:epc:id:", "urn:epc:tag:", "urn:epc:pat:",
+	"urn:epc:raw:", "urn:epc:", "urn:nfc:",
+}
+
+// EncodeURIPrefix splits a URI into its NFC URI record identifier code and
+// the remainder, using the longest matching entry of the prefix table (so
+// "https://www." wins over "https://", "urn:epc:id:" over "urn:").
+// Returns code 0x00 and the full URI if no prefix applies.
+func EncodeURIPrefix(uri string) (code byte, rest string) {
+	best := 0
+	for i, prefix := range uriPrefixes {
+		if i > 0 && len(prefix) > len(uriPrefixes[best]) && strings.HasPrefix(uri, prefix) {
+			best = i
+		}
+	}
+	return byte(best), uri[len(uriPrefixes[best]):]
+}
+
+// DecodeURIPrefix expands an identifier code and the remainder of a URI
+// record back into the full URI. Codes past the end of the table are
+// reserved (RFU) and expand to nothing.
+func DecodeURIPrefix(code byte, rest string) string {
+	if int(code) < len(uriPrefixes) {
+		return uriPrefixes[code] + rest
+	}
+	return rest
+}
+
+// ParseNDEFMessage parses an NDEF message into its records.
+// From ro/ndef.go (generalized to multi-record messages).
+//
+// data is the message without the 2-byte NLEN, as returned by ReadNDEF.
+// Records are walked from MB to ME, honoring SR (1-byte vs 4-byte payload
+// length) and IL (ID length present). Bytes after the ME record are ignored.
+// Chunked records (CF) are not supported.
+//
+// Returns:
+//   - Records in message order (slices alias data)
+//   - Error if the message is truncated, lacks MB/ME, or uses chunking
+func ParseNDEFMessage(data []byte) ([]NDEFRecord, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty NDEF message")
+	}
+
+	var records []NDEFRecord
+	idx := 0
+	for {
+		if len(data) < idx+3 {
+			return nil, fmt.Errorf("record %d: header truncated", len(records))
+		}
+		hdr := data[idx]
+		if len(records) == 0 && (hdr&ndefFlagMB) == 0 {
+			return nil, fmt.Errorf("record 0: MB flag not set")
+		}
+		if len(records) > 0 && (hdr&ndefFlagMB) != 0 {
+			return nil, fmt.Errorf("record %d: unexpected MB flag", len(records))
+		}
+		if (hdr & ndefFlagCF) != 0 {
+			return nil, fmt.Errorf("record %d: chunked records not supported", len(records))
+		}
+
+		typeLen := int(data[idx+1])
+		idx += 2
+
+		var payloadLen int
+		if (hdr & ndefFlagSR) != 0 {
+			payloadLen = int(data[idx])
+			idx++
+		} else {
+			if len(data) < idx+4 {
+				return nil, fmt.Errorf("record %d: payload length truncated", len(records))
+			}
+			payloadLen = int(data[idx])<<24 | int(data[idx+1])<<16 | int(data[idx+2])<<8 | int(data[idx+3])
+			idx += 4
+		}
+
+		idLen := 0
+		if (hdr & ndefFlagIL) != 0 {
+			if len(data) < idx+1 {
+				return nil, fmt.Errorf("record %d: ID length truncated", len(records))
+			}
+			idLen = int(data[idx])
+			idx++
+		}
+
+		if payloadLen < 0 || len(data)-idx < typeLen+idLen+payloadLen {
+			return nil, fmt.Errorf("record %d: truncated", len(records))
+		}
+
+		rec := NDEFRecord{TNF: hdr & 0x07}
+		rec.Type = data[idx : idx+typeLen]
+		idx += typeLen
+		if idLen > 0 {
+			rec.ID = data[idx : idx+idLen]
+		}
+		idx += idLen
+		rec.Payload = data[idx : idx+payloadLen]
+		idx += payloadLen
+		records = append(records, rec)
+
+		if (hdr & ndefFlagME) != 0 {
+			return records, nil
+		}
+		if idx >= len(data) {
+			return nil, fmt.Errorf("record %d: message ends without ME flag", len(records)-1)
+		}
+	}
+}
+
+// DecodeURIRecord returns the full URI from a well-known URI ("U") record,
+// expanding the identifier code with the NFC URI prefix table.
+func DecodeURIRecord(rec NDEFRecord) (string, error) {
+	if rec.TNF != TNFWellKnown || string(rec.Type) != "U" {
+		return "", fmt.Errorf("not a URI record")
+	}
+	if len(rec.Payload) == 0 {
+		return "", fmt.Errorf("empty URI payload")
+	}
+
+	return DecodeURIPrefix(rec.Payload[0], string(rec.Payload[1:])), nil
+}
+
+// Text record status byte (NFC Forum Text RTD).
+const (
+	textStatusUTF16   = 0x80 // Text is UTF-16; clear means UTF-8
+	textStatusLangLen = 0x3F // Length of the IANA language code
+)
+
+// BuildTextRecord returns a well-known Text ("T") record: a status byte, the
+// language code (e.g. "en", "zh-Hant") and the text, UTF-8 or, if useUTF16
+// is set, big-endian UTF-16 without a byte order mark. The status byte holds
+// the language code length in 6 bits, so a code longer than 63 bytes is
+// truncated.
+func BuildTextRecord(lang, text string, useUTF16 bool) NDEFRecord {
+	if len(lang) > textStatusLangLen {
+		lang = lang[:textStatusLangLen]
+	}
+	status := byte(len(lang))
+	var body []byte
+	if useUTF16 {
+		status |= textStatusUTF16
+		body = encodeUTF16BE(text)
+	} else {
+		body = []byte(text)
+	}
+	payload := make([]byte, 0, 1+len(lang)+len(body))
+	payload = append(payload, status)
+	payload = append(payload, lang...)
+	payload = append(payload, body...)
+	return NDEFRecord{TNF: TNFWellKnown, Type: []byte("T"), Payload: payload}
+}
+
+// DecodeTextRecord returns the language code and text of a well-known Text
+// ("T") record. UTF-16 text is read big-endian unless it starts with a byte
+// order mark.
+func DecodeTextRecord(rec NDEFRecord) (lang, text string, err error) {
+	if rec.TNF != TNFWellKnown || string(rec.Type) != "T" {
+		return "", "", fmt.Errorf("not a Text record")
+	}
+	if len(rec.Payload) == 0 {
+		return "", "", fmt.Errorf("empty Text payload")
+	}
+	status := rec.Payload[0]
+	n := int(status & textStatusLangLen)
+	if 1+n > len(rec.Payload) {
+		return "", "", fmt.Errorf("language code length %d exceeds payload", n)
+	}
+	lang = string(rec.Payload[1 : 1+n])
+	body := rec.Payload[1+n:]
+	if status&textStatusUTF16 == 0 {
+		if !utf8.Valid(body) {
+			return "", "", fmt.Errorf("text is not valid UTF-8")
+		}
+		return lang, string(body), nil
+	}
+
+	if len(body)%2 != 0 {
+		return "", "", fmt.Errorf("UTF-16 text has odd length %d", len(body))
+	}
+	bigEndian := true
+	if len(body) >= 2 {
+		switch {
+		case body[0] == 0xFE && body[1] == 0xFF:
+			body = body[2:]
+		case body[0] == 0xFF && body[1] == 0xFE:
+			bigEndian = false
+			body = body[2:]
+		}
+	}
+	units := make([]uint16, len(body)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(body[2*i])<<8 | uint16(body[2*i+1])
+		} else {
+			units[i] = uint16(body[2*i+1])<<8 | uint16(body[2*i])
+		}
+	}
+	return lang, string(utf16.Decode(units)), nil
+}
+
+// encodeUTF16BE encodes s as big-endian UTF-16 without a byte order mark.
+func encodeUTF16BE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
 }
@@ -0,0 +1,123 @@
+package ntag424
+
+import "fmt"
+
+// NDEFLayout is how the NDEF file frames the NDEF message.
+type NDEFLayout int
+
+const (
+	// NDEFLayoutStandardNLEN2 is the NFC Forum Type 4 layout NTAG 424 DNA
+	// uses: a 2-byte big-endian NLEN, then the message.
+	NDEFLayoutStandardNLEN2 NDEFLayout = iota
+	// NDEFLayoutTLV wraps the message in an NDEF Message TLV (T=0x03, L as
+	// one byte or 0xFF plus 2 bytes big-endian) followed by a Terminator TLV
+	// (0xFE), as Type 2 tags do. Some toolchains write this layout to Type 4
+	// files too.
+	NDEFLayoutTLV
+)
+
+// TLV tags in a TLV-wrapped NDEF file.
+const (
+	tlvNull       = 0x00
+	tlvNDEF       = 0x03
+	tlvTerminator = 0xFE
+)
+
+// ndefTLVHeadLen is how much of a TLV-wrapped file ReadNDEFWithLayout reads
+// to find the NDEF Message TLV; NULL and other TLVs before it must fit.
+const ndefTLVHeadLen = 32
+
+func (l NDEFLayout) String() string {
+	switch l {
+	case NDEFLayoutStandardNLEN2:
+		return "nlen2"
+	case NDEFLayoutTLV:
+		return "tlv"
+	default:
+		return fmt.Sprintf("NDEFLayout(%d)", int(l))
+	}
+}
+
+// ParseNDEFLayout parses a layout name as printed by NDEFLayout.String:
+// "nlen2" or "tlv".
+func ParseNDEFLayout(s string) (NDEFLayout, error) {
+	switch s {
+	case "nlen2":
+		return NDEFLayoutStandardNLEN2, nil
+	case "tlv":
+		return NDEFLayoutTLV, nil
+	default:
+		return 0, fmt.Errorf("unknown NDEF layout %q (want nlen2 or tlv)", s)
+	}
+}
+
+// ndefHeader returns the bytes that precede an n-byte message in layout.
+func ndefHeader(layout NDEFLayout, n int) ([]byte, error) {
+	switch layout {
+	case NDEFLayoutStandardNLEN2:
+		if n > 0xFFFF {
+			return nil, fmt.Errorf("NDEF message is %d bytes, NLEN holds at most 65535", n)
+		}
+		return []byte{byte(n >> 8), byte(n)}, nil
+	case NDEFLayoutTLV:
+		if n < 0xFF {
+			return []byte{tlvNDEF, byte(n)}, nil
+		}
+		if n > 0xFFFE {
+			return nil, fmt.Errorf("NDEF message is %d bytes, a TLV holds at most 65534", n)
+		}
+		return []byte{tlvNDEF, 0xFF, byte(n >> 8), byte(n)}, nil
+	default:
+		return nil, fmt.Errorf("unknown NDEF layout %d", int(layout))
+	}
+}
+
+// ndefTrailer returns the bytes that follow the message in layout.
+func ndefTrailer(layout NDEFLayout) []byte {
+	if layout == NDEFLayoutTLV {
+		return []byte{tlvTerminator}
+	}
+	return nil
+}
+
+// parseNDEFHeader finds the message in the first bytes of an NDEF file and
+// returns its offset and length. A TLV-wrapped file may start with NULL,
+// Lock Control, Memory Control or proprietary TLVs, which are skipped; a
+// Terminator before any NDEF Message TLV means the file is empty.
+func parseNDEFHeader(layout NDEFLayout, head []byte) (offset, length int, err error) {
+	switch layout {
+	case NDEFLayoutStandardNLEN2:
+		if len(head) < 2 {
+			return 0, 0, fmt.Errorf("NLEN read too short")
+		}
+		return 2, int(head[0])<<8 | int(head[1]), nil
+	case NDEFLayoutTLV:
+		truncated := fmt.Errorf("no NDEF Message TLV in the first %d bytes", len(head))
+		for i := 0; i < len(head); {
+			switch head[i] {
+			case tlvNull:
+				i++
+				continue
+			case tlvTerminator:
+				return i, 0, nil
+			}
+			if i+1 >= len(head) {
+				return 0, 0, truncated
+			}
+			l, n := int(head[i+1]), 2
+			if l == 0xFF {
+				if i+3 >= len(head) {
+					return 0, 0, truncated
+				}
+				l, n = int(head[i+2])<<8|int(head[i+3]), 4
+			}
+			if head[i] == tlvNDEF {
+				return i + n, l, nil
+			}
+			i += n + l
+		}
+		return 0, 0, truncated
+	default:
+		return 0, 0, fmt.Errorf("unknown NDEF layout %d", int(layout))
+	}
+}
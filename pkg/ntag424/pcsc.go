@@ -1,7 +1,12 @@
 package ntag424
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/ebfe/scard"
 )
@@ -13,6 +18,32 @@ type Connection struct {
 	Card      *scard.Card
 	Reader    string
 	ReaderIdx int
+
+	share  scard.ShareMode // zero means scard.ShareShared
+	proto  scard.Protocol  // zero means scard.ProtocolAny
+	handle cardHandle      // overrides Card in tests
+}
+
+// cardHandle is the part of *scard.Card that Transmit, Reconnect and
+// EnsureCard drive.
+type cardHandle interface {
+	Transmit(cmd []byte) ([]byte, error)
+	Status() (*scard.CardStatus, error)
+	Reconnect(mode scard.ShareMode, proto scard.Protocol, disp scard.Disposition) error
+}
+
+// card returns the handle commands are sent through.
+func (c *Connection) card() (cardHandle, error) {
+	if c == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+	if c.handle != nil {
+		return c.handle, nil
+	}
+	if c.Card == nil {
+		return nil, fmt.Errorf("connection not established")
+	}
+	return c.Card, nil
 }
 
 // Connect establishes a connection to a card reader.
@@ -23,7 +54,24 @@ type Connection struct {
 // Returns:
 //   - Connection struct with context and card
 //   - Error if connection fails
+//
+// The card is shared with other applications and any protocol is accepted;
+// see ConnectWithOptions.
 func Connect(readerIndex int) (*Connection, error) {
+	return ConnectWithOptions(readerIndex, scard.ShareShared, scard.ProtocolAny)
+}
+
+// ConnectWithOptions is Connect with an explicit share mode and protocol,
+// which Reconnect reuses after a card reset.
+//
+// scard.ShareExclusive keeps other applications (a reader daemon, a phone
+// companion app polling the same reader) off the card for the whole
+// connection. Use it for multi-step key changes when a shared connection
+// fails with "card in use" or a secure session drops mid-sequence;
+// Connection.WithTransaction is the lighter option for a single sequence.
+// scard.ProtocolT1 is for readers that fail protocol negotiation with
+// scard.ProtocolAny; contactless readers present the tag as T=1.
+func ConnectWithOptions(readerIndex int, share scard.ShareMode, proto scard.Protocol) (*Connection, error) {
 	ctx, err := scard.EstablishContext()
 	if err != nil {
 		return nil, fmt.Errorf("EstablishContext failed: %w", err)
@@ -39,8 +87,121 @@ func Connect(readerIndex int) (*Connection, error) {
 		return nil, fmt.Errorf("reader index out of range (0..%d)", len(readers)-1)
 	}
 
-	reader := readers[readerIndex]
-	card, err := ctx.Connect(reader, scard.ShareShared, scard.ProtocolAny)
+	return connectReader(ctx, readers, readerIndex, share, proto)
+}
+
+// ListReaders returns the names of the PC/SC readers currently attached.
+func ListReaders() ([]string, error) {
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		return nil, fmt.Errorf("EstablishContext failed: %w", err)
+	}
+	defer ctx.Release()
+
+	readers, err := ctx.ListReaders()
+	if err != nil {
+		return nil, fmt.Errorf("list readers: %w", err)
+	}
+	return readers, nil
+}
+
+// ConnectByName connects to the reader whose name contains substr
+// (e.g. "ACR122"). It fails if no reader or more than one reader matches;
+// see MatchReader.
+//
+// The card is shared with other applications and any protocol is accepted;
+// see ConnectByNameWithOptions.
+func ConnectByName(substr string) (*Connection, error) {
+	return ConnectByNameWithOptions(substr, scard.ShareShared, scard.ProtocolAny)
+}
+
+// ConnectByNameWithOptions is ConnectByName with an explicit share mode and
+// protocol; see ConnectWithOptions.
+func ConnectByNameWithOptions(substr string, share scard.ShareMode, proto scard.Protocol) (*Connection, error) {
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		return nil, fmt.Errorf("EstablishContext failed: %w", err)
+	}
+
+	readers, err := ctx.ListReaders()
+	if err != nil || len(readers) == 0 {
+		ctx.Release()
+		return nil, fmt.Errorf("no readers found: %v", err)
+	}
+	idx, err := MatchReader(readers, substr)
+	if err != nil {
+		ctx.Release()
+		return nil, err
+	}
+	return connectReader(ctx, readers, idx, share, proto)
+}
+
+// MatchReader returns the index of the single reader whose name contains
+// substr. An exact name match wins over substring matches, so a full name
+// returned by ListReaders always selects that reader.
+func MatchReader(readers []string, substr string) (int, error) {
+	if substr == "" {
+		return -1, fmt.Errorf("reader name is empty")
+	}
+	var matches []int
+	for i, r := range readers {
+		if r == substr {
+			return i, nil
+		}
+		if strings.Contains(r, substr) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("no reader matches %q (available: %s)", substr, strings.Join(readers, ", "))
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, idx := range matches {
+			names[i] = readers[idx]
+		}
+		return -1, fmt.Errorf("reader name %q is ambiguous, matches: %s", substr, strings.Join(names, ", "))
+	}
+}
+
+// ParseShareMode parses a -share flag value: "shared" or "exclusive".
+func ParseShareMode(s string) (scard.ShareMode, error) {
+	switch strings.ToLower(s) {
+	case "shared":
+		return scard.ShareShared, nil
+	case "exclusive":
+		return scard.ShareExclusive, nil
+	default:
+		return 0, fmt.Errorf("unknown share mode %q (want shared or exclusive)", s)
+	}
+}
+
+// ParseProtocol parses a -protocol flag value: "any", "t0" or "t1".
+func ParseProtocol(s string) (scard.Protocol, error) {
+	switch strings.ToLower(s) {
+	case "any":
+		return scard.ProtocolAny, nil
+	case "t0":
+		return scard.ProtocolT0, nil
+	case "t1":
+		return scard.ProtocolT1, nil
+	default:
+		return 0, fmt.Errorf("unknown protocol %q (want any, t0 or t1)", s)
+	}
+}
+
+// scardConnect connects to a reader; tests replace it to observe the options.
+var scardConnect = func(ctx *scard.Context, reader string, share scard.ShareMode, proto scard.Protocol) (*scard.Card, error) {
+	return ctx.Connect(reader, share, proto)
+}
+
+// connectReader connects to readers[idx] and takes ownership of ctx,
+// releasing it on failure.
+func connectReader(ctx *scard.Context, readers []string, idx int, share scard.ShareMode, proto scard.Protocol) (*Connection, error) {
+	reader := readers[idx]
+	card, err := scardConnect(ctx, reader, share, proto)
 	if err != nil {
 		ctx.Release()
 		return nil, fmt.Errorf("connect failed: %w", err)
@@ -50,10 +211,144 @@ func Connect(readerIndex int) (*Connection, error) {
 		ctx:       ctx,
 		Card:      card,
 		Reader:    reader,
-		ReaderIdx: readerIndex,
+		ReaderIdx: idx,
+		share:     share,
+		proto:     proto,
 	}, nil
 }
 
+// options returns the share mode and protocol to reconnect with.
+func (c *Connection) options() (scard.ShareMode, scard.Protocol) {
+	share, proto := c.share, c.proto
+	if share == 0 {
+		share = scard.ShareShared
+	}
+	if proto == 0 {
+		proto = scard.ProtocolAny
+	}
+	return share, proto
+}
+
+// Card monitoring timing. GetStatusChange blocks for at most
+// monitorPollInterval so cancellation is noticed even if Cancel is missed.
+const (
+	monitorPollInterval = time.Second
+	monitorConnectTries = 3
+	monitorRetryDelay   = 200 * time.Millisecond
+)
+
+// MonitorCards watches reader (a full name or a unique fragment, see
+// MatchReader) and calls onInsert with a freshly connected Connection each
+// time a card is placed on it. The connection is closed when onInsert
+// returns; the callback runs on the monitoring goroutine, so the next card
+// is not detected until it returns.
+//
+// Timeouts and transient PC/SC errors are logged and polling continues; a
+// card that cannot be connected after a few attempts is skipped until it is
+// removed. MonitorCards returns nil when ctx is cancelled.
+//
+// Cards are connected shared with any protocol; see MonitorCardsWithOptions.
+func MonitorCards(ctx context.Context, reader string, onInsert func(*Connection)) error {
+	return MonitorCardsWithOptions(ctx, reader, scard.ShareShared, scard.ProtocolAny, onInsert)
+}
+
+// MonitorCardsWithOptions is MonitorCards connecting each card with share
+// and proto, as ConnectWithOptions does.
+func MonitorCardsWithOptions(ctx context.Context, reader string, share scard.ShareMode, proto scard.Protocol, onInsert func(*Connection)) error {
+	sctx, err := scard.EstablishContext()
+	if err != nil {
+		return fmt.Errorf("EstablishContext failed: %w", err)
+	}
+	defer sctx.Release()
+
+	readers, err := sctx.ListReaders()
+	if err != nil || len(readers) == 0 {
+		return fmt.Errorf("no readers found: %v", err)
+	}
+	idx, err := MatchReader(readers, reader)
+	if err != nil {
+		return err
+	}
+	reader = readers[idx]
+
+	// Wake GetStatusChange as soon as the caller cancels.
+	stop := context.AfterFunc(ctx, func() { _ = sctx.Cancel() })
+	defer stop()
+
+	states := []scard.ReaderState{{Reader: reader, CurrentState: scard.StateUnaware}}
+	present := false
+	for ctx.Err() == nil {
+		err := sctx.GetStatusChange(states, monitorPollInterval)
+		if errors.Is(err, scard.ErrTimeout) || errors.Is(err, scard.ErrCancelled) {
+			continue
+		}
+		if err != nil {
+			slog.Warn("GetStatusChange failed, retrying", "reader", reader, "error", err)
+			sleepCtx(ctx, monitorRetryDelay)
+			continue
+		}
+
+		rs := states[0]
+		inserted, removed := presenceEdge(present, rs.EventState)
+		switch {
+		case inserted:
+			present = true
+			card, err := connectWithRetry(ctx, sctx, reader, share, proto)
+			if err != nil {
+				slog.Warn("connect to inserted card failed, remove and re-tap", "reader", reader, "error", err)
+				break
+			}
+			conn := &Connection{Card: card, Reader: reader, ReaderIdx: idx, share: share, proto: proto}
+			onInsert(conn)
+			conn.Close()
+		case removed:
+			present = false
+		}
+		states[0].CurrentState = rs.EventState
+	}
+	return nil
+}
+
+// presenceEdge reports whether a reader state change is a card insertion or
+// removal, given whether a card was present before.
+func presenceEdge(present bool, state scard.StateFlag) (inserted, removed bool) {
+	if state&scard.StatePresent != 0 && !present {
+		return true, false
+	}
+	if state&scard.StateEmpty != 0 && present {
+		return false, true
+	}
+	return false, false
+}
+
+func connectWithRetry(ctx context.Context, sctx *scard.Context, reader string, share scard.ShareMode, proto scard.Protocol) (*scard.Card, error) {
+	var err error
+	for i := 0; i < monitorConnectTries; i++ {
+		var card *scard.Card
+		card, err = scardConnect(sctx, reader, share, proto)
+		if err == nil {
+			return card, nil
+		}
+		if !sleepCtx(ctx, monitorRetryDelay) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("connect failed: %w", err)
+}
+
+// sleepCtx waits for d or until ctx is done, reporting whether the full
+// delay elapsed.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
 // Close disconnects the card and releases the PC/SC context.
 func (c *Connection) Close() {
 	if c == nil {
@@ -67,10 +362,114 @@ func (c *Connection) Close() {
 	}
 }
 
+// BeginTransaction starts an exclusive PC/SC transaction on the card, so no
+// other process can send APDUs to it until EndTransaction. Use it around
+// multi-step flows: a foreign APDU between two secure messaging commands
+// desynchronizes the DESFire command counter and drops the session.
+//
+// A transaction that is never ended blocks every other application using the
+// reader (including pcscd-driven daemons) until the card is disconnected or
+// removed. Prefer WithTransaction, which always ends it.
+func (c *Connection) BeginTransaction() error {
+	if c == nil || c.Card == nil {
+		return fmt.Errorf("connection not established")
+	}
+	if err := c.Card.BeginTransaction(); err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	return nil
+}
+
+// EndTransaction ends a transaction started by BeginTransaction, leaving the
+// card powered and in its current state (scard.LeaveCard).
+func (c *Connection) EndTransaction() error {
+	if c == nil || c.Card == nil {
+		return fmt.Errorf("connection not established")
+	}
+	if err := c.Card.EndTransaction(scard.LeaveCard); err != nil {
+		return fmt.Errorf("end transaction: %w", err)
+	}
+	return nil
+}
+
+// WithTransaction runs fn inside BeginTransaction/EndTransaction. The
+// transaction is ended even if fn fails; fn's error takes precedence over an
+// error ending the transaction.
+func (c *Connection) WithTransaction(fn func() error) error {
+	if err := c.BeginTransaction(); err != nil {
+		return err
+	}
+	err := fn()
+	if endErr := c.EndTransaction(); err == nil {
+		err = endErr
+	}
+	return err
+}
+
 // Transmit sends an APDU to the card (implements Card interface).
+//
+// If the transfer fails because the card was reset or powered down (reader
+// sleep, another process resetting it), Transmit reconnects once and resends
+// the APDU. The reconnect loses the selected application and any EV2
+// session, so a resent secure messaging command fails with an
+// authentication error rather than a transport error; callers re-select and
+// re-authenticate as after any reset.
 func (c *Connection) Transmit(apdu []byte) ([]byte, error) {
-	if c == nil || c.Card == nil {
-		return nil, fmt.Errorf("connection not established")
+	h, err := c.card()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.Transmit(apdu)
+	if err == nil || !needsReconnect(err) {
+		return resp, err
+	}
+	slog.Warn("card connection lost, reconnecting", "reader", c.Reader, "error", err)
+	if rerr := c.Reconnect(); rerr != nil {
+		return nil, fmt.Errorf("%w (reconnect failed: %v)", err, rerr)
+	}
+	return h.Transmit(apdu)
+}
+
+// Reconnect re-establishes the connection to the card on the same reader
+// with the share mode and protocol it was connected with, leaving the card
+// in its current state. Like a card reset, it drops the selected
+// application and any EV2 session.
+func (c *Connection) Reconnect() error {
+	h, err := c.card()
+	if err != nil {
+		return err
+	}
+	share, proto := c.options()
+	if err := h.Reconnect(share, proto, scard.LeaveCard); err != nil {
+		return fmt.Errorf("reconnect: %w", err)
 	}
-	return c.Card.Transmit(apdu)
+	return nil
+}
+
+// EnsureCard checks that the card is still present and reachable, and
+// reconnects if it was reset or powered down since the last command. A
+// removed card is an error: a card tapped in its place is a different tag.
+// Scan loops call it before starting work on a connection that may have
+// been idle.
+func (c *Connection) EnsureCard() error {
+	h, err := c.card()
+	if err != nil {
+		return err
+	}
+	_, err = h.Status()
+	switch {
+	case err == nil:
+		return nil
+	case needsReconnect(err):
+		slog.Info("card was reset, reconnecting", "reader", c.Reader, "error", err)
+		return c.Reconnect()
+	default:
+		return fmt.Errorf("card not available: %w", err)
+	}
+}
+
+// needsReconnect reports whether a PC/SC error means the card is still on
+// the reader but the handle must be reconnected before it can be used.
+func needsReconnect(err error) bool {
+	return errors.Is(err, scard.ErrResetCard) || errors.Is(err, scard.ErrUnpoweredCard)
 }
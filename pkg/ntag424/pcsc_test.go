@@ -0,0 +1,219 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ebfe/scard"
+)
+
+func TestMatchReader(t *testing.T) {
+	readers := []string{
+		"ACS ACR122U PICC Interface 00",
+		"Identiv uTrust 3700 F CL Reader 00",
+		"Identiv uTrust 3700 F CL Reader 01",
+	}
+
+	cases := []struct {
+		substr  string
+		want    int
+		wantErr string
+	}{
+		{substr: "ACR122", want: 0},
+		{substr: "Reader 01", want: 2},
+		{substr: "Identiv uTrust 3700 F CL Reader 00", want: 1},
+		{substr: "uTrust", want: -1, wantErr: "ambiguous"},
+		{substr: "SCL3711", want: -1, wantErr: "no reader matches"},
+		{substr: "", want: -1, wantErr: "empty"},
+	}
+	for _, tc := range cases {
+		got, err := MatchReader(readers, tc.substr)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("MatchReader(%q): expected error containing %q, got %v", tc.substr, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("MatchReader(%q) returned error: %v", tc.substr, err)
+		}
+		if got != tc.want {
+			t.Fatalf("MatchReader(%q) = %d, want %d", tc.substr, got, tc.want)
+		}
+	}
+}
+
+func TestMatchReaderExactNameBeatsSubstring(t *testing.T) {
+	readers := []string{"Reader 0", "Reader 00"}
+	got, err := MatchReader(readers, "Reader 0")
+	if err != nil {
+		t.Fatalf("MatchReader returned error: %v", err)
+	}
+	if got != 0 {
+		t.Fatalf("expected exact match at index 0, got %d", got)
+	}
+}
+
+func TestPresenceEdge(t *testing.T) {
+	cases := []struct {
+		present           bool
+		state             scard.StateFlag
+		inserted, removed bool
+	}{
+		{present: false, state: scard.StatePresent | scard.StateChanged, inserted: true},
+		{present: true, state: scard.StatePresent | scard.StateInuse},
+		{present: true, state: scard.StateEmpty | scard.StateChanged, removed: true},
+		{present: false, state: scard.StateEmpty},
+	}
+	for _, tc := range cases {
+		inserted, removed := presenceEdge(tc.present, tc.state)
+		if inserted != tc.inserted || removed != tc.removed {
+			t.Fatalf("presenceEdge(%v, %#x) = (%v, %v), want (%v, %v)",
+				tc.present, tc.state, inserted, removed, tc.inserted, tc.removed)
+		}
+	}
+}
+
+func TestWithTransactionRequiresConnection(t *testing.T) {
+	called := false
+	err := (&Connection{}).WithTransaction(func() error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Fatalf("expected error without calling fn on an unconnected card, got %v (called=%v)", err, called)
+	}
+	if err := (*Connection)(nil).EndTransaction(); err == nil {
+		t.Fatalf("expected EndTransaction on nil connection to fail")
+	}
+}
+
+// flakyHandle is a cardHandle whose transmits and status checks fail with
+// err until Reconnect is called.
+type flakyHandle struct {
+	err        error
+	reconnects int
+	sent       int
+	share      scard.ShareMode // options of the last Reconnect
+	proto      scard.Protocol
+}
+
+func (h *flakyHandle) Transmit(cmd []byte) ([]byte, error) {
+	h.sent++
+	if h.reconnects == 0 {
+		return nil, h.err
+	}
+	return []byte{0x90, 0x00}, nil
+}
+
+func (h *flakyHandle) Status() (*scard.CardStatus, error) {
+	if h.reconnects == 0 {
+		return nil, h.err
+	}
+	return &scard.CardStatus{}, nil
+}
+
+func (h *flakyHandle) Reconnect(share scard.ShareMode, proto scard.Protocol, _ scard.Disposition) error {
+	h.reconnects++
+	h.share, h.proto = share, proto
+	return nil
+}
+
+func TestConnectionTransmitReconnectsAfterReset(t *testing.T) {
+	h := &flakyHandle{err: scard.ErrResetCard}
+	conn := &Connection{Reader: "fake", handle: h}
+
+	resp, err := conn.Transmit([]byte{0x90, 0x60, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("Transmit returned error: %v", err)
+	}
+	if !bytes.Equal(resp, []byte{0x90, 0x00}) || h.reconnects != 1 || h.sent != 2 {
+		t.Fatalf("expected one reconnect and a resend, got resp %X, %d reconnects, %d sends", resp, h.reconnects, h.sent)
+	}
+
+	// Other transport errors are returned without reconnecting.
+	h = &flakyHandle{err: scard.ErrRemovedCard}
+	conn.handle = h
+	if _, err := conn.Transmit([]byte{0x90, 0x60, 0x00, 0x00, 0x00}); !errors.Is(err, scard.ErrRemovedCard) || h.reconnects != 0 {
+		t.Fatalf("expected removed-card error without reconnect, got %v (%d reconnects)", err, h.reconnects)
+	}
+}
+
+func TestConnectionEnsureCard(t *testing.T) {
+	h := &flakyHandle{err: scard.ErrUnpoweredCard}
+	conn := &Connection{handle: h}
+	if err := conn.EnsureCard(); err != nil || h.reconnects != 1 {
+		t.Fatalf("expected EnsureCard to reconnect once, got %v (%d reconnects)", err, h.reconnects)
+	}
+	if err := conn.EnsureCard(); err != nil || h.reconnects != 1 {
+		t.Fatalf("expected healthy card to need no reconnect, got %v (%d reconnects)", err, h.reconnects)
+	}
+
+	conn.handle = &flakyHandle{err: scard.ErrRemovedCard}
+	if err := conn.EnsureCard(); !errors.Is(err, scard.ErrRemovedCard) {
+		t.Fatalf("expected removed-card error, got %v", err)
+	}
+	if err := (&Connection{}).EnsureCard(); err == nil {
+		t.Fatal("expected EnsureCard on an unconnected card to fail")
+	}
+}
+
+func TestConnectOptionsPassThrough(t *testing.T) {
+	var gotShare scard.ShareMode
+	var gotProto scard.Protocol
+	saved := scardConnect
+	defer func() { scardConnect = saved }()
+	scardConnect = func(_ *scard.Context, reader string, share scard.ShareMode, proto scard.Protocol) (*scard.Card, error) {
+		gotShare, gotProto = share, proto
+		return &scard.Card{}, nil
+	}
+
+	conn, err := connectReader(nil, []string{"Reader 00"}, 0, scard.ShareExclusive, scard.ProtocolT1)
+	if err != nil {
+		t.Fatalf("connectReader returned error: %v", err)
+	}
+	if gotShare != scard.ShareExclusive || gotProto != scard.ProtocolT1 {
+		t.Fatalf("expected exclusive/T=1 on connect, got %v/%v", gotShare, gotProto)
+	}
+
+	// Reconnect after a reset keeps the options.
+	h := &flakyHandle{}
+	conn.handle = h
+	if err := conn.Reconnect(); err != nil {
+		t.Fatalf("Reconnect returned error: %v", err)
+	}
+	if h.share != scard.ShareExclusive || h.proto != scard.ProtocolT1 {
+		t.Fatalf("expected exclusive/T=1 on reconnect, got %v/%v", h.share, h.proto)
+	}
+
+	// A Connection built without options reconnects shared/any.
+	h = &flakyHandle{}
+	if err := (&Connection{handle: h}).Reconnect(); err != nil {
+		t.Fatalf("Reconnect returned error: %v", err)
+	}
+	if h.share != scard.ShareShared || h.proto != scard.ProtocolAny {
+		t.Fatalf("expected shared/any by default, got %v/%v", h.share, h.proto)
+	}
+}
+
+func TestParseShareModeAndProtocol(t *testing.T) {
+	if m, err := ParseShareMode("exclusive"); err != nil || m != scard.ShareExclusive {
+		t.Fatalf("ParseShareMode(exclusive) = %v, %v", m, err)
+	}
+	if m, err := ParseShareMode("shared"); err != nil || m != scard.ShareShared {
+		t.Fatalf("ParseShareMode(shared) = %v, %v", m, err)
+	}
+	if _, err := ParseShareMode("direct"); err == nil {
+		t.Fatal("expected error for unsupported share mode")
+	}
+	for s, want := range map[string]scard.Protocol{"any": scard.ProtocolAny, "t0": scard.ProtocolT0, "T1": scard.ProtocolT1} {
+		if p, err := ParseProtocol(s); err != nil || p != want {
+			t.Fatalf("ParseProtocol(%s) = %v, %v; want %v", s, p, err, want)
+		}
+	}
+	if _, err := ParseProtocol("t=1"); err == nil {
+		t.Fatal("expected error for unknown protocol")
+	}
+}
@@ -0,0 +1,191 @@
+package ntag424
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PICCDataTag for a mirrored 7-byte UID and read counter: bit 7 = UID
+// mirrored, bit 6 = SDMReadCtr mirrored, bits 3:0 = UID length.
+const piccDataTagUIDCtr = 0xC7
+
+// Query parameters written by BuildSDMNDEFEncryptedPICC.
+const (
+	piccDataParam = "picc_data"
+	piccMACParam  = "mac"
+)
+
+// EncryptPICCData builds the encrypted PICC data block a tag in
+// PICC-data mode mirrors on tap:
+//
+//	E(SDMMetaReadKey, PICCDataTag || UID(7) || SDMReadCtr_LE(3) || padding(5))
+//
+// The block is a single AES-128 block encrypted with a zero IV; the tag pads
+// with random bytes, and so does this function.
+func EncryptPICCData(metaKey, uid []byte, counter uint32) ([]byte, error) {
+	if len(metaKey) != 16 {
+		return nil, fmt.Errorf("SDM meta key must be 16 bytes, got %d", len(metaKey))
+	}
+	if len(uid) != 7 {
+		return nil, fmt.Errorf("UID must be 7 bytes, got %d", len(uid))
+	}
+	if counter > 0xFFFFFF {
+		return nil, fmt.Errorf("counter must be <= 0xFFFFFF, got %d", counter)
+	}
+
+	plain := make([]byte, 16)
+	plain[0] = piccDataTagUIDCtr
+	copy(plain[1:8], uid)
+	plain[8], plain[9], plain[10] = byte(counter), byte(counter>>8), byte(counter>>16)
+	if _, err := rand.Read(plain[11:]); err != nil {
+		return nil, fmt.Errorf("PICC data padding: %w", err)
+	}
+	return aesCBCEncrypt(metaKey, make([]byte, 16), plain)
+}
+
+// DecryptPICCData decrypts an encrypted PICC data block with the SDM meta
+// read key and returns the mirrored UID and read counter. Only blocks with
+// both UID and counter mirrored (PICCDataTag 0xC7) are accepted.
+func DecryptPICCData(metaKey, encrypted []byte) (uid []byte, counter uint32, err error) {
+	if len(metaKey) != 16 {
+		return nil, 0, fmt.Errorf("SDM meta key must be 16 bytes, got %d", len(metaKey))
+	}
+	if len(encrypted) != 16 {
+		return nil, 0, fmt.Errorf("PICC data must be 16 bytes, got %d", len(encrypted))
+	}
+	plain, err := aesCBCDecrypt(metaKey, make([]byte, 16), encrypted)
+	if err != nil {
+		return nil, 0, err
+	}
+	if plain[0] != piccDataTagUIDCtr {
+		return nil, 0, fmt.Errorf("unexpected PICCDataTag 0x%02X (wrong meta key?)", plain[0])
+	}
+	uid = append([]byte(nil), plain[1:8]...)
+	counter = uint32(plain[8]) | uint32(plain[9])<<8 | uint32(plain[10])<<16
+	return uid, counter, nil
+}
+
+// GenerateSDMURLEncryptedPICC simulates a tap on a tag provisioned with
+// BuildSDMNDEFEncryptedPICC. It is the inverse of VerifySDMMACEncryptedPICC.
+//
+// Parameters:
+//   - baseURL: Base URL (e.g., "https://api.guideapparel.com/tap")
+//   - uid: 7-byte tag UID
+//   - counter: SDM read counter value (0-0xFFFFFF)
+//   - metaKey: 16-byte SDM meta read key (encrypts the PICC data)
+//   - fileKey: 16-byte SDM file read key (MAC session key base)
+//
+// Returns:
+//   - URL with picc_data and mac parameters first, existing parameters after
+//   - error if validation fails
+//
+// The function:
+//  1. Encrypts PICCDataTag || UID || counter with metaKey
+//  2. Derives the SDM session key from fileKey, UID and counter
+//  3. Computes CMAC over "picc_data=<32 hex>&mac="
+//  4. Truncates CMAC to 8 bytes (odd bytes only)
+func GenerateSDMURLEncryptedPICC(baseURL string, uid []byte, counter uint32, metaKey, fileKey []byte) (string, error) {
+	baseKey, err := newSDMBaseKey(fileKey)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %v", err)
+	}
+
+	encrypted, err := EncryptPICCData(metaKey, uid, counter)
+	if err != nil {
+		return "", err
+	}
+	piccHex := strings.ToUpper(hex.EncodeToString(encrypted))
+
+	ctrLE := []byte{byte(counter), byte(counter >> 8), byte(counter >> 16)}
+	sessionKey, err := deriveSDMSessionKey(baseKey, uid, ctrLE)
+	if err != nil {
+		return "", fmt.Errorf("session key derive: %v", err)
+	}
+	cmac, err := AESCMAC(sessionKey, []byte(piccMACInput(piccHex)))
+	if err != nil {
+		return "", fmt.Errorf("CMAC error: %v", err)
+	}
+	macHex := strings.ToUpper(hex.EncodeToString(TruncateOddBytes(cmac)))
+
+	// Keep the tag's parameter order: the SDM block leads the query.
+	q := u.Query()
+	for _, key := range []string{piccDataParam, piccMACParam, "uid", "ctr"} {
+		q.Del(key)
+	}
+	u.RawQuery = piccDataParam + "=" + piccHex + "&" + piccMACParam + "=" + macHex
+	if rest := q.Encode(); rest != "" {
+		u.RawQuery += "&" + rest
+	}
+	return u.String(), nil
+}
+
+// VerifySDMMACEncryptedPICC verifies a URL from a tag in PICC-data mode.
+// The picc_data parameter is decrypted with metaKey to recover the UID and
+// counter, which then derive the MAC session key from fileKey.
+//
+// Returns:
+//   - match: true if the MAC matches
+//   - uid, counter: decrypted from picc_data
+//   - error if parsing, decryption or derivation fails
+func VerifySDMMACEncryptedPICC(rawURL string, metaKey, fileKey []byte) (match bool, uid []byte, counter uint32, err error) {
+	match, uid, counter, _, err = VerifySDMMACEncryptedPICCDetailed(rawURL, metaKey, fileKey)
+	return match, uid, counter, err
+}
+
+// VerifySDMMACEncryptedPICCDetailed is VerifySDMMACEncryptedPICC that also
+// returns the MAC it computed, as uppercase hex, like VerifySDMMACDetailed.
+// computedMAC is empty when verification fails before the MAC is computed.
+func VerifySDMMACEncryptedPICCDetailed(rawURL string, metaKey, fileKey []byte) (match bool, uid []byte, counter uint32, computedMAC string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, nil, 0, "", err
+	}
+	q := u.Query()
+	piccHex, mac := q.Get(piccDataParam), q.Get(piccMACParam)
+	if len(piccHex) != sdmPICCDataLenASCII || len(mac) != sdmMacLenASCII {
+		return false, nil, 0, "", fmt.Errorf("invalid parameter lengths: %s=%d %s=%d (want %d,%d)",
+			piccDataParam, len(piccHex), piccMACParam, len(mac), sdmPICCDataLenASCII, sdmMacLenASCII)
+	}
+	encrypted, err := hex.DecodeString(piccHex)
+	if err != nil {
+		return false, nil, 0, "", fmt.Errorf("PICC data hex decode: %v", err)
+	}
+	expected, err := hex.DecodeString(mac)
+	if err != nil {
+		return false, nil, 0, "", fmt.Errorf("MAC decode error")
+	}
+
+	uid, counter, err = DecryptPICCData(metaKey, encrypted)
+	if err != nil {
+		return false, nil, 0, "", err
+	}
+	baseKey, err := newSDMBaseKey(fileKey)
+	if err != nil {
+		return false, uid, counter, "", err
+	}
+	ctrLE := []byte{byte(counter), byte(counter >> 8), byte(counter >> 16)}
+	sessionKey, err := deriveSDMSessionKey(baseKey, uid, ctrLE)
+	if err != nil {
+		return false, uid, counter, "", fmt.Errorf("session key derive: %v", err)
+	}
+	cmac, err := AESCMAC(sessionKey, []byte(piccMACInput(piccHex)))
+	if err != nil {
+		return false, uid, counter, "", fmt.Errorf("CMAC error: %v", err)
+	}
+	computed := TruncateOddBytes(cmac)
+	return bytes.Equal(computed, expected), uid, counter, strings.ToUpper(hex.EncodeToString(computed)), nil
+}
+
+// piccMACInput is the ASCII MAC input for PICC-data mode, matching the
+// bytes BuildSDMNDEFEncryptedPICC places between MacInputOffset and MacOffset.
+func piccMACInput(piccHex string) string {
+	return piccDataParam + "=" + piccHex + "&" + piccMACParam + "="
+}
@@ -0,0 +1,113 @@
+package ntag424
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var testMetaKey = []byte{0xF0, 0xE1, 0xD2, 0xC3, 0xB4, 0xA5, 0x96, 0x87, 0x78, 0x69, 0x5A, 0x4B, 0x3C, 0x2D, 0x1E, 0x0F}
+
+func TestGenerateSDMURLEncryptedPICCRoundTrip(t *testing.T) {
+	for _, ctr := range []uint32{0, 0x00002A, 0xFFFFFF} {
+		rawURL, err := GenerateSDMURLEncryptedPICC("https://example.com/tap?hat=42&uid=stale", testUID, ctr, testMetaKey, testSDMKey)
+		if err != nil {
+			t.Fatalf("GenerateSDMURLEncryptedPICC returned error: %v", err)
+		}
+
+		match, uid, counter, err := VerifySDMMACEncryptedPICC(rawURL, testMetaKey, testSDMKey)
+		if err != nil {
+			t.Fatalf("VerifySDMMACEncryptedPICC returned error: %v", err)
+		}
+		if !match || !bytes.Equal(uid, testUID) || counter != ctr {
+			t.Fatalf("expected match for UID % X counter %d, got match=%v uid=% X counter=%d", testUID, ctr, match, uid, counter)
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("parse generated URL: %v", err)
+		}
+		if !strings.HasPrefix(u.RawQuery, "picc_data=") || u.Query().Get("hat") != "42" || u.Query().Get("uid") != "" {
+			t.Fatalf("expected picc_data first, hat kept and uid dropped, got %q", u.RawQuery)
+		}
+	}
+}
+
+func TestGenerateSDMURLEncryptedPICCMatchesNDEFLayout(t *testing.T) {
+	sdm, err := BuildSDMNDEFEncryptedPICC("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEFEncryptedPICC returned error: %v", err)
+	}
+	rawURL, err := GenerateSDMURLEncryptedPICC("https://example.com/tap", testUID, 7, testMetaKey, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLEncryptedPICC returned error: %v", err)
+	}
+	piccHex := mustQuery(t, rawURL, "picc_data")
+
+	// The MAC input is the template bytes with the ciphertext mirrored in.
+	input := append([]byte{}, sdm.NDEF[sdm.MacInputOffset:sdm.MacOffset]...)
+	copy(input[sdm.PICCDataOffset-sdm.MacInputOffset:], piccHex)
+	if got := string(input); got != piccMACInput(piccHex) {
+		t.Fatalf("expected MAC input %q, got %q", piccMACInput(piccHex), got)
+	}
+}
+
+func TestVerifySDMMACEncryptedPICCDetailed(t *testing.T) {
+	rawURL, err := GenerateSDMURLEncryptedPICC("https://example.com/tap", testUID, 9, testMetaKey, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLEncryptedPICC returned error: %v", err)
+	}
+	mac := mustQuery(t, rawURL, "mac")
+
+	match, uid, counter, computed, err := VerifySDMMACEncryptedPICCDetailed(rawURL, testMetaKey, testSDMKey)
+	if err != nil || !match || !bytes.Equal(uid, testUID) || counter != 9 || computed != mac {
+		t.Fatalf("expected match with computed MAC %s, got match=%v uid=% X counter=%d computed=%s err=%v", mac, match, uid, counter, computed, err)
+	}
+
+	match, _, _, computed, err = VerifySDMMACEncryptedPICCDetailed(rawURL, testMetaKey, bytes.Repeat([]byte{0x42}, 16))
+	if err != nil || match || len(computed) != 16 || computed == mac {
+		t.Fatalf("expected a different computed MAC with the wrong file key, got match=%v computed=%s err=%v", match, computed, err)
+	}
+}
+
+func TestVerifySDMMACEncryptedPICCWrongKeys(t *testing.T) {
+	rawURL, err := GenerateSDMURLEncryptedPICC("https://example.com/tap", testUID, 5, testMetaKey, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLEncryptedPICC returned error: %v", err)
+	}
+
+	otherKey := bytes.Repeat([]byte{0x42}, 16)
+	match, _, counter, err := VerifySDMMACEncryptedPICC(rawURL, testMetaKey, otherKey)
+	if err != nil || match || counter != 5 {
+		t.Fatalf("expected MAC mismatch with wrong file key, got match=%v counter=%d err=%v", match, counter, err)
+	}
+	// Fixed padding keeps the wrong-key PICCDataTag check deterministic.
+	plain := append(append([]byte{piccDataTagUIDCtr}, testUID...), 5, 0, 0, 0, 0, 0, 0, 0)
+	encrypted, err := aesCBCEncrypt(testMetaKey, make([]byte, 16), plain)
+	if err != nil {
+		t.Fatalf("aesCBCEncrypt returned error: %v", err)
+	}
+	if _, _, err := DecryptPICCData(otherKey, encrypted); err == nil {
+		t.Fatalf("expected error decrypting with wrong meta key")
+	}
+	if _, _, _, err := VerifySDMMACEncryptedPICC("https://example.com/tap?picc_data=00&mac=00", testMetaKey, testSDMKey); err == nil {
+		t.Fatalf("expected error for short parameters")
+	}
+	if _, err := GenerateSDMURLEncryptedPICC("https://example.com/tap", testUID, 0x1000000, testMetaKey, testSDMKey); err == nil {
+		t.Fatalf("expected error for counter above 0xFFFFFF")
+	}
+}
+
+func mustQuery(t *testing.T, rawURL, key string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse %q: %v", rawURL, err)
+	}
+	v := u.Query().Get(key)
+	if v == "" {
+		t.Fatalf("missing %s in %q", key, rawURL)
+	}
+	return v
+}
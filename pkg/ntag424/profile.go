@@ -0,0 +1,70 @@
+package ntag424
+
+// ProvisioningProfile holds the file settings a product line provisions the
+// SDM (NDEF) file with: comm mode, access rights and SDM options/key slots.
+// The mirror offsets are not part of the profile; they come from the NDEF
+// template (see FileSettings).
+type ProvisioningProfile struct {
+	Name       string       `json:"name"`
+	CommMode   byte         `json:"comm_mode"`   // FileOption bits 1:0 (0x00 plain, 0x01 MAC, 0x03 full)
+	Access     AccessRights `json:"access"`      // AR1/AR2 of the SDM file
+	SDMOptions byte         `json:"sdm_options"` // bit 7=UID, bit 6=Ctr, bit 0=ASCII
+	SDMMeta    byte         `json:"sdm_meta"`    // SDMMetaRead key, 0xE = plain UID/Ctr
+	SDMFile    byte         `json:"sdm_file"`    // SDMFileRead key (MAC key)
+	SDMCtr     byte         `json:"sdm_ctr"`     // SDMCtrRet key
+}
+
+// DefaultGuideApparelProfile returns the profile the tools have always
+// provisioned:
+//
+//	CommMode=plain, AR1=0x20, AR2=0xE2 (Read=free Write=slot2 ReadWrite=slot2 Change=slot0)
+//	SDMOptions=0xC1 (UID + ReadCtr mirrored, ASCII), Meta=0xE (plain), File=slot1, Ctr=slot1
+func DefaultGuideApparelProfile() ProvisioningProfile {
+	return ProvisioningProfile{
+		Name:     "guideapparel",
+		CommMode: 0x00,
+		Access: AccessRights{
+			Read:               ARFree,
+			Write:              0x02,
+			ReadWrite:          0x02,
+			ChangeAccessRights: 0x00,
+		},
+		SDMOptions: 0xC1,
+		SDMMeta:    0x0E,
+		SDMFile:    0x01,
+		SDMCtr:     0x01,
+	}
+}
+
+// AccessRightsBytes returns the profile's access rights as AR1/AR2.
+func (p ProvisioningProfile) AccessRightsBytes() (ar1, ar2 byte) {
+	return p.Access.Encode()
+}
+
+// FileSettings returns the settings to write to the SDM file. The mirror
+// offsets are taken from sdm when it is non-nil (see SDMNDEF.ApplyTo).
+func (p ProvisioningProfile) FileSettings(sdm *SDMNDEF) *FileSettings {
+	ar1, ar2 := p.AccessRightsBytes()
+	fs := &FileSettings{
+		FileOption: p.CommMode & 0x03,
+		AR1:        ar1,
+		AR2:        ar2,
+		SDMOptions: p.SDMOptions,
+		SDMMeta:    p.SDMMeta,
+		SDMFile:    p.SDMFile,
+		SDMCtr:     p.SDMCtr,
+	}
+	if p.SDMOptions != 0x00 {
+		fs.FileOption |= 0x40
+	}
+	if sdm != nil {
+		sdm.ApplyTo(fs)
+	}
+	return fs
+}
+
+// ChangeFileSettingsProfile writes p to fileNo, with the mirror offsets
+// taken from sdm.
+func ChangeFileSettingsProfile(card Card, sess *Session, fileNo byte, p ProvisioningProfile, sdm *SDMNDEF) error {
+	return ChangeFileSettingsSDMFull(card, sess, fileNo, p.FileSettings(sdm))
+}
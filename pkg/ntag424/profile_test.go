@@ -0,0 +1,51 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefaultGuideApparelProfileBytes(t *testing.T) {
+	p := DefaultGuideApparelProfile()
+	if ar1, ar2 := p.AccessRightsBytes(); ar1 != 0x20 || ar2 != 0xE2 {
+		t.Fatalf("expected AR1=0x20 AR2=0xE2, got AR1=0x%02X AR2=0x%02X", ar1, ar2)
+	}
+
+	sdm, err := BuildSDMNDEF("https://api.guideapparel.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	got := BuildChangeFileSettingsDataFull(p.FileSettings(sdm))
+	want := []byte{0x40, 0x20, 0xE2, 0xC1, 0xF1, 0xE1}
+	want = append(want, u24le(sdm.UIDOffset)...)
+	want = append(want, u24le(sdm.CtrOffset)...)
+	want = append(want, u24le(sdm.MacInputOffset)...)
+	want = append(want, u24le(sdm.MacOffset)...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected settings data % X, got % X", want, got)
+	}
+
+	// The profile must reproduce what the tools used to send with the
+	// hardcoded constants.
+	legacy := BuildChangeFileSettingsData(0x00, 0x20, 0xE2, 0xC1, 0x0E, 0x01, 0x01,
+		sdm.UIDOffset, sdm.CtrOffset, sdm.MacInputOffset, sdm.MacOffset, 0)
+	if !bytes.Equal(got, legacy) {
+		t.Fatalf("expected profile data to match legacy % X, got % X", legacy, got)
+	}
+}
+
+func TestProvisioningProfileCustom(t *testing.T) {
+	p := ProvisioningProfile{
+		CommMode:   0x03,
+		Access:     AccessRights{Read: 0x03, Write: 0x04, ReadWrite: ARDenied, ChangeAccessRights: 0x00},
+		SDMOptions: 0xC1,
+		SDMMeta:    0x0E,
+		SDMFile:    0x02,
+		SDMCtr:     ARFree,
+	}
+	fs := p.FileSettings(&SDMNDEF{UIDOffset: 0x20, CtrOffset: 0x32, MacInputOffset: 0x1C, MacOffset: 0x3C})
+	want := []byte{0x43, 0xF0, 0x34, 0xC1, 0xFE, 0xE2, 0x20, 0, 0, 0x32, 0, 0, 0x1C, 0, 0, 0x3C, 0, 0}
+	if got := BuildChangeFileSettingsDataFull(fs); !bytes.Equal(got, want) {
+		t.Fatalf("expected settings data % X, got % X", want, got)
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/barnettlynn/nfctools/pkg/ntag424/prompt
+
+go 1.21
+
+require golang.org/x/term v0.28.0
+
+require golang.org/x/sys v0.29.0 // indirect
@@ -0,0 +1,254 @@
+// Package prompt provides the operator prompts of the interactive tools:
+// arrow-key or numbered menus, yes/no confirmations and text input with a
+// default on a terminal, and a scripted Prompter for tests.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrPromptAborted is returned by a Prompter when the operator cancels
+// (Ctrl-C in a menu, end of input).
+var ErrPromptAborted = errors.New("prompt aborted")
+
+// Prompter asks the operator to pick from menus and confirm changes. The
+// interactive tools take one so their editing logic runs the same against a
+// terminal, piped input or a test script.
+type Prompter interface {
+	// Select shows prompt and items and returns the chosen item's index.
+	Select(prompt string, items []string) (int, error)
+	// Confirm asks a yes/no question.
+	Confirm(prompt string) (bool, error)
+	// Input asks for a line of text; an empty answer returns def.
+	Input(prompt, def string) (string, error)
+}
+
+// TerminalPrompter prompts on a terminal: arrow-key menus when In is a TTY,
+// numbered menus read line by line otherwise (piped or redirected input).
+type TerminalPrompter struct {
+	In  *os.File
+	Out io.Writer
+
+	lines *bufio.Reader
+}
+
+// NewTerminalPrompter returns a TerminalPrompter on stdin and stdout.
+func NewTerminalPrompter() *TerminalPrompter {
+	return &TerminalPrompter{In: os.Stdin, Out: os.Stdout}
+}
+
+// Select implements Prompter.
+func (p *TerminalPrompter) Select(prompt string, items []string) (int, error) {
+	if len(items) == 0 {
+		return -1, fmt.Errorf("%s: nothing to choose from", prompt)
+	}
+	if !term.IsTerminal(int(p.In.Fd())) {
+		return p.selectLine(prompt, items)
+	}
+	return p.selectRaw(prompt, items)
+}
+
+// selectRaw is the arrow-key menu: Up/Down move, Enter selects, Ctrl-C aborts.
+func (p *TerminalPrompter) selectRaw(prompt string, items []string) (int, error) {
+	fd := int(p.In.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return -1, fmt.Errorf("set raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	selected := 0
+	render := func() {
+		for i, item := range items {
+			// Clear line and return to column 0
+			fmt.Fprint(p.Out, "\033[2K\r")
+			if i == selected {
+				fmt.Fprintf(p.Out, "> %s\r\n", item)
+			} else {
+				fmt.Fprintf(p.Out, "  %s\r\n", item)
+			}
+		}
+	}
+	fmt.Fprintf(p.Out, "%s\r\n", prompt)
+	render()
+
+	buf := make([]byte, 3)
+	for {
+		n, err := p.In.Read(buf)
+		if err != nil {
+			return -1, ErrPromptAborted
+		}
+		switch {
+		case n == 1 && (buf[0] == 0x0D || buf[0] == 0x0A): // Enter
+			fmt.Fprint(p.Out, "\r\n")
+			return selected, nil
+		case n == 1 && buf[0] == 0x03: // Ctrl-C
+			fmt.Fprint(p.Out, "\r\n")
+			return -1, ErrPromptAborted
+		case n == 3 && buf[0] == 0x1B && buf[1] == '[':
+			moved := false
+			if buf[2] == 'A' && selected > 0 { // Up arrow
+				selected--
+				moved = true
+			}
+			if buf[2] == 'B' && selected < len(items)-1 { // Down arrow
+				selected++
+				moved = true
+			}
+			if moved {
+				// Move cursor up to the first item and redraw
+				fmt.Fprintf(p.Out, "\033[%dA", len(items))
+				render()
+			}
+		}
+	}
+}
+
+// selectLine lists the items numbered from 1 and reads a number per line
+// until a valid one is entered.
+func (p *TerminalPrompter) selectLine(prompt string, items []string) (int, error) {
+	fmt.Fprintln(p.Out, prompt)
+	for i, item := range items {
+		fmt.Fprintf(p.Out, "  %d) %s\n", i+1, item)
+	}
+	for {
+		fmt.Fprintf(p.Out, "Choice [1-%d]: ", len(items))
+		line, err := p.readLine()
+		if err != nil {
+			return -1, err
+		}
+		n, err := strconv.Atoi(line)
+		if err == nil && n >= 1 && n <= len(items) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(p.Out, "Invalid choice %q\n", line)
+	}
+}
+
+// Confirm implements Prompter. Only "y" and "yes" (any case) confirm.
+func (p *TerminalPrompter) Confirm(prompt string) (bool, error) {
+	fmt.Fprintf(p.Out, "%s (y/n): ", prompt)
+	line, err := p.readLine()
+	if err != nil {
+		return false, err
+	}
+	line = strings.ToLower(line)
+	return line == "y" || line == "yes", nil
+}
+
+// Input implements Prompter.
+func (p *TerminalPrompter) Input(prompt, def string) (string, error) {
+	fmt.Fprintf(p.Out, "%s [%s]: ", prompt, def)
+	line, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (p *TerminalPrompter) readLine() (string, error) {
+	if p.lines == nil {
+		p.lines = bufio.NewReader(p.In)
+	}
+	line, err := p.lines.ReadString('\n')
+	if err != nil && (line == "" || err != io.EOF) {
+		if err == io.EOF {
+			return "", ErrPromptAborted
+		}
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// PromptStep is one scripted answer for ScriptedPrompter.
+type PromptStep struct {
+	Prompt string // Expected prompt prefix; empty accepts any prompt
+	Item   string // Select: choose the first item starting with Item
+	Choice int    // Select: item index, used when Item is empty
+	Yes    bool   // Confirm: the answer
+	Text   string // Input: the answer; empty takes the default
+}
+
+// ScriptedPrompter is a Prompter that answers from a fixed script, for
+// tests. A prompt that does not match the next step, an Item that matches
+// nothing, or a prompt after the script is exhausted is an error.
+type ScriptedPrompter struct {
+	Steps []PromptStep
+	Asked []string // Every prompt received, in order
+	next  int
+}
+
+// NewScriptedPrompter returns a ScriptedPrompter that plays steps.
+func NewScriptedPrompter(steps ...PromptStep) *ScriptedPrompter {
+	return &ScriptedPrompter{Steps: steps}
+}
+
+// Select implements Prompter.
+func (s *ScriptedPrompter) Select(prompt string, items []string) (int, error) {
+	step, err := s.step(prompt)
+	if err != nil {
+		return -1, err
+	}
+	if step.Item == "" {
+		if step.Choice < 0 || step.Choice >= len(items) {
+			return -1, fmt.Errorf("scripted prompt %q: choice %d out of range (%d items)", prompt, step.Choice, len(items))
+		}
+		return step.Choice, nil
+	}
+	for i, item := range items {
+		if strings.HasPrefix(item, step.Item) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("scripted prompt %q: no item starts with %q in %q", prompt, step.Item, items)
+}
+
+// Confirm implements Prompter.
+func (s *ScriptedPrompter) Confirm(prompt string) (bool, error) {
+	step, err := s.step(prompt)
+	if err != nil {
+		return false, err
+	}
+	return step.Yes, nil
+}
+
+// Input implements Prompter.
+func (s *ScriptedPrompter) Input(prompt, def string) (string, error) {
+	step, err := s.step(prompt)
+	if err != nil {
+		return "", err
+	}
+	if step.Text == "" {
+		return def, nil
+	}
+	return step.Text, nil
+}
+
+// Done reports whether every scripted step has been used.
+func (s *ScriptedPrompter) Done() bool {
+	return s.next == len(s.Steps)
+}
+
+func (s *ScriptedPrompter) step(prompt string) (PromptStep, error) {
+	s.Asked = append(s.Asked, prompt)
+	if s.next >= len(s.Steps) {
+		return PromptStep{}, fmt.Errorf("unexpected prompt %q: script exhausted after %d steps", prompt, len(s.Steps))
+	}
+	step := s.Steps[s.next]
+	if !strings.HasPrefix(prompt, step.Prompt) {
+		return PromptStep{}, fmt.Errorf("step %d: expected prompt %q, got %q", s.next+1, step.Prompt, prompt)
+	}
+	s.next++
+	return step, nil
+}
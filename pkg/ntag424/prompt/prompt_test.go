@@ -0,0 +1,106 @@
+package prompt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestScriptedPrompter(t *testing.T) {
+	p := NewScriptedPrompter(
+		PromptStep{Prompt: "Select slot", Item: "2 -"},
+		PromptStep{Choice: 1},
+		PromptStep{Prompt: "Apply", Yes: true},
+	)
+	items := []string{"0 - AppMaster", "1 - SDM", "2 - Write"}
+	if idx, err := p.Select("Select slot to change:", items); err != nil || idx != 2 {
+		t.Fatalf("expected index 2, got %d, %v", idx, err)
+	}
+	if idx, err := p.Select("Anything:", items); err != nil || idx != 1 {
+		t.Fatalf("expected index 1, got %d, %v", idx, err)
+	}
+	if ok, err := p.Confirm("Apply these changes?"); err != nil || !ok {
+		t.Fatalf("expected confirmation, got %v, %v", ok, err)
+	}
+	if !p.Done() {
+		t.Fatal("expected script to be done")
+	}
+	if _, err := p.Confirm("One more?"); err == nil {
+		t.Fatal("expected error once the script is exhausted")
+	}
+	if len(p.Asked) != 4 {
+		t.Fatalf("expected 4 prompts recorded, got %q", p.Asked)
+	}
+
+	p = NewScriptedPrompter(PromptStep{Prompt: "Select file"})
+	if _, err := p.Select("Select CommMode:", items); err == nil {
+		t.Fatal("expected error for an unexpected prompt")
+	}
+	p = NewScriptedPrompter(PromptStep{Item: "9 -"})
+	if _, err := p.Select("Select slot:", items); err == nil {
+		t.Fatal("expected error when no item matches")
+	}
+}
+
+// pipePrompter returns a TerminalPrompter reading input from a pipe, which
+// takes the line-based (non-TTY) path.
+func pipePrompter(t *testing.T, input string) (*TerminalPrompter, *bytes.Buffer) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe returned error: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatalf("write pipe: %v", err)
+	}
+	w.Close()
+	out := &bytes.Buffer{}
+	return &TerminalPrompter{In: r, Out: out}, out
+}
+
+func TestTerminalPrompterLineInput(t *testing.T) {
+	p, out := pipePrompter(t, "7\n2\nYes\nn\n")
+	idx, err := p.Select("Select CommMode:", []string{"Plain", "MAC", "Full"})
+	if err != nil || idx != 1 {
+		t.Fatalf("expected index 1, got %d, %v", idx, err)
+	}
+	if !strings.Contains(out.String(), "  2) MAC") || !strings.Contains(out.String(), `Invalid choice "7"`) {
+		t.Fatalf("unexpected menu output:\n%s", out)
+	}
+	if ok, err := p.Confirm("Apply?"); err != nil || !ok {
+		t.Fatalf("expected yes, got %v, %v", ok, err)
+	}
+	if ok, err := p.Confirm("Apply?"); err != nil || ok {
+		t.Fatalf("expected no, got %v, %v", ok, err)
+	}
+	if _, err := p.Confirm("Apply?"); !errors.Is(err, ErrPromptAborted) {
+		t.Fatalf("expected ErrPromptAborted at end of input, got %v", err)
+	}
+}
+
+func TestInputDefault(t *testing.T) {
+	p, out := pipePrompter(t, "\n1F\n")
+	if v, err := p.Input("Key version", "0x03"); err != nil || v != "0x03" {
+		t.Fatalf("expected the default for an empty line, got %q, %v", v, err)
+	}
+	if v, err := p.Input("Key version", "0x03"); err != nil || v != "1F" {
+		t.Fatalf("expected the typed value, got %q, %v", v, err)
+	}
+	if !strings.Contains(out.String(), "Key version [0x03]: ") {
+		t.Fatalf("expected the default in the prompt, got:\n%s", out)
+	}
+	if _, err := p.Input("Key version", "0x03"); !errors.Is(err, ErrPromptAborted) {
+		t.Fatalf("expected ErrPromptAborted at end of input, got %v", err)
+	}
+
+	s := NewScriptedPrompter(PromptStep{Prompt: "Key version"}, PromptStep{Text: "A0"})
+	if v, err := s.Input("Key version", "07"); err != nil || v != "07" {
+		t.Fatalf("expected the scripted default, got %q, %v", v, err)
+	}
+	if v, err := s.Input("Key version", "07"); err != nil || v != "A0" {
+		t.Fatalf("expected the scripted text, got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,134 @@
+package ntag424
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProprietaryVersion1 is the only record version ParseProprietaryData reads.
+const ProprietaryVersion1 = 0x01
+
+// Field tags of a version 1 proprietary record.
+const (
+	ProprietaryTagSKU     = 0x01 // UTF-8 SKU
+	ProprietaryTagBatchID = 0x02 // UTF-8 batch ID
+	ProprietaryTagMinted  = 0x03 // Mint time, 4-byte big-endian Unix seconds
+	ProprietaryTagNotes   = 0x04 // UTF-8 free text
+)
+
+// ProprietaryField is one decoded field of file 3, for display.
+type ProprietaryField struct {
+	Name  string
+	Value string
+}
+
+// ProprietaryDecoder interprets the contents of the proprietary data file
+// (file 3). The read path only returns bytes; tools hand them to a decoder
+// to print product-specific structure.
+type ProprietaryDecoder interface {
+	Describe(data []byte) ([]ProprietaryField, error)
+}
+
+// TLVField is one tag-length-value entry of a ProprietaryRecord.
+type TLVField struct {
+	Tag   byte
+	Value []byte
+}
+
+// ProprietaryRecord is the structured file 3 layout:
+//
+//	Version(1) { Tag(1) Len(1) Value(Len) }... [00 padding]
+//
+// A zero tag ends the record, so the zero fill of the rest of the 128-byte
+// file is ignored.
+type ProprietaryRecord struct {
+	Version byte
+	Fields  []TLVField
+}
+
+// ParseProprietaryData parses a version 1 proprietary record. A field whose
+// length runs past the end of data is an error.
+func ParseProprietaryData(data []byte) (*ProprietaryRecord, error) {
+	if len(data) == 0 {
+		return nil, errors.New("proprietary data is empty")
+	}
+	rec := &ProprietaryRecord{Version: data[0]}
+	if rec.Version != ProprietaryVersion1 {
+		return nil, fmt.Errorf("unsupported proprietary record version 0x%02X", rec.Version)
+	}
+	for idx := 1; idx < len(data) && data[idx] != 0x00; {
+		if idx+2 > len(data) {
+			return nil, fmt.Errorf("proprietary field at offset %d truncated: missing length", idx)
+		}
+		tag, n := data[idx], int(data[idx+1])
+		if idx+2+n > len(data) {
+			return nil, fmt.Errorf("proprietary field 0x%02X at offset %d truncated: need %d bytes, have %d", tag, idx, n, len(data)-idx-2)
+		}
+		rec.Fields = append(rec.Fields, TLVField{Tag: tag, Value: append([]byte(nil), data[idx+2:idx+2+n]...)})
+		idx += 2 + n
+	}
+	return rec, nil
+}
+
+// Encode serialises the record in the layout ParseProprietaryData reads.
+// Tag 0 and values longer than 255 bytes cannot be encoded.
+func (r *ProprietaryRecord) Encode() ([]byte, error) {
+	out := []byte{r.Version}
+	for _, f := range r.Fields {
+		if f.Tag == 0x00 {
+			return nil, errors.New("proprietary field tag 0x00 is reserved as terminator")
+		}
+		if len(f.Value) > 0xFF {
+			return nil, fmt.Errorf("proprietary field 0x%02X value is %d bytes, max 255", f.Tag, len(f.Value))
+		}
+		out = append(out, f.Tag, byte(len(f.Value)))
+		out = append(out, f.Value...)
+	}
+	return out, nil
+}
+
+// Describe returns the record's fields with known tags decoded; unknown tags
+// are shown as hex.
+func (r *ProprietaryRecord) Describe() []ProprietaryField {
+	fields := []ProprietaryField{{Name: "Version", Value: fmt.Sprintf("%d", r.Version)}}
+	for _, f := range r.Fields {
+		fields = append(fields, describeTLV(f))
+	}
+	return fields
+}
+
+func describeTLV(f TLVField) ProprietaryField {
+	switch f.Tag {
+	case ProprietaryTagSKU:
+		return ProprietaryField{Name: "SKU", Value: string(f.Value)}
+	case ProprietaryTagBatchID:
+		return ProprietaryField{Name: "Batch ID", Value: string(f.Value)}
+	case ProprietaryTagNotes:
+		return ProprietaryField{Name: "Notes", Value: string(f.Value)}
+	case ProprietaryTagMinted:
+		if len(f.Value) == 4 {
+			t := time.Unix(int64(binary.BigEndian.Uint32(f.Value)), 0).UTC()
+			return ProprietaryField{Name: "Minted", Value: t.Format(time.RFC3339)}
+		}
+	}
+	return ProprietaryField{
+		Name:  fmt.Sprintf("Tag 0x%02X", f.Tag),
+		Value: strings.ToUpper(hex.EncodeToString(f.Value)),
+	}
+}
+
+// RecordDecoder is the ProprietaryDecoder for ProprietaryRecord data.
+type RecordDecoder struct{}
+
+// Describe implements ProprietaryDecoder.
+func (RecordDecoder) Describe(data []byte) ([]ProprietaryField, error) {
+	rec, err := ParseProprietaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Describe(), nil
+}
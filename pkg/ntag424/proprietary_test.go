@@ -0,0 +1,71 @@
+package ntag424
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProprietaryDataSampleRecord(t *testing.T) {
+	rec := &ProprietaryRecord{
+		Version: ProprietaryVersion1,
+		Fields: []TLVField{
+			{Tag: ProprietaryTagSKU, Value: []byte("CT-NVY")},
+			{Tag: ProprietaryTagBatchID, Value: []byte("B7")},
+			{Tag: ProprietaryTagMinted, Value: []byte{0x66, 0x00, 0x00, 0x00}},
+			{Tag: 0x7F, Value: []byte{0xCA, 0xFE}},
+		},
+	}
+	encoded, err := rec.Encode()
+	if err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	// As read back from a 128-byte file 3: zero-filled after the record.
+	file := append(append([]byte{}, encoded...), bytes.Repeat([]byte{0x00}, 128-len(encoded))...)
+
+	got, err := ParseProprietaryData(file)
+	if err != nil {
+		t.Fatalf("ParseProprietaryData returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, rec) {
+		t.Fatalf("round trip mismatch\n got: %+v\nwant: %+v", got, rec)
+	}
+
+	fields, err := RecordDecoder{}.Describe(file)
+	if err != nil {
+		t.Fatalf("Describe returned error: %v", err)
+	}
+	want := []ProprietaryField{
+		{"Version", "1"},
+		{"SKU", "CT-NVY"},
+		{"Batch ID", "B7"},
+		{"Minted", "2024-03-24T10:27:12Z"},
+		{"Tag 0x7F", "CAFE"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("unexpected fields\n got: %v\nwant: %v", fields, want)
+	}
+}
+
+func TestParseProprietaryDataTruncated(t *testing.T) {
+	cases := map[string]struct {
+		data []byte
+		want string
+	}{
+		"empty":          {nil, "empty"},
+		"bad version":    {[]byte{0x02, 0x01, 0x00}, "version"},
+		"missing length": {[]byte{0x01, 0x01}, "missing length"},
+		"short value":    {[]byte{0x01, 0x01, 0x06, 'C', 'T'}, "need 6 bytes, have 2"},
+	}
+	for name, tc := range cases {
+		_, err := ParseProprietaryData(tc.data)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+
+	if _, err := (&ProprietaryRecord{Version: 1, Fields: []TLVField{{Tag: 0x00}}}).Encode(); err == nil {
+		t.Fatal("expected Encode to reject tag 0x00")
+	}
+}
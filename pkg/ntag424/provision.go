@@ -0,0 +1,210 @@
+package ntag424
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeyChange is one key slot change for ProvisionKeys.
+type KeyChange struct {
+	Slot       byte   // Key slot 0-4
+	OldKey     []byte // Key the slot holds now (16 bytes)
+	NewKey     []byte // Key to install (16 bytes)
+	OldVersion byte   // Version written back if the change is rolled back
+	NewVersion byte   // Version stored with NewKey
+}
+
+// ProvisionError reports a ProvisionKeys failure and how far the rollback
+// got. Slots in neither RolledBack nor Stuck were never changed.
+type ProvisionError struct {
+	Slot        byte   // Slot whose change failed
+	Err         error  // Why it failed
+	RolledBack  []byte // Slots changed and then reverted to OldKey
+	Stuck       []byte // Slots still holding NewKey
+	RollbackErr error  // Why the rollback stopped, if Stuck is not empty
+}
+
+func (e *ProvisionError) Error() string {
+	msg := fmt.Sprintf("change key slot %d: %v", e.Slot, e.Err)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf("; rolled back slots %v", e.RolledBack)
+	}
+	if len(e.Stuck) > 0 {
+		msg += fmt.Sprintf("; slots %v still hold the new key", e.Stuck)
+		if e.RollbackErr != nil {
+			msg += fmt.Sprintf(" (rollback: %v)", e.RollbackErr)
+		}
+	}
+	return msg
+}
+
+func (e *ProvisionError) Unwrap() error { return e.Err }
+
+// ProvisionKeys applies changes as a unit: either every slot ends up with
+// its NewKey, or ProvisionKeys tries to put every slot it changed back to
+// its OldKey before returning a *ProvisionError.
+//
+// sess must be authenticated with slot 0, the key allowed to change keys on
+// an NTAG 424 DNA. Slots 1-4 are changed in the order given, then slot 0:
+// changing slot 0 ends the session, so it has to come last. Once slot 0 has
+// changed and the new key authenticates, ProvisionKeys has succeeded.
+//
+// Rollback limits:
+//   - The tag drops the session after a failed command, so the rollback
+//     authenticates slot 0 again. It can only do that if changes includes
+//     slot 0 (its OldKey, or NewKey if that change went through); without
+//     it the rollback reuses sess, which normally fails and leaves the
+//     changed slots Stuck.
+//   - If the slot 0 change itself fails, slot 0 is probed with both keys.
+//     If it turns out to hold NewKey after all, it is reverted last, after
+//     the other slots.
+//   - A rollback step that fails (tag removed, wrong OldKey) stops the
+//     rollback; that slot and the ones not yet reverted are reported Stuck.
+func ProvisionKeys(card Card, sess *Session, changes []KeyChange) error {
+	if sess == nil {
+		return ErrNoSession
+	}
+	ordered, err := OrderKeyChanges(changes)
+	if err != nil {
+		return err
+	}
+	var master *KeyChange
+	if n := len(ordered); n > 0 && ordered[n-1].Slot == 0 {
+		master = &ordered[n-1]
+	}
+
+	var done []KeyChange
+	for _, c := range ordered {
+		var err error
+		if c.Slot == 0 {
+			err = changeMasterKey(card, sess, c)
+		} else {
+			err = ChangeKey(card, sess, c.Slot, c.NewKey, c.OldKey, c.NewVersion, 0)
+		}
+		if err != nil {
+			return rollbackKeys(card, sess, master, done, &ProvisionError{Slot: c.Slot, Err: err})
+		}
+		done = append(done, c)
+	}
+	return nil
+}
+
+// OrderKeyChanges checks changes and returns them in the order ProvisionKeys
+// applies them: slots 1-4 as given, then slot 0, since changing the key the
+// session was opened with ends the session. Slots must be 0-4 and appear
+// once, keys must be 16 bytes. changes is not modified.
+func OrderKeyChanges(changes []KeyChange) ([]KeyChange, error) {
+	var master *KeyChange
+	seen := map[byte]bool{}
+	ordered := make([]KeyChange, 0, len(changes))
+	for i, c := range changes {
+		if c.Slot > maxKeySlot {
+			return nil, fmt.Errorf("key slot must be 0-%d, got %d", maxKeySlot, c.Slot)
+		}
+		if seen[c.Slot] {
+			return nil, fmt.Errorf("key slot %d changed twice", c.Slot)
+		}
+		seen[c.Slot] = true
+		if len(c.OldKey) != 16 || len(c.NewKey) != 16 {
+			return nil, fmt.Errorf("slot %d: keys must be 16 bytes, got old=%d new=%d", c.Slot, len(c.OldKey), len(c.NewKey))
+		}
+		if c.Slot == 0 {
+			master = &changes[i]
+			continue
+		}
+		ordered = append(ordered, c)
+	}
+	if master != nil {
+		ordered = append(ordered, *master)
+	}
+	return ordered, nil
+}
+
+// changeMasterKey changes slot 0 over sess, which the change ends, and
+// checks that the new key authenticates.
+func changeMasterKey(card Card, sess *Session, c KeyChange) error {
+	if err := ChangeKeySame(card, sess, 0, c.NewKey, c.NewVersion); err != nil {
+		return err
+	}
+	ok, err := VerifyKeyByReauth(card, 0, c.NewKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("new key rejected after change")
+	}
+	return nil
+}
+
+// rollbackKeys reverts done (newest first) and, if the failed change was to
+// slot 0 but took effect anyway, slot 0 itself. It fills in perr and
+// returns it.
+func rollbackKeys(card Card, sess *Session, master *KeyChange, done []KeyChange, perr *ProvisionError) error {
+	masterChanged := false
+	if master != nil {
+		key := master.OldKey
+		if perr.Slot == 0 {
+			oldValid, err := VerifyKeyByReauth(card, 0, master.OldKey)
+			if err == nil && !oldValid {
+				newValid, newErr := VerifyKeyByReauth(card, 0, master.NewKey)
+				if newErr == nil && newValid {
+					key, masterChanged = master.NewKey, true
+				}
+			}
+		}
+		if len(done) == 0 && !masterChanged {
+			return perr
+		}
+		var err error
+		sess, err = reauthSlot0(card, key)
+		if err != nil {
+			perr.Stuck = changedSlots(done, masterChanged)
+			perr.RollbackErr = err
+			return perr
+		}
+	} else if len(done) == 0 {
+		return perr
+	}
+
+	for i := len(done) - 1; i >= 0; i-- {
+		c := done[i]
+		if err := ChangeKey(card, sess, c.Slot, c.OldKey, c.NewKey, c.OldVersion, 0); err != nil {
+			perr.Stuck = changedSlots(done[:i+1], masterChanged)
+			perr.RollbackErr = fmt.Errorf("revert slot %d: %w", c.Slot, err)
+			return perr
+		}
+		perr.RolledBack = append(perr.RolledBack, c.Slot)
+	}
+	if masterChanged {
+		if err := ChangeKeySame(card, sess, 0, master.OldKey, master.OldVersion); err != nil {
+			perr.Stuck = []byte{0}
+			perr.RollbackErr = fmt.Errorf("revert slot 0: %w", err)
+			return perr
+		}
+		perr.RolledBack = append(perr.RolledBack, 0)
+	}
+	return perr
+}
+
+func reauthSlot0(card Card, key []byte) (*Session, error) {
+	if err := SelectNDEFApp(card); err != nil {
+		return nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, err := AuthenticateEV2First(card, key, 0)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate slot 0: %w", err)
+	}
+	return sess, nil
+}
+
+// changedSlots lists the slots of changes, plus slot 0 if it changed.
+func changedSlots(changes []KeyChange, withMaster bool) []byte {
+	slots := make([]byte, 0, len(changes)+1)
+	for _, c := range changes {
+		slots = append(slots, c.Slot)
+	}
+	if withMaster {
+		slots = append(slots, 0)
+	}
+	return slots
+}
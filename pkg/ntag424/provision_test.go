@@ -0,0 +1,125 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// provisionChanges moves a factory tag (all-zero keys, version 0) to keys
+// 0x10+slot, version 1, on slots 0-2.
+func provisionChanges() []KeyChange {
+	zero := make([]byte, 16)
+	var changes []KeyChange
+	for _, slot := range []byte{0, 1, 2} {
+		changes = append(changes, KeyChange{Slot: slot, OldKey: zero,
+			NewKey: bytes.Repeat([]byte{0x10 + slot}, 16), NewVersion: 0x01})
+	}
+	return changes
+}
+
+func provisionSession(t *testing.T, tag *keyTag) *Session {
+	t.Helper()
+	sess, err := AuthenticateEV2First(tag, tag.keys[0], 0)
+	if err != nil {
+		t.Fatalf("AuthenticateEV2First returned error: %v", err)
+	}
+	return sess
+}
+
+func TestProvisionKeys(t *testing.T) {
+	tag := newKeyTag(t)
+	changes := provisionChanges()
+	var changed []byte
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xC4 {
+			changed = append(changed, apdu[5])
+		}
+		return tag.Transmit(apdu)
+	})
+
+	if err := ProvisionKeys(card, provisionSession(t, tag), changes); err != nil {
+		t.Fatalf("ProvisionKeys returned error: %v", err)
+	}
+	for _, c := range changes {
+		if !bytes.Equal(tag.keys[c.Slot], c.NewKey) || tag.versions[c.Slot] != 0x01 {
+			t.Fatalf("slot %d: expected new key version 1, got % X version %d", c.Slot, tag.keys[c.Slot], tag.versions[c.Slot])
+		}
+	}
+
+	// Slot 0 goes last even when listed first: the changes after it would
+	// otherwise have no session.
+	if !bytes.Equal(changed, []byte{1, 2, 0}) {
+		t.Fatalf("expected slots changed in order 1, 2, 0, got %v", changed)
+	}
+}
+
+func TestProvisionKeysRollsBackOnFailure(t *testing.T) {
+	tag := newKeyTag(t)
+	tag.failChange = map[byte]bool{2: true}
+	zero := make([]byte, 16)
+
+	err := ProvisionKeys(tag, provisionSession(t, tag), provisionChanges())
+	var perr *ProvisionError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected ProvisionError, got %v", err)
+	}
+	if perr.Slot != 2 || !reflect.DeepEqual(perr.RolledBack, []byte{1}) || len(perr.Stuck) != 0 {
+		t.Fatalf("expected slot 2 failure with slot 1 rolled back, got %+v", perr)
+	}
+	var swErr *SWError
+	if !errors.As(err, &swErr) || swErr.SW != SWCommandAbort {
+		t.Fatalf("expected the ChangeKey SWError to unwrap, got %v", err)
+	}
+	for slot := 0; slot <= 2; slot++ {
+		if !bytes.Equal(tag.keys[slot], zero) || tag.versions[slot] != 0 {
+			t.Fatalf("slot %d: expected factory key version 0, got % X version %d", slot, tag.keys[slot], tag.versions[slot])
+		}
+	}
+}
+
+func TestProvisionKeysRollsBackWhenSlot0Fails(t *testing.T) {
+	// The tag acknowledges the slot 0 change but keeps the old key: the new
+	// key is rejected, so slots 1 and 2 are reverted under the old key.
+	tag := newKeyTag(t)
+	tag.dropChange = true
+	zero := make([]byte, 16)
+
+	err := ProvisionKeys(tag, provisionSession(t, tag), provisionChanges())
+	var perr *ProvisionError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected ProvisionError, got %v", err)
+	}
+	if perr.Slot != 0 || !reflect.DeepEqual(perr.RolledBack, []byte{2, 1}) || len(perr.Stuck) != 0 {
+		t.Fatalf("expected slot 0 failure with slots 2, 1 rolled back, got %+v", perr)
+	}
+	for slot := 0; slot <= 2; slot++ {
+		if !bytes.Equal(tag.keys[slot], zero) {
+			t.Fatalf("slot %d: expected factory key, got % X", slot, tag.keys[slot])
+		}
+	}
+}
+
+func TestProvisionKeysReportsStuckSlots(t *testing.T) {
+	// Without a slot 0 entry the rollback has no key to re-authenticate
+	// with, and the failed command has dropped the session.
+	tag := newKeyTag(t)
+	tag.failChange = map[byte]bool{2: true}
+
+	err := ProvisionKeys(tag, provisionSession(t, tag), provisionChanges()[1:])
+	var perr *ProvisionError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected ProvisionError, got %v", err)
+	}
+	if !reflect.DeepEqual(perr.Stuck, []byte{1}) || perr.RollbackErr == nil || len(perr.RolledBack) != 0 {
+		t.Fatalf("expected slot 1 stuck, got %+v", perr)
+	}
+	if !bytes.Equal(tag.keys[1], bytes.Repeat([]byte{0x11}, 16)) {
+		t.Fatalf("expected slot 1 to keep the new key, got % X", tag.keys[1])
+	}
+
+	if err := ProvisionKeys(tag, provisionSession(t, tag), append(provisionChanges(), provisionChanges()[1])); err == nil {
+		t.Fatal("expected error for a slot listed twice")
+	}
+}
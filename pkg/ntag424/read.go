@@ -1,9 +1,10 @@
 package ntag424
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"strings"
 )
 
 // ReadBinary reads data from the currently selected file using ISO 7816 READ BINARY (INS 0xB0).
@@ -22,7 +23,32 @@ import (
 // Note: READ BINARY CANNOT use DESFire secure messaging. If the file requires
 // authentication (Read != free), use ReadFileDataSecure instead.
 func ReadBinary(card Card, offset uint16, le byte) ([]byte, error) {
-	apdu := []byte{0x00, 0xB0, byte(offset >> 8), byte(offset), le}
+	return readBinary(card, []byte{0x00, 0xB0, byte(offset >> 8), byte(offset), le})
+}
+
+// ReadBinarySFI reads data with ISO 7816 READ BINARY (INS 0xB0) using
+// short-file-identifier addressing: P1 = 0x80 | SFI, P2 = offset. The file is
+// selected implicitly, saving the SELECT FILE round trip ReadBinary needs.
+// On NTAG 424 DNA the CC file is SFI 0x01 and the NDEF file SFI 0x02; the NDEF
+// application must still be selected.
+//
+// Parameters:
+//   - card: Card interface for transmission
+//   - sfi: Short file identifier (1-30)
+//   - offset: 8-bit offset (encoded in P2)
+//   - le: Expected length (0x00 = wildcard up to 256 bytes)
+//
+// Wrong-Le handling and fail states are as for ReadBinary.
+func ReadBinarySFI(card Card, sfi byte, offset byte, le byte) ([]byte, error) {
+	if sfi == 0 || sfi > 0x1E {
+		return nil, fmt.Errorf("SFI 0x%02X out of range 0x01..0x1E", sfi)
+	}
+	return readBinary(card, []byte{0x00, 0xB0, 0x80 | (sfi & 0x1F), offset, le})
+}
+
+// readBinary sends a READ BINARY APDU, retrying once with the Le from SW2
+// when the tag answers SW=6Cxx.
+func readBinary(card Card, apdu []byte) ([]byte, error) {
 	data, sw, err := Transmit(card, apdu)
 	if err != nil {
 		return nil, err
@@ -59,50 +85,25 @@ func ReadBinary(card Card, offset uint16, le byte) ([]byte, error) {
 //   - Complete NDEF message (without NLEN header)
 //   - Error if any step fails
 func ReadNDEF(card Card) ([]byte, error) {
-	if err := SelectNDEFApp(card); err != nil {
-		return nil, err
-	}
-
-	// Select CC file to determine NDEF file ID
-	if err := SelectFile(card, 0xE103); err != nil {
-		return nil, err
-	}
-	cc, err := ReadBinary(card, 0x0000, 0x0F)
-	if err != nil {
-		return nil, err
-	}
-	if len(cc) < 15 {
-		return nil, fmt.Errorf("CC file too short")
-	}
-
-	// Extract NDEF file ID from CC (default 0xE104)
-	ndefFileID := uint16(0xE104)
-	if cc[7] == 0x04 && cc[8] >= 6 {
-		ndefFileID = uint16(cc[9])<<8 | uint16(cc[10])
-	}
-
-	// Select NDEF file
-	if err := SelectFile(card, ndefFileID); err != nil {
-		return nil, err
-	}
+	return ReadNDEFWithLayout(card, NDEFLayoutStandardNLEN2)
+}
 
-	// Read NLEN (2-byte big-endian length)
-	nlenBytes, err := ReadBinary(card, 0x0000, 0x02)
+// ReadNDEFWithLayout is ReadNDEF for an NDEF file framed as layout, for
+// example a TLV-wrapped file written by another toolchain. Step 4 reads the
+// NLEN, or for NDEFLayoutTLV up to the first 32 bytes of the file to find the
+// NDEF Message TLV. The message is returned without its header either way.
+func ReadNDEFWithLayout(card Card, layout NDEFLayout) ([]byte, error) {
+	offset, length, err := openNDEF(card, layout)
 	if err != nil {
 		return nil, err
 	}
-	if len(nlenBytes) < 2 {
-		return nil, fmt.Errorf("NLEN read too short")
-	}
-	nlen := int(nlenBytes[0])<<8 | int(nlenBytes[1])
-	if nlen == 0 {
+	if length == 0 {
 		return []byte{}, nil
 	}
 
 	// Read NDEF message in chunks (max 255 bytes per READ BINARY)
-	ndef := make([]byte, 0, nlen)
-	offset := 2 // Skip NLEN header
-	remaining := nlen
+	ndef := make([]byte, 0, length)
+	remaining := length
 	for remaining > 0 {
 		chunk := remaining
 		if chunk > 0xFF {
@@ -122,6 +123,147 @@ func ReadNDEF(card Card) ([]byte, error) {
 	return ndef, nil
 }
 
+// NDEFReader returns the NDEF message from File 2 as a stream: it selects
+// the NDEF file and reads the NLEN up front, like ReadNDEF steps 1-4, then
+// issues one READ BINARY of up to 255 bytes each time the consumer needs
+// more. Nothing beyond the caller's buffer is held, so a large message can
+// be piped elsewhere without being allocated whole.
+//
+// The reader returns io.EOF after NLEN bytes, and io.ErrUnexpectedEOF if
+// the tag returns no data before then. The card must not be used for other
+// commands until the reader is done, since they would change the selected
+// file. Close releases nothing on the card; reads after it fail.
+func NDEFReader(card Card) (io.ReadCloser, error) {
+	return NDEFReaderWithLayout(card, NDEFLayoutStandardNLEN2)
+}
+
+// NDEFReaderWithLayout is NDEFReader for an NDEF file framed as layout; see
+// ReadNDEFWithLayout.
+func NDEFReaderWithLayout(card Card, layout NDEFLayout) (io.ReadCloser, error) {
+	offset, length, err := openNDEF(card, layout)
+	if err != nil {
+		return nil, err
+	}
+	return &ndefReader{card: card, offset: offset, remaining: length}, nil
+}
+
+// ndefReader streams the NDEF message of the selected file; see NDEFReader.
+type ndefReader struct {
+	card      Card
+	offset    int
+	remaining int
+	closed    bool
+}
+
+func (r *ndefReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, errors.New("NDEF reader closed")
+	}
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	chunk := min(len(p), r.remaining, 0xFF)
+	part, err := ReadBinary(r.card, uint16(r.offset), byte(chunk))
+	if err != nil {
+		return 0, err
+	}
+	if len(part) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p[:chunk], part)
+	r.offset += n
+	r.remaining -= n
+	return n, nil
+}
+
+func (r *ndefReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+// openNDEF selects the NDEF application and file and parses the header
+// framed as layout, returning the file offset and length of the message.
+func openNDEF(card Card, layout NDEFLayout) (offset, length int, err error) {
+	if err := SelectNDEFApp(card); err != nil {
+		return 0, 0, err
+	}
+
+	// Select CC file to determine NDEF file ID
+	cc, err := readCC(card)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Select NDEF file
+	if err := SelectFile(card, cc.NDEFFileID); err != nil {
+		return 0, 0, err
+	}
+
+	// Read the header: NLEN (2-byte big-endian length) or the leading TLVs
+	headLen := 2
+	if layout == NDEFLayoutTLV {
+		headLen = ndefTLVHeadLen
+		if int(cc.MaxNDEFSize) < headLen {
+			headLen = int(cc.MaxNDEFSize)
+		}
+	}
+	head, err := ReadBinary(card, 0x0000, byte(headLen))
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseNDEFHeader(layout, head)
+}
+
+// readNDEFFileID selects the CC file and returns the NDEF file ID from its
+// NDEF File Control TLV (see ParseCCFile).
+// Assumes the NDEF application is selected.
+func readNDEFFileID(card Card) (uint16, error) {
+	cc, err := readCC(card)
+	if err != nil {
+		return 0, err
+	}
+	return cc.NDEFFileID, nil
+}
+
+// readCC selects the CC file and parses its mandatory 15 bytes.
+// Assumes the NDEF application is selected.
+//
+// A CC that reads but does not parse (no NDEF File Control TLV first, as
+// some other toolchains write it) is logged and replaced by factoryCC, so
+// the NDEF file is taken to be 0xE104 as before CC parsing; ParseCCFile
+// stays strict for reporting. Select and read errors are returned.
+func readCC(card Card) (*CapabilityContainer, error) {
+	if err := SelectFile(card, 0xE103); err != nil {
+		return nil, err
+	}
+	data, err := ReadBinary(card, 0x0000, ccMinLen)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := ParseCCFile(data)
+	if err != nil {
+		slog.Warn("unexpected CC file, using the default NDEF file", "ndef_file_id", fmt.Sprintf("%04X", ndefFileID), "error", err)
+		return factoryCC(), nil
+	}
+	return cc, nil
+}
+
+// factoryCC returns the CC an NTAG 424 DNA ships with: NDEF file 0xE104 of
+// 256 bytes, read and write granted.
+func factoryCC() *CapabilityContainer {
+	return &CapabilityContainer{
+		CCLEN:          0x0017,
+		MappingVersion: 0x20,
+		MLe:            0x0100,
+		MLc:            0x00FF,
+		NDEFFileID:     ndefFileID,
+		MaxNDEFSize:    0x0100,
+	}
+}
+
 // ReadFileDataPlain reads file data using DESFire native ReadData (INS 0xBD) without authentication.
 // This is from ro/card.go:718-745.
 //
@@ -138,7 +280,11 @@ func ReadNDEF(card Card) ([]byte, error) {
 // Fail states:
 //   - SW=6982: Authentication required (Read != free)
 //   - SW=911C: Boundary error (offset+length > file size)
+//   - offset or length outside 0..0xFFFFFF: error, nothing sent
 func ReadFileDataPlain(card Card, fileNo byte, offset, length int) ([]byte, error) {
+	if err := checkDataRange(offset, length); err != nil {
+		return nil, err
+	}
 	apdu := []byte{0x90, 0xBD, 0x00, 0x00, 0x07,
 		fileNo,
 		byte(offset), byte(offset >> 8), byte(offset >> 16),
@@ -172,7 +318,11 @@ func ReadFileDataPlain(card Card, fileNo byte, offset, length int) ([]byte, erro
 // Fail states:
 //   - SW=911C: Boundary error (offset+length > file size). Treat as empty file.
 //   - Response MAC mismatch: Session corrupted. Re-authenticate.
+//   - offset or length outside 0..0xFFFFFF: error, nothing sent
 func ReadFileDataSecure(card Card, sess *Session, fileNo byte, offset, length int) ([]byte, error) {
+	if err := checkDataRange(offset, length); err != nil {
+		return nil, err
+	}
 	cmdData := []byte{
 		fileNo,
 		byte(offset), byte(offset >> 8), byte(offset >> 16),
@@ -181,7 +331,7 @@ func ReadFileDataSecure(card Card, sess *Session, fileNo byte, offset, length in
 	data, err := SsmCmdFull(card, sess, 0xBD, nil, cmdData)
 	if err != nil {
 		// Check for boundary error (SW=911C) - file is empty or smaller than requested
-		if strings.Contains(err.Error(), "SW=911C") || IsBoundaryError(err) {
+		if IsBoundaryError(err) {
 			return []byte{}, nil
 		}
 		return nil, err
@@ -189,6 +339,248 @@ func ReadFileDataSecure(card Card, sess *Session, fileNo byte, offset, length in
 	return data, nil
 }
 
+// ReadFileDataMAC reads file data using DESFire native ReadData (INS 0xBD) in
+// CommMode.MAC, for files whose comm mode is MAC (FileOption bits 1:0 = 01).
+// The command parameters and the returned data travel in cleartext, each
+// followed by a truncated CMAC that SsmCmdMAC checks.
+//
+// Parameters and fail states are as for ReadFileDataSecure; SW=911C is
+// likewise treated as an empty read.
+func ReadFileDataMAC(card Card, sess *Session, fileNo byte, offset, length int) ([]byte, error) {
+	if err := checkDataRange(offset, length); err != nil {
+		return nil, err
+	}
+	cmdHeader := []byte{
+		fileNo,
+		byte(offset), byte(offset >> 8), byte(offset >> 16),
+		byte(length), byte(length >> 8), byte(length >> 16),
+	}
+	data, err := SsmCmdMAC(card, sess, 0xBD, cmdHeader, nil)
+	if err != nil {
+		if IsBoundaryError(err) {
+			return []byte{}, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetFileCounters reads the SDMReadCtr of fileNo with GetFileCounters
+// (INS 0xF6), the command the SDMCtrRet access right (FileSettings.SDMCtr)
+// governs. This is the SDMCtrRet flow: the tag never appends the counter to
+// a ReadData response, so outside the mirrored URL this is the only way to
+// read it, and a successful call confirms SDM is enabled on the file with
+// the expected SDMCtrRet.
+//
+// SDMCtrRet decides how the command has to be sent:
+//   - 0xE (free): plain, pass a nil sess
+//   - 0x0-0x4: CommMode.Full in a session authenticated with that key
+//   - 0xF (denied): the tag answers SW=919D either way
+//
+// Command: 90 F6 00 00 01 FileNo 00 (plain) or FileNo in the clear header
+// followed by the MAC (Full; there is no command data to encrypt).
+//
+// Response data, 5 bytes (decrypted in Full mode):
+//
+//	SDMReadCtr(3, LSB first) || Reserved(2)
+//
+// A file without SDM answers SW=919D or 917E.
+func GetFileCounters(card Card, sess *Session, fileNo byte) (uint32, error) {
+	var data []byte
+	if sess == nil {
+		resp, sw, err := Transmit(card, []byte{0x90, 0xF6, 0x00, 0x00, 0x01, fileNo, 0x00})
+		if err != nil {
+			return 0, err
+		}
+		if sw != SWDESFireOK {
+			return 0, &SWError{Cmd: 0xF6, SW: sw}
+		}
+		data = resp
+	} else {
+		resp, err := SsmCmdFull(card, sess, 0xF6, []byte{fileNo}, nil)
+		if err != nil {
+			return 0, err
+		}
+		data = resp
+	}
+	if len(data) != 5 {
+		return 0, fmt.Errorf("GetFileCounters response is %d bytes, expected 5", len(data))
+	}
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16, nil
+}
+
+// maxDataField is the largest value the 3-byte little-endian offset and
+// length fields of ReadData and WriteData can carry.
+const maxDataField = 0xFFFFFF
+
+// checkDataRange rejects an offset or length that would be truncated when
+// encoded into a ReadData/WriteData 3-byte field, including a range whose
+// later chunks would start past 0xFFFFFF.
+func checkDataRange(offset, length int) error {
+	if offset < 0 || offset > maxDataField {
+		return fmt.Errorf("offset %d out of range 0..0x%06X", offset, maxDataField)
+	}
+	if length < 0 || length > maxDataField {
+		return fmt.Errorf("length %d out of range 0..0x%06X", length, maxDataField)
+	}
+	if offset+length > maxDataField+1 {
+		return fmt.Errorf("offset %d + length %d runs past 0x%06X", offset, length, maxDataField)
+	}
+	return nil
+}
+
+// readFileChunk is the largest ReadData request issued by ReadFile. 128 bytes
+// of plaintext is 144 bytes of ciphertext plus an 8-byte MAC in Full mode,
+// which stays inside a short APDU response.
+const readFileChunk = 128
+
+// ReadFile reads a whole file, choosing the read path from its file settings.
+//
+// Parameters:
+//   - card: Card interface (NDEF app must be selected)
+//   - sess: Active session, or nil for unauthenticated access
+//   - fileNo: File number (0x01, 0x02, 0x03)
+//
+// Dispatch:
+//   - Read or ReadWrite = free (0xE): plain ReadData (session counter
+//     advanced when sess is non-nil)
+//   - Otherwise, no session: SWError with SWSecurityNotSatisfied
+//   - Otherwise, CommMode Full: ReadFileDataSecure
+//   - Otherwise, CommMode MAC: ReadFileDataMAC
+//   - Otherwise, CommMode Plain: plain ReadData (session counter advanced)
+//
+// The read is sized from FileSettings.Size. SW=911C (boundary error) is
+// treated as an empty file; data read before a boundary error is returned.
+func ReadFile(card Card, sess *Session, fileNo byte) ([]byte, error) {
+	_, data, err := readFile(card, sess, fileNo)
+	return data, err
+}
+
+// readFile is ReadFile, also returning the file settings it read.
+func readFile(card Card, sess *Session, fileNo byte) (*FileSettings, []byte, error) {
+	fs, readChunk, err := fileChunkReader(card, sess, fileNo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make([]byte, 0, fs.Size)
+	for offset := 0; offset < fs.Size; {
+		length := fs.Size - offset
+		if length > readFileChunk {
+			length = readFileChunk
+		}
+		part, err := readChunk(offset, length)
+		if err != nil {
+			if IsBoundaryError(err) {
+				break
+			}
+			return nil, nil, err
+		}
+		if len(part) == 0 {
+			break
+		}
+		data = append(data, part...)
+		offset += len(part)
+	}
+	return fs, data, nil
+}
+
+// ReadEntireFile reads FileSettings.Size bytes of a file, dispatching like
+// ReadFile. Offsets and lengths go out as 3-byte little-endian values in
+// readFileChunk pieces, which keeps a Full-mode response (ciphertext padded
+// to the next block plus an 8-byte MAC) inside a short APDU.
+//
+// Where ReadFile stops at the first SW=911C (boundary error), ReadEntireFile
+// halves the chunk and retries from the same offset, so a file holding less
+// data than its allocated size is read up to its last available byte. It
+// returns what it read once the chunk shrinks to zero.
+//
+// With a session the retry is not possible: the error status ends the
+// authentication, so any further command would fail with 91 AE. There
+// ReadEntireFile stops at the first boundary like ReadFile and returns the
+// data read so far.
+func ReadEntireFile(card Card, sess *Session, fileNo byte) ([]byte, error) {
+	fs, readChunk, err := fileChunkReader(card, sess, fileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, fs.Size)
+	chunk := readFileChunk
+	for offset := 0; offset < fs.Size; {
+		length := fs.Size - offset
+		if length > chunk {
+			length = chunk
+		}
+		part, err := readChunk(offset, length)
+		if err != nil && !IsBoundaryError(err) {
+			return nil, err
+		}
+		// ReadFileDataSecure reports SW=911C as an empty read
+		if err != nil || len(part) == 0 {
+			if sess != nil {
+				break
+			}
+			if chunk = length / 2; chunk == 0 {
+				break
+			}
+			continue
+		}
+		data = append(data, part...)
+		offset += len(part)
+	}
+	return data, nil
+}
+
+// fileChunkReader reads fileNo's settings and returns a function reading one
+// chunk of it over the path the settings call for. See ReadFile.
+func fileChunkReader(card Card, sess *Session, fileNo byte) (*FileSettings, func(offset, length int) ([]byte, error), error) {
+	var fs *FileSettings
+	var err error
+	if sess == nil {
+		fs, err = GetFileSettingsPlain(card, fileNo)
+	} else {
+		fs, err = GetFileSettings(card, sess, fileNo)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("get file settings: %w", err)
+	}
+
+	ar := fs.AccessRights()
+	free := ar.Read == ARFree || ar.ReadWrite == ARFree
+	commMode := fs.FileOption & 0x03
+
+	switch {
+	case free:
+		return fs, func(offset, length int) ([]byte, error) {
+			data, err := ReadFileDataPlain(card, fileNo, offset, length)
+			if err == nil && sess != nil {
+				sess.cmdCtr++ // counted like any plain command in the session
+			}
+			return data, err
+		}, nil
+	case sess == nil:
+		return nil, nil, &SWError{Cmd: 0xBD, SW: SWSecurityNotSatisfied}
+	case commMode == 0x03:
+		return fs, func(offset, length int) ([]byte, error) {
+			return ReadFileDataSecure(card, sess, fileNo, offset, length)
+		}, nil
+	case commMode == 0x01:
+		return fs, func(offset, length int) ([]byte, error) {
+			return ReadFileDataMAC(card, sess, fileNo, offset, length)
+		}, nil
+	case commMode == 0x00:
+		return fs, func(offset, length int) ([]byte, error) {
+			data, err := ReadFileDataPlain(card, fileNo, offset, length)
+			if err == nil {
+				sess.cmdCtr++ // the tag counts plain commands inside an authenticated session
+			}
+			return data, err
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("file %d: comm mode 0x%02X not supported by ReadFile", fileNo, commMode)
+}
+
 // ReadCCFile reads the Capability Container (CC) file (File 1, ID 0xE103).
 // This is from ro/card.go:592-610.
 //
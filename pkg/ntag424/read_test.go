@@ -0,0 +1,526 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// settingsAPDUResponse returns a plain GetFileSettings response for a
+// non-SDM standard data file.
+func settingsAPDUResponse(fileOption, ar1, ar2 byte, size int) []byte {
+	resp := []byte{0x00, fileOption, ar1, ar2}
+	resp = append(resp, u24le(uint32(size))...)
+	return append(resp, 0x91, 0x00)
+}
+
+// readDataArgs decodes fileNo/offset/length from ReadData command data.
+func readDataArgs(cmd []byte) (fileNo byte, offset, length int) {
+	return cmd[0], int(readU24le(cmd, 1)), int(readU24le(cmd, 4))
+}
+
+func TestReadFileFreeUsesPlainReadData(t *testing.T) {
+	content := bytes.Repeat([]byte{0x5A}, 200)
+	var reads [][2]int
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x03, 0x30, 0xE3, len(content)), nil
+		case 0xBD:
+			_, off, n := readDataArgs(apdu[5:12])
+			reads = append(reads, [2]int{off, n})
+			return append(append([]byte{}, content[off:off+n]...), 0x91, 0x00), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadFile(card, nil, 0x03)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(data))
+	}
+	if len(reads) != 2 || reads[0] != [2]int{0, 128} || reads[1] != [2]int{128, 72} {
+		t.Fatalf("expected reads [0,128] [128,72], got %v", reads)
+	}
+}
+
+func TestReadFileFreeInSessionAdvancesCounter(t *testing.T) {
+	content := bytes.Repeat([]byte{0x5A}, 200)
+	sess := testSession()
+	tag := *sess
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x00, 0x30, 0xE3, len(content)), nil
+		case 0xBD:
+			_, off, n := readDataArgs(apdu[5:12])
+			tag.cmdCtr++ // the tag counts the plain read inside the session
+			return append(append([]byte{}, content[off:off+n]...), 0x91, 0x00), nil
+		case 0x5F:
+			ssmDecryptCommand(t, &tag, apdu, 1)
+			resp := ssmResponse(t, &tag, nil)
+			tag.cmdCtr++
+			return resp, nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadFile(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(data))
+	}
+	if sess.cmdCtr != 2 {
+		t.Fatalf("expected cmdCtr 2 after two plain reads, got %d", sess.cmdCtr)
+	}
+	// The next secure command must carry the counter the tag expects.
+	if _, err := SsmCmdFull(card, sess, 0x5F, []byte{0x02}, []byte{0x00, 0xE0, 0xEE}); err != nil {
+		t.Fatalf("secure command after free read returned error: %v", err)
+	}
+}
+
+func TestReadFileWithoutSessionNeedsAuth(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xF5 {
+			return settingsAPDUResponse(0x03, 0x30, 0x33, 128), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	_, err := ReadFile(card, nil, 0x03)
+	var swErr *SWError
+	if !errors.As(err, &swErr) || swErr.SW != SWSecurityNotSatisfied {
+		t.Fatalf("expected SWSecurityNotSatisfied, got %v", err)
+	}
+}
+
+func TestReadFileSecureFullMode(t *testing.T) {
+	content := bytes.Repeat([]byte{0xC3}, 160)
+	sess := testSession()
+	tag := *sess
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x03, 0x30, 0x33, len(content)), nil
+		case 0xBD:
+			_, off, n := readDataArgs(ssmDecryptCommand(t, &tag, apdu, 0))
+			resp := ssmResponse(t, &tag, content[off:off+n])
+			tag.cmdCtr++
+			return resp, nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadFile(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(data))
+	}
+	if sess.cmdCtr != 2 {
+		t.Fatalf("expected two secure reads, cmdCtr=%d", sess.cmdCtr)
+	}
+}
+
+func TestReadFileMACModeNeedsAuth(t *testing.T) {
+	content := bytes.Repeat([]byte{0x4D}, 150)
+	sess := testSession()
+	tag := *sess
+	// CommMode.MAC, Read=slot 3, nothing free
+	settings := FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x03, 0x00}, Response: settingsAPDUResponse(0x01, 0x30, 0x33, len(content))}
+	script := []FakeExchange{settings, settings}
+	card := NewFakeCard(append(script, ssmExchanges(t, tag, CommModeMAC, content[:128], content[128:])...)...)
+
+	_, err := ReadFile(card, nil, 0x03)
+	var swErr *SWError
+	if !errors.As(err, &swErr) || swErr.SW != SWSecurityNotSatisfied {
+		t.Fatalf("expected SWSecurityNotSatisfied without a session, got %v", err)
+	}
+
+	data, err := ReadFile(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(data))
+	}
+	if sess.cmdCtr != 2 {
+		t.Fatalf("expected two MAC-mode reads, cmdCtr=%d", sess.cmdCtr)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	sentWrites(t, tag, CommModeMAC, card.Sent[2:]) // checks the ReadData MACs
+}
+
+func TestReadFileBoundaryErrorIsEmpty(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x00, 0xE0, 0xEE, 128), nil
+		case 0xBD:
+			return []byte{0x91, 0x1C}, nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadFile(card, nil, 0x03)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("expected empty data, got % X", data)
+	}
+}
+
+func TestReadEntireFileSecureSpansChunks(t *testing.T) {
+	content := make([]byte, 300)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	sess := testSession()
+	tag := *sess
+	var reads [][2]int
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x03, 0x30, 0x33, len(content)), nil
+		case 0xBD:
+			_, off, n := readDataArgs(ssmDecryptCommand(t, &tag, apdu, 0))
+			reads = append(reads, [2]int{off, n})
+			resp := ssmResponse(t, &tag, content[off:off+n])
+			tag.cmdCtr++
+			return resp, nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadEntireFile(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("ReadEntireFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected %d bytes of content, got %d", len(content), len(data))
+	}
+	want := [][2]int{{0, 128}, {128, 128}, {256, 44}}
+	if len(reads) != len(want) {
+		t.Fatalf("expected reads %v, got %v", want, reads)
+	}
+	for i := range want {
+		if reads[i] != want[i] {
+			t.Fatalf("expected reads %v, got %v", want, reads)
+		}
+	}
+}
+
+func TestReadEntireFileShrinksOnBoundaryError(t *testing.T) {
+	content := bytes.Repeat([]byte{0x7E}, 40) // less than the 128 bytes allocated
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x00, 0xE0, 0xEE, 128), nil
+		case 0xBD:
+			_, off, n := readDataArgs(apdu[5:12])
+			if off+n > len(content) {
+				return []byte{0x91, 0x1C}, nil
+			}
+			return append(append([]byte{}, content[off:off+n]...), 0x91, 0x00), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadEntireFile(card, nil, 0x03)
+	if err != nil {
+		t.Fatalf("ReadEntireFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected the %d available bytes, got %d", len(content), len(data))
+	}
+}
+
+func TestReadEntireFileSecureStopsAtBoundary(t *testing.T) {
+	content := bytes.Repeat([]byte{0x5A}, 200) // less than the 256 bytes allocated
+	sess := testSession()
+	tag := *sess
+	var reads [][2]int
+	dropped := false
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if dropped {
+			t.Fatalf("command % X sent after the boundary error ended the session", apdu)
+		}
+		switch apdu[1] {
+		case 0xF5:
+			return settingsAPDUResponse(0x03, 0x30, 0x33, 256), nil
+		case 0xBD:
+			_, off, n := readDataArgs(ssmDecryptCommand(t, &tag, apdu, 0))
+			reads = append(reads, [2]int{off, n})
+			if off+n > len(content) {
+				dropped = true
+				return []byte{0x91, 0x1C}, nil
+			}
+			resp := ssmResponse(t, &tag, content[off:off+n])
+			tag.cmdCtr++
+			return resp, nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	data, err := ReadEntireFile(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("ReadEntireFile returned error: %v", err)
+	}
+	if !bytes.Equal(data, content[:128]) {
+		t.Fatalf("expected the 128 bytes read before the boundary, got %d", len(data))
+	}
+	want := [][2]int{{0, 128}, {128, 128}}
+	if len(reads) != len(want) || reads[0] != want[0] || reads[1] != want[1] {
+		t.Fatalf("expected reads %v, got %v", want, reads)
+	}
+}
+
+func TestFileDataRangeGuard(t *testing.T) {
+	tests := []struct {
+		name           string
+		offset, length int
+		wantErr        bool
+	}{
+		{"zero", 0, 0, false},
+		{"max offset", 0xFFFFFF, 1, false},
+		{"max length", 0, 0xFFFFFF, false},
+		{"offset past 24 bits", 0x1000000, 1, true},
+		{"length past 24 bits", 0, 0x1000000, true},
+		{"negative offset", -1, 1, true},
+		{"negative length", 0, -1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent int
+			card := apduFunc(func(apdu []byte) ([]byte, error) {
+				sent++
+				return []byte{0x91, 0x00}, nil
+			})
+
+			_, err := ReadFileDataPlain(card, 0x02, tc.offset, tc.length)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ReadFileDataPlain(%d, %d) error = %v, wantErr %v", tc.offset, tc.length, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if sent != 0 {
+					t.Fatalf("expected no APDU for a rejected range, sent %d", sent)
+				}
+				if _, err := ReadFileDataSecure(card, testSession(), 0x02, tc.offset, tc.length); err == nil {
+					t.Fatal("ReadFileDataSecure accepted an out-of-range request")
+				}
+				if _, err := ReadFileDataMAC(card, testSession(), 0x02, tc.offset, tc.length); err == nil {
+					t.Fatal("ReadFileDataMAC accepted an out-of-range request")
+				}
+				if sent != 0 {
+					t.Fatalf("expected no APDU from the secure reads, sent %d", sent)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileDataRangeGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int
+		wantErr bool
+	}{
+		{"zero", 0, false},
+		{"max offset", 0xFFFFFF, false},
+		{"offset past 24 bits", 0x1000000, true},
+		{"negative offset", -1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent int
+			card := apduFunc(func(apdu []byte) ([]byte, error) {
+				sent++
+				return []byte{0x91, 0x00}, nil
+			})
+
+			err := WriteFileDataPlain(card, 0x02, tc.offset, []byte{0x01})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("WriteFileDataPlain(%d) error = %v, wantErr %v", tc.offset, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if err := WriteFileDataSecure(card, testSession(), 0x02, tc.offset, []byte{0x01}); err == nil {
+					t.Fatal("WriteFileDataSecure accepted an out-of-range offset")
+				}
+				if err := WriteFileDataMAC(card, testSession(), 0x02, tc.offset, []byte{0x01}); err == nil {
+					t.Fatal("WriteFileDataMAC accepted an out-of-range offset")
+				}
+				if sent != 0 {
+					t.Fatalf("expected no APDU for a rejected offset, sent %d", sent)
+				}
+			}
+		})
+	}
+}
+
+func TestReadBinarySFIEncoding(t *testing.T) {
+	var apdus [][]byte
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		apdus = append(apdus, append([]byte(nil), apdu...))
+		if apdu[4] == 0x00 {
+			return []byte{0x6C, 0x0F}, nil
+		}
+		return append(ccWithNDEFFile(0xE104), 0x90, 0x00), nil
+	})
+
+	data, err := ReadBinarySFI(card, 0x01, 0x00, 0x00)
+	if err != nil {
+		t.Fatalf("ReadBinarySFI returned error: %v", err)
+	}
+	if !bytes.Equal(data, ccWithNDEFFile(0xE104)) {
+		t.Fatalf("unexpected CC data % X", data)
+	}
+	want := [][]byte{
+		{0x00, 0xB0, 0x81, 0x00, 0x00},
+		{0x00, 0xB0, 0x81, 0x00, 0x0F},
+	}
+	if len(apdus) != len(want) || !bytes.Equal(apdus[0], want[0]) || !bytes.Equal(apdus[1], want[1]) {
+		t.Fatalf("expected APDUs % X, got % X", want, apdus)
+	}
+
+	apdus = nil
+	if _, err := ReadBinarySFI(card, 0x02, 0x02, 0x10); err != nil {
+		t.Fatalf("ReadBinarySFI returned error: %v", err)
+	}
+	if !bytes.Equal(apdus[0], []byte{0x00, 0xB0, 0x82, 0x02, 0x10}) {
+		t.Fatalf("expected P1=82 P2=02 for SFI 2 offset 2, got % X", apdus[0])
+	}
+
+	for _, sfi := range []byte{0x00, 0x1F, 0x20} {
+		if _, err := ReadBinarySFI(card, sfi, 0x00, 0x00); err == nil {
+			t.Fatalf("expected SFI 0x%02X to be rejected", sfi)
+		}
+	}
+}
+
+func TestGetFileCounters(t *testing.T) {
+	// SDMCtrRet free: plain command, counter 0x00012A, reserved bytes zero
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if !bytes.Equal(apdu, []byte{0x90, 0xF6, 0x00, 0x00, 0x01, 0x02, 0x00}) {
+			t.Fatalf("unexpected APDU % X", apdu)
+		}
+		return []byte{0x2A, 0x01, 0x00, 0x00, 0x00, 0x91, 0x00}, nil
+	})
+	if ctr, err := GetFileCounters(card, nil, 0x02); err != nil || ctr != 0x12A {
+		t.Fatalf("expected plain counter 0x12A, got 0x%X %v", ctr, err)
+	}
+
+	// SDMCtrRet is a key: CommMode.Full, file number in the clear header
+	sess := testSession()
+	tag := *sess
+	card = apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] != 0xF6 || apdu[4] != 1+8 || apdu[5] != 0x02 {
+			t.Fatalf("expected GetFileCounters with header and MAC only, got % X", apdu)
+		}
+		ssmDecryptCommand(t, &tag, apdu, 1)
+		return ssmResponse(t, &tag, []byte{0x07, 0x00, 0x01, 0x00, 0x00}), nil
+	})
+	if ctr, err := GetFileCounters(card, sess, 0x02); err != nil || ctr != 0x010007 {
+		t.Fatalf("expected secure counter 0x010007, got 0x%X %v", ctr, err)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected session counter 1, got %d", sess.cmdCtr)
+	}
+
+	// SDMCtrRet denied
+	card = apduFunc(func(apdu []byte) ([]byte, error) { return []byte{0x91, 0x9D}, nil })
+	var swErr *SWError
+	if _, err := GetFileCounters(card, nil, 0x02); !errors.As(err, &swErr) || swErr.SW != SWPermDenied {
+		t.Fatalf("expected SW=919D, got %v", err)
+	}
+}
+
+func TestNDEFReaderStreamsInChunks(t *testing.T) {
+	tag := newISONDEFTag(t, 700)
+	payload := make([]byte, 600)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	if err := WriteNDEFMessage(tag, payload); err != nil {
+		t.Fatalf("WriteNDEFMessage returned error: %v", err)
+	}
+
+	var reads [][2]int
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xB0 && tag.selected == 0xE104 {
+			reads = append(reads, [2]int{int(apdu[2])<<8 | int(apdu[3]), int(apdu[4])})
+		}
+		return tag.Transmit(apdu)
+	})
+	r, err := NDEFReader(card)
+	if err != nil {
+		t.Fatalf("NDEFReader returned error: %v", err)
+	}
+	if len(reads) != 1 {
+		t.Fatalf("expected only the NLEN read before the first Read, got %v", reads)
+	}
+
+	// io.ReadAll passes buffers of 512 bytes and up; each READ BINARY
+	// still asks for at most 255.
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("expected streamed message to match payload")
+	}
+	want := [][2]int{{0, 2}, {2, 255}, {257, 255}, {512, 90}}
+	if len(reads) != len(want) {
+		t.Fatalf("expected reads %v, got %v", want, reads)
+	}
+	for i := range want {
+		if reads[i] != want[i] {
+			t.Fatalf("expected reads %v, got %v", want, reads)
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected Read after Close to fail")
+	}
+}
+
+func TestNDEFReaderShortFile(t *testing.T) {
+	tag := newISONDEFTag(t, 64)
+	tag.files[0xE104][1] = 0x10 // NLEN 16
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0xB0 && tag.selected == 0xE104 && apdu[3] != 0 {
+			return []byte{0x90, 0x00}, nil // tag returns no data
+		}
+		return tag.Transmit(apdu)
+	})
+	r, err := NDEFReader(card)
+	if err != nil {
+		t.Fatalf("NDEFReader returned error: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RelayRequest is the body HTTPRelayCard POSTs for each APDU.
+type RelayRequest struct {
+	APDU string `json:"apdu"` // Command APDU, hex
+}
+
+// RelayResponse is the body a relay answers with: the response APDU
+// including SW1 SW2, or why the tag could not be reached (tag lost, no tag
+// in the field). A relay that answers Error should still use HTTP 200; any
+// other status is treated as a relay failure.
+type RelayResponse struct {
+	Response string `json:"response,omitempty"` // Response data and SW1 SW2, hex
+	Error    string `json:"error,omitempty"`
+}
+
+// relayTimeout bounds one APDU round trip through a relay when
+// HTTPRelayCard.Client is nil. A phone tap plus network hop is slower than a
+// USB reader, but a single APDU should never take this long.
+const relayTimeout = 10 * time.Second
+
+// HTTPRelayCard is a Card that forwards every APDU to a relay over HTTP, for
+// example a phone app holding the tag in its NFC field, so provisioning and
+// inspection code can run without a PC/SC reader. Each Transmit is one
+// POST of a RelayRequest to URL, answered with a RelayResponse.
+//
+// The relay must keep the tag connection open between requests: secure
+// messaging sessions live on the tag and end if it leaves the field.
+type HTTPRelayCard struct {
+	URL    string
+	Client *http.Client // nil uses a client with a 10 s timeout
+	Header http.Header  // Sent with every request, e.g. an Authorization token
+}
+
+// NewHTTPRelayCard returns an HTTPRelayCard posting to url.
+func NewHTTPRelayCard(url string) *HTTPRelayCard {
+	return &HTTPRelayCard{URL: url}
+}
+
+// Transmit implements Card.
+func (c *HTTPRelayCard) Transmit(apdu []byte) ([]byte, error) {
+	body, err := json.Marshal(RelayRequest{APDU: strings.ToUpper(hex.EncodeToString(apdu))})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("relay request: %w", err)
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: relayTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("relay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("relay: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var rr RelayResponse
+	if err := json.Unmarshal(data, &rr); err != nil {
+		return nil, fmt.Errorf("relay: decode response: %w", err)
+	}
+	if rr.Error != "" {
+		return nil, errors.New("relay: " + rr.Error)
+	}
+	out, err := hex.DecodeString(rr.Response)
+	if err != nil {
+		return nil, fmt.Errorf("relay: response is not hex: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// relayServer is a relay in front of card, as a phone app would be in front
+// of a tapped tag. It requires the X-Relay-Token header.
+func relayServer(t *testing.T, card Card) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Relay-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var req RelayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		apdu, err := hex.DecodeString(req.APDU)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var rr RelayResponse
+		if resp, err := card.Transmit(apdu); err != nil {
+			rr.Error = err.Error()
+		} else {
+			rr.Response = hex.EncodeToString(resp)
+		}
+		json.NewEncoder(w).Encode(rr)
+	}))
+}
+
+func TestHTTPRelayCard(t *testing.T) {
+	fake := NewFakeCard(
+		FakeExchange{Command: []byte{0xFF, 0xCA, 0x00, 0x00, 0x00}, Response: []byte{0x04, 0x1E, 0x3C, 0x5A, 0x7B, 0x6F, 0x80, 0x90, 0x00}},
+		FakeExchange{Response: []byte{0x91, 0x1C}},
+	)
+	srv := relayServer(t, fake)
+	defer srv.Close()
+
+	card := NewHTTPRelayCard(srv.URL)
+	card.Header = http.Header{"X-Relay-Token": {"secret"}}
+
+	uid, err := GetUID(card)
+	if err != nil || !bytes.Equal(uid, testUID) {
+		t.Fatalf("expected UID % X over the relay, got % X %v", testUID, uid, err)
+	}
+	// Status words come back untouched
+	if ids, err := GetApplicationIDs(card); err != nil || ids != nil {
+		t.Fatalf("expected unsupported GetApplicationIDs to read as none, got %v %v", ids, err)
+	}
+	if err := fake.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag side failing (script exhausted here, tag lost on a phone)
+	if _, err := card.Transmit([]byte{0x90, 0x60, 0x00, 0x00, 0x00}); err == nil || !strings.Contains(err.Error(), "relay: fake card") {
+		t.Fatalf("expected relayed tag error, got %v", err)
+	}
+	// The relay refusing the request
+	card.Header = nil
+	if _, err := card.Transmit([]byte{0x90, 0x60, 0x00, 0x00, 0x00}); err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Fatalf("expected HTTP 403 error, got %v", err)
+	}
+}
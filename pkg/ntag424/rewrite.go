@@ -0,0 +1,108 @@
+package ntag424
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sdmNDEFFileNo is the DESFire file number of the NDEF file (ISO 0xE104).
+const sdmNDEFFileNo = 0x02
+
+// SDMOffsetShiftError reports that a new SDM URL would move the mirrors away
+// from the offsets the tag's file settings point at.
+type SDMOffsetShiftError struct {
+	Fields []string // "UIDOffset 32 -> 36", one per offset that moved
+}
+
+func (e *SDMOffsetShiftError) Error() string {
+	return "SDM offsets would shift: " + strings.Join(e.Fields, ", ")
+}
+
+// RewriteSDMURL replaces the base URL of an SDM-enabled NDEF file without
+// touching its file settings. It is for URL changes that keep the SDM layout
+// identical, e.g. a new host or path of the same length; it never disables
+// SDM or opens write access, so the tag is not exposed in between.
+//
+// Steps:
+//  1. Build the new SDM NDEF template
+//  2. Select NDEF app, authenticate settingsKeyNo and read file 2 settings
+//  3. Check SDM is enabled and the UID/Ctr/MACInput/MAC offsets are unchanged
+//  4. Authenticate with writeKey on the file's Write (or ReadWrite) slot,
+//     unless write access is free
+//  5. Write the NDEF template
+//
+// If any offset would move, nothing is written and the error is an
+// *SDMOffsetShiftError; use sdmconfig -update-sdm for such changes.
+func RewriteSDMURL(card Card, settingsKey []byte, settingsKeyNo byte, writeKey []byte, newBaseURL string) error {
+	sdm, err := BuildSDMNDEF(newBaseURL)
+	if err != nil {
+		return err
+	}
+
+	if err := SelectNDEFApp(card); err != nil {
+		return fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, err := AuthenticateEV2First(card, settingsKey, settingsKeyNo)
+	if err != nil {
+		return fmt.Errorf("authenticate settings key slot %d: %w", settingsKeyNo, err)
+	}
+	fs, err := GetFileSettings(card, sess, sdmNDEFFileNo)
+	if err != nil {
+		return fmt.Errorf("read file %d settings: %w", sdmNDEFFileNo, err)
+	}
+	if err := checkSDMOffsets(fs, sdm); err != nil {
+		return err
+	}
+
+	access := fs.AccessRights()
+	writeSlot := access.Write
+	if writeSlot == ARDenied {
+		writeSlot = access.ReadWrite
+	}
+	switch {
+	case access.Write == ARFree || access.ReadWrite == ARFree:
+		// No authentication needed to write.
+	case writeSlot == ARDenied:
+		return fmt.Errorf("file %d is not writable (%s)", sdmNDEFFileNo, access)
+	default:
+		if _, err := AuthenticateEV2First(card, writeKey, writeSlot); err != nil {
+			return fmt.Errorf("authenticate write key slot %d: %w", writeSlot, err)
+		}
+	}
+
+	// WriteNDEFWithAuth keeps the app selected so the write session survives.
+	if err := WriteNDEFWithAuth(card, sdm.NDEF); err != nil {
+		return fmt.Errorf("write NDEF: %w", err)
+	}
+	return nil
+}
+
+// checkSDMOffsets reports whether sdm lays its mirrors out at the offsets fs
+// already configures.
+func checkSDMOffsets(fs *FileSettings, sdm *SDMNDEF) error {
+	if fs.FileOption&0x40 == 0 {
+		return errors.New("SDM is not enabled on the NDEF file")
+	}
+	if fs.Size > 0 && len(sdm.NDEF) > int(fs.Size) {
+		return fmt.Errorf("NDEF template is %d bytes, file holds %d", len(sdm.NDEF), fs.Size)
+	}
+	shift := &SDMOffsetShiftError{}
+	for _, o := range []struct {
+		name     string
+		cur, new uint32
+	}{
+		{"UIDOffset", fs.UIDOffset, sdm.UIDOffset},
+		{"CtrOffset", fs.CtrOffset, sdm.CtrOffset},
+		{"MACInputOffset", fs.MACInputOffset, sdm.MacInputOffset},
+		{"MACOffset", fs.MACOffset, sdm.MacOffset},
+	} {
+		if o.cur != o.new {
+			shift.Fields = append(shift.Fields, fmt.Sprintf("%s %d -> %d", o.name, o.cur, o.new))
+		}
+	}
+	if len(shift.Fields) > 0 {
+		return shift
+	}
+	return nil
+}
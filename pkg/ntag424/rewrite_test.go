@@ -0,0 +1,101 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var rewriteWriteKey = bytes.Repeat([]byte{0x22}, 16)
+
+// sdmNDEFSettings returns the settings of an SDM NDEF file provisioned for
+// baseURL: read free, write on slot 2.
+func sdmNDEFSettings(t *testing.T, baseURL string) *FileSettings {
+	t.Helper()
+	sdm, err := BuildSDMNDEF(baseURL)
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	fs := &FileSettings{FileOption: 0x40, AR1: 0x20, AR2: 0xE2, Size: 256,
+		SDMOptions: 0xC1, SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01}
+	sdm.ApplyTo(fs)
+	return fs
+}
+
+// rewriteSettingsExchanges scripts RewriteSDMURL up to the settings read:
+// select, slot 0 authentication with the factory key and a plain
+// GetFileSettings of file 2 answered with fs.
+func rewriteSettingsExchanges(t *testing.T, fs *FileSettings) []FakeExchange {
+	t.Helper()
+	zero := make([]byte, 16)
+	auth, _ := authExchanges(t, 0, zero, zero)
+	script := append([]FakeExchange{selectNDEFAppExchange}, auth...)
+	resp := settingsResponse(0x00, int(fs.Size), BuildChangeFileSettingsDataFull(fs))
+	return append(script, FakeExchange{
+		Command:  []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x00},
+		Response: append(resp, 0x91, 0x00),
+	})
+}
+
+// updateBinaryExchanges scripts the UPDATE BINARY chunks that write data
+// from the start of the selected file.
+func updateBinaryExchanges(data []byte) []FakeExchange {
+	var script []FakeExchange
+	for off := 0; off < len(data); off += 0xFF {
+		chunk := data[off:]
+		if len(chunk) > 0xFF {
+			chunk = chunk[:0xFF]
+		}
+		script = append(script, FakeExchange{
+			Command:  append([]byte{0x00, 0xD6, byte(off >> 8), byte(off), byte(len(chunk))}, chunk...),
+			Response: []byte{0x90, 0x00},
+		})
+	}
+	return script
+}
+
+func TestRewriteSDMURLSameOffsets(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	want, _ := BuildSDMNDEF("https://api.example.org/tap")
+
+	// Settings key, then write key, then the new NDEF; the settings are never
+	// changed (no ChangeFileSettings is scripted).
+	script := rewriteSettingsExchanges(t, sdmNDEFSettings(t, "https://api.example.com/tap"))
+	auth, _ := authExchanges(t, 2, rewriteWriteKey, rewriteWriteKey)
+	script = append(script, auth...)
+	script = append(script, FakeExchange{Command: mustHex(t, "00A4000C02E104"), Response: []byte{0x90, 0x00}})
+	script = append(script, updateBinaryExchanges(want.NDEF)...)
+	card := NewFakeCard(script...)
+
+	// Same length host: every mirror stays where the settings point.
+	if err := RewriteSDMURL(card, make([]byte, 16), 0, rewriteWriteKey, "https://api.example.org/tap"); err != nil {
+		t.Fatalf("RewriteSDMURL returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewriteSDMURLRejectsShiftedOffsets(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+
+	// Nothing past the settings read is scripted, so nothing can be written.
+	card := NewFakeCard(rewriteSettingsExchanges(t, sdmNDEFSettings(t, "https://api.example.com/tap"))...)
+	err := RewriteSDMURL(card, make([]byte, 16), 0, rewriteWriteKey, "https://example.com/t")
+	var shift *SDMOffsetShiftError
+	if !errors.As(err, &shift) {
+		t.Fatalf("expected SDMOffsetShiftError, got %v", err)
+	}
+	if len(shift.Fields) != 4 || !strings.HasPrefix(shift.Fields[0], "UIDOffset ") {
+		t.Fatalf("expected all four offsets reported, got %v", shift.Fields)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	card = NewFakeCard(rewriteSettingsExchanges(t, &FileSettings{FileOption: 0x00, AR1: 0xE0, AR2: 0xEE, Size: 256})...)
+	if err := RewriteSDMURL(card, make([]byte, 16), 0, rewriteWriteKey, "https://api.example.com/tap"); err == nil || !strings.Contains(err.Error(), "SDM is not enabled") {
+		t.Fatalf("expected SDM-disabled error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package ntag424
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SlotRoles names what each key slot is used for, for display (e.g. 0:
+// "AppMaster"). Slots without an entry have no role.
+type SlotRoles map[byte]string
+
+// DefaultSlotRoles returns the slot assignment the tools provision:
+// AppMaster in slot 0, SDM in 1, File Two Write in 2 and general read/write
+// keys in 3 and 4.
+func DefaultSlotRoles() SlotRoles {
+	return SlotRoles{
+		0: "AppMaster",
+		1: "SDM",
+		2: "File Two Write",
+		3: "read/write",
+		4: "read/write",
+	}
+}
+
+// Role returns the role of slot, or "" if it has none. A nil SlotRoles uses
+// DefaultSlotRoles.
+func (r SlotRoles) Role(slot byte) string {
+	if r == nil {
+		return DefaultSlotRoles()[slot]
+	}
+	return r[slot]
+}
+
+// Slots returns the slots that have a role, in ascending order.
+func (r SlotRoles) Slots() []byte {
+	slots := make([]byte, 0, len(r))
+	for slot := range r {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots
+}
+
+// WithOverrides returns a copy of r with overrides applied: a listed slot
+// gets the given role, and an empty role removes it. Slots overrides does not
+// mention keep their role in r. The tools read overrides from a slot_roles
+// file (see their -slot-roles flag) and apply them to DefaultSlotRoles.
+func (r SlotRoles) WithOverrides(overrides map[int]string) (SlotRoles, error) {
+	roles := make(SlotRoles, len(r))
+	for slot, role := range r {
+		roles[slot] = role
+	}
+	for slot, role := range overrides {
+		if slot < 0 || slot > maxKeySlot {
+			return nil, fmt.Errorf("slot_roles: slot %d out of range 0-%d", slot, maxKeySlot)
+		}
+		if role == "" {
+			delete(roles, byte(slot))
+			continue
+		}
+		roles[byte(slot)] = role
+	}
+	return roles, nil
+}
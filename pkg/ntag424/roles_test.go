@@ -0,0 +1,39 @@
+package ntag424
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlotRolesWithOverrides(t *testing.T) {
+	defaults := DefaultSlotRoles()
+	roles, err := defaults.WithOverrides(map[int]string{1: "SDM MAC", 3: "Loyalty", 4: ""})
+	if err != nil {
+		t.Fatalf("WithOverrides returned error: %v", err)
+	}
+	want := SlotRoles{0: "AppMaster", 1: "SDM MAC", 2: "File Two Write", 3: "Loyalty"}
+	if !reflect.DeepEqual(roles, want) {
+		t.Fatalf("expected roles %v, got %v", want, roles)
+	}
+	if got := roles.Slots(); !reflect.DeepEqual(got, []byte{0, 1, 2, 3}) {
+		t.Fatalf("expected slots 0-3, got %v", got)
+	}
+	if !reflect.DeepEqual(defaults, DefaultSlotRoles()) {
+		t.Fatalf("WithOverrides modified the receiver: %v", defaults)
+	}
+}
+
+func TestSlotRolesWithOverridesRejectsSlotOutOfRange(t *testing.T) {
+	for _, slot := range []int{-1, 5} {
+		if _, err := DefaultSlotRoles().WithOverrides(map[int]string{slot: "Extra"}); err == nil {
+			t.Fatalf("expected error for slot %d", slot)
+		}
+	}
+}
+
+func TestSlotRolesNilUsesDefaults(t *testing.T) {
+	var roles SlotRoles
+	if got := roles.Role(0); got != "AppMaster" {
+		t.Fatalf("expected default AppMaster for slot 0, got %q", got)
+	}
+}
@@ -5,9 +5,178 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
+// SDMParamConfig names the SDM query parameters and describes the MAC input layout.
+//
+// Fields:
+//   - UIDParam: query parameter carrying the UID mirror (default "uid")
+//   - CtrParam: query parameter carrying the read counter mirror (default "ctr")
+//   - MACParam: query parameter carrying the truncated CMAC (default "mac")
+//   - MACInputTemplate: ASCII MAC input with {uid} and {ctr} placeholders.
+//     Empty means "<UIDParam>={uid}&<CtrParam>={ctr}&<MACParam>=".
+//   - Encoding: how the tag mirrors UID, ReadCtr and MAC (SDMOptions bit 0).
+//     The zero value is SDMEncodingASCII.
+//   - CounterEndianness: byte order of the ctr hex in ASCII encoding. The
+//     zero value is CounterBigEndian, as the tag mirrors it; binary mirrors
+//     are always LSB first and ignore this field.
+//
+// The tag computes the MAC over the exact bytes between MacInputOffset and
+// MacOffset, so the template must match the layout BuildSDMNDEFWithConfig
+// writes into the NDEF file.
+type SDMParamConfig struct {
+	UIDParam          string
+	CtrParam          string
+	MACParam          string
+	MACInputTemplate  string
+	Encoding          SDMEncoding
+	CounterEndianness CounterEndianness
+}
+
+// CounterEndianness is the byte order of the ctr value in an SDM URL.
+//
+// Reading the counter in the wrong order does not fail to parse; it derives
+// the wrong session key, so the MAC check fails exactly as it would for a
+// wrong key.
+type CounterEndianness int
+
+const (
+	// CounterBigEndian reads ctr MSB first ("00012A" is 0x12A), as the tag
+	// mirrors ReadCtr in ASCII encoding.
+	CounterBigEndian CounterEndianness = iota
+	// CounterLittleEndian reads ctr LSB first ("2A0100" is 0x12A), for
+	// configurations that mirror or forward the counter in that order.
+	CounterLittleEndian
+)
+
+func (e CounterEndianness) String() string {
+	switch e {
+	case CounterBigEndian:
+		return "big-endian"
+	case CounterLittleEndian:
+		return "little-endian"
+	}
+	return fmt.Sprintf("CounterEndianness(%d)", int(e))
+}
+
+// SDMEncoding is the mirror encoding selected by SDMOptions bit 0.
+//
+// In a URL both encodings arrive as hex: ASCII mirrors are hex already, and a
+// binary mirror is hex-encoded by whatever forwards it. They differ in the
+// MAC input, which holds exactly the bytes the tag mirrored, and in the
+// counter byte order.
+type SDMEncoding int
+
+const (
+	// SDMEncodingASCII mirrors uppercase hex: UID 14 chars, ReadCtr 6 chars
+	// MSB first, MAC 16 chars. This is the layout BuildSDMNDEF writes.
+	SDMEncodingASCII SDMEncoding = iota
+	// SDMEncodingBinary mirrors raw bytes: UID 7 bytes, ReadCtr 3 bytes LSB
+	// first, MAC 8 bytes. The hex forms of these replace {uid} and {ctr} in
+	// the URL, but the MAC is computed over the raw bytes.
+	SDMEncodingBinary
+)
+
+// SDMEncodingFromOptions returns the encoding selected by an SDMOptions byte.
+func SDMEncodingFromOptions(sdmOptions byte) SDMEncoding {
+	if sdmOptions&0x01 != 0 {
+		return SDMEncodingASCII
+	}
+	return SDMEncodingBinary
+}
+
+// OptionBit returns the SDMOptions bit 0 value that selects e.
+func (e SDMEncoding) OptionBit() byte {
+	if e == SDMEncodingASCII {
+		return 0x01
+	}
+	return 0x00
+}
+
+func (e SDMEncoding) String() string {
+	switch e {
+	case SDMEncodingASCII:
+		return "ascii"
+	case SDMEncodingBinary:
+		return "binary"
+	}
+	return fmt.Sprintf("SDMEncoding(%d)", int(e))
+}
+
+// DefaultSDMParamConfig returns the uid/ctr/mac layout emitted by BuildSDMNDEF.
+func DefaultSDMParamConfig() SDMParamConfig {
+	return SDMParamConfig{
+		UIDParam: "uid",
+		CtrParam: "ctr",
+		MACParam: "mac",
+	}
+}
+
+func (c SDMParamConfig) validate() error {
+	if c.UIDParam == "" || c.CtrParam == "" || c.MACParam == "" {
+		return fmt.Errorf("SDM parameter names must not be empty")
+	}
+	if c.UIDParam == c.CtrParam || c.UIDParam == c.MACParam || c.CtrParam == c.MACParam {
+		return fmt.Errorf("SDM parameter names must be distinct: %s/%s/%s", c.UIDParam, c.CtrParam, c.MACParam)
+	}
+	if c.Encoding != SDMEncodingASCII && c.Encoding != SDMEncodingBinary {
+		return fmt.Errorf("unknown SDM encoding %v", c.Encoding)
+	}
+	if c.CounterEndianness != CounterBigEndian && c.CounterEndianness != CounterLittleEndian {
+		return fmt.Errorf("unknown counter endianness %v", c.CounterEndianness)
+	}
+	return nil
+}
+
+// counterLSBFirst reports whether the ctr hex in the URL is LSB first.
+func (c SDMParamConfig) counterLSBFirst() bool {
+	return c.Encoding == SDMEncodingBinary || c.CounterEndianness == CounterLittleEndian
+}
+
+// template returns MACInputTemplate, or the default layout derived from the parameter names.
+func (c SDMParamConfig) template() string {
+	if c.MACInputTemplate != "" {
+		return c.MACInputTemplate
+	}
+	return c.UIDParam + "={uid}&" + c.CtrParam + "={ctr}&" + c.MACParam + "="
+}
+
+// macInput renders the ASCII MAC input for the given uid and counter hex strings.
+func (c SDMParamConfig) macInput(uidHex, ctrHex string) string {
+	return strings.NewReplacer("{uid}", uidHex, "{ctr}", ctrHex).Replace(c.template())
+}
+
+// tapMACInput renders the MAC input the tag computes for uid and counter:
+// the hex strings in ASCII encoding, the raw mirrored bytes in binary.
+func (c SDMParamConfig) tapMACInput(uid []byte, counter uint32) []byte {
+	if c.Encoding == SDMEncodingBinary {
+		return []byte(c.macInput(string(uid), string(u24le(counter))))
+	}
+	return []byte(c.macInput(strings.ToUpper(hex.EncodeToString(uid)), c.ctrHex(counter)))
+}
+
+// ctrHex returns the hex form of counter as it appears in the URL: MSB first
+// for ASCII (unless CounterEndianness says otherwise), the hex of the
+// LSB-first mirror for binary.
+func (c SDMParamConfig) ctrHex(counter uint32) string {
+	ctr := u24le(counter)
+	if !c.counterLSBFirst() {
+		ctr[0], ctr[2] = ctr[2], ctr[0]
+	}
+	return strings.ToUpper(hex.EncodeToString(ctr))
+}
+
+// SV labels for DeriveSDMSessionKeyWithLabel. Each is followed by
+// 00 01 00 80 (counter, length 128 bits) in the session vector.
+var (
+	// SDMMACLabel derives SesSDMFileReadMACKey, used for the SDM MAC.
+	SDMMACLabel = []byte{0x3C, 0xC3, 0x00, 0x01, 0x00, 0x80}
+	// SDMENCLabel derives SesSDMFileReadENCKey, used for SDM ENC file data.
+	SDMENCLabel = []byte{0xC3, 0x3C, 0x00, 0x01, 0x00, 0x80}
+)
+
 // DeriveSDMSessionKey derives the SDM MAC session key from a base key, UID, and read counter.
 // From ro/sdm.go:11-28.
 //
@@ -20,25 +189,60 @@ import (
 //   - 16-byte SDM session key (CMAC of SV2)
 //
 // SV2 derivation:
-//   SV2 = 3C C3 00 01 00 80 || UID(7) || Counter_LE(3)
-//   SDMSessionKey = AES-CMAC(baseKey, SV2)
+//
+//	SV2 = 3C C3 00 01 00 80 || UID(7) || Counter_LE(3)
+//	SDMSessionKey = AES-CMAC(baseKey, SV2)
+//
+// This is DeriveSDMSessionKeyWithLabel with SDMMACLabel.
 func DeriveSDMSessionKey(baseKey, uid, ctrLE []byte) ([]byte, error) {
+	return DeriveSDMSessionKeyWithLabel(baseKey, uid, ctrLE, SDMMACLabel)
+}
+
+// DeriveSDMSessionKeyWithLabel derives an SDM session key with a caller-chosen
+// SV label:
+//
+//	SV = label || UID(7) || Counter_LE(3)
+//	SessionKey = AES-CMAC(baseKey, SV)
+//
+// The tag uses two labels:
+//   - SDMMACLabel (3C C3 00 01 00 80): SesSDMFileReadMACKey, for the SDM MAC
+//   - SDMENCLabel (C3 3C 00 01 00 80): SesSDMFileReadENCKey, for decrypting
+//     SDM ENC file data
+//
+// Other labels are accepted for custom schemes; label must not be empty.
+func DeriveSDMSessionKeyWithLabel(baseKey, uid, ctrLE, label []byte) ([]byte, error) {
 	if len(baseKey) != 16 {
 		return nil, fmt.Errorf("base key must be 16 bytes, got %d", len(baseKey))
 	}
+	ck, err := newCMACKey(baseKey)
+	if err != nil {
+		return nil, err
+	}
+	return deriveSDMSessionKeyWithLabel(ck, uid, ctrLE, label)
+}
+
+// deriveSDMSessionKey is DeriveSDMSessionKey with a precomputed base key.
+func deriveSDMSessionKey(baseKey *cmacKey, uid, ctrLE []byte) ([]byte, error) {
+	return deriveSDMSessionKeyWithLabel(baseKey, uid, ctrLE, SDMMACLabel)
+}
+
+func deriveSDMSessionKeyWithLabel(baseKey *cmacKey, uid, ctrLE, label []byte) ([]byte, error) {
 	if len(uid) != 7 {
 		return nil, fmt.Errorf("UID must be 7 bytes, got %d", len(uid))
 	}
 	if len(ctrLE) != 3 {
 		return nil, fmt.Errorf("counter must be 3 bytes, got %d", len(ctrLE))
 	}
+	if len(label) == 0 {
+		return nil, fmt.Errorf("SV label must not be empty")
+	}
 
-	sv2 := make([]byte, 0, 16)
-	sv2 = append(sv2, 0x3C, 0xC3, 0x00, 0x01, 0x00, 0x80)
-	sv2 = append(sv2, uid...)
-	sv2 = append(sv2, ctrLE...)
+	sv := make([]byte, 0, len(label)+10)
+	sv = append(sv, label...)
+	sv = append(sv, uid...)
+	sv = append(sv, ctrLE...)
 
-	return aesCMAC(baseKey, sv2)
+	return baseKey.sum(sv), nil
 }
 
 // ParseSDMURL extracts uid, ctr, and mac parameters from an SDM URL.
@@ -50,16 +254,24 @@ func DeriveSDMSessionKey(baseKey, uid, ctrLE []byte) ([]byte, error) {
 //   - mac: 16-character hex string (8 bytes truncated CMAC)
 //   - error if parsing fails or parameters are missing
 func ParseSDMURL(rawURL string) (uid, ctr, mac string, err error) {
+	return ParseSDMURLWithConfig(rawURL, DefaultSDMParamConfig())
+}
+
+// ParseSDMURLWithConfig extracts the SDM parameters named by cfg from an SDM URL.
+func ParseSDMURLWithConfig(rawURL string, cfg SDMParamConfig) (uid, ctr, mac string, err error) {
+	if err := cfg.validate(); err != nil {
+		return "", "", "", err
+	}
 	u, err := url.Parse(rawURL)
 	if err != nil {
 		return "", "", "", err
 	}
 	q := u.Query()
-	uid = q.Get("uid")
-	ctr = q.Get("ctr")
-	mac = q.Get("mac")
+	uid = q.Get(cfg.UIDParam)
+	ctr = q.Get(cfg.CtrParam)
+	mac = q.Get(cfg.MACParam)
 	if uid == "" || ctr == "" || mac == "" {
-		return uid, ctr, mac, fmt.Errorf("missing uid/ctr/mac parameters")
+		return uid, ctr, mac, fmt.Errorf("missing %s/%s/%s parameters", cfg.UIDParam, cfg.CtrParam, cfg.MACParam)
 	}
 	return uid, ctr, mac, nil
 }
@@ -76,63 +288,97 @@ func ParseSDMURL(rawURL string) (uid, ctr, mac string, err error) {
 //   - error if parsing or derivation fails
 //
 // Steps:
-//   1. Parse uid, ctr, mac from URL
-//   2. Convert counter from big-endian to little-endian
-//   3. Derive SDM session key
-//   4. Compute CMAC over "uid=<uid>&ctr=<ctr>&mac="
-//   5. Truncate to 8 bytes (odd bytes only)
-//   6. Compare with provided MAC
+//  1. Parse uid, ctr, mac from URL
+//  2. Convert counter from big-endian to little-endian
+//  3. Derive SDM session key
+//  4. Compute CMAC over "uid=<uid>&ctr=<ctr>&mac="
+//  5. Truncate to 8 bytes (odd bytes only)
+//  6. Compare with provided MAC
 func VerifySDMMAC(rawURL string, sdmFileKey []byte) (bool, error) {
 	uid, ctr, mac, err := ParseSDMURL(rawURL)
 	if err != nil {
 		return false, err
 	}
+	return VerifySDMMACFields(uid, ctr, mac, sdmFileKey)
+}
 
-	if len(uid) != 14 || len(ctr) != 6 || len(mac) != 16 {
-		return false, fmt.Errorf("invalid parameter lengths: uid=%d ctr=%d mac=%d (want 14,6,16)", len(uid), len(ctr), len(mac))
-	}
-
-	// Decode UID
-	uidBytes, err := hex.DecodeString(uid)
+// VerifySDMMACFields verifies SDM values that have already been extracted,
+// e.g. from a JSON or form body rather than a URL query string.
+//
+// Parameters:
+//   - uid: 14-character hex UID mirror
+//   - ctr: 6-character hex read counter mirror (big-endian)
+//   - mac: 16-character hex truncated CMAC
+//   - sdmFileKey: 16-byte SDM file read key
+//
+// The MAC input is the default "uid=<uid>&ctr=<ctr>&mac=" layout written by
+// BuildSDMNDEF, so uid and ctr must be passed exactly as the tag mirrored
+// them (hex case included).
+func VerifySDMMACFields(uid, ctr, mac string, sdmFileKey []byte) (bool, error) {
+	baseKey, err := newSDMBaseKey(sdmFileKey)
 	if err != nil {
-		return false, fmt.Errorf("UID hex decode: %v", err)
-	}
-	if len(uidBytes) != 7 {
-		return false, fmt.Errorf("UID length: got %d bytes, want 7", len(uidBytes))
+		return false, err
 	}
+	match, _, _, err := verifySDMParams(baseKey, uid, ctr, mac, DefaultSDMParamConfig())
+	return match, err
+}
 
-	// Decode counter (big-endian in URL, little-endian for derivation)
-	ctrBytesBE, err := hex.DecodeString(ctr)
+// VerifySDMMACWithConfig verifies the MAC from an SDM URL whose parameter names
+// and MAC input layout are described by cfg.
+//
+// Parameters:
+//   - rawURL: Full SDM URL carrying the parameters named in cfg
+//   - sdmFileKey: 16-byte SDM file read key
+//   - cfg: parameter names and MAC input template
+//
+// Returns:
+//   - true if MAC matches, false otherwise
+//   - error if parsing or derivation fails
+func VerifySDMMACWithConfig(rawURL string, sdmFileKey []byte, cfg SDMParamConfig) (bool, error) {
+	uid, ctr, mac, err := ParseSDMURLWithConfig(rawURL, cfg)
 	if err != nil {
-		return false, fmt.Errorf("CTR hex decode: %v", err)
-	}
-	if len(ctrBytesBE) != 3 {
-		return false, fmt.Errorf("CTR length: got %d bytes, want 3", len(ctrBytesBE))
+		return false, err
 	}
-	ctrBytesLE := []byte{ctrBytesBE[2], ctrBytesBE[1], ctrBytesBE[0]}
-
-	// Derive SDM session key
-	sessionKey, err := DeriveSDMSessionKey(sdmFileKey, uidBytes, ctrBytesLE)
+	baseKey, err := newSDMBaseKey(sdmFileKey)
 	if err != nil {
-		return false, fmt.Errorf("session key derive: %v", err)
+		return false, err
 	}
+	match, _, _, err := verifySDMParams(baseKey, uid, ctr, mac, cfg)
+	return match, err
+}
 
-	// Compute CMAC over MAC input
-	macInput := fmt.Sprintf("uid=%s&ctr=%s&mac=", uid, ctr)
-	cmac, err := aesCMAC(sessionKey, []byte(macInput))
+// sdmRawSpan matches the default uid/ctr/mac block as the tag mirrors it:
+// group 1 is the MAC input (everything up to and including "mac="), groups
+// 2-4 are the uid, ctr and mac values.
+var sdmRawSpan = regexp.MustCompile(`(?:^|[?&])(uid=([0-9A-Fa-f]{14})&ctr=([0-9A-Fa-f]{6})&mac=)([0-9A-Fa-f]{16})(?:$|[&#])`)
+
+// VerifySDMMACFromRaw verifies the MAC from a scanned SDM URL by computing it
+// over the exact "uid=<uid>&ctr=<ctr>&mac=" span found in the URL, rather
+// than reconstructing the MAC input from parsed parameters.
+//
+// The URL is percent-decoded before the span is searched for, so a scanner
+// that encoded '=' or '&' (%3D, %26) still verifies. Parameters before or
+// after the span (e.g. "&lang=en") are ignored; the span itself must be
+// contiguous, as the tag wrote it between MacInputOffset and MacOffset.
+//
+// Returns:
+//   - true if the MAC matches, false otherwise
+//   - error if no uid/ctr/mac span is found or derivation fails
+func VerifySDMMACFromRaw(rawURL string, sdmFileKey []byte) (bool, error) {
+	decoded, err := url.PathUnescape(rawURL)
 	if err != nil {
-		return false, fmt.Errorf("CMAC error: %v", err)
+		return false, fmt.Errorf("percent-decode URL: %v", err)
 	}
-	computed := truncateOddBytes(cmac)
-
-	// Decode expected MAC
-	expectedBytes, err := hex.DecodeString(mac)
-	if err != nil || len(expectedBytes) != 8 {
-		return false, fmt.Errorf("MAC decode error")
+	m := sdmRawSpan.FindStringSubmatch(decoded)
+	if m == nil {
+		return false, fmt.Errorf("no uid=<14 hex>&ctr=<6 hex>&mac=<16 hex> span in URL")
 	}
-
-	// Compare
-	return bytes.Equal(computed, expectedBytes), nil
+	baseKey, err := newSDMBaseKey(sdmFileKey)
+	if err != nil {
+		return false, err
+	}
+	match, _, _, err := verifySDMMACInput(baseKey, m[2], m[3], m[4], m[1])
+	return match, err
 }
 
 // VerifySDMMACDetailed verifies the MAC from an SDM URL and returns detailed information.
@@ -143,59 +389,166 @@ func VerifySDMMAC(rawURL string, sdmFileKey []byte) (bool, error) {
 //   - computedMAC: computed MAC hex string
 //   - error: if parsing or derivation fails
 func VerifySDMMACDetailed(rawURL string, sdmFileKey []byte) (match bool, counter uint32, computedMAC string, err error) {
-	uid, ctr, mac, err := ParseSDMURL(rawURL)
+	return VerifySDMMACDetailedWithConfig(rawURL, sdmFileKey, DefaultSDMParamConfig())
+}
+
+// VerifySDMMACDetailedWithConfig is VerifySDMMACDetailed for URLs laid out
+// as cfg describes. Set cfg.CounterEndianness to CounterLittleEndian for
+// URLs whose ctr is LSB first; counter is then decoded in that order and the
+// MAC input keeps the ctr hex exactly as it appears in the URL.
+func VerifySDMMACDetailedWithConfig(rawURL string, sdmFileKey []byte, cfg SDMParamConfig) (match bool, counter uint32, computedMAC string, err error) {
+	uid, ctr, mac, err := ParseSDMURLWithConfig(rawURL, cfg)
 	if err != nil {
 		return false, 0, "", err
 	}
+	baseKey, err := newSDMBaseKey(sdmFileKey)
+	if err != nil {
+		return false, 0, "", err
+	}
+	match, counter, computed, err := verifySDMParams(baseKey, uid, ctr, mac, cfg)
+	if computed != nil {
+		computedMAC = strings.ToUpper(hex.EncodeToString(computed))
+	}
+	return match, counter, computedMAC, err
+}
 
+// SDMVerifyResult is the outcome of verifying one URL in a batch.
+type SDMVerifyResult struct {
+	URL     string // URL as supplied
+	Match   bool   // true if the MAC matches
+	Counter uint32 // Read counter (valid once the ctr parameter decodes)
+	Err     error  // Parse or derivation error for this URL, nil otherwise
+}
+
+// VerifySDMMACBatch verifies many SDM URLs against one SDM file key.
+//
+// The AES key schedule and CMAC subkeys for sdmFileKey are computed once and
+// reused for every URL; only the per-tap session key is derived per URL.
+// Per-URL failures are reported in SDMVerifyResult.Err and do not stop the batch.
+//
+// Returns:
+//   - one result per input URL, in input order
+//   - error only if sdmFileKey itself is invalid
+func VerifySDMMACBatch(urls []string, sdmFileKey []byte) ([]SDMVerifyResult, error) {
+	baseKey, err := newSDMBaseKey(sdmFileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := DefaultSDMParamConfig()
+	results := make([]SDMVerifyResult, len(urls))
+	for i, rawURL := range urls {
+		results[i].URL = rawURL
+		uid, ctr, mac, err := ParseSDMURLWithConfig(rawURL, cfg)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Match, results[i].Counter, _, results[i].Err = verifySDMParams(baseKey, uid, ctr, mac, cfg)
+	}
+	return results, nil
+}
+
+// newSDMBaseKey prepares the SDM file key for repeated session key derivation.
+func newSDMBaseKey(sdmFileKey []byte) (*cmacKey, error) {
+	if len(sdmFileKey) != 16 {
+		return nil, fmt.Errorf("session key derive: base key must be 16 bytes, got %d", len(sdmFileKey))
+	}
+	return newCMACKey(sdmFileKey)
+}
+
+// verifySDMParams checks the uid/ctr/mac hex strings taken from an SDM URL.
+//
+// Returns:
+//   - match: true if the MAC matches
+//   - counter: decoded read counter (set once ctr decodes)
+//   - computed: 8-byte truncated MAC (set once it has been computed)
+//   - error if a parameter is malformed
+//
+// Steps:
+//  1. Decode UID and counter (byte order per cfg.Encoding and CounterEndianness)
+//  2. Derive SDM session key from the little-endian counter
+//  3. Compute CMAC over the MAC input rendered from cfg
+//  4. Truncate to 8 bytes (odd bytes only) and compare
+func verifySDMParams(baseKey *cmacKey, uid, ctr, mac string, cfg SDMParamConfig) (match bool, counter uint32, computed []byte, err error) {
+	uidBytes, counter, err := decodeSDMParams(uid, ctr, mac, cfg.counterLSBFirst())
+	if err != nil {
+		return false, counter, nil, err
+	}
+	computed, err = computeSDMMAC(baseKey, uidBytes, counter, cfg.tapMACInput(uidBytes, counter))
+	if err != nil {
+		return false, counter, nil, err
+	}
+	match, err = compareSDMMAC(computed, mac)
+	return match, counter, computed, err
+}
+
+// verifySDMMACInput is verifySDMParams for ASCII mirrors with the MAC input
+// supplied by the caller.
+func verifySDMMACInput(baseKey *cmacKey, uid, ctr, mac, macInput string) (match bool, counter uint32, computed []byte, err error) {
+	uidBytes, counter, err := decodeSDMParams(uid, ctr, mac, false)
+	if err != nil {
+		return false, counter, nil, err
+	}
+	computed, err = computeSDMMAC(baseKey, uidBytes, counter, []byte(macInput))
+	if err != nil {
+		return false, counter, nil, err
+	}
+	match, err = compareSDMMAC(computed, mac)
+	return match, counter, computed, err
+}
+
+// decodeSDMParams decodes the uid and ctr hex strings from an SDM URL. The
+// counter is MSB first unless ctrLSBFirst is set.
+func decodeSDMParams(uid, ctr, mac string, ctrLSBFirst bool) (uidBytes []byte, counter uint32, err error) {
 	if len(uid) != 14 || len(ctr) != 6 || len(mac) != 16 {
-		return false, 0, "", fmt.Errorf("invalid parameter lengths: uid=%d ctr=%d mac=%d (want 14,6,16)", len(uid), len(ctr), len(mac))
+		return nil, 0, fmt.Errorf("invalid parameter lengths: uid=%d ctr=%d mac=%d (want 14,6,16)", len(uid), len(ctr), len(mac))
 	}
 
 	// Decode UID
-	uidBytes, err := hex.DecodeString(uid)
+	uidBytes, err = hex.DecodeString(uid)
 	if err != nil {
-		return false, 0, "", fmt.Errorf("UID hex decode: %v", err)
+		return nil, 0, fmt.Errorf("UID hex decode: %v", err)
 	}
 	if len(uidBytes) != 7 {
-		return false, 0, "", fmt.Errorf("UID length: got %d bytes, want 7", len(uidBytes))
+		return nil, 0, fmt.Errorf("UID length: got %d bytes, want 7", len(uidBytes))
 	}
 
-	// Decode counter (big-endian in URL, little-endian for derivation)
-	ctrBytesBE, err := hex.DecodeString(ctr)
+	// Decode counter
+	ctrBytes, err := hex.DecodeString(ctr)
 	if err != nil {
-		return false, 0, "", fmt.Errorf("CTR hex decode: %v", err)
+		return nil, 0, fmt.Errorf("CTR hex decode: %v", err)
 	}
-	if len(ctrBytesBE) != 3 {
-		return false, 0, "", fmt.Errorf("CTR length: got %d bytes, want 3", len(ctrBytesBE))
+	if len(ctrBytes) != 3 {
+		return nil, 0, fmt.Errorf("CTR length: got %d bytes, want 3", len(ctrBytes))
 	}
-	ctrBytesLE := []byte{ctrBytesBE[2], ctrBytesBE[1], ctrBytesBE[0]}
-	counter = uint32(ctrBytesBE[0])<<16 | uint32(ctrBytesBE[1])<<8 | uint32(ctrBytesBE[2])
+	if ctrLSBFirst {
+		return uidBytes, readU24le(ctrBytes, 0), nil
+	}
+	return uidBytes, uint32(ctrBytes[0])<<16 | uint32(ctrBytes[1])<<8 | uint32(ctrBytes[2]), nil
+}
 
-	// Derive SDM session key
-	sessionKey, err := DeriveSDMSessionKey(sdmFileKey, uidBytes, ctrBytesLE)
+// computeSDMMAC derives the SDM session key for uid and counter and returns
+// the truncated CMAC over macInput.
+func computeSDMMAC(baseKey *cmacKey, uid []byte, counter uint32, macInput []byte) ([]byte, error) {
+	sessionKey, err := deriveSDMSessionKey(baseKey, uid, u24le(counter))
 	if err != nil {
-		return false, counter, "", fmt.Errorf("session key derive: %v", err)
+		return nil, fmt.Errorf("session key derive: %v", err)
 	}
-
-	// Compute CMAC over MAC input
-	macInput := fmt.Sprintf("uid=%s&ctr=%s&mac=", uid, ctr)
-	cmac, err := aesCMAC(sessionKey, []byte(macInput))
+	cmac, err := AESCMAC(sessionKey, macInput)
 	if err != nil {
-		return false, counter, "", fmt.Errorf("CMAC error: %v", err)
+		return nil, fmt.Errorf("CMAC error: %v", err)
 	}
-	computed := truncateOddBytes(cmac)
-	computedMAC = strings.ToUpper(hex.EncodeToString(computed))
+	return TruncateOddBytes(cmac), nil
+}
 
-	// Decode expected MAC
-	expectedBytes, err := hex.DecodeString(mac)
-	if err != nil || len(expectedBytes) != 8 {
-		return false, counter, computedMAC, fmt.Errorf("MAC decode error")
+// compareSDMMAC reports whether computed matches the 16-char mac hex string.
+func compareSDMMAC(computed []byte, mac string) (bool, error) {
+	expected, err := hex.DecodeString(mac)
+	if err != nil || len(expected) != 8 {
+		return false, fmt.Errorf("MAC decode error")
 	}
-
-	// Compare
-	match = bytes.Equal(computed, expectedBytes)
-	return match, counter, computedMAC, nil
+	return bytes.Equal(computed, expected), nil
 }
 
 // GenerateSDMURL generates an SDM URL by simulating what the NTAG 424 DNA tag does on tap.
@@ -217,65 +570,96 @@ func VerifySDMMACDetailed(rawURL string, sdmFileKey []byte) (match bool, counter
 //  3. Encodes counter as 3-byte big-endian uppercase hex (6 chars)
 //  4. Derives SDM session key
 //  5. Computes CMAC over "uid=<UID>&ctr=<CTR>&mac="
+//     (GenerateSDMURLWithConfig with SDMEncodingBinary MACs the raw bytes)
 //  6. Truncates CMAC to 8 bytes (odd bytes only)
-//  7. Builds final URL preserving any existing query parameters
+//  7. Builds the final URL with uid, ctr, mac first, in that order and
+//     unescaped as the tag mirrors them, followed by any existing query
+//     parameters
 func GenerateSDMURL(baseURL string, uid []byte, counter uint32, sdmFileKey []byte) (string, error) {
+	return GenerateSDMURLWithConfig(baseURL, uid, counter, sdmFileKey, DefaultSDMParamConfig())
+}
+
+// GenerateSDMURLWithConfig generates an SDM URL using the parameter names and
+// MAC input template from cfg. See GenerateSDMURL for the tap simulation steps.
+func GenerateSDMURLWithConfig(baseURL string, uid []byte, counter uint32, sdmFileKey []byte, cfg SDMParamConfig) (string, error) {
+	g, err := NewSDMURLGenerator(baseURL, uid, sdmFileKey, cfg)
+	if err != nil {
+		return "", err
+	}
+	return g.Generate(counter)
+}
+
+// SDMURLGenerator generates SDM URLs for one tag at many counter values.
+// The base URL, UID encoding, AES key schedule and CMAC subkeys are prepared
+// once, so generating a counter range only pays for the per-counter session
+// key derivation and MAC.
+type SDMURLGenerator struct {
+	base    *url.URL
+	uid     []byte
+	uidHex  string
+	baseKey *cmacKey
+	cfg     SDMParamConfig
+}
+
+// NewSDMURLGenerator validates the inputs shared by every URL for this tag.
+func NewSDMURLGenerator(baseURL string, uid, sdmFileKey []byte, cfg SDMParamConfig) (*SDMURLGenerator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	// Validate inputs
 	if len(uid) != 7 {
-		return "", fmt.Errorf("UID must be 7 bytes, got %d", len(uid))
+		return nil, fmt.Errorf("UID must be 7 bytes, got %d", len(uid))
 	}
 	if len(sdmFileKey) != 16 {
-		return "", fmt.Errorf("SDM file key must be 16 bytes, got %d", len(sdmFileKey))
+		return nil, fmt.Errorf("SDM file key must be 16 bytes, got %d", len(sdmFileKey))
 	}
-	if counter > 0xFFFFFF {
-		return "", fmt.Errorf("counter must be <= 0xFFFFFF, got %d", counter)
+	baseKey, err := newSDMBaseKey(sdmFileKey)
+	if err != nil {
+		return nil, err
 	}
 
-	// Encode UID as uppercase hex (14 chars)
-	uidHex := strings.ToUpper(hex.EncodeToString(uid))
-
-	// Encode counter as 3-byte big-endian uppercase hex (6 chars)
-	ctrBytesBE := []byte{
-		byte((counter >> 16) & 0xFF),
-		byte((counter >> 8) & 0xFF),
-		byte(counter & 0xFF),
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %v", err)
 	}
-	ctrHex := strings.ToUpper(hex.EncodeToString(ctrBytesBE))
 
-	// Convert counter to little-endian for SDM key derivation
-	ctrBytesLE := []byte{ctrBytesBE[2], ctrBytesBE[1], ctrBytesBE[0]}
+	return &SDMURLGenerator{
+		base:    parsedURL,
+		uid:     append([]byte(nil), uid...),
+		uidHex:  strings.ToUpper(hex.EncodeToString(uid)), // 14 uppercase hex chars
+		baseKey: baseKey,
+		cfg:     cfg,
+	}, nil
+}
 
-	// Derive SDM session key
-	sessionKey, err := DeriveSDMSessionKey(sdmFileKey, uid, ctrBytesLE)
-	if err != nil {
-		return "", fmt.Errorf("session key derive: %v", err)
+// Generate returns the URL the tag would produce at the given read counter.
+func (g *SDMURLGenerator) Generate(counter uint32) (string, error) {
+	if counter > 0xFFFFFF {
+		return "", fmt.Errorf("counter must be <= 0xFFFFFF, got %d", counter)
 	}
 
-	// Build MAC input string
-	macInput := fmt.Sprintf("uid=%s&ctr=%s&mac=", uidHex, ctrHex)
+	// Encode counter as 6 uppercase hex chars (byte order per encoding)
+	ctrHex := g.cfg.ctrHex(counter)
 
-	// Compute CMAC
-	cmac, err := aesCMAC(sessionKey, []byte(macInput))
+	// Derive the session key and MAC the bytes the tag would mirror
+	truncated, err := computeSDMMAC(g.baseKey, g.uid, counter, g.cfg.tapMACInput(g.uid, counter))
 	if err != nil {
-		return "", fmt.Errorf("CMAC error: %v", err)
+		return "", err
 	}
-
-	// Truncate to 8 bytes (odd bytes only)
-	truncated := truncateOddBytes(cmac)
 	macHex := strings.ToUpper(hex.EncodeToString(truncated))
 
-	// Build final URL with query parameters
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		return "", fmt.Errorf("invalid base URL: %v", err)
+	// Keep the tag's parameter order: the SDM block leads the query as raw
+	// hex (url.Values.Encode() sorts alphabetically), other params follow.
+	u := *g.base
+	q := u.Query()
+	for _, key := range []string{g.cfg.UIDParam, g.cfg.CtrParam, g.cfg.MACParam} {
+		q.Del(key)
+	}
+	u.RawQuery = g.cfg.UIDParam + "=" + g.uidHex + "&" + g.cfg.CtrParam + "=" + ctrHex + "&" + g.cfg.MACParam + "=" + macHex
+	if rest := q.Encode(); rest != "" {
+		u.RawQuery += "&" + rest
 	}
 
-	// Preserve existing query parameters and add SDM params
-	q := parsedURL.Query()
-	q.Set("uid", uidHex)
-	q.Set("ctr", ctrHex)
-	q.Set("mac", macHex)
-	parsedURL.RawQuery = q.Encode()
-
-	return parsedURL.String(), nil
+	return u.String(), nil
 }
@@ -0,0 +1,454 @@
+package ntag424
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var (
+	testSDMKey = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	testUID    = []byte{0x04, 0x1E, 0x3C, 0x5A, 0x7B, 0x6F, 0x80}
+)
+
+func TestGenerateAndVerifySDMURLWithCustomParams(t *testing.T) {
+	cfg := SDMParamConfig{UIDParam: "picc", CtrParam: "ctr", MACParam: "cmac"}
+
+	rawURL, err := GenerateSDMURLWithConfig("https://example.com/tap?hat=42", testUID, 0x00002A, testSDMKey, cfg)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLWithConfig returned error: %v", err)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse generated URL: %v", err)
+	}
+	q := u.Query()
+	if got := q.Get("picc"); got != "041E3C5A7B6F80" {
+		t.Fatalf("expected picc=041E3C5A7B6F80, got %q", got)
+	}
+	if got := q.Get("ctr"); got != "00002A" {
+		t.Fatalf("expected ctr=00002A, got %q", got)
+	}
+	if q.Get("cmac") == "" || q.Get("uid") != "" || q.Get("mac") != "" {
+		t.Fatalf("expected only picc/ctr/cmac SDM params, got %q", u.RawQuery)
+	}
+	if got := q.Get("hat"); got != "42" {
+		t.Fatalf("expected existing hat param preserved, got %q", got)
+	}
+
+	ok, err := VerifySDMMACWithConfig(rawURL, testSDMKey, cfg)
+	if err != nil {
+		t.Fatalf("VerifySDMMACWithConfig returned error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected MAC to verify for %s", rawURL)
+	}
+
+	if _, err := VerifySDMMAC(rawURL, testSDMKey); err == nil {
+		t.Fatalf("expected default VerifySDMMAC to reject picc/cmac URL")
+	}
+}
+
+func TestVerifySDMMACWithConfigRejectsWrongTemplate(t *testing.T) {
+	cfg := SDMParamConfig{UIDParam: "picc", CtrParam: "ctr", MACParam: "cmac"}
+	rawURL, err := GenerateSDMURLWithConfig("https://example.com/tap", testUID, 7, testSDMKey, cfg)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLWithConfig returned error: %v", err)
+	}
+
+	// Same parameter names, but the MAC input claims a different layout.
+	wrong := cfg
+	wrong.MACInputTemplate = "ctr={ctr}&picc={uid}&cmac="
+	ok, err := VerifySDMMACWithConfig(rawURL, testSDMKey, wrong)
+	if err != nil {
+		t.Fatalf("VerifySDMMACWithConfig returned error: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected MAC mismatch when template does not match generator")
+	}
+}
+
+func TestGenerateSDMURLDefaultMatchesDefaultConfig(t *testing.T) {
+	a, err := GenerateSDMURL("https://example.com/tap", testUID, 1, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	b, err := GenerateSDMURLWithConfig("https://example.com/tap", testUID, 1, testSDMKey, DefaultSDMParamConfig())
+	if err != nil {
+		t.Fatalf("GenerateSDMURLWithConfig returned error: %v", err)
+	}
+	if a != b {
+		t.Fatalf("expected identical URLs, got %q and %q", a, b)
+	}
+	ok, err := VerifySDMMAC(a, testSDMKey)
+	if err != nil || !ok {
+		t.Fatalf("expected default URL to verify, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestBuildSDMNDEFWithConfigMACInputMatchesTemplate(t *testing.T) {
+	cases := []SDMParamConfig{
+		DefaultSDMParamConfig(),
+		{UIDParam: "picc", CtrParam: "ctr", MACParam: "cmac"},
+		{UIDParam: "picc", CtrParam: "n", MACParam: "cmac", MACInputTemplate: "n={ctr}&picc={uid}&cmac="},
+	}
+	for _, cfg := range cases {
+		sdm, err := BuildSDMNDEFWithConfig("https://example.com/tap", cfg)
+		if err != nil {
+			t.Fatalf("BuildSDMNDEFWithConfig(%+v) returned error: %v", cfg, err)
+		}
+
+		want := cfg.macInput(strings.Repeat("0", sdmUIDLenASCII), strings.Repeat("0", sdmCtrLenASCII))
+		got := sdm.NDEF[sdm.MacInputOffset:sdm.MacOffset]
+		if !bytes.Equal(got, []byte(want)) {
+			t.Fatalf("expected MAC input %q between offsets, got %q", want, got)
+		}
+		if got := string(sdm.NDEF[sdm.UIDOffset-uint32(len(cfg.UIDParam)+1) : sdm.UIDOffset]); got != cfg.UIDParam+"=" {
+			t.Fatalf("expected UID offset after %q, got %q", cfg.UIDParam+"=", got)
+		}
+		if got := string(sdm.NDEF[sdm.CtrOffset-uint32(len(cfg.CtrParam)+1) : sdm.CtrOffset]); got != cfg.CtrParam+"=" {
+			t.Fatalf("expected counter offset after %q, got %q", cfg.CtrParam+"=", got)
+		}
+	}
+}
+
+func TestBuildSDMNDEFWithConfigRejectsBadTemplate(t *testing.T) {
+	cases := []SDMParamConfig{
+		{UIDParam: "uid", CtrParam: "uid", MACParam: "mac"},
+		{UIDParam: "uid", CtrParam: "ctr", MACParam: "mac", MACInputTemplate: "uid={uid}&mac="},
+		{UIDParam: "uid", CtrParam: "ctr", MACParam: "mac", MACInputTemplate: "uid={uid}&ctr={ctr}&sig="},
+	}
+	for _, cfg := range cases {
+		if _, err := BuildSDMNDEFWithConfig("https://example.com/tap", cfg); err == nil {
+			t.Fatalf("expected error for config %+v", cfg)
+		}
+	}
+}
+
+func TestVerifySDMMACBatch(t *testing.T) {
+	good, err := GenerateSDMURL("https://example.com/tap", testUID, 0x000102, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	otherKey := bytes.Repeat([]byte{0x42}, 16)
+	forged, err := GenerateSDMURL("https://example.com/tap", testUID, 5, otherKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	urls := []string{good, forged, "https://example.com/tap?uid=04"}
+
+	results, err := VerifySDMMACBatch(urls, testSDMKey)
+	if err != nil {
+		t.Fatalf("VerifySDMMACBatch returned error: %v", err)
+	}
+	if len(results) != len(urls) {
+		t.Fatalf("expected %d results, got %d", len(urls), len(results))
+	}
+	if !results[0].Match || results[0].Counter != 0x000102 || results[0].Err != nil {
+		t.Fatalf("expected first URL to match with counter 0x000102, got %+v", results[0])
+	}
+	if results[1].Match || results[1].Counter != 5 || results[1].Err != nil {
+		t.Fatalf("expected forged URL to mismatch without error, got %+v", results[1])
+	}
+	if results[2].Err == nil || results[2].URL != urls[2] {
+		t.Fatalf("expected per-URL error for malformed URL, got %+v", results[2])
+	}
+
+	for i, u := range urls[:2] {
+		ok, err := VerifySDMMAC(u, testSDMKey)
+		if err != nil || ok != results[i].Match {
+			t.Fatalf("batch result %d disagrees with VerifySDMMAC: ok=%v err=%v", i, ok, err)
+		}
+	}
+
+	if _, err := VerifySDMMACBatch(urls, testSDMKey[:8]); err == nil {
+		t.Fatalf("expected error for short key")
+	}
+}
+
+func benchmarkSDMURLs(b *testing.B, n int) []string {
+	b.Helper()
+	urls := make([]string, n)
+	for i := range urls {
+		u, err := GenerateSDMURL("https://example.com/tap", testUID, uint32(i), testSDMKey)
+		if err != nil {
+			b.Fatalf("GenerateSDMURL returned error: %v", err)
+		}
+		urls[i] = u
+	}
+	return urls
+}
+
+func BenchmarkVerifySDMMACLoop(b *testing.B) {
+	urls := benchmarkSDMURLs(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, u := range urls {
+			if _, err := VerifySDMMAC(u, testSDMKey); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkVerifySDMMACBatch(b *testing.B) {
+	urls := benchmarkSDMURLs(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifySDMMACBatch(urls, testSDMKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSDMURLGeneratorMatchesGenerateSDMURL(t *testing.T) {
+	g, err := NewSDMURLGenerator("https://example.com/tap?hat=42", testUID, testSDMKey, DefaultSDMParamConfig())
+	if err != nil {
+		t.Fatalf("NewSDMURLGenerator returned error: %v", err)
+	}
+	for _, ctr := range []uint32{0, 1, 0x00FFFF, 0xFFFFFF} {
+		got, err := g.Generate(ctr)
+		if err != nil {
+			t.Fatalf("Generate(%d) returned error: %v", ctr, err)
+		}
+		want, err := GenerateSDMURL("https://example.com/tap?hat=42", testUID, ctr, testSDMKey)
+		if err != nil {
+			t.Fatalf("GenerateSDMURL returned error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("counter %d: expected %q, got %q", ctr, want, got)
+		}
+	}
+	if _, err := g.Generate(0x1000000); err == nil {
+		t.Fatalf("expected error for counter above 0xFFFFFF")
+	}
+}
+
+func TestDeriveSDMSessionKeyWithLabelVectors(t *testing.T) {
+	zeroKey := make([]byte, 16)
+	tests := []struct {
+		name  string
+		label []byte
+		uid   string
+		ctr   string
+		want  string
+	}{
+		// AN12196 SDM MAC example: SesSDMFileReadMACKey
+		{"mac", SDMMACLabel, "04DE5F1EACC040", "3D0000", "3FB5F6E3A807A03D5E3570ACE393776F"},
+		{"enc", SDMENCLabel, "04DE5F1EACC040", "3D0000", "DF38382B84FB90D2DDDB24E51AAFF7AC"},
+		{"enc other tag", SDMENCLabel, "04958CAA5C5E80", "010000", "8097D73344D53F963B09E23E03B62336"},
+	}
+	for _, tt := range tests {
+		got, err := DeriveSDMSessionKeyWithLabel(zeroKey, mustHex(t, tt.uid), mustHex(t, tt.ctr), tt.label)
+		if err != nil {
+			t.Fatalf("%s: DeriveSDMSessionKeyWithLabel returned error: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, mustHex(t, tt.want)) {
+			t.Fatalf("%s: expected %s, got %X", tt.name, tt.want, got)
+		}
+	}
+
+	mac, err := DeriveSDMSessionKey(zeroKey, mustHex(t, "04DE5F1EACC040"), mustHex(t, "3D0000"))
+	if err != nil || !bytes.Equal(mac, mustHex(t, tests[0].want)) {
+		t.Fatalf("expected DeriveSDMSessionKey to use SDMMACLabel, got %X, %v", mac, err)
+	}
+	if _, err := DeriveSDMSessionKeyWithLabel(zeroKey, mustHex(t, "04DE5F1EACC040"), mustHex(t, "3D0000"), nil); err == nil {
+		t.Fatalf("expected error for empty label")
+	}
+}
+
+func TestVerifySDMMACFromRaw(t *testing.T) {
+	rawURL, err := GenerateSDMURL("https://example.com/tap", testUID, 0x00002A, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	uid, ctr, mac, err := ParseSDMURL(rawURL)
+	if err != nil {
+		t.Fatalf("ParseSDMURL returned error: %v", err)
+	}
+	query := "uid=" + uid + "&ctr=" + ctr + "&mac=" + mac
+	rawURL = "https://example.com/tap?" + query
+	encoded := strings.NewReplacer("=", "%3D", "&", "%26").Replace(query)
+
+	for _, tc := range []struct {
+		name string
+		url  string
+	}{
+		{"plain", rawURL},
+		{"trailing param", rawURL + "&lang=en"},
+		{"leading params", "https://example.com/tap?ref=a%26b&" + query + "#top"},
+		{"percent-encoded span", "https://example.com/t%61p?" + encoded + "&lang=en"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := VerifySDMMACFromRaw(tc.url, testSDMKey)
+			if err != nil {
+				t.Fatalf("VerifySDMMACFromRaw returned error: %v", err)
+			}
+			if !ok {
+				t.Fatalf("expected MAC to verify for %s", tc.url)
+			}
+		})
+	}
+
+	tampered := strings.Replace(rawURL, "ctr=00002A", "ctr=00002B", 1)
+	if ok, err := VerifySDMMACFromRaw(tampered, testSDMKey); err != nil || ok {
+		t.Fatalf("expected tampered counter to fail verification, got ok=%v err=%v", ok, err)
+	}
+	if _, err := VerifySDMMACFromRaw("https://example.com/tap?ctr=00002A&uid=041E3C5A7B6F80&mac=0000000000000000", testSDMKey); err == nil {
+		t.Fatalf("expected error when uid/ctr/mac are not mirrored as one span")
+	}
+}
+
+func TestGenerateSDMURLParamOrder(t *testing.T) {
+	rawURL, err := GenerateSDMURL("https://example.com/tap?uid=stale&ref=a%2Fb", testUID, 0x00002A, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse generated URL: %v", err)
+	}
+
+	parts := strings.Split(u.RawQuery, "&")
+	if len(parts) != 4 {
+		t.Fatalf("expected uid, ctr, mac and ref params, got %q", u.RawQuery)
+	}
+	if parts[0] != "uid=041E3C5A7B6F80" || parts[1] != "ctr=00002A" {
+		t.Fatalf("expected uid then ctr as raw hex first, got %q", u.RawQuery)
+	}
+	mac, ok := strings.CutPrefix(parts[2], "mac=")
+	if !ok || len(mac) != 16 || strings.ToUpper(mac) != mac || strings.Contains(mac, "%") {
+		t.Fatalf("expected mac as 16 raw uppercase hex chars third, got %q", parts[2])
+	}
+	if parts[3] != "ref=a%2Fb" {
+		t.Fatalf("expected existing param escaped after the SDM block, got %q", parts[3])
+	}
+
+	// The literal query is what a server MACs, so it must verify as-is.
+	if ok, err := VerifySDMMACFromRaw(rawURL, testSDMKey); err != nil || !ok {
+		t.Fatalf("expected generated URL to verify from raw, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSDMEncodingVectors(t *testing.T) {
+	// AN12196 SUN MAC example: all-zero key, UID 04DE5F1EACC040, counter
+	// 3D0000 mirrored LSB first, empty MAC input.
+	zeroKey, err := newSDMBaseKey(make([]byte, 16))
+	if err != nil {
+		t.Fatalf("newSDMBaseKey returned error: %v", err)
+	}
+	if mac, err := computeSDMMAC(zeroKey, mustHex(t, "04DE5F1EACC040"), 0x3D, nil); err != nil || !bytes.Equal(mac, mustHex(t, "94EED9EE65337086")) {
+		t.Fatalf("expected AN12196 MAC 94EED9EE65337086, got %X, %v", mac, err)
+	}
+
+	// Same tag and tap in both encodings: the URL carries hex either way, but
+	// the binary mirror puts the counter LSB first and MACs the raw bytes
+	// "uid=" 04 1E 3C 5A 7B 6F 80 "&ctr=" 2A 01 00 "&mac=".
+	//
+	// MACs computed independently with openssl: the session key is
+	// AES-CMAC(testSDMKey, 3CC300010080 041E3C5A7B6F80 2A0100) =
+	// 977AAA58966BFA9479D6B7FD623C589B, and each MAC is the odd bytes of its
+	// CMAC over the MAC input (031AE920...DA2D ASCII, B04B858D...037A binary).
+	sessKey, err := DeriveSDMSessionKey(testSDMKey, testUID, []byte{0x2A, 0x01, 0x00})
+	if err != nil || !bytes.Equal(sessKey, mustHex(t, "977AAA58966BFA9479D6B7FD623C589B")) {
+		t.Fatalf("unexpected session key %X, %v", sessKey, err)
+	}
+	tests := []struct {
+		enc  SDMEncoding
+		want string
+	}{
+		{SDMEncodingASCII, "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00012A&mac=1A20128D9EA27F2D"},
+		{SDMEncodingBinary, "https://example.com/tap?uid=041E3C5A7B6F80&ctr=2A0100&mac=4B8D38AE033A407A"},
+	}
+	for _, tt := range tests {
+		cfg := DefaultSDMParamConfig()
+		cfg.Encoding = tt.enc
+		got, err := GenerateSDMURLWithConfig("https://example.com/tap", testUID, 0x00012A, testSDMKey, cfg)
+		if err != nil {
+			t.Fatalf("%v: GenerateSDMURLWithConfig returned error: %v", tt.enc, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%v: expected %s, got %s", tt.enc, tt.want, got)
+		}
+		ok, err := VerifySDMMACWithConfig(tt.want, testSDMKey, cfg)
+		if err != nil || !ok {
+			t.Fatalf("%v: expected vector to verify, got %v, %v", tt.enc, ok, err)
+		}
+	}
+
+	// Each URL fails under the other encoding.
+	if ok, _ := VerifySDMMAC(tests[1].want, testSDMKey); ok {
+		t.Fatal("expected binary-encoded URL to fail ASCII verification")
+	}
+	if ok, err := VerifySDMMAC(tests[0].want, testSDMKey); err != nil || !ok {
+		t.Fatalf("expected VerifySDMMAC to default to ASCII, got %v, %v", ok, err)
+	}
+
+	if SDMEncodingFromOptions(0xC1) != SDMEncodingASCII || SDMEncodingFromOptions(0xC0) != SDMEncodingBinary {
+		t.Fatal("expected SDMOptions bit 0 to select the encoding")
+	}
+	if SDMEncodingBinary.OptionBit() != 0x00 || SDMEncodingASCII.OptionBit() != 0x01 {
+		t.Fatal("unexpected OptionBit values")
+	}
+	if _, err := BuildSDMNDEFWithConfig("https://example.com/tap", SDMParamConfig{UIDParam: "uid", CtrParam: "ctr", MACParam: "mac", Encoding: SDMEncodingBinary}); err == nil {
+		t.Fatal("expected BuildSDMNDEFWithConfig to reject binary encoding")
+	}
+}
+
+func TestVerifySDMMACFields(t *testing.T) {
+	// Fields as a backend would receive them in a JSON body, e.g.
+	// {"uid":"041E3C5A7B6F80","ctr":"00012A","mac":"1A20128D9EA27F2D"}.
+	ok, err := VerifySDMMACFields("041E3C5A7B6F80", "00012A", "1A20128D9EA27F2D", testSDMKey)
+	if err != nil || !ok {
+		t.Fatalf("expected fields to verify, got %v, %v", ok, err)
+	}
+	if ok, err := VerifySDMMACFields("041E3C5A7B6F80", "00012B", "1A20128D9EA27F2D", testSDMKey); err != nil || ok {
+		t.Fatalf("expected a different counter not to verify, got %v, %v", ok, err)
+	}
+	if _, err := VerifySDMMACFields("041E3C5A7B6F", "00012A", "1A20128D9EA27F2D", testSDMKey); err == nil {
+		t.Fatal("expected error for a short uid")
+	}
+	if _, err := VerifySDMMACFields("041E3C5A7B6F80", "00012A", "1A20128D9EA27F2D", testSDMKey[:8]); err == nil {
+		t.Fatal("expected error for a short key")
+	}
+}
+
+func TestSDMCounterEndianness(t *testing.T) {
+	// One tap (counter 0x12A) with the ASCII counter mirrored MSB first and
+	// LSB first. The MAC covers the ctr text as it appears in each URL.
+	beURL := "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00012A&mac=1A20128D9EA27F2D"
+	leURL := "https://example.com/tap?uid=041E3C5A7B6F80&ctr=2A0100&mac=97A4E36E3BAA3C5A"
+	le := DefaultSDMParamConfig()
+	le.CounterEndianness = CounterLittleEndian
+
+	for _, tt := range []struct {
+		url string
+		cfg SDMParamConfig
+	}{
+		{beURL, DefaultSDMParamConfig()},
+		{leURL, le},
+	} {
+		match, counter, computed, err := VerifySDMMACDetailedWithConfig(tt.url, testSDMKey, tt.cfg)
+		if err != nil || !match || counter != 0x12A {
+			t.Fatalf("%v: expected match at counter 0x12A, got %v %X %s %v", tt.cfg.CounterEndianness, match, counter, computed, err)
+		}
+	}
+
+	// The wrong byte order parses fine and just fails the MAC check.
+	match, counter, _, err := VerifySDMMACDetailed(leURL, testSDMKey)
+	if err != nil || match || counter != 0x2A0100 {
+		t.Fatalf("expected silent mismatch at counter 0x2A0100, got %v %X %v", match, counter, err)
+	}
+
+	got, err := GenerateSDMURLWithConfig("https://example.com/tap", testUID, 0x12A, testSDMKey, le)
+	if err != nil || !strings.Contains(got, "ctr=2A0100&mac=97A4E36E3BAA3C5A") {
+		t.Fatalf("expected generated LE URL to match the vector, got %s, %v", got, err)
+	}
+
+	le.CounterEndianness = 7
+	if _, _, _, err := VerifySDMMACDetailedWithConfig(leURL, testSDMKey, le); err == nil {
+		t.Fatal("expected error for an unknown endianness")
+	}
+}
@@ -0,0 +1,116 @@
+package ntag424
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SDMTapCheck is the outcome of CheckSDMTap.
+type SDMTapCheck struct {
+	TapURL   string   // URL as the tag mirrored it into the NDEF read
+	UID      []byte   // Real UID from GetCardUID
+	Counter  uint32   // SDM read counter from GetFileCounters, after the read
+	Expected string   // GenerateSDMURL for UID and Counter
+	Problems []string // Why TapURL does not match Expected; empty when it does
+}
+
+// OK reports whether the tap URL verified.
+func (c *SDMTapCheck) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// CheckSDMTap proves a provisioned tag produces a verifiable SDM URL. It
+// reads the NDEF file the way a phone does, so the tag mirrors UID, counter
+// and MAC into the URL, then authenticates sdmKeyNo with sdmKey to fetch the
+// real UID (GetCardUID) and the read counter (GetFileCounters on fileNo).
+// The URL GenerateSDMURLWithConfig expects for that UID and counter is
+// compared with the tapped one, and the tapped URL must pass
+// VerifySDMMACWithConfig.
+//
+// sdmKey must be the SDM file read key, sdmKeyNo the file's SDMCtrRet slot
+// and fileNo the SDM file the phone reads, as sdmconfig provisions them;
+// cfg names the URL parameters and MAC input layout the file was built
+// with. The read increments the counter.
+//
+// A tag that answers but mirrors the wrong bytes is reported in Problems,
+// naming the offset or key most likely at fault; only failed exchanges are
+// returned as an error.
+func CheckSDMTap(card Card, sdmKey []byte, sdmKeyNo, fileNo byte, cfg SDMParamConfig) (*SDMTapCheck, error) {
+	if len(sdmKey) != 16 {
+		return nil, fmt.Errorf("SDM key must be 16 bytes, got %d", len(sdmKey))
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	msg, err := ReadNDEF(card)
+	if err != nil {
+		return nil, fmt.Errorf("read NDEF: %w", err)
+	}
+	records, err := ParseNDEFMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("parse NDEF: %w", err)
+	}
+	check := &SDMTapCheck{}
+	for _, rec := range records {
+		if u, err := DecodeURIRecord(rec); err == nil {
+			check.TapURL = u
+			break
+		}
+	}
+	if check.TapURL == "" {
+		return nil, fmt.Errorf("NDEF message has no URI record")
+	}
+
+	if err := SelectNDEFApp(card); err != nil {
+		return nil, fmt.Errorf("select NDEF app: %w", err)
+	}
+	sess, err := AuthenticateEV2First(card, sdmKey, sdmKeyNo)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate SDM key slot %d: %w", sdmKeyNo, err)
+	}
+	if check.UID, err = GetCardUID(card, sess); err != nil {
+		return nil, fmt.Errorf("get card UID: %w", err)
+	}
+	if check.Counter, err = GetFileCounters(card, sess, fileNo); err != nil {
+		return nil, fmt.Errorf("get SDM read counter: %w", err)
+	}
+
+	tapUID, tapCtr, _, err := ParseSDMURLWithConfig(check.TapURL, cfg)
+	if err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("tap URL: %v (check the SDM offsets)", err))
+		return check, nil
+	}
+	base, err := url.Parse(check.TapURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse tap URL: %w", err)
+	}
+	q := base.Query()
+	for _, key := range []string{cfg.UIDParam, cfg.CtrParam, cfg.MACParam} {
+		q.Del(key)
+	}
+	base.RawQuery = q.Encode()
+	if check.Expected, err = GenerateSDMURLWithConfig(base.String(), check.UID, check.Counter, sdmKey, cfg); err != nil {
+		return nil, err
+	}
+	wantUID, wantCtr, _, err := ParseSDMURLWithConfig(check.Expected, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(tapUID, wantUID) {
+		check.Problems = append(check.Problems, fmt.Sprintf("mirrored uid %s, GetCardUID returned %s (check UIDOffset)", tapUID, strings.ToUpper(hex.EncodeToString(check.UID))))
+	}
+	if !strings.EqualFold(tapCtr, wantCtr) {
+		check.Problems = append(check.Problems, fmt.Sprintf("mirrored ctr %s, GetFileCounters returned %s (check CtrOffset)", tapCtr, wantCtr))
+	}
+	ok, err := VerifySDMMACWithConfig(check.TapURL, sdmKey, cfg)
+	switch {
+	case err != nil:
+		check.Problems = append(check.Problems, fmt.Sprintf("verify MAC: %v", err))
+	case !ok:
+		check.Problems = append(check.Problems, "MAC does not verify with the SDM key (check the key and MACInputOffset/MACOffset)")
+	}
+	return check, nil
+}
@@ -0,0 +1,154 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var tapSDMKey = bytes.Repeat([]byte{0x11}, 16)
+
+// tappedNDEF returns NLEN and the message of sdm's NDEF file as a phone reads
+// it: UID and counter mirrored for testUID and ctr, and the MAC computed
+// with macKey.
+func tappedNDEF(t *testing.T, sdm *SDMNDEF, macKey []byte, ctr uint32) []byte {
+	t.Helper()
+	file := append([]byte{}, sdm.NDEF...)
+	copy(file[sdm.UIDOffset:], strings.ToUpper(hex.EncodeToString(testUID)))
+	copy(file[sdm.CtrOffset:], fmt.Sprintf("%06X", ctr))
+	baseKey, err := newSDMBaseKey(macKey)
+	if err != nil {
+		t.Fatalf("SDM base key: %v", err)
+	}
+	mac, err := computeSDMMAC(baseKey, testUID, ctr, file[sdm.MacInputOffset:sdm.MacOffset])
+	if err != nil {
+		t.Fatalf("SDM MAC: %v", err)
+	}
+	copy(file[sdm.MacOffset:], strings.ToUpper(hex.EncodeToString(mac)))
+	return file[:2+(int(file[0])<<8|int(file[1]))]
+}
+
+// sdmTapExchanges scripts CheckSDMTap with tapSDMKey in slot 1: the
+// phone-style read of ndef, then slot 1 authentication, GetCardUID and
+// GetFileCounters answering ctr.
+func sdmTapExchanges(t *testing.T, ndef []byte, ctr uint32) []FakeExchange {
+	t.Helper()
+	script := append(readNDEFExchanges(t, ndef), selectNDEFAppExchange)
+	auth, sess := authExchanges(t, 1, tapSDMKey, tapSDMKey)
+	script = append(script, auth...)
+	return append(script, ssmExchanges(t, *sess, CommModeFull, testUID, []byte{byte(ctr), byte(ctr >> 8), byte(ctr >> 16), 0x00, 0x00})...)
+}
+
+// counterFileNo returns the file GetFileCounters asked for, the last command
+// CheckSDMTap sends.
+func counterFileNo(t *testing.T, card *FakeCard) byte {
+	t.Helper()
+	apdu := card.Sent[len(card.Sent)-1]
+	if apdu[1] != 0xF6 {
+		t.Fatalf("expected GetFileCounters last, got % X", apdu)
+	}
+	return apdu[5]
+}
+
+func TestCheckSDMTap(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	sdm, err := BuildSDMNDEF("https://example.com/tap?hat=42")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	card := NewFakeCard(sdmTapExchanges(t, tappedNDEF(t, sdm, tapSDMKey, 0x2A), 0x2A)...)
+
+	check, err := CheckSDMTap(card, tapSDMKey, 1, 2, DefaultSDMParamConfig())
+	if err != nil {
+		t.Fatalf("CheckSDMTap returned error: %v", err)
+	}
+	if !check.OK() {
+		t.Fatalf("expected tap to verify, got problems %v", check.Problems)
+	}
+	if check.Counter != 0x00002A || !bytes.Equal(check.UID, testUID) {
+		t.Fatalf("expected UID % X counter 0x2A, got % X counter 0x%X", testUID, check.UID, check.Counter)
+	}
+	want, _ := GenerateSDMURL("https://example.com/tap?hat=42", testUID, 0x00002A, tapSDMKey)
+	if check.Expected != want || check.TapURL != want {
+		t.Fatalf("expected tap and generated URL %s, got tap %s generated %s", want, check.TapURL, check.Expected)
+	}
+	// One authentication, on the SDM key slot.
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSDMTapUsesFileAndParamConfig(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	cfg := SDMParamConfig{UIDParam: "u", CtrParam: "c", MACParam: "m"}
+	sdm, err := BuildSDMNDEFWithConfig("https://example.com/tap", cfg)
+	if err != nil {
+		t.Fatalf("BuildSDMNDEFWithConfig returned error: %v", err)
+	}
+	card := NewFakeCard(sdmTapExchanges(t, tappedNDEF(t, sdm, tapSDMKey, 0x2A), 0x2A)...)
+
+	check, err := CheckSDMTap(card, tapSDMKey, 1, 2, cfg)
+	if err != nil {
+		t.Fatalf("CheckSDMTap returned error: %v", err)
+	}
+	if !check.OK() {
+		t.Fatalf("expected tap to verify with u/c/m parameters, got problems %v", check.Problems)
+	}
+	if !strings.Contains(check.TapURL, "?u=") || check.Expected != check.TapURL {
+		t.Fatalf("expected matching u/c/m URLs, got tap %s generated %s", check.TapURL, check.Expected)
+	}
+	if fileNo := counterFileNo(t, card); fileNo != 2 {
+		t.Fatalf("expected GetFileCounters on file 2, got %d", fileNo)
+	}
+
+	// The default uid/ctr/mac names do not find the u/c/m parameters, and the
+	// counter comes from the file passed in.
+	card = NewFakeCard(sdmTapExchanges(t, tappedNDEF(t, sdm, tapSDMKey, 0x2B), 0x2B)...)
+	check, err = CheckSDMTap(card, tapSDMKey, 1, 3, DefaultSDMParamConfig())
+	if err != nil {
+		t.Fatalf("CheckSDMTap returned error: %v", err)
+	}
+	if check.OK() {
+		t.Fatal("expected the default parameter names to fail on a u/c/m URL")
+	}
+	if fileNo := counterFileNo(t, card); fileNo != 3 {
+		t.Fatalf("expected GetFileCounters on file 3, got %d", fileNo)
+	}
+}
+
+func TestCheckSDMTapReportsMismatch(t *testing.T) {
+	t.Setenv("NTAG_RNDA", fakeRndA)
+	sdm, err := BuildSDMNDEF("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		ndef := tappedNDEF(t, sdm, bytes.Repeat([]byte{0x99}, 16), 0x2A)
+		card := NewFakeCard(sdmTapExchanges(t, ndef, 0x2A)...)
+
+		check, err := CheckSDMTap(card, tapSDMKey, 1, 2, DefaultSDMParamConfig())
+		if err != nil {
+			t.Fatalf("CheckSDMTap returned error: %v", err)
+		}
+		if check.OK() || len(check.Problems) != 1 || !strings.Contains(check.Problems[0], "MAC does not verify") {
+			t.Fatalf("expected only a MAC problem, got %v", check.Problems)
+		}
+	})
+
+	t.Run("shifted counter", func(t *testing.T) {
+		shifted := *sdm
+		shifted.CtrOffset++ // tag mirrors over the '&' before mac=
+		card := NewFakeCard(sdmTapExchanges(t, tappedNDEF(t, &shifted, tapSDMKey, 0x2A), 0x2A)...)
+
+		check, err := CheckSDMTap(card, tapSDMKey, 1, 2, DefaultSDMParamConfig())
+		if err != nil {
+			t.Fatalf("CheckSDMTap returned error: %v", err)
+		}
+		if check.OK() || !strings.Contains(strings.Join(check.Problems, "; "), "check the SDM offsets") {
+			t.Fatalf("expected an SDM offset problem, got %v", check.Problems)
+		}
+	})
+}
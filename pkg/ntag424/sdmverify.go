@@ -0,0 +1,102 @@
+package ntag424
+
+// Reasons reported in SDMResult.Reason.
+const (
+	SDMReasonOK            = "ok"               // MAC verified and the counter is acceptable
+	SDMReasonMalformedURL  = "malformed_url"    // URL or uid/ctr/mac parameters missing or not hex of the right length
+	SDMReasonMACMismatch   = "mac_mismatch"     // Well-formed, but the MAC does not verify; likely the wrong key
+	SDMReasonCounterReplay = "counter_replayed" // MAC verifies, but the counter is not above the last-seen or tracked watermark
+	SDMReasonInvalidKey    = "invalid_key"      // The verifier's key is not a 16-byte AES key; the URL was not checked
+	SDMReasonInvalidConfig = "invalid_config"   // The WithSDMParamConfig layout is invalid; the URL was not checked
+)
+
+// SDMResult is the outcome of VerifySDM. UID and Counter are set once the
+// parameters decode, even when the MAC does not verify, so a handler can
+// log which tag a rejected tap claims to be from.
+type SDMResult struct {
+	Valid   bool
+	Counter uint32
+	Reason  string // One of the SDMReason constants
+	UID     []byte
+}
+
+// SDMOption configures VerifySDM.
+type SDMOption func(*sdmVerifyOptions)
+
+type sdmVerifyOptions struct {
+	cfg      SDMParamConfig
+	lastSeen uint32
+	haveLast bool
+	tracker  *CounterTracker
+}
+
+// WithSDMParamConfig verifies URLs laid out as cfg describes instead of the
+// default uid/ctr/mac layout.
+func WithSDMParamConfig(cfg SDMParamConfig) SDMOption {
+	return func(o *sdmVerifyOptions) { o.cfg = cfg }
+}
+
+// WithLastSeenCounter rejects a tap whose counter is not above last, the
+// highest counter already accepted for the tag. The tag increments its
+// counter on every read, so an equal or lower counter is a replayed URL.
+func WithLastSeenCounter(last uint32) SDMOption {
+	return func(o *sdmVerifyOptions) { o.lastSeen, o.haveLast = last, true }
+}
+
+// WithCounterTracker checks every tap whose MAC verifies against t, which
+// rejects counters at or below the tag's last accepted one and otherwise
+// records the new counter. Forged taps never reach t.
+func WithCounterTracker(t *CounterTracker) SDMOption {
+	return func(o *sdmVerifyOptions) { o.tracker = t }
+}
+
+// VerifySDM verifies an SDM URL and reports the outcome as an SDMResult, so
+// server handlers can switch on Reason instead of telling errors apart.
+// Invalid URLs, wrong MACs and replays are results, not errors.
+//
+// key must be the 16-byte SDM file read key and any WithSDMParamConfig
+// config valid. Otherwise the result is SDMReasonInvalidKey or
+// SDMReasonInvalidConfig: a server misconfiguration, not a property of the
+// tap, so a handler should report it rather than reject the tag.
+func VerifySDM(rawURL string, key []byte, opts ...SDMOption) SDMResult {
+	o := sdmVerifyOptions{cfg: DefaultSDMParamConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.cfg.validate(); err != nil {
+		return SDMResult{Reason: SDMReasonInvalidConfig}
+	}
+	baseKey, err := newSDMBaseKey(key)
+	if err != nil {
+		return SDMResult{Reason: SDMReasonInvalidKey}
+	}
+
+	uid, ctr, mac, err := ParseSDMURLWithConfig(rawURL, o.cfg)
+	if err != nil {
+		return SDMResult{Reason: SDMReasonMalformedURL}
+	}
+	uidBytes, counter, err := decodeSDMParams(uid, ctr, mac, o.cfg.counterLSBFirst())
+	if err != nil {
+		return SDMResult{Reason: SDMReasonMalformedURL}
+	}
+	res := SDMResult{Counter: counter, UID: uidBytes}
+	computed, err := computeSDMMAC(baseKey, uidBytes, counter, o.cfg.tapMACInput(uidBytes, counter))
+	if err != nil {
+		res.Reason = SDMReasonInvalidKey
+		return res
+	}
+	match, err := compareSDMMAC(computed, mac)
+	switch {
+	case err != nil:
+		res.Reason = SDMReasonMalformedURL
+	case !match:
+		res.Reason = SDMReasonMACMismatch
+	case o.haveLast && counter <= o.lastSeen:
+		res.Reason = SDMReasonCounterReplay
+	case o.tracker != nil && !o.tracker.Check(uidBytes, counter):
+		res.Reason = SDMReasonCounterReplay
+	default:
+		res.Valid, res.Reason = true, SDMReasonOK
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package ntag424
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVerifySDMReasons(t *testing.T) {
+	good, err := GenerateSDMURL("https://example.com/tap", testUID, 0x00002A, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	forged, err := GenerateSDMURL("https://example.com/tap", testUID, 0x00002A, bytes.Repeat([]byte{0x99}, 16))
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		opts    []SDMOption
+		reason  string
+		counter uint32
+		hasUID  bool
+	}{
+		{"ok", good, nil, SDMReasonOK, 0x2A, true},
+		{"ok above watermark", good, []SDMOption{WithLastSeenCounter(0x29)}, SDMReasonOK, 0x2A, true},
+		{"wrong key", forged, nil, SDMReasonMACMismatch, 0x2A, true},
+		{"replayed", good, []SDMOption{WithLastSeenCounter(0x2A)}, SDMReasonCounterReplay, 0x2A, true},
+		{"older counter", good, []SDMOption{WithLastSeenCounter(0x100)}, SDMReasonCounterReplay, 0x2A, true},
+		{"missing mac", "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00002A", nil, SDMReasonMalformedURL, 0, false},
+		{"short uid", strings.Replace(good, "uid=041E3C5A7B6F80", "uid=041E3C", 1), nil, SDMReasonMalformedURL, 0, false},
+		{"non-hex mac", good[:len(good)-1] + "Z", nil, SDMReasonMalformedURL, 0x2A, true},
+		{"bad URL", "http://[::1", nil, SDMReasonMalformedURL, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := VerifySDM(tt.url, testSDMKey, tt.opts...)
+			if res.Reason != tt.reason || res.Valid != (tt.reason == SDMReasonOK) {
+				t.Fatalf("expected reason %s, got %+v", tt.reason, res)
+			}
+			if res.Counter != tt.counter {
+				t.Fatalf("expected counter 0x%X, got 0x%X", tt.counter, res.Counter)
+			}
+			if tt.hasUID != bytes.Equal(res.UID, testUID) {
+				t.Fatalf("expected UID set=%v, got % X", tt.hasUID, res.UID)
+			}
+		})
+	}
+}
+
+func TestVerifySDMWithParamConfig(t *testing.T) {
+	cfg := SDMParamConfig{UIDParam: "picc", CtrParam: "ctr", MACParam: "cmac"}
+	rawURL, err := GenerateSDMURLWithConfig("https://example.com/tap", testUID, 7, testSDMKey, cfg)
+	if err != nil {
+		t.Fatalf("GenerateSDMURLWithConfig returned error: %v", err)
+	}
+	if res := VerifySDM(rawURL, testSDMKey, WithSDMParamConfig(cfg)); !res.Valid {
+		t.Fatalf("expected custom-layout URL to verify, got %+v", res)
+	}
+	if res := VerifySDM(rawURL, testSDMKey); res.Reason != SDMReasonMalformedURL {
+		t.Fatalf("expected default layout to find no uid/ctr/mac, got %+v", res)
+	}
+}
+
+func TestVerifySDMReportsBadKeyAndConfig(t *testing.T) {
+	good, err := GenerateSDMURL("https://example.com/tap", testUID, 0x2A, testSDMKey)
+	if err != nil {
+		t.Fatalf("GenerateSDMURL returned error: %v", err)
+	}
+	if res := VerifySDM(good, testSDMKey[:15]); res.Reason != SDMReasonInvalidKey || res.Valid {
+		t.Fatalf("expected %s for a 15-byte key, got %+v", SDMReasonInvalidKey, res)
+	}
+	bad := SDMParamConfig{UIDParam: "uid", CtrParam: "uid", MACParam: "mac"}
+	if res := VerifySDM(good, testSDMKey, WithSDMParamConfig(bad)); res.Reason != SDMReasonInvalidConfig || res.Valid {
+		t.Fatalf("expected %s for duplicate parameter names, got %+v", SDMReasonInvalidConfig, res)
+	}
+}
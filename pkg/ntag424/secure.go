@@ -9,6 +9,16 @@ import (
 	"strings"
 )
 
+// Secure messaging errors, matched with errors.Is.
+var (
+	// ErrNoSession is returned by commands that need an authenticated
+	// session when given a nil one.
+	ErrNoSession = errors.New("session is nil")
+	// ErrResponseMAC is returned when a response MAC does not verify: the
+	// session is out of sync with the tag, or the response was tampered with.
+	ErrResponseMAC = errors.New("response MAC mismatch")
+)
+
 // BuildSsmApdu constructs a secure messaging APDU for DESFire commands.
 // It encrypts the command data, computes the MAC, and assembles the final APDU.
 //
@@ -26,7 +36,7 @@ import (
 //   - err: Error if any
 func BuildSsmApdu(sess *Session, cmd byte, header, data []byte) (apdu, macInput, encData, mact []byte, err error) {
 	if sess == nil {
-		return nil, nil, nil, nil, errors.New("session is nil")
+		return nil, nil, nil, nil, ErrNoSession
 	}
 
 	// Generate IV for command encryption: ECB-encrypt(Kenc, A5 5A TI(4) CmdCtr(2) 00..00)
@@ -43,7 +53,7 @@ func BuildSsmApdu(sess *Session, cmd byte, header, data []byte) (apdu, macInput,
 
 	// Encrypt command data (if any) with IV_C
 	if len(data) > 0 {
-		padded := padISO9797M2(data)
+		padded := PadISO9797M2(data)
 		encData, err = aesCBCEncrypt(sess.kenc[:], ivc, padded)
 		if err != nil {
 			return nil, nil, nil, nil, err
@@ -60,11 +70,11 @@ func BuildSsmApdu(sess *Session, cmd byte, header, data []byte) (apdu, macInput,
 	macInput = append(macInput, header...)
 	macInput = append(macInput, encData...)
 
-	cmac, err := aesCMAC(sess.kmac[:], macInput)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-	mact = truncateOddBytes(cmac)
+	mact = TruncateOddBytes(cmac)
 
 	// Assemble final APDU: 90 Cmd 00 00 Lc Header EncData MACT 00
 	dataLen := len(header) + len(encData) + len(mact)
@@ -81,7 +91,29 @@ func BuildSsmApdu(sess *Session, cmd byte, header, data []byte) (apdu, macInput,
 	return apdu, macInput, encData, mact, nil
 }
 
-// SsmCmdFull executes a secure messaging command and verifies the response.
+// CommMode is the communication mode of a command in an authenticated
+// session, as encoded in FileOption bits 1:0.
+type CommMode byte
+
+const (
+	CommModePlain CommMode = 0x00 // cleartext command and response, no MAC
+	CommModeMAC   CommMode = 0x01 // cleartext data protected by a truncated CMAC
+	CommModeFull  CommMode = 0x03 // encrypted data plus truncated CMAC
+)
+
+func (m CommMode) String() string {
+	switch m {
+	case CommModePlain:
+		return "Plain"
+	case CommModeMAC:
+		return "MAC"
+	case CommModeFull:
+		return "Full"
+	}
+	return fmt.Sprintf("CommMode(0x%02X)", byte(m))
+}
+
+// SsmCmdFull executes a secure messaging command in CommMode.Full.
 // It handles encryption, MAC generation, transmission, response verification,
 // and decryption.
 //
@@ -96,79 +128,215 @@ func BuildSsmApdu(sess *Session, cmd byte, header, data []byte) (apdu, macInput,
 //   - Decrypted response data (without padding)
 //   - Error if command fails, MAC mismatch, or decryption error
 func SsmCmdFull(card Card, sess *Session, cmd byte, header, data []byte) ([]byte, error) {
+	return SsmCmd(card, sess, CommModeFull, cmd, header, data)
+}
+
+// SsmCmdMAC executes a command in CommMode.MAC: header and data are sent in
+// cleartext with a truncated CMAC appended, and the response data is
+// returned as received once its MAC verifies.
+func SsmCmdMAC(card Card, sess *Session, cmd byte, header, data []byte) ([]byte, error) {
+	return SsmCmd(card, sess, CommModeMAC, cmd, header, data)
+}
+
+// SsmCmd executes a command in an authenticated session using the given
+// comm mode for both the command and the response. The caller states the
+// mode instead of SsmCmd guessing it from the response length: a 16-byte
+// MAC-mode response is indistinguishable from one block of ciphertext.
+//
+// Modes:
+//   - CommModePlain: command and response are sent as-is, no MAC
+//   - CommModeMAC: data is cleartext; command and response carry a MAC
+//   - CommModeFull: data is encrypted (see BuildSsmApdu) and MACed
+//
+// Responses split across frames (SW=91AF) are fetched with 0xAF
+// continuations and verified and decrypted as a whole.
+//
+// The session counter advances on success in every mode.
+func SsmCmd(card Card, sess *Session, mode CommMode, cmd byte, header, data []byte) ([]byte, error) {
+	out, _, err := ssmCmd(card, sess, mode, cmd, header, data)
+	return out, err
+}
+
+// SsmCmdFullDebug is SsmCmdFull for diagnosing secure reads: besides the
+// decrypted response it returns raw, the response exactly as the tag sent
+// it (ciphertext followed by the MAC, without the status word), and
+// respMAC, its last 8 bytes. raw and respMAC are returned whenever a
+// response arrived, including on an error status, a response MAC mismatch
+// or a decryption failure; plain is only set on success.
+func SsmCmdFullDebug(card Card, sess *Session, cmd byte, header, data []byte) (plain []byte, raw []byte, respMAC []byte, err error) {
+	return SsmCmdDebug(card, sess, CommModeFull, cmd, header, data)
+}
+
+// SsmCmdDebug is SsmCmdFullDebug in the given comm mode, so a file read in
+// CommMode.MAC can be diagnosed the same way. In MAC mode raw is the
+// cleartext data followed by the MAC; in plain mode there is no MAC and
+// respMAC is nil.
+func SsmCmdDebug(card Card, sess *Session, mode CommMode, cmd byte, header, data []byte) (plain []byte, raw []byte, respMAC []byte, err error) {
+	plain, raw, err = ssmCmd(card, sess, mode, cmd, header, data)
+	if mode != CommModePlain && len(raw) >= 8 {
+		respMAC = append([]byte{}, raw[len(raw)-8:]...)
+	}
+	return plain, raw, respMAC, err
+}
+
+// ssmCmd does the work of SsmCmd and also returns the raw response data
+// (everything before the status word) once one has been received.
+func ssmCmd(card Card, sess *Session, mode CommMode, cmd byte, header, data []byte) ([]byte, []byte, error) {
 	if sess == nil {
-		return nil, errors.New("session is nil")
+		return nil, nil, ErrNoSession
 	}
 
-	apdu, macInput, encData, mact, err := BuildSsmApdu(sess, cmd, header, data)
+	var apdu []byte
+	var err error
+	switch mode {
+	case CommModePlain:
+		apdu, err = buildPlainApdu(cmd, header, data)
+	case CommModeMAC:
+		apdu, err = buildMACApdu(sess, cmd, header, data)
+	case CommModeFull:
+		var macInput, encData, mact []byte
+		apdu, macInput, encData, mact, err = BuildSsmApdu(sess, cmd, header, data)
+		if err == nil {
+			slog.Debug("secure messaging",
+				"cmd", fmt.Sprintf("0x%02X", cmd),
+				"apdu", strings.ToUpper(hex.EncodeToString(apdu)),
+				"enc", strings.ToUpper(hex.EncodeToString(encData)),
+				"mac_input", strings.ToUpper(hex.EncodeToString(macInput)),
+				"mact", strings.ToUpper(hex.EncodeToString(mact)))
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported comm mode %s", mode)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if mode != CommModeFull {
+		slog.Debug("secure messaging",
+			"cmd", fmt.Sprintf("0x%02X", cmd),
+			"mode", mode.String(),
+			"apdu", strings.ToUpper(hex.EncodeToString(apdu)))
 	}
-	slog.Debug("secure messaging",
-		"cmd", fmt.Sprintf("0x%02X", cmd),
-		"apdu", strings.ToUpper(hex.EncodeToString(apdu)),
-		"enc", strings.ToUpper(hex.EncodeToString(encData)),
-		"mac_input", strings.ToUpper(hex.EncodeToString(macInput)),
-		"mact", strings.ToUpper(hex.EncodeToString(mact)))
 
-	resp, sw, err := Transmit(card, apdu)
+	resp, sw, err := transmitChained(card, apdu)
 	if err != nil {
-		return nil, err
+		return nil, resp, err
 	}
 	if sw != SWDESFireOK {
-		return nil, &SWError{Cmd: cmd, SW: sw}
+		return nil, resp, &SWError{Cmd: cmd, SW: sw}
+	}
+	cmdCtr1 := sess.cmdCtr + 1
+	if mode == CommModePlain {
+		sess.cmdCtr = cmdCtr1
+		return resp, resp, nil
 	}
 	if len(resp) < 8 {
-		return nil, fmt.Errorf("response too short (len=%d, SW=%04X)", len(resp), sw)
+		return nil, resp, fmt.Errorf("response too short (len=%d, SW=%04X)", len(resp), sw)
 	}
 
-	// Split response into encrypted data and MAC
-	respEncLen := len(resp) - 8
-	respEnc := resp[:respEncLen]
-	respMac := resp[respEncLen:]
+	// Split response into data (cleartext or encrypted) and MAC
+	respDataLen := len(resp) - 8
+	respData := resp[:respDataLen]
+	respMac := resp[respDataLen:]
 
-	// Generate IV for response decryption: ECB-encrypt(Kenc, 5A A5 TI(4) (CmdCtr+1)(2) 00..00)
-	cmdCtr1 := sess.cmdCtr + 1
-	ivrIn := make([]byte, 16)
-	ivrIn[0] = 0x5A
-	ivrIn[1] = 0xA5
-	copy(ivrIn[2:6], sess.ti[:])
-	ivrIn[6] = byte(cmdCtr1 & 0xFF)
-	ivrIn[7] = byte((cmdCtr1 >> 8) & 0xFF)
-	ivr, err := aesECBEncrypt(sess.kenc[:], ivrIn)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify response MAC: CMAC(Kmac, SW(1) CmdCtr+1(2) TI(4) RespEnc)
-	macIn2 := make([]byte, 0, 8+respEncLen)
+	// Verify response MAC: CMAC(Kmac, SW(1) CmdCtr+1(2) TI(4) RespData)
+	macIn2 := make([]byte, 0, 8+respDataLen)
 	macIn2 = append(macIn2, byte(sw&0xFF))
 	macIn2 = append(macIn2, byte(cmdCtr1&0xFF), byte((cmdCtr1>>8)&0xFF))
 	macIn2 = append(macIn2, sess.ti[:]...)
-	macIn2 = append(macIn2, respEnc...)
+	macIn2 = append(macIn2, respData...)
 
-	cmac2, err := aesCMAC(sess.kmac[:], macIn2)
+	cmac2, err := AESCMAC(sess.kmac[:], macIn2)
 	if err != nil {
-		return nil, err
+		return nil, resp, err
 	}
-	mact2 := truncateOddBytes(cmac2)
+	mact2 := TruncateOddBytes(cmac2)
 	if !bytes.Equal(respMac, mact2) {
-		return nil, errors.New("response MAC mismatch")
+		return nil, resp, ErrResponseMAC
 	}
 
-	// Decrypt response data (if any) and remove padding
-	out := []byte{}
-	if respEncLen > 0 {
-		dec, err := aesCBCDecrypt(sess.kenc[:], ivr, respEnc)
+	out := append([]byte{}, respData...)
+	if mode == CommModeFull && respDataLen > 0 {
+		// Generate IV for response decryption: ECB-encrypt(Kenc, 5A A5 TI(4) (CmdCtr+1)(2) 00..00)
+		ivrIn := make([]byte, 16)
+		ivrIn[0] = 0x5A
+		ivrIn[1] = 0xA5
+		copy(ivrIn[2:6], sess.ti[:])
+		ivrIn[6] = byte(cmdCtr1 & 0xFF)
+		ivrIn[7] = byte((cmdCtr1 >> 8) & 0xFF)
+		ivr, err := aesECBEncrypt(sess.kenc[:], ivrIn)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		// Decrypt response data and remove padding
+		dec, err := aesCBCDecrypt(sess.kenc[:], ivr, respData)
 		if err != nil {
-			return nil, err
+			return nil, resp, err
 		}
-		out, err = unpadISO9797M2(dec)
+		out, err = UnpadISO9797M2(dec)
 		if err != nil {
-			return nil, err
+			return nil, resp, err
 		}
 	}
 
 	sess.cmdCtr = cmdCtr1
-	return out, nil
+	return out, resp, nil
+}
+
+// maxResponseFrames bounds the 0xAF continuations transmitChained follows,
+// so a misbehaving card cannot keep it looping.
+const maxResponseFrames = 64
+
+// transmitChained sends apdu and, while the card answers SW=91AF, fetches
+// the remaining frames with 90 AF 00 00 00. The frames are concatenated; for
+// MAC and Full mode the response MAC sits at the end of the last frame and
+// covers the whole response, so the result is verified as one response.
+func transmitChained(card Card, apdu []byte) ([]byte, uint16, error) {
+	resp, sw, err := Transmit(card, apdu)
+	if err != nil {
+		return nil, 0, err
+	}
+	for frames := 1; sw == SWMoreData; frames++ {
+		if frames >= maxResponseFrames {
+			return nil, 0, fmt.Errorf("response still incomplete after %d frames", frames)
+		}
+		var more []byte
+		more, sw, err = Transmit(card, []byte{0x90, 0xAF, 0x00, 0x00, 0x00})
+		if err != nil {
+			return nil, 0, err
+		}
+		resp = append(resp, more...)
+	}
+	return resp, sw, nil
+}
+
+// buildPlainApdu wraps a native command as 90 Cmd 00 00 Lc Header Data 00.
+func buildPlainApdu(cmd byte, header, data []byte) ([]byte, error) {
+	dataLen := len(header) + len(data)
+	if dataLen > 255 {
+		return nil, fmt.Errorf("APDU data too long")
+	}
+	apdu := make([]byte, 0, 6+dataLen)
+	apdu = append(apdu, 0x90, cmd, 0x00, 0x00, byte(dataLen))
+	apdu = append(apdu, header...)
+	apdu = append(apdu, data...)
+	return append(apdu, 0x00), nil
+}
+
+// buildMACApdu builds a CommMode.MAC command: header and data in cleartext
+// followed by MACt = CMAC(Kmac, Cmd CmdCtr(2) TI(4) Header Data), truncated.
+func buildMACApdu(sess *Session, cmd byte, header, data []byte) ([]byte, error) {
+	macInput := make([]byte, 0, 7+len(header)+len(data))
+	macInput = append(macInput, cmd)
+	macInput = append(macInput, byte(sess.cmdCtr&0xFF), byte((sess.cmdCtr>>8)&0xFF))
+	macInput = append(macInput, sess.ti[:]...)
+	macInput = append(macInput, header...)
+	macInput = append(macInput, data...)
+
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
+	if err != nil {
+		return nil, err
+	}
+	body := append(append([]byte{}, data...), TruncateOddBytes(cmac)...)
+	return buildPlainApdu(cmd, header, body)
 }
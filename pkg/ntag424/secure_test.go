@@ -0,0 +1,331 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testSession returns a session with fixed keys and TI for tag-side emulation.
+func testSession() *Session {
+	sess := &Session{ti: [4]byte{0x9D, 0x00, 0xC4, 0xDF}}
+	for i := range sess.kenc {
+		sess.kenc[i] = byte(0x10 + i)
+		sess.kmac[i] = byte(0x20 + i)
+	}
+	return sess
+}
+
+// ssmDecryptCommand plays the tag side of BuildSsmApdu: it checks the command
+// MAC and returns the decrypted command data. headerLen is the number of
+// cleartext header bytes after Lc.
+func ssmDecryptCommand(t *testing.T, sess *Session, apdu []byte, headerLen int) []byte {
+	t.Helper()
+	lc := int(apdu[4])
+	body := apdu[5 : 5+lc]
+	header := body[:headerLen]
+	enc := body[headerLen : lc-8]
+	mac := body[lc-8:]
+
+	macInput := []byte{apdu[1], byte(sess.cmdCtr), byte(sess.cmdCtr >> 8)}
+	macInput = append(macInput, sess.ti[:]...)
+	macInput = append(macInput, header...)
+	macInput = append(macInput, enc...)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
+	if err != nil {
+		t.Fatalf("command CMAC: %v", err)
+	}
+	if !bytes.Equal(TruncateOddBytes(cmac), mac) {
+		t.Fatalf("command MAC mismatch for % X", apdu)
+	}
+	if len(enc) == 0 {
+		return nil
+	}
+
+	ivIn := make([]byte, 16)
+	ivIn[0], ivIn[1] = 0xA5, 0x5A
+	copy(ivIn[2:6], sess.ti[:])
+	ivIn[6], ivIn[7] = byte(sess.cmdCtr), byte(sess.cmdCtr>>8)
+	iv, err := aesECBEncrypt(sess.kenc[:], ivIn)
+	if err != nil {
+		t.Fatalf("command IV: %v", err)
+	}
+	dec, err := aesCBCDecrypt(sess.kenc[:], iv, enc)
+	if err != nil {
+		t.Fatalf("command decrypt: %v", err)
+	}
+	plain, err := UnpadISO9797M2(dec)
+	if err != nil {
+		t.Fatalf("command unpad: %v", err)
+	}
+	return plain
+}
+
+// ssmResponse plays the tag side of SsmCmdFull: it encrypts plain (if any) and
+// appends the response MAC and SW 9100, using the session's current counter.
+func ssmResponse(t *testing.T, sess *Session, plain []byte) []byte {
+	t.Helper()
+	ctr := sess.cmdCtr + 1
+	var enc []byte
+	if len(plain) > 0 {
+		ivIn := make([]byte, 16)
+		ivIn[0], ivIn[1] = 0x5A, 0xA5
+		copy(ivIn[2:6], sess.ti[:])
+		ivIn[6], ivIn[7] = byte(ctr), byte(ctr>>8)
+		iv, err := aesECBEncrypt(sess.kenc[:], ivIn)
+		if err != nil {
+			t.Fatalf("response IV: %v", err)
+		}
+		enc, err = aesCBCEncrypt(sess.kenc[:], iv, PadISO9797M2(plain))
+		if err != nil {
+			t.Fatalf("response encrypt: %v", err)
+		}
+	}
+
+	macInput := []byte{0x00, byte(ctr), byte(ctr >> 8)}
+	macInput = append(macInput, sess.ti[:]...)
+	macInput = append(macInput, enc...)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
+	if err != nil {
+		t.Fatalf("response CMAC: %v", err)
+	}
+
+	resp := append([]byte{}, enc...)
+	resp = append(resp, TruncateOddBytes(cmac)...)
+	return append(resp, 0x91, 0x00)
+}
+
+func TestSsmCmdFullRoundTrip(t *testing.T) {
+	sess := testSession()
+	tag := *sess // tag-side copy of the session state
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		cmdData := ssmDecryptCommand(t, &tag, apdu, 1)
+		if apdu[5] != 0x02 || !bytes.Equal(cmdData, []byte{0xAA, 0xBB}) {
+			t.Fatalf("unexpected command header/data: % X / % X", apdu[5], cmdData)
+		}
+		resp := ssmResponse(t, &tag, []byte("hello"))
+		tag.cmdCtr++
+		return resp, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		out, err := SsmCmdFull(card, sess, 0x5F, []byte{0x02}, []byte{0xAA, 0xBB})
+		if err != nil {
+			t.Fatalf("SsmCmdFull #%d returned error: %v", i, err)
+		}
+		if string(out) != "hello" {
+			t.Fatalf("expected decrypted \"hello\", got %q", out)
+		}
+	}
+	if sess.cmdCtr != 2 {
+		t.Fatalf("expected cmdCtr 2, got %d", sess.cmdCtr)
+	}
+}
+
+func TestSsmCmdFullRejectsBadResponseMAC(t *testing.T) {
+	sess := testSession()
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		resp := ssmResponse(t, sess, []byte("data"))
+		resp[0] ^= 0x01
+		return resp, nil
+	})
+	if _, err := SsmCmdFull(card, sess, 0xBD, nil, []byte{0x03}); err == nil {
+		t.Fatalf("expected MAC mismatch error")
+	}
+	if sess.cmdCtr != 0 {
+		t.Fatalf("expected cmdCtr unchanged on failure, got %d", sess.cmdCtr)
+	}
+}
+
+// ssmCheckMACCommand plays the tag side of buildMACApdu: it checks the
+// command MAC and returns the cleartext command data (header and data).
+func ssmCheckMACCommand(t *testing.T, sess *Session, apdu []byte) []byte {
+	t.Helper()
+	lc := int(apdu[4])
+	body := apdu[5 : 5+lc-8]
+	mac := apdu[5+lc-8 : 5+lc]
+
+	macInput := []byte{apdu[1], byte(sess.cmdCtr), byte(sess.cmdCtr >> 8)}
+	macInput = append(macInput, sess.ti[:]...)
+	macInput = append(macInput, body...)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
+	if err != nil {
+		t.Fatalf("command CMAC: %v", err)
+	}
+	if !bytes.Equal(TruncateOddBytes(cmac), mac) {
+		t.Fatalf("command MAC mismatch for % X", apdu)
+	}
+	return append([]byte{}, body...)
+}
+
+// ssmMACResponse plays the tag side of a CommMode.MAC response: plain data
+// followed by the response MAC and SW 9100.
+func ssmMACResponse(t *testing.T, sess *Session, plain []byte) []byte {
+	t.Helper()
+	ctr := sess.cmdCtr + 1
+	macInput := []byte{0x00, byte(ctr), byte(ctr >> 8)}
+	macInput = append(macInput, sess.ti[:]...)
+	macInput = append(macInput, plain...)
+	cmac, err := AESCMAC(sess.kmac[:], macInput)
+	if err != nil {
+		t.Fatalf("response CMAC: %v", err)
+	}
+	resp := append([]byte{}, plain...)
+	resp = append(resp, TruncateOddBytes(cmac)...)
+	return append(resp, 0x91, 0x00)
+}
+
+func TestSsmCmdMACModeKeeps16BytePlaintext(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	plain := []byte("sixteen byte msg") // one full AES block of cleartext
+
+	card := NewFakeCard(FakeExchange{Response: ssmMACResponse(t, &tag, plain)})
+	out, err := SsmCmd(card, sess, CommModeMAC, 0xF5, []byte{0x02}, nil)
+	if err != nil {
+		t.Fatalf("SsmCmd returned error: %v", err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("expected cleartext %q, got % X", plain, out)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected cmdCtr 1, got %d", sess.cmdCtr)
+	}
+
+	// Command: cleartext header, no data, MAC over Cmd CmdCtr TI Header.
+	sent := card.Sent[0]
+	cmac, err := AESCMAC(tag.kmac[:], append([]byte{0xF5, 0x00, 0x00, 0x9D, 0x00, 0xC4, 0xDF}, 0x02))
+	if err != nil {
+		t.Fatalf("AESCMAC returned error: %v", err)
+	}
+	want := append([]byte{0x90, 0xF5, 0x00, 0x00, 0x09, 0x02}, TruncateOddBytes(cmac)...)
+	if !bytes.Equal(sent, append(want, 0x00)) {
+		t.Fatalf("expected MAC-mode APDU % X, got % X", append(want, 0x00), sent)
+	}
+}
+
+func TestSsmCmdFullModeDecrypts16ByteCiphertext(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	plain := []byte("fifteen bytes!!") // pads to exactly one ciphertext block
+
+	resp := ssmResponse(t, &tag, plain)
+	if len(resp)-10 != 16 {
+		t.Fatalf("expected a 16-byte ciphertext, got %d bytes", len(resp)-10)
+	}
+	out, err := SsmCmd(NewFakeCard(FakeExchange{Response: resp}), sess, CommModeFull, 0xF5, []byte{0x02}, nil)
+	if err != nil {
+		t.Fatalf("SsmCmd returned error: %v", err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("expected decrypted %q, got % X", plain, out)
+	}
+
+	// The same 16 ciphertext bytes read in MAC mode are returned untouched.
+	macSess := testSession()
+	macTag := *macSess
+	cipher := resp[:16]
+	out, err = SsmCmd(NewFakeCard(FakeExchange{Response: ssmMACResponse(t, &macTag, cipher)}), macSess, CommModeMAC, 0xF5, []byte{0x02}, nil)
+	if err != nil {
+		t.Fatalf("SsmCmd returned error: %v", err)
+	}
+	if !bytes.Equal(out, cipher) {
+		t.Fatalf("expected MAC mode to return ciphertext bytes as-is, got % X", out)
+	}
+}
+
+func TestSsmCmdPlainModeAdvancesCounter(t *testing.T) {
+	sess := testSession()
+	card := NewFakeCard(FakeExchange{
+		Command:  []byte{0x90, 0xBD, 0x00, 0x00, 0x07, 0x02, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00},
+		Response: []byte{0x01, 0x02, 0x03, 0x04, 0x91, 0x00},
+	})
+	out, err := SsmCmd(card, sess, CommModePlain, 0xBD, nil, []byte{0x02, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("SsmCmd returned error: %v", err)
+	}
+	if !bytes.Equal(out, []byte{0x01, 0x02, 0x03, 0x04}) || sess.cmdCtr != 1 {
+		t.Fatalf("expected plain data with cmdCtr 1, got % X with %d", out, sess.cmdCtr)
+	}
+	if _, err := SsmCmd(card, sess, CommMode(0x02), 0xBD, nil, nil); err == nil {
+		t.Fatalf("expected error for unsupported comm mode")
+	}
+}
+
+func TestSessionNearLimitThreshold(t *testing.T) {
+	sess := testSession()
+	if sess.CommandsIssued() != 0 || sess.NearLimit() {
+		t.Fatalf("expected fresh session at 0 and not near limit, got %d/%v", sess.CommandsIssued(), sess.NearLimit())
+	}
+
+	sess.cmdCtr = 0xFFFF - sessionLimitMargin - 1
+	if sess.NearLimit() {
+		t.Fatalf("expected cmdCtr 0x%04X to be below the threshold", sess.cmdCtr)
+	}
+	sess.cmdCtr++
+	if !sess.NearLimit() {
+		t.Fatalf("expected cmdCtr 0x%04X to be near the limit", sess.cmdCtr)
+	}
+	if sess.CommandsIssued() != 0xFFFF-sessionLimitMargin {
+		t.Fatalf("expected CommandsIssued 0x%04X, got 0x%04X", 0xFFFF-sessionLimitMargin, sess.CommandsIssued())
+	}
+
+	var nilSess *Session
+	if nilSess.CommandsIssued() != 0 || nilSess.NearLimit() {
+		t.Fatal("expected nil session to report 0 commands and not near limit")
+	}
+}
+
+func TestSsmCmdFullDebugReturnsRawOnMACMismatch(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	good := ssmResponse(t, &tag, []byte("file data"))
+	raw := append([]byte{}, good[:len(good)-2]...)
+
+	// Same ciphertext, last MAC byte flipped
+	bad := append([]byte{}, good...)
+	bad[len(bad)-3] ^= 0xFF
+	card := NewFakeCard(FakeExchange{Response: bad})
+
+	plain, gotRaw, respMAC, err := SsmCmdFullDebug(card, sess, 0xBD, nil, []byte{0x03, 0, 0, 0, 9, 0, 0})
+	if err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Fatalf("expected MAC mismatch, got %v", err)
+	}
+	if plain != nil {
+		t.Fatalf("expected no plaintext on mismatch, got % X", plain)
+	}
+	if !bytes.Equal(gotRaw, bad[:len(bad)-2]) || !bytes.Equal(respMAC, bad[len(bad)-10:len(bad)-2]) {
+		t.Fatalf("expected raw response and MAC as sent, got raw=% X mac=% X", gotRaw, respMAC)
+	}
+	if sess.cmdCtr != 0 {
+		t.Fatalf("expected counter unchanged after mismatch, got %d", sess.cmdCtr)
+	}
+
+	card = NewFakeCard(FakeExchange{Response: good})
+	plain, gotRaw, respMAC, err = SsmCmdFullDebug(card, sess, 0xBD, nil, []byte{0x03, 0, 0, 0, 9, 0, 0})
+	if err != nil || string(plain) != "file data" {
+		t.Fatalf("expected decrypted data, got %q %v", plain, err)
+	}
+	if !bytes.Equal(gotRaw, raw) || !bytes.Equal(respMAC, raw[len(raw)-8:]) {
+		t.Fatalf("expected raw response on success too, got raw=% X mac=% X", gotRaw, respMAC)
+	}
+}
+
+func TestSsmCmdDebugMACMode(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	good := ssmMACResponse(t, &tag, []byte("file data"))
+	bad := append([]byte{}, good...)
+	bad[len(bad)-3] ^= 0xFF
+	card := NewFakeCard(FakeExchange{Response: bad})
+
+	plain, raw, respMAC, err := SsmCmdDebug(card, sess, CommModeMAC, 0xBD, nil, []byte{0x03, 0, 0, 0, 9, 0, 0})
+	if !errors.Is(err, ErrResponseMAC) || plain != nil {
+		t.Fatalf("expected a response MAC mismatch and no data, got % X %v", plain, err)
+	}
+	if !bytes.Equal(raw, bad[:len(bad)-2]) || !bytes.Equal(respMAC, bad[len(bad)-10:len(bad)-2]) {
+		t.Fatalf("expected cleartext and MAC as sent, got raw=% X mac=% X", raw, respMAC)
+	}
+}
@@ -9,31 +9,56 @@ import (
 
 // FileSettings represents the complete file settings structure.
 // This is the full 16-field version from permissionsedit.
+//
+// RawData is a copy of the parsed response: the plain GetFileSettings data,
+// or the secure response with its MAC removed. ParseFileSettings and
+// ParseFileSettingsSDM set it, and so every GetFileSettings variant does,
+// whichever path answered. Changing fields afterwards (ApplyTo, edits) does
+// not update it.
 type FileSettings struct {
-	FileType   byte   // 0x00 = standard data file
-	FileOption byte   // bit 6 = SDM enabled, bits 1:0 = comm mode
-	AR1        byte   // [ReadWrite nibble | ChangeAccessRights nibble]
-	AR2        byte   // [Read nibble | Write nibble]
-	Size       int    // File size in bytes (3-byte LE)
-	SDMOptions byte   // SDM options (bit 7=UID, bit 6=Ctr, bit 0=TT)
-	SDMMeta    byte   // Meta access rights (upper nibble of SDMAR)
-	SDMFile    byte   // File access rights (bits 11:8 of SDMAR)
-	SDMCtr     byte   // Counter access rights (lower nibble of SDMAR)
-	RawData    []byte // Store raw response for debugging
+	FileType   byte   `json:"file_type"`             // 0x00 = standard data file
+	FileOption byte   `json:"file_option"`           // bit 6 = SDM enabled, bits 1:0 = comm mode
+	AR1        byte   `json:"ar1"`                   // [ReadWrite nibble | ChangeAccessRights nibble]
+	AR2        byte   `json:"ar2"`                   // [Read nibble | Write nibble]
+	Size       int    `json:"size"`                  // File size in bytes (3-byte LE)
+	SDMOptions byte   `json:"sdm_options,omitempty"` // SDM options (bit 7=UID, bit 6=Ctr, bit 0=TT)
+	SDMMeta    byte   `json:"sdm_meta"`              // Meta access rights (upper nibble of SDMAR)
+	SDMFile    byte   `json:"sdm_file"`              // File access rights (bits 11:8 of SDMAR)
+	SDMCtr     byte   `json:"sdm_ctr"`               // Counter access rights (lower nibble of SDMAR)
+	RawData    []byte `json:"-"`                     // Settings bytes exactly as the tag sent them; see below
 
 	// Conditional SDM offset fields (present depending on SDMOptions/SDMAR)
-	UIDOffset      uint32 // UID mirror offset (if bit7=1 and Meta=0xE)
-	CtrOffset      uint32 // Counter mirror offset (if bit6=1 and Meta=0xE)
-	MACInputOffset uint32 // MAC input offset (if File != 0xF)
-	MACOffset      uint32 // MAC offset (if File != 0xF)
-	ENCOffset      uint32 // ENC offset (if bit4=1)
-	ENCLength      uint32 // ENC length (if bit4=1)
-	CtrLimit       uint32 // Counter limit (if bit5=1)
+	UIDOffset      uint32 `json:"uid_offset,omitempty"`       // UID mirror offset (if bit7=1 and Meta=0xE)
+	CtrOffset      uint32 `json:"ctr_offset,omitempty"`       // Counter mirror offset (if bit6=1 and Meta=0xE)
+	PICCDataOffset uint32 `json:"picc_data_offset,omitempty"` // Encrypted PICC data offset (if Meta is a key); see ParseFileSettingsSDM
+	MACInputOffset uint32 `json:"mac_input_offset,omitempty"` // MAC input offset (if File != 0xF)
+	MACOffset      uint32 `json:"mac_offset,omitempty"`       // MAC offset (if File != 0xF)
+	ENCOffset      uint32 `json:"enc_offset,omitempty"`       // ENC offset (if bit4=1)
+	ENCLength      uint32 `json:"enc_length,omitempty"`       // ENC length (if bit4=1)
+	CtrLimit       uint32 `json:"ctr_limit,omitempty"`        // Counter limit (if bit5=1)
 }
 
 // ParseFileSettings parses the raw GetFileSettings response.
 // This is the most complete version from permissionsedit/main.go:546-629.
+//
+// For encrypted PICC data (SDMMeta is a key) the PICCDataOffset is stored in
+// UIDOffset, as older callers expect. Use ParseFileSettingsSDM to keep it in
+// its own field.
 func ParseFileSettings(data []byte) (*FileSettings, error) {
+	return parseFileSettings(data, false)
+}
+
+// ParseFileSettingsSDM parses the raw GetFileSettings response like
+// ParseFileSettings, but keeps the PICCDataOffset in FileSettings.PICCDataOffset
+// and leaves UIDOffset zero, so every SDM offset the tag reported is available
+// unchanged.
+func ParseFileSettingsSDM(data []byte) (*FileSettings, error) {
+	return parseFileSettings(data, true)
+}
+
+// parseFileSettings does the work for ParseFileSettings and
+// ParseFileSettingsSDM; splitPICC selects where PICCDataOffset goes.
+func parseFileSettings(data []byte, splitPICC bool) (*FileSettings, error) {
 	if len(data) < 7 {
 		return nil, errors.New("file settings too short")
 	}
@@ -88,7 +113,11 @@ func ParseFileSettings(data []byte) (*FileSettings, error) {
 		if len(data) < idx+3 {
 			return nil, errors.New("file settings missing PICCDataOffset")
 		}
-		fs.UIDOffset = readU24le(data, idx) // Reuse UIDOffset field for PICC data
+		if splitPICC {
+			fs.PICCDataOffset = readU24le(data, idx)
+		} else {
+			fs.UIDOffset = readU24le(data, idx) // Reuse UIDOffset field for PICC data
+		}
 		idx += 3
 	}
 
@@ -124,6 +153,99 @@ func ParseFileSettings(data []byte) (*FileSettings, error) {
 	return fs, nil
 }
 
+// Validate checks the SDM fields of fs for combinations the tag rejects, so
+// ChangeFileSettings fails client-side with an error naming the offending
+// field instead of a bare SW=917E/919E. Settings with SDM disabled
+// (SDMOptions == 0) are always valid; FileType, Size and RawData are only
+// used for the offset bounds check when Size is non-zero.
+func (fs *FileSettings) Validate() error {
+	if fs.SDMOptions == 0 {
+		return nil
+	}
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("invalid file settings: "+format, args...)
+	}
+	isKey := func(v byte) bool { return v <= 0x04 }
+
+	uidMirror := fs.SDMOptions&0x80 != 0
+	ctrMirror := fs.SDMOptions&0x40 != 0
+	ctrLimit := fs.SDMOptions&0x20 != 0
+	encFile := fs.SDMOptions&0x10 != 0
+
+	if fs.SDMOptions&0x0E != 0 {
+		return invalid("SDMOptions 0x%02X sets reserved bits 3:1", fs.SDMOptions)
+	}
+	if !isKey(fs.SDMMeta) && fs.SDMMeta != 0x0E && fs.SDMMeta != 0x0F {
+		return invalid("SDMMeta 0x%X must be a key slot 0-4, 0xE (plain) or 0xF (no mirror)", fs.SDMMeta)
+	}
+	if !isKey(fs.SDMFile) && fs.SDMFile != 0x0F {
+		return invalid("SDMFile 0x%X must be a key slot 0-4 or 0xF (no MAC)", fs.SDMFile)
+	}
+	if !isKey(fs.SDMCtr) && fs.SDMCtr != 0x0E && fs.SDMCtr != 0x0F {
+		return invalid("SDMCtr 0x%X must be a key slot 0-4, 0xE (free) or 0xF (denied)", fs.SDMCtr)
+	}
+
+	// PICC data mirroring
+	if (uidMirror || ctrMirror) && fs.SDMMeta == 0x0F {
+		return invalid("SDMOptions 0x%02X mirrors UID/ReadCtr but SDMMeta is 0xF (no mirror)", fs.SDMOptions)
+	}
+	if isKey(fs.SDMMeta) && !uidMirror && !ctrMirror {
+		return invalid("SDMMeta key %d encrypts PICC data but SDMOptions 0x%02X mirrors neither UID nor ReadCtr", fs.SDMMeta, fs.SDMOptions)
+	}
+
+	// SDM MAC
+	if fs.SDMFile == 0x0F {
+		if fs.MACInputOffset != 0 || fs.MACOffset != 0 {
+			return invalid("MACInputOffset/MACOffset set but SDMFile is 0xF (no MAC); they would not be sent")
+		}
+		if encFile {
+			return invalid("SDMOptions 0x%02X encrypts file data but SDMFile is 0xF (no MAC)", fs.SDMOptions)
+		}
+	} else if fs.MACInputOffset > fs.MACOffset {
+		return invalid("MACInputOffset %d is after MACOffset %d", fs.MACInputOffset, fs.MACOffset)
+	}
+
+	// SDM encrypted file data
+	if encFile {
+		if !uidMirror || !ctrMirror {
+			return invalid("SDMOptions 0x%02X encrypts file data without both UID and ReadCtr mirroring", fs.SDMOptions)
+		}
+		if fs.ENCLength == 0 || fs.ENCLength%32 != 0 {
+			return invalid("ENCLength %d must be a non-zero multiple of 32", fs.ENCLength)
+		}
+		if fs.ENCOffset < fs.MACInputOffset || fs.ENCOffset+fs.ENCLength > fs.MACOffset {
+			return invalid("ENCOffset %d + ENCLength %d must lie between MACInputOffset %d and MACOffset %d",
+				fs.ENCOffset, fs.ENCLength, fs.MACInputOffset, fs.MACOffset)
+		}
+	} else if fs.ENCOffset != 0 || fs.ENCLength != 0 {
+		return invalid("ENCOffset/ENCLength set but SDMOptions 0x%02X does not enable encrypted file data", fs.SDMOptions)
+	}
+
+	if ctrLimit && fs.CtrLimit > 0xFFFFFF {
+		return invalid("CtrLimit %d exceeds 0xFFFFFF", fs.CtrLimit)
+	}
+
+	// Mirrors must fit in the file (ASCII: UID 14, ReadCtr 6, MAC 16 chars;
+	// binary, SDMOptions bit 0 clear: 7, 3 and 8 bytes)
+	if fs.Size > 0 {
+		size := uint32(fs.Size)
+		unit, uidLen, ctrLen, macLen := "char", uint32(14), uint32(6), uint32(16)
+		if SDMEncodingFromOptions(fs.SDMOptions) == SDMEncodingBinary {
+			unit, uidLen, ctrLen, macLen = "byte", 7, 3, 8
+		}
+		if uidMirror && fs.SDMMeta == 0x0E && fs.UIDOffset+uidLen > size {
+			return invalid("UIDOffset %d leaves no room for the %d-%s UID in a %d-byte file", fs.UIDOffset, uidLen, unit, size)
+		}
+		if ctrMirror && fs.SDMMeta == 0x0E && fs.CtrOffset+ctrLen > size {
+			return invalid("CtrOffset %d leaves no room for the %d-%s counter in a %d-byte file", fs.CtrOffset, ctrLen, unit, size)
+		}
+		if fs.SDMFile != 0x0F && fs.MACOffset+macLen > size {
+			return invalid("MACOffset %d leaves no room for the %d-%s MAC in a %d-byte file", fs.MACOffset, macLen, unit, size)
+		}
+	}
+	return nil
+}
+
 // readU24le reads a 3-byte little-endian uint32 at the given offset.
 func readU24le(data []byte, offset int) uint32 {
 	return uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16
@@ -134,46 +256,102 @@ func u24le(v uint32) []byte {
 	return []byte{byte(v & 0xFF), byte((v >> 8) & 0xFF), byte((v >> 16) & 0xFF)}
 }
 
-// GetFileSettings retrieves file settings using plain-first-then-secure strategy.
-// This is the canonical version from update/internal/ntag/settings.go:9-68.
-// It tries multiple plain APDU formats first, then falls back to secure messaging with retry logic.
+// GetFileSettings retrieves file settings with at most one plain and one
+// secure attempt. The first read of a file tries a plain GetFileSettings
+// (fixing up Le from SW=6Cxx); if the tag refuses it and sess is set, it
+// falls back to secure messaging (CommMode.MAC, see GetFileSettingsSecure).
+// Which path worked, and the file's comm mode, are remembered on sess, so
+// later reads of the same file in the session go straight to that path.
 func GetFileSettings(card Card, sess *Session, fileNo byte) (*FileSettings, error) {
-	// Try multiple plain APDU formats
-	plainFormats := [][]byte{
-		{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x20}, // Le=0x20 (32 bytes)
-		{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x10}, // Le=0x10 (16 bytes)
-		{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo},       // No Le
-		{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x00}, // Le=0x00 (256 bytes)
+	return getFileSettings(card, sess, fileNo, ParseFileSettings)
+}
+
+// GetFileSettingsSDM is GetFileSettings, but parses the response with
+// ParseFileSettingsSDM so an encrypted-PICC PICCDataOffset is returned in its
+// own field rather than in UIDOffset.
+func GetFileSettingsSDM(card Card, sess *Session, fileNo byte) (*FileSettings, error) {
+	return getFileSettings(card, sess, fileNo, ParseFileSettingsSDM)
+}
+
+// fileMode is what a session has learned about one file.
+type fileMode struct {
+	commMode byte // FileOption bits 0-1
+	plain    bool // plain GetFileSettings is answered
+}
+
+// FileCommMode returns the comm mode of fileNo (FileOption bits 0-1: 0x00
+// plain, 0x01 MAC, 0x03 full). It reads the file settings once, plain if the
+// tag allows it and secure otherwise, and caches the answer on s; later calls
+// for the same file cost no round trip. A nil s can only use the plain read
+// and caches nothing.
+//
+// ChangeFileSettings through the library forgets the cached entry for that
+// file; a new session starts with an empty cache.
+func (s *Session) FileCommMode(card Card, fileNo byte) (byte, error) {
+	if m, ok := s.fileMode(fileNo); ok {
+		return m.commMode, nil
 	}
+	fs, err := getFileSettings(card, s, fileNo, ParseFileSettings)
+	if err != nil {
+		return 0, err
+	}
+	return fs.FileOption & 0x03, nil
+}
+
+func (s *Session) fileMode(fileNo byte) (fileMode, bool) {
+	if s == nil {
+		return fileMode{}, false
+	}
+	m, ok := s.fileModes[fileNo]
+	return m, ok
+}
+
+func (s *Session) rememberFileMode(fileNo byte, m fileMode) {
+	if s == nil {
+		return
+	}
+	if s.fileModes == nil {
+		s.fileModes = make(map[byte]fileMode)
+	}
+	s.fileModes[fileNo] = m
+}
+
+func (s *Session) forgetFileMode(fileNo byte) {
+	if s != nil {
+		delete(s.fileModes, fileNo)
+	}
+}
+
+func getFileSettings(card Card, sess *Session, fileNo byte, parse func([]byte) (*FileSettings, error)) (*FileSettings, error) {
+	known, cached := sess.fileMode(fileNo)
 
 	var plainSW uint16
-	for i, apdu := range plainFormats {
-		resp, sw, err := Transmit(card, apdu)
+	if !cached || known.plain {
+		resp, sw, err := getFileSettingsPlainResp(card, fileNo)
+		if err != nil {
+			return nil, err
+		}
 		plainSW = sw
-		leStr := "none"
-		if len(apdu) > 6 {
-			leStr = fmt.Sprintf("0x%02X", apdu[len(apdu)-1])
+		if sw == SWSuccess || sw == SWDESFireOK {
+			fs, err := parse(resp)
+			if err != nil {
+				return nil, err
+			}
+			sess.rememberFileMode(fileNo, fileMode{commMode: fs.FileOption & 0x03, plain: true})
+			return fs, nil
 		}
-		slog.Debug("GetFileSettings plain attempt",
-			"file_no", fmt.Sprintf("%02X", fileNo),
-			"attempt", i+1,
-			"le", leStr,
-			"sw", fmt.Sprintf("%04X", sw),
-			"resp_len", len(resp))
-		if err == nil && (sw == SWSuccess || sw == SWDESFireOK) {
-			slog.Debug("GetFileSettings plain success",
-				"ar1", fmt.Sprintf("%02X", resp[2]),
-				"ar2", fmt.Sprintf("%02X", resp[3]))
-			return ParseFileSettings(resp)
+		if sess == nil {
+			return nil, &SWError{Cmd: 0xF5, SW: sw}
 		}
+		slog.Debug("GetFileSettings plain refused, using secure",
+			"file_no", fmt.Sprintf("%02X", fileNo),
+			"sw", fmt.Sprintf("%04X", sw))
+	}
+	if sess == nil {
+		return nil, errors.New("GetFileSettings needs an authenticated session for this file")
 	}
 
-	// Plain failed, try secure messaging
-	slog.Warn("GetFileSettings fallback to secure",
-		"reason", "all plain attempts failed",
-		"last_sw", fmt.Sprintf("%04X", plainSW))
-
-	// Try secure messaging with retry logic (tag may need time after ChangeFileSettings)
+	// Secure messaging, with retries (tag may need time after ChangeFileSettings)
 	var lastErr error
 	for attempt := 0; attempt < 3; attempt++ {
 		if attempt > 0 {
@@ -181,9 +359,14 @@ func GetFileSettings(card Card, sess *Session, fileNo byte) (*FileSettings, erro
 			time.Sleep(100 * time.Millisecond)
 		}
 
-		out, err := SsmCmdFull(card, sess, 0xF5, []byte{fileNo}, nil)
+		out, err := SsmCmdMAC(card, sess, 0xF5, []byte{fileNo}, nil)
 		if err == nil {
-			return ParseFileSettings(out)
+			fs, err := parse(out)
+			if err != nil {
+				return nil, err
+			}
+			sess.rememberFileMode(fileNo, fileMode{commMode: fs.FileOption & 0x03})
+			return fs, nil
 		}
 		lastErr = err
 
@@ -193,7 +376,26 @@ func GetFileSettings(card Card, sess *Session, fileNo byte) (*FileSettings, erro
 		}
 	}
 
-	return nil, fmt.Errorf("plain SW=%04X; secure err: %v", plainSW, lastErr)
+	if cached {
+		return nil, fmt.Errorf("secure err: %w", lastErr)
+	}
+	return nil, fmt.Errorf("plain SW=%04X; secure err: %w", plainSW, lastErr)
+}
+
+// getFileSettingsPlainResp sends one plain GetFileSettings with Le=00 and,
+// if the tag answers SW=6Cxx, resends it once with the Le from SW2.
+func getFileSettingsPlainResp(card Card, fileNo byte) ([]byte, uint16, error) {
+	apdu := []byte{0x90, 0xF5, 0x00, 0x00, 0x01, fileNo, 0x00}
+	resp, sw, err := Transmit(card, apdu)
+	if err == nil && (sw&0xFF00) == SWWrongLe {
+		correctLe := byte(sw & 0x00FF)
+		slog.Debug("GetFileSettings wrong Le, retrying",
+			"file_no", fmt.Sprintf("%02X", fileNo),
+			"correct_le", fmt.Sprintf("0x%02X", correctLe))
+		apdu[6] = correctLe
+		resp, sw, err = Transmit(card, apdu)
+	}
+	return resp, sw, err
 }
 
 // GetFileSettingsPlain retrieves file settings using plain APDU (from ro/auth.go:212).
@@ -210,8 +412,10 @@ func GetFileSettingsPlain(card Card, fileNo byte) (*FileSettings, error) {
 }
 
 // GetFileSettingsSecure retrieves file settings using secure messaging (from ro/auth.go:204).
+// GetFileSettings is a CommMode.MAC command whatever the file's own comm
+// mode: the settings come back in cleartext followed by a MAC.
 func GetFileSettingsSecure(card Card, sess *Session, fileNo byte) (*FileSettings, error) {
-	out, err := SsmCmdFull(card, sess, 0xF5, []byte{fileNo}, nil)
+	out, err := SsmCmdMAC(card, sess, 0xF5, []byte{fileNo}, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -220,28 +424,113 @@ func GetFileSettingsSecure(card Card, sess *Session, fileNo byte) (*FileSettings
 
 // ChangeFileSettingsBasic modifies file settings without SDM configuration.
 // From update/internal/ntag/settings.go:103-108.
+//
+// The command is always sent in CommMode.Full, also for files in CommMode.MAC.
 func ChangeFileSettingsBasic(card Card, sess *Session, fileNo byte, fileOption, ar1, ar2 byte) error {
-	data := []byte{fileOption, ar1, ar2}
-	_, err := SsmCmdFull(card, sess, 0x5F, []byte{fileNo}, data)
-	return err
+	return changeFileSettings(card, sess, fileNo, []byte{fileOption, ar1, ar2})
+}
+
+// ChangeFileSettingsBasicIdempotent is ChangeFileSettingsBasic, but treats
+// SW=9140 (settings already match) as success. Use it when re-applying
+// settings that may already be in place, e.g. re-running reset.
+func ChangeFileSettingsBasicIdempotent(card Card, sess *Session, fileNo byte, fileOption, ar1, ar2 byte) error {
+	return ignoreNoChanges(ChangeFileSettingsBasic(card, sess, fileNo, fileOption, ar1, ar2))
 }
 
 // ChangeFileSettingsSDM modifies file settings with SDM configuration.
 // From update/internal/ntag/settings.go:110-118.
+//
+// Only the UID/Ctr/MAC offsets are written. SDMOptions with encrypted file data
+// (bit 4) or a ReadCtr limit (bit 5) need ChangeFileSettingsSDMFull. The
+// settings are checked with FileSettings.Validate before anything is sent.
 func ChangeFileSettingsSDM(card Card, sess *Session, fileNo byte, commMode byte, ar1, ar2 byte,
 	sdmOptions, sdmMeta, sdmFile, sdmCtr byte,
 	uidOffset, ctrOffset, macInputOffset, macOffset uint32) error {
 
+	if (sdmOptions & 0x30) != 0 {
+		return fmt.Errorf("SDMOptions 0x%02X needs ENC/CtrLimit fields; use ChangeFileSettingsSDMFull", sdmOptions)
+	}
+	fs := &FileSettings{
+		FileOption: commMode & 0x03, AR1: ar1, AR2: ar2,
+		SDMOptions: sdmOptions, SDMMeta: sdmMeta, SDMFile: sdmFile, SDMCtr: sdmCtr,
+		UIDOffset: uidOffset, CtrOffset: ctrOffset, MACInputOffset: macInputOffset, MACOffset: macOffset,
+	}
+	if err := fs.Validate(); err != nil {
+		return err
+	}
 	data := BuildChangeFileSettingsData(commMode, ar1, ar2, sdmOptions, sdmMeta, sdmFile, sdmCtr,
-		uidOffset, ctrOffset, macInputOffset, macOffset)
+		uidOffset, ctrOffset, macInputOffset, macOffset, 0)
+	return changeFileSettings(card, sess, fileNo, data)
+}
+
+// ChangeFileSettingsSDMIdempotent is ChangeFileSettingsSDM, but treats
+// SW=9140 (settings already match) as success.
+func ChangeFileSettingsSDMIdempotent(card Card, sess *Session, fileNo byte, commMode byte, ar1, ar2 byte,
+	sdmOptions, sdmMeta, sdmFile, sdmCtr byte,
+	uidOffset, ctrOffset, macInputOffset, macOffset uint32) error {
+
+	return ignoreNoChanges(ChangeFileSettingsSDM(card, sess, fileNo, commMode, ar1, ar2,
+		sdmOptions, sdmMeta, sdmFile, sdmCtr, uidOffset, ctrOffset, macInputOffset, macOffset))
+}
+
+func ignoreNoChanges(err error) error {
+	if IsNoChanges(err) {
+		slog.Debug("ChangeFileSettings: no changes (settings already match)")
+		return nil
+	}
+	return err
+}
+
+// ChangeFileSettingsSDMFull modifies file settings from a complete FileSettings.
+// Every conditional SDM field (UID/Ctr or PICCData offset, MAC offsets, ENC
+// offset/length, ReadCtr limit) is written according to fs.SDMOptions and the
+// SDM access rights. FileType and RawData are ignored; fs is checked with
+// Validate first.
+func ChangeFileSettingsSDMFull(card Card, sess *Session, fileNo byte, fs *FileSettings) error {
+	if err := fs.Validate(); err != nil {
+		return err
+	}
+	return changeFileSettings(card, sess, fileNo, BuildChangeFileSettingsDataFull(fs))
+}
+
+// changeFileSettings sends ChangeFileSettings (CommMode.Full) and drops the
+// session's cached mode for fileNo, since the comm mode may have changed.
+//
+// ChangeFileSettings is always CommMode.Full on NTAG 424 DNA (NT4H2421Gx
+// section 10.7.1), whatever the file's own comm mode: that only applies to
+// ReadData/WriteData on the file. A MAC-mode file is reconfigured with an
+// encrypted command like any other.
+func changeFileSettings(card Card, sess *Session, fileNo byte, data []byte) error {
+	sess.forgetFileMode(fileNo)
 	_, err := SsmCmdFull(card, sess, 0x5F, []byte{fileNo}, data)
 	return err
 }
 
+// ChangeFileSettingsSDMWithNDEF modifies file settings with SDM configuration,
+// taking every mirror offset (including ENC offset/length and CtrLimit) from
+// the SDMNDEF produced by the BuildSDMNDEF family.
+func ChangeFileSettingsSDMWithNDEF(card Card, sess *Session, fileNo byte, commMode byte, ar1, ar2 byte,
+	sdmOptions, sdmMeta, sdmFile, sdmCtr byte, sdm *SDMNDEF) error {
+
+	fs := &FileSettings{
+		FileOption: commMode & 0x03,
+		AR1:        ar1,
+		AR2:        ar2,
+		SDMOptions: sdmOptions,
+		SDMMeta:    sdmMeta,
+		SDMFile:    sdmFile,
+		SDMCtr:     sdmCtr,
+	}
+	sdm.ApplyTo(fs)
+	return ChangeFileSettingsSDMFull(card, sess, fileNo, fs)
+}
+
 // BuildChangeFileSettingsData constructs the ChangeFileSettings data payload.
 // From update/internal/ntag/settings.go:120-145.
+//
+// ctrLimit is appended as SDMReadCtrLimit when sdmOptions bit 5 is set.
 func BuildChangeFileSettingsData(commMode, ar1, ar2, sdmOptions, sdmMeta, sdmFile, sdmCtr byte,
-	uidOffset, ctrOffset, macInputOffset, macOffset uint32) []byte {
+	uidOffset, ctrOffset, macInputOffset, macOffset, ctrLimit uint32) []byte {
 
 	data := make([]byte, 0, 64)
 	fileOption := (commMode & 0x03)
@@ -265,6 +554,58 @@ func BuildChangeFileSettingsData(commMode, ar1, ar2, sdmOptions, sdmMeta, sdmFil
 		data = append(data, u24le(macInputOffset)...)
 		data = append(data, u24le(macOffset)...)
 	}
+	if (sdmOptions & 0x20) != 0 {
+		data = append(data, u24le(ctrLimit)...)
+	}
+
+	return data
+}
+
+// BuildChangeFileSettingsDataFull constructs the ChangeFileSettings data payload
+// from a complete FileSettings, in the field order ParseFileSettings reads.
+//
+// The comm mode is taken from fs.FileOption bits 1:0. SDM is enabled when
+// fs.SDMOptions is non-zero; otherwise only FileOption/AR1/AR2 are emitted.
+// For encrypted PICC data (Meta not 0xE/0xF) the PICCDataOffset is taken
+// from fs.PICCDataOffset, or from fs.UIDOffset when that is zero, matching
+// both ParseFileSettingsSDM and ParseFileSettings.
+func BuildChangeFileSettingsDataFull(fs *FileSettings) []byte {
+	data := make([]byte, 0, 64)
+	fileOption := fs.FileOption & 0x03
+	if fs.SDMOptions == 0x00 {
+		return append(data, fileOption, fs.AR1, fs.AR2)
+	}
+	fileOption |= 0x40
+	data = append(data, fileOption, fs.AR1, fs.AR2, fs.SDMOptions)
+
+	// SDMAR: [Meta(15:12) | File(11:8) | RFU(7:4) | Ctr(3:0)]
+	sdmAR := uint16((uint16(fs.SDMMeta&0x0F) << 12) | (uint16(fs.SDMFile&0x0F) << 8) | (0x0F << 4) | uint16(fs.SDMCtr&0x0F))
+	data = append(data, byte(sdmAR&0xFF), byte((sdmAR>>8)&0xFF))
+
+	if (fs.SDMOptions&0x80) != 0 && fs.SDMMeta == 0x0E {
+		data = append(data, u24le(fs.UIDOffset)...)
+	}
+	if (fs.SDMOptions&0x40) != 0 && fs.SDMMeta == 0x0E {
+		data = append(data, u24le(fs.CtrOffset)...)
+	}
+	if fs.SDMMeta != 0x0E && fs.SDMMeta != 0x0F {
+		piccDataOffset := fs.PICCDataOffset
+		if piccDataOffset == 0 {
+			piccDataOffset = fs.UIDOffset
+		}
+		data = append(data, u24le(piccDataOffset)...)
+	}
+	if fs.SDMFile != 0x0F {
+		data = append(data, u24le(fs.MACInputOffset)...)
+		data = append(data, u24le(fs.MACOffset)...)
+	}
+	if (fs.SDMOptions & 0x10) != 0 {
+		data = append(data, u24le(fs.ENCOffset)...)
+		data = append(data, u24le(fs.ENCLength)...)
+	}
+	if (fs.SDMOptions & 0x20) != 0 {
+		data = append(data, u24le(fs.CtrLimit)...)
+	}
 
 	return data
 }
@@ -0,0 +1,497 @@
+package ntag424
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// settingsResponse wraps a ChangeFileSettings payload in the GetFileSettings
+// response layout (FileType and Size are not part of ChangeFileSettings).
+func settingsResponse(fileType byte, size int, data []byte) []byte {
+	resp := []byte{fileType}
+	resp = append(resp, data[:3]...)
+	resp = append(resp, u24le(uint32(size))...)
+	return append(resp, data[3:]...)
+}
+
+func TestBuildChangeFileSettingsDataFullRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		fs   FileSettings
+	}{
+		{
+			name: "no sdm",
+			fs:   FileSettings{FileOption: 0x00, AR1: 0xE0, AR2: 0xEE},
+		},
+		{
+			name: "uid ctr mac",
+			fs: FileSettings{FileOption: 0x40, AR1: 0x20, AR2: 0xE2, SDMOptions: 0xC1,
+				SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01,
+				UIDOffset: 0x20, CtrOffset: 0x33, MACInputOffset: 0x1C, MACOffset: 0x3E},
+		},
+		{
+			name: "ctr limit",
+			fs: FileSettings{FileOption: 0x40, AR1: 0x20, AR2: 0xE2, SDMOptions: 0xE1,
+				SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01,
+				UIDOffset: 0x20, CtrOffset: 0x33, MACInputOffset: 0x1C, MACOffset: 0x3E,
+				CtrLimit: 0x0186A0},
+		},
+		{
+			name: "picc data enc and limit",
+			fs: FileSettings{FileOption: 0x43, AR1: 0x00, AR2: 0xE0, SDMOptions: 0xF1,
+				SDMMeta: 0x02, SDMFile: 0x02, SDMCtr: 0x0F,
+				UIDOffset: 0x20, MACInputOffset: 0x20, MACOffset: 0x70,
+				ENCOffset: 0x45, ENCLength: 0x20, CtrLimit: 0xFFFFFF},
+		},
+	}
+
+	for _, tc := range cases {
+		data := BuildChangeFileSettingsDataFull(&tc.fs)
+		got, err := ParseFileSettings(settingsResponse(0x00, 256, data))
+		if err != nil {
+			t.Fatalf("%s: ParseFileSettings returned error: %v", tc.name, err)
+		}
+		want := tc.fs
+		want.Size = 256
+		got.RawData = nil
+		if !reflect.DeepEqual(*got, want) {
+			t.Fatalf("%s: round trip mismatch\n got: %+v\nwant: %+v", tc.name, *got, want)
+		}
+	}
+}
+
+func TestBuildChangeFileSettingsDataAppendsCtrLimit(t *testing.T) {
+	without := BuildChangeFileSettingsData(0x00, 0x20, 0xE2, 0xC1, 0x0E, 0x01, 0x01, 0x20, 0x33, 0x1C, 0x3E, 0x0186A0)
+	with := BuildChangeFileSettingsData(0x00, 0x20, 0xE2, 0xE1, 0x0E, 0x01, 0x01, 0x20, 0x33, 0x1C, 0x3E, 0x0186A0)
+	if len(with) != len(without)+3 {
+		t.Fatalf("expected CtrLimit to add 3 bytes, got %d vs %d", len(with), len(without))
+	}
+	if !bytes.Equal(with[len(with)-3:], []byte{0xA0, 0x86, 0x01}) {
+		t.Fatalf("expected little-endian CtrLimit A08601, got % X", with[len(with)-3:])
+	}
+
+	full := BuildChangeFileSettingsDataFull(&FileSettings{AR1: 0x20, AR2: 0xE2, SDMOptions: 0xE1,
+		SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01,
+		UIDOffset: 0x20, CtrOffset: 0x33, MACInputOffset: 0x1C, MACOffset: 0x3E, CtrLimit: 0x0186A0})
+	if !bytes.Equal(with, full) {
+		t.Fatalf("expected positional and full builders to agree\n got: % X\nwant: % X", full, with)
+	}
+}
+
+func TestSDMNDEFApplyToSetsCtrLimit(t *testing.T) {
+	sdm, err := BuildSDMNDEF("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	sdm.CtrLimit = 1000
+
+	fs := &FileSettings{FileOption: 0x40, AR1: 0x20, AR2: 0xE2, SDMOptions: 0xC1, SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01}
+	sdm.ApplyTo(fs)
+	if fs.SDMOptions != 0xE1 || fs.CtrLimit != 1000 {
+		t.Fatalf("expected SDMOptions E1 and CtrLimit 1000, got %02X and %d", fs.SDMOptions, fs.CtrLimit)
+	}
+	if fs.UIDOffset != sdm.UIDOffset || fs.MACOffset != sdm.MacOffset {
+		t.Fatalf("expected offsets copied from SDMNDEF, got %+v", fs)
+	}
+}
+
+func TestFileSettingsValidateAcceptsToolSettings(t *testing.T) {
+	sdm, err := BuildSDMNDEF("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEF returned error: %v", err)
+	}
+	fs := &FileSettings{AR1: 0x20, AR2: 0xE2, SDMOptions: 0xC1, SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01, Size: 256}
+	sdm.ApplyTo(fs)
+	if err := fs.Validate(); err != nil {
+		t.Fatalf("expected minter settings to validate, got %v", err)
+	}
+
+	picc, err := BuildSDMNDEFEncryptedPICC("https://example.com/tap")
+	if err != nil {
+		t.Fatalf("BuildSDMNDEFEncryptedPICC returned error: %v", err)
+	}
+	fs = &FileSettings{SDMOptions: 0xC1, SDMMeta: 0x02, SDMFile: 0x02, SDMCtr: 0x0F}
+	picc.ApplyTo(fs)
+	if err := fs.Validate(); err != nil {
+		t.Fatalf("expected encrypted PICC settings to validate, got %v", err)
+	}
+
+	if err := (&FileSettings{FileOption: 0x00, AR1: 0xE0, AR2: 0xEE}).Validate(); err != nil {
+		t.Fatalf("expected SDM-disabled settings to validate, got %v", err)
+	}
+}
+
+func TestFileSettingsValidateRejectsInconsistentSDM(t *testing.T) {
+	base := FileSettings{SDMOptions: 0xC1, SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x01,
+		UIDOffset: 0x20, CtrOffset: 0x33, MACInputOffset: 0x1C, MACOffset: 0x3E, Size: 256}
+	cases := []struct {
+		name  string
+		edit  func(*FileSettings)
+		field string
+	}{
+		{"reserved option bits", func(fs *FileSettings) { fs.SDMOptions |= 0x02 }, "SDMOptions"},
+		{"meta out of range", func(fs *FileSettings) { fs.SDMMeta = 0x07 }, "SDMMeta"},
+		{"file free", func(fs *FileSettings) { fs.SDMFile = 0x0E }, "SDMFile"},
+		{"ctr out of range", func(fs *FileSettings) { fs.SDMCtr = 0x09 }, "SDMCtr"},
+		{"uid mirror with meta denied", func(fs *FileSettings) { fs.SDMMeta = 0x0F }, "SDMMeta is 0xF"},
+		{"meta key without mirror", func(fs *FileSettings) { fs.SDMMeta = 0x02; fs.SDMOptions = 0x01 }, "SDMMeta key"},
+		{"mac offsets with file denied", func(fs *FileSettings) { fs.SDMFile = 0x0F }, "MACInputOffset/MACOffset"},
+		{"mac input after mac", func(fs *FileSettings) { fs.MACInputOffset = 0x40 }, "MACInputOffset"},
+		{"enc without file key", func(fs *FileSettings) {
+			fs.SDMFile, fs.MACInputOffset, fs.MACOffset = 0x0F, 0, 0
+			fs.SDMOptions |= 0x10
+		}, "SDMFile is 0xF"},
+		{"enc without ctr mirror", func(fs *FileSettings) {
+			fs.SDMOptions = 0x91
+			fs.ENCOffset, fs.ENCLength = 0x20, 32
+		}, "ReadCtr"},
+		{"enc length", func(fs *FileSettings) {
+			fs.SDMOptions |= 0x10
+			fs.ENCOffset, fs.ENCLength = 0x1C, 16
+		}, "ENCLength"},
+		{"enc outside mac input", func(fs *FileSettings) {
+			fs.SDMOptions |= 0x10
+			fs.ENCOffset, fs.ENCLength = 0x30, 32
+		}, "ENCOffset"},
+		{"enc fields without option", func(fs *FileSettings) { fs.ENCLength = 32 }, "ENCOffset/ENCLength"},
+		{"ctr limit too large", func(fs *FileSettings) { fs.SDMOptions |= 0x20; fs.CtrLimit = 0x1000000 }, "CtrLimit"},
+		{"mac past end of file", func(fs *FileSettings) { fs.Size = 0x40 }, "MACOffset"},
+	}
+	for _, tc := range cases {
+		fs := base
+		tc.edit(&fs)
+		err := fs.Validate()
+		if err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+		if !strings.Contains(err.Error(), tc.field) {
+			t.Fatalf("%s: expected error naming %q, got %v", tc.name, tc.field, err)
+		}
+	}
+}
+
+func TestChangeFileSettingsSDMValidatesBeforeSending(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+	// UID mirror requested with SDMMeta denied: would be SW=917E on the tag.
+	err := ChangeFileSettingsSDM(card, testSession(), 0x02, 0x00, 0x20, 0xE2,
+		0xC1, 0x0F, 0x01, 0x01, 0x20, 0x33, 0x1C, 0x3E)
+	if err == nil || !strings.Contains(err.Error(), "SDMMeta") {
+		t.Fatalf("expected SDMMeta validation error, got %v", err)
+	}
+}
+
+func TestChangeFileSettingsIdempotentToleratesNoChanges(t *testing.T) {
+	sw := []byte{0x91, 0x40}
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] != 0x5F {
+			t.Fatalf("unexpected APDU % X", apdu)
+		}
+		return sw, nil
+	})
+
+	err := ChangeFileSettingsBasic(card, testSession(), 0x02, 0x00, 0x00, 0xEE)
+	if !IsNoChanges(err) {
+		t.Fatalf("expected IsNoChanges for SW=9140, got %v", err)
+	}
+	if !IsNoChanges(fmt.Errorf("restore file 2: %w", err)) {
+		t.Fatalf("expected IsNoChanges to see through wrapping")
+	}
+	if err := ChangeFileSettingsBasicIdempotent(card, testSession(), 0x02, 0x00, 0x00, 0xEE); err != nil {
+		t.Fatalf("expected idempotent basic change to succeed, got %v", err)
+	}
+	if err := ChangeFileSettingsSDMIdempotent(card, testSession(), 0x02, 0x00, 0x20, 0xE2,
+		0xC1, 0x0E, 0x01, 0x01, 0x20, 0x33, 0x1C, 0x3E); err != nil {
+		t.Fatalf("expected idempotent SDM change to succeed, got %v", err)
+	}
+
+	sw = []byte{0x91, 0x9E}
+	if err := ChangeFileSettingsBasicIdempotent(card, testSession(), 0x02, 0x00, 0x00, 0xEE); err == nil || IsNoChanges(err) {
+		t.Fatalf("expected parameter error to pass through, got %v", err)
+	}
+}
+
+// macModeGetFileSettings is a GetFileSettings exchange for file 3 (CommMode
+// MAC, Read/Write key 3, 128 bytes) under testSession: cleartext settings
+// followed by the response MAC.
+const macModeGetFileSettings = `
+> 90F500000903AFA16B0B3365F66D00
+< 00013033800000D14B167A489387609100
+`
+
+func TestGetFileSettingsSecureMACModeTranscript(t *testing.T) {
+	script, err := ReadTranscript(strings.NewReader(macModeGetFileSettings))
+	if err != nil {
+		t.Fatalf("ReadTranscript returned error: %v", err)
+	}
+	sess := testSession()
+	card := NewFakeCard(script...)
+
+	fs, err := GetFileSettingsSecure(card, sess, 0x03)
+	if err != nil {
+		t.Fatalf("GetFileSettingsSecure returned error: %v", err)
+	}
+	if fs.FileOption != 0x01 || fs.AR1 != 0x30 || fs.AR2 != 0x33 || fs.Size != 128 {
+		t.Fatalf("unexpected settings %+v", fs)
+	}
+	if sess.cmdCtr != 1 {
+		t.Fatalf("expected cmdCtr 1, got %d", sess.cmdCtr)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetFileSettingsRetriesWithLeFromSW(t *testing.T) {
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x00}, Response: []byte{0x6C, 0x07}},
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x07}, Response: settingsAPDUResponse(0x00, 0xE0, 0xEE, 256)},
+	)
+
+	fs, err := GetFileSettings(card, nil, 0x02)
+	if err != nil {
+		t.Fatalf("GetFileSettings returned error: %v", err)
+	}
+	if fs.AR1 != 0xE0 || fs.AR2 != 0xEE || fs.Size != 256 {
+		t.Fatalf("unexpected settings %+v", fs)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseFileSettingsSDMKeepsPICCDataOffset(t *testing.T) {
+	want := FileSettings{FileOption: 0x43, AR1: 0x00, AR2: 0xE0, Size: 256, SDMOptions: 0xC1,
+		SDMMeta: 0x02, SDMFile: 0x02, SDMCtr: 0x0F,
+		PICCDataOffset: 0x2A, MACInputOffset: 0x20, MACOffset: 0x50}
+	blob := settingsResponse(0x00, 256, BuildChangeFileSettingsDataFull(&want))
+
+	got, err := ParseFileSettingsSDM(blob)
+	if err != nil {
+		t.Fatalf("ParseFileSettingsSDM returned error: %v", err)
+	}
+	got.RawData = nil
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("round trip mismatch\n got: %+v\nwant: %+v", *got, want)
+	}
+
+	legacy, err := ParseFileSettings(blob)
+	if err != nil {
+		t.Fatalf("ParseFileSettings returned error: %v", err)
+	}
+	if legacy.UIDOffset != 0x2A || legacy.PICCDataOffset != 0 {
+		t.Fatalf("expected ParseFileSettings to keep PICCDataOffset in UIDOffset, got %+v", legacy)
+	}
+
+	// Both parsed forms must rebuild the same ChangeFileSettings payload.
+	if !bytes.Equal(BuildChangeFileSettingsDataFull(legacy), BuildChangeFileSettingsDataFull(got)) {
+		t.Fatal("expected legacy and SDM parses to rebuild identical payloads")
+	}
+
+	sess := testSession()
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if len(apdu) > 5 && apdu[4] == 0x01 {
+			return []byte{0x91, 0xAE}, nil // plain GetFileSettings refused
+		}
+		return ssmMACResponse(t, sess, blob), nil
+	})
+	fs, err := GetFileSettingsSDM(card, sess, 0x02)
+	if err != nil {
+		t.Fatalf("GetFileSettingsSDM returned error: %v", err)
+	}
+	if fs.PICCDataOffset != 0x2A || fs.UIDOffset != 0 || fs.MACOffset != 0x50 {
+		t.Fatalf("unexpected secure settings %+v", fs)
+	}
+}
+
+func TestFileCommModePlainAllowed(t *testing.T) {
+	sess := testSession()
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x00}, Response: settingsAPDUResponse(0x00, 0xE0, 0xEE, 256)},
+		FakeExchange{Command: []byte{0x90, 0xF5, 0x00, 0x00, 0x01, 0x02, 0x00}, Response: settingsAPDUResponse(0x00, 0xE0, 0xEE, 256)},
+	)
+
+	mode, err := sess.FileCommMode(card, 0x02)
+	if err != nil || mode != 0x00 {
+		t.Fatalf("expected plain comm mode, got %02X, %v", mode, err)
+	}
+	// Cached: no second round trip.
+	if mode, err := sess.FileCommMode(card, 0x02); err != nil || mode != 0x00 {
+		t.Fatalf("expected cached plain comm mode, got %02X, %v", mode, err)
+	}
+	if len(card.Sent) != 1 {
+		t.Fatalf("expected 1 APDU, got %d", len(card.Sent))
+	}
+	// The file is known to answer plain, so GetFileSettings sends only that.
+	if _, err := GetFileSettings(card, sess, 0x02); err != nil {
+		t.Fatalf("GetFileSettings returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if sess.cmdCtr != 0 {
+		t.Fatalf("expected no secure commands, cmdCtr %d", sess.cmdCtr)
+	}
+}
+
+func TestFileCommModeAuthRequired(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	settings := settingsAPDUResponse(0x03, 0x30, 0x33, 128)
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] == 0x5F {
+			resp := ssmMACResponse(t, &tag, nil)
+			tag.cmdCtr++
+			return resp, nil
+		}
+		if apdu[1] != 0xF5 {
+			return nil, fmt.Errorf("unexpected APDU % X", apdu)
+		}
+		if apdu[4] == 0x01 {
+			return []byte{0x91, 0x9D}, nil
+		}
+		ssmDecryptCommand(t, &tag, apdu, 1)
+		resp := ssmMACResponse(t, &tag, settings[:len(settings)-2])
+		tag.cmdCtr++
+		return resp, nil
+	})
+	var sent [][]byte
+	rec := apduFunc(func(apdu []byte) ([]byte, error) {
+		sent = append(sent, append([]byte{}, apdu...))
+		return card.Transmit(apdu)
+	})
+
+	mode, err := sess.FileCommMode(rec, 0x03)
+	if err != nil || mode != 0x03 {
+		t.Fatalf("expected full comm mode, got %02X, %v", mode, err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("expected one plain and one secure APDU, got %d", len(sent))
+	}
+
+	// Known to need secure messaging: no plain attempt this time.
+	fs, err := GetFileSettings(rec, sess, 0x03)
+	if err != nil {
+		t.Fatalf("GetFileSettings returned error: %v", err)
+	}
+	if fs.AR1 != 0x30 || fs.AR2 != 0x33 || len(sent) != 3 || sent[2][4] == 0x01 {
+		t.Fatalf("expected a single secure APDU, sent %X", sent[2:])
+	}
+
+	// ChangeFileSettings forgets the cached mode.
+	if err := ChangeFileSettingsBasic(rec, sess, 0x03, 0x03, 0x30, 0x33); err != nil {
+		t.Fatalf("ChangeFileSettingsBasic returned error: %v", err)
+	}
+	if _, ok := sess.fileMode(0x03); ok {
+		t.Fatal("expected cache entry dropped after ChangeFileSettings")
+	}
+
+	// Without a session only the plain read is possible.
+	var nilSess *Session
+	if _, err := nilSess.FileCommMode(rec, 0x03); err == nil {
+		t.Fatal("expected error for an auth-required file without a session")
+	}
+}
+
+func TestChangeFileSettingsMACModeFileIsEncrypted(t *testing.T) {
+	sess := testSession()
+	sess.rememberFileMode(0x03, fileMode{commMode: byte(CommModeMAC)})
+	tag := *sess
+	settings := []byte{0x01, 0x30, 0x33} // stays CommMode.MAC
+
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		if apdu[1] != 0x5F || apdu[5] != 0x03 {
+			t.Fatalf("unexpected APDU % X", apdu)
+		}
+		// File number in clear, one encrypted block, 8-byte MAC
+		if apdu[4] != 1+16+8 || bytes.Contains(apdu[6:], settings) {
+			t.Fatalf("expected encrypted settings, got % X", apdu)
+		}
+		if got := ssmDecryptCommand(t, &tag, apdu, 1); !bytes.Equal(got, settings) {
+			t.Fatalf("expected settings % X, got % X", settings, got)
+		}
+		return ssmMACResponse(t, &tag, nil), nil
+	})
+
+	if err := ChangeFileSettingsBasic(card, sess, 0x03, settings[0], settings[1], settings[2]); err != nil {
+		t.Fatalf("ChangeFileSettingsBasic returned error: %v", err)
+	}
+	if _, ok := sess.fileMode(0x03); ok {
+		t.Fatal("expected the cached comm mode of file 3 to be dropped")
+	}
+}
+
+func TestGetFileSettingsRawDataIsOnWireBytes(t *testing.T) {
+	want := FileSettings{FileOption: 0x40, AR1: 0x00, AR2: 0xE0, Size: 256, SDMOptions: 0xC1,
+		SDMMeta: 0x0E, SDMFile: 0x01, SDMCtr: 0x0F,
+		UIDOffset: 0x20, CtrOffset: 0x32, MACInputOffset: 0x20, MACOffset: 0x3C}
+	blob := settingsResponse(0x00, 256, BuildChangeFileSettingsDataFull(&want))
+
+	plainCard := func() Card {
+		return apduFunc(func(apdu []byte) ([]byte, error) {
+			return append(append([]byte{}, blob...), 0x91, 0x00), nil
+		})
+	}
+	secureCard := func(sess *Session) Card {
+		tag := *sess
+		return apduFunc(func(apdu []byte) ([]byte, error) {
+			if apdu[4] == 0x01 {
+				return []byte{0x91, 0x9D}, nil // plain GetFileSettings refused
+			}
+			ssmDecryptCommand(t, &tag, apdu, 1)
+			resp := ssmMACResponse(t, &tag, blob)
+			tag.cmdCtr++
+			return resp, nil
+		})
+	}
+
+	entries := map[string]func() (*FileSettings, error){
+		"ParseFileSettings":    func() (*FileSettings, error) { return ParseFileSettings(blob) },
+		"ParseFileSettingsSDM": func() (*FileSettings, error) { return ParseFileSettingsSDM(blob) },
+		"GetFileSettingsPlain": func() (*FileSettings, error) { return GetFileSettingsPlain(plainCard(), 0x02) },
+		"GetFileSettings plain": func() (*FileSettings, error) {
+			return GetFileSettings(plainCard(), nil, 0x02)
+		},
+		"GetFileSettings secure": func() (*FileSettings, error) {
+			sess := testSession()
+			return GetFileSettings(secureCard(sess), sess, 0x02)
+		},
+		"GetFileSettingsSDM secure": func() (*FileSettings, error) {
+			sess := testSession()
+			return GetFileSettingsSDM(secureCard(sess), sess, 0x02)
+		},
+		"GetFileSettingsSecure": func() (*FileSettings, error) {
+			sess := testSession()
+			return GetFileSettingsSecure(secureCard(sess), sess, 0x02)
+		},
+	}
+	for name, get := range entries {
+		fs, err := get()
+		if err != nil {
+			t.Fatalf("%s returned error: %v", name, err)
+		}
+		if !bytes.Equal(fs.RawData, blob) {
+			t.Errorf("%s: RawData\n got % X\nwant % X", name, fs.RawData, blob)
+		}
+		// permissionsedit keeps the SDM part of RawData when only AR bytes change
+		if !bytes.Equal(fs.RawData[7:], BuildChangeFileSettingsDataFull(&want)[3:]) {
+			t.Errorf("%s: RawData[7:] is not the SDM settings", name)
+		}
+	}
+
+	// RawData is a copy, not the caller's buffer.
+	buf := append([]byte{}, blob...)
+	fs, err := ParseFileSettings(buf)
+	if err != nil {
+		t.Fatalf("ParseFileSettings returned error: %v", err)
+	}
+	buf[2] ^= 0xFF
+	if !bytes.Equal(fs.RawData, blob) {
+		t.Fatal("expected RawData to be unaffected by changes to the input")
+	}
+}
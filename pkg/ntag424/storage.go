@@ -0,0 +1,147 @@
+package ntag424
+
+import "fmt"
+
+// ccFileNo is the DESFire file number of the Capability Container (ISO file
+// ID 0xE103) in the NTAG 424 DNA NDEF application.
+const ccFileNo = 0x01
+
+// UsedUnknown is FileStorage.Used when the used size could not be worked out.
+const UsedUnknown = -1
+
+// StorageReport is the storage use of the selected application, as returned
+// by GetStorageReport.
+type StorageReport struct {
+	Files     []FileStorage `json:"files"`
+	Allocated int           `json:"allocated"`  // Sum of the files' allocated sizes
+	Used      int           `json:"used"`       // Sum of the known Used values
+	FreeBytes int           `json:"free_bytes"` // Free EEPROM from GetFreeMemory, UsedUnknown if not reported
+}
+
+// FileStorage is the allocated and used size of one file.
+type FileStorage struct {
+	FileNo    byte   `json:"file_no"`
+	FileType  byte   `json:"file_type"`
+	Allocated int    `json:"allocated"` // FileSettings.Size of a data file, 0 for value and record files
+	Used      int    `json:"used"`      // Bytes in use, UsedUnknown if not known
+	Error     string `json:"error,omitempty"`
+}
+
+// GetFreeMemory returns the free EEPROM of the card in bytes using native
+// FreeMem (90 6E 00 00 00). ok is false if the card does not offer the
+// command; NTAG 424 DNA, with its fixed file layout, answers 911C.
+func GetFreeMemory(card Card) (free int, ok bool, err error) {
+	data, sw, err := Transmit(card, []byte{0x90, 0x6E, 0x00, 0x00, 0x00})
+	if err != nil {
+		return 0, false, err
+	}
+	if commandUnsupported(sw) {
+		return 0, false, nil
+	}
+	if sw != SWDESFireOK {
+		return 0, false, &SWError{Cmd: 0x6E, SW: sw}
+	}
+	if len(data) != 3 {
+		return 0, false, fmt.Errorf("FreeMem response is %d bytes, expected 3", len(data))
+	}
+	return int(data[0]) | int(data[1])<<8 | int(data[2])<<16, true, nil
+}
+
+// GetStorageReport lists every file of the selected application with its
+// allocated size and the bytes in use, plus the card's free EEPROM. Each file
+// is read whole (see ReadFile), so sess is needed for files that cannot be
+// read freely; pass nil to read only those that can.
+//
+// What counts as used depends on the file:
+//   - CC file (1): CCLEN
+//   - NDEF file (2): NLEN plus the 2-byte NLEN field
+//   - any other standard or backup data file: up to the last non-zero byte,
+//     a best guess since the tag does not record how much was written
+//   - value and record files: UsedUnknown
+//
+// A file that cannot be read gets UsedUnknown and the reason in Error. Files
+// come from ListFileIDs. Only a failed GetFileIDs or GetFreeMemory exchange is
+// returned as an error.
+func GetStorageReport(card Card, sess *Session) (*StorageReport, error) {
+	fileNos, err := ListFileIDs(card, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get file IDs: %w", err)
+	}
+
+	files := make([]FileStorage, 0, len(fileNos))
+	for _, fileNo := range fileNos {
+		f := FileStorage{FileNo: fileNo, Used: UsedUnknown}
+		fs, data, err := readFile(card, sess, fileNo)
+		if err != nil {
+			f.Error = err.Error()
+			// The settings may still be readable when the data is not
+			if fs, err = GetFileSettingsPlain(card, fileNo); err == nil {
+				f.setSettings(fs)
+			}
+		} else {
+			f.setSettings(fs)
+			f.Used = fileUsedBytes(fileNo, fs, data)
+		}
+		files = append(files, f)
+	}
+
+	free, ok, err := GetFreeMemory(card)
+	if err != nil {
+		return nil, fmt.Errorf("get free memory: %w", err)
+	}
+	if !ok {
+		free = UsedUnknown
+	}
+	return newStorageReport(files, free), nil
+}
+
+// setSettings fills in FileType and, for data files, Allocated. Value and
+// record files use the size field for limits and record sizes.
+func (f *FileStorage) setSettings(fs *FileSettings) {
+	f.FileType = fs.FileType
+	if fs.FileType <= 0x01 {
+		f.Allocated = fs.Size
+	}
+}
+
+// newStorageReport totals files into a StorageReport.
+func newStorageReport(files []FileStorage, free int) *StorageReport {
+	r := &StorageReport{Files: files, FreeBytes: free}
+	for _, f := range files {
+		r.Allocated += f.Allocated
+		if f.Used != UsedUnknown {
+			r.Used += f.Used
+		}
+	}
+	return r
+}
+
+// fileUsedBytes works out the bytes in use of a file from its contents; see
+// GetStorageReport. The result never exceeds the allocated size.
+func fileUsedBytes(fileNo byte, fs *FileSettings, data []byte) int {
+	if fs.FileType > 0x01 { // value and record files
+		return UsedUnknown
+	}
+	used := 0
+	switch {
+	case fileNo == ccFileNo || fileNo == sdmNDEFFileNo:
+		if len(data) < 2 {
+			return UsedUnknown
+		}
+		used = int(data[0])<<8 | int(data[1])
+		if fileNo == sdmNDEFFileNo {
+			used += 2
+		}
+	default:
+		for i := len(data) - 1; i >= 0; i-- {
+			if data[i] != 0x00 {
+				used = i + 1
+				break
+			}
+		}
+	}
+	if used > fs.Size {
+		used = fs.Size
+	}
+	return used
+}
@@ -0,0 +1,103 @@
+package ntag424
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetStorageReportNTAG424Layout(t *testing.T) {
+	files := map[byte][]byte{
+		0x01: append(ccWithNDEFFile(0xE104), make([]byte, 17)...), // CCLEN 0x000F, 32 allocated
+		0x02: append([]byte{0x00, 0x20}, bytes.Repeat([]byte{0xD1}, 254)...),
+	}
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		switch apdu[1] {
+		case 0x6F:
+			return []byte{0x01, 0x02, 0x03, 0x91, 0x00}, nil
+		case 0x6E:
+			return []byte{0x91, 0x1C}, nil
+		case 0xF5:
+			switch fileNo := apdu[5]; fileNo {
+			case 0x03:
+				return settingsAPDUResponse(0x03, 0x30, 0x33, 128), nil // read needs a key
+			default:
+				return settingsAPDUResponse(0x00, 0xE0, 0xEE, len(files[fileNo])), nil
+			}
+		case 0xBD:
+			fileNo, off, n := readDataArgs(apdu[5:12])
+			return append(append([]byte{}, files[fileNo][off:off+n]...), 0x91, 0x00), nil
+		}
+		t.Fatalf("unexpected APDU % X", apdu)
+		return nil, nil
+	})
+
+	r, err := GetStorageReport(card, nil)
+	if err != nil {
+		t.Fatalf("GetStorageReport returned error: %v", err)
+	}
+	want := []FileStorage{
+		{FileNo: 0x01, Allocated: 32, Used: 15},
+		{FileNo: 0x02, Allocated: 256, Used: 34},
+		{FileNo: 0x03, Allocated: 128, Used: UsedUnknown},
+	}
+	if len(r.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), r.Files)
+	}
+	for i, w := range want {
+		got := r.Files[i]
+		got.Error = ""
+		if got != w {
+			t.Fatalf("file %d: expected %+v, got %+v", w.FileNo, w, r.Files[i])
+		}
+	}
+	if r.Files[2].Error == "" {
+		t.Fatal("expected file 3 to record why it could not be read")
+	}
+	if r.Allocated != 416 || r.Used != 49 || r.FreeBytes != UsedUnknown {
+		t.Fatalf("expected totals 416/49/unknown, got %d/%d/%d", r.Allocated, r.Used, r.FreeBytes)
+	}
+}
+
+func TestStorageReportAggregation(t *testing.T) {
+	std := func(size int) *FileSettings { return &FileSettings{FileType: 0x00, Size: size} }
+	cases := []struct {
+		name   string
+		fileNo byte
+		fs     *FileSettings
+		data   []byte
+		want   int
+	}{
+		{"empty NDEF", 0x02, std(256), make([]byte, 256), 2},
+		{"NLEN past file end", 0x02, std(32), []byte{0x01, 0x00}, 32},
+		{"short NDEF read", 0x02, std(256), []byte{0x00}, UsedUnknown},
+		{"CC", 0x01, std(32), []byte{0x00, 0x17}, 23},
+		{"data up to last non-zero", 0x03, std(128), append([]byte{0, 7, 0, 9}, make([]byte, 124)...), 4},
+		{"all zero data", 0x03, std(128), make([]byte, 128), 0},
+		{"backup file", 0x04, &FileSettings{FileType: 0x01, Size: 8}, []byte{1, 2, 3, 0}, 3},
+		{"value file", 0x05, &FileSettings{FileType: 0x02, Size: 4}, []byte{1, 2, 3, 4}, UsedUnknown},
+	}
+	for _, tt := range cases {
+		if got := fileUsedBytes(tt.fileNo, tt.fs, tt.data); got != tt.want {
+			t.Fatalf("%s: expected %d used bytes, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	r := newStorageReport([]FileStorage{
+		{FileNo: 1, Allocated: 32, Used: 23},
+		{FileNo: 2, Allocated: 256, Used: UsedUnknown},
+		{FileNo: 3, Allocated: 128, Used: 40},
+	}, 7168)
+	if r.Allocated != 416 || r.Used != 63 || r.FreeBytes != 7168 {
+		t.Fatalf("expected totals 416/63/7168, got %d/%d/%d", r.Allocated, r.Used, r.FreeBytes)
+	}
+}
+
+func TestGetFreeMemory(t *testing.T) {
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		return []byte{0x00, 0x1C, 0x00, 0x91, 0x00}, nil
+	})
+	free, ok, err := GetFreeMemory(card)
+	if err != nil || !ok || free != 0x1C00 {
+		t.Fatalf("expected 7168 free bytes, got %d %v %v", free, ok, err)
+	}
+}
@@ -0,0 +1,193 @@
+package ntag424
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Difference is one way two TagReports differ. A and B are the values from
+// the first and second report, rendered for display.
+type Difference struct {
+	Field string // e.g. "file 2 Write", "key slot 1", "NDEF URL template"
+	A, B  string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s vs %s", d.Field, d.A, d.B)
+}
+
+// sdmMirrorParams returns the query parameters whose values the tag
+// rewrites on every tap for URLs laid out as cfg describes: cfg's uid, ctr
+// and mac names plus the picc_data and enc mirrors.
+func sdmMirrorParams(cfg SDMParamConfig) map[string]bool {
+	return map[string]bool{
+		cfg.UIDParam:  true,
+		cfg.CtrParam:  true,
+		cfg.MACParam:  true,
+		piccDataParam: true,
+		piccMACParam:  true,
+		sdmENCParam:   true,
+	}
+}
+
+// DiffTags compares the configuration of two inspected tags, typically a
+// known-good "golden" tag and a suspect one, and lists every difference in
+// file settings (comm mode, SDM, each access condition, size, SDM access
+// rights and offsets), key slot provisioning and the NDEF URL template.
+//
+// Per-tag values are not compared: UID, version, originality signature and
+// the uid/ctr/mac/picc_data/enc values mirrored into the URL. Differences
+// come out in file, key slot, URL order, so the result is stable.
+func DiffTags(a, b *TagReport) []Difference {
+	return DiffTagsWithConfig(a, b, DefaultSDMParamConfig())
+}
+
+// DiffTagsWithConfig is DiffTags for tags whose SDM URLs use the parameter
+// names in cfg, so their mirrored values are masked too.
+func DiffTagsWithConfig(a, b *TagReport, cfg SDMParamConfig) []Difference {
+	var diffs []Difference
+	add := func(field string, av, bv any) {
+		as, bs := fmt.Sprint(av), fmt.Sprint(bv)
+		if as != bs {
+			diffs = append(diffs, Difference{Field: field, A: as, B: bs})
+		}
+	}
+
+	filesA, filesB := fileReportsByNo(a.Files), fileReportsByNo(b.Files)
+	for _, no := range unionKeys(filesA, filesB) {
+		field := fmt.Sprintf("file %d", no)
+		fa, okA := filesA[no]
+		fb, okB := filesB[no]
+		if !okA || !okB {
+			add(field, presence(okA), presence(okB))
+			continue
+		}
+		if fa.Settings == nil || fb.Settings == nil {
+			add(field+" settings", settingsState(fa), settingsState(fb))
+			continue
+		}
+		diffFileSettings(field, fa.Settings, fb.Settings, add)
+	}
+
+	slotsA, slotsB := keySlotsByNo(a.KeySlots), keySlotsByNo(b.KeySlots)
+	for _, slot := range unionKeys(slotsA, slotsB) {
+		ka, okA := slotsA[slot]
+		kb, okB := slotsB[slot]
+		if !okA || !okB {
+			add(fmt.Sprintf("key slot %d", slot), presence(okA), presence(okB))
+			continue
+		}
+		add(fmt.Sprintf("key slot %d", slot), keySlotState(ka), keySlotState(kb))
+	}
+
+	mirrored := sdmMirrorParams(cfg)
+	add("NDEF URL template", ndefURLTemplate(a.NDEFURL, mirrored), ndefURLTemplate(b.NDEFURL, mirrored))
+	return diffs
+}
+
+// diffFileSettings reports the settings fields that differ between fa and fb.
+func diffFileSettings(field string, fa, fb *FileSettings, add func(string, any, any)) {
+	add(field+" comm mode", CommMode(fa.FileOption&0x03), CommMode(fb.FileOption&0x03))
+	add(field+" SDM", fa.FileOption&0x40 != 0, fb.FileOption&0x40 != 0)
+
+	ara, arb := fa.AccessRights(), fb.AccessRights()
+	add(field+" Read", accessCondName(ara.Read), accessCondName(arb.Read))
+	add(field+" Write", accessCondName(ara.Write), accessCondName(arb.Write))
+	add(field+" ReadWrite", accessCondName(ara.ReadWrite), accessCondName(arb.ReadWrite))
+	add(field+" Change", accessCondName(ara.ChangeAccessRights), accessCondName(arb.ChangeAccessRights))
+	add(field+" size", fa.Size, fb.Size)
+
+	if fa.FileOption&0x40 == 0 && fb.FileOption&0x40 == 0 {
+		return
+	}
+	add(field+" SDMOptions", fmt.Sprintf("0x%02X", fa.SDMOptions), fmt.Sprintf("0x%02X", fb.SDMOptions))
+	add(field+" SDMMetaRead", accessCondName(fa.SDMMeta), accessCondName(fb.SDMMeta))
+	add(field+" SDMFileRead", accessCondName(fa.SDMFile), accessCondName(fb.SDMFile))
+	add(field+" SDMCtrRet", accessCondName(fa.SDMCtr), accessCondName(fb.SDMCtr))
+	for _, o := range []struct {
+		name string
+		a, b uint32
+	}{
+		{"UIDOffset", fa.UIDOffset, fb.UIDOffset},
+		{"CtrOffset", fa.CtrOffset, fb.CtrOffset},
+		{"PICCDataOffset", fa.PICCDataOffset, fb.PICCDataOffset},
+		{"MACInputOffset", fa.MACInputOffset, fb.MACInputOffset},
+		{"MACOffset", fa.MACOffset, fb.MACOffset},
+		{"ENCOffset", fa.ENCOffset, fb.ENCOffset},
+		{"ENCLength", fa.ENCLength, fb.ENCLength},
+		{"CtrLimit", fa.CtrLimit, fb.CtrLimit},
+	} {
+		add(field+" "+o.name, o.a, o.b)
+	}
+}
+
+func presence(ok bool) string {
+	if ok {
+		return "present"
+	}
+	return "missing"
+}
+
+func settingsState(f FileReport) string {
+	if f.Settings != nil {
+		return "read"
+	}
+	return "unreadable (" + f.Error + ")"
+}
+
+func keySlotState(k KeySlotReport) string {
+	if k.MatchedKey == "" || k.MatchedKey == FactoryKeyName {
+		return string(k.State)
+	}
+	return fmt.Sprintf("%s (%s)", k.State, k.MatchedKey)
+}
+
+// ndefURLTemplate masks the values of the mirrored parameters in rawURL,
+// keeping the parameter order, so URLs read from two tags compare equal when
+// only the mirrored values differ.
+func ndefURLTemplate(rawURL string, mirrored map[string]bool) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	parts := strings.Split(query, "&")
+	for i, p := range parts {
+		if k, _, found := strings.Cut(p, "="); found && mirrored[k] {
+			parts[i] = k + "=*"
+		}
+	}
+	return base + "?" + strings.Join(parts, "&")
+}
+
+func fileReportsByNo(files []FileReport) map[byte]FileReport {
+	m := make(map[byte]FileReport, len(files))
+	for _, f := range files {
+		m[f.FileNo] = f
+	}
+	return m
+}
+
+func keySlotsByNo(slots []KeySlotReport) map[byte]KeySlotReport {
+	m := make(map[byte]KeySlotReport, len(slots))
+	for _, s := range slots {
+		m[s.Slot] = s
+	}
+	return m
+}
+
+// unionKeys returns the keys of a and b, sorted.
+func unionKeys[V any](a, b map[byte]V) []byte {
+	seen := make(map[byte]bool, len(a)+len(b))
+	var keys []byte
+	for _, m := range []map[byte]V{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,87 @@
+package ntag424
+
+import "testing"
+
+// goldenReport is a provisioned tag: SDM on the NDEF file, slots 0-2 on
+// production keys.
+func goldenReport(uid []byte, url string) *TagReport {
+	return &TagReport{
+		UID: uid,
+		Files: []FileReport{
+			{FileNo: 1, Settings: &FileSettings{AR1: 0x00, AR2: 0xE0, Size: 32}},
+			{FileNo: 2, Settings: &FileSettings{
+				FileOption: 0x40, AR1: 0x00, AR2: 0xE2, Size: 256,
+				SDMOptions: 0xC1, SDMMeta: 0x0E, SDMFile: 0x02, SDMCtr: 0x0F,
+				UIDOffset: 41, CtrOffset: 59, MACInputOffset: 41, MACOffset: 70,
+			}},
+			{FileNo: 3, Settings: &FileSettings{FileOption: 0x03, AR1: 0x30, AR2: 0x33, Size: 128}},
+		},
+		KeySlots: []KeySlotReport{
+			{Slot: 0, State: KeySlotProvisioned, MatchedKey: "master"},
+			{Slot: 1, State: KeySlotDefault, MatchedKey: FactoryKeyName},
+			{Slot: 2, State: KeySlotProvisioned, MatchedKey: "sdm"},
+		},
+		NDEFURL: url,
+	}
+}
+
+func TestDiffTagsIdentical(t *testing.T) {
+	a := goldenReport(testUID, "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00002A&mac=0011223344556677")
+	b := goldenReport([]byte{0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, "https://example.com/tap?uid=04000000000001&ctr=000003&mac=8899AABBCCDDEEFF")
+	if diffs := DiffTags(a, b); len(diffs) != 0 {
+		t.Fatalf("expected no differences between tags with the same configuration, got %v", diffs)
+	}
+}
+
+func TestDiffTagsOneAccessRightNibble(t *testing.T) {
+	url := "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00002A&mac=0011223344556677"
+	a, b := goldenReport(testUID, url), goldenReport(testUID, url)
+	b.Files[1].Settings.AR2 = 0xEE // Write: slot2 -> free
+
+	diffs := DiffTags(a, b)
+	want := Difference{Field: "file 2 Write", A: "slot2", B: "free"}
+	if len(diffs) != 1 || diffs[0] != want {
+		t.Fatalf("expected only %v, got %v", want, diffs)
+	}
+}
+
+func TestDiffTagsReportsConfigDrift(t *testing.T) {
+	a := goldenReport(testUID, "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00002A&mac=0011223344556677")
+	b := goldenReport(testUID, "https://example.org/tap?uid=041E3C5A7B6F80&ctr=00002A&mac=0011223344556677")
+	b.Files[1].Settings.MACOffset = 71
+	b.Files = b.Files[:2]
+	b.KeySlots[2] = KeySlotReport{Slot: 2, State: KeySlotUnknown}
+
+	got := map[string]bool{}
+	for _, d := range DiffTags(a, b) {
+		got[d.Field] = true
+	}
+	for _, field := range []string{"file 2 MACOffset", "file 3", "key slot 2", "NDEF URL template"} {
+		if !got[field] {
+			t.Errorf("expected a difference in %q, got %v", field, got)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("expected 4 differences, got %v", got)
+	}
+}
+
+func TestDiffTagsMasksENCMirror(t *testing.T) {
+	a := goldenReport(testUID, "https://example.com/tap?uid=041E3C5A7B6F80&ctr=00002A&enc=00112233445566778899AABBCCDDEEFF&mac=0011223344556677")
+	b := goldenReport(testUID, "https://example.com/tap?uid=04000000000001&ctr=000003&enc=FFEEDDCCBBAA99887766554433221100&mac=8899AABBCCDDEEFF")
+	if diffs := DiffTags(a, b); len(diffs) != 0 {
+		t.Fatalf("expected no differences between ENC tags with the same configuration, got %v", diffs)
+	}
+}
+
+func TestDiffTagsWithConfigMasksCustomParams(t *testing.T) {
+	cfg := SDMParamConfig{UIDParam: "u", CtrParam: "c", MACParam: "m"}
+	a := goldenReport(testUID, "https://example.com/tap?u=041E3C5A7B6F80&c=00002A&m=0011223344556677")
+	b := goldenReport(testUID, "https://example.com/tap?u=04000000000001&c=000003&m=8899AABBCCDDEEFF")
+	if diffs := DiffTagsWithConfig(a, b, cfg); len(diffs) != 0 {
+		t.Fatalf("expected no differences with custom parameter names masked, got %v", diffs)
+	}
+	if diffs := DiffTags(a, b); len(diffs) != 1 || diffs[0].Field != "NDEF URL template" {
+		t.Fatalf("expected the default names to leave u/c/m unmasked, got %v", diffs)
+	}
+}
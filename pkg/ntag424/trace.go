@@ -0,0 +1,70 @@
+package ntag424
+
+import (
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// apduTrace is the state set by EnableAPDUTrace.
+var apduTrace struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	redact bool
+}
+
+// EnableAPDUTrace logs every APDU sent through Transmit, with its response
+// or transmit error, to w as one JSON object per line:
+//
+//	{"time":"...","level":"INFO","msg":"apdu","cmd":"90AF0000...","resp":"...","sw":"9100"}
+//
+// When redactKeys is set, the debug lines that carry key material (the
+// EV2First RndA/RndB and session keys Kenc/Kmac) are suppressed from the
+// default slog logger too, so a trace and debug log can be attached to a bug
+// report. The APDUs themselves are never redacted: key changes and
+// authentication are encrypted on the wire, but the trace still records
+// UIDs and any plain file contents.
+//
+// A nil w turns tracing off. Redaction stays as last set.
+func EnableAPDUTrace(w io.Writer, redactKeys bool) {
+	apduTrace.mu.Lock()
+	defer apduTrace.mu.Unlock()
+	apduTrace.redact = redactKeys
+	if w == nil {
+		apduTrace.logger = nil
+		return
+	}
+	apduTrace.logger = slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// redactKeyMaterial reports whether debug logging of key material is
+// suppressed (see EnableAPDUTrace).
+func redactKeyMaterial() bool {
+	apduTrace.mu.Lock()
+	defer apduTrace.mu.Unlock()
+	return apduTrace.redact
+}
+
+// traceAPDU records one Transmit exchange if tracing is enabled.
+func traceAPDU(apdu, resp []byte, err error) {
+	apduTrace.mu.Lock()
+	defer apduTrace.mu.Unlock()
+	if apduTrace.logger == nil {
+		return
+	}
+	cmd := strings.ToUpper(hex.EncodeToString(apdu))
+	if err != nil {
+		apduTrace.logger.Info("apdu", "cmd", cmd, "error", err.Error())
+		return
+	}
+	if len(resp) < 2 {
+		apduTrace.logger.Info("apdu", "cmd", cmd, "resp", strings.ToUpper(hex.EncodeToString(resp)))
+		return
+	}
+	apduTrace.logger.Info("apdu",
+		"cmd", cmd,
+		"resp", strings.ToUpper(hex.EncodeToString(resp[:len(resp)-2])),
+		"sw", strings.ToUpper(hex.EncodeToString(resp[len(resp)-2:])))
+}
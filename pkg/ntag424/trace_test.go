@@ -0,0 +1,65 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// traceAuth authenticates against a keyTag with debug logging captured and
+// returns the trace, the debug log and the session.
+func traceAuth(t *testing.T, redact bool) (trace, debug string, sess *Session) {
+	t.Helper()
+	var traceBuf, debugBuf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&debugBuf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	EnableAPDUTrace(&traceBuf, redact)
+	t.Cleanup(func() {
+		EnableAPDUTrace(nil, false)
+		slog.SetDefault(prev)
+	})
+
+	tag := newKeyTag(t)
+	sess, err := AuthenticateEV2First(tag, tag.keys[0], 0)
+	if err != nil {
+		t.Fatalf("AuthenticateEV2First returned error: %v", err)
+	}
+	return traceBuf.String(), debugBuf.String(), sess
+}
+
+func TestAPDUTraceRecordsExchanges(t *testing.T) {
+	trace, _, _ := traceAuth(t, true)
+	lines := strings.Split(strings.TrimSpace(trace), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 traced APDUs for EV2First, got %d:\n%s", len(lines), trace)
+	}
+	if !strings.Contains(lines[0], `"cmd":"9071000002000000"`) || !strings.Contains(lines[0], `"sw":"91AF"`) {
+		t.Fatalf("expected EV2First part 1 with SW 91AF, got %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"sw":"9100"`) {
+		t.Fatalf("expected EV2First part 2 with SW 9100, got %s", lines[1])
+	}
+}
+
+func TestAPDUTraceRedactsKeyMaterial(t *testing.T) {
+	trace, debug, sess := traceAuth(t, true)
+	kenc := strings.ToUpper(hex.EncodeToString(sess.kenc[:]))
+	kmac := strings.ToUpper(hex.EncodeToString(sess.kmac[:]))
+	for _, out := range []string{trace, debug} {
+		for _, secret := range []string{kenc, kmac, "kenc=", "kmac=", "rndA=", "rndB="} {
+			if strings.Contains(out, secret) {
+				t.Fatalf("expected %q to be redacted, got:\n%s", secret, out)
+			}
+		}
+	}
+	if !strings.Contains(debug, "session keys derived") {
+		t.Fatalf("expected the session debug line without keys, got:\n%s", debug)
+	}
+
+	_, debug, sess = traceAuth(t, false)
+	if !strings.Contains(debug, strings.ToUpper(hex.EncodeToString(sess.kenc[:]))) {
+		t.Fatalf("expected kenc in the debug log without redaction, got:\n%s", debug)
+	}
+}
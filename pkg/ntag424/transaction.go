@@ -0,0 +1,31 @@
+package ntag424
+
+import "fmt"
+
+// CommitTransaction validates all pending writes to backup data, value and
+// record files (DESFire CommitTransaction, INS 0xC7).
+//
+// NTAG 424 DNA files are standard data files (FileType 0x00), whose writes
+// take effect immediately, so the tools in this repo never need it. DESFire
+// EV1/EV2/EV3 cards with backup data files (FileType 0x01) do: their writes
+// stay invisible until committed.
+//
+// The command is sent in MAC mode: there is no command data, so SsmCmdFull
+// only MACs the command and verifies the response MAC. Requires an active
+// session; cmdCtr advances on success.
+func CommitTransaction(card Card, sess *Session) error {
+	if _, err := SsmCmdFull(card, sess, 0xC7, nil, nil); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AbortTransaction discards all pending writes to backup data, value and
+// record files (DESFire AbortTransaction, INS 0xA7). See CommitTransaction
+// for when this applies.
+func AbortTransaction(card Card, sess *Session) error {
+	if _, err := SsmCmdFull(card, sess, 0xA7, nil, nil); err != nil {
+		return fmt.Errorf("abort transaction: %w", err)
+	}
+	return nil
+}
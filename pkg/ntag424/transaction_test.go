@@ -0,0 +1,67 @@
+package ntag424
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTransactionCommandsAreMACOnly(t *testing.T) {
+	cases := []struct {
+		name string
+		ins  byte
+		fn   func(Card, *Session) error
+	}{
+		{"commit", 0xC7, CommitTransaction},
+		{"abort", 0xA7, AbortTransaction},
+	}
+	for _, tc := range cases {
+		sess := testSession()
+		tag := *sess
+		var sent []byte
+		card := apduFunc(func(apdu []byte) ([]byte, error) {
+			sent = append([]byte{}, apdu...)
+			if data := ssmDecryptCommand(t, &tag, apdu, 0); data != nil {
+				t.Fatalf("%s: expected no command data, got % X", tc.name, data)
+			}
+			resp := ssmResponse(t, &tag, nil)
+			tag.cmdCtr++
+			return resp, nil
+		})
+
+		if err := tc.fn(card, sess); err != nil {
+			t.Fatalf("%s returned error: %v", tc.name, err)
+		}
+		// 90 INS 00 00 Lc=08 MACt(8) Le=00
+		if len(sent) != 14 || !bytes.Equal(sent[:5], []byte{0x90, tc.ins, 0x00, 0x00, 0x08}) || sent[13] != 0x00 {
+			t.Fatalf("%s: unexpected APDU % X", tc.name, sent)
+		}
+		if sess.cmdCtr != 1 {
+			t.Fatalf("%s: expected cmdCtr 1, got %d", tc.name, sess.cmdCtr)
+		}
+	}
+}
+
+func TestCommitTransactionRejectsBadResponse(t *testing.T) {
+	sess := testSession()
+	tag := *sess
+	card := apduFunc(func(apdu []byte) ([]byte, error) {
+		resp := ssmResponse(t, &tag, nil)
+		resp[0] ^= 0x01
+		return resp, nil
+	})
+	if err := CommitTransaction(card, sess); err == nil {
+		t.Fatalf("expected response MAC mismatch")
+	}
+	if sess.cmdCtr != 0 {
+		t.Fatalf("expected cmdCtr unchanged on failure, got %d", sess.cmdCtr)
+	}
+
+	card = apduFunc(func(apdu []byte) ([]byte, error) {
+		return []byte{0x91, 0x0C}, nil
+	})
+	var swErr *SWError
+	if err := AbortTransaction(card, sess); !errors.As(err, &swErr) || swErr.SW != 0x910C {
+		t.Fatalf("expected SWError 910C, got %v", err)
+	}
+}
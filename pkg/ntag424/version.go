@@ -1,29 +1,49 @@
 package ntag424
 
-import "fmt"
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
 // TagVersion holds the hardware and software version information from GetVersion.
 // From ro/card.go:10-30.
 type TagVersion struct {
-	HWVendorID    byte   // Hardware vendor ID
-	HWType        byte   // Hardware type
-	HWSubType     byte   // Hardware subtype
-	HWMajorVer    byte   // Hardware major version
-	HWMinorVer    byte   // Hardware minor version
-	HWStorageSize byte   // Hardware storage size
-	HWProtocol    byte   // Hardware protocol
-	SWVendorID    byte   // Software vendor ID
-	SWType        byte   // Software type
-	SWSubType     byte   // Software subtype
-	SWMajorVer    byte   // Software major version
-	SWMinorVer    byte   // Software minor version
-	SWStorageSize byte   // Software storage size
-	SWProtocol    byte   // Software protocol
-	UID           []byte // 7-byte UID
-	BatchNo       []byte // 5-byte batch number
-	FabKey        byte   // Fabrication key
-	ProdYear      byte   // Production year (BCD)
-	ProdWeek      byte   // Production week (nibble)
+	HWVendorID    byte   `json:"hw_vendor_id"`    // Hardware vendor ID
+	HWType        byte   `json:"hw_type"`         // Hardware type
+	HWSubType     byte   `json:"hw_sub_type"`     // Hardware subtype
+	HWMajorVer    byte   `json:"hw_major_ver"`    // Hardware major version
+	HWMinorVer    byte   `json:"hw_minor_ver"`    // Hardware minor version
+	HWStorageSize byte   `json:"hw_storage_size"` // Hardware storage size
+	HWProtocol    byte   `json:"hw_protocol"`     // Hardware protocol
+	SWVendorID    byte   `json:"sw_vendor_id"`    // Software vendor ID
+	SWType        byte   `json:"sw_type"`         // Software type
+	SWSubType     byte   `json:"sw_sub_type"`     // Software subtype
+	SWMajorVer    byte   `json:"sw_major_ver"`    // Software major version
+	SWMinorVer    byte   `json:"sw_minor_ver"`    // Software minor version
+	SWStorageSize byte   `json:"sw_storage_size"` // Software storage size
+	SWProtocol    byte   `json:"sw_protocol"`     // Software protocol
+	UID           []byte `json:"uid"`             // 7-byte UID
+	BatchNo       []byte `json:"batch_no"`        // Batch number (first 36 bits of these 5 bytes)
+	FabKey        byte   `json:"fab_key"`         // Fabrication key (5 bits)
+	ProdYear      byte   `json:"prod_year"`       // Production year (BCD, 0x23 = 2023)
+	ProdWeek      byte   `json:"prod_week"`       // Production calendar week (BCD)
+}
+
+// MarshalJSON encodes UID and BatchNo as uppercase hex instead of base64 so
+// the output matches what the tools print.
+func (v TagVersion) MarshalJSON() ([]byte, error) {
+	type plain TagVersion
+	return json.Marshal(struct {
+		plain
+		UID     string `json:"uid"`
+		BatchNo string `json:"batch_no"`
+	}{
+		plain:   plain(v),
+		UID:     strings.ToUpper(hex.EncodeToString(v.UID)),
+		BatchNo: strings.ToUpper(hex.EncodeToString(v.BatchNo)),
+	})
 }
 
 // GetVersion retrieves the tag version information using DESFire GetVersion (INS 0x60).
@@ -40,8 +60,11 @@ func GetVersion(card Card) (*TagVersion, error) {
 	if err != nil {
 		return nil, err
 	}
-	if sw != SWMoreData || len(resp1) != 7 {
-		return nil, fmt.Errorf("GetVersion part 1 failed (SW=%04X len=%d)", sw, len(resp1))
+	if sw != SWMoreData {
+		return nil, fmt.Errorf("GetVersion part 1: %w", &SWError{Cmd: 0x60, SW: sw})
+	}
+	if len(resp1) != 7 {
+		return nil, fmt.Errorf("GetVersion part 1 returned %d bytes, expected 7", len(resp1))
 	}
 
 	// Second part: 0xAF (Additional Frame)
@@ -50,8 +73,11 @@ func GetVersion(card Card) (*TagVersion, error) {
 	if err != nil {
 		return nil, err
 	}
-	if sw != SWMoreData || len(resp2) != 7 {
-		return nil, fmt.Errorf("GetVersion part 2 failed (SW=%04X len=%d)", sw, len(resp2))
+	if sw != SWMoreData {
+		return nil, fmt.Errorf("GetVersion part 2: %w", &SWError{Cmd: 0xAF, SW: sw})
+	}
+	if len(resp2) != 7 {
+		return nil, fmt.Errorf("GetVersion part 2 returned %d bytes, expected 7", len(resp2))
 	}
 
 	// Third part: 0xAF (Additional Frame)
@@ -60,8 +86,11 @@ func GetVersion(card Card) (*TagVersion, error) {
 	if err != nil {
 		return nil, err
 	}
-	if !SwOK(sw) || len(resp3) != 14 {
-		return nil, fmt.Errorf("GetVersion part 3 failed (SW=%04X len=%d)", sw, len(resp3))
+	if !SwOK(sw) {
+		return nil, fmt.Errorf("GetVersion part 3: %w", &SWError{Cmd: 0xAF, SW: sw})
+	}
+	if len(resp3) != 14 {
+		return nil, fmt.Errorf("GetVersion part 3 returned %d bytes, expected 14", len(resp3))
 	}
 
 	v := &TagVersion{
@@ -81,9 +110,36 @@ func GetVersion(card Card) (*TagVersion, error) {
 		SWProtocol:    resp2[6],
 		UID:           resp3[0:7],
 		BatchNo:       resp3[7:12],
-		FabKey:        resp3[12],
-		ProdYear:      resp3[13] >> 4,
-		ProdWeek:      resp3[13] & 0x0F,
+		FabKey:        (resp3[11]&0x0F)<<1 | resp3[12]>>7,
+		ProdYear:      resp3[13],
+		ProdWeek:      resp3[12] & 0x7F,
 	}
 	return v, nil
 }
+
+// ProductionDate returns the production year (e.g. 2023) and calendar week
+// decoded from the BCD ProdYear and ProdWeek bytes.
+func (v *TagVersion) ProductionDate() (year int, week int) {
+	return 2000 + fromBCD(v.ProdYear), fromBCD(v.ProdWeek)
+}
+
+// StorageBytes decodes HWStorageSize: bits 7-1 hold n and the storage is
+// 2^n bytes. If bit 0 is set the real size lies between 2^n and 2^(n+1)
+// (NTAG 424 DNA reports 0x11: 416 bytes, more than 256); the lower bound
+// 2^n is returned.
+func (v *TagVersion) StorageBytes() int {
+	return 1 << (v.HWStorageSize >> 1)
+}
+
+// IsNTAG424DNA reports whether the hardware version bytes identify an NTAG
+// 424 DNA or NTAG 424 DNA TagTamper: vendor NXP (0x04), type NTAG (0x04),
+// subtype 0x02 (50 pF) or 0x08 (TagTamper) and major version 0x30.
+func (v *TagVersion) IsNTAG424DNA() bool {
+	return v.HWVendorID == 0x04 && v.HWType == 0x04 &&
+		(v.HWSubType == 0x02 || v.HWSubType == 0x08) && v.HWMajorVer == 0x30
+}
+
+// fromBCD decodes a two-digit BCD byte.
+func fromBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0F)
+}
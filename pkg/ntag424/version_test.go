@@ -0,0 +1,67 @@
+package ntag424
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTagVersionMarshalJSONUsesHex(t *testing.T) {
+	v := TagVersion{HWVendorID: 0x04, HWType: 0x04, UID: testUID, BatchNo: []byte{0xCA, 0xFE, 0x00, 0x01, 0x02}, ProdYear: 0x23}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error: %v", err)
+	}
+	s := string(b)
+	for _, want := range []string{`"uid":"041E3C5A7B6F80"`, `"batch_no":"CAFE000102"`, `"hw_vendor_id":4`, `"prod_year":35`} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("expected %s in %s", want, s)
+		}
+	}
+	if strings.Count(s, `"uid"`) != 1 {
+		t.Fatalf("expected a single uid field, got %s", s)
+	}
+}
+
+func TestGetVersionDecoding(t *testing.T) {
+	// NTAG 424 DNA: HW and SW parts, then UID, batch, FabKey 0x15 and week
+	// 14 of 2023.
+	card := NewFakeCard(
+		FakeExchange{Command: []byte{0x90, 0x60, 0x00, 0x00, 0x00}, Response: mustHex(t, "0404023000110591AF")},
+		FakeExchange{Command: []byte{0x90, 0xAF, 0x00, 0x00, 0x00}, Response: mustHex(t, "0404020102110591AF")},
+		FakeExchange{Command: []byte{0x90, 0xAF, 0x00, 0x00, 0x00}, Response: mustHex(t, "041E3C5A7B6F80CF39A4125A94239100")},
+	)
+	v, err := GetVersion(card)
+	if err != nil {
+		t.Fatalf("GetVersion returned error: %v", err)
+	}
+	if err := card.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(v.UID, testUID) || !bytes.Equal(v.BatchNo, mustHex(t, "CF39A4125A")) {
+		t.Fatalf("unexpected UID/batch % X / % X", v.UID, v.BatchNo)
+	}
+	if v.FabKey != 0x15 {
+		t.Fatalf("expected FabKey 0x15, got 0x%02X", v.FabKey)
+	}
+	if year, week := v.ProductionDate(); year != 2023 || week != 14 {
+		t.Fatalf("expected 2023 week 14, got %d week %d", year, week)
+	}
+	if got := v.StorageBytes(); got != 256 {
+		t.Fatalf("expected storage lower bound 256, got %d", got)
+	}
+	if !v.IsNTAG424DNA() {
+		t.Fatal("expected NTAG 424 DNA")
+	}
+
+	v.HWMajorVer = 0x10 // NTAG 413 DNA
+	if v.IsNTAG424DNA() {
+		t.Fatal("expected NTAG 413 DNA not to match")
+	}
+	v.HWStorageSize = 0x1A // DESFire 8 KB
+	if got := v.StorageBytes(); got != 8192 {
+		t.Fatalf("expected 8192, got %d", got)
+	}
+}
@@ -17,6 +17,8 @@ const configFileName = "config.yaml"
 func main() {
 	verbose := flag.Bool("v", false, "enable debug logging")
 	logFormat := flag.String("log-format", "text", "log format: text or json")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
+	dryRun := flag.Bool("dry-run", false, "read the tag and print the planned changes without writing anything")
 	flag.Parse()
 
 	// Configure slog
@@ -30,6 +32,14 @@ func main() {
 	} else {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
 	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("-trace: %v", err)
+		}
+		defer f.Close()
+		ntag424.EnableAPDUTrace(f, true)
+	}
 
 	// Load config
 	configPath, err := defaultConfigPath()
@@ -84,12 +94,27 @@ func main() {
 	fmt.Printf("Using reader [%d]: %s\n", conn.ReaderIdx, conn.Reader)
 
 	// Reset tag
-	fmt.Println("Resetting tag to factory defaults...")
-	if err := resetTag(conn, appMasterKey, sdmKey, ndefKey, fileThreeKey); err != nil {
+	var m tagMutator = cardMutator{conn: conn}
+	if *dryRun {
+		m = dryRunMutator{}
+		fmt.Println("Dry run: planning reset to factory defaults (no changes will be applied)...")
+	} else {
+		fmt.Println("Resetting tag to factory defaults...")
+	}
+	// Hold the card for the whole reset so no other process interleaves
+	// APDUs with the secure session.
+	err = conn.WithTransaction(func() error {
+		return resetTag(conn, m, appMasterKey, sdmKey, ndefKey, fileThreeKey)
+	})
+	if err != nil {
 		log.Fatalf("reset tag failed: %v", err)
 	}
 
-	fmt.Println("Tag successfully reset to factory defaults!")
+	if *dryRun {
+		fmt.Println("Dry run complete; tag was not modified.")
+	} else {
+		fmt.Println("Tag successfully reset to factory defaults!")
+	}
 }
 
 func defaultConfigPath() (string, error) {
@@ -15,12 +15,78 @@ const (
 	authDefaultKeyNo = 0x00
 )
 
+// tagMutator performs the state-changing commands of a reset. resetTag
+// does all reads and authentication itself and routes every write through
+// a tagMutator, so a dry run only has to swap the implementation.
+//
+// DryRun reports whether the writes are only planned. resetTag asks the
+// mutator rather than checking its type, so a wrapper (logging, tracing)
+// around a dry-run mutator stays a dry run.
+type tagMutator interface {
+	DryRun() bool
+	ChangeKey(sess *ntag424.Session, keyNo byte, newKey, oldKey []byte, keyVersion, authSlot byte) error
+	ChangeKeySame(sess *ntag424.Session, keyNo byte, newKey []byte, keyVersion byte) error
+	ChangeFileSettingsBasic(sess *ntag424.Session, fileNo, fileOption, ar1, ar2 byte) error
+	WriteNDEFPlain(data []byte) error
+}
+
+// cardMutator sends the commands to the tag.
+type cardMutator struct {
+	conn *ntag424.Connection
+}
+
+func (cardMutator) DryRun() bool { return false }
+
+func (m cardMutator) ChangeKey(sess *ntag424.Session, keyNo byte, newKey, oldKey []byte, keyVersion, authSlot byte) error {
+	return ntag424.ChangeKey(m.conn, sess, keyNo, newKey, oldKey, keyVersion, authSlot)
+}
+
+func (m cardMutator) ChangeKeySame(sess *ntag424.Session, keyNo byte, newKey []byte, keyVersion byte) error {
+	return ntag424.ChangeKeySame(m.conn, sess, keyNo, newKey, keyVersion)
+}
+
+// ChangeFileSettingsBasic tolerates SW=9140 so re-running reset on a tag
+// that already has factory settings succeeds.
+func (m cardMutator) ChangeFileSettingsBasic(sess *ntag424.Session, fileNo, fileOption, ar1, ar2 byte) error {
+	return ntag424.ChangeFileSettingsBasicIdempotent(m.conn, sess, fileNo, fileOption, ar1, ar2)
+}
+
+func (m cardMutator) WriteNDEFPlain(data []byte) error {
+	return ntag424.WriteNDEFPlain(m.conn, data)
+}
+
+// dryRunMutator prints each planned command and leaves the tag untouched.
+type dryRunMutator struct{}
+
+func (dryRunMutator) DryRun() bool { return true }
+
+func (dryRunMutator) ChangeKey(_ *ntag424.Session, keyNo byte, _, _ []byte, keyVersion, authSlot byte) error {
+	fmt.Printf("  [dry run] would ChangeKey slot %d -> zeros (version 0x%02X, auth slot %d)\n", keyNo, keyVersion, authSlot)
+	return nil
+}
+
+func (dryRunMutator) ChangeKeySame(_ *ntag424.Session, keyNo byte, _ []byte, keyVersion byte) error {
+	fmt.Printf("  [dry run] would ChangeKey slot %d (same slot) -> zeros (version 0x%02X)\n", keyNo, keyVersion)
+	return nil
+}
+
+func (dryRunMutator) ChangeFileSettingsBasic(_ *ntag424.Session, fileNo, fileOption, ar1, ar2 byte) error {
+	fmt.Printf("  [dry run] would ChangeFileSettings file %d: FileOption=0x%02X, AR1=0x%02X, AR2=0x%02X\n", fileNo, fileOption, ar1, ar2)
+	return nil
+}
+
+func (dryRunMutator) WriteNDEFPlain(data []byte) error {
+	fmt.Printf("  [dry run] would write %d-byte NDEF file (% X)\n", len(data), data)
+	return nil
+}
+
 // tryChangeKey attempts to change a key slot, trying primaryOld first, then falling back to altOld if different.
 // On fallback, re-authenticates with authKey to get a fresh session before retrying.
 // Returns the (possibly refreshed) session for subsequent operations.
-func tryChangeKey(conn *ntag424.Connection, sess *ntag424.Session, keyNo byte, newKey, primaryOld, altOld, authKey []byte) (*ntag424.Session, error) {
-	// Try with primary old key first (use keyVersion 0x00 for factory defaults)
-	err := ntag424.ChangeKey(conn, sess, keyNo, newKey, primaryOld, 0x00, authDefaultKeyNo)
+func tryChangeKey(conn *ntag424.Connection, m tagMutator, sess *ntag424.Session, keyNo byte, newKey, primaryOld, altOld, authKey []byte) (*ntag424.Session, error) {
+	// Try with primary old key first. keyVersion is the version stored with
+	// the new key (0x00, factory default); the old version is not sent.
+	err := m.ChangeKey(sess, keyNo, newKey, primaryOld, 0x00, authDefaultKeyNo)
 	if err == nil {
 		return sess, nil
 	}
@@ -43,7 +109,7 @@ func tryChangeKey(conn *ntag424.Connection, sess *ntag424.Session, keyNo byte, n
 	}
 
 	// Retry with alternative old key (use keyVersion 0x00 for factory defaults)
-	err = ntag424.ChangeKey(conn, newSess, keyNo, newKey, altOld, 0x00, authDefaultKeyNo)
+	err = m.ChangeKey(newSess, keyNo, newKey, altOld, 0x00, authDefaultKeyNo)
 	if err != nil {
 		return newSess, err
 	}
@@ -51,6 +117,45 @@ func tryChangeKey(conn *ntag424.Connection, sess *ntag424.Session, keyNo byte, n
 	return newSess, nil
 }
 
+// readKeyVersions reads the versions of key slots 0-4 over sess and prints
+// them. A failed read ends the session on the tag, so reading stops there,
+// slot 0 is authenticated again with authKey and the slots not read are left
+// out of the map. Returns the session to continue with.
+func readKeyVersions(conn *ntag424.Connection, sess *ntag424.Session, authKey []byte) (map[byte]byte, *ntag424.Session, error) {
+	versions := make(map[byte]byte)
+	fmt.Println("\nKey versions:")
+	for slot := byte(0); slot <= 4; slot++ {
+		v, err := ntag424.GetKeyVersion(conn, sess, slot)
+		if err != nil {
+			fmt.Printf("  Warning: could not read slot %d version (will guess old keys): %v\n", slot, err)
+			if err := ntag424.SelectNDEFApp(conn); err != nil {
+				return nil, nil, fmt.Errorf("re-select after key version read: %w", err)
+			}
+			sess, err = ntag424.AuthenticateEV2First(conn, authKey, authDefaultKeyNo)
+			if err != nil {
+				return nil, nil, fmt.Errorf("re-authenticate after key version read: %w", err)
+			}
+			break
+		}
+		versions[slot] = v
+		fmt.Printf("  Slot %d: 0x%02X\n", slot, v)
+	}
+	return versions, sess, nil
+}
+
+// oldKeyOrder picks which old key to try first when resetting slot: the
+// provisioned key if the slot's version is non-zero, zeros if it is 0x00.
+// Without a version it follows the tag as a whole (provisioned).
+func oldKeyOrder(versions map[byte]byte, slot byte, provisioned bool, provisionedKey, zeroKey []byte) (primary, alt []byte) {
+	if v, ok := versions[slot]; ok {
+		provisioned = v != 0x00
+	}
+	if provisioned {
+		return provisionedKey, zeroKey
+	}
+	return zeroKey, provisionedKey
+}
+
 // resetTag resets an NTAG 424 DNA tag to factory defaults by reversing all minter changes.
 //
 // Steps:
@@ -68,7 +173,17 @@ func tryChangeKey(conn *ntag424.Connection, sess *ntag424.Session, keyNo byte, n
 // 12. Reset key slot 0 to zeros (invalidates session)
 // 13. Restore all file settings to factory defaults
 // 14. Verify file settings
-func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThreeKey []byte) error {
+//
+// Before step 8 the key versions of slots 0-4 are read (non-fatal): a slot
+// with a non-zero version is reset from its provisioned key first, a slot at
+// 0x00 from zeros first.
+//
+// All writes in steps 6-13 go through m. When m.DryRun() is true the reads
+// and authentication still run, but the tag is left unchanged and step 14 is
+// skipped.
+func resetTag(conn *ntag424.Connection, m tagMutator, appMasterKey, sdmKey, ndefKey, fileThreeKey []byte) error {
+	dryRun := m.DryRun()
+
 	// 1) Get UID
 	uid, err := ntag424.GetUID(conn)
 	if err != nil {
@@ -96,18 +211,13 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 		ntag424.PrintFileSettings("", counterFileNo, beforeSettings)
 	}
 
-	// 4) Select NDEF application
-	if err := ntag424.SelectNDEFApp(conn); err != nil {
-		return fmt.Errorf("select NDEF app: %w", err)
-	}
-
-	// 5) Authenticate with app master key (slot 0), with fallback to zeros
-	sess, authKey, _, err := ntag424.AuthenticateWithFallback(conn, appMasterKey, authDefaultKeyNo, authDefaultKeyNo)
+	// 4-5) Select NDEF application and authenticate with app master key
+	// (slot 0), with fallback to zeros
+	provisioned, authKey, sess, err := ntag424.TagState(conn, appMasterKey)
 	if err != nil {
-		return fmt.Errorf("authenticate with fallback: %w", err)
+		return fmt.Errorf("check tag state: %w", err)
 	}
 	zeroKey := make([]byte, 16)
-	provisioned := !bytes.Equal(authKey, zeroKey)
 	if provisioned {
 		fmt.Println("\nAuthenticated with app master key (slot 0) - tag is provisioned")
 	} else {
@@ -124,7 +234,7 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 		ar1        = 0x00 // RW=0, CAR=0
 		ar2        = 0xEE // R=free (0xE), W=free (0xE)
 	)
-	if err := ntag424.ChangeFileSettingsBasic(conn, sess, counterFileNo, fileOption, ar1, ar2); err != nil {
+	if err := m.ChangeFileSettingsBasic(sess, counterFileNo, fileOption, ar1, ar2); err != nil {
 		return fmt.Errorf("reset file 2 settings: %w", err)
 	}
 	fmt.Println("File 2 settings reset to factory defaults (free write)")
@@ -132,7 +242,7 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 	// 7) Clear NDEF data using ISO write (file 2 now has Write=free after step 6)
 	fmt.Println("\nClearing NDEF data...")
 	emptyNDEF := []byte{0x00, 0x00} // NLEN=0
-	if err := ntag424.WriteNDEFPlain(conn, emptyNDEF); err != nil {
+	if err := m.WriteNDEFPlain(emptyNDEF); err != nil {
 		fmt.Printf("Warning: could not clear NDEF (will continue): %v\n", err)
 	} else {
 		fmt.Println("NDEF data cleared")
@@ -149,15 +259,17 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 	}
 	fmt.Println("Re-authenticated successfully")
 
+	// Read key versions so each slot tries the key its version points to
+	// first: minter writes non-zero versions, factory keys are version 0x00
+	versions, sess, err := readKeyVersions(conn, sess, authKey)
+	if err != nil {
+		return err
+	}
+
 	// 8) Reset key slot 1 to zeros (cross-slot change)
 	fmt.Println("\nResetting key slot 1 to factory zeros...")
-	var primaryOld1, altOld1 []byte
-	if provisioned {
-		primaryOld1, altOld1 = sdmKey, zeroKey
-	} else {
-		primaryOld1, altOld1 = zeroKey, sdmKey
-	}
-	sess, err = tryChangeKey(conn, sess, 0x01, zeroKey, primaryOld1, altOld1, authKey)
+	primaryOld1, altOld1 := oldKeyOrder(versions, 0x01, provisioned, sdmKey, zeroKey)
+	sess, err = tryChangeKey(conn, m, sess, 0x01, zeroKey, primaryOld1, altOld1, authKey)
 	if err != nil {
 		return fmt.Errorf("reset key slot 1: %w", err)
 	}
@@ -165,13 +277,8 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 
 	// 9) Reset key slot 2 to zeros (cross-slot change)
 	fmt.Println("Resetting key slot 2 to factory zeros...")
-	var primaryOld2, altOld2 []byte
-	if provisioned {
-		primaryOld2, altOld2 = ndefKey, zeroKey
-	} else {
-		primaryOld2, altOld2 = zeroKey, ndefKey
-	}
-	sess, err = tryChangeKey(conn, sess, 0x02, zeroKey, primaryOld2, altOld2, authKey)
+	primaryOld2, altOld2 := oldKeyOrder(versions, 0x02, provisioned, ndefKey, zeroKey)
+	sess, err = tryChangeKey(conn, m, sess, 0x02, zeroKey, primaryOld2, altOld2, authKey)
 	if err != nil {
 		return fmt.Errorf("reset key slot 2: %w", err)
 	}
@@ -179,13 +286,8 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 
 	// 10) Reset key slot 3 to factory zeros (cross-slot change)
 	fmt.Println("Resetting key slot 3 to factory zeros...")
-	var primaryOld3, altOld3 []byte
-	if provisioned {
-		primaryOld3, altOld3 = fileThreeKey, zeroKey
-	} else {
-		primaryOld3, altOld3 = zeroKey, fileThreeKey
-	}
-	sess, err = tryChangeKey(conn, sess, 0x03, zeroKey, primaryOld3, altOld3, authKey)
+	primaryOld3, altOld3 := oldKeyOrder(versions, 0x03, provisioned, fileThreeKey, zeroKey)
+	sess, err = tryChangeKey(conn, m, sess, 0x03, zeroKey, primaryOld3, altOld3, authKey)
 	if err != nil {
 		return fmt.Errorf("reset key slot 3: %w", err)
 	}
@@ -193,7 +295,7 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 
 	// 11) Reset key slot 4 to factory zeros
 	fmt.Println("Resetting key slot 4 to factory zeros...")
-	if err := ntag424.ChangeKey(conn, sess, 0x04, zeroKey, zeroKey, 0x00, authDefaultKeyNo); err != nil {
+	if err := m.ChangeKey(sess, 0x04, zeroKey, zeroKey, 0x00, authDefaultKeyNo); err != nil {
 		return fmt.Errorf("reset key slot 4: %w", err)
 	}
 	fmt.Println("Key slot 4 reset to zeros")
@@ -201,7 +303,7 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 	// 12) Reset key slot 0 to zeros (same-slot change, invalidates session)
 	fmt.Println("Resetting key slot 0 to factory zeros...")
 	if provisioned {
-		if err := ntag424.ChangeKeySame(conn, sess, 0x00, zeroKey, 0x00); err != nil {
+		if err := m.ChangeKeySame(sess, 0x00, zeroKey, 0x00); err != nil {
 			return fmt.Errorf("reset key slot 0: %w", err)
 		}
 		fmt.Println("Key slot 0 reset to zeros (session invalidated)")
@@ -214,35 +316,42 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 	if err := ntag424.SelectNDEFApp(conn); err != nil {
 		return fmt.Errorf("re-select for file settings restore: %w", err)
 	}
-	sess, err = ntag424.AuthenticateEV2First(conn, zeroKey, authDefaultKeyNo)
+	// Slot 0 is only zeros now if step 12 actually ran
+	slot0Key := zeroKey
+	if dryRun {
+		slot0Key = authKey
+	}
+	sess, err = ntag424.AuthenticateEV2First(conn, slot0Key, authDefaultKeyNo)
 	if err != nil {
 		return fmt.Errorf("re-auth for file settings restore: %w", err)
 	}
 
 	// File 1 (CC): FileOption=0x00, AR1=0x00, AR2=0xE0
-	if err := ntag424.ChangeFileSettingsBasic(conn, sess, 0x01, 0x00, 0x00, 0xE0); err != nil {
+	if err := m.ChangeFileSettingsBasic(sess, 0x01, 0x00, 0x00, 0xE0); err != nil {
 		return fmt.Errorf("restore file 1 settings: %w", err)
 	}
 	fmt.Println("File 1 (CC) settings restored to factory defaults")
 
 	// File 2 (NDEF): FileOption=0x00, AR1=0x00, AR2=0xEE (Write=free for minter compatibility)
-	if err := ntag424.ChangeFileSettingsBasic(conn, sess, counterFileNo, 0x00, 0x00, 0xEE); err != nil {
+	if err := m.ChangeFileSettingsBasic(sess, counterFileNo, 0x00, 0x00, 0xEE); err != nil {
 		return fmt.Errorf("restore file 2 settings: %w", err)
 	}
 	fmt.Println("File 2 (NDEF) settings restored to factory defaults")
 
 	// File 3 (Proprietary): FileOption=0x03, AR1=0x00, AR2=0x00
-	if err := ntag424.ChangeFileSettingsBasic(conn, sess, 0x03, 0x03, 0x00, 0x00); err != nil {
+	if err := m.ChangeFileSettingsBasic(sess, 0x03, 0x03, 0x00, 0x00); err != nil {
 		return fmt.Errorf("restore file 3 settings: %w", err)
 	}
 	fmt.Println("File 3 (Proprietary) settings restored to factory defaults")
 
 	// 14) Verify file settings (after re-selecting app)
-	fmt.Println("\nVerifying file settings...")
 	var afterSettings *ntag424.FileSettings
-	if err := ntag424.SelectNDEFApp(conn); err != nil {
+	if dryRun {
+		fmt.Println("\nSkipping verification (dry run)")
+	} else if err := ntag424.SelectNDEFApp(conn); err != nil {
 		fmt.Printf("Warning: could not re-select app for verification: %v\n", err)
 	} else {
+		fmt.Println("\nVerifying file settings...")
 		afterSettings, err = ntag424.GetFileSettingsPlain(conn, counterFileNo)
 		if err != nil {
 			fmt.Printf("Warning: could not verify file settings: %v\n", err)
@@ -254,7 +363,11 @@ func resetTag(conn *ntag424.Connection, appMasterKey, sdmKey, ndefKey, fileThree
 
 	// Print summary
 	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("RESET SUMMARY")
+	if dryRun {
+		fmt.Println("RESET SUMMARY (dry run — no changes applied)")
+	} else {
+		fmt.Println("RESET SUMMARY")
+	}
 	fmt.Println(strings.Repeat("=", 60))
 	fmt.Printf("Tag UID: %s\n", uidHex)
 	fmt.Println("\nKeys reset:")
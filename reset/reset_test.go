@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOldKeyOrderFollowsKeyVersion(t *testing.T) {
+	provisionedKey := bytes.Repeat([]byte{0x11}, 16)
+	zeroKey := make([]byte, 16)
+	versions := map[byte]byte{0: 0x01, 1: 0x03, 2: 0x00}
+
+	tests := []struct {
+		name        string
+		slot        byte
+		provisioned bool
+		wantPrimary []byte
+	}{
+		{"non-zero version on a factory tag", 1, false, provisionedKey},
+		{"zero version on a provisioned tag", 2, true, zeroKey},
+		{"version not read, provisioned tag", 3, true, provisionedKey},
+		{"version not read, factory tag", 4, false, zeroKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, alt := oldKeyOrder(versions, tt.slot, tt.provisioned, provisionedKey, zeroKey)
+			if !bytes.Equal(primary, tt.wantPrimary) {
+				t.Fatalf("slot %d: expected primary % X, got % X", tt.slot, tt.wantPrimary, primary)
+			}
+			wantAlt := zeroKey
+			if bytes.Equal(tt.wantPrimary, zeroKey) {
+				wantAlt = provisionedKey
+			}
+			if !bytes.Equal(alt, wantAlt) {
+				t.Fatalf("slot %d: expected alternate % X, got % X", tt.slot, wantAlt, alt)
+			}
+		})
+	}
+}
+
+// wrappedMutator stands in for any wrapper (logging, tracing) around a
+// tagMutator.
+type wrappedMutator struct {
+	tagMutator
+}
+
+func TestWrappedMutatorKeepsDryRun(t *testing.T) {
+	if m := tagMutator(wrappedMutator{tagMutator: dryRunMutator{}}); !m.DryRun() {
+		t.Fatal("expected a wrapped dry-run mutator to report DryRun")
+	}
+	if m := tagMutator(wrappedMutator{tagMutator: cardMutator{}}); m.DryRun() {
+		t.Fatal("expected a wrapped card mutator not to report DryRun")
+	}
+}
@@ -2,23 +2,24 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
 
-	"github.com/ebfe/scard"
 	"github.com/barnettlynn/nfctools/pkg/ntag424"
 )
 
 // Wrapper functions to bridge ro tool to shared library
 
-func loadAllHexKeys(dir string) ([]keyFile, error) {
-	keys, err := ntag424.LoadAllHexKeys(dir)
+func loadAllKeys(dir string) ([]keyFile, error) {
+	keys, err := ntag424.LoadAllKeys(dir)
 	if err != nil {
 		return nil, err
 	}
 	result := make([]keyFile, len(keys))
 	for i, k := range keys {
-		result[i] = keyFile{name: k.Name, key: k.Key}
+		result[i] = keyFile{name: k.Name, key: k.Key, slot: k.Slot}
 	}
 	return result, nil
 }
@@ -27,7 +28,7 @@ func loadKeyHexFile(path string) ([]byte, error) {
 	return ntag424.LoadKeyHexFile(path)
 }
 
-func authenticateEV2First(card *scard.Card, key []byte, keyNo byte) (*session, error) {
+func authenticateEV2First(card ntag424.Card, key []byte, keyNo byte) (*session, error) {
 	sess, err := ntag424.AuthenticateEV2First(card, key, keyNo)
 	if err != nil {
 		return nil, err
@@ -35,7 +36,7 @@ func authenticateEV2First(card *scard.Card, key []byte, keyNo byte) (*session, e
 	return fromNtag424Session(sess), nil
 }
 
-func getFileSettingsPlain(card *scard.Card, fileNo byte) (*fileSettings, error) {
+func getFileSettingsPlain(card ntag424.Card, fileNo byte) (*fileSettings, error) {
 	fs, err := ntag424.GetFileSettingsPlain(card, fileNo)
 	if err != nil {
 		return nil, err
@@ -44,7 +45,7 @@ func getFileSettingsPlain(card *scard.Card, fileNo byte) (*fileSettings, error)
 	return convertFileSettings(fs), nil
 }
 
-func getFileSettingsSecure(card *scard.Card, sess *session, fileNo byte) (*fileSettings, error) {
+func getFileSettingsSecure(card ntag424.Card, sess *session, fileNo byte) (*fileSettings, error) {
 	fs, err := ntag424.GetFileSettingsSecure(card, toNtag424Session(sess), fileNo)
 	if err != nil {
 		return nil, err
@@ -52,7 +53,7 @@ func getFileSettingsSecure(card *scard.Card, sess *session, fileNo byte) (*fileS
 	return convertFileSettings(fs), nil
 }
 
-func getKeySettingsPlain(card *scard.Card) (keySettings byte, maxKeys byte, err error) {
+func getKeySettingsPlain(card ntag424.Card) (keySettings byte, maxKeys byte, err error) {
 	apdu := []byte{0x90, 0x45, 0x00, 0x00, 0x00}
 	resp, sw, err := transmit(card, apdu)
 	if err != nil {
@@ -64,12 +65,12 @@ func getKeySettingsPlain(card *scard.Card) (keySettings byte, maxKeys byte, err
 	return resp[0], resp[1], nil
 }
 
-func getKeySettingsSecure(card *scard.Card, sess *session) (keySettings byte, maxKeys byte, err error) {
+func getKeySettingsSecure(card ntag424.Card, sess *session) (keySettings byte, maxKeys byte, err error) {
 	// For now, fall back to plain - can be enhanced later
 	return getKeySettingsPlain(card)
 }
 
-func ssmCmdFull(card *scard.Card, sess *session, cmd byte, header, data []byte) ([]byte, error) {
+func ssmCmdFull(card ntag424.Card, sess *session, cmd byte, header, data []byte) ([]byte, error) {
 	return ntag424.SsmCmdFull(card, toNtag424Session(sess), cmd, header, data)
 }
 
@@ -108,45 +109,15 @@ func convertFileSettings(fs *ntag424.FileSettings) *fileSettings {
 	}
 }
 
-type TagVersion struct {
-	HWVendorID    byte
-	HWType        byte
-	HWSubType     byte
-	HWMajorVer    byte
-	HWMinorVer    byte
-	HWStorageSize byte
-	HWProtocol    byte
-	SWVendorID    byte
-	SWType        byte
-	SWSubType     byte
-	SWMajorVer    byte
-	SWMinorVer    byte
-	SWStorageSize byte
-	SWProtocol    byte
-	UID           []byte
-	BatchNo       []byte
-	FabKey        byte
-	ProdYear      byte
-	ProdWeek      byte
-}
-
 func swOK(sw uint16) bool {
 	return sw == 0x9000 || sw == 0x9100
 }
 
-func transmit(card *scard.Card, apdu []byte) ([]byte, uint16, error) {
-	resp, err := card.Transmit(apdu)
-	if err != nil {
-		return nil, 0, err
-	}
-	if len(resp) < 2 {
-		return nil, 0, fmt.Errorf("short response: %d bytes", len(resp))
-	}
-	sw := uint16(resp[len(resp)-2])<<8 | uint16(resp[len(resp)-1])
-	return resp[:len(resp)-2], sw, nil
+func transmit(card ntag424.Card, apdu []byte) ([]byte, uint16, error) {
+	return ntag424.Transmit(card, apdu)
 }
 
-func getUID(card *scard.Card) ([]byte, error) {
+func getUID(card ntag424.Card) ([]byte, error) {
 	for _, le := range []byte{0x00, 0x04} {
 		apdu := []byte{0xFF, 0xCA, 0x00, 0x00, le}
 		data, sw, err := transmit(card, apdu)
@@ -157,7 +128,7 @@ func getUID(card *scard.Card) ([]byte, error) {
 	return nil, fmt.Errorf("UID not available via GET DATA")
 }
 
-func selectNDEFApp(card *scard.Card) error {
+func selectNDEFApp(card ntag424.Card) error {
 	aid := []byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01}
 	apdu := []byte{0x00, 0xA4, 0x04, 0x00, byte(len(aid))}
 	apdu = append(apdu, aid...)
@@ -172,7 +143,7 @@ func selectNDEFApp(card *scard.Card) error {
 	return nil
 }
 
-func selectFile(card *scard.Card, fileID uint16) error {
+func selectFile(card ntag424.Card, fileID uint16) error {
 	apdu := []byte{0x00, 0xA4, 0x00, 0x0C, 0x02, byte(fileID >> 8), byte(fileID)}
 	_, sw, err := transmit(card, apdu)
 	if err != nil {
@@ -184,7 +155,7 @@ func selectFile(card *scard.Card, fileID uint16) error {
 	return nil
 }
 
-func readBinary(card *scard.Card, offset uint16, le byte) ([]byte, error) {
+func readBinary(card ntag424.Card, offset uint16, le byte) ([]byte, error) {
 	apdu := []byte{0x00, 0xB0, byte(offset >> 8), byte(offset), le}
 	data, sw, err := transmit(card, apdu)
 	if err != nil {
@@ -203,120 +174,30 @@ func readBinary(card *scard.Card, offset uint16, le byte) ([]byte, error) {
 	return data, nil
 }
 
-func readNDEF(card *scard.Card) ([]byte, error) {
-	if err := selectNDEFApp(card); err != nil {
-		return nil, err
-	}
-	if err := selectFile(card, 0xE103); err != nil {
-		return nil, err
-	}
-	cc, err := readBinary(card, 0x0000, 0x0F)
-	if err != nil {
-		return nil, err
-	}
-	if len(cc) < 15 {
-		return nil, fmt.Errorf("CC file too short")
-	}
-
-	ndefFileID := uint16(0xE104)
-	if cc[7] == 0x04 && cc[8] >= 6 {
-		ndefFileID = uint16(cc[9])<<8 | uint16(cc[10])
-	}
-
-	if err := selectFile(card, ndefFileID); err != nil {
-		return nil, err
-	}
-	nlenBytes, err := readBinary(card, 0x0000, 0x02)
-	if err != nil {
-		return nil, err
-	}
-	if len(nlenBytes) < 2 {
-		return nil, fmt.Errorf("NLEN read too short")
-	}
-	nlen := int(nlenBytes[0])<<8 | int(nlenBytes[1])
-	if nlen == 0 {
-		return []byte{}, nil
-	}
-
-	ndef := make([]byte, 0, nlen)
-	offset := 2
-	remaining := nlen
-	for remaining > 0 {
-		chunk := remaining
-		if chunk > 0xFF {
-			chunk = 0xFF
-		}
-		part, err := readBinary(card, uint16(offset), byte(chunk))
-		if err != nil {
-			return nil, err
-		}
-		if len(part) == 0 {
-			break
-		}
-		ndef = append(ndef, part...)
-		offset += len(part)
-		remaining -= len(part)
-	}
-	return ndef, nil
+// readNDEF reads the NDEF message framed as layout. A CC without an NDEF File
+// Control TLV first is logged and the default file E104 read, as ro did
+// before it used the library reader.
+func readNDEF(card ntag424.Card, layout ntag424.NDEFLayout) ([]byte, error) {
+	return ntag424.ReadNDEFWithLayout(card, layout)
 }
 
-func getVersion(card *scard.Card) (*TagVersion, error) {
-	// GetVersion is a three-part command exchange at PICC level
-	// First part: 0x60
-	apdu1 := []byte{0x90, 0x60, 0x00, 0x00, 0x00}
-	resp1, sw, err := transmit(card, apdu1)
+// streamNDEF copies the NDEF message to w as it is read from the tag, so a
+// large message is never held whole.
+func streamNDEF(w io.Writer, card ntag424.Card, layout ntag424.NDEFLayout) error {
+	r, err := ntag424.NDEFReaderWithLayout(card, layout)
 	if err != nil {
-		return nil, err
-	}
-	if sw != 0x91AF || len(resp1) != 7 {
-		return nil, fmt.Errorf("GetVersion part 1 failed (SW=%04X len=%d)", sw, len(resp1))
+		return err
 	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
 
-	// Second part: 0xAF
-	apdu2 := []byte{0x90, 0xAF, 0x00, 0x00, 0x00}
-	resp2, sw, err := transmit(card, apdu2)
-	if err != nil {
-		return nil, err
-	}
-	if sw != 0x91AF || len(resp2) != 7 {
-		return nil, fmt.Errorf("GetVersion part 2 failed (SW=%04X len=%d)", sw, len(resp2))
-	}
+func getVersion(card ntag424.Card) (*ntag424.TagVersion, error) {
+	return ntag424.GetVersion(card)
+}
 
-	// Third part: 0xAF
-	apdu3 := []byte{0x90, 0xAF, 0x00, 0x00, 0x00}
-	resp3, sw, err := transmit(card, apdu3)
-	if err != nil {
-		return nil, err
-	}
-	if !swOK(sw) || len(resp3) != 14 {
-		return nil, fmt.Errorf("GetVersion part 3 failed (SW=%04X len=%d)", sw, len(resp3))
-	}
-
-	v := &TagVersion{
-		HWVendorID:    resp1[0],
-		HWType:        resp1[1],
-		HWSubType:     resp1[2],
-		HWMajorVer:    resp1[3],
-		HWMinorVer:    resp1[4],
-		HWStorageSize: resp1[5],
-		HWProtocol:    resp1[6],
-		SWVendorID:    resp2[0],
-		SWType:        resp2[1],
-		SWSubType:     resp2[2],
-		SWMajorVer:    resp2[3],
-		SWMinorVer:    resp2[4],
-		SWStorageSize: resp2[5],
-		SWProtocol:    resp2[6],
-		UID:           resp3[0:7],
-		BatchNo:       resp3[7:12],
-		FabKey:        resp3[12],
-		ProdYear:      resp3[13] >> 4,
-		ProdWeek:      resp3[13] & 0x0F,
-	}
-	return v, nil
-}
-
-func printTagVersion(v *TagVersion) {
+func printTagVersion(v *ntag424.TagVersion) {
 	if v == nil {
 		return
 	}
@@ -328,48 +209,17 @@ func printTagVersion(v *TagVersion) {
 	fmt.Printf("  UID: %s\n", hexUpper(v.UID))
 	fmt.Printf("  Batch: %s\n", hexUpper(v.BatchNo))
 	fmt.Printf("  Fab key: %02X\n", v.FabKey)
-	fmt.Printf("  Production: 20%X%d Week %d\n", v.ProdYear/10, v.ProdYear%10, v.ProdWeek)
-}
-
-func getApplicationIDs(card *scard.Card) ([][]byte, error) {
-	// DESFire GetApplicationIDs command (0x6A) - no auth needed
-	apdu := []byte{0x90, 0x6A, 0x00, 0x00, 0x00}
-	data, sw, err := transmit(card, apdu)
-	if err != nil {
-		return nil, err
-	}
-	if !swOK(sw) {
-		return nil, fmt.Errorf("GetApplicationIDs failed (SW1SW2=%04X)", sw)
-	}
-
-	// Parse response into 3-byte AID chunks
-	if len(data)%3 != 0 {
-		return nil, fmt.Errorf("invalid GetApplicationIDs response length: %d", len(data))
-	}
-
-	apps := make([][]byte, 0, len(data)/3)
-	for i := 0; i < len(data); i += 3 {
-		aid := make([]byte, 3)
-		copy(aid, data[i:i+3])
-		apps = append(apps, aid)
+	year, week := v.ProductionDate()
+	fmt.Printf("  Production: %d Week %d\n", year, week)
+	fmt.Printf("  Storage: %d bytes\n", v.StorageBytes())
+	if !v.IsNTAG424DNA() {
+		fmt.Println("  Note: not an NTAG 424 DNA")
 	}
-	return apps, nil
 }
 
-func getFileIDs(card *scard.Card) ([]byte, error) {
-	// DESFire GetFileIDs command (0x6F) - no auth needed
-	apdu := []byte{0x90, 0x6F, 0x00, 0x00, 0x00}
-	data, sw, err := transmit(card, apdu)
-	if err != nil {
-		return nil, err
-	}
-	if !swOK(sw) {
-		return nil, fmt.Errorf("GetFileIDs failed (SW1SW2=%04X)", sw)
-	}
-	return data, nil
-}
-
-func printApplications(card *scard.Card, apps [][]byte) {
+// printApplications lists every application on a DESFire card and, for
+// each, selects it and dumps its file numbers and plain file settings.
+func printApplications(card ntag424.Card, apps [][]byte) {
 	fmt.Println("Applications:")
 	if len(apps) == 0 {
 		fmt.Println("  (none)")
@@ -385,52 +235,199 @@ func printApplications(card *scard.Card, apps [][]byte) {
 		}
 		fmt.Printf("  AID: %s%s\n", aidHex, desc)
 
-		// Try to select this app and get its file IDs
-		fullAID := []byte{aid[0], aid[1], aid[2], 0x00, 0x85, 0x01, 0x01}
-		apdu := []byte{0x00, 0xA4, 0x04, 0x00, byte(len(fullAID))}
-		apdu = append(apdu, fullAID...)
-		apdu = append(apdu, 0x00)
-		_, sw, err := transmit(card, apdu)
-		if err == nil && swOK(sw) {
-			fileIDs, err := getFileIDs(card)
-			if err == nil && len(fileIDs) > 0 {
-				fileList := make([]string, len(fileIDs))
-				for i, fid := range fileIDs {
-					fileList[i] = fmt.Sprintf("%02X", fid)
-				}
-				fmt.Printf("    Files: %s\n", strings.Join(fileList, ", "))
+		if err := ntag424.SelectApplicationAID(card, aid); err != nil {
+			fmt.Printf("    Select failed: %v\n", err)
+			continue
+		}
+		fileIDs, err := ntag424.GetFileIDs(card)
+		if err != nil {
+			fmt.Printf("    Files: error: %v\n", err)
+			continue
+		}
+		if len(fileIDs) == 0 {
+			fmt.Println("    Files: (none)")
+			continue
+		}
+		for _, fid := range fileIDs {
+			fs, err := getFileSettingsPlain(card, fid)
+			if err != nil {
+				fmt.Printf("    File %02X: settings not readable without auth (%v)\n", fid, err)
+				continue
+			}
+			line := fmt.Sprintf("    File %02X: %s", fid, fileTypeLabel(fs.fileType))
+			if fs.fileType <= 0x01 {
+				// Only data files carry a size; value and record files
+				// put limits or record sizes there.
+				line += fmt.Sprintf(", %d bytes", fs.size)
 			}
+			fmt.Printf("%s, %s\n", line, fs.accessRights())
 		}
 	}
 }
 
-func printKeySlots(card *scard.Card, cfg *readerConfig) {
-	fmt.Println("Key slots:")
+// printStorage prints the allocated and used size of each NDEF application
+// file and the card's free memory. Files that are not freely readable are
+// read under the configured auth key when it authenticates.
+func printStorage(card ntag424.Card, cfg *readerConfig) {
+	fmt.Println("Storage:")
+	if err := selectNDEFApp(card); err != nil {
+		fmt.Printf("  error: %v\n", err)
+		return
+	}
+	var sess *ntag424.Session
+	if cfg != nil && len(cfg.authKey) == 16 {
+		if s, err := ntag424.AuthenticateEV2First(card, cfg.authKey, cfg.authKeyNo); err == nil {
+			sess = s
+		} else if err := selectNDEFApp(card); err != nil {
+			fmt.Printf("  error: %v\n", err)
+			return
+		}
+	}
+	r, err := ntag424.GetStorageReport(card, sess)
+	if err != nil {
+		fmt.Printf("  error: %v\n", err)
+		return
+	}
+	for _, f := range r.Files {
+		used := "unknown"
+		if f.Used != ntag424.UsedUnknown {
+			used = fmt.Sprintf("%d", f.Used)
+		}
+		fmt.Printf("  File %02X (%s): %s of %d bytes used", f.FileNo, fileTypeLabel(f.FileType), used, f.Allocated)
+		if f.Error != "" {
+			fmt.Printf(" (%s)", f.Error)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  Total: %d of %d bytes used\n", r.Used, r.Allocated)
+	if r.FreeBytes == ntag424.UsedUnknown {
+		fmt.Println("  Free memory: not reported (fixed file layout)")
+	} else {
+		fmt.Printf("  Free memory: %d bytes\n", r.FreeBytes)
+	}
+}
+
+// printKeyCapabilities prints, for each loaded key, the slots it matches and
+// what those slots may do with each file. Every slot a key does not match
+// costs a failed authentication.
+func printKeyCapabilities(card ntag424.Card, cfg *readerConfig) {
+	fmt.Println("Key capabilities:")
+	keys := []struct {
+		label string
+		key   []byte
+	}{
+		{cfg.authKeyLabel, cfg.authKey},
+		{cfg.sdmKeyLabel, cfg.sdmKey},
+		{cfg.ndefKeyLabel, cfg.ndefKey},
+	}
+	for _, k := range keys {
+		if len(k.key) != 16 {
+			continue
+		}
+		fmt.Printf("  %s:\n", k.label)
+		r, err := ntag424.KeyCapabilities(card, k.key)
+		if err != nil {
+			fmt.Printf("    error: %v\n", err)
+			continue
+		}
+		if len(r.Slots) == 0 {
+			fmt.Println("    matches no slot (free operations only)")
+		} else {
+			fmt.Printf("    slots: %v", r.Slots)
+			if r.ChangeKeys {
+				fmt.Print(" (AppMasterKey: can change keys)")
+			}
+			fmt.Println()
+		}
+		for _, f := range r.Files {
+			if f.Error != "" {
+				fmt.Printf("    File %02X: settings unreadable (%s)\n", f.FileNo, f.Error)
+				continue
+			}
+			ops := "nothing"
+			if o := f.Operations(); len(o) > 0 {
+				ops = strings.Join(o, ", ")
+			}
+			fmt.Printf("    File %02X: %s [%s]\n", f.FileNo, ops, f.Access)
+		}
+	}
+}
+
+// fileName names the NTAG 424 DNA files; other DESFire files are "data".
+func fileName(fileNo byte) string {
+	switch fileNo {
+	case 0x01:
+		return "CC"
+	case 0x02:
+		return "NDEF"
+	case 0x03:
+		return "proprietary"
+	default:
+		return "data"
+	}
+}
+
+// fileTypeLabel names a DESFire file type from GetFileSettings.
+func fileTypeLabel(fileType byte) string {
+	switch fileType {
+	case 0x00:
+		return "standard data"
+	case 0x01:
+		return "backup data"
+	case 0x02:
+		return "value"
+	case 0x03:
+		return "linear record"
+	case 0x04:
+		return "cyclic record"
+	}
+	return "unknown"
+}
+
+// keySlotProbe is the outcome of trying every known key against one slot.
+type keySlotProbe struct {
+	slot       byte
+	role       string
+	matchedKey string // label of the key that authenticated, "" if none
+}
+
+// roles returns the configured key slot labels (defaults when cfg is nil).
+func (cfg *readerConfig) roles() ntag424.SlotRoles {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.slotRoles
+}
 
+// probeKeySlots tries the all-zero key, the configured keys and every key in
+// ../keys against slots 0-4. changeKeyNo is the key that may change other
+// keys (from GetKeySettings), or 0xFF if it could not be read.
+func probeKeySlots(card ntag424.Card, cfg *readerConfig) (slots []keySlotProbe, changeKeyNo byte) {
 	// Prepare keys to test
 	type keyInfo struct {
 		key   []byte
 		label string
+		slot  int // slot a .json key declares, -1 to try it on every slot
 	}
 
 	keys := []keyInfo{
-		{make([]byte, 16), "all-zero"},
+		{make([]byte, 16), "all-zero", -1},
 	}
 
 	// Add configured keys if available
 	if cfg != nil {
 		if len(cfg.authKey) == 16 {
-			keys = append(keys, keyInfo{cfg.authKey, cfg.authKeyLabel})
+			keys = append(keys, keyInfo{cfg.authKey, cfg.authKeyLabel, -1})
 		}
 		if len(cfg.sdmKey) == 16 {
-			keys = append(keys, keyInfo{cfg.sdmKey, cfg.sdmKeyLabel})
+			keys = append(keys, keyInfo{cfg.sdmKey, cfg.sdmKeyLabel, -1})
 		}
 	}
 
 	// Load additional keys from key directories
 	keyDirs := []string{"../keys"}
 	for _, dir := range keyDirs {
-		keyFiles, err := loadAllHexKeys(dir)
+		keyFiles, err := loadAllKeys(dir)
 		if err == nil {
 			for _, kf := range keyFiles {
 				// Check if we already have this key
@@ -442,7 +439,7 @@ func printKeySlots(card *scard.Card, cfg *readerConfig) {
 					}
 				}
 				if !isDuplicate {
-					keys = append(keys, keyInfo{kf.key, kf.name})
+					keys = append(keys, keyInfo{kf.key, kf.name, kf.slot})
 				}
 			}
 		}
@@ -451,7 +448,7 @@ func printKeySlots(card *scard.Card, cfg *readerConfig) {
 	// Get key settings to determine change authority
 	// Note: GetKeySettings may be restricted on some cards. If access is denied,
 	// we won't be able to show which key can change each slot.
-	var changeKeyNo byte = 0xFF // unknown
+	changeKeyNo = 0xFF // unknown
 	if err := selectNDEFApp(card); err == nil {
 		// Try plain GetKeySettings first
 		if ks, _, err := getKeySettingsPlain(card); err == nil {
@@ -460,6 +457,9 @@ func printKeySlots(card *scard.Card, cfg *readerConfig) {
 			// Plain GetKeySettings failed - try with authentication
 			// Try authenticating with key 0 (AppMasterKey)
 			for _, k := range keys {
+				if k.slot > 0 {
+					continue // declared for another slot
+				}
 				if err := selectNDEFApp(card); err != nil {
 					continue
 				}
@@ -475,58 +475,59 @@ func printKeySlots(card *scard.Card, cfg *readerConfig) {
 		}
 	}
 
-	// Test each slot (0-4 are standard on NTAG 424 DNA)
-	slotRoles := map[byte]string{
-		0: "AppMaster",
-		1: "SDM",
-		2: "File Two Write",
-		3: "read/write",
-		4: "read/write",
-	}
-
+	// Test each slot (0-4 are standard on NTAG 424 DNA). A .json key is only
+	// tried on the slot it declares: every failed attempt counts against the
+	// tag's failed-authentication counter.
 	for slot := byte(0); slot <= 4; slot++ {
-		role := slotRoles[slot]
+		var probeKeys []ntag424.KeyFile
+		for _, k := range keys {
+			if k.slot < 0 || k.slot == int(slot) {
+				probeKeys = append(probeKeys, ntag424.KeyFile{Name: k.label, Key: k.key})
+			}
+		}
+		matched := ntag424.MatchedKeys(ntag424.ProbeAllKeys(card, probeKeys, []byte{slot}))
+		role := cfg.roles().Role(slot)
 		if role == "" {
 			role = "unused"
 		}
+		slots = append(slots, keySlotProbe{slot: slot, role: role, matchedKey: matched[slot]})
+	}
+	return slots, changeKeyNo
+}
 
-		// Try each key on this slot
-		var matchedKey string
-		for _, k := range keys {
-			if err := selectNDEFApp(card); err != nil {
-				continue
-			}
-			if _, err := authenticateEV2First(card, k.key, slot); err == nil {
-				matchedKey = k.label
-				break
-			}
-		}
+// status renders the probe result as shown in the key slot listing.
+func (p keySlotProbe) status() string {
+	switch p.matchedKey {
+	case "":
+		return "unknown"
+	case "all-zero":
+		return "default (all-zero)"
+	default:
+		return fmt.Sprintf("provisioned (%s)", p.matchedKey)
+	}
+}
 
-		status := "unknown"
-		if matchedKey != "" {
-			if matchedKey == "all-zero" {
-				status = "default (all-zero)"
-			} else {
-				status = fmt.Sprintf("provisioned (%s)", matchedKey)
-			}
-		}
+func printKeySlots(card ntag424.Card, cfg *readerConfig) {
+	fmt.Println("Key slots:")
 
-		fmt.Printf("  Slot %d (%s): %s\n", slot, role, status)
+	slots, changeKeyNo := probeKeySlots(card, cfg)
+	for _, p := range slots {
+		fmt.Printf("  Slot %d (%s): %s\n", p.slot, p.role, p.status())
 
 		// Show which key can change this slot
 		if changeKeyNo != 0xFF {
 			var changeLabel string
-			if slot == 0 {
+			if p.slot == 0 {
 				changeLabel = "Key slot 0 (self)"
 			} else {
 				switch changeKeyNo {
 				case 0x0E:
-					changeLabel = fmt.Sprintf("Key slot %d (self)", slot)
+					changeLabel = fmt.Sprintf("Key slot %d (self)", p.slot)
 				case 0x0F:
 					changeLabel = "frozen (cannot be changed)"
 				default:
 					changeLabel = fmt.Sprintf("Key slot %d", changeKeyNo)
-					if role := slotRoles[changeKeyNo]; role != "" {
+					if role := cfg.roles().Role(changeKeyNo); role != "" {
 						changeLabel += fmt.Sprintf("       <- %s key", role)
 					}
 				}
@@ -536,7 +537,7 @@ func printKeySlots(card *scard.Card, cfg *readerConfig) {
 	}
 }
 
-func printFilesInfo(card *scard.Card, cfg *readerConfig) {
+func printFilesInfo(card ntag424.Card, cfg *readerConfig) {
 	fmt.Println("File settings:")
 
 	// Select NDEF app
@@ -545,50 +546,30 @@ func printFilesInfo(card *scard.Card, cfg *readerConfig) {
 		return
 	}
 
-	// Define files to check
-	fileInfos := []struct {
-		fileNo byte
-		name   string
-	}{
-		{0x01, "CC"},
-		{0x02, "NDEF"},
-		{0x03, "proprietary"},
+	uid := settingsCacheUID(card, cfg)
+
+	// Files the application lists (1-3 on NTAG 424 DNA, which does not list them)
+	fileNos, err := ntag424.ListFileIDs(card, nil)
+	if err != nil {
+		fmt.Printf("  Error: Could not list files: %v\n", err)
+		return
 	}
 
-	for _, finfo := range fileInfos {
-		fmt.Printf("  File %d (%s):\n", finfo.fileNo, finfo.name)
+	for _, fileNo := range fileNos {
+		fmt.Printf("  File %d (%s):\n", fileNo, fileName(fileNo))
 
-		// Try to get file settings (plain first, then authenticated if needed)
-		fs, err := getFileSettingsPlain(card, finfo.fileNo)
-		if err != nil {
-			// Try authenticated read with available keys
-			fs = tryGetFileSettingsAuth(card, finfo.fileNo, cfg)
-			if fs == nil {
-				fmt.Printf("    Error: Could not read file settings\n")
-				continue
-			}
+		// Try to get file settings (cache, plain, then authenticated if needed)
+		full := readFileSettings(card, uid, fileNo, cfg)
+		if full == nil {
+			fmt.Printf("    Error: Could not read file settings\n")
+			continue
 		}
+		fs := convertFileSettings(full)
 
-		// Parse file type
-		fileTypeStr := "unknown"
-		switch fs.fileType {
-		case 0x00:
-			fileTypeStr = "standard data"
-		case 0x01:
-			fileTypeStr = "backup data"
-		case 0x02:
-			fileTypeStr = "value"
-		case 0x03:
-			fileTypeStr = "linear record"
-		case 0x04:
-			fileTypeStr = "cyclic record"
-		}
+		fileTypeStr := fileTypeLabel(fs.fileType)
 
 		// Parse access rights
-		r := (fs.ar2 >> 4) & 0x0F
-		w := fs.ar2 & 0x0F
-		rw := (fs.ar1 >> 4) & 0x0F
-		car := fs.ar1 & 0x0F
+		ar := fs.accessRights()
 
 		// Parse comm mode
 		commMode := fs.fileOption & 0x03
@@ -606,10 +587,10 @@ func printFilesInfo(card *scard.Card, cfg *readerConfig) {
 		fmt.Printf("    Type:             %s (0x%02X)\n", fileTypeStr, fs.fileType)
 		fmt.Printf("    Size:             %d bytes\n", fs.size)
 		fmt.Printf("    Comm mode:        %s\n", commModeStr)
-		fmt.Printf("    Read access:      %s\n", accessLabel(r, cfg))
-		fmt.Printf("    Write access:     %s\n", accessLabel(w, cfg))
-		fmt.Printf("    Read+Write:       %s\n", accessLabel(rw, cfg))
-		fmt.Printf("    Change settings:  %s\n", accessLabel(car, cfg))
+		fmt.Printf("    Read access:      %s\n", accessLabel(ar.Read, cfg))
+		fmt.Printf("    Write access:     %s\n", accessLabel(ar.Write, cfg))
+		fmt.Printf("    Read+Write:       %s\n", accessLabel(ar.ReadWrite, cfg))
+		fmt.Printf("    Change settings:  %s\n", accessLabel(ar.ChangeAccessRights, cfg))
 
 		// Check SDM status
 		sdmEnabled := (fs.fileOption & 0x40) != 0
@@ -617,6 +598,11 @@ func printFilesInfo(card *scard.Card, cfg *readerConfig) {
 			fmt.Printf("    SDM:              enabled\n")
 			fmt.Printf("      MAC generation: %s\n", accessLabel(fs.sdmFile, cfg))
 			fmt.Printf("      Counter read:   %s\n", accessLabel(fs.sdmCtr, cfg))
+			if ctr, err := readSDMCounter(card, fileNo, fs.sdmCtr, cfg); err != nil {
+				fmt.Printf("      Read counter:   not read (%v)\n", err)
+			} else {
+				fmt.Printf("      Read counter:   %d (GetFileCounters)\n", ctr)
+			}
 			fmt.Printf("      Meta read:      %s (UID/counter metadata)\n", accessLabel(fs.sdmMeta, cfg))
 
 			// Decode SDM options byte
@@ -649,7 +635,68 @@ func printFilesInfo(card *scard.Card, cfg *readerConfig) {
 	}
 }
 
-func tryGetFileSettingsAuth(card *scard.Card, fileNo byte, cfg *readerConfig) *fileSettings {
+// readSDMCounter reads the SDMReadCtr of fileNo with GetFileCounters, the
+// command the SDMCtrRet access right (sdmCtr) controls: plain if it is free,
+// otherwise authenticated with the configured key for that slot. The NDEF
+// app is selected again afterwards, so the session does not outlive it.
+func readSDMCounter(card ntag424.Card, fileNo, sdmCtr byte, cfg *readerConfig) (uint32, error) {
+	switch {
+	case sdmCtr == 0x0E:
+		return ntag424.GetFileCounters(card, nil, fileNo)
+	case sdmCtr == 0x0F:
+		return 0, fmt.Errorf("SDMCtrRet denied")
+	}
+	var key []byte
+	switch {
+	case cfg != nil && sdmCtr == cfg.authKeyNo && len(cfg.authKey) == 16:
+		key = cfg.authKey
+	case cfg != nil && sdmCtr == cfg.sdmKeyNo && len(cfg.sdmKey) == 16:
+		key = cfg.sdmKey
+	default:
+		return 0, fmt.Errorf("no key configured for slot %d", sdmCtr)
+	}
+	defer selectNDEFApp(card)
+	sess, err := ntag424.AuthenticateEV2First(card, key, sdmCtr)
+	if err != nil {
+		return 0, fmt.Errorf("authenticate slot %d: %w", sdmCtr, err)
+	}
+	return ntag424.GetFileCounters(card, sess, fileNo)
+}
+
+// readFileSettings returns the settings of fileNo from cfg.settingsCache, or
+// reads them in plain, falling back to authenticated GetFileSettings with
+// the known keys, and caches them under uid. Returns nil if they cannot be
+// read.
+func readFileSettings(card ntag424.Card, uid []byte, fileNo byte, cfg *readerConfig) *ntag424.FileSettings {
+	if fs, ok := cfg.settingsCache.Get(uid, fileNo); ok {
+		slog.Debug("file settings from cache", "file", fileNo)
+		return fs
+	}
+	fs, err := ntag424.GetFileSettingsPlain(card, fileNo)
+	if err != nil {
+		fs = tryGetFileSettingsAuthFull(card, fileNo, cfg)
+	}
+	cfg.settingsCache.Put(uid, fileNo, fs)
+	return fs
+}
+
+// settingsCacheUID returns the UID to key cfg.settingsCache with, or nil
+// when caching is off (or the UID cannot be read), so no extra GET DATA is
+// sent without a cache.
+func settingsCacheUID(card ntag424.Card, cfg *readerConfig) []byte {
+	if cfg.settingsCache == nil {
+		return nil
+	}
+	uid, err := getUID(card)
+	if err != nil {
+		return nil
+	}
+	return uid
+}
+
+// tryGetFileSettingsAuthFull authenticates with each known key in turn and
+// returns the first file settings that can be read, or nil.
+func tryGetFileSettingsAuthFull(card ntag424.Card, fileNo byte, cfg *readerConfig) *ntag424.FileSettings {
 	// Try authenticating with known keys and reading file settings
 	keys := []struct {
 		key   []byte
@@ -677,11 +724,11 @@ func tryGetFileSettingsAuth(card *scard.Card, fileNo byte, cfg *readerConfig) *f
 		if err := selectNDEFApp(card); err != nil {
 			continue
 		}
-		sess, err := authenticateEV2First(card, k.key, k.keyNo)
+		sess, err := ntag424.AuthenticateEV2First(card, k.key, k.keyNo)
 		if err != nil {
 			continue
 		}
-		fs, err := getFileSettingsSecure(card, sess, fileNo)
+		fs, err := ntag424.GetFileSettingsSecure(card, sess, fileNo)
 		if err == nil {
 			return fs
 		}
@@ -690,7 +737,7 @@ func tryGetFileSettingsAuth(card *scard.Card, fileNo byte, cfg *readerConfig) *f
 	return nil
 }
 
-func readCCFile(card *scard.Card) ([]byte, error) {
+func readCCFile(card ntag424.Card) ([]byte, error) {
 	// Select NDEF application
 	if err := selectNDEFApp(card); err != nil {
 		return nil, err
@@ -720,76 +767,29 @@ func printCCFile(data []byte) {
 	// Print raw hex
 	fmt.Printf("  Raw:              %s\n", hexUpper(data))
 
-	// Parse known fields
-	if len(data) < 7 {
-		fmt.Println("  (too short to parse)")
-		return
-	}
-
-	// CCLEN (bytes 0-1, big-endian)
-	ccLen := int(data[0])<<8 | int(data[1])
-	fmt.Printf("  CCLEN:            %d bytes\n", ccLen)
-
-	// Mapping version (byte 2) - upper nibble.lower nibble
-	mapVer := data[2]
-	fmt.Printf("  Mapping version:  %d.%d\n", mapVer>>4, mapVer&0x0F)
-
-	// MLe (bytes 3-4, big-endian) - Max R-APDU data size
-	mle := int(data[3])<<8 | int(data[4])
-	fmt.Printf("  MLe:              %d\n", mle)
-
-	// MLc (bytes 5-6, big-endian) - Max C-APDU data size
-	mlc := int(data[5])<<8 | int(data[6])
-	fmt.Printf("  MLc:              %d\n", mlc)
-
-	// NDEF File Control TLV starts at byte 7
-	if len(data) < 8 {
-		return
-	}
-
-	// Tag (byte 7) should be 0x04 for NDEF File Control TLV
-	if data[7] != 0x04 {
-		fmt.Printf("  TLV tag:          %02X (expected 04)\n", data[7])
-		return
-	}
-
-	// Length (byte 8)
-	if len(data) < 9 {
-		return
-	}
-	tlvLen := int(data[8])
-
-	// Parse NDEF File Control TLV (need at least 6 bytes)
-	if tlvLen < 6 || len(data) < 9+tlvLen {
+	cc, err := ntag424.ParseCCFile(data)
+	if err != nil {
+		fmt.Printf("  (could not parse: %v)\n", err)
 		return
 	}
+	fmt.Printf("  CCLEN:            %d bytes\n", cc.CCLEN)
+	fmt.Printf("  Mapping version:  %d.%d\n", cc.MappingVersion>>4, cc.MappingVersion&0x0F)
+	fmt.Printf("  MLe:              %d\n", cc.MLe)
+	fmt.Printf("  MLc:              %d\n", cc.MLc)
+	fmt.Printf("  NDEF File ID:     %04X\n", cc.NDEFFileID)
+	fmt.Printf("  Max NDEF size:    %d\n", cc.MaxNDEFSize)
+	fmt.Printf("  Read access:      %s\n", ccAccess(cc.ReadAccess))
+	fmt.Printf("  Write access:     %s\n", ccAccess(cc.WriteAccess))
+}
 
-	// NDEF File ID (bytes 9-10, big-endian)
-	ndefFileID := int(data[9])<<8 | int(data[10])
-	fmt.Printf("  NDEF File ID:     %04X\n", ndefFileID)
-
-	// Max NDEF size (bytes 11-12, big-endian)
-	maxNDEF := int(data[11])<<8 | int(data[12])
-	fmt.Printf("  Max NDEF size:    %d\n", maxNDEF)
-
-	// Read access (byte 13)
-	readAccess := data[13]
-	fmt.Printf("  Read access:      %02X", readAccess)
-	if readAccess == 0x00 {
-		fmt.Printf(" (granted)")
-	}
-	fmt.Println()
-
-	// Write access (byte 14)
-	writeAccess := data[14]
-	fmt.Printf("  Write access:     %02X", writeAccess)
-	if writeAccess == 0x00 {
-		fmt.Printf(" (granted)")
+func ccAccess(b byte) string {
+	if b == 0x00 {
+		return "00 (granted)"
 	}
-	fmt.Println()
+	return fmt.Sprintf("%02X", b)
 }
 
-func readFile3(card *scard.Card, cfg *readerConfig) ([]byte, *fileSettings, error) {
+func readFile3(card ntag424.Card, cfg *readerConfig) ([]byte, *fileSettings, error) {
 	// Select NDEF application
 	if err := selectNDEFApp(card); err != nil {
 		return nil, nil, err
@@ -812,29 +812,16 @@ func readFile3(card *scard.Card, cfg *readerConfig) ([]byte, *fileSettings, erro
 	}
 
 	// Try unauthenticated read first
-	const fileNo = 0x03
 	fmt.Println("  Trying unauthenticated read...")
-	lengths := []int{1, 8, 16, 32, 128}
-	for _, length := range lengths {
-		apdu := []byte{0x90, 0xBD, 0x00, 0x00, 0x07,
-			fileNo,
-			0x00, 0x00, 0x00, // offset: 0
-			byte(length), byte(length >> 8), byte(length >> 16), // length
-			0x00}
-		data, sw, err := transmit(card, apdu)
-		if err == nil && swOK(sw) {
-			fmt.Printf("  Unauthenticated read succeeded: %d bytes\n", len(data))
-			if fsPlain == nil {
-				fsPlain = &fileSettings{size: len(data)}
-			}
-			return data, fsPlain, nil
-		}
-		// If auth required, break and try with authentication
-		if sw == 0x6982 {
-			fmt.Println("  Authentication required")
-			break
+	data, err := ntag424.ReadEntireFile(card, nil, 0x03)
+	if err == nil {
+		fmt.Printf("  Unauthenticated read succeeded: %d bytes\n", len(data))
+		if fsPlain == nil {
+			fsPlain = &fileSettings{size: len(data)}
 		}
+		return data, fsPlain, nil
 	}
+	fmt.Printf("  Unauthenticated read failed: %v\n", err)
 
 	// Build list of key attempts: (key, keyNo, label)
 	type keyAttempt struct {
@@ -851,16 +838,19 @@ func readFile3(card *scard.Card, cfg *readerConfig) ([]byte, *fileSettings, erro
 		attempts = append(attempts, keyAttempt{allZeroKey, keyNo, fmt.Sprintf("all-zero/KeyNo %d", keyNo)})
 	}
 
-	// Load all .hex keys from multiple directories
+	// Load all .hex and .json keys from multiple directories
 	keyDirs := []string{"../keys"}
 	for _, dir := range keyDirs {
-		keyFiles, err := loadAllHexKeys(dir)
+		keyFiles, err := loadAllKeys(dir)
 		if err != nil {
 			continue
 		}
-		// Try each loaded key with all key slots
+		// Try each loaded key with its declared slot, or all key slots
 		for _, kf := range keyFiles {
 			for keyNo := byte(0); keyNo < 16; keyNo++ {
+				if kf.slot >= 0 && kf.slot != int(keyNo) {
+					continue
+				}
 				attempts = append(attempts, keyAttempt{kf.key, keyNo, fmt.Sprintf("%s/KeyNo %d", kf.name, keyNo)})
 			}
 		}
@@ -884,57 +874,21 @@ func readFile3(card *scard.Card, cfg *readerConfig) ([]byte, *fileSettings, erro
 		// Auth succeeded
 		fmt.Printf("  Auth succeeded with %s\n", attempt.label)
 
-		// Determine read length: use fsPlain.size if available, otherwise try common lengths
-		const fileNo = 0x03
-		var data []byte
-		var readErr error
-
-		if fsPlain != nil && fsPlain.size > 0 {
-			// We know the allocated size from plain file settings, but the file might be empty
-			// Try reading the allocated size first
-			readDataCmd := []byte{
-				fileNo,
-				0x00, 0x00, 0x00, // offset: 0
-				byte(fsPlain.size), byte(fsPlain.size >> 8), byte(fsPlain.size >> 16),
-			}
-			data, readErr = ssmCmdFull(card, sess, 0xBD, nil, readDataCmd)
-			if readErr == nil {
-				fmt.Printf("  Successfully read %d bytes\n", len(data))
-				return data, fsPlain, nil
-			}
-
-			// Check if it's a boundary error (SW=911C) - means file is empty or contains less data
-			if ntag424.IsBoundaryError(readErr) {
-				fmt.Printf("  File has size %d but contains no data (empty)\n", fsPlain.size)
-				return []byte{}, fsPlain, nil
-			}
-			fmt.Printf("  DESFire ReadData failed: %v\n", readErr)
-		} else if fsPlain != nil && fsPlain.size == 0 {
-			// File size is 0, return empty
-			fmt.Println("  File 3 has size 0 (empty)")
-			return []byte{}, fsPlain, nil
-		} else {
-			// Try common lengths since we don't know the size
-			lengths := []int{128, 32, 16, 8, 1}
-			for _, length := range lengths {
-				readDataCmd := []byte{
-					fileNo,
-					0x00, 0x00, 0x00, // offset: 0
-					byte(length), byte(length >> 8), byte(length >> 16),
-				}
-				data, readErr = ssmCmdFull(card, sess, 0xBD, nil, readDataCmd)
-				if readErr == nil {
-					fmt.Printf("  Successfully read %d bytes (size unknown, tried length %d)\n", len(data), length)
-					// Build a minimal fileSettings if we don't have one
-					fs := fsPlain
-					if fs == nil {
-						fs = &fileSettings{size: len(data)}
-					}
-					return data, fs, nil
-				}
+		// ReadEntireFile sizes the read from the file settings
+		data, err := ntag424.ReadEntireFile(card, toNtag424Session(sess), 0x03)
+		if err != nil {
+			fmt.Printf("  DESFire ReadData failed: %v\n", err)
+			if cfg != nil && cfg.debugSecure {
+				debugSecureRead(card, attempt.key, attempt.keyNo, 0x03, fsPlain)
 			}
-			fmt.Printf("  DESFire ReadData failed for all attempted lengths: %v\n", readErr)
+			continue
+		}
+		fmt.Printf("  Successfully read %d bytes\n", len(data))
+		fs := fsPlain
+		if fs == nil {
+			fs = &fileSettings{size: len(data)}
 		}
+		return data, fs, nil
 	}
 
 	// If we got plain file settings but couldn't read data, return what we have
@@ -945,6 +899,53 @@ func readFile3(card *scard.Card, cfg *readerConfig) ([]byte, *fileSettings, erro
 	return nil, nil, fmt.Errorf("authentication failed with all available keys and slots (last error: %v)", lastAuthErr)
 }
 
+// debugSecureRead authenticates again and repeats the first ReadData chunk
+// of fileNo in the file's comm mode, printing the raw response and its MAC
+// whether or not they verify, for -debug-secure. The comm mode and size come
+// from fs, the settings already read; if there are none they are read over
+// the new session.
+func debugSecureRead(card ntag424.Card, key []byte, keyNo, fileNo byte, fs *fileSettings) {
+	if err := selectNDEFApp(card); err != nil {
+		fmt.Printf("  [debug-secure] select failed: %v\n", err)
+		return
+	}
+	sess, err := ntag424.AuthenticateEV2First(card, key, keyNo)
+	if err != nil {
+		fmt.Printf("  [debug-secure] re-auth failed: %v\n", err)
+		return
+	}
+	var mode ntag424.CommMode
+	var size int
+	if fs != nil {
+		mode, size = ntag424.CommMode(fs.fileOption&0x03), fs.size
+	} else {
+		settings, err := ntag424.GetFileSettings(card, sess, fileNo)
+		if err != nil {
+			fmt.Printf("  [debug-secure] file settings: %v\n", err)
+			return
+		}
+		mode, size = ntag424.CommMode(settings.FileOption&0x03), settings.Size
+	}
+	if mode == ntag424.CommModePlain || size == 0 {
+		fmt.Printf("  [debug-secure] file %d is %s with %d bytes: no secure response to show\n", fileNo, mode, size)
+		return
+	}
+	if size > 128 {
+		size = 128 // the chunk ReadEntireFile reads first
+	}
+	// ReadData, offset 0, as ReadEntireFile sends it
+	cmdData := []byte{fileNo, 0x00, 0x00, 0x00, byte(size), 0x00, 0x00}
+	plain, raw, respMAC, err := ntag424.SsmCmdDebug(card, sess, mode, 0xBD, nil, cmdData)
+	fmt.Printf("  [debug-secure] %s read of %d bytes\n", mode, size)
+	fmt.Printf("  [debug-secure] raw response: %s\n", hexUpper(raw))
+	fmt.Printf("  [debug-secure] response MAC: %s\n", hexUpper(respMAC))
+	if err != nil {
+		fmt.Printf("  [debug-secure] error: %v\n", err)
+		return
+	}
+	fmt.Printf("  [debug-secure] plaintext:    %s\n", hexUpper(plain))
+}
+
 func printFile3(data []byte, fs *fileSettings, cfg *readerConfig) {
 	fmt.Println("File 3 (proprietary):")
 
@@ -970,16 +971,28 @@ func printFile3(data []byte, fs *fileSettings, cfg *readerConfig) {
 		fmt.Printf("  Comm mode:    %s\n", commModeStr)
 
 		// Display access rights
-		r := (fs.ar2 >> 4) & 0x0F
-		w := fs.ar2 & 0x0F
-		fmt.Printf("  Read access:  %s\n", accessLabel(r, cfg))
-		fmt.Printf("  Write access: %s\n", accessLabel(w, cfg))
+		ar := fs.accessRights()
+		fmt.Printf("  Read access:  %s\n", accessLabel(ar.Read, cfg))
+		fmt.Printf("  Write access: %s\n", accessLabel(ar.Write, cfg))
 	}
 
 	// Display raw data
 	if len(data) == 0 {
 		fmt.Println("  Raw:          (empty)")
-	} else {
-		fmt.Printf("  Raw:          %s\n", hexUpper(data))
+		return
+	}
+	fmt.Printf("  Raw:          %s\n", hexUpper(data))
+
+	if cfg.proprietaryDecoder == nil {
+		return
+	}
+	fields, err := cfg.proprietaryDecoder.Describe(data)
+	if err != nil {
+		fmt.Printf("  Decoded:      (not a proprietary record: %v)\n", err)
+		return
+	}
+	fmt.Println("  Decoded:")
+	for _, f := range fields {
+		fmt.Printf("    %-10s %s\n", f.Name+":", f.Value)
 	}
 }
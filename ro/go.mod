@@ -2,4 +2,7 @@ module github.com/barnettlynn/nfctools/ro
 
 go 1.21
 
-require github.com/ebfe/scard v0.0.0-20241214075232-7af069cabc25
+require (
+	github.com/ebfe/scard v0.0.0-20241214075232-7af069cabc25 // indirect
+	gopkg.in/yaml.v3 v3.0.1
+)
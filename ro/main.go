@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -10,20 +11,32 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
-	"time"
 
-	"github.com/ebfe/scard"
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
 )
 
-func readAndPrint(ctx *scard.Context, reader string, cfg *readerConfig) {
-	card, err := ctx.Connect(reader, scard.ShareShared, scard.ProtocolAny)
-	if err != nil {
-		log.Printf("Connect failed: %v", err)
+func readAndPrint(conn *ntag424.Connection, cfg *readerConfig) {
+	// Every command goes through conn so a reset card is reconnected and the
+	// APDU resent; a tag left idle on the reader may have been reset already.
+	if err := conn.EnsureCard(); err != nil {
+		log.Printf("Card error: %v", err)
+		return
+	}
+	var card ntag424.Card = conn
+
+	if cfg.ndefRaw {
+		if err := streamNDEF(os.Stdout, card, cfg.ndefLayout); err != nil {
+			log.Printf("NDEF error: %v", err)
+		}
+		return
+	}
+	if cfg.jsonOutput {
+		if err := writeScanReport(os.Stdout, buildScanReport(card, cfg)); err != nil {
+			log.Printf("JSON encode failed: %v", err)
+		}
 		return
 	}
-	defer card.Disconnect(scard.LeaveCard)
 
 	uid, err := getUID(card)
 	if err != nil {
@@ -41,10 +54,10 @@ func readAndPrint(ctx *scard.Context, reader string, cfg *readerConfig) {
 	}
 
 	// List applications and files
-	apps, err := getApplicationIDs(card)
+	// NTAG 424 DNA rejects GetApplicationIDs; that reads as no applications.
+	apps, err := ntag424.GetApplicationIDs(card)
 	if err != nil {
-		// NTAG 424 DNA doesn't support GetApplicationIDs command - skip silently
-		fmt.Println("Applications: (not available on this tag)")
+		log.Printf("Applications error: %v", err)
 	} else {
 		printApplications(card, apps)
 	}
@@ -55,18 +68,31 @@ func readAndPrint(ctx *scard.Context, reader string, cfg *readerConfig) {
 	// Show detailed file settings and access rights
 	printFilesInfo(card, cfg)
 
+	// Show allocated vs used bytes per file and free memory
+	printStorage(card, cfg)
+
+	// Show what each loaded key may do (opt-in: probing costs failed auths)
+	if cfg.analyze {
+		printKeyCapabilities(card, cfg)
+	}
+
 	// Read and display NDEF (moved here after file settings)
-	ndef, err := readNDEF(card)
+	ndef, err := readNDEF(card, cfg.ndefLayout)
 	if err != nil {
 		log.Printf("NDEF error: %v", err)
 	} else if len(ndef) == 0 {
 		fmt.Println("NDEF: (empty)")
 	} else {
 		fmt.Printf("NDEF: %s\n", hexUpper(ndef))
-		printNDEFInfo(ndef)
-		if url, err := decodeNDEFURI(ndef); err == nil {
-			fmt.Printf("URL: %s\n", url)
-			printSDMVerify(url, cfg.sdmKey, cfg.sdmKeyLabel, cfg.sdmKeyNo)
+		records, err := ntag424.ParseNDEFMessage(ndef)
+		if err != nil {
+			log.Printf("NDEF parse error: %v", err)
+		} else {
+			printNDEFInfo(records)
+			if url, ok := firstNDEFURI(records); ok {
+				fmt.Printf("URL: %s\n", url)
+				printSDMVerify(url, cfg.sdmKey, cfg.sdmKeyLabel, cfg.sdmKeyNo)
+			}
 		}
 	}
 
@@ -90,6 +116,9 @@ func readAndPrint(ctx *scard.Context, reader string, cfg *readerConfig) {
 func main() {
 	verbose := flag.Bool("v", false, "enable debug logging")
 	logFormat := flag.String("log-format", "text", "log format: text or json")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
+	analyze := flag.Bool("analyze", false, "print which slots each loaded key matches and what it may do with each file")
+	debugSecure := flag.Bool("debug-secure", false, "when a secure read fails, repeat it once and print the raw encrypted response and MAC")
 	authKeyFile := flag.String("auth-key-file", filepath.Join("..", "keys", "AppMasterKey.hex"), "path to AppMasterKey file (KeyNo 0)")
 	authKeyHex := flag.String("auth-key", "", "optional 32-hex auth key")
 	authKeyNo := flag.Int("auth-keyno", 0, "auth key number (default: 0)")
@@ -97,7 +126,15 @@ func main() {
 	sdmKeyHex := flag.String("sdm-key", "", "optional 32-hex SDM key")
 	sdmKeyNo := flag.Int("sdm-keyno", 1, "SDM key number (default: 1)")
 	fileNo := flag.Int("file", 2, "file number for SDM settings (default: 2)")
+	ndefLayout := flag.String("ndef-layout", "nlen2", "NDEF file framing: nlen2 (2-byte NLEN, NTAG 424 default) or tlv (NDEF Message TLV)")
 	fullProbe := flag.Bool("full-probe", false, "probe all 16 key slots (default: probe only expected slots)")
+	jsonOutput := flag.Bool("json", false, "emit one JSON object per scan on stdout instead of text")
+	ndefRaw := flag.Bool("ndef-raw", false, "stream each scanned tag's raw NDEF message to stdout instead of the report")
+	decodeProprietary := flag.Bool("decode-proprietary", false, "decode file 3 as a TLV proprietary record after the raw dump")
+	slotRolesFile := flag.String("slot-roles", "", "YAML file with slot_roles labels for key slots (default: standard layout)")
+	shareFlag := flag.String("share", "shared", "PC/SC share mode: shared or exclusive")
+	protocolFlag := flag.String("protocol", "any", "PC/SC protocol: any, t0 or t1")
+	settingsCacheTTL := flag.Duration("settings-cache-ttl", 0, "reuse file settings for a UID seen again within this long (0 = always re-read)")
 	flag.Parse()
 
 	// Configure slog
@@ -111,6 +148,14 @@ func main() {
 	} else {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
 	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("-trace: %v", err)
+		}
+		defer f.Close()
+		ntag424.EnableAPDUTrace(f, true)
+	}
 
 	if *authKeyNo < 0 || *authKeyNo > 15 {
 		log.Fatalf("-auth-keyno must be 0..15")
@@ -122,6 +167,19 @@ func main() {
 		log.Fatalf("-file must be 0..31")
 	}
 
+	layout, err := ntag424.ParseNDEFLayout(*ndefLayout)
+	if err != nil {
+		log.Fatalf("-ndef-layout: %v", err)
+	}
+	share, err := ntag424.ParseShareMode(*shareFlag)
+	if err != nil {
+		log.Fatalf("-share: %v", err)
+	}
+	proto, err := ntag424.ParseProtocol(*protocolFlag)
+	if err != nil {
+		log.Fatalf("-protocol: %v", err)
+	}
+
 	var authKey []byte
 	authKeyLabel := ""
 	if *authKeyHex != "" {
@@ -181,7 +239,9 @@ func main() {
 
 	ndefKeyPath := filepath.Join("..", "keys", "FileTwoWrite.hex")
 	ndefKeyLabel := ndefKeyPath
-	if _, err := os.Stat(ndefKeyPath); err != nil {
+	ndefKey, err := loadKeyHexFile(ndefKeyPath)
+	if err != nil {
+		ndefKey = nil
 		ndefKeyLabel = fmt.Sprintf("%s (missing)", ndefKeyPath)
 	}
 
@@ -192,89 +252,68 @@ func main() {
 		sdmKey:       sdmKey,
 		sdmKeyLabel:  sdmKeyLabel,
 		sdmKeyNo:     byte(*sdmKeyNo),
+		ndefKey:      ndefKey,
 		ndefKeyLabel: ndefKeyLabel,
 		ndefKeyNo:    0x02,
 		fileNo:       byte(*fileNo),
+		ndefLayout:   layout,
 		fullProbe:    *fullProbe,
+		jsonOutput:   *jsonOutput,
+		ndefRaw:      *ndefRaw,
+		debugSecure:  *debugSecure,
+		analyze:      *analyze,
 	}
-
-	ctx, err := scard.EstablishContext()
-	if err != nil {
-		log.Fatalf("EstablishContext failed: %v", err)
+	if *decodeProprietary {
+		cfg.proprietaryDecoder = ntag424.RecordDecoder{}
+	}
+	if *slotRolesFile != "" {
+		roles, err := loadSlotRoles(*slotRolesFile)
+		if err != nil {
+			log.Fatalf("-slot-roles error: %v", err)
+		}
+		cfg.slotRoles = roles
+	}
+	if *settingsCacheTTL > 0 {
+		cfg.settingsCache = ntag424.NewSettingsCache(*settingsCacheTTL)
 	}
-	defer ctx.Release()
 
-	// Set up signal handling for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-sigCh
-		fmt.Printf("\nReceived %v, shutting down...\n", sig)
-		ctx.Release()
-		os.Exit(0)
-	}()
+	// Keep stdout machine-readable in -json and -ndef-raw modes.
+	statusOut := os.Stdout
+	if cfg.jsonOutput || cfg.ndefRaw {
+		statusOut = os.Stderr
+	}
 
-	readers, err := ctx.ListReaders()
+	readers, err := ntag424.ListReaders()
 	if err != nil || len(readers) == 0 {
 		log.Fatalf("No readers found: %v", err)
 	}
 
 	readerIndex := 0
-	reader := readers[0]
-	args := flag.Args()
-	if len(args) > 0 {
+	if args := flag.Args(); len(args) > 0 {
 		arg := args[0]
 		if v, err := strconv.Atoi(arg); err == nil {
-			if v >= 0 && v < len(readers) {
-				readerIndex = v
-				reader = readers[readerIndex]
-			} else {
-				log.Printf("Reader index out of range (0..%d), using 0", len(readers)-1)
-			}
-		} else {
-			// Treat as a substring match on the reader name.
-			found := false
-			for i, r := range readers {
-				if strings.Contains(r, arg) {
-					readerIndex = i
-					reader = r
-					found = true
-					break
-				}
-			}
-			if !found {
-				log.Printf("Reader name not found (%s), using 0", arg)
+			if v < 0 || v >= len(readers) {
+				log.Fatalf("Reader index out of range (0..%d)", len(readers)-1)
 			}
+			readerIndex = v
+		} else if readerIndex, err = ntag424.MatchReader(readers, arg); err != nil {
+			log.Fatal(err)
 		}
 	}
-	fmt.Printf("Using reader [%d]: %s\n", readerIndex, reader)
+	reader := readers[readerIndex]
+	fmt.Fprintf(statusOut, "Using reader [%d]: %s\n", readerIndex, reader)
 
-	states := []scard.ReaderState{{
-		Reader:       reader,
-		CurrentState: scard.StateUnaware,
-	}}
-	cardPresent := false
-
-	fmt.Println("Waiting for card scans...")
-	for {
-		if err := ctx.GetStatusChange(states, time.Second); err != nil {
-			if err == scard.ErrTimeout {
-				continue
-			}
-			log.Printf("GetStatusChange error: %v", err)
-			continue
-		}
-
-		rs := states[0]
-		if (rs.EventState&scard.StatePresent) != 0 && !cardPresent {
-			cardPresent = true
-			readAndPrint(ctx, reader, cfg)
-			fmt.Println("Waiting for next scan...")
-		} else if (rs.EventState&scard.StateEmpty) != 0 && cardPresent {
-			cardPresent = false
-		}
+	// Set up signal handling for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		states[0].CurrentState = rs.EventState
+	fmt.Fprintln(statusOut, "Waiting for card scans...")
+	err = ntag424.MonitorCardsWithOptions(ctx, reader, share, proto, func(conn *ntag424.Connection) {
+		readAndPrint(conn, cfg)
+		fmt.Fprintln(statusOut, "Waiting for next scan...")
+	})
+	if err != nil {
+		log.Fatalf("Card monitor failed: %v", err)
 	}
+	fmt.Fprintln(statusOut, "\nShutting down...")
 }
-
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/ebfe/scard"
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
 )
 
 func containsByte(slice []byte, val byte) bool {
@@ -16,7 +16,7 @@ func containsByte(slice []byte, val byte) bool {
 	return false
 }
 
-func probeAuthKeySlots(card *scard.Card, key []byte, slots []byte) []byte {
+func probeAuthKeySlots(card ntag424.Card, key []byte, slots []byte) []byte {
 	if len(key) != 16 {
 		return nil
 	}
@@ -29,7 +29,7 @@ func probeAuthKeySlots(card *scard.Card, key []byte, slots []byte) []byte {
 	return matches
 }
 
-func probeAuthKey(card *scard.Card, key []byte) []byte {
+func probeAuthKey(card ntag424.Card, key []byte) []byte {
 	if len(key) != 16 {
 		return nil
 	}
@@ -93,7 +93,8 @@ func accessLabel(keyNo byte, cfg *readerConfig) string {
 	case 0x0F:
 		return "denied          (never)"
 	default:
-		// Add role label if this matches a known key slot
+		// Label the slots of the configured keys (-auth-keyno, -sdm-keyno and
+		// the File Two Write slot) first; other slots get their slot role.
 		roleLabel := ""
 		if keyNo == cfg.authKeyNo {
 			roleLabel = " <- AppMasterKey"
@@ -101,12 +102,14 @@ func accessLabel(keyNo byte, cfg *readerConfig) string {
 			roleLabel = " <- SDM key"
 		} else if keyNo == cfg.ndefKeyNo {
 			roleLabel = " <- File Two Write key"
+		} else if role := cfg.roles().Role(keyNo); role != "" {
+			roleLabel = " <- " + role + " key"
 		}
 		return fmt.Sprintf("Key slot %d      %s", keyNo, roleLabel)
 	}
 }
 
-func printProvisioningCheck(card *scard.Card, cfg *readerConfig, macVerified bool) {
+func printProvisioningCheck(card ntag424.Card, cfg *readerConfig, macVerified bool) {
 	fmt.Println("Provisioning check:")
 
 	// Probe key slots for each key file
@@ -217,17 +220,14 @@ func printProvisioningCheck(card *scard.Card, cfg *readerConfig, macVerified boo
 	// Parse file settings
 	sdmEnabled := (fs.fileOption & 0x40) != 0
 	commMode := fs.fileOption & 0x03
-	rw := (fs.ar1 >> 4) & 0x0F
-	car := fs.ar1 & 0x0F
-	r := (fs.ar2 >> 4) & 0x0F
-	w := fs.ar2 & 0x0F
+	ar := fs.accessRights()
 
 	// --- File access rights section ---
 	fmt.Printf("\n  File %d access rights:              [raw: %02X %02X]\n", cfg.fileNo, fs.ar1, fs.ar2)
-	fmt.Printf("    Read data:        %s\n", accessLabel(r, cfg))
-	fmt.Printf("    Write data:       %s\n", accessLabel(w, cfg))
-	fmt.Printf("    Read+Write:       %s\n", accessLabel(rw, cfg))
-	fmt.Printf("    Change settings:  %s\n", accessLabel(car, cfg))
+	fmt.Printf("    Read data:        %s\n", accessLabel(ar.Read, cfg))
+	fmt.Printf("    Write data:       %s\n", accessLabel(ar.Write, cfg))
+	fmt.Printf("    Read+Write:       %s\n", accessLabel(ar.ReadWrite, cfg))
+	fmt.Printf("    Change settings:  %s\n", accessLabel(ar.ChangeAccessRights, cfg))
 
 	// --- SDM config section ---
 	if sdmEnabled {
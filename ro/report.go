@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
+)
+
+// scanReport is the -json form of one tag scan. NDEF and SDM fields are
+// omitted when the tag has no NDEF URL.
+type scanReport struct {
+	UID      string              `json:"uid,omitempty"`
+	Version  *ntag424.TagVersion `json:"version,omitempty"`
+	Files    []fileReport        `json:"files"`
+	KeySlots []keySlotReport     `json:"key_slots"`
+	NDEFURL  string              `json:"ndef_url,omitempty"`
+	SDM      *sdmReport          `json:"sdm,omitempty"`
+	Errors   []string            `json:"errors,omitempty"`
+}
+
+type fileReport struct {
+	FileNo       byte                  `json:"file_no"`
+	Name         string                `json:"name"`
+	Settings     *ntag424.FileSettings `json:"settings,omitempty"`
+	AccessRights *ntag424.AccessRights `json:"access_rights,omitempty"`
+	Access       string                `json:"access,omitempty"` // e.g. "Read=free Write=slot2 ..."
+	Error        string                `json:"error,omitempty"`
+}
+
+type keySlotReport struct {
+	Slot       byte   `json:"slot"`
+	Role       string `json:"role"`
+	Status     string `json:"status"`
+	MatchedKey string `json:"matched_key,omitempty"`
+}
+
+type sdmReport struct {
+	MACMatch    bool   `json:"mac_match"`
+	Counter     uint32 `json:"counter"`
+	ComputedMAC string `json:"computed_mac,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (r *scanReport) addError(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// buildScanReport gathers the same information readAndPrint shows, without
+// printing anything.
+func buildScanReport(card ntag424.Card, cfg *readerConfig) *scanReport {
+	r := &scanReport{Files: []fileReport{}, KeySlots: []keySlotReport{}}
+
+	if uid, err := getUID(card); err != nil {
+		r.addError("uid: %v", err)
+	} else {
+		r.UID = hexUpper(uid)
+	}
+
+	if v, err := getVersion(card); err != nil {
+		r.addError("version: %v", err)
+	} else {
+		r.Version = v
+	}
+
+	r.Files = fileReports(card, cfg)
+
+	slots, _ := probeKeySlots(card, cfg)
+	for _, p := range slots {
+		r.KeySlots = append(r.KeySlots, keySlotReport{
+			Slot:       p.slot,
+			Role:       p.role,
+			Status:     p.status(),
+			MatchedKey: p.matchedKey,
+		})
+	}
+
+	ndef, err := readNDEF(card, cfg.ndefLayout)
+	if err != nil {
+		r.addError("ndef: %v", err)
+		return r
+	}
+	if len(ndef) == 0 {
+		return r
+	}
+	records, err := ntag424.ParseNDEFMessage(ndef)
+	if err != nil {
+		r.addError("ndef parse: %v", err)
+		return r
+	}
+	url, ok := firstNDEFURI(records)
+	if !ok {
+		return r
+	}
+	r.NDEFURL = url
+
+	sdm := &sdmReport{}
+	match, counter, computed, err := ntag424.VerifySDMMACDetailed(url, cfg.sdmKey)
+	if err != nil {
+		sdm.Error = err.Error()
+	} else {
+		sdm.MACMatch = match
+		sdm.Counter = counter
+		sdm.ComputedMAC = computed
+	}
+	r.SDM = sdm
+	return r
+}
+
+// fileReports reads settings, with readFileSettings, for every file
+// ListFileIDs lists before authenticating: files 1-3 on NTAG 424 DNA, which
+// refuses GetFileIDs, and every file of a DESFire application that lists them.
+func fileReports(card ntag424.Card, cfg *readerConfig) []fileReport {
+	// NTAG 424 DNA files, reported with the error if the app cannot be listed
+	fileNos := []byte{0x01, 0x02, 0x03}
+	selectErr := selectNDEFApp(card)
+	if selectErr == nil {
+		if ids, err := ntag424.ListFileIDs(card, nil); err == nil {
+			fileNos = ids
+		}
+	}
+	files := make([]fileReport, 0, len(fileNos))
+	for _, fileNo := range fileNos {
+		files = append(files, fileReport{FileNo: fileNo, Name: fileName(fileNo)})
+	}
+	if selectErr != nil {
+		for i := range files {
+			files[i].Error = fmt.Sprintf("select NDEF app: %v", selectErr)
+		}
+		return files
+	}
+
+	uid := settingsCacheUID(card, cfg)
+	for i := range files {
+		f := &files[i]
+		fs := readFileSettings(card, uid, f.FileNo, cfg)
+		if fs == nil {
+			f.Error = "could not read file settings"
+			continue
+		}
+		ar := fs.AccessRights()
+		f.Settings = fs
+		f.AccessRights = &ar
+		f.Access = ar.String()
+	}
+	return files
+}
+
+func writeScanReport(w io.Writer, r *scanReport) error {
+	return json.NewEncoder(w).Encode(r)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/barnettlynn/nfctools/pkg/ntag424"
+	"gopkg.in/yaml.v3"
+)
+
+// slotRolesFile is the -slot-roles YAML layout:
+//
+//	slot_roles:
+//	  0: AppMaster
+//	  3: Loyalty
+type slotRolesFile struct {
+	SlotRoles map[int]string `yaml:"slot_roles"`
+}
+
+// loadSlotRoles reads a -slot-roles file and applies it to
+// ntag424.DefaultSlotRoles: listed slots get the given role, an empty role
+// removes it, and unlisted slots keep the standard label.
+func loadSlotRoles(path string) (ntag424.SlotRoles, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read slot roles: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	var f slotRolesFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse slot roles yaml: %w", err)
+	}
+	return ntag424.DefaultSlotRoles().WithOverrides(f.SlotRoles)
+}
@@ -12,10 +12,23 @@ type readerConfig struct {
 	sdmKey       []byte
 	sdmKeyLabel  string
 	sdmKeyNo     byte
+	ndefKey      []byte // nil if the key file is missing
 	ndefKeyLabel string
 	ndefKeyNo    byte
 	fileNo       byte
+	ndefLayout   ntag424.NDEFLayout // framing of the NDEF file (-ndef-layout)
 	fullProbe    bool
+	jsonOutput   bool
+	ndefRaw      bool              // stream the raw NDEF message to stdout instead of the report
+	debugSecure  bool              // dump raw secure responses when a secure read fails
+	analyze      bool              // print what each loaded key may do
+	slotRoles    ntag424.SlotRoles // key slot labels; nil means ntag424.DefaultSlotRoles
+
+	// proprietaryDecoder interprets file 3 after the raw dump; nil (the
+	// default without -decode-proprietary) prints the raw bytes only.
+	proprietaryDecoder ntag424.ProprietaryDecoder
+
+	settingsCache *ntag424.SettingsCache // nil unless -settings-cache-ttl is set
 }
 
 type session struct {
@@ -23,6 +36,8 @@ type session struct {
 	kmac   [16]byte
 	ti     [4]byte
 	cmdCtr uint16
+
+	fileModes unsafe.Pointer // ntag424.Session's file comm mode cache (a map); only the library uses it
 }
 
 type fileSettings struct {
@@ -37,9 +52,14 @@ type fileSettings struct {
 	sdmCtr     byte
 }
 
+func (fs *fileSettings) accessRights() ntag424.AccessRights {
+	return ntag424.DecodeAccessRights(fs.ar1, fs.ar2)
+}
+
 type keyFile struct {
 	name string
 	key  []byte
+	slot int // declared slot from a .json key file, -1 if unknown
 }
 
 // Session conversion helpers
@@ -28,6 +28,8 @@ type Config struct {
 type SDMConfig struct {
 	FileNo   *int `yaml:"file_no"`
 	SDMKeyNo *int `yaml:"sdm_key_no"`
+	// SDMKeyHexFile is the SDM file read key; optional, only -verify uses it.
+	SDMKeyHexFile string `yaml:"sdm_key_hex_file"`
 }
 
 type AuthConfig struct {
@@ -136,6 +138,11 @@ func (c *Config) validateFullMode() error {
 	if *c.SDM.SDMKeyNo < 0 || *c.SDM.SDMKeyNo > 15 {
 		return fmt.Errorf("config.sdm.sdm_key_no must be 0..15")
 	}
+	if strings.TrimSpace(c.SDM.SDMKeyHexFile) != "" {
+		if err := validateReadableFile(c.SDM.SDMKeyHexFile, "config.sdm.sdm_key_hex_file"); err != nil {
+			return err
+		}
+	}
 
 	if err := c.validateAuthDiagMode(); err != nil {
 		return err
@@ -168,6 +175,7 @@ func (c *Config) resolvePaths(configPath string) {
 	configDir := filepath.Dir(configPath)
 	c.Auth.SettingsKeyHexFile = resolvePath(configDir, c.Auth.SettingsKeyHexFile)
 	c.Auth.File2WriteKeyFile = resolvePath(configDir, c.Auth.File2WriteKeyFile)
+	c.SDM.SDMKeyHexFile = resolvePath(configDir, c.SDM.SDMKeyHexFile)
 }
 
 func resolvePath(baseDir, path string) string {
@@ -17,6 +17,10 @@ func TestLoadValidFullConfigAndResolveRelativePaths(t *testing.T) {
 	if err := os.WriteFile(writeKeyPath, []byte("FFEEDDCCBBAA99887766554433221100\n"), 0o644); err != nil {
 		t.Fatalf("write write key: %v", err)
 	}
+	sdmKeyPath := filepath.Join(tmp, "sdm.hex")
+	if err := os.WriteFile(sdmKeyPath, []byte("11111111111111111111111111111111\n"), 0o644); err != nil {
+		t.Fatalf("write sdm key: %v", err)
+	}
 
 	cfgPath := filepath.Join(tmp, "config.yaml")
 	cfgYAML := `
@@ -24,6 +28,7 @@ url: "https://example.com/tap"
 sdm:
   file_no: 2
   sdm_key_no: 1
+  sdm_key_hex_file: "sdm.hex"
 auth:
   settings_key_no: 0
   settings_key_hex_file: "settings.hex"
@@ -49,6 +54,9 @@ runtime:
 	if cfg.Auth.File2WriteKeyFile != writeKeyPath {
 		t.Fatalf("expected resolved write key path %q, got %q", writeKeyPath, cfg.Auth.File2WriteKeyFile)
 	}
+	if cfg.SDM.SDMKeyHexFile != sdmKeyPath {
+		t.Fatalf("expected resolved SDM key path %q, got %q", sdmKeyPath, cfg.SDM.SDMKeyHexFile)
+	}
 }
 
 func TestLoadWithModeAuthDiagAllowsMinimalConfig(t *testing.T) {
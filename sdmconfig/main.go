@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -17,10 +18,13 @@ const configFileName = "config.yaml"
 func main() {
 	verbose := flag.Bool("v", false, "enable debug logging")
 	logFormat := flag.String("log-format", "text", "log format: text or json")
+	traceFile := flag.String("trace", "", "write a JSON trace of every APDU to this file (key material redacted)")
 	diagAuth := flag.Bool("diag-auth", false, "diagnose EV2 authentication across key slots and exit")
 	disableSDM := flag.Bool("disable-sdm", false, "disable SDM on the tag and exit")
 	enableSDM := flag.Bool("enable-sdm", false, "enable SDM on the tag (assumes SDM is currently disabled)")
 	updateSDM := flag.Bool("update-sdm", false, "update NDEF when SDM is enabled (disable -> write -> re-enable)")
+	rewriteURL := flag.Bool("rewrite-url", false, "rewrite the SDM URL in place, only if the SDM offsets stay the same")
+	verify := flag.Bool("verify", false, "read the tag like a phone tap and check the SDM URL verifies, then exit")
 	flag.Parse()
 
 	// Configure slog
@@ -34,6 +38,14 @@ func main() {
 	} else {
 		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
 	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("-trace: %v", err)
+		}
+		defer f.Close()
+		ntag424.EnableAPDUTrace(f, true)
+	}
 
 	configPath, err := defaultConfigPath()
 	if err != nil {
@@ -61,6 +73,16 @@ func main() {
 		return
 	}
 
+	if *rewriteURL {
+		runRewriteURL(configPath)
+		return
+	}
+
+	if *verify {
+		runVerify(configPath)
+		return
+	}
+
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		log.Fatalf("config load failed: %v", err)
@@ -99,10 +121,11 @@ func main() {
 
 	fileNo := byte(*cfg.SDM.FileNo)
 	sdmKeyNo := byte(*cfg.SDM.SDMKeyNo)
+	profile := ntag424.DefaultGuideApparelProfile()
+	profile.SDMFile, profile.SDMCtr = sdmKeyNo, sdmKeyNo
 
 	// Get current settings to preserve AR values
-	targetAR1 := byte(0x20) // Standard: RW=slot 2, Change=slot 0
-	targetAR2 := byte(0xE2) // Standard: Read=free, Write=slot 2
+	targetAR1, targetAR2 := profile.AccessRightsBytes() // Standard: Read=free, Write=slot 2, RW=slot 2, Change=slot 0
 	currentFS, err := ntag424.GetFileSettings(conn.Card, settingsSess, fileNo)
 	if err != nil {
 		slog.Debug("GetFileSettings failed, using standard AR", "error", err)
@@ -121,13 +144,13 @@ func main() {
 	}
 
 	fs := &ntag424.FileSettings{
-		FileOption: 0x40,
+		FileOption: 0x40 | profile.CommMode&0x03,
 		AR1:        targetAR1,
 		AR2:        targetAR2,
-		SDMOptions: 0xC1,
-		SDMMeta:    0x0E,
-		SDMFile:    sdmKeyNo,
-		SDMCtr:     sdmKeyNo,
+		SDMOptions: profile.SDMOptions,
+		SDMMeta:    profile.SDMMeta,
+		SDMFile:    profile.SDMFile,
+		SDMCtr:     profile.SDMCtr,
 	}
 
 	ntag424.PrintFileSettings("TARGET", fileNo, fs)
@@ -309,10 +332,11 @@ func runEnableSDM(configPath string) {
 
 	fileNo := byte(*cfg.SDM.FileNo)
 	sdmKeyNo := byte(*cfg.SDM.SDMKeyNo)
+	profile := ntag424.DefaultGuideApparelProfile()
+	profile.SDMFile, profile.SDMCtr = sdmKeyNo, sdmKeyNo
 
 	// Get current file settings to preserve AR values if they're non-standard
-	targetAR1 := byte(0x20) // Standard: RW=slot 2, Change=slot 0
-	targetAR2 := byte(0xE2) // Standard: Read=free, Write=slot 2
+	targetAR1, targetAR2 := profile.AccessRightsBytes() // Standard: Read=free, Write=slot 2, RW=slot 2, Change=slot 0
 	currentFS, err := ntag424.GetFileSettings(conn.Card, settingsSess, fileNo)
 	if err != nil {
 		slog.Debug("GetFileSettings failed, using standard AR", "error", err)
@@ -338,13 +362,13 @@ func runEnableSDM(configPath string) {
 	}
 
 	fs := &ntag424.FileSettings{
-		FileOption: 0x40, // Enable SDM
+		FileOption: 0x40 | profile.CommMode&0x03, // Enable SDM in the profile's comm mode
 		AR1:        targetAR1,
 		AR2:        targetAR2,
-		SDMOptions: 0xC1,
-		SDMMeta:    0x0E,
-		SDMFile:    sdmKeyNo,
-		SDMCtr:     sdmKeyNo,
+		SDMOptions: profile.SDMOptions,
+		SDMMeta:    profile.SDMMeta,
+		SDMFile:    profile.SDMFile,
+		SDMCtr:     profile.SDMCtr,
 	}
 
 	ntag424.PrintFileSettings("TARGET", fileNo, fs)
@@ -416,6 +440,8 @@ func runUpdateSDM(configPath string) {
 
 	fileNo := byte(*cfg.SDM.FileNo)
 	sdmKeyNo := byte(*cfg.SDM.SDMKeyNo)
+	profile := ntag424.DefaultGuideApparelProfile()
+	profile.SDMFile, profile.SDMCtr = sdmKeyNo, sdmKeyNo
 
 	// STEP 1: Disable SDM
 	fmt.Println("========================================")
@@ -432,8 +458,7 @@ func runUpdateSDM(configPath string) {
 	}
 
 	// Get current settings to preserve original AR values
-	originalAR1 := byte(0x20) // Standard: RW=slot 2, Change=slot 0
-	originalAR2 := byte(0xE2) // Standard: Read=free, Write=slot 2
+	originalAR1, originalAR2 := profile.AccessRightsBytes() // Standard: Read=free, Write=slot 2, RW=slot 2, Change=slot 0
 	currentFS, err := ntag424.GetFileSettings(conn.Card, settingsSess, fileNo)
 	if err != nil {
 		slog.Debug("GetFileSettings failed, using standard AR", "error", err)
@@ -493,13 +518,13 @@ func runUpdateSDM(configPath string) {
 	}
 
 	fsEnable := &ntag424.FileSettings{
-		FileOption: 0x40,
+		FileOption: 0x40 | profile.CommMode&0x03,
 		AR1:        originalAR1,
 		AR2:        originalAR2,
-		SDMOptions: 0xC1,
-		SDMMeta:    0x0E,
-		SDMFile:    sdmKeyNo,
-		SDMCtr:     sdmKeyNo,
+		SDMOptions: profile.SDMOptions,
+		SDMMeta:    profile.SDMMeta,
+		SDMFile:    profile.SDMFile,
+		SDMCtr:     profile.SDMCtr,
 	}
 
 	ntag424.PrintFileSettings("TARGET", fileNo, fsEnable)
@@ -536,6 +561,82 @@ func runUpdateSDM(configPath string) {
 	fmt.Println("========================================")
 }
 
+// runRewriteURL writes the configured URL over the current SDM NDEF without
+// disabling SDM, refusing if the uid/ctr/mac offsets would move.
+func runRewriteURL(configPath string) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("config load failed: %v", err)
+	}
+
+	settingsKey, err := ntag424.LoadKeyHexFile(cfg.Auth.SettingsKeyHexFile)
+	if err != nil {
+		log.Fatalf("settings key file invalid: %v", err)
+	}
+	file2WriteKey, err := ntag424.LoadKeyHexFile(cfg.Auth.File2WriteKeyFile)
+	if err != nil {
+		log.Fatalf("file2 write key file invalid: %v", err)
+	}
+
+	conn, err := ntag424.Connect(*cfg.Runtime.ReaderIndex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Printf("Using reader [%d]: %s\n", conn.ReaderIdx, conn.Reader)
+
+	err = ntag424.RewriteSDMURL(conn, settingsKey, byte(*cfg.Auth.SettingsKeyNo), file2WriteKey, cfg.URL)
+	var shift *ntag424.SDMOffsetShiftError
+	if errors.As(err, &shift) {
+		log.Fatalf("%v; use -update-sdm to move the SDM offsets", err)
+	}
+	if err != nil {
+		log.Fatalf("Rewrite SDM URL failed: %v", err)
+	}
+	fmt.Printf("SDM URL rewritten: %s\n", cfg.URL)
+}
+
+// runVerify checks a provisioned tag end to end: the URL it mirrors on a
+// read must match GenerateSDMURL for its real UID and counter and verify
+// with the SDM key. Exits non-zero on FAIL.
+func runVerify(configPath string) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("config load failed: %v", err)
+	}
+	if cfg.SDM.SDMKeyHexFile == "" {
+		log.Fatalf("-verify needs config.sdm.sdm_key_hex_file")
+	}
+	sdmKey, err := ntag424.LoadKeyHexFile(cfg.SDM.SDMKeyHexFile)
+	if err != nil {
+		log.Fatalf("sdm key file invalid: %v", err)
+	}
+
+	conn, err := ntag424.Connect(*cfg.Runtime.ReaderIndex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Printf("Using reader [%d]: %s\n", conn.ReaderIdx, conn.Reader)
+
+	// The template comes from BuildSDMNDEF, so the default parameter names apply.
+	check, err := ntag424.CheckSDMTap(conn.Card, sdmKey, byte(*cfg.SDM.SDMKeyNo), byte(*cfg.SDM.FileNo), ntag424.DefaultSDMParamConfig())
+	if err != nil {
+		log.Fatalf("Verify SDM failed: %v", err)
+	}
+	fmt.Printf("Tap URL:      %s\n", check.TapURL)
+	fmt.Printf("Expected URL: %s\n", check.Expected)
+	fmt.Printf("UID=%X counter=%d\n", check.UID, check.Counter)
+	if !check.OK() {
+		for _, p := range check.Problems {
+			fmt.Printf("  - %s\n", p)
+		}
+		fmt.Println("Verify: FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("Verify: OK")
+}
+
 func runAuthDiagnostics(configPath string) {
 	cfg, err := config.LoadWithMode(configPath, config.ValidationAuthDiag)
 	if err != nil {